@@ -0,0 +1,137 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"slices"
+	"strings"
+
+	"github.com/harrydayexe/GoWebUtilities/crashreport"
+	"github.com/harrydayexe/GoWebUtilities/diagnostics"
+	"github.com/harrydayexe/GoWebUtilities/logging"
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+)
+
+func init() {
+	// Serve the middleware's counters on /debug/vars with the runtime's.
+	expvar.Publish("middleware", expvar.Func(func() any { return middleware.Metrics() }))
+}
+
+// Options configures a Handler. Zero values are defaults.
+type Options struct {
+	// Token is the bearer token requests must present in the Authorization
+	// header. Empty means token authorization is disabled.
+	Token string
+	// AllowClientCerts authorizes requests whose connection presented a
+	// client certificate verified by the TLS server, for mutual TLS setups.
+	AllowClientCerts bool
+	// Config is the configuration shown by /config. Fields whose names
+	// suggest a secret are masked. Nil means /config is not mounted.
+	Config any
+	// Maintenance is the switch served at GET and PUT /maintenance. Nil
+	// means /maintenance is not mounted.
+	Maintenance *Maintenance
+}
+
+// Handler routes admin requests after authorizing them. It is an
+// http.Handler. Endpoints must be added with Handle before it starts serving.
+type Handler struct {
+	mux      *http.ServeMux
+	opts     Options
+	patterns []string
+}
+
+// NewHandler returns a Handler with the built-in endpoints mounted (see the
+// package documentation). With neither Token nor AllowClientCerts set, every
+// request is refused.
+func NewHandler(opts Options) *Handler {
+	h := &Handler{mux: http.NewServeMux(), opts: opts}
+	h.mux.HandleFunc("GET /{$}", h.index)
+
+	h.Handle("GET /debug/pprof/", http.HandlerFunc(pprof.Index))
+	h.Handle("GET /debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
+	h.Handle("GET /debug/pprof/profile", http.HandlerFunc(pprof.Profile))
+	h.Handle("GET /debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
+	h.Handle("GET /debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+	// Requests reaching the mux have already been authorized.
+	h.Handle("GET /debug/profiles", diagnostics.NewProfileHandler(func(*http.Request) bool { return true }))
+	h.Handle("GET /debug/vars", expvar.Handler())
+
+	h.Handle("GET /loglevel", http.HandlerFunc(getLogLevel))
+	h.Handle("PUT /loglevel", http.HandlerFunc(setLogLevel))
+
+	if opts.Config != nil {
+		h.Handle("GET /config", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(crashreport.MaskedConfig(opts.Config)))
+		}))
+	}
+	if opts.Maintenance != nil {
+		h.Handle("GET /maintenance", http.HandlerFunc(opts.Maintenance.get))
+		h.Handle("PUT /maintenance", http.HandlerFunc(opts.Maintenance.set))
+	}
+	return h
+}
+
+// Handle mounts handler on the admin router at pattern, which follows
+// http.ServeMux conventions (for example "POST /cache/purge"). It panics if
+// the pattern conflicts with one already mounted.
+func (h *Handler) Handle(pattern string, handler http.Handler) {
+	h.mux.Handle(pattern, handler)
+	h.patterns = append(h.patterns, pattern)
+}
+
+// ServeHTTP authorizes the request and routes it to the mounted endpoint.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// authorized reports whether r carries the token or a verified client certificate.
+func (h *Handler) authorized(r *http.Request) bool {
+	if h.opts.AllowClientCerts && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	if h.opts.Token == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(h.opts.Token)) == 1
+}
+
+// index lists the mounted endpoints.
+func (h *Handler) index(w http.ResponseWriter, r *http.Request) {
+	patterns := slices.Sorted(slices.Values(h.patterns))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, p := range patterns {
+		fmt.Fprintln(w, p)
+	}
+}
+
+// getLogLevel writes the default logger's level.
+func getLogLevel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, logging.Level())
+}
+
+// setLogLevel changes the default logger's level to the level query parameter.
+func setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(r.URL.Query().Get("level"))); err != nil {
+		http.Error(w, fmt.Sprintf("invalid level: %v", err), http.StatusBadRequest)
+		return
+	}
+	previous := logging.Level()
+	logging.SetLevel(level)
+	slog.InfoContext(r.Context(), "log level changed", slog.String("from", previous.String()), slog.String("to", level.String()))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, level)
+}
@@ -0,0 +1,152 @@
+package admin
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+	"github.com/harrydayexe/GoWebUtilities/logging"
+)
+
+// get sends a GET request for path to h with the given bearer token.
+func get(h http.Handler, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestHandler_Authorization(t *testing.T) {
+	h := NewHandler(Options{Token: "s3cret"})
+
+	for _, token := range []string{"", "wrong"} {
+		w := get(h, "/loglevel", token)
+		if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("token %q: got %d, want 401 with challenge", token, w.Code)
+		}
+	}
+	if w := get(h, "/loglevel", "s3cret"); w.Code != http.StatusOK {
+		t.Errorf("valid token: got %d, want 200", w.Code)
+	}
+
+	if w := get(NewHandler(Options{}), "/loglevel", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("no authorization configured: got %d, want 401", w.Code)
+	}
+}
+
+func TestHandler_ClientCertificate(t *testing.T) {
+	h := NewHandler(Options{AllowClientCerts: true})
+	req := httptest.NewRequest("GET", "/loglevel", nil)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("verified client certificate: got %d, want 200", w.Code)
+	}
+
+	req.TLS = &tls.ConnectionState{}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unverified connection: got %d, want 401", w.Code)
+	}
+}
+
+func TestHandler_LogLevel(t *testing.T) {
+	original := slog.Default()
+	defer slog.SetDefault(original)
+	logging.SetDefaultLogger(config.ServerConfig{Environment: config.Production, LogLevel: slog.LevelWarn})
+
+	h := NewHandler(Options{Token: "t"})
+	req := httptest.NewRequest("PUT", "/loglevel?level=debug", nil)
+	req.Header.Set("Authorization", "Bearer t")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || logging.Level() != slog.LevelDebug {
+		t.Errorf("PUT /loglevel: got %d, level %v", w.Code, logging.Level())
+	}
+	if w := get(h, "/loglevel", "t"); w.Body.String() != "DEBUG\n" {
+		t.Errorf("GET /loglevel = %q, want DEBUG", w.Body.String())
+	}
+
+	req = httptest.NewRequest("PUT", "/loglevel?level=loud", nil)
+	req.Header.Set("Authorization", "Bearer t")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid level: got %d, want 400", w.Code)
+	}
+}
+
+func TestHandler_ConfigAndIndex(t *testing.T) {
+	h := NewHandler(Options{Token: "t", Config: config.ServerConfig{Port: 8080, AdminToken: "t"}})
+	h.Handle("POST /cache/purge", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	body := get(h, "/config", "t").Body.String()
+	if !strings.Contains(body, "Port: 8080") || !strings.Contains(body, "AdminToken: [MASKED]") {
+		t.Errorf("unexpected config dump:\n%s", body)
+	}
+
+	index := get(h, "/", "t").Body.String()
+	for _, want := range []string{"GET /config", "GET /debug/pprof/", "PUT /loglevel", "POST /cache/purge"} {
+		if !strings.Contains(index, want) {
+			t.Errorf("index should list %q, got:\n%s", want, index)
+		}
+	}
+	if w := get(h, "/debug/pprof/cmdline", "t"); w.Code != http.StatusOK {
+		t.Errorf("pprof: got %d, want 200", w.Code)
+	}
+	if w := get(h, "/debug/vars", "t"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"memstats"`) ||
+		!strings.Contains(w.Body.String(), `"middleware"`) {
+		t.Errorf("expvar: got %d %.40q", w.Code, w.Body.String())
+	}
+}
+
+func TestHandler_Maintenance(t *testing.T) {
+	var m Maintenance
+	h := NewHandler(Options{Token: "t", Maintenance: &m})
+	app := m.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	put := func(query string) int {
+		req := httptest.NewRequest("PUT", "/maintenance?"+query, nil)
+		req.Header.Set("Authorization", "Bearer t")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if w := get(app, "/", ""); w.Code != http.StatusOK {
+		t.Errorf("maintenance off: got %d, want 200", w.Code)
+	}
+	if code := put("enabled=true"); code != http.StatusOK || !m.Enabled() {
+		t.Errorf("PUT enabled=true: got %d, enabled %v", code, m.Enabled())
+	}
+	if w := get(h, "/maintenance", "t"); w.Body.String() != "true\n" {
+		t.Errorf("GET /maintenance = %q, want true", w.Body.String())
+	}
+	w := get(app, "/", "")
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"maintenance"`) {
+		t.Errorf("maintenance on: got %d %s, want 503 with reason maintenance", w.Code, w.Body.String())
+	}
+
+	if code := put("enabled=maybe"); code != http.StatusBadRequest || !m.Enabled() {
+		t.Errorf("invalid value: got %d, enabled %v", code, m.Enabled())
+	}
+	if code := put("enabled=false"); code != http.StatusOK {
+		t.Errorf("PUT enabled=false: got %d", code)
+	}
+	if w := get(app, "/", ""); w.Code != http.StatusOK {
+		t.Errorf("maintenance switched off: got %d, want 200", w.Code)
+	}
+	if w := get(NewHandler(Options{Token: "t"}), "/maintenance", "t"); w.Code != http.StatusNotFound {
+		t.Errorf("without Options.Maintenance: got %d, want 404", w.Code)
+	}
+}
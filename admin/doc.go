@@ -0,0 +1,37 @@
+// Package admin provides a router for operational endpoints, protected by a
+// single authorization check, to be served on a separate admin port.
+//
+// NewHandler mounts the built-in endpoints:
+//
+//	GET       /                 list of the mounted endpoints
+//	GET       /debug/pprof/     net/http/pprof profiles and index
+//	GET       /debug/profiles   tar.gz bundle of profiles (diagnostics.NewProfileHandler)
+//	GET       /debug/vars       expvar variables as JSON, including memstats and
+//	                            the "middleware" counters (middleware.Metrics)
+//	GET, PUT  /loglevel         read or change the default logger's level
+//	GET       /config           configuration snapshot with secrets masked
+//	GET, PUT  /maintenance      read or switch maintenance mode (with
+//	                            Options.Maintenance)
+//
+// A Maintenance switch turns maintenance mode on and off; its Middleware,
+// installed on the public handler (server.WithMaintenance does so), answers
+// every request with 503 while it is on:
+//
+//	curl -X PUT -H "Authorization: Bearer s3cret" "localhost:9090/maintenance?enabled=true"
+//
+// Importing net/http/pprof and expvar, as this package does, also registers
+// their handlers on http.DefaultServeMux, so the public listener should serve
+// a mux of its own rather than the default one.
+//
+// Other subsystems add their endpoints with Handle, so that every sensitive
+// endpoint sits behind the same authorization rather than being wired up and
+// protected individually.
+//
+// Requests are authorized by a bearer token or by a client certificate that
+// the TLS server has verified (mutual TLS); everything else is answered with
+// 401. server.Run serves a Handler on ADMIN_PORT when it is set:
+//
+//	ADMIN_PORT=9090 ADMIN_TOKEN=s3cret ./service
+//	curl -H "Authorization: Bearer s3cret" localhost:9090/loglevel
+//	curl -X PUT -H "Authorization: Bearer s3cret" "localhost:9090/loglevel?level=DEBUG"
+package admin
@@ -0,0 +1,71 @@
+package admin
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+)
+
+// Maintenance is a maintenance mode switch. While it is on, the middleware
+// returned by Middleware answers every request with 503 Service Unavailable.
+// A Handler whose Options.Maintenance is set serves it at GET and
+// PUT /maintenance, so operators can turn it on and off at runtime.
+//
+// The zero value is off and ready to use. A Maintenance is safe for
+// concurrent use.
+type Maintenance struct {
+	on atomic.Bool
+}
+
+// Enabled reports whether maintenance mode is on.
+func (m *Maintenance) Enabled() bool {
+	return m.on.Load()
+}
+
+// Set turns maintenance mode on or off.
+func (m *Maintenance) Set(on bool) {
+	m.on.Store(on)
+}
+
+// Middleware returns a middleware that answers requests with a 503 problem
+// response (see middleware.RespondOverloaded, reason "maintenance") while
+// maintenance mode is on, and passes them to the next handler otherwise.
+func (m *Maintenance) Middleware() middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if m.Enabled() {
+				middleware.RespondOverloaded(w, r, middleware.Overload{
+					Status: http.StatusServiceUnavailable,
+					Reason: "maintenance",
+					Detail: "The service is down for maintenance.",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// get writes whether maintenance mode is on.
+func (m *Maintenance) get(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, m.Enabled())
+}
+
+// set turns maintenance mode on or off from the enabled query parameter.
+func (m *Maintenance) set(w http.ResponseWriter, r *http.Request) {
+	on, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+	if err != nil {
+		http.Error(w, "invalid enabled: must be true or false", http.StatusBadRequest)
+		return
+	}
+	if previous := m.on.Swap(on); previous != on {
+		slog.InfoContext(r.Context(), "maintenance mode changed", slog.Bool("enabled", on))
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, on)
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+	"github.com/harrydayexe/GoWebUtilities/logging"
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+	"github.com/harrydayexe/GoWebUtilities/server"
+)
+
+// SetupFunc registers a service's routes on mux. ctx carries cfg, as
+// config.FromContext reads it, and is cancelled if the process is told to
+// stop during startup. An error stops the service before it serves.
+type SetupFunc func(ctx context.Context, cfg config.ServerConfig, mux *http.ServeMux) error
+
+// Option configures Main.
+type Option func(*options)
+
+type options struct {
+	middleware    []middleware.Middleware
+	warmups       []warmup
+	serverOptions []server.Option
+	startupGate   *server.StartupGateOptions
+}
+
+type warmup struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// WithMiddleware appends mws to the middleware stack, inside the default
+// request ID, logging and recovery middleware and in the order given, the
+// first outermost.
+func WithMiddleware(mws ...middleware.Middleware) Option {
+	return func(o *options) {
+		o.middleware = append(o.middleware, mws...)
+	}
+}
+
+// WithWarmup registers fn to run after setup and before the server starts
+// serving, such as a database migration or a cache fill. Warmups run in
+// registration order; one that fails stops the service.
+func WithWarmup(name string, fn func(ctx context.Context) error) Option {
+	return func(o *options) {
+		o.warmups = append(o.warmups, warmup{name: name, fn: fn})
+	}
+}
+
+// WithStartupGate makes the server listen before the warmups run and answer
+// 503 with Retry-After until they are done, as server.WithStartupGate
+// describes; opts.Warmup runs after the WithWarmup warmups. Self tests run
+// the warmups before serving as usual, and Host, whose servers are run by
+// server.RunGroup, ignores it.
+func WithStartupGate(opts server.StartupGateOptions) Option {
+	return func(o *options) {
+		o.startupGate = &opts
+	}
+}
+
+// WithServerOptions passes opts to server.Run, or to server.SelfTest.
+func WithServerOptions(opts ...server.Option) Option {
+	return func(o *options) {
+		o.serverOptions = append(o.serverOptions, opts...)
+	}
+}
+
+// Main runs the service: it parses the command line and the
+// config.ServerConfig from the environment, configures the default logger,
+// calls setup with a new mux, runs the warmups, and serves the mux wrapped in
+// the middleware stack with server.Run until SIGINT or SIGTERM. With
+// -selftest, it runs server.SelfTest instead. If any step fails, Main logs
+// the error and exits with status 1.
+func Main(setup SetupFunc, opts ...Option) {
+	selfTest := server.SelfTestFlag(flag.CommandLine)
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := run(ctx, *selfTest, setup, opts...)
+	stop()
+	exitOnError(err)
+}
+
+// exitOnError logs err and exits with status 1 if err is not nil.
+func exitOnError(err error) {
+	if err != nil {
+		slog.Error("service failed", slog.String("error", err.Error()))
+		logging.Flush(context.Background())
+		os.Exit(1)
+	}
+}
+
+// defaultMiddleware returns the middleware every stack starts with.
+func defaultMiddleware(logger *slog.Logger) []middleware.Middleware {
+	return []middleware.Middleware{
+		middleware.NewRequestID(),
+		middleware.NewLoggingMiddleware(logger),
+		middleware.NewRecovery(logger),
+	}
+}
+
+// run implements Main.
+func run(ctx context.Context, selfTest bool, setup SetupFunc, opts ...Option) error {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cfg, err := config.ParseConfig[config.ServerConfig]()
+	if err != nil {
+		return fmt.Errorf("app: parsing configuration: %w", err)
+	}
+	logging.SetDefaultLogger(cfg)
+	logger := slog.Default()
+	ctx = config.NewContext(ctx, cfg)
+
+	mux := http.NewServeMux()
+	if err := setup(ctx, cfg, mux); err != nil {
+		return fmt.Errorf("app: setup: %w", err)
+	}
+	stack := middleware.CreateStack(append(defaultMiddleware(logger), o.middleware...)...)
+	if o.startupGate != nil && !selfTest {
+		gate := *o.startupGate
+		warmup := gate.Warmup
+		gate.Warmup = func(ctx context.Context) error {
+			if err := runWarmups(ctx, logger, o.warmups); err != nil {
+				return err
+			}
+			if warmup != nil {
+				return warmup(ctx)
+			}
+			return nil
+		}
+		return server.Run(ctx, stack(mux), append(o.serverOptions, server.WithStartupGate(gate))...)
+	}
+
+	if err := runWarmups(ctx, logger, o.warmups); err != nil {
+		return err
+	}
+	if selfTest {
+		return server.SelfTest(ctx, stack(mux), o.serverOptions...)
+	}
+	return server.Run(ctx, stack(mux), o.serverOptions...)
+}
+
+// runWarmups runs warmups in order, stopping at the first failure.
+func runWarmups(ctx context.Context, logger *slog.Logger, warmups []warmup) error {
+	for _, w := range warmups {
+		logger.Info("running warmup", slog.String("name", w.name))
+		if err := w.fn(ctx); err != nil {
+			return fmt.Errorf("app: warmup %s: %w", w.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+	"github.com/harrydayexe/GoWebUtilities/health"
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+	"github.com/harrydayexe/GoWebUtilities/server"
+)
+
+// setEnv isolates the test from server configuration in the environment.
+func setEnv(t *testing.T) {
+	t.Helper()
+	for _, v := range []string{"PORT", "ENVIRONMENT", "ADMIN_PORT", "LISTEN_NETWORK", "LISTEN_ADDRESS", "LISTEN_PID", "LISTEN_FDS"} {
+		t.Setenv(v, "")
+	}
+	t.Setenv("LOG_LEVEL", "ERROR")
+}
+
+func TestRun_SelfTest(t *testing.T) {
+	setEnv(t)
+	var steps []string
+	setup := func(ctx context.Context, cfg config.ServerConfig, mux *http.ServeMux) error {
+		if _, ok := config.FromContext(ctx); !ok {
+			t.Error("setup context carries no config")
+		}
+		steps = append(steps, "setup")
+		mux.HandleFunc("GET /hello", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "hello")
+		})
+		mux.HandleFunc("GET /panic", func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		})
+		return nil
+	}
+	warmup := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			steps = append(steps, name)
+			return nil
+		}
+	}
+	tagged := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Test", "yes")
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	err := run(context.Background(), true, setup,
+		WithWarmup("migrations", warmup("migrations")),
+		WithWarmup("cache", warmup("cache")),
+		WithMiddleware(tagged),
+		WithServerOptions(
+			server.WithSmokeCheck(server.SmokeCheck{
+				Path: "/hello",
+				Check: func(resp *http.Response) error {
+					if resp.Header.Get("X-Test") != "yes" {
+						return errors.New("middleware from WithMiddleware not applied")
+					}
+					if resp.Header.Get(middleware.RequestIDHeader) == "" {
+						return errors.New("no request ID")
+					}
+					return nil
+				},
+			}),
+			server.WithSmokeCheck(server.SmokeCheck{Path: "/panic", Status: http.StatusInternalServerError}),
+		),
+	)
+	if err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if want := []string{"setup", "migrations", "cache"}; !slices.Equal(steps, want) {
+		t.Errorf("steps = %v, want %v", steps, want)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	setEnv(t)
+	ok := func(context.Context, config.ServerConfig, *http.ServeMux) error { return nil }
+	boom := errors.New("boom")
+
+	t.Run("setup", func(t *testing.T) {
+		err := run(context.Background(), true, func(context.Context, config.ServerConfig, *http.ServeMux) error {
+			return boom
+		})
+		if !errors.Is(err, boom) || !strings.Contains(err.Error(), "setup") {
+			t.Errorf("run() error = %v, want setup error wrapping %v", err, boom)
+		}
+	})
+
+	t.Run("warmup", func(t *testing.T) {
+		var ranAfter bool
+		err := run(context.Background(), true, ok,
+			WithWarmup("migrations", func(context.Context) error { return boom }),
+			WithWarmup("cache", func(context.Context) error { ranAfter = true; return nil }),
+		)
+		if !errors.Is(err, boom) || !strings.Contains(err.Error(), "warmup migrations") {
+			t.Errorf("run() error = %v, want warmup error wrapping %v", err, boom)
+		}
+		if ranAfter {
+			t.Error("warmup after a failed one ran")
+		}
+	})
+
+	t.Run("config", func(t *testing.T) {
+		t.Setenv("LOG_LEVEL", "nonsense")
+		if err := run(context.Background(), true, ok); err == nil {
+			t.Error("run() succeeded with invalid configuration")
+		}
+	})
+}
+
+func TestRun_StartupGate(t *testing.T) {
+	setEnv(t)
+	t.Setenv("PORT", "0")
+	setup := func(ctx context.Context, cfg config.ServerConfig, mux *http.ServeMux) error {
+		mux.HandleFunc("GET /hello", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "hello")
+		})
+		return nil
+	}
+	release := make(chan struct{})
+	warmedUp := make(chan struct{})
+	ready := make(chan net.Addr, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, false, setup,
+			WithWarmup("cache", func(ctx context.Context) error {
+				<-release
+				return nil
+			}),
+			WithStartupGate(server.StartupGateOptions{Warmup: func(context.Context) error {
+				close(warmedUp)
+				return nil
+			}}),
+			WithServerOptions(server.WithReadyFunc(func(addr net.Addr) { ready <- addr })),
+		)
+	}()
+	addr := (<-ready).String()
+
+	get := func() int {
+		resp, err := http.Get("http://" + addr + "/hello")
+		if err != nil {
+			t.Fatalf("GET /hello: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := get(); got != http.StatusServiceUnavailable {
+		t.Errorf("status during warmup = %d, want 503", got)
+	}
+	close(release)
+	<-warmedUp
+	deadline := time.Now().Add(5 * time.Second)
+	for get() != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("server still gated after the warmups")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("run() error = %v", err)
+	}
+}
+
+func TestHost(t *testing.T) {
+	setEnv(t)
+	t.Setenv("PORT", "0")
+	t.Setenv("BILLING_PORT", "0")
+	t.Setenv("BILLING_ENVIRONMENT", "production")
+
+	// env reports the environment of the configuration a request carries.
+	env := func(ctx context.Context, cfg config.ServerConfig, mux *http.ServeMux) error {
+		if got, _ := config.FromContext(ctx); got.Environment != cfg.Environment {
+			t.Errorf("setup context environment %q, want %q", got.Environment, cfg.Environment)
+		}
+		mux.HandleFunc("GET /env", func(w http.ResponseWriter, r *http.Request) {
+			cfg, _ := config.FromContext(r.Context())
+			fmt.Fprint(w, cfg.Environment)
+		})
+		return nil
+	}
+	tag := func(name string) middleware.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Service", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	billingHealth := health.New(health.Options{})
+	auditHealth := health.New(health.Options{})
+	auditHealth.AddReadiness("db", health.CheckerFunc(func(context.Context) error { return errors.New("down") }))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ready := make(chan net.Addr, 2)
+	done := make(chan error, 1)
+	go func() {
+		done <- Host(ctx, []Service{
+			{Name: "billing", Prefix: "BILLING_", Setup: env, Health: billingHealth, Middleware: []middleware.Middleware{tag("billing")}},
+			{Name: "audit", Mount: "/audit/", Setup: env, Health: auditHealth, Middleware: []middleware.Middleware{tag("audit")}},
+			{Name: "search", Mount: "/search", Setup: env, Middleware: []middleware.Middleware{tag("search")}},
+		}, WithServerOptions(server.WithReadyFunc(func(addr net.Addr) { ready <- addr })))
+	}()
+	var addrs []string
+	for range 2 {
+		select {
+		case addr := <-ready:
+			addrs = append(addrs, "http://"+addr.String())
+		case err := <-done:
+			t.Fatalf("Host() returned before it was ready: %v", err)
+		}
+	}
+
+	get := func(url string) (int, string, string) {
+		t.Helper()
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("X-Service"), string(b)
+	}
+	// The shared server serves the mounted services; the other is billing's.
+	shared, billing := addrs[0], addrs[1]
+	if status, _, _ := get(shared + "/audit/env"); status != http.StatusOK {
+		shared, billing = billing, shared
+	}
+
+	tests := []struct {
+		url         string
+		wantStatus  int
+		wantService string
+		wantBody    string
+	}{
+		{billing + "/env", http.StatusOK, "billing", "production"},
+		{billing + "/readyz", http.StatusOK, "billing", ""},
+		{billing + "/audit/env", http.StatusNotFound, "billing", ""},
+		{shared + "/audit/env", http.StatusOK, "audit", "local"},
+		{shared + "/audit/readyz", http.StatusServiceUnavailable, "audit", ""},
+		{shared + "/search/env", http.StatusOK, "search", "local"},
+		{shared + "/env", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		status, service, body := get(tt.url)
+		if status != tt.wantStatus || service != tt.wantService || tt.wantBody != "" && body != tt.wantBody {
+			t.Errorf("GET %s = %d %q %q, want %d %q %q", tt.url, status, service, body, tt.wantStatus, tt.wantService, tt.wantBody)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Host() error = %v", err)
+	}
+}
+
+func TestHost_InvalidServices(t *testing.T) {
+	setEnv(t)
+	setup := func(context.Context, config.ServerConfig, *http.ServeMux) error { return nil }
+	tests := []struct {
+		name     string
+		services []Service
+		want     string
+	}{
+		{"none", nil, "at least one service"},
+		{"no name", []Service{{Setup: setup}}, "no name"},
+		{"duplicate name", []Service{{Name: "a", Prefix: "A_", Setup: setup}, {Name: "a", Prefix: "B_", Setup: setup}}, "name already used"},
+		{"no setup", []Service{{Name: "a"}}, "no setup function"},
+		{"relative mount", []Service{{Name: "a", Mount: "a/", Setup: setup}}, "must start with"},
+		{"duplicate mount", []Service{{Name: "a", Mount: "/x/", Setup: setup}, {Name: "b", Mount: "/x", Setup: setup}}, "mount /x already used"},
+		{"shared port", []Service{{Name: "a", Mount: "/a/", Setup: setup}, {Name: "b", Setup: setup}}, "share the unprefixed port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Host(context.Background(), tt.services)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Host() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
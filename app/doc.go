@@ -0,0 +1,30 @@
+// Package app collapses the main function of a service built with this
+// module into one call. Main parses the server configuration, configures
+// the default logger, lets the service register its routes, runs warmups
+// such as database migrations, wraps the routes in a middleware stack and
+// serves them with server.Run until the process is told to stop:
+//
+//	func main() {
+//	    app.Main(func(ctx context.Context, cfg config.ServerConfig, mux *http.ServeMux) error {
+//	        db, err := sql.Open("pgx", os.Getenv("DATABASE_URL"))
+//	        if err != nil {
+//	            return err
+//	        }
+//	        mux.Handle("GET /users", listUsers(db))
+//	        return nil
+//	    },
+//	        app.WithWarmup("migrations", migrate),
+//	        app.WithMiddleware(middleware.NewMaxBytesReader(1<<20)),
+//	        app.WithServerOptions(server.WithHealth(h)),
+//	    )
+//	}
+//
+// The stack is request IDs, access logs and panic recovery, followed by the
+// middleware passed to WithMiddleware. Main also defines the -selftest flag
+// of server.SelfTestFlag, so the same binary can check itself as a container
+// healthcheck.
+//
+// Host runs several such services in one process, each with its own
+// configuration prefix, port or path mount, middleware and health checks,
+// sharing the process's lifecycle and shutdown.
+package app
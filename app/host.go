@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+	"github.com/harrydayexe/GoWebUtilities/health"
+	"github.com/harrydayexe/GoWebUtilities/logging"
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+	"github.com/harrydayexe/GoWebUtilities/server"
+)
+
+// Service is one logical service hosted in a process by Host.
+type Service struct {
+	// Name identifies the service in logs and errors.
+	Name string
+	// Prefix is the prefix of the service's configuration variables, such
+	// as "BILLING_" for BILLING_PORT; see config.ParseConfigWithPrefix.
+	// Empty reads the unprefixed variables.
+	Prefix string
+	// Mount, if set, serves the service under this path, such as
+	// "/billing/", of a server shared with the other mounted services and
+	// configured by the unprefixed variables, instead of on its own port.
+	// Requests reach the service with the mount path stripped.
+	Mount string
+	// Setup registers the service's routes, and is called with its
+	// configuration.
+	Setup SetupFunc
+	// Middleware is appended to the service's stack, after the default
+	// middleware and the middleware given with WithMiddleware.
+	Middleware []middleware.Middleware
+	// Health, if set, serves the service's GET /healthz and /readyz,
+	// under Mount for a mounted service.
+	Health *health.Health
+}
+
+// Host runs several logical services in one process, each with its own
+// configuration, routes, middleware stack and health checks, sharing the
+// process's lifecycle: they start together, and server.RunGroup shuts them
+// all down together on SIGINT, SIGTERM, cancellation of ctx or the failure of
+// any of them. Small internal services can so be consolidated without
+// merging their code:
+//
+//	err := app.Host(ctx, []app.Service{
+//	    {Name: "billing", Prefix: "BILLING_", Setup: billing.Setup},
+//	    {Name: "audit", Mount: "/audit/", Setup: audit.Setup, Health: auditHealth},
+//	    {Name: "search", Mount: "/search/", Setup: search.Setup},
+//	})
+//
+// The unprefixed configuration configures the default logger and, if any
+// service has a Mount, the server shared by the mounted services; a service
+// with neither Prefix nor Mount would listen on the same port, and is
+// rejected. Each service's stack is request IDs, access logs tagged with the
+// service name and panic recovery, followed by the WithMiddleware middleware
+// and the service's own. Warmups run once every service is set up, and
+// WithServerOptions options are passed to server.RunGroup.
+func Host(ctx context.Context, services []Service, opts ...Option) error {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := validateServices(services); err != nil {
+		return err
+	}
+
+	base, err := config.ParseConfig[config.ServerConfig]()
+	if err != nil {
+		return fmt.Errorf("app: parsing configuration: %w", err)
+	}
+	logging.SetDefaultLogger(base)
+	logger := slog.Default()
+
+	var servers []*http.Server
+	var shared *http.ServeMux
+	for _, svc := range services {
+		cfg := base
+		if svc.Prefix != "" {
+			if cfg, err = config.ParseConfigWithPrefix[config.ServerConfig](svc.Prefix); err != nil {
+				return fmt.Errorf("app: service %s: parsing configuration: %w", svc.Name, err)
+			}
+		}
+		mux := http.NewServeMux()
+		if svc.Health != nil {
+			svc.Health.Register(mux)
+		}
+		if err := svc.Setup(config.NewContext(ctx, cfg), cfg, mux); err != nil {
+			return fmt.Errorf("app: service %s: setup: %w", svc.Name, err)
+		}
+		svcLogger := logger.With(slog.String("service", svc.Name))
+		stack := middleware.CreateStack(append(append(defaultMiddleware(svcLogger), o.middleware...), svc.Middleware...)...)
+		handler := stack(mux)
+
+		if svc.Mount == "" {
+			servers = append(servers, server.NewServerFromConfig(cfg, handler))
+			continue
+		}
+		if shared == nil {
+			shared = http.NewServeMux()
+			servers = append(servers, server.NewServerFromConfig(base, shared))
+		}
+		prefix := strings.TrimSuffix(svc.Mount, "/")
+		shared.Handle(prefix+"/", http.StripPrefix(prefix, withConfig(cfg, handler)))
+	}
+
+	if err := runWarmups(ctx, logger, o.warmups); err != nil {
+		return err
+	}
+	return server.RunGroup(ctx, servers, o.serverOptions...)
+}
+
+// MainHost runs Host until SIGINT or SIGTERM, logging the error and exiting
+// with status 1 if it fails, as Main does for a single service.
+func MainHost(services []Service, opts ...Option) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := Host(ctx, services, opts...)
+	stop()
+	exitOnError(err)
+}
+
+// validateServices checks the services passed to Host.
+func validateServices(services []Service) error {
+	if len(services) == 0 {
+		return errors.New("app: Host needs at least one service")
+	}
+	names := make(map[string]bool)
+	mounts := make(map[string]bool)
+	var mounted bool
+	var unprefixed int
+	for _, svc := range services {
+		switch {
+		case svc.Name == "":
+			return errors.New("app: service has no name")
+		case names[svc.Name]:
+			return fmt.Errorf("app: service %s: name already used", svc.Name)
+		case svc.Setup == nil:
+			return fmt.Errorf("app: service %s: no setup function", svc.Name)
+		case svc.Mount != "" && !strings.HasPrefix(svc.Mount, "/"):
+			return fmt.Errorf(`app: service %s: mount must start with "/"`, svc.Name)
+		}
+		names[svc.Name] = true
+		if svc.Mount == "" {
+			if svc.Prefix == "" {
+				unprefixed++
+			}
+			continue
+		}
+		mount := strings.TrimSuffix(svc.Mount, "/")
+		if mounts[mount] {
+			return fmt.Errorf("app: service %s: mount %s already used", svc.Name, svc.Mount)
+		}
+		mounts[mount] = true
+		mounted = true
+	}
+	if unprefixed > 1 || mounted && unprefixed > 0 {
+		return errors.New("app: services without a prefix or mount would share the unprefixed port")
+	}
+	return nil
+}
+
+// withConfig returns handler with cfg attached to the request context, for
+// services mounted on a server configured otherwise.
+func withConfig(cfg config.ServerConfig, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(config.NewContext(r.Context(), cfg)))
+	})
+}
@@ -0,0 +1,253 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Options configures a batch handler. Zero values are defaults.
+type Options struct {
+	// MaxRequests is the most sub-requests one batch may contain.
+	// Defaults to 20.
+	MaxRequests int
+	// Parallelism is how many sub-requests of a batch run at once.
+	// Defaults to 4.
+	Parallelism int
+	// MaxBodySize is the largest batch request body, in bytes.
+	// Defaults to 1 MiB.
+	MaxBodySize int64
+	// MaxResponseSize is the largest body kept for each sub-response, in
+	// bytes; longer bodies are replaced by a 502 result. Defaults to 1 MiB.
+	MaxResponseSize int
+}
+
+// Request is one sub-request of a batch.
+type Request struct {
+	// ID is echoed in the result so clients can match them up.
+	ID string `json:"id,omitempty"`
+	// Method defaults to GET.
+	Method string `json:"method,omitempty"`
+	// Path is the request path and query, starting with "/".
+	Path string `json:"path"`
+	// Headers are added to those inherited from the batch request.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body is sent as the JSON request body.
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// Result is the outcome of one sub-request.
+type Result struct {
+	ID      string            `json:"id,omitempty"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// batchKey marks the context of sub-requests, so that batches cannot nest.
+type batchKey struct{}
+
+// inheritedHeaderSkip lists batch request headers that describe the batch
+// body or connection and so are not copied to sub-requests.
+var inheritedHeaderSkip = map[string]bool{
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Content-Encoding":  true,
+	"Transfer-Encoding": true,
+	"Accept-Encoding":   true,
+	"Expect":            true,
+}
+
+// NewHandler returns a handler that executes batches of sub-requests against
+// target (see the package documentation). It answers 400 for malformed
+// batches, nested batches and batches larger than MaxRequests, and 413 for
+// bodies larger than MaxBodySize. A sub-request whose handler panics gets a
+// 500 result, and the panic is logged with slog.Default.
+func NewHandler(target http.Handler, opts Options) http.Handler {
+	if opts.MaxRequests <= 0 {
+		opts.MaxRequests = 20
+	}
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = 4
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	if opts.MaxResponseSize <= 0 {
+		opts.MaxResponseSize = 1 << 20
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(batchKey{}) != nil {
+			http.Error(w, "batches cannot be nested", http.StatusBadRequest)
+			return
+		}
+		var reqs []Request
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, opts.MaxBodySize)).Decode(&reqs); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "batch too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "invalid batch: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(reqs) > opts.MaxRequests {
+			http.Error(w, fmt.Sprintf("batch has %d requests; the limit is %d", len(reqs), opts.MaxRequests), http.StatusBadRequest)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), batchKey{}, true)
+		results := make([]Result, len(reqs))
+		sem := make(chan struct{}, opts.Parallelism)
+		var wg sync.WaitGroup
+		for i, sub := range reqs {
+			wg.Go(func() {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				results[i] = execute(ctx, target, r, sub, opts.MaxResponseSize)
+			})
+		}
+		wg.Wait()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	})
+}
+
+// execute runs one sub-request against target.
+func execute(ctx context.Context, target http.Handler, outer *http.Request, sub Request, maxResponse int) Result {
+	res := Result{ID: sub.ID}
+	method := sub.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	if !strings.HasPrefix(sub.Path, "/") || strings.HasPrefix(sub.Path, "//") {
+		return errorResult(res, http.StatusBadRequest, "path must start with a single /")
+	}
+
+	var body io.Reader = http.NoBody
+	if len(sub.Body) > 0 {
+		body = bytes.NewReader(sub.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, sub.Path, body)
+	if err != nil {
+		return errorResult(res, http.StatusBadRequest, err.Error())
+	}
+	for name, values := range outer.Header {
+		if !inheritedHeaderSkip[name] {
+			req.Header[name] = values
+		}
+	}
+	if len(sub.Body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range sub.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Host = outer.Host
+	req.RemoteAddr = outer.RemoteAddr
+	req.TLS = outer.TLS
+	req.Proto, req.ProtoMajor, req.ProtoMinor = outer.Proto, outer.ProtoMajor, outer.ProtoMinor
+	req.RequestURI = sub.Path
+
+	rec := &recorder{header: make(http.Header), max: maxResponse}
+	if !serve(target, rec, req) {
+		return errorResult(res, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if rec.overflow {
+		return errorResult(res, http.StatusBadGateway, "response too large for a batch")
+	}
+
+	res.Status = rec.status
+	res.Headers = make(map[string]string, len(rec.header))
+	for name := range rec.header {
+		res.Headers[name] = strings.Join(rec.header.Values(name), ", ")
+	}
+	if rec.body.Len() > 0 {
+		if isJSON(rec.header.Get("Content-Type")) && json.Valid(rec.body.Bytes()) {
+			res.Body = rec.body.Bytes()
+		} else {
+			res.Body, _ = json.Marshal(rec.body.String())
+		}
+	}
+	return res
+}
+
+// serve runs target and reports whether it returned without panicking. The
+// sub-request runs on a goroutine of its own, where net/http cannot recover
+// a panic, so one would otherwise crash the process. Panics are logged with
+// slog.Default.
+func serve(target http.Handler, w http.ResponseWriter, r *http.Request) (ok bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			slog.Default().ErrorContext(r.Context(), "batch sub-request panicked",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Any("panic", v),
+				slog.String("stack", string(debug.Stack())))
+			ok = false
+		}
+	}()
+	target.ServeHTTP(w, r)
+	return true
+}
+
+// errorResult completes res as an error with a plain-text message.
+func errorResult(res Result, status int, msg string) Result {
+	res.Status = status
+	res.Headers = map[string]string{"Content-Type": "text/plain; charset=utf-8"}
+	res.Body, _ = json.Marshal(msg)
+	return res
+}
+
+// isJSON reports whether a Content-Type names JSON.
+func isJSON(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// recorder captures a sub-response, up to max body bytes.
+type recorder struct {
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	max      int
+	overflow bool
+}
+
+// Header implements http.ResponseWriter.
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+// Write implements http.ResponseWriter.
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if r.body.Len()+len(b) > r.max {
+		r.overflow = true
+		return 0, errors.New("batch: response too large")
+	}
+	return r.body.Write(b)
+}
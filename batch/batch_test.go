@@ -0,0 +1,131 @@
+package batch
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"`+r.PathValue("id")+`"}`)
+	})
+	mux.HandleFunc("POST /echo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		w.WriteHeader(http.StatusCreated)
+		io.Copy(w, r.Body)
+	})
+	mux.HandleFunc("GET /text", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "plain")
+	})
+	mux.HandleFunc("GET /big", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 100))
+	})
+	mux.HandleFunc("GET /boom", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	return mux
+}
+
+func serveBatch(t *testing.T, h http.Handler, body string) (int, []Result) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer t")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var results []Result
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+			t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec.Code, results
+}
+
+func TestHandler(t *testing.T) {
+	mux := newTestMux()
+	h := NewHandler(mux, Options{MaxResponseSize: 50})
+	mux.Handle("POST /batch", h)
+
+	code, results := serveBatch(t, h, `[
+		{"id": "a", "path": "/users/1"},
+		{"id": "b", "method": "POST", "path": "/echo", "body": {"x": 1}},
+		{"id": "c", "path": "/text"},
+		{"id": "d", "path": "/missing"},
+		{"id": "e", "path": "/big"},
+		{"id": "f", "path": "https://example.com/"},
+		{"id": "g", "method": "POST", "path": "/batch", "body": []},
+		{"id": "h", "path": "/boom"}
+	]`)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	want := []struct {
+		id     string
+		status int
+		body   string
+	}{
+		{"a", 200, `{"id":"1"}`},
+		{"b", 201, `{"x":1}`},
+		{"c", 200, `"plain"`},
+		{"d", 404, `"404 page not found\n"`},
+		{"e", 502, `"response too large for a batch"`},
+		{"f", 400, `"path must start with a single /"`},
+		{"g", 400, `"batches cannot be nested\n"`},
+		{"h", 500, `"Internal Server Error"`},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		r := results[i]
+		if r.ID != w.id || r.Status != w.status || string(r.Body) != w.body {
+			t.Errorf("result %d = {%s %d %s}, want {%s %d %s}", i, r.ID, r.Status, r.Body, w.id, w.status, w.body)
+		}
+	}
+}
+
+func TestHandler_Limits(t *testing.T) {
+	h := NewHandler(newTestMux(), Options{MaxRequests: 2, MaxBodySize: 100})
+	if code, _ := serveBatch(t, h, `[{"path":"/text"},{"path":"/text"},{"path":"/text"}]`); code != http.StatusBadRequest {
+		t.Errorf("too many requests: status = %d, want 400", code)
+	}
+	if code, _ := serveBatch(t, h, `[{"path":"/`+strings.Repeat("x", 200)+`"}]`); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: status = %d, want 413", code)
+	}
+	if code, _ := serveBatch(t, h, `{"path":"/text"}`); code != http.StatusBadRequest {
+		t.Errorf("not an array: status = %d, want 400", code)
+	}
+}
+
+func TestHandler_Parallelism(t *testing.T) {
+	var running, peak atomic.Int64
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	})
+	h := NewHandler(slow, Options{Parallelism: 2})
+	serveBatch(t, h, `[{"path":"/"},{"path":"/"},{"path":"/"},{"path":"/"},{"path":"/"}]`)
+	if p := peak.Load(); p != 2 {
+		t.Errorf("peak concurrency = %d, want 2", p)
+	}
+}
@@ -0,0 +1,29 @@
+// Package batch provides an endpoint that executes several sub-requests in
+// one round trip, for clients such as mobile apps on high-latency networks.
+//
+// NewHandler dispatches each sub-request to an http.Handler, usually the
+// application's own mux, with bounded parallelism:
+//
+//	mux.Handle("POST /batch", batch.NewHandler(mux, batch.Options{}))
+//
+// The request body is a JSON array of sub-requests:
+//
+//	[
+//	  {"id": "me", "method": "GET", "path": "/users/me"},
+//	  {"id": "star", "method": "POST", "path": "/repos/42/star", "body": {"on": true}}
+//	]
+//
+// and the response is a JSON array of results in the same order, each with
+// its own status, so one failing sub-request does not fail the batch:
+//
+//	[
+//	  {"id": "me", "status": 200, "headers": {"Content-Type": "application/json"}, "body": {"name": "ada"}},
+//	  {"id": "star", "status": 404, "headers": {...}, "body": "repo not found\n"}
+//	]
+//
+// JSON sub-response bodies are embedded as JSON; others as strings.
+// Sub-requests inherit the batch request's headers (so authentication
+// applies to each), context and remote address. They run concurrently, so
+// a batch must not rely on their order; clients needing ordering send
+// separate batches.
+package batch
@@ -0,0 +1,252 @@
+package bind
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+	"github.com/harrydayexe/GoWebUtilities/respond"
+	"github.com/harrydayexe/GoWebUtilities/scalar"
+	"github.com/harrydayexe/GoWebUtilities/validate"
+)
+
+// Options configures JSONWith. Zero values are defaults.
+type Options struct {
+	// MaxBodySize is the largest body accepted, in bytes. Defaults to 1 MiB.
+	MaxBodySize int64
+	// DisallowUnknownFields rejects objects with fields the type does not
+	// have, catching client typos that would otherwise be silently ignored.
+	DisallowUnknownFields bool
+
+	// The limits below protect handlers from pathological payloads that are
+	// small in bytes but expensive to decode or process. A zero value means
+	// no limit. Setting any of them, or NumbersExact, makes JSONWith scan
+	// the whole body before decoding it; violations are answered with 400
+	// and name the offending field.
+
+	// MaxDepth is the deepest nesting of objects and arrays accepted; the
+	// top-level value is depth 1.
+	MaxDepth int
+	// MaxStringLength is the longest string, or object member name,
+	// accepted, in bytes after unescaping.
+	MaxStringLength int
+	// MaxArrayLength is the most elements accepted in any one array.
+	MaxArrayLength int
+	// RejectDuplicateKeys rejects objects that repeat a member name, which
+	// encoding/json otherwise resolves silently in favour of the last one.
+	RejectDuplicateKeys bool
+	// Numbers is how numbers are decoded or rejected. Defaults to
+	// NumbersFloat64, the encoding/json behaviour.
+	Numbers NumberPolicy
+
+	// Schema, if set, is a JSON Schema the body must match, checked after
+	// decoding and before Validate. Mismatches are answered with 422 and
+	// reported per field by JSON Pointer, such as "/items/0/name".
+	Schema *Schema
+}
+
+// FieldError describes a problem with one field of a request body. Its Field
+// is the JSON path of the field, such as "address.city".
+type FieldError = validate.FieldError
+
+// FieldErrors is a list of field problems. It implements error, so Validate
+// methods can return it to report every invalid field at once.
+type FieldErrors = validate.FieldErrors
+
+// Error is returned when a request body cannot be bound.
+type Error struct {
+	// Status is the response status that fits the failure.
+	Status  int
+	Message string
+	// Fields lists problems with individual fields, if known.
+	Fields FieldErrors
+	// Err is the underlying decoding or validation error, if any.
+	Err error
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	if len(e.Fields) > 0 {
+		return e.Message + ": " + e.Fields.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the problem details for the error, for respond.Error, and
+// the underlying error.
+func (e *Error) Unwrap() []error {
+	problem := &respond.ProblemDetails{Status: e.Status, Detail: e.Message}
+	if len(e.Fields) > 0 {
+		problem.Extensions = map[string]any{"errors": e.Fields}
+	}
+	if e.Err != nil {
+		return []error{problem, e.Err}
+	}
+	return []error{problem}
+}
+
+// JSON decodes r's JSON body into a T with default Options.
+func JSON[T any](r *http.Request) (T, error) {
+	return JSONWith[T](r, Options{})
+}
+
+// JSONWith decodes r's JSON body into a T and validates it. The request must
+// have a JSON Content-Type (application/json or a +json type) and a body of
+// exactly one JSON value no larger than opts.MaxBodySize, within any
+// structural limits set in opts, and matching opts.Schema if set. The
+// decoded value's string fields are then rewritten by their sanitize struct
+// tags, it is checked against its validate struct tags (see the validate
+// package) and, if those pass and T, or *T, implements config.Validator,
+// Validate is called on it; a returned FieldErrors becomes the error's
+// Fields. Errors are *Error.
+func JSONWith[T any](r *http.Request, opts Options) (T, error) {
+	var v T
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	if !isJSON(r.Header.Get("Content-Type")) {
+		return v, &Error{Status: http.StatusUnsupportedMediaType, Message: "Content-Type must be application/json"}
+	}
+
+	body := io.Reader(http.MaxBytesReader(nil, r.Body, opts.MaxBodySize))
+	var data []byte
+	if opts.strict() || opts.Schema != nil {
+		var err error
+		if data, err = io.ReadAll(body); err != nil {
+			return v, decodeError(err)
+		}
+		if err := checkLimits(data, opts); err != nil {
+			return v, err
+		}
+		body = bytes.NewReader(data)
+	}
+	dec := json.NewDecoder(body)
+	if opts.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if opts.Numbers == NumbersAsJSONNumber {
+		dec.UseNumber()
+	}
+	if err := dec.Decode(&v); err != nil {
+		return v, decodeError(err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return v, decodeError(err)
+		}
+		return v, &Error{Status: http.StatusBadRequest, Message: "request body must contain a single JSON value"}
+	}
+
+	if opts.Schema != nil {
+		var doc any
+		schemaDec := json.NewDecoder(bytes.NewReader(data))
+		schemaDec.UseNumber()
+		schemaDec.Decode(&doc) // cannot fail: data has already been decoded
+		if err := opts.Schema.Validate(doc); err != nil {
+			bindErr := &Error{Status: http.StatusUnprocessableEntity, Message: "schema validation failed", Err: err}
+			errors.As(err, &bindErr.Fields)
+			return v, bindErr
+		}
+	}
+
+	if err := validate.Sanitize(&v); err != nil {
+		return v, &Error{Status: http.StatusInternalServerError, Message: "invalid sanitize tags", Err: err}
+	}
+	if err := validate.Struct(v); err != nil {
+		var fields FieldErrors
+		if !errors.As(err, &fields) {
+			return v, &Error{Status: http.StatusInternalServerError, Message: "invalid validation tags", Err: err}
+		}
+		return v, &Error{Status: http.StatusUnprocessableEntity, Message: "validation failed", Fields: fields, Err: err}
+	}
+
+	var validator config.Validator
+	if val, ok := any(v).(config.Validator); ok {
+		validator = val
+	} else if val, ok := any(&v).(config.Validator); ok {
+		validator = val
+	}
+	if validator != nil {
+		if err := validator.Validate(); err != nil {
+			bindErr := &Error{Status: http.StatusUnprocessableEntity, Message: "validation failed", Err: err}
+			var fields FieldErrors
+			if errors.As(err, &fields) {
+				bindErr.Fields = fields
+			} else {
+				bindErr.Message = err.Error()
+			}
+			return v, bindErr
+		}
+	}
+	return v, nil
+}
+
+// decodeError converts a json.Decoder error to an *Error.
+func decodeError(err error) *Error {
+	var (
+		tooLarge  *http.MaxBytesError
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		parseErr  *scalar.ParseError
+	)
+	switch {
+	case errors.As(err, &tooLarge):
+		return &Error{Status: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("request body larger than %d bytes", tooLarge.Limit), Err: err}
+	case errors.Is(err, io.EOF):
+		return &Error{Status: http.StatusBadRequest, Message: "request body is empty", Err: err}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &Error{Status: http.StatusBadRequest, Message: "request body is truncated JSON", Err: err}
+	case errors.As(err, &syntaxErr):
+		return &Error{Status: http.StatusBadRequest, Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset), Err: err}
+	case errors.As(err, &parseErr):
+		return &Error{Status: http.StatusBadRequest, Message: parseErr.Error(), Err: err}
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			return &Error{Status: http.StatusBadRequest, Message: "request body must be a JSON " + typeErr.Type.Kind().String(), Err: err}
+		}
+		return &Error{
+			Status:  http.StatusBadRequest,
+			Message: "invalid field types",
+			Fields:  FieldErrors{{Field: field, Message: "must be " + jsonKind(typeErr.Type.Kind().String()) + ", not " + typeErr.Value}},
+			Err:     err,
+		}
+	}
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return &Error{
+			Status:  http.StatusBadRequest,
+			Message: "unknown fields",
+			Fields:  FieldErrors{{Field: strings.Trim(name, `"`), Message: "is not a known field"}},
+			Err:     err,
+		}
+	}
+	return &Error{Status: http.StatusBadRequest, Message: "invalid JSON", Err: err}
+}
+
+// jsonKind describes a Go kind in JSON terms.
+func jsonKind(kind string) string {
+	switch kind {
+	case "string":
+		return "a string"
+	case "bool":
+		return "a boolean"
+	case "slice", "array":
+		return "an array"
+	case "struct", "map":
+		return "an object"
+	}
+	return "a number"
+}
+
+// isJSON reports whether a Content-Type names JSON.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
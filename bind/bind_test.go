@@ -0,0 +1,199 @@
+package bind
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/harrydayexe/GoWebUtilities/respond"
+	"github.com/harrydayexe/GoWebUtilities/scalar"
+)
+
+type createUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func (c createUser) Validate() error {
+	var errs FieldErrors
+	if c.Name == "" {
+		errs = append(errs, FieldError{Field: "name", Message: "is required"})
+	}
+	if c.Age < 0 {
+		errs = append(errs, FieldError{Field: "age", Message: "must not be negative"})
+	}
+	return errs.Err()
+}
+
+func newRequest(contentType, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	return r
+}
+
+func TestJSON(t *testing.T) {
+	got, err := JSON[createUser](newRequest("application/json; charset=utf-8", `{"name":"ada","age":36}`))
+	if err != nil || got != (createUser{Name: "ada", Age: 36}) {
+		t.Errorf("JSON = %+v, %v", got, err)
+	}
+}
+
+func TestJSON_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		opts        Options
+		wantStatus  int
+		wantFields  int
+	}{
+		{"wrong content type", "text/plain", `{}`, Options{}, http.StatusUnsupportedMediaType, 0},
+		{"empty body", "application/json", ``, Options{}, http.StatusBadRequest, 0},
+		{"syntax error", "application/json", `{"name":}`, Options{}, http.StatusBadRequest, 0},
+		{"two values", "application/json", `{"name":"a"} {}`, Options{}, http.StatusBadRequest, 0},
+		{"wrong type", "application/json", `{"name":"a","age":"old"}`, Options{}, http.StatusBadRequest, 1},
+		{"unknown field", "application/json", `{"name":"a","nmae":"b"}`, Options{DisallowUnknownFields: true}, http.StatusBadRequest, 1},
+		{"too large", "application/json", `{"name":"` + strings.Repeat("a", 100) + `"}`, Options{MaxBodySize: 50}, http.StatusRequestEntityTooLarge, 0},
+		{"validation", "application/problem+json", `{"age":-1}`, Options{}, http.StatusUnprocessableEntity, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := JSONWith[createUser](newRequest(tt.contentType, tt.body), tt.opts)
+			var bindErr *Error
+			if !errors.As(err, &bindErr) {
+				t.Fatalf("error = %v, want *Error", err)
+			}
+			if bindErr.Status != tt.wantStatus || len(bindErr.Fields) != tt.wantFields {
+				t.Errorf("got status %d with %d fields (%v), want %d with %d", bindErr.Status, len(bindErr.Fields), err, tt.wantStatus, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestError_Respond(t *testing.T) {
+	_, err := JSON[createUser](newRequest("application/json", `{"age":-1}`))
+	rec := httptest.NewRecorder()
+	respond.Error(rec, http.StatusBadRequest, err)
+	want := `{"detail":"validation failed","errors":[{"field":"name","message":"is required"},{"field":"age","message":"must not be negative"}],"status":422,"title":"Unprocessable Entity","type":"about:blank"}`
+	if rec.Code != http.StatusUnprocessableEntity || strings.TrimSpace(rec.Body.String()) != want {
+		t.Errorf("got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestJSON_Limits(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		opts      Options
+		wantField string
+	}{
+		{"too deep", `{"a":{"b":[{"c":1}]}}`, Options{MaxDepth: 3}, "a.b[0]"},
+		{"long string", `{"name":"abcdef"}`, Options{MaxStringLength: 5}, "name"},
+		{"long name", `{"abcdef":1}`, Options{MaxStringLength: 5}, "abcdef"},
+		{"long array", `{"tags":["a","b","c"]}`, Options{MaxArrayLength: 2}, "tags[2]"},
+		{"duplicate key", `{"a":{"x":1,"x":2}}`, Options{RejectDuplicateKeys: true}, "a.x"},
+		{"inexact integer", `{"id":9007199254740993}`, Options{Numbers: NumbersExact}, "id"},
+		{"out of range", `{"n":[1e400]}`, Options{Numbers: NumbersExact}, "n[0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := JSONWith[map[string]any](newRequest("application/json", tt.body), tt.opts)
+			var bindErr *Error
+			if !errors.As(err, &bindErr) {
+				t.Fatalf("error = %v, want *Error", err)
+			}
+			if bindErr.Status != http.StatusBadRequest || len(bindErr.Fields) != 1 || bindErr.Fields[0].Field != tt.wantField {
+				t.Errorf("got status %d with fields %v, want 400 for %q", bindErr.Status, bindErr.Fields, tt.wantField)
+			}
+		})
+	}
+
+	t.Run("within limits", func(t *testing.T) {
+		opts := Options{MaxDepth: 3, MaxStringLength: 5, MaxArrayLength: 2, RejectDuplicateKeys: true, Numbers: NumbersExact}
+		body := `{"a":{"b":[1,0.1]},"c":"abcde","d":{"a":9007199254740992}}`
+		if _, err := JSONWith[map[string]any](newRequest("application/json", body), opts); err != nil {
+			t.Errorf("JSONWith = %v, want nil", err)
+		}
+	})
+
+	t.Run("json.Number", func(t *testing.T) {
+		got, err := JSONWith[map[string]any](newRequest("application/json", `{"id":9007199254740993}`), Options{Numbers: NumbersAsJSONNumber})
+		if err != nil || got["id"] != json.Number("9007199254740993") {
+			t.Errorf("JSONWith = %v (%T), %v", got["id"], got["id"], err)
+		}
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		_, err := JSONWith[map[string]any](newRequest("application/json", `{"a":[}`), Options{MaxDepth: 3})
+		var bindErr *Error
+		if !errors.As(err, &bindErr) || bindErr.Status != http.StatusBadRequest || len(bindErr.Fields) != 0 {
+			t.Errorf("error = %v, want a plain 400", err)
+		}
+	})
+}
+
+type tagged struct {
+	Email string `json:"email" validate:"required,email"`
+	Items []struct {
+		SKU string `json:"sku" validate:"len=3"`
+	} `json:"items"`
+}
+
+func TestJSON_ValidateTags(t *testing.T) {
+	_, err := JSON[tagged](newRequest("application/json", `{"email":"nope","items":[{"sku":"abc"},{"sku":"x"}]}`))
+	var bindErr *Error
+	if !errors.As(err, &bindErr) {
+		t.Fatalf("error = %v, want *Error", err)
+	}
+	want := FieldErrors{{Field: "email", Message: "must be a valid email address"}, {Field: "items[1].sku", Message: "must be exactly 3 characters long"}}
+	if bindErr.Status != http.StatusUnprocessableEntity || !slices.Equal(bindErr.Fields, want) {
+		t.Errorf("got status %d with fields %v, want 422 with %v", bindErr.Status, bindErr.Fields, want)
+	}
+
+	type badTag struct {
+		Name string `json:"name" validate:"nope"`
+	}
+	_, err = JSON[badTag](newRequest("application/json", `{"name":"a"}`))
+	if !errors.As(err, &bindErr) || bindErr.Status != http.StatusInternalServerError {
+		t.Errorf("error = %v, want 500 for an invalid tag", err)
+	}
+}
+
+func TestJSON_Sanitize(t *testing.T) {
+	type signUp struct {
+		Email string `json:"email" sanitize:"trimspace,lowercase" validate:"required,email"`
+	}
+	got, err := JSON[signUp](newRequest("application/json", `{"email":"  Ada@Example.COM "}`))
+	if err != nil || got.Email != "ada@example.com" {
+		t.Errorf("JSON = %+v, %v", got, err)
+	}
+
+	_, err = JSON[signUp](newRequest("application/json", `{"email":"   "}`))
+	var bindErr *Error
+	if !errors.As(err, &bindErr) || bindErr.Status != http.StatusUnprocessableEntity {
+		t.Errorf("error = %v, want 422 for a blank email after trimming", err)
+	}
+}
+
+func TestJSON_Scalars(t *testing.T) {
+	type payment struct {
+		Amount scalar.Money `json:"amount"`
+		On     scalar.Date  `json:"on"`
+	}
+	got, err := JSON[payment](newRequest("application/json", `{"amount":{"amount":"9.99","currency":"GBP"},"on":"2024-03-01"}`))
+	if err != nil || got.Amount != (scalar.Money{Amount: 999, Currency: "GBP"}) || got.On.String() != "2024-03-01" {
+		t.Errorf("JSON = %+v, %v", got, err)
+	}
+
+	_, err = JSON[payment](newRequest("application/json", `{"amount":{"amount":"9.999","currency":"GBP"}}`))
+	var bindErr *Error
+	if !errors.As(err, &bindErr) || bindErr.Status != http.StatusBadRequest || !strings.Contains(bindErr.Message, `invalid amount "9.999"`) {
+		t.Errorf("error = %v, want 400 naming the amount", err)
+	}
+}
@@ -0,0 +1,45 @@
+// Package bind decodes and validates request bodies.
+//
+// JSON decodes a request's JSON body into a value of the type parameter:
+//
+//	type CreateUser struct {
+//	    Name  string `json:"name"`
+//	    Email string `json:"email"`
+//	}
+//
+//	func (c CreateUser) Validate() error {
+//	    var errs bind.FieldErrors
+//	    if c.Name == "" {
+//	        errs = append(errs, bind.FieldError{Field: "name", Message: "is required"})
+//	    }
+//	    return errs.Err()
+//	}
+//
+//	in, err := bind.JSON[CreateUser](r)
+//	if err != nil {
+//	    respond.Error(w, http.StatusBadRequest, err)
+//	    return
+//	}
+//
+// It requires a JSON Content-Type, limits the body size, optionally rejects
+// unknown fields, applies sanitize and validate struct tags (see the validate
+// package), and calls Validate when the type implements config.Validator.
+// Failures are *Error values carrying the status to answer with (415, 413,
+// 400 or 422) and per-field errors. An *Error wraps a
+// respond.ProblemDetails, so respond.Error writes it as problem details with
+// the field errors in an "errors" member:
+//
+//	{"type":"about:blank","title":"Unprocessable Entity","status":422,
+//	 "detail":"validation failed","errors":[{"field":"name","message":"is required"}]}
+//
+// Options can also bound the structure of the body: MaxDepth,
+// MaxStringLength and MaxArrayLength cap nesting and sizes,
+// RejectDuplicateKeys refuses repeated member names, and Numbers chooses
+// whether large integers are decoded as float64, rejected (NumbersExact) or
+// kept as json.Number. A violation is a 400 *Error whose field error names
+// the offending path, such as "items[1000]".
+//
+// Options.Schema validates the body against a JSON Schema compiled with
+// CompileSchema, for contracts kept as schema documents. Mismatches are a 422
+// *Error with a field error per problem, keyed by JSON Pointer.
+package bind
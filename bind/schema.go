@@ -0,0 +1,733 @@
+package bind
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math/big"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Schema is a compiled JSON Schema (draft 2020-12) that request bodies can be
+// validated against by setting Options.Schema. It is safe for concurrent use.
+//
+// The assertion vocabulary is supported: type, enum, const, the numeric,
+// string, array and object keywords (including prefixItems, contains,
+// patternProperties, propertyNames and dependentRequired), the applicators
+// allOf, anyOf, oneOf, not, if/then/else and dependentSchemas, and $ref to
+// locations within the same document, such as "#/$defs/address". format is
+// treated as an annotation, as the specification's default is, and other
+// unknown keywords are ignored. Patterns use Go's RE2 syntax, which differs
+// from ECMA 262 in rarely used features such as backreferences.
+// unevaluatedProperties, unevaluatedItems, $dynamicRef and references to
+// other documents are not supported and make CompileSchema fail rather than
+// silently accept everything.
+type Schema struct {
+	root *schemaNode
+}
+
+// schemaCache holds compiled schemas by their source text, so compiling the
+// same document again, as a handler might on every request, is cheap.
+var schemaCache sync.Map // string -> *Schema
+
+// CompileSchema compiles the JSON Schema document data. Compiled schemas are
+// cached by their source, so calling CompileSchema again with the same
+// document returns the same *Schema without recompiling it.
+//
+//	//go:embed schemas/create-user.json
+//	var createUserSchema []byte
+//
+//	var createUser = bind.MustCompileSchema(createUserSchema)
+func CompileSchema(data []byte) (*Schema, error) {
+	if s, ok := schemaCache.Load(string(data)); ok {
+		return s.(*Schema), nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("bind: invalid schema JSON: %w", err)
+	}
+	c := &schemaCompiler{doc: doc, nodes: make(map[string]*schemaNode)}
+	root, err := c.compile(doc, "")
+	if err != nil {
+		return nil, fmt.Errorf("bind: invalid schema: %w", err)
+	}
+	s, _ := schemaCache.LoadOrStore(string(data), &Schema{root: root})
+	return s.(*Schema), nil
+}
+
+// MustCompileSchema is like CompileSchema but panics if the schema is
+// invalid. It is intended for package-level schemas.
+func MustCompileSchema(data []byte) *Schema {
+	s, err := CompileSchema(data)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Validate validates doc, a value decoded from JSON, against the schema and
+// returns the problems found as FieldErrors, or nil. Each Field is the JSON
+// Pointer (RFC 6901) of the offending value, such as "/items/0/name"; the
+// document itself is "". Numbers may be json.Number or float64.
+func (s *Schema) Validate(doc any) error {
+	var errs FieldErrors
+	s.root.validate(doc, "", &errs)
+	return errs.Err()
+}
+
+// schemaNode is one compiled schema or subschema.
+type schemaNode struct {
+	always *bool // for the boolean schemas true and false
+	ref    *schemaNode
+
+	types    []string
+	enum     []any
+	constVal any
+	hasConst bool
+
+	minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf *schemaNumber
+
+	minLength, maxLength int // -1 if unset
+	pattern              *regexp.Regexp
+
+	prefixItems              []*schemaNode
+	items, contains          *schemaNode
+	minItems, maxItems       int // -1 if unset
+	minContains, maxContains int // -1 if unset
+	uniqueItems              bool
+
+	properties                   map[string]*schemaNode
+	patternProperties            []patternSchema
+	additionalProperties         *schemaNode
+	propertyNames                *schemaNode
+	required                     []string
+	dependentRequired            map[string][]string
+	dependentSchemas             map[string]*schemaNode
+	minProperties, maxProperties int // -1 if unset
+
+	allOf, anyOf, oneOf                   []*schemaNode
+	not, ifSchema, thenSchema, elseSchema *schemaNode
+}
+
+// schemaNumber is a numeric keyword value, kept exactly and as written.
+type schemaNumber struct {
+	rat  *big.Rat
+	text string
+}
+
+// patternSchema is one entry of patternProperties.
+type patternSchema struct {
+	re     *regexp.Regexp
+	schema *schemaNode
+}
+
+// schemaCompiler compiles a schema document, sharing the nodes of subschemas
+// reached more than once through $ref.
+type schemaCompiler struct {
+	doc   any
+	nodes map[string]*schemaNode // by JSON Pointer within doc
+}
+
+// compile compiles the schema v found at ptr in the document.
+func (c *schemaCompiler) compile(v any, ptr string) (*schemaNode, error) {
+	if n, ok := c.nodes[ptr]; ok {
+		return n, nil
+	}
+	n := &schemaNode{minLength: -1, maxLength: -1, minItems: -1, maxItems: -1,
+		minContains: -1, maxContains: -1, minProperties: -1, maxProperties: -1}
+	c.nodes[ptr] = n // before compiling children, so recursive $refs resolve to n
+
+	if b, ok := v.(bool); ok {
+		n.always = &b
+		return n, nil
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object or a boolean", pointerOrRoot(ptr))
+	}
+	kw := schemaKeywords{c: c, obj: obj, ptr: ptr}
+
+	for _, name := range []string{"unevaluatedProperties", "unevaluatedItems", "$dynamicRef"} {
+		if _, ok := obj[name]; ok {
+			return nil, fmt.Errorf("%s: %s is not supported", pointerOrRoot(ptr), name)
+		}
+	}
+	if ref, ok := obj["$ref"]; ok {
+		target, err := c.resolve(ref, ptr)
+		if err != nil {
+			return nil, err
+		}
+		n.ref = target
+	}
+
+	if t, ok := obj["type"]; ok {
+		switch t := t.(type) {
+		case string:
+			n.types = []string{t}
+		case []any:
+			for _, item := range t {
+				s, ok := item.(string)
+				if !ok {
+					return nil, kw.invalid("type", "a string or an array of strings")
+				}
+				n.types = append(n.types, s)
+			}
+		default:
+			return nil, kw.invalid("type", "a string or an array of strings")
+		}
+		for _, t := range n.types {
+			if !slices.Contains([]string{"null", "boolean", "object", "array", "number", "string", "integer"}, t) {
+				return nil, fmt.Errorf("%s: unknown type %q", pointerOrRoot(ptr+"/type"), t)
+			}
+		}
+	}
+	if e, ok := obj["enum"]; ok {
+		if n.enum, ok = e.([]any); !ok {
+			return nil, kw.invalid("enum", "an array")
+		}
+	}
+	n.constVal, n.hasConst = obj["const"]
+
+	var err error
+	for _, k := range []struct {
+		name string
+		dst  **schemaNumber
+	}{
+		{"minimum", &n.minimum}, {"maximum", &n.maximum},
+		{"exclusiveMinimum", &n.exclusiveMinimum}, {"exclusiveMaximum", &n.exclusiveMaximum},
+		{"multipleOf", &n.multipleOf},
+	} {
+		if *k.dst, err = kw.number(k.name); err != nil {
+			return nil, err
+		}
+	}
+	if n.multipleOf != nil && n.multipleOf.rat.Sign() <= 0 {
+		return nil, kw.invalid("multipleOf", "greater than 0")
+	}
+	for _, k := range []struct {
+		name string
+		dst  *int
+	}{
+		{"minLength", &n.minLength}, {"maxLength", &n.maxLength},
+		{"minItems", &n.minItems}, {"maxItems", &n.maxItems},
+		{"minContains", &n.minContains}, {"maxContains", &n.maxContains},
+		{"minProperties", &n.minProperties}, {"maxProperties", &n.maxProperties},
+	} {
+		if *k.dst, err = kw.count(k.name); err != nil {
+			return nil, err
+		}
+	}
+	if n.pattern, err = kw.pattern("pattern"); err != nil {
+		return nil, err
+	}
+	if u, ok := obj["uniqueItems"]; ok {
+		if n.uniqueItems, ok = u.(bool); !ok {
+			return nil, kw.invalid("uniqueItems", "a boolean")
+		}
+	}
+
+	if _, ok := obj["items"].([]any); ok {
+		return nil, fmt.Errorf("%s: the array form of items is not supported; use prefixItems", pointerOrRoot(ptr+"/items"))
+	}
+	for _, k := range []struct {
+		name string
+		dst  **schemaNode
+	}{
+		{"items", &n.items}, {"contains", &n.contains},
+		{"additionalProperties", &n.additionalProperties}, {"propertyNames", &n.propertyNames},
+		{"not", &n.not}, {"if", &n.ifSchema}, {"then", &n.thenSchema}, {"else", &n.elseSchema},
+	} {
+		if *k.dst, err = kw.schema(k.name); err != nil {
+			return nil, err
+		}
+	}
+	for _, k := range []struct {
+		name string
+		dst  *[]*schemaNode
+	}{
+		{"prefixItems", &n.prefixItems}, {"allOf", &n.allOf}, {"anyOf", &n.anyOf}, {"oneOf", &n.oneOf},
+	} {
+		if *k.dst, err = kw.schemaList(k.name); err != nil {
+			return nil, err
+		}
+	}
+	for _, k := range []struct {
+		name string
+		dst  *map[string]*schemaNode
+	}{
+		{"properties", &n.properties}, {"dependentSchemas", &n.dependentSchemas},
+	} {
+		if *k.dst, err = kw.schemaMap(k.name); err != nil {
+			return nil, err
+		}
+	}
+	pp, err := kw.schemaMap("patternProperties")
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range slices.Sorted(maps.Keys(pp)) {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern: %w", pointerOrRoot(ptr+"/patternProperties"), err)
+		}
+		n.patternProperties = append(n.patternProperties, patternSchema{re: re, schema: pp[p]})
+	}
+	if n.required, err = kw.strings("required", obj["required"]); err != nil {
+		return nil, err
+	}
+	if dr, ok := obj["dependentRequired"]; ok {
+		m, ok := dr.(map[string]any)
+		if !ok {
+			return nil, kw.invalid("dependentRequired", "an object")
+		}
+		n.dependentRequired = make(map[string][]string, len(m))
+		for name, v := range m {
+			if n.dependentRequired[name], err = kw.strings("dependentRequired", v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// resolve compiles the target of a $ref found in the schema at ptr.
+func (c *schemaCompiler) resolve(ref any, ptr string) (*schemaNode, error) {
+	s, ok := ref.(string)
+	if !ok || !strings.HasPrefix(s, "#") {
+		return nil, fmt.Errorf("%s: only references within the schema (\"#...\") are supported", pointerOrRoot(ptr+"/$ref"))
+	}
+	target, err := url.PathUnescape(s[1:])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", pointerOrRoot(ptr+"/$ref"), err)
+	}
+	v := c.doc
+	if target != "" {
+		if !strings.HasPrefix(target, "/") {
+			return nil, fmt.Errorf("%s: anchors are not supported", pointerOrRoot(ptr+"/$ref"))
+		}
+		for tok := range strings.SplitSeq(target[1:], "/") {
+			tok = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+			switch parent := v.(type) {
+			case map[string]any:
+				v, ok = parent[tok]
+			case []any:
+				i, err := strconv.Atoi(tok)
+				ok = err == nil && i >= 0 && i < len(parent)
+				if ok {
+					v = parent[i]
+				}
+			default:
+				ok = false
+			}
+			if !ok {
+				return nil, fmt.Errorf("%s: %q does not resolve", pointerOrRoot(ptr+"/$ref"), s)
+			}
+		}
+	}
+	return c.compile(v, target)
+}
+
+// schemaKeywords reads the keywords of one schema object.
+type schemaKeywords struct {
+	c   *schemaCompiler
+	obj map[string]any
+	ptr string
+}
+
+// invalid returns the error for keyword name not being what it must be.
+func (kw schemaKeywords) invalid(name, want string) error {
+	return fmt.Errorf("%s: must be %s", pointerOrRoot(kw.ptr+"/"+escapePointer(name)), want)
+}
+
+// number returns the numeric keyword name, or nil if it is absent.
+func (kw schemaKeywords) number(name string) (*schemaNumber, error) {
+	v, ok := kw.obj[name]
+	if !ok {
+		return nil, nil
+	}
+	r, ok := ratOf(v)
+	if !ok {
+		return nil, kw.invalid(name, "a number")
+	}
+	return &schemaNumber{rat: r, text: fmt.Sprint(v)}, nil
+}
+
+// count returns the non-negative integer keyword name, or -1 if it is absent.
+func (kw schemaKeywords) count(name string) (int, error) {
+	v, ok := kw.obj[name]
+	if !ok {
+		return -1, nil
+	}
+	r, ok := ratOf(v)
+	if !ok || !r.IsInt() || r.Sign() < 0 || !r.Num().IsInt64() {
+		return 0, kw.invalid(name, "a non-negative integer")
+	}
+	return int(r.Num().Int64()), nil
+}
+
+// pattern returns the compiled regular expression keyword name, or nil.
+func (kw schemaKeywords) pattern(name string) (*regexp.Regexp, error) {
+	v, ok := kw.obj[name]
+	if !ok {
+		return nil, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, kw.invalid(name, "a string")
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid pattern: %w", pointerOrRoot(kw.ptr+"/"+name), err)
+	}
+	return re, nil
+}
+
+// schema returns the compiled subschema keyword name, or nil.
+func (kw schemaKeywords) schema(name string) (*schemaNode, error) {
+	v, ok := kw.obj[name]
+	if !ok {
+		return nil, nil
+	}
+	return kw.c.compile(v, kw.ptr+"/"+escapePointer(name))
+}
+
+// schemaList returns the compiled array of subschemas keyword name.
+func (kw schemaKeywords) schemaList(name string) ([]*schemaNode, error) {
+	v, ok := kw.obj[name]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := v.([]any)
+	if !ok || len(list) == 0 {
+		return nil, kw.invalid(name, "a non-empty array of schemas")
+	}
+	nodes := make([]*schemaNode, len(list))
+	for i, item := range list {
+		n, err := kw.c.compile(item, fmt.Sprintf("%s/%s/%d", kw.ptr, escapePointer(name), i))
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = n
+	}
+	return nodes, nil
+}
+
+// schemaMap returns the compiled object of subschemas keyword name.
+func (kw schemaKeywords) schemaMap(name string) (map[string]*schemaNode, error) {
+	v, ok := kw.obj[name]
+	if !ok {
+		return nil, nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, kw.invalid(name, "an object of schemas")
+	}
+	nodes := make(map[string]*schemaNode, len(m))
+	for key, item := range m {
+		n, err := kw.c.compile(item, kw.ptr+"/"+escapePointer(name)+"/"+escapePointer(key))
+		if err != nil {
+			return nil, err
+		}
+		nodes[key] = n
+	}
+	return nodes, nil
+}
+
+// strings returns v, the value of keyword name, as an array of strings.
+func (kw schemaKeywords) strings(name string, v any) ([]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, kw.invalid(name, "an array of strings")
+	}
+	out := make([]string, len(list))
+	for i, item := range list {
+		if out[i], ok = item.(string); !ok {
+			return nil, kw.invalid(name, "an array of strings")
+		}
+	}
+	return out, nil
+}
+
+// valid reports whether v is valid against n, without collecting errors.
+func (n *schemaNode) valid(v any) bool {
+	var errs FieldErrors
+	n.validate(v, "", &errs)
+	return len(errs) == 0
+}
+
+// validate appends to errs the problems with the value v at ptr.
+func (n *schemaNode) validate(v any, ptr string, errs *FieldErrors) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, FieldError{Field: ptr, Message: fmt.Sprintf(format, args...)})
+	}
+	if n.always != nil {
+		if !*n.always {
+			fail("is not allowed")
+		}
+		return
+	}
+	if n.ref != nil {
+		n.ref.validate(v, ptr, errs)
+	}
+
+	if len(n.types) > 0 && !slices.ContainsFunc(n.types, func(t string) bool { return hasType(v, t) }) {
+		fail("must be of type %s", strings.Join(n.types, " or "))
+		return // the remaining keywords would only repeat the problem
+	}
+	if n.enum != nil && !slices.ContainsFunc(n.enum, func(e any) bool { return jsonEqual(v, e) }) {
+		fail("must be one of the allowed values")
+	}
+	if n.hasConst && !jsonEqual(v, n.constVal) {
+		fail("must be the constant value")
+	}
+
+	switch v := v.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if n.minLength >= 0 && length < n.minLength {
+			fail("must be at least %d characters long", n.minLength)
+		}
+		if n.maxLength >= 0 && length > n.maxLength {
+			fail("must be at most %d characters long", n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(v) {
+			fail("must match the pattern %q", n.pattern.String())
+		}
+	case []any:
+		n.validateArray(v, ptr, errs, fail)
+	case map[string]any:
+		n.validateObject(v, ptr, errs, fail)
+	default:
+		if r, ok := ratOf(v); ok {
+			if n.minimum != nil && r.Cmp(n.minimum.rat) < 0 {
+				fail("must be at least %s", n.minimum.text)
+			}
+			if n.exclusiveMinimum != nil && r.Cmp(n.exclusiveMinimum.rat) <= 0 {
+				fail("must be greater than %s", n.exclusiveMinimum.text)
+			}
+			if n.maximum != nil && r.Cmp(n.maximum.rat) > 0 {
+				fail("must be at most %s", n.maximum.text)
+			}
+			if n.exclusiveMaximum != nil && r.Cmp(n.exclusiveMaximum.rat) >= 0 {
+				fail("must be less than %s", n.exclusiveMaximum.text)
+			}
+			if n.multipleOf != nil && !new(big.Rat).Quo(r, n.multipleOf.rat).IsInt() {
+				fail("must be a multiple of %s", n.multipleOf.text)
+			}
+		}
+	}
+
+	for _, s := range n.allOf {
+		s.validate(v, ptr, errs)
+	}
+	if n.anyOf != nil && !slices.ContainsFunc(n.anyOf, func(s *schemaNode) bool { return s.valid(v) }) {
+		fail("must match at least one of the anyOf schemas")
+	}
+	if n.oneOf != nil {
+		matched := 0
+		for _, s := range n.oneOf {
+			if s.valid(v) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			fail("must match exactly one of the oneOf schemas, but matches %d", matched)
+		}
+	}
+	if n.not != nil && n.not.valid(v) {
+		fail("must not match the not schema")
+	}
+	if n.ifSchema != nil {
+		if n.ifSchema.valid(v) {
+			if n.thenSchema != nil {
+				n.thenSchema.validate(v, ptr, errs)
+			}
+		} else if n.elseSchema != nil {
+			n.elseSchema.validate(v, ptr, errs)
+		}
+	}
+}
+
+// validateArray applies the array keywords of n to v.
+func (n *schemaNode) validateArray(v []any, ptr string, errs *FieldErrors, fail func(string, ...any)) {
+	if n.minItems >= 0 && len(v) < n.minItems {
+		fail("must have at least %d items", n.minItems)
+	}
+	if n.maxItems >= 0 && len(v) > n.maxItems {
+		fail("must have at most %d items", n.maxItems)
+	}
+	if n.uniqueItems {
+	unique:
+		for i := range v {
+			for j := range i {
+				if jsonEqual(v[i], v[j]) {
+					fail("must not contain duplicate items")
+					break unique
+				}
+			}
+		}
+	}
+	for i, item := range v {
+		itemPtr := ptr + "/" + strconv.Itoa(i)
+		if i < len(n.prefixItems) {
+			n.prefixItems[i].validate(item, itemPtr, errs)
+		} else if n.items != nil {
+			n.items.validate(item, itemPtr, errs)
+		}
+	}
+	if n.contains != nil {
+		matched := 0
+		for _, item := range v {
+			if n.contains.valid(item) {
+				matched++
+			}
+		}
+		least := 1
+		if n.minContains >= 0 {
+			least = n.minContains
+		}
+		if matched < least {
+			fail("must contain at least %d matching items", least)
+		}
+		if n.maxContains >= 0 && matched > n.maxContains {
+			fail("must contain at most %d matching items", n.maxContains)
+		}
+	}
+}
+
+// validateObject applies the object keywords of n to v.
+func (n *schemaNode) validateObject(v map[string]any, ptr string, errs *FieldErrors, fail func(string, ...any)) {
+	if n.minProperties >= 0 && len(v) < n.minProperties {
+		fail("must have at least %d properties", n.minProperties)
+	}
+	if n.maxProperties >= 0 && len(v) > n.maxProperties {
+		fail("must have at most %d properties", n.maxProperties)
+	}
+	for _, name := range n.required {
+		if _, ok := v[name]; !ok {
+			*errs = append(*errs, FieldError{Field: ptr + "/" + escapePointer(name), Message: "is required"})
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(v)) { // for a deterministic error order
+		propPtr := ptr + "/" + escapePointer(name)
+		if n.propertyNames != nil {
+			n.propertyNames.validate(name, propPtr, errs)
+		}
+		for _, dep := range n.dependentRequired[name] {
+			if _, ok := v[dep]; !ok {
+				*errs = append(*errs, FieldError{Field: ptr + "/" + escapePointer(dep), Message: fmt.Sprintf("is required when %q is present", name)})
+			}
+		}
+		if s, ok := n.dependentSchemas[name]; ok {
+			s.validate(v, ptr, errs)
+		}
+		evaluated := false
+		if s, ok := n.properties[name]; ok {
+			s.validate(v[name], propPtr, errs)
+			evaluated = true
+		}
+		for _, p := range n.patternProperties {
+			if p.re.MatchString(name) {
+				p.schema.validate(v[name], propPtr, errs)
+				evaluated = true
+			}
+		}
+		if !evaluated && n.additionalProperties != nil {
+			n.additionalProperties.validate(v[name], propPtr, errs)
+		}
+	}
+}
+
+// hasType reports whether the decoded JSON value v is of the JSON Schema type t.
+func hasType(v any, t string) bool {
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := ratOf(v)
+		return ok
+	case "integer":
+		r, ok := ratOf(v)
+		return ok && r.IsInt()
+	}
+	return false
+}
+
+// ratOf returns the JSON number v exactly.
+func ratOf(v any) (*big.Rat, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(v.String())
+	case float64:
+		r := new(big.Rat)
+		if r.SetFloat64(v) == nil {
+			return nil, false
+		}
+		return r, true
+	}
+	return nil, false
+}
+
+// jsonEqual reports whether two decoded JSON values are equal, comparing
+// numbers by value so that 1 and 1.0 are equal.
+func jsonEqual(a, b any) bool {
+	if ra, ok := ratOf(a); ok {
+		rb, ok := ratOf(b)
+		return ok && ra.Cmp(rb) == 0
+	}
+	switch a := a.(type) {
+	case []any:
+		b, ok := b.([]any)
+		return ok && slices.EqualFunc(a, b, jsonEqual)
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, va := range a {
+			vb, ok := b[k]
+			if !ok || !jsonEqual(va, vb) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// escapePointer escapes a member name for use in a JSON Pointer.
+func escapePointer(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
+
+// pointerOrRoot names the schema location ptr in a compile error.
+func pointerOrRoot(ptr string) string {
+	if ptr == "" {
+		return "#"
+	}
+	return "#" + ptr
+}
@@ -0,0 +1,167 @@
+package bind
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const userSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["name", "age"],
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "maxLength": 5},
+		"age": {"type": "integer", "minimum": 0},
+		"email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+		"tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": true, "maxItems": 3},
+		"address": {"$ref": "#/$defs/address"},
+		"role": {"enum": ["admin", "user"]}
+	},
+	"additionalProperties": false,
+	"$defs": {
+		"address": {
+			"type": "object",
+			"required": ["city"],
+			"properties": {"city": {"type": "string"}}
+		}
+	}
+}`
+
+func TestSchema_Validate(t *testing.T) {
+	s := MustCompileSchema([]byte(userSchema))
+	tests := []struct {
+		name string
+		doc  string
+		want []string // "field message"
+	}{
+		{"valid", `{"name":"ada","age":36,"tags":["a","b"],"address":{"city":"x"},"role":"admin"}`, nil},
+		{"wrong type", `[]`, []string{" must be of type object"}},
+		{"missing", `{}`, []string{"/name is required", "/age is required"}},
+		{"string and number", `{"name":"","age":1.5}`, []string{"/age must be of type integer", "/name must be at least 1 characters long"}},
+		{"integral float", `{"name":"ada","age":2.0}`, nil},
+		{"pattern", `{"name":"ada","age":1,"email":"nope"}`, []string{`/email must match the pattern "^[^@]+@[^@]+$"`}},
+		{"array", `{"name":"ada","age":1,"tags":["a",1,"a","b"]}`, []string{"/tags must have at most 3 items", "/tags must not contain duplicate items", "/tags/1 must be of type string"}},
+		{"ref", `{"name":"ada","age":1,"address":{}}`, []string{"/address/city is required"}},
+		{"additional", `{"name":"ada","age":1,"a/b":true}`, []string{"/a~1b is not allowed"}},
+		{"enum", `{"name":"ada","age":1,"role":"root"}`, []string{"/role must be one of the allowed values"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			if err := s.Validate(decodeDoc(t, tt.doc)); err != nil {
+				var fields FieldErrors
+				if !errors.As(err, &fields) {
+					t.Fatalf("Validate = %v, want FieldErrors", err)
+				}
+				for _, f := range fields {
+					got = append(got, f.Field+" "+f.Message)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Validate = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchema_Applicators(t *testing.T) {
+	tests := []struct {
+		schema, doc string
+		valid       bool
+	}{
+		{`{"anyOf":[{"type":"string"},{"type":"integer"}]}`, `3`, true},
+		{`{"anyOf":[{"type":"string"},{"type":"integer"}]}`, `true`, false},
+		{`{"oneOf":[{"minimum":0},{"maximum":10}]}`, `5`, false},
+		{`{"oneOf":[{"minimum":0},{"maximum":10}]}`, `50`, true},
+		{`{"not":{"type":"null"}}`, `null`, false},
+		{`{"allOf":[{"minimum":1},{"exclusiveMaximum":3}]}`, `3`, false},
+		{`{"if":{"properties":{"kind":{"const":"a"}}},"then":{"required":["x"]},"else":{"required":["y"]}}`, `{"kind":"a","y":1}`, false},
+		{`{"if":{"properties":{"kind":{"const":"a"}}},"then":{"required":["x"]},"else":{"required":["y"]}}`, `{"kind":"b","y":1}`, true},
+		{`{"multipleOf":0.1}`, `0.3`, true},
+		{`{"const":{"a":[1,2]}}`, `{"a":[1.0,2]}`, true},
+		{`{"prefixItems":[{"type":"string"}],"items":false}`, `["a"]`, true},
+		{`{"prefixItems":[{"type":"string"}],"items":false}`, `["a",1]`, false},
+		{`{"contains":{"type":"integer"},"minContains":2}`, `[1,"a",2]`, true},
+		{`{"contains":{"type":"integer"},"maxContains":1}`, `[1,2]`, false},
+		{`{"patternProperties":{"^x-":{"type":"string"}},"additionalProperties":false}`, `{"x-a":"b"}`, true},
+		{`{"propertyNames":{"maxLength":2}}`, `{"abc":1}`, false},
+		{`{"dependentRequired":{"card":["cvc"]}}`, `{"card":1}`, false},
+		{`{"$defs":{"node":{"type":"object","properties":{"next":{"$ref":"#/$defs/node"}}}},"$ref":"#/$defs/node"}`, `{"next":{"next":{"next":1}}}`, false},
+		{`true`, `{}`, true},
+		{`false`, `{}`, false},
+	}
+	for _, tt := range tests {
+		s, err := CompileSchema([]byte(tt.schema))
+		if err != nil {
+			t.Fatalf("CompileSchema(%s) = %v", tt.schema, err)
+		}
+		if err := s.Validate(decodeDoc(t, tt.doc)); (err == nil) != tt.valid {
+			t.Errorf("%s against %s: Validate = %v, want valid %v", tt.doc, tt.schema, err, tt.valid)
+		}
+	}
+}
+
+func TestCompileSchema(t *testing.T) {
+	a, err := CompileSchema([]byte(userSchema))
+	if err != nil {
+		t.Fatalf("CompileSchema = %v", err)
+	}
+	if b, _ := CompileSchema([]byte(userSchema)); a != b {
+		t.Error("CompileSchema did not return the cached schema")
+	}
+
+	for _, schema := range []string{
+		`{`,
+		`"object"`,
+		`{"type":"text"}`,
+		`{"minLength":-1}`,
+		`{"pattern":"("}`,
+		`{"$ref":"#/$defs/missing"}`,
+		`{"$ref":"other.json"}`,
+		`{"unevaluatedProperties":false}`,
+		`{"items":[{"type":"string"}]}`,
+		`{"properties":{"a":1}}`,
+	} {
+		if _, err := CompileSchema([]byte(schema)); err == nil {
+			t.Errorf("CompileSchema(%s) = nil, want error", schema)
+		}
+	}
+}
+
+func TestJSON_Schema(t *testing.T) {
+	opts := Options{Schema: MustCompileSchema([]byte(userSchema))}
+
+	got, err := JSONWith[createUser](newRequest("application/json", `{"name":"ada","age":36}`), opts)
+	if err != nil || got != (createUser{Name: "ada", Age: 36}) {
+		t.Errorf("JSONWith = %+v, %v", got, err)
+	}
+
+	_, err = JSONWith[createUser](newRequest("application/json", `{"name":"ada","age":36,"extra":1}`), opts)
+	var bindErr *Error
+	if !errors.As(err, &bindErr) {
+		t.Fatalf("error = %v, want *Error", err)
+	}
+	if bindErr.Status != http.StatusUnprocessableEntity || len(bindErr.Fields) != 1 || bindErr.Fields[0].Field != "/extra" {
+		t.Errorf("got status %d with fields %v, want 422 for /extra", bindErr.Status, bindErr.Fields)
+	}
+
+	_, err = JSONWith[createUser](newRequest("application/json", `{"name":`), opts)
+	if !errors.As(err, &bindErr) || bindErr.Status != http.StatusBadRequest {
+		t.Errorf("error = %v, want 400 for malformed JSON", err)
+	}
+}
+
+func decodeDoc(t *testing.T, doc string) any {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
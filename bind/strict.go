@@ -0,0 +1,152 @@
+package bind
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NumberPolicy controls how JSONWith treats JSON numbers.
+type NumberPolicy int
+
+const (
+	// NumbersFloat64 decodes numbers as encoding/json does: into the target
+	// field's type, or float64 for interface values. Integers beyond 2^53
+	// silently lose precision in float64 targets.
+	NumbersFloat64 NumberPolicy = iota
+	// NumbersExact rejects numbers that a float64 cannot hold exactly as
+	// written: integers beyond ±2^53 and values outside the float64 range.
+	// Decimal fractions such as 0.1 are accepted.
+	NumbersExact
+	// NumbersAsJSONNumber decodes numbers in interface values as
+	// json.Number, keeping their exact text for the handler to parse.
+	NumbersAsJSONNumber
+)
+
+// strict reports whether opts enables any of the structural limits that
+// need the body scanned before it is decoded.
+func (opts Options) strict() bool {
+	return opts.MaxDepth > 0 || opts.MaxStringLength > 0 || opts.MaxArrayLength > 0 ||
+		opts.RejectDuplicateKeys || opts.Numbers == NumbersExact
+}
+
+// scanFrame is an object or array being scanned by checkLimits.
+type scanFrame struct {
+	object    bool
+	keys      map[string]bool
+	key       string // current member, for objects
+	n         int    // elements so far, for arrays
+	expectKey bool
+}
+
+// checkLimits scans data token by token and returns an *Error for the first
+// value that breaks a limit in opts. Syntax errors are left for the decoder,
+// which reports them with the usual messages.
+func checkLimits(data []byte, opts Options) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var stack []*scanFrame
+	path := func() string {
+		var b strings.Builder
+		for _, f := range stack {
+			if f.object {
+				if b.Len() > 0 {
+					b.WriteByte('.')
+				}
+				b.WriteString(f.key)
+			} else {
+				fmt.Fprintf(&b, "[%d]", f.n-1)
+			}
+		}
+		return b.String()
+	}
+	violation := func(message string) error {
+		return &Error{
+			Status:  http.StatusBadRequest,
+			Message: "request body exceeds JSON limits",
+			Fields:  FieldErrors{{Field: path(), Message: message}},
+		}
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil // end of input, or a syntax error for the decoder to report
+		}
+		var top *scanFrame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+
+		if top != nil && top.object && top.expectKey {
+			if tok == json.Delim('}') {
+				stack = stack[:len(stack)-1]
+				valueDone(stack)
+				continue
+			}
+			key, _ := tok.(string)
+			top.key = key
+			if opts.MaxStringLength > 0 && len(key) > opts.MaxStringLength {
+				return violation(fmt.Sprintf("has a name longer than %d bytes", opts.MaxStringLength))
+			}
+			if opts.RejectDuplicateKeys && top.keys[key] {
+				return violation("is a duplicate key")
+			}
+			top.keys[key] = true
+			top.expectKey = false
+			continue
+		}
+
+		if tok == json.Delim(']') {
+			stack = stack[:len(stack)-1]
+			valueDone(stack)
+			continue
+		}
+		if top != nil && !top.object {
+			top.n++
+			if opts.MaxArrayLength > 0 && top.n > opts.MaxArrayLength {
+				return violation(fmt.Sprintf("exceeds the maximum array length of %d", opts.MaxArrayLength))
+			}
+		}
+		switch t := tok.(type) {
+		case json.Delim: // '{' or '['
+			if opts.MaxDepth > 0 && len(stack) >= opts.MaxDepth {
+				return violation(fmt.Sprintf("is nested deeper than %d levels", opts.MaxDepth))
+			}
+			stack = append(stack, &scanFrame{object: t == '{', keys: map[string]bool{}, expectKey: t == '{'})
+			continue
+		case string:
+			if opts.MaxStringLength > 0 && len(t) > opts.MaxStringLength {
+				return violation(fmt.Sprintf("is longer than %d bytes", opts.MaxStringLength))
+			}
+		case json.Number:
+			if opts.Numbers == NumbersExact && !exactNumber(string(t)) {
+				return violation("is a number that cannot be represented exactly")
+			}
+		}
+		valueDone(stack)
+	}
+}
+
+// valueDone records that a member value of the innermost object has been
+// scanned, so the next token is a key.
+func valueDone(stack []*scanFrame) {
+	if len(stack) > 0 && stack[len(stack)-1].object {
+		stack[len(stack)-1].expectKey = true
+	}
+}
+
+// exactNumber reports whether the JSON number s is within the float64
+// range and, if it is an integer literal, within ±2^53.
+func exactNumber(s string) bool {
+	if strings.ContainsAny(s, ".eE") {
+		_, err := strconv.ParseFloat(s, 64)
+		return !errors.Is(err, strconv.ErrRange)
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return err == nil && n >= -1<<53 && n <= 1<<53
+}
@@ -0,0 +1,52 @@
+package config
+
+import "fmt"
+
+// ClientConfig holds the connection pool settings for outbound HTTP clients
+// built with httpclient.NewTransport.
+// All fields are populated from environment variables with sensible defaults.
+type ClientConfig struct {
+	// MaxIdleConns is the maximum number of idle connections kept across all
+	// hosts. Zero means no limit. Defaults to 100 if HTTP_CLIENT_MAX_IDLE_CONNS is not set.
+	MaxIdleConns int `env:"HTTP_CLIENT_MAX_IDLE_CONNS" envDefault:"100"`
+	// MaxIdleConnsPerHost is the maximum number of idle connections kept per
+	// host. Services that call a few hosts at high concurrency should raise it,
+	// or connections are closed and redialled under load.
+	// Defaults to 10 if HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST is not set.
+	MaxIdleConnsPerHost int `env:"HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST" envDefault:"10"`
+	// MaxConnsPerHost limits the connections per host, counting those in use.
+	// Zero means no limit. No limit applies if HTTP_CLIENT_MAX_CONNS_PER_HOST is not set.
+	MaxConnsPerHost int `env:"HTTP_CLIENT_MAX_CONNS_PER_HOST"`
+	// IdleConnTimeout is the number of seconds an idle connection is kept
+	// before it is closed. Defaults to 90 seconds if HTTP_CLIENT_IDLE_CONN_TIMEOUT is not set.
+	IdleConnTimeout int `env:"HTTP_CLIENT_IDLE_CONN_TIMEOUT" envDefault:"90"`
+	// TLSHandshakeTimeout is the maximum number of seconds a TLS handshake may take.
+	// Defaults to 10 seconds if HTTP_CLIENT_TLS_HANDSHAKE_TIMEOUT is not set.
+	TLSHandshakeTimeout int `env:"HTTP_CLIENT_TLS_HANDSHAKE_TIMEOUT" envDefault:"10"`
+	// TLSSessionCacheSize is the number of TLS sessions cached for resumption,
+	// which makes handshakes with hosts seen before cheaper. Zero disables the
+	// cache. Defaults to 64 if HTTP_CLIENT_TLS_SESSION_CACHE_SIZE is not set.
+	TLSSessionCacheSize int `env:"HTTP_CLIENT_TLS_SESSION_CACHE_SIZE" envDefault:"64"`
+}
+
+// Validate checks that the ClientConfig has valid values.
+// Currently validates that no setting is negative.
+// Returns an error if validation fails, nil otherwise.
+func (c ClientConfig) Validate() error {
+	for _, s := range []struct {
+		name  string
+		value int
+	}{
+		{"HTTP_CLIENT_MAX_IDLE_CONNS", c.MaxIdleConns},
+		{"HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST", c.MaxIdleConnsPerHost},
+		{"HTTP_CLIENT_MAX_CONNS_PER_HOST", c.MaxConnsPerHost},
+		{"HTTP_CLIENT_IDLE_CONN_TIMEOUT", c.IdleConnTimeout},
+		{"HTTP_CLIENT_TLS_HANDSHAKE_TIMEOUT", c.TLSHandshakeTimeout},
+		{"HTTP_CLIENT_TLS_SESSION_CACHE_SIZE", c.TLSSessionCacheSize},
+	} {
+		if s.value < 0 {
+			return fmt.Errorf("invalid %s: %d (must not be negative)", s.name, s.value)
+		}
+	}
+	return nil
+}
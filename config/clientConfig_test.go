@@ -0,0 +1,33 @@
+package config
+
+import "testing"
+
+func TestParseConfig_ClientConfig_Defaults(t *testing.T) {
+	for _, v := range []string{"HTTP_CLIENT_MAX_IDLE_CONNS", "HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST", "HTTP_CLIENT_MAX_CONNS_PER_HOST", "HTTP_CLIENT_IDLE_CONN_TIMEOUT", "HTTP_CLIENT_TLS_HANDSHAKE_TIMEOUT", "HTTP_CLIENT_TLS_SESSION_CACHE_SIZE"} {
+		t.Setenv(v, "")
+	}
+
+	cfg, err := ParseConfig[ClientConfig]()
+	if err != nil {
+		t.Fatalf("ParseConfig() with defaults should not error, got: %v", err)
+	}
+	want := ClientConfig{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90,
+		TLSHandshakeTimeout: 10,
+		TLSSessionCacheSize: 64,
+	}
+	if cfg != want {
+		t.Errorf("ParseConfig() = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestClientConfig_Validate(t *testing.T) {
+	if err := (ClientConfig{}).Validate(); err != nil {
+		t.Errorf("zero ClientConfig: Validate() = %v, want nil", err)
+	}
+	if err := (ClientConfig{MaxIdleConnsPerHost: -1}).Validate(); err == nil {
+		t.Error("negative MaxIdleConnsPerHost: Validate() = nil, want error")
+	}
+}
@@ -0,0 +1,22 @@
+package config
+
+import "context"
+
+// contextKey is the unexported key type for values stored in a context by this package.
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that carries cfg.
+//
+// server.NewServerWithConfig uses this to make the parsed ServerConfig
+// available to every request handled by the server, so that handlers and
+// middleware can retrieve it with FromContext.
+func NewContext(ctx context.Context, cfg ServerConfig) context.Context {
+	return context.WithValue(ctx, contextKey{}, cfg)
+}
+
+// FromContext returns the ServerConfig stored in ctx by NewContext, and
+// whether one was present.
+func FromContext(ctx context.Context) (ServerConfig, bool) {
+	cfg, ok := ctx.Value(contextKey{}).(ServerConfig)
+	return cfg, ok
+}
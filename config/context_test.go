@@ -0,0 +1,30 @@
+package config
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContext_RoundTrip(t *testing.T) {
+	cfg := ServerConfig{Environment: Production, Port: 9000}
+
+	ctx := NewContext(context.Background(), cfg)
+
+	got, ok := FromContext(ctx)
+	if !ok {
+		t.Fatal("FromContext() should find the stored config")
+	}
+	if got != cfg {
+		t.Errorf("FromContext() = %+v, want %+v", got, cfg)
+	}
+}
+
+func TestContext_Missing(t *testing.T) {
+	got, ok := FromContext(context.Background())
+	if ok {
+		t.Error("FromContext() on empty context should report false")
+	}
+	if got != (ServerConfig{}) {
+		t.Errorf("FromContext() on empty context = %+v, want zero value", got)
+	}
+}
@@ -6,8 +6,9 @@
 //
 // Configuration structs must implement the Validator interface so that semantic
 // constraints (e.g. valid environment names) are checked after the raw environment
-// variables have been parsed. ParseConfig handles both steps and returns a combined
-// error so callers can decide how to react — log.Fatal, a fallback config, etc.
+// variables have been parsed. Fields may also carry validate struct tags (see the
+// validate package), checked before Validate with errors naming the variable.
+// ParseConfig handles parsing and validation and returns a combined error so callers can decide how to react — log.Fatal, a fallback config, etc.
 //
 // Example usage:
 //
@@ -16,4 +17,13 @@
 //	    log.Fatal(err)
 //	}
 //	fmt.Printf("Server running on port %d in %s environment\n", cfg.Port, cfg.Environment)
+//
+// ParseConfigFrom reads the same struct tags from a list of Sources instead,
+// later ones taking precedence: the environment (Env), .env files
+// (DotEnvFile) and flat JSON files (JSONFile). Optional skips files that do
+// not exist, so a local config file can sit under production env overrides.
+//
+// A Watcher holds a configuration parsed from sources and reloads it on
+// demand or when its files change, notifying subscribers of each Change.
+// logging.FollowConfig and server.WithConfigWatcher build on it.
 package config
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// ParseRouteLogLevels parses a list of per-route log level overrides, as read
+// from the ROUTE_LOG_LEVELS environment variable, into a map from route
+// pattern to level. The list is comma-separated pattern=level pairs:
+//
+//	/healthz=DEBUG,/metrics=DEBUG,/admin/=WARN
+//
+// Patterns must begin with "/". Levels accept the same values as LOG_LEVEL.
+// An empty string yields an empty map.
+func ParseRouteLogLevels(s string) (map[string]slog.Level, error) {
+	levels := make(map[string]slog.Level)
+	for entry := range strings.SplitSeq(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, levelStr, ok := strings.Cut(entry, "=")
+		pattern, levelStr = strings.TrimSpace(pattern), strings.TrimSpace(levelStr)
+		if !ok || !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("invalid route log level %q (must be /pattern=LEVEL)", entry)
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(levelStr)); err != nil {
+			return nil, fmt.Errorf("invalid route log level %q: %w", entry, err)
+		}
+		levels[pattern] = level
+	}
+	return levels, nil
+}
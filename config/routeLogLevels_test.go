@@ -0,0 +1,40 @@
+package config
+
+import (
+	"log/slog"
+	"maps"
+	"testing"
+)
+
+func TestParseRouteLogLevels(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]slog.Level
+		wantErr bool
+	}{
+		{"empty", "", map[string]slog.Level{}, false},
+		{"single", "/healthz=DEBUG", map[string]slog.Level{"/healthz": slog.LevelDebug}, false},
+		{
+			"multiple_with_spaces",
+			" /healthz = debug , /admin/=WARN,",
+			map[string]slog.Level{"/healthz": slog.LevelDebug, "/admin/": slog.LevelWarn},
+			false,
+		},
+		{"missing_level", "/healthz", nil, true},
+		{"relative_pattern", "healthz=DEBUG", nil, true},
+		{"unknown_level", "/healthz=LOUD", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRouteLogLevels(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRouteLogLevels(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("ParseRouteLogLevels(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -25,6 +25,23 @@ const (
 	Production Environment = "production"
 )
 
+// AccessLogFormat defines the line format of the access log.
+// Valid values are CommonLogFormat and CombinedLogFormat.
+type AccessLogFormat string
+
+// String returns the string representation of the AccessLogFormat.
+func (f AccessLogFormat) String() string {
+	return string(f)
+}
+
+const (
+	// CommonLogFormat is the Apache Common Log Format.
+	CommonLogFormat AccessLogFormat = "common"
+	// CombinedLogFormat is the Apache Combined Log Format, which extends the
+	// Common Log Format with the Referer and User-Agent request headers.
+	CombinedLogFormat AccessLogFormat = "combined"
+)
+
 // ServerConfig holds the configuration for an HTTP server.
 // All fields are populated from environment variables with sensible defaults.
 type ServerConfig struct {
@@ -37,6 +54,14 @@ type ServerConfig struct {
 	// Port is the HTTP server port number.
 	// Defaults to 8080 if PORT is not set.
 	Port int `env:"PORT" envDefault:"8080"`
+	// ListenNetwork is the network server.Run listens on: tcp, tcp4, tcp6 or
+	// unix. Defaults to tcp if LISTEN_NETWORK is not set.
+	ListenNetwork string `env:"LISTEN_NETWORK" envDefault:"tcp"`
+	// ListenAddress is the address server.Run listens on, such as
+	// "127.0.0.1:8080" or, for unix, the socket path. For the tcp networks it
+	// defaults to ":PORT" if LISTEN_ADDRESS is not set; unix requires it.
+	// A listener inherited through systemd socket activation takes precedence.
+	ListenAddress string `env:"LISTEN_ADDRESS"`
 	// ReadTimeout is the maximum duration in seconds for reading the entire request.
 	// Defaults to 15 seconds if READ_TIMEOUT is not set.
 	ReadTimeout int `env:"READ_TIMEOUT" envDefault:"15"`
@@ -46,22 +71,149 @@ type ServerConfig struct {
 	// IdleTimeout is the maximum duration in seconds to wait for the next request
 	// when keep-alives are enabled. Defaults to 60 seconds if IDLE_TIMEOUT is not set.
 	IdleTimeout int `env:"IDLE_TIMEOUT" envDefault:"60"`
+	// HandlerTimeout is the maximum duration in seconds a handler may take
+	// before middleware.NewTimeout answers 504 Gateway Timeout. It must be
+	// shorter than WriteTimeout for the 504 to reach the client. Handlers are
+	// not limited if HANDLER_TIMEOUT is not set.
+	HandlerTimeout int `env:"HANDLER_TIMEOUT"`
+	// H2C enables HTTP/2 over cleartext (prior knowledge, as gRPC clients and
+	// load balancers speak it) alongside HTTP/1.1, for servers that do not
+	// terminate TLS themselves. Defaults to false if H2C is not set.
+	H2C bool `env:"H2C"`
+	// HTTP2MaxConcurrentStreams is the number of concurrent streams a client
+	// may open on one HTTP/2 connection. Defaults to Go's default (at least
+	// 100) if HTTP2_MAX_CONCURRENT_STREAMS is not set. HTTP/2 connections
+	// are closed after IdleTimeout like HTTP/1.1 ones.
+	HTTP2MaxConcurrentStreams int `env:"HTTP2_MAX_CONCURRENT_STREAMS"`
+	// HTTP2ReadIdleTimeout is the duration in seconds after which a ping
+	// checks the health of an HTTP/2 connection nothing has been received on,
+	// so dead connections behind load balancers are noticed. No health
+	// checks are made if HTTP2_READ_IDLE_TIMEOUT is not set.
+	HTTP2ReadIdleTimeout int `env:"HTTP2_READ_IDLE_TIMEOUT"`
+	// TuneRuntime controls whether server.Run sets the Go runtime's memory limit
+	// from the container's cgroup memory limit at startup.
+	// Defaults to true if TUNE_RUNTIME is not set.
+	TuneRuntime bool `env:"TUNE_RUNTIME" envDefault:"true"`
+	// RouteLogLevels overrides the level at which requests to particular routes
+	// are logged, as comma-separated pattern=level pairs (e.g. "/healthz=DEBUG").
+	// Parse it with ParseRouteLogLevels. No overrides apply if ROUTE_LOG_LEVELS is not set.
+	RouteLogLevels string `env:"ROUTE_LOG_LEVELS"`
+	// CrashDir is a directory that crash reports are written to when a handler
+	// panics or the server fails. Crash reports are disabled if CRASH_DIR is not set.
+	CrashDir string `env:"CRASH_DIR"`
+	// AccessLogFile is the path of a file that access log lines are appended to,
+	// separate from the application log. The access log is disabled if
+	// ACCESS_LOG_FILE is not set.
+	AccessLogFile string `env:"ACCESS_LOG_FILE"`
+	// AccessLogFormat is the access log line format (common or combined).
+	// Defaults to combined if ACCESS_LOG_FORMAT is not set.
+	AccessLogFormat AccessLogFormat `env:"ACCESS_LOG_FORMAT" envDefault:"combined"`
+	// AdminPort is the port of the admin server that server.Run starts for
+	// operational endpoints. The admin server is disabled if ADMIN_PORT is not set.
+	AdminPort int `env:"ADMIN_PORT"`
+	// AdminToken is the bearer token that admin requests must present.
+	// Required when AdminPort is set, unless AdminClientCAFile is.
+	AdminToken string `env:"ADMIN_TOKEN"`
+	// AdminTLSCertFile and AdminTLSKeyFile are the certificate and key the
+	// admin server serves TLS with. The admin server uses plain HTTP if
+	// ADMIN_TLS_CERT_FILE is not set.
+	AdminTLSCertFile string `env:"ADMIN_TLS_CERT_FILE"`
+	AdminTLSKeyFile  string `env:"ADMIN_TLS_KEY_FILE"`
+	// AdminClientCAFile is a PEM file of CA certificates for mutual TLS: admin
+	// clients presenting a certificate signed by one of them are authorized
+	// without a token. Requires AdminTLSCertFile and AdminTLSKeyFile.
+	AdminClientCAFile string `env:"ADMIN_CLIENT_CA_FILE"`
 }
 
 // Validate checks that the ServerConfig has valid values.
-// Currently validates that Environment is one of Local, Test, or Production.
+// Currently validates that Environment is one of Local, Test, or Production,
+// that RouteLogLevels can be parsed, that HandlerTimeout is not negative and
+// is shorter than WriteTimeout, that AccessLogFormat, if set, is
+// common or combined, that the HTTP/2 settings are not negative, that
+// ListenNetwork is supported and has the address it needs, and that an
+// enabled admin server has a valid port and a way to authorize requests.
 // Returns an error if validation fails, nil otherwise.
 func (c ServerConfig) Validate() error {
 	switch c.Environment {
 	case Local, Test, Production:
-		return nil
 	default:
 		return fmt.Errorf("invalid environment: %s (must be local, test or production)", c.Environment)
 	}
+
+	if _, err := ParseRouteLogLevels(c.RouteLogLevels); err != nil {
+		return err
+	}
+
+	if c.HandlerTimeout < 0 {
+		return fmt.Errorf("invalid handler timeout: %d (must not be negative)", c.HandlerTimeout)
+	}
+	if c.HandlerTimeout > 0 && c.WriteTimeout > 0 && c.HandlerTimeout >= c.WriteTimeout {
+		return fmt.Errorf("handler timeout %ds must be shorter than write timeout %ds", c.HandlerTimeout, c.WriteTimeout)
+	}
+
+	if c.HTTP2MaxConcurrentStreams < 0 {
+		return fmt.Errorf("invalid HTTP/2 max concurrent streams: %d (must not be negative)", c.HTTP2MaxConcurrentStreams)
+	}
+	if c.HTTP2ReadIdleTimeout < 0 {
+		return fmt.Errorf("invalid HTTP/2 read idle timeout: %d (must not be negative)", c.HTTP2ReadIdleTimeout)
+	}
+
+	switch c.ListenNetwork {
+	case "", "tcp", "tcp4", "tcp6":
+	case "unix":
+		if c.ListenAddress == "" {
+			return fmt.Errorf("LISTEN_NETWORK unix requires LISTEN_ADDRESS, the socket path")
+		}
+	default:
+		return fmt.Errorf("invalid listen network: %s (must be tcp, tcp4, tcp6 or unix)", c.ListenNetwork)
+	}
+
+	switch c.AccessLogFormat {
+	case "", CommonLogFormat, CombinedLogFormat:
+	default:
+		return fmt.Errorf("invalid access log format: %s (must be common or combined)", c.AccessLogFormat)
+	}
+
+	return c.validateAdmin()
+}
+
+// ListenAddr returns the network and address the server should listen on, from
+// ListenNetwork and ListenAddress, defaulting to tcp and ":Port".
+func (c ServerConfig) ListenAddr() (network, address string) {
+	network, address = c.ListenNetwork, c.ListenAddress
+	if network == "" {
+		network = "tcp"
+	}
+	if address == "" && network != "unix" {
+		address = fmt.Sprintf(":%d", c.Port)
+	}
+	return network, address
+}
+
+// validateAdmin checks the admin server settings.
+func (c ServerConfig) validateAdmin() error {
+	if c.AdminPort == 0 {
+		return nil
+	}
+	if c.AdminPort < 0 || c.AdminPort > 65535 {
+		return fmt.Errorf("invalid admin port: %d", c.AdminPort)
+	}
+	if (c.AdminTLSCertFile == "") != (c.AdminTLSKeyFile == "") {
+		return fmt.Errorf("admin TLS requires both ADMIN_TLS_CERT_FILE and ADMIN_TLS_KEY_FILE")
+	}
+	if c.AdminClientCAFile != "" && c.AdminTLSCertFile == "" {
+		return fmt.Errorf("ADMIN_CLIENT_CA_FILE requires admin TLS")
+	}
+	if c.AdminToken == "" && c.AdminClientCAFile == "" {
+		return fmt.Errorf("admin server requires ADMIN_TOKEN or ADMIN_CLIENT_CA_FILE")
+	}
+	return nil
 }
 
 // ParseConfig parses environment variables into a configuration struct of type C
-// and validates the result. The type parameter C must implement the Validator interface.
+// and validates the result: first against any validate struct tags on its fields
+// (see the validate package), then with its Validate method. The type parameter C
+// must implement the Validator interface.
 // Returns an error if parsing or validation fails, allowing the caller to decide how to handle it.
 //
 // Example:
@@ -77,7 +229,25 @@ func ParseConfig[C Validator]() (C, error) {
 		return zero, fmt.Errorf("failed to parse config from environment: %w", err)
 	}
 
-	if err := cfg.Validate(); err != nil {
+	if err := validateConfig(cfg); err != nil {
+		return zero, fmt.Errorf("config validation failed: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// ParseConfigWithPrefix is ParseConfig reading every variable with the given
+// prefix, so that several configurations can share one environment. For
+// example, with the prefix "BILLING_", ServerConfig reads BILLING_PORT and
+// BILLING_LOG_LEVEL; unset variables take their defaults as usual.
+func ParseConfigWithPrefix[C Validator](prefix string) (C, error) {
+	var zero C
+	cfg, err := env.ParseAsWithOptions[C](env.Options{Prefix: prefix})
+	if err != nil {
+		return zero, fmt.Errorf("failed to parse config from environment: %w", err)
+	}
+
+	if err := validateConfig(cfg); err != nil {
 		return zero, fmt.Errorf("config validation failed: %w", err)
 	}
 
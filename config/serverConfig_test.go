@@ -95,6 +95,144 @@ func TestServerConfig_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "invalid environment: LOCAL (must be local, test or production)",
 		},
+		{
+			name: "Valid handler timeout",
+			config: ServerConfig{
+				Environment:    Local,
+				HandlerTimeout: 10,
+				WriteTimeout:   15,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid handler timeout - negative",
+			config: ServerConfig{
+				Environment:    Local,
+				HandlerTimeout: -1,
+			},
+			wantErr: true,
+			errMsg:  "invalid handler timeout: -1 (must not be negative)",
+		},
+		{
+			name: "Invalid handler timeout - not shorter than write timeout",
+			config: ServerConfig{
+				Environment:    Local,
+				HandlerTimeout: 15,
+				WriteTimeout:   15,
+			},
+			wantErr: true,
+			errMsg:  "handler timeout 15s must be shorter than write timeout 15s",
+		},
+		{
+			name: "Valid common access log format",
+			config: ServerConfig{
+				Environment:     Local,
+				AccessLogFormat: CommonLogFormat,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid access log format",
+			config: ServerConfig{
+				Environment:     Local,
+				AccessLogFormat: "json",
+			},
+			wantErr: true,
+			errMsg:  "invalid access log format: json (must be common or combined)",
+		},
+		{
+			name: "Invalid route log levels",
+			config: ServerConfig{
+				Environment:    Local,
+				RouteLogLevels: "/healthz=LOUD",
+			},
+			wantErr: true,
+			errMsg:  `invalid route log level "/healthz=LOUD": slog: level string "LOUD": unknown name`,
+		},
+		{
+			name: "Valid admin server with token",
+			config: ServerConfig{
+				Environment: Local,
+				AdminPort:   9090,
+				AdminToken:  "secret",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Admin server without authorization",
+			config: ServerConfig{
+				Environment: Local,
+				AdminPort:   9090,
+			},
+			wantErr: true,
+			errMsg:  "admin server requires ADMIN_TOKEN or ADMIN_CLIENT_CA_FILE",
+		},
+		{
+			name: "Admin client CA without TLS",
+			config: ServerConfig{
+				Environment:       Local,
+				AdminPort:         9090,
+				AdminClientCAFile: "ca.pem",
+			},
+			wantErr: true,
+			errMsg:  "ADMIN_CLIENT_CA_FILE requires admin TLS",
+		},
+		{
+			name: "Invalid admin port",
+			config: ServerConfig{
+				Environment: Local,
+				AdminPort:   70000,
+				AdminToken:  "secret",
+			},
+			wantErr: true,
+			errMsg:  "invalid admin port: 70000",
+		},
+		{
+			name: "Valid h2c with HTTP/2 tuning",
+			config: ServerConfig{
+				Environment:               Local,
+				H2C:                       true,
+				HTTP2MaxConcurrentStreams: 250,
+				HTTP2ReadIdleTimeout:      30,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Negative HTTP/2 max concurrent streams",
+			config: ServerConfig{
+				Environment:               Local,
+				HTTP2MaxConcurrentStreams: -1,
+			},
+			wantErr: true,
+			errMsg:  "invalid HTTP/2 max concurrent streams: -1 (must not be negative)",
+		},
+		{
+			name: "Valid unix socket listener",
+			config: ServerConfig{
+				Environment:   Local,
+				ListenNetwork: "unix",
+				ListenAddress: "/run/app.sock",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Unix listener without address",
+			config: ServerConfig{
+				Environment:   Local,
+				ListenNetwork: "unix",
+			},
+			wantErr: true,
+			errMsg:  "LISTEN_NETWORK unix requires LISTEN_ADDRESS, the socket path",
+		},
+		{
+			name: "Invalid listen network",
+			config: ServerConfig{
+				Environment:   Local,
+				ListenNetwork: "udp",
+			},
+			wantErr: true,
+			errMsg:  "invalid listen network: udp (must be tcp, tcp4, tcp6 or unix)",
+		},
 		{
 			name: "Valid config with all fields populated",
 			config: ServerConfig{
@@ -125,7 +263,7 @@ func TestServerConfig_Validate(t *testing.T) {
 
 func TestParseConfig_ServerConfig_Defaults(t *testing.T) {
 	// Clear all relevant environment variables to test defaults
-	envVars := []string{"ENVIRONMENT", "LOG_LEVEL", "PORT", "READ_TIMEOUT", "WRITE_TIMEOUT", "IDLE_TIMEOUT"}
+	envVars := []string{"ENVIRONMENT", "LOG_LEVEL", "PORT", "READ_TIMEOUT", "WRITE_TIMEOUT", "IDLE_TIMEOUT", "TUNE_RUNTIME", "ACCESS_LOG_FILE", "ACCESS_LOG_FORMAT", "CRASH_DIR", "LISTEN_NETWORK", "LISTEN_ADDRESS"}
 	for _, v := range envVars {
 		t.Setenv(v, "")
 	}
@@ -154,6 +292,21 @@ func TestParseConfig_ServerConfig_Defaults(t *testing.T) {
 	if cfg.IdleTimeout != 60 {
 		t.Errorf("Default IdleTimeout = %v, want %v", cfg.IdleTimeout, 60)
 	}
+	if !cfg.TuneRuntime {
+		t.Errorf("Default TuneRuntime = %v, want %v", cfg.TuneRuntime, true)
+	}
+	if cfg.CrashDir != "" {
+		t.Errorf("Default CrashDir = %q, want empty", cfg.CrashDir)
+	}
+	if cfg.AccessLogFile != "" {
+		t.Errorf("Default AccessLogFile = %q, want empty", cfg.AccessLogFile)
+	}
+	if cfg.AccessLogFormat != CombinedLogFormat {
+		t.Errorf("Default AccessLogFormat = %v, want %v", cfg.AccessLogFormat, CombinedLogFormat)
+	}
+	if network, address := cfg.ListenAddr(); network != "tcp" || address != ":8080" {
+		t.Errorf("Default ListenAddr() = %q, %q, want %q, %q", network, address, "tcp", ":8080")
+	}
 }
 
 func TestParseConfig_ServerConfig_CustomValues(t *testing.T) {
@@ -164,6 +317,7 @@ func TestParseConfig_ServerConfig_CustomValues(t *testing.T) {
 	t.Setenv("READ_TIMEOUT", "30")
 	t.Setenv("WRITE_TIMEOUT", "30")
 	t.Setenv("IDLE_TIMEOUT", "120")
+	t.Setenv("TUNE_RUNTIME", "false")
 
 	cfg, err := ParseConfig[ServerConfig]()
 	if err != nil {
@@ -189,6 +343,33 @@ func TestParseConfig_ServerConfig_CustomValues(t *testing.T) {
 	if cfg.IdleTimeout != 120 {
 		t.Errorf("IdleTimeout = %v, want %v", cfg.IdleTimeout, 120)
 	}
+	if cfg.TuneRuntime {
+		t.Errorf("TuneRuntime = %v, want %v", cfg.TuneRuntime, false)
+	}
+}
+
+func TestParseConfigWithPrefix(t *testing.T) {
+	t.Setenv("PORT", "8080")
+	t.Setenv("ENVIRONMENT", "production")
+	t.Setenv("BILLING_PORT", "9000")
+	t.Setenv("BILLING_ENVIRONMENT", "")
+
+	cfg, err := ParseConfigWithPrefix[ServerConfig]("BILLING_")
+	if err != nil {
+		t.Fatalf("ParseConfigWithPrefix() error = %v", err)
+	}
+	if cfg.Port != 9000 {
+		t.Errorf("Port = %v, want %v", cfg.Port, 9000)
+	}
+	// Unset prefixed variables take their defaults, not the unprefixed values.
+	if cfg.Environment != Local {
+		t.Errorf("Environment = %v, want %v", cfg.Environment, Local)
+	}
+
+	t.Setenv("BILLING_ENVIRONMENT", "staging")
+	if _, err := ParseConfigWithPrefix[ServerConfig]("BILLING_"); err == nil || !contains(err.Error(), "invalid environment: staging") {
+		t.Errorf("ParseConfigWithPrefix() error = %v, want a validation error", err)
+	}
 }
 
 func TestParseConfig_ValidationError(t *testing.T) {
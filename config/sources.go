@@ -0,0 +1,221 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/caarlos0/env/v11"
+)
+
+// Source supplies configuration values to ParseConfigFrom, keyed by
+// environment variable name, so that every source fills the same `env` struct
+// tags.
+type Source interface {
+	// Values returns the variables the source defines.
+	Values() (map[string]string, error)
+}
+
+// SourceFunc adapts a function to a Source.
+type SourceFunc func() (map[string]string, error)
+
+// Values implements Source.
+func (f SourceFunc) Values() (map[string]string, error) {
+	return f()
+}
+
+// Env returns a Source of the process environment.
+func Env() Source {
+	return SourceFunc(func() (map[string]string, error) {
+		return env.ToMap(os.Environ()), nil
+	})
+}
+
+// DotEnvFile returns a Source reading the named .env file. Each line is
+// NAME=value, optionally preceded by "export ". Blank lines and lines starting
+// with # are ignored. Values may be double-quoted, with \n, \t, \" and \\
+// escapes, or single-quoted, taken literally; unquoted values end at " #".
+func DotEnvFile(name string) Source {
+	return SourceFunc(func() (map[string]string, error) {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		vars, err := parseDotEnv(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return vars, nil
+	})
+}
+
+// JSONFile returns a Source reading the named JSON file, which must hold one
+// object mapping variable names to strings, numbers, booleans or arrays of
+// them. Arrays become comma-separated lists, matching the default separator
+// for slice fields:
+//
+//	{"PORT": 9000, "LOG_LEVEL": "DEBUG", "TUNE_RUNTIME": false}
+func JSONFile(name string) Source {
+	return SourceFunc(func() (map[string]string, error) {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		vars, err := parseJSONVars(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return vars, nil
+	})
+}
+
+// Optional returns a Source like s that defines nothing, instead of failing,
+// when its file does not exist. Use it for files present only in some
+// environments, such as a developer's .env.
+func Optional(s Source) Source {
+	return SourceFunc(func() (map[string]string, error) {
+		vars, err := s.Values()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return vars, err
+	})
+}
+
+// ParseConfigFrom parses a configuration struct of type C from sources and
+// validates it, like ParseConfig. Sources are applied in order, so later ones
+// take precedence; list the environment last to let it override files:
+//
+//	cfg, err := config.ParseConfigFrom[config.ServerConfig](
+//		config.Optional(config.JSONFile("config.json")),
+//		config.Optional(config.DotEnvFile(".env")),
+//		config.Env(),
+//	)
+//
+// Only the given sources are consulted; the environment is not read unless
+// Env is among them. YAML files are not supported.
+func ParseConfigFrom[C Validator](sources ...Source) (C, error) {
+	var zero C
+	vars := make(map[string]string)
+	for _, s := range sources {
+		v, err := s.Values()
+		if err != nil {
+			return zero, fmt.Errorf("failed to read config source: %w", err)
+		}
+		maps.Copy(vars, v)
+	}
+
+	cfg, err := env.ParseAsWithOptions[C](env.Options{Environment: vars})
+	if err != nil {
+		return zero, fmt.Errorf("failed to parse config from sources: %w", err)
+	}
+	if err := validateConfig(cfg); err != nil {
+		return zero, fmt.Errorf("config validation failed: %w", err)
+	}
+	return cfg, nil
+}
+
+// parseDotEnv parses the contents of a .env file.
+func parseDotEnv(data []byte) (map[string]string, error) {
+	vars := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("line %d: expected NAME=value", n)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case strings.HasPrefix(value, `"`):
+			end := closingQuote(value)
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated quoted value", n)
+			}
+			unquoted, err := strconv.Unquote(value[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			value = unquoted
+		case strings.HasPrefix(value, "'"):
+			end := strings.IndexByte(value[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated quoted value", n)
+			}
+			value = value[1 : end+1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		vars[name] = value
+	}
+	return vars, sc.Err()
+}
+
+// closingQuote returns the index of the double quote ending the quoted
+// string at the start of s, or -1.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseJSONVars parses a flat JSON object of variables.
+func parseJSONVars(data []byte) (map[string]string, error) {
+	var raw map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string, len(raw))
+	for name, v := range raw {
+		arr, ok := v.([]any)
+		if !ok {
+			arr = []any{v}
+		}
+		items := make([]string, len(arr))
+		for i, item := range arr {
+			s, err := jsonScalar(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			items[i] = s
+		}
+		vars[name] = strings.Join(items, ",")
+	}
+	return vars, nil
+}
+
+// jsonScalar formats a decoded JSON string, number or boolean.
+func jsonScalar(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v (want a string, number, boolean or array of them)", v)
+	}
+}
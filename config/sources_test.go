@@ -0,0 +1,135 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseDotEnv(t *testing.T) {
+	vars, err := parseDotEnv([]byte(`
+# local settings
+PORT=9000
+export LOG_LEVEL = DEBUG  # noisy
+GREETING="hello \"world\"\nbye"
+RAW='a\nb # not a comment'
+EMPTY=
+URL=http://host/#frag
+`))
+	if err != nil {
+		t.Fatalf("parseDotEnv() error = %v", err)
+	}
+	want := map[string]string{
+		"PORT":      "9000",
+		"LOG_LEVEL": "DEBUG",
+		"GREETING":  "hello \"world\"\nbye",
+		"RAW":       `a\nb # not a comment`,
+		"EMPTY":     "",
+		"URL":       "http://host/#frag",
+	}
+	for k, v := range want {
+		if vars[k] != v {
+			t.Errorf("%s = %q, want %q", k, vars[k], v)
+		}
+	}
+	if len(vars) != len(want) {
+		t.Errorf("got %d variables, want %d", len(vars), len(want))
+	}
+
+	for _, bad := range []string{"NOEQUALS", "=value", `Q="open`, "A B=1"} {
+		if _, err := parseDotEnv([]byte(bad)); err == nil {
+			t.Errorf("parseDotEnv(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestParseJSONVars(t *testing.T) {
+	vars, err := parseJSONVars([]byte(`{"PORT": 9000, "TUNE_RUNTIME": false, "HOSTS": ["a", "b"], "NAME": "x", "RATIO": 0.5}`))
+	if err != nil {
+		t.Fatalf("parseJSONVars() error = %v", err)
+	}
+	want := map[string]string{"PORT": "9000", "TUNE_RUNTIME": "false", "HOSTS": "a,b", "NAME": "x", "RATIO": "0.5"}
+	for k, v := range want {
+		if vars[k] != v {
+			t.Errorf("%s = %q, want %q", k, vars[k], v)
+		}
+	}
+
+	for _, bad := range []string{`{"A": {"nested": 1}}`, `{"A": null}`, `[1]`} {
+		if _, err := parseJSONVars([]byte(bad)); err == nil {
+			t.Errorf("parseJSONVars(%s) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestParseConfigFrom(t *testing.T) {
+	jsonFile := writeFile(t, "config.json", `{"PORT": 9000, "LOG_LEVEL": "INFO", "ENVIRONMENT": "test"}`)
+	dotEnv := writeFile(t, ".env", "LOG_LEVEL=DEBUG\nREAD_TIMEOUT=30\n")
+	t.Setenv("READ_TIMEOUT", "45")
+
+	cfg, err := ParseConfigFrom[ServerConfig](
+		JSONFile(jsonFile),
+		DotEnvFile(dotEnv),
+		Optional(DotEnvFile(filepath.Join(t.TempDir(), "missing.env"))),
+		Env(),
+	)
+	if err != nil {
+		t.Fatalf("ParseConfigFrom() error = %v", err)
+	}
+	if cfg.Port != 9000 || cfg.Environment != Test {
+		t.Errorf("Port, Environment = %d, %s; want values from the JSON file", cfg.Port, cfg.Environment)
+	}
+	if cfg.LogLevel != slog.LevelDebug {
+		t.Errorf("LogLevel = %v, want DEBUG from .env overriding the JSON file", cfg.LogLevel)
+	}
+	if cfg.ReadTimeout != 45 {
+		t.Errorf("ReadTimeout = %d, want 45 from the environment overriding .env", cfg.ReadTimeout)
+	}
+	if cfg.WriteTimeout != 15 {
+		t.Errorf("WriteTimeout = %d, want the default 15", cfg.WriteTimeout)
+	}
+
+	_, err = ParseConfigFrom[ServerConfig](DotEnvFile(filepath.Join(t.TempDir(), "missing.env")))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing required file error = %v, want fs.ErrNotExist", err)
+	}
+
+	_, err = ParseConfigFrom[ServerConfig](SourceFunc(func() (map[string]string, error) {
+		return map[string]string{"ENVIRONMENT": "staging"}, nil
+	}))
+	if err == nil || !strings.Contains(err.Error(), "config validation failed") {
+		t.Errorf("invalid config error = %v, want a validation error", err)
+	}
+}
+
+type taggedConfig struct {
+	Name string `env:"APP_NAME" validate:"required,min=3"`
+}
+
+func (taggedConfig) Validate() error { return nil }
+
+func TestParseConfigFrom_ValidateTags(t *testing.T) {
+	vars := func(v map[string]string) Source {
+		return SourceFunc(func() (map[string]string, error) { return v, nil })
+	}
+	if _, err := ParseConfigFrom[taggedConfig](vars(map[string]string{"APP_NAME": "api"})); err != nil {
+		t.Errorf("ParseConfigFrom() error = %v", err)
+	}
+	_, err := ParseConfigFrom[taggedConfig](vars(map[string]string{"APP_NAME": "x"}))
+	if err == nil || !strings.Contains(err.Error(), "APP_NAME must be at least 3 characters long") {
+		t.Errorf("error = %v, want the APP_NAME field error", err)
+	}
+}
@@ -1,5 +1,7 @@
 package config
 
+import "github.com/harrydayexe/GoWebUtilities/validate"
+
 // Validator is an interface for configuration types that support validation.
 // Configuration structs should implement this interface to enable validation
 // of their fields after parsing from environment variables.
@@ -8,3 +10,13 @@ type Validator interface {
 	// It returns an error describing what is invalid, or nil if the configuration is valid.
 	Validate() error
 }
+
+// validateConfig checks cfg against the validate tags on its fields, which
+// name fields by their environment variable, and then calls its Validate
+// method.
+func validateConfig[C Validator](cfg C) error {
+	if err := validate.StructWith(cfg, validate.Options{NameTag: "env"}); err != nil {
+		return err
+	}
+	return cfg.Validate()
+}
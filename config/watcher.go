@@ -0,0 +1,181 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Change describes a reload that altered a Watcher's configuration.
+type Change[C any] struct {
+	Old, New C
+}
+
+// WatcherOptions configures NewWatcher. Zero values are defaults.
+type WatcherOptions struct {
+	// Files are the configuration files that Watch polls for changes, such
+	// as those read by the Watcher's DotEnvFile and JSONFile sources.
+	Files []string
+	// Interval is how often Watch polls Files. Defaults to 2 seconds.
+	Interval time.Duration
+	// Logger receives failed reloads during Watch. Defaults to
+	// slog.Default().
+	Logger *slog.Logger
+}
+
+// Watcher holds a configuration parsed from sources and re-parses it on
+// demand (Reload) or when its files change (Watch), notifying subscribers of
+// each change so a long-running server can adjust log levels and similar
+// settings without a restart. A reload that fails to parse or validate is
+// discarded, keeping the previous configuration.
+//
+// A Watcher is safe for concurrent use. Subscribers are called one reload at
+// a time, in subscription order.
+type Watcher[C Validator] struct {
+	sources []Source
+	opts    WatcherOptions
+	files   []fileState // as of the initial parse, for Watch
+
+	reloadMu sync.Mutex // serializes reloads and their notifications
+
+	mu      sync.Mutex // guards the fields below
+	current C
+	subs    map[int]func(Change[C])
+	nextSub int
+}
+
+// NewWatcher parses the configuration from sources, as ParseConfigFrom does,
+// and returns a Watcher holding it. It returns an error if the initial
+// configuration is invalid.
+//
+//	w, err := config.NewWatcher[config.ServerConfig](
+//		config.WatcherOptions{Files: []string{"config.json"}},
+//		config.Optional(config.JSONFile("config.json")),
+//		config.Env(),
+//	)
+//	go w.Watch(ctx)
+//	logging.FollowConfig(w)
+func NewWatcher[C Validator](opts WatcherOptions, sources ...Source) (*Watcher[C], error) {
+	if opts.Interval <= 0 {
+		opts.Interval = 2 * time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	cfg, err := ParseConfigFrom[C](sources...)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher[C]{sources: sources, opts: opts, current: cfg, subs: make(map[int]func(Change[C]))}
+	w.files = w.stat()
+	return w, nil
+}
+
+// Current returns the configuration as of the last successful reload.
+func (w *Watcher[C]) Current() C {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Subscribe registers fn to be called after each reload that changes the
+// configuration, and returns a function that unregisters it. fn may call
+// Current but must not call Reload.
+func (w *Watcher[C]) Subscribe(fn func(Change[C])) (unsubscribe func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	id := w.nextSub
+	w.nextSub++
+	w.subs[id] = fn
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subs, id)
+	}
+}
+
+// Reload re-parses the configuration from the Watcher's sources. If it is
+// valid and differs from the current one, it replaces it and subscribers are
+// notified before Reload returns. If it is invalid, Reload returns the error
+// and the current configuration stays in effect.
+func (w *Watcher[C]) Reload() error {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+	cfg, err := ParseConfigFrom[C](w.sources...)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	if reflect.DeepEqual(cfg, w.current) {
+		w.mu.Unlock()
+		return nil
+	}
+	change := Change[C]{Old: w.current, New: cfg}
+	w.current = cfg
+	var subs []func(Change[C])
+	for id := range w.nextSub {
+		if fn, ok := w.subs[id]; ok {
+			subs = append(subs, fn)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, fn := range subs {
+		fn(change)
+	}
+	return nil
+}
+
+// Watch polls the modification time and size of opts.Files every
+// opts.Interval and calls Reload when any of them has changed since the
+// previous poll (since NewWatcher, for the first poll), until ctx is done.
+// A file that appears or disappears also counts as a change. Failed reloads
+// are logged.
+//
+// Watch does not handle signals; to also reload on SIGHUP, pass the Watcher
+// to server.WithConfigWatcher, or call Reload from a signal handler.
+func (w *Watcher[C]) Watch(ctx context.Context) {
+	last := w.files
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := w.stat()
+		if slices.Equal(now, last) {
+			continue
+		}
+		last = now
+		if err := w.Reload(); err != nil {
+			w.opts.Logger.ErrorContext(ctx, "config reload failed, keeping previous config",
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+// fileState is what Watch compares to detect a changed file.
+type fileState struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+// stat returns the state of each watched file.
+func (w *Watcher[C]) stat() []fileState {
+	states := make([]fileState, len(w.opts.Files))
+	for i, name := range w.opts.Files {
+		if fi, err := os.Stat(name); err == nil {
+			states[i] = fileState{exists: true, modTime: fi.ModTime(), size: fi.Size()}
+		}
+	}
+	return states
+}
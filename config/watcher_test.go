@@ -0,0 +1,80 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatcher_Reload(t *testing.T) {
+	path := writeFile(t, ".env", "LOG_LEVEL=WARN\n")
+	w, err := NewWatcher[ServerConfig](WatcherOptions{}, DotEnvFile(path))
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+
+	var changes []Change[ServerConfig]
+	unsubscribe := w.Subscribe(func(c Change[ServerConfig]) {
+		if w.Current() != c.New {
+			t.Error("Current() inside a subscriber does not return the new config")
+		}
+		changes = append(changes, c)
+	})
+
+	if err := w.Reload(); err != nil || len(changes) != 0 {
+		t.Fatalf("unchanged Reload() = %v with %d notifications, want nil and none", err, len(changes))
+	}
+
+	os.WriteFile(path, []byte("LOG_LEVEL=DEBUG\n"), 0o600)
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(changes) != 1 || changes[0].Old.LogLevel != slog.LevelWarn || changes[0].New.LogLevel != slog.LevelDebug {
+		t.Fatalf("changes = %+v, want one WARN to DEBUG change", changes)
+	}
+
+	os.WriteFile(path, []byte("ENVIRONMENT=staging\n"), 0o600)
+	if err := w.Reload(); err == nil {
+		t.Error("Reload() of an invalid config succeeded")
+	}
+	if w.Current().LogLevel != slog.LevelDebug {
+		t.Error("invalid reload replaced the current config")
+	}
+
+	unsubscribe()
+	os.WriteFile(path, []byte("LOG_LEVEL=ERROR\n"), 0o600)
+	w.Reload()
+	if len(changes) != 1 {
+		t.Errorf("unsubscribed callback was notified")
+	}
+
+	if _, err := NewWatcher[ServerConfig](WatcherOptions{}, DotEnvFile(path+".missing")); err == nil {
+		t.Error("NewWatcher() with an unreadable source succeeded")
+	}
+}
+
+func TestWatcher_Watch(t *testing.T) {
+	path := writeFile(t, "config.json", `{"LOG_LEVEL": "WARN"}`)
+	w, err := NewWatcher[ServerConfig](WatcherOptions{Files: []string{path}, Interval: 5 * time.Millisecond}, JSONFile(path))
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	changed := make(chan Change[ServerConfig], 1)
+	w.Subscribe(func(c Change[ServerConfig]) { changed <- c })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Watch(ctx)
+
+	os.WriteFile(path, []byte(`{"LOG_LEVEL": "INFO", "PORT": 9000}`), 0o600)
+	select {
+	case c := <-changed:
+		if c.New.LogLevel != slog.LevelInfo || c.New.Port != 9000 {
+			t.Errorf("new config = %+v, want INFO on port 9000", c.New)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Watch did not reload after the file changed")
+	}
+}
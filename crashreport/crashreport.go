@@ -0,0 +1,292 @@
+package crashreport
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/logging"
+)
+
+// masked replaces secret values in a report.
+const masked = "[MASKED]"
+
+// Report describes a crash.
+type Report struct {
+	// Time is when the crash happened. Defaults to the time of Write.
+	Time time.Time
+	// Reason is a one-line description, such as the panic value or error.
+	Reason string
+	// Stack is the stack trace to include, such as from debug.Stack.
+	Stack []byte
+	// Request, if set, is the request being served when the crash happened.
+	// Its method, URL, protocol, remote address and headers are recorded,
+	// with headers and query parameters whose names suggest a secret masked.
+	Request *http.Request
+	// Attrs are additional request attributes to record, such as those
+	// extracted by middleware.NewRequestAttrs. Attributes whose keys suggest
+	// a secret are masked.
+	Attrs []slog.Attr
+	// Config, if set, is a configuration struct to snapshot. Fields and
+	// headers whose names suggest a secret (such as "Password", "APIKey" or
+	// "Authorization") are masked.
+	Config any
+}
+
+// Write writes rep as a timestamped text file in dir, creating dir if needed,
+// and returns the file's path. The file is written under a temporary name,
+// synced to disk and then renamed, so a crash report is either complete or
+// absent even if the process dies while writing it.
+func Write(dir string, rep Report) (string, error) {
+	if rep.Time.IsZero() {
+		rep.Time = time.Now()
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create crash report directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, ".crash-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create crash report: %w", err)
+	}
+	defer os.Remove(f.Name()) // no-op once renamed
+
+	if _, err := f.Write(rep.format()); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to write crash report: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to sync crash report: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to close crash report: %w", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("crash-%s.txt", rep.Time.UTC().Format("20060102T150405.000000000Z")))
+	if err := os.Rename(f.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to rename crash report: %w", err)
+	}
+	return path, nil
+}
+
+// format renders the report as text.
+func (rep Report) format() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "time: %s\n", rep.Time.Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "reason: %s\n", rep.Reason)
+	if host, err := os.Hostname(); err == nil {
+		fmt.Fprintf(&b, "host: %s\n", host)
+	}
+	fmt.Fprintf(&b, "pid: %d\n", os.Getpid())
+
+	if r := rep.Request; r != nil {
+		b.WriteString("\n== request ==\n")
+		fmt.Fprintf(&b, "%s %s %s\n", r.Method, maskedRequestURI(r.URL), r.Proto)
+		fmt.Fprintf(&b, "host: %s\n", r.Host)
+		fmt.Fprintf(&b, "remote: %s\n", r.RemoteAddr)
+		names := make([]string, 0, len(r.Header))
+		for name := range r.Header {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			value := strings.Join(r.Header[name], ", ")
+			if logging.IsSecretName(name) {
+				value = masked
+			}
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+
+	if len(rep.Attrs) > 0 {
+		b.WriteString("\n== attributes ==\n")
+		for _, a := range rep.Attrs {
+			value := a.Value.String()
+			if logging.IsSecretName(a.Key) {
+				value = masked
+			}
+			fmt.Fprintf(&b, "%s: %s\n", a.Key, value)
+		}
+	}
+
+	b.WriteString("\n== build ==\n")
+	if info, ok := debug.ReadBuildInfo(); ok {
+		b.WriteString(info.String())
+	} else {
+		b.WriteString("unavailable\n")
+	}
+
+	if rep.Config != nil {
+		b.WriteString("\n== config ==\n")
+		writeConfig(&b, rep.Config)
+	}
+
+	if len(rep.Stack) > 0 {
+		b.WriteString("\n== stack ==\n")
+		b.Write(rep.Stack)
+		if rep.Stack[len(rep.Stack)-1] != '\n' {
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
+
+// MaskedConfig renders cfg as it appears in crash reports: one "Name: value"
+// line per exported field, with the values of fields whose names suggest a
+// secret masked, also within nested structs, maps (by key) and slices, and
+// the passwords of URLs removed. Other diagnostics use it to show
+// configuration safely.
+func MaskedConfig(cfg any) string {
+	var b bytes.Buffer
+	writeConfig(&b, cfg)
+	return b.String()
+}
+
+// writeConfig writes one line per exported field of the struct cfg, masking
+// non-zero values of fields whose names suggest a secret. Values other than
+// structs are written as a single line.
+func writeConfig(b *bytes.Buffer, cfg any) {
+	v := reflect.Indirect(reflect.ValueOf(cfg))
+	if v.Kind() != reflect.Struct {
+		fmt.Fprintf(b, "%s\n", maskedValue(reflect.ValueOf(cfg), 0))
+		return
+	}
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fmt.Fprintf(b, "%s: %s\n", field.Name, maskedField(field.Name, v.Field(i), 0))
+	}
+}
+
+// maxConfigDepth bounds how deep maskedValue descends, so that cyclic
+// pointers end.
+const maxConfigDepth = 8
+
+// maskedField formats the value of a field or map entry called name, masked
+// if the name suggests a secret and the value is set.
+func maskedField(name string, v reflect.Value, depth int) string {
+	if logging.IsSecretName(name) && !v.IsZero() {
+		return masked
+	}
+	return maskedValue(v, depth)
+}
+
+// maskedValue formats v as %v would, but masks secret fields and map
+// entries of nested structs and maps, and removes passwords from URLs.
+// Values with a String or Error method, other than structs holding secrets,
+// are formatted with it.
+func maskedValue(v reflect.Value, depth int) string {
+	if !v.IsValid() {
+		return "<nil>"
+	}
+	if depth > maxConfigDepth {
+		return "..."
+	}
+	if v.CanInterface() {
+		switch x := v.Interface().(type) {
+		case url.URL:
+			return x.Redacted()
+		case *url.URL:
+			if x != nil {
+				return x.Redacted()
+			}
+		case fmt.Stringer, error:
+			if !hasExportedFields(reflect.TypeOf(x)) {
+				return fmt.Sprint(x)
+			}
+		}
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return "<nil>"
+		}
+		return maskedValue(v.Elem(), depth+1)
+	case reflect.Struct:
+		var parts []string
+		t := v.Type()
+		for i := range t.NumField() {
+			if field := t.Field(i); field.IsExported() {
+				parts = append(parts, field.Name+":"+maskedField(field.Name, v.Field(i), depth+1))
+			}
+		}
+		return "{" + strings.Join(parts, " ") + "}"
+	case reflect.Map:
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+		})
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			name := fmt.Sprint(k.Interface())
+			parts[i] = name + ":" + maskedField(name, v.MapIndex(k), depth+1)
+		}
+		return "map[" + strings.Join(parts, " ") + "]"
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprint(v.Interface())
+		}
+		parts := make([]string, v.Len())
+		for i := range v.Len() {
+			parts[i] = maskedValue(v.Index(i), depth+1)
+		}
+		return "[" + strings.Join(parts, " ") + "]"
+	}
+	if v.CanInterface() {
+		return fmt.Sprint(v.Interface())
+	}
+	return "?"
+}
+
+// hasExportedFields reports whether t, or the type t points to, is a struct
+// with exported fields.
+func hasExportedFields(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := range t.NumField() {
+		if t.Field(i).IsExported() {
+			return true
+		}
+	}
+	return false
+}
+
+// maskedRequestURI returns u's request URI with the values of query
+// parameters whose names suggest a secret, such as "token" or "api_key",
+// masked. The parameters keep their order.
+func maskedRequestURI(u *url.URL) string {
+	uri := u.RequestURI()
+	if u.RawQuery == "" {
+		return uri
+	}
+	path, _, _ := strings.Cut(uri, "?")
+	params := strings.Split(u.RawQuery, "&")
+	for i, param := range params {
+		rawName, _, hasValue := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+		if hasValue && logging.IsSecretName(name) {
+			params[i] = rawName + "=" + masked
+		}
+	}
+	return path + "?" + strings.Join(params, "&")
+}
@@ -0,0 +1,144 @@
+package crashreport
+
+import (
+	"log/slog"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Port        int
+	APIKey      string
+	DBPassword  string
+	EmptyToken  string
+	Environment string
+	unexported  string
+}
+
+func TestWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "crashes")
+	req := httptest.NewRequest("POST", "/pay?id=7&access_token=t-456&API%5FKEY=k-789", nil)
+	req.Header.Set("Authorization", "Bearer abc")
+	req.Header.Set("X-Request-Id", "req-1")
+
+	path, err := Write(dir, Report{
+		Time:    time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC),
+		Reason:  "panic: card declined",
+		Stack:   []byte("goroutine 1 [running]:\nmain.main()"),
+		Request: req,
+		Attrs:   []slog.Attr{slog.String("tenant", "acme"), slog.String("api_key", "k-123")},
+		Config: testConfig{
+			Port:        8080,
+			APIKey:      "k-123",
+			DBPassword:  "hunter2",
+			Environment: "production",
+			unexported:  "hidden",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got, want := filepath.Base(path), "crash-20260102T030405.000000006Z.txt"; got != want {
+		t.Errorf("file name = %q, want %q", got, want)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := string(data)
+	for _, want := range []string{
+		"reason: panic: card declined",
+		"== request ==\nPOST /pay?id=7&access_token=[MASKED]&API%5FKEY=[MASKED] HTTP/1.1",
+		"Authorization: [MASKED]",
+		"X-Request-Id: req-1",
+		"== attributes ==\ntenant: acme\napi_key: [MASKED]",
+		"== build ==",
+		"Port: 8080",
+		"APIKey: [MASKED]",
+		"DBPassword: [MASKED]",
+		"EmptyToken: \n",
+		"Environment: production",
+		"== stack ==\ngoroutine 1 [running]:\nmain.main()\n",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report should contain %q, got:\n%s", want, report)
+		}
+	}
+	for _, secret := range []string{"Bearer abc", "k-123", "t-456", "k-789", "hunter2", "hidden"} {
+		if strings.Contains(report, secret) {
+			t.Errorf("report should not contain %q", secret)
+		}
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the report in %s, found %d entries", dir, len(entries))
+	}
+}
+
+func TestWrite_MinimalReport(t *testing.T) {
+	path, err := Write(t.TempDir(), Report{Reason: "listen tcp :80: bind: permission denied"})
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "== request ==") || strings.Contains(string(data), "== config ==") {
+		t.Errorf("report should omit empty sections, got:\n%s", data)
+	}
+}
+
+func TestWrite_UnwritableDir(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Write(filepath.Join(file, "crashes"), Report{Reason: "x"}); err == nil {
+		t.Error("expected error when directory cannot be created")
+	}
+}
+
+func TestMaskedConfig(t *testing.T) {
+	got := MaskedConfig(testConfig{Port: 8080, APIKey: "k-123"})
+	want := "Port: 8080\nAPIKey: [MASKED]\nDBPassword: \nEmptyToken: \nEnvironment: \n"
+	if got != want {
+		t.Errorf("MaskedConfig = %q, want %q", got, want)
+	}
+}
+
+func TestMaskedConfig_Nested(t *testing.T) {
+	type db struct {
+		Host     string
+		Password string
+	}
+	type nestedConfig struct {
+		DB       db
+		Replicas []*db
+		Extra    map[string]string
+		Upstream *url.URL
+		Timeout  time.Duration
+	}
+	got := MaskedConfig(nestedConfig{
+		DB:       db{Host: "db.internal", Password: "hunter2"},
+		Replicas: []*db{{Host: "replica", Password: "hunter3"}, nil},
+		Extra:    map[string]string{"region": "eu", "api_token": "hunter4"},
+		Upstream: &url.URL{Scheme: "https", User: url.UserPassword("u", "hunter5"), Host: "up"},
+		Timeout:  time.Second,
+	})
+	want := "DB: {Host:db.internal Password:[MASKED]}\n" +
+		"Replicas: [{Host:replica Password:[MASKED]} <nil>]\n" +
+		"Extra: map[api_token:[MASKED] region:eu]\n" +
+		"Upstream: https://u:xxxxx@up\n" +
+		"Timeout: 1s\n"
+	if got != want {
+		t.Errorf("MaskedConfig = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,17 @@
+// Package crashreport writes crash reports to disk for post-mortem analysis.
+//
+// Logs are often lost when a process crashes: buffered output is never
+// flushed, or the log pipeline is the thing that failed. A crash report is a
+// self-contained text file holding the reason, stack trace, request metadata,
+// build information and a configuration snapshot with secrets masked.
+//
+// middleware.NewRecovery and server.Run write reports automatically when the
+// CRASH_DIR environment variable (config.ServerConfig.CrashDir) is set. Write
+// can also be called directly:
+//
+//	path, err := crashreport.Write("/var/crash/myapp", crashreport.Report{
+//	    Reason: fmt.Sprint(v),
+//	    Stack:  debug.Stack(),
+//	    Config: cfg,
+//	})
+package crashreport
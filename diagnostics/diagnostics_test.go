@@ -0,0 +1,168 @@
+package diagnostics
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+)
+
+// allow is an authorize function that approves every request.
+func allow(*http.Request) bool { return true }
+
+// tarNames returns the file names in a gzipped tar archive.
+func tarNames(t *testing.T, r io.Reader) []string {
+	t.Helper()
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatalf("invalid gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatalf("invalid tar: %v", err)
+		}
+		if hdr.Size == 0 {
+			t.Errorf("%s is empty", hdr.Name)
+		}
+		names = append(names, hdr.Name)
+	}
+}
+
+func TestProfileHandler_Unauthorized(t *testing.T) {
+	tests := []struct {
+		name      string
+		authorize func(*http.Request) bool
+	}{
+		{"nil_authorize", nil},
+		{"denied", func(*http.Request) bool { return false }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewProfileHandler(tt.authorize).ServeHTTP(w, httptest.NewRequest("GET", "/?seconds=0", nil))
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestProfileHandler_InvalidSeconds(t *testing.T) {
+	for _, seconds := range []string{"-1", "abc", "1000"} {
+		t.Run(seconds, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewProfileHandler(allow).ServeHTTP(w, httptest.NewRequest("GET", "/?seconds="+seconds, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestProfileHandler_Bundle(t *testing.T) {
+	tests := []struct {
+		name    string
+		seconds string
+		want    []string
+	}{
+		{"snapshots_only", "0", []string{"heap.pprof", "goroutine.pprof", "mutex.pprof", "block.pprof"}},
+		{"with_cpu", "1", []string{"cpu.pprof", "heap.pprof", "goroutine.pprof", "mutex.pprof", "block.pprof"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewProfileHandler(allow).ServeHTTP(w, httptest.NewRequest("GET", "/?seconds="+tt.seconds, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/gzip" {
+				t.Errorf("Content-Type = %q, want application/gzip", got)
+			}
+			if got := tarNames(t, w.Body); !slices.Equal(got, tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeakDetector_Leak(t *testing.T) {
+	d := NewLeakDetector(slog.New(slog.DiscardHandler), 50*time.Millisecond)
+	release := make(chan struct{})
+	defer close(release)
+
+	handler := d.Apply(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		go func() { <-release }()
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	err := d.Check()
+	if err == nil {
+		t.Fatal("expected leak to be reported")
+	}
+	if !strings.Contains(err.Error(), "1 goroutine(s) leaked") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := d.Check(); err != nil {
+		t.Errorf("expected leaks to be cleared after Check, got: %v", err)
+	}
+}
+
+func TestLeakDetector_NoLeak(t *testing.T) {
+	d := NewLeakDetector(slog.New(slog.DiscardHandler), time.Second)
+
+	handler := d.Apply(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The goroutine outlives the request but exits within the grace period.
+		go time.Sleep(20 * time.Millisecond)
+	}))
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	for range 3 {
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if err := d.Check(); err != nil {
+		t.Errorf("expected no leaks, got: %v", err)
+	}
+}
+
+func TestLeakDetector_OnlyInTestEnvironment(t *testing.T) {
+	d := NewLeakDetector(slog.New(slog.DiscardHandler), 10*time.Millisecond)
+	release := make(chan struct{})
+	defer close(release)
+
+	leaky := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		go func() { <-release }()
+	})
+	stack := middleware.CreateStack(
+		middleware.NewConfigContext(config.ServerConfig{Environment: config.Production}),
+		middleware.When(config.Test, d.Apply),
+	)
+	stack(leaky).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if err := d.Check(); err != nil {
+		t.Errorf("expected detector to be disabled outside the test environment, got: %v", err)
+	}
+}
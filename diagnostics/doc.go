@@ -0,0 +1,31 @@
+// Package diagnostics provides tools for inspecting a running service.
+//
+// NewProfileHandler serves a tar.gz bundle of pprof profiles (CPU, heap,
+// goroutine, mutex and block) captured on demand, so that an incident can be
+// investigated without shell access to the host. The handler must be given an
+// authorization function and should be mounted on an internal route:
+//
+//	mux.Handle("GET /debug/profiles", diagnostics.NewProfileHandler(
+//	    func(r *http.Request) bool {
+//	        return subtle.ConstantTimeCompare(
+//	            []byte(r.Header.Get("Authorization")), []byte("Bearer "+adminToken)) == 1
+//	    },
+//	))
+//
+// The bundle can then be fetched and analysed with:
+//
+//	curl -H "Authorization: Bearer $TOKEN" "host/debug/profiles?seconds=30" | tar xz
+//	go tool pprof cpu.pprof
+//
+// LeakDetector reports goroutines started by HTTP handlers that are still
+// running after the requests that started them have completed. It is meant
+// for the test environment, where Check lets test helpers fail a test that
+// leaks:
+//
+//	detector := diagnostics.NewLeakDetector(logger, time.Second)
+//	handler := middleware.When(config.Test, detector.Apply)(mux)
+//	// ... run requests ...
+//	if err := detector.Check(); err != nil {
+//	    t.Error(err)
+//	}
+package diagnostics
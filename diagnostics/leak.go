@@ -0,0 +1,211 @@
+package diagnostics
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ignoredStacks identifies goroutines that legitimately outlive a request,
+// such as those owned by net/http connections or the testing package.
+var ignoredStacks = []string{
+	"net/http.(*conn).serve",
+	"net/http.(*connReader).backgroundRead",
+	"net/http.(*persistConn)",
+	"net/http.(*Transport)",
+	"net/http.(*Server).Serve",
+	"net/http/httptest.(*Server)",
+	"testing.(*T)",
+	"testing.(*M)",
+	"testing.tRunner",
+	"os/signal.",
+	"diagnostics.(*LeakDetector)",
+}
+
+// LeakedGoroutine describes a goroutine that was started while serving
+// requests and was still running after they completed.
+type LeakedGoroutine struct {
+	// ID is the runtime goroutine ID.
+	ID int
+	// Stack is the goroutine's stack trace in runtime.Stack format.
+	Stack string
+}
+
+// LeakDetector finds goroutines leaked by HTTP handlers. It groups requests
+// into batches, where a batch runs from the moment the first request arrives
+// at an idle server until no requests are in flight. When a batch ends, the
+// running goroutines are compared with those at its start; any new goroutine
+// that has not exited within the grace period is reported as leaked, logged
+// as a warning, and recorded for Check.
+//
+// Leak detection lists every goroutine's stack after each batch, which is too
+// expensive for production. Enable it in the test environment only:
+//
+//	detector := diagnostics.NewLeakDetector(logger, time.Second)
+//	stack := middleware.CreateStack(middleware.When(config.Test, detector.Apply), ...)
+//
+// A LeakDetector is safe for concurrent use.
+type LeakDetector struct {
+	logger *slog.Logger
+	grace  time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	baseline map[int]string
+	checks   sync.WaitGroup
+	leaks    []LeakedGoroutine
+}
+
+// NewLeakDetector returns a LeakDetector that logs leaks to logger and gives
+// goroutines started by a batch of requests up to grace to exit after the
+// batch ends. A nil logger uses slog.Default().
+func NewLeakDetector(logger *slog.Logger, grace time.Duration) *LeakDetector {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &LeakDetector{logger: logger, grace: grace}
+}
+
+// Apply wraps next so that its requests are checked for goroutine leaks.
+// It has the middleware.Middleware signature.
+func (d *LeakDetector) Apply(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.begin()
+		defer d.end()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Check waits for pending batch checks to finish and returns an error
+// describing every goroutine leaked since the previous call, or nil if there
+// were none. Test helpers call it after a test's requests have completed:
+//
+//	t.Cleanup(func() {
+//	    if err := detector.Check(); err != nil {
+//	        t.Error(err)
+//	    }
+//	})
+func (d *LeakDetector) Check() error {
+	d.checks.Wait()
+	d.mu.Lock()
+	leaks := d.leaks
+	d.leaks = nil
+	d.mu.Unlock()
+
+	if len(leaks) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d goroutine(s) leaked by HTTP handlers:", len(leaks))
+	for _, g := range leaks {
+		b.WriteString("\n\n")
+		b.WriteString(g.Stack)
+	}
+	return fmt.Errorf("%s", b.String())
+}
+
+// begin records the goroutine baseline when a new batch starts.
+func (d *LeakDetector) begin() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.inFlight == 0 {
+		d.baseline = goroutineStacks()
+	}
+	d.inFlight++
+}
+
+// end starts a leak check when the last request of a batch completes.
+func (d *LeakDetector) end() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.inFlight--
+	if d.inFlight > 0 {
+		return
+	}
+	baseline := d.baseline
+	d.baseline = nil
+	d.checks.Add(1)
+	go d.check(baseline)
+}
+
+// check waits up to the grace period for goroutines started since baseline
+// to exit, then records and logs those still running.
+func (d *LeakDetector) check(baseline map[int]string) {
+	defer d.checks.Done()
+
+	deadline := time.Now().Add(d.grace)
+	var leaked []LeakedGoroutine
+	for {
+		leaked = leaked[:0]
+		for id, stack := range goroutineStacks() {
+			if _, ok := baseline[id]; ok || isIgnored(stack) {
+				continue
+			}
+			leaked = append(leaked, LeakedGoroutine{ID: id, Stack: stack})
+		}
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(leaked) == 0 {
+		return
+	}
+	slices.SortFunc(leaked, func(a, b LeakedGoroutine) int { return a.ID - b.ID })
+
+	for _, g := range leaked {
+		d.logger.Warn("goroutine leaked by HTTP handler",
+			slog.Int("goroutine", g.ID),
+			slog.String("stack", g.Stack),
+		)
+	}
+	d.mu.Lock()
+	d.leaks = append(d.leaks, leaked...)
+	d.mu.Unlock()
+}
+
+// isIgnored reports whether stack belongs to a goroutine that is expected to
+// outlive a request.
+func isIgnored(stack string) bool {
+	for _, s := range ignoredStacks {
+		if strings.Contains(stack, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// goroutineStacks returns the stack trace of every goroutine, keyed by ID.
+func goroutineStacks() map[int]string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[int]string)
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		// Each stack starts with a header such as "goroutine 12 [running]:".
+		rest, ok := strings.CutPrefix(g, "goroutine ")
+		if !ok {
+			continue
+		}
+		idStr, _, _ := strings.Cut(rest, " ")
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+		stacks[id] = g
+	}
+	return stacks
+}
@@ -0,0 +1,126 @@
+package diagnostics
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultCPUSeconds is the CPU profile duration when none is requested.
+	defaultCPUSeconds = 10
+	// maxCPUSeconds caps the requested CPU profile duration.
+	maxCPUSeconds = 120
+)
+
+// snapshotProfiles are the runtime/pprof profiles captured after the CPU
+// profile, in the order they appear in the bundle.
+var snapshotProfiles = []string{"heap", "goroutine", "mutex", "block"}
+
+// NewProfileHandler returns a handler that captures a bundle of pprof profiles
+// and sends it to the client as a tar.gz archive, so that an incident can be
+// debugged without shell access to the host.
+//
+// The bundle contains a CPU profile recorded for the number of seconds given by
+// the "seconds" query parameter (default 10, at most 120; 0 skips it) followed
+// by heap, goroutine, mutex and block profiles, each as a .pprof file readable
+// by go tool pprof. The mutex and block profiles are empty unless the program
+// enables them with runtime.SetMutexProfileFraction and
+// runtime.SetBlockProfileRate.
+//
+// Profiles expose internal details of the program, so every request must be
+// approved by authorize; a nil authorize rejects all requests. Unapproved
+// requests receive 401 Unauthorized. Only one CPU profile can run at a time;
+// concurrent requests receive 409 Conflict.
+//
+// The server's WriteTimeout must exceed the CPU profile duration, or the
+// connection is closed before the bundle is sent.
+func NewProfileHandler(authorize func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authorize == nil || !authorize(r) {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		seconds := defaultCPUSeconds
+		if s := r.URL.Query().Get("seconds"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 || n > maxCPUSeconds {
+				http.Error(w, fmt.Sprintf("seconds must be an integer between 0 and %d", maxCPUSeconds), http.StatusBadRequest)
+				return
+			}
+			seconds = n
+		}
+
+		files := make(map[string][]byte)
+		var names []string
+		if seconds > 0 {
+			var buf bytes.Buffer
+			if err := pprof.StartCPUProfile(&buf); err != nil {
+				http.Error(w, "cpu profile already in progress", http.StatusConflict)
+				return
+			}
+			select {
+			case <-time.After(time.Duration(seconds) * time.Second):
+			case <-r.Context().Done():
+			}
+			pprof.StopCPUProfile()
+			if r.Context().Err() != nil {
+				return
+			}
+			files["cpu.pprof"] = buf.Bytes()
+			names = append(names, "cpu.pprof")
+		}
+
+		for _, profile := range snapshotProfiles {
+			var buf bytes.Buffer
+			if err := pprof.Lookup(profile).WriteTo(&buf, 0); err != nil {
+				http.Error(w, fmt.Sprintf("failed to write %s profile", profile), http.StatusInternalServerError)
+				return
+			}
+			name := profile + ".pprof"
+			files[name] = buf.Bytes()
+			names = append(names, name)
+		}
+
+		now := time.Now().UTC()
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="profiles-%s.tar.gz"`, now.Format("20060102T150405Z")))
+
+		if err := writeTarGz(w, names, files, now); err != nil {
+			slog.Default().ErrorContext(r.Context(), "failed to send profile bundle", slog.String("error", err.Error()))
+		}
+	})
+}
+
+// writeTarGz writes the named files, in order, to w as a gzipped tar archive.
+func writeTarGz(w http.ResponseWriter, names []string, files map[string][]byte, modTime time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		data := files[name]
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0o644,
+			Size:    int64(len(data)),
+			ModTime: modTime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
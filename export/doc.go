@@ -0,0 +1,30 @@
+// Package export streams large result sets as NDJSON or CSV with
+// checkpoints that let clients resume an interrupted download.
+//
+// A Source yields rows in a stable order, each with an opaque checkpoint,
+// starting after the checkpoint the client passes in the "after" query
+// parameter:
+//
+//	orders := func(ctx context.Context, after string) iter.Seq2[export.Row[Order], error] {
+//	    return func(yield func(export.Row[Order], error) bool) {
+//	        rows, err := db.QueryContext(ctx, "SELECT ... WHERE id > $1 ORDER BY id", afterID(after))
+//	        ...
+//	        for rows.Next() {
+//	            ...
+//	            if !yield(export.Row[Order]{Checkpoint: strconv.Itoa(o.ID), Value: o}, nil) {
+//	                return
+//	            }
+//	        }
+//	    }
+//	}
+//	mux.Handle("GET /exports/orders.ndjson", export.NDJSON(orders, export.Options{}))
+//	mux.Handle("GET /exports/orders.csv", export.CSV(orders, []string{"id", "total"}, Order.Fields, export.Options{}))
+//
+// Rows are flushed to the client in chunks, and the export stops when the
+// client goes away. Every NDJSON line and CSV record carries its row's
+// checkpoint, so a client whose download breaks off requests
+// ?after=<last checkpoint received> and appends the rest. A Source error
+// before the first row is answered with a problem response (400 for
+// ErrInvalidCheckpoint); once streaming has begun the connection is aborted
+// so the client can tell the download is incomplete.
+package export
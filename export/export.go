@@ -0,0 +1,165 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"iter"
+	"log/slog"
+	"net/http"
+
+	"github.com/harrydayexe/GoWebUtilities/respond"
+)
+
+// Row is one exported value with the checkpoint a client passes back to
+// resume the export after it.
+type Row[T any] struct {
+	// Checkpoint identifies the position just after this row, such as its
+	// primary key or an encoded sort key. It is opaque to clients.
+	Checkpoint string
+	Value      T
+}
+
+// Source yields the rows of an export in a stable order, starting after the
+// row whose checkpoint is after, or from the beginning if after is empty. It
+// should stop when ctx is done. A Source that does not recognise after
+// should yield ErrInvalidCheckpoint.
+type Source[T any] func(ctx context.Context, after string) iter.Seq2[Row[T], error]
+
+// ErrInvalidCheckpoint is yielded by a Source for a checkpoint it cannot
+// resume from. The export is answered with 400 Bad Request.
+var ErrInvalidCheckpoint = errors.New("export: invalid checkpoint")
+
+// Options configures an export handler. Zero values are defaults.
+type Options struct {
+	// Param is the query parameter carrying the checkpoint to resume after.
+	// Defaults to "after".
+	Param string
+	// FlushEvery is how many rows are written between flushes to the
+	// client. Defaults to 100.
+	FlushEvery int
+	// Logger receives errors yielded by the Source, other than
+	// ErrInvalidCheckpoint and cancellation. Defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// withDefaults returns opts with zero values replaced by defaults.
+func (opts Options) withDefaults() Options {
+	if opts.Param == "" {
+		opts.Param = "after"
+	}
+	if opts.FlushEvery <= 0 {
+		opts.FlushEvery = 100
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return opts
+}
+
+// NDJSON returns a handler streaming src as newline-delimited JSON
+// (application/x-ndjson), one object per row:
+//
+//	{"checkpoint":"1042","value":{...}}
+func NDJSON[T any](src Source[T], opts Options) http.Handler {
+	opts = opts.withDefaults()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := json.NewEncoder(w)
+		stream(w, r, src, opts, "application/x-ndjson", nil, func(row Row[T]) error {
+			return enc.Encode(struct {
+				Checkpoint string `json:"checkpoint"`
+				Value      T      `json:"value"`
+			}{row.Checkpoint, row.Value})
+		})
+	})
+}
+
+// CSV returns a handler streaming src as CSV (text/csv). The first column of
+// every record is the row's checkpoint, followed by the fields returned by
+// record. The header row is "checkpoint" followed by header, and is omitted
+// when resuming so that resumed output can be appended to what the client
+// already has.
+func CSV[T any](src Source[T], header []string, record func(T) []string, opts Options) http.Handler {
+	opts = opts.withDefaults()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := csv.NewWriter(w)
+		begin := func() error {
+			if r.URL.Query().Get(opts.Param) != "" {
+				return nil
+			}
+			cw.Write(append([]string{"checkpoint"}, header...))
+			cw.Flush()
+			return cw.Error()
+		}
+		stream(w, r, src, opts, "text/csv; charset=utf-8", begin, func(row Row[T]) error {
+			cw.Write(append([]string{row.Checkpoint}, record(row.Value)...))
+			cw.Flush() // into the ResponseWriter's buffer, not to the client
+			return cw.Error()
+		})
+	})
+}
+
+// stream writes the rows of src with write, flushing to the client every
+// opts.FlushEvery rows. The response starts with the first row, or at the
+// end of an empty export, and begin, if not nil, is called once it has.
+//
+// An error before the response has started is answered with a problem
+// response. After that the status has been sent, so the connection is
+// aborted instead; the client sees an incomplete response and resumes from
+// its last checkpoint.
+func stream[T any](w http.ResponseWriter, r *http.Request, src Source[T], opts Options, contentType string, begin func() error, write func(Row[T]) error) {
+	ctx := r.Context()
+	rc := http.NewResponseController(w)
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+		if begin != nil {
+			return begin()
+		}
+		return nil
+	}
+
+	n := 0
+	for row, err := range src(ctx, r.URL.Query().Get(opts.Param)) {
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			if !started {
+				status := http.StatusInternalServerError
+				if errors.Is(err, ErrInvalidCheckpoint) {
+					status = http.StatusBadRequest
+				} else if ctx.Err() == nil {
+					opts.Logger.ErrorContext(ctx, "export failed", slog.String("error", err.Error()))
+				}
+				respond.Error(w, status, err)
+				return
+			}
+			if ctx.Err() == nil {
+				opts.Logger.ErrorContext(ctx, "export aborted",
+					slog.Int("rows", n),
+					slog.String("error", err.Error()),
+				)
+			}
+			panic(http.ErrAbortHandler)
+		}
+		if !started {
+			if err := start(); err != nil {
+				return
+			}
+		}
+		if err := write(row); err != nil {
+			return // the client has gone away
+		}
+		if n++; n%opts.FlushEvery == 0 {
+			rc.Flush()
+		}
+	}
+	if !started {
+		start()
+	}
+}
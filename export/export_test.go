@@ -0,0 +1,113 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// numbers is a Source of the integers 1 to n, checkpointed by value, that
+// fails after failAfter rows if failAfter is positive.
+func numbers(n, failAfter int) Source[int] {
+	return func(ctx context.Context, after string) iter.Seq2[Row[int], error] {
+		return func(yield func(Row[int], error) bool) {
+			start := 0
+			if after != "" {
+				var err error
+				if start, err = strconv.Atoi(after); err != nil {
+					yield(Row[int]{}, ErrInvalidCheckpoint)
+					return
+				}
+			}
+			for i := start + 1; i <= n; i++ {
+				if failAfter > 0 && i > failAfter {
+					yield(Row[int]{}, errors.New("database went away"))
+					return
+				}
+				if !yield(Row[int]{Checkpoint: strconv.Itoa(i), Value: i * 10}, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func get(t *testing.T, h http.Handler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestNDJSON(t *testing.T) {
+	h := NDJSON(numbers(3, 0), Options{FlushEvery: 2})
+
+	w := get(t, h, "/export")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("got %d %q, want 200 application/x-ndjson", w.Code, w.Header().Get("Content-Type"))
+	}
+	want := `{"checkpoint":"1","value":10}
+{"checkpoint":"2","value":20}
+{"checkpoint":"3","value":30}
+`
+	if w.Body.String() != want {
+		t.Errorf("body = %q, want %q", w.Body.String(), want)
+	}
+	if !w.Flushed {
+		t.Error("rows were not flushed")
+	}
+
+	if w := get(t, h, "/export?after=2"); w.Body.String() != `{"checkpoint":"3","value":30}`+"\n" {
+		t.Errorf("resumed body = %q, want only row 3", w.Body.String())
+	}
+	if w := get(t, h, "/export?after=x"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid checkpoint status = %d, want 400", w.Code)
+	}
+	if w := get(t, h, "/export?after=3"); w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("finished export = %d %q, want empty 200", w.Code, w.Body.String())
+	}
+}
+
+func TestCSV(t *testing.T) {
+	h := CSV(numbers(2, 0), []string{"value"}, func(v int) []string { return []string{strconv.Itoa(v)} }, Options{})
+
+	w := get(t, h, "/export")
+	if want := "checkpoint,value\n1,10\n2,20\n"; w.Body.String() != want {
+		t.Errorf("body = %q, want %q", w.Body.String(), want)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if w := get(t, h, "/export?after=1"); w.Body.String() != "2,20\n" {
+		t.Errorf("resumed body = %q, want only row 2 without a header", w.Body.String())
+	}
+
+	empty := CSV(numbers(0, 0), []string{"value"}, func(v int) []string { return nil }, Options{})
+	if w := get(t, empty, "/export"); w.Body.String() != "checkpoint,value\n" {
+		t.Errorf("empty export body = %q, want the header row", w.Body.String())
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	opts := Options{Logger: slog.New(slog.DiscardHandler)}
+
+	failFirst := NDJSON(func(ctx context.Context, after string) iter.Seq2[Row[int], error] {
+		return func(yield func(Row[int], error) bool) { yield(Row[int]{}, io.ErrUnexpectedEOF) }
+	}, opts)
+	if w := get(t, failFirst, "/export"); w.Code != http.StatusInternalServerError {
+		t.Errorf("error before first row status = %d, want 500", w.Code)
+	}
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("error mid-stream recovered %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	get(t, NDJSON(numbers(3, 1), opts), "/export")
+}
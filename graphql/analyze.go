@@ -0,0 +1,419 @@
+package graphql
+
+import (
+	"errors"
+	"fmt"
+)
+
+// tokenKind classifies the lexical tokens of a GraphQL document that matter
+// for analysis. Values such as strings and numbers are kept as opaque tokens.
+type tokenKind int
+
+const (
+	tokName tokenKind = iota
+	tokPunct
+	tokValue
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// tokenize splits a GraphQL document into tokens, dropping whitespace, commas
+// and comments. String and block string literals are returned as single value tokens.
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+		case c == '"':
+			start := i
+			if len(src) >= i+3 && src[i:i+3] == `"""` {
+				i += 3
+				for {
+					if i >= len(src) {
+						return nil, errors.New("unterminated block string")
+					}
+					if src[i] == '\\' && len(src) >= i+4 && src[i+1:i+4] == `"""` {
+						i += 4
+						continue
+					}
+					if len(src) >= i+3 && src[i:i+3] == `"""` {
+						i += 3
+						break
+					}
+					i++
+				}
+			} else {
+				i++
+				for {
+					if i >= len(src) || src[i] == '\n' {
+						return nil, errors.New("unterminated string")
+					}
+					if src[i] == '\\' {
+						i += 2
+						continue
+					}
+					if src[i] == '"' {
+						i++
+						break
+					}
+					i++
+				}
+			}
+			tokens = append(tokens, token{tokValue, src[start:i]})
+		case c == '.':
+			if len(src) < i+3 || src[i:i+3] != "..." {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			tokens = append(tokens, token{tokPunct, "..."})
+			i += 3
+		case isNameStart(c):
+			start := i
+			for i < len(src) && isNameContinue(src[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tokName, src[start:i]})
+		case c == '-' || (c >= '0' && c <= '9'):
+			start := i
+			i++
+			for i < len(src) && (isNameContinue(src[i]) || src[i] == '.' || src[i] == '+' || src[i] == '-') {
+				i++
+			}
+			tokens = append(tokens, token{tokValue, src[start:i]})
+		case c == '{' || c == '}' || c == '(' || c == ')' || c == '[' || c == ']' ||
+			c == ':' || c == '@' || c == '$' || c == '!' || c == '=' || c == '|' || c == '&':
+			tokens = append(tokens, token{tokPunct, string(c)})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameContinue(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// Operation describes one operation definition found in a GraphQL document.
+type Operation struct {
+	// Type is "query", "mutation" or "subscription".
+	Type string
+	// Name is the operation name, or empty for anonymous operations.
+	Name string
+	// Depth is the maximum nesting depth of field selections, with
+	// fragment spreads expanded. A query of "{ a { b } }" has depth 2.
+	Depth int
+	// Complexity is the total number of field selections, with fragment
+	// spreads expanded.
+	Complexity int
+}
+
+// Analysis is the result of analysing a GraphQL document with Analyze.
+type Analysis struct {
+	Operations []Operation
+}
+
+// Operation returns the operation selected by name, following the GraphQL
+// rules: an empty name selects the only operation in the document. It returns
+// false if no single operation matches.
+func (a Analysis) Operation(name string) (Operation, bool) {
+	if name == "" {
+		if len(a.Operations) == 1 {
+			return a.Operations[0], true
+		}
+		return Operation{}, false
+	}
+	for _, op := range a.Operations {
+		if op.Name == name {
+			return op, true
+		}
+	}
+	return Operation{}, false
+}
+
+// Analyze lexically analyses a GraphQL document, reporting the type, depth
+// and complexity of each operation. It does not validate the document against
+// a schema; it only understands enough of the grammar to measure selection
+// sets, which makes it cheap enough to run before every execution.
+//
+// Analyze returns an error for documents that are not syntactically valid
+// enough to be measured, including fragments that spread themselves.
+func Analyze(query string) (Analysis, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return Analysis{}, err
+	}
+
+	a := &analyzer{
+		tokens:    tokens,
+		fragments: make(map[string]int),
+		stats:     make(map[string]selectionStats),
+		visiting:  make(map[string]bool),
+	}
+	type opStart struct {
+		op  Operation
+		pos int
+	}
+	var ops []opStart
+
+	// First pass: locate fragment and operation selection sets.
+	for a.pos < len(a.tokens) {
+		t := a.next()
+		switch {
+		case t.kind == tokPunct && t.text == "{":
+			a.pos--
+			ops = append(ops, opStart{Operation{Type: "query"}, a.pos})
+			if err := a.skipBalanced("{", "}"); err != nil {
+				return Analysis{}, err
+			}
+		case t.kind == tokName && t.text == "fragment":
+			name := a.next()
+			if name.kind != tokName {
+				return Analysis{}, errors.New("expected fragment name")
+			}
+			if err := a.skipToSelectionSet(); err != nil {
+				return Analysis{}, err
+			}
+			a.fragments[name.text] = a.pos
+			if err := a.skipBalanced("{", "}"); err != nil {
+				return Analysis{}, err
+			}
+		case t.kind == tokName && (t.text == "query" || t.text == "mutation" || t.text == "subscription"):
+			op := Operation{Type: t.text}
+			if a.peek().kind == tokName {
+				op.Name = a.next().text
+			}
+			if err := a.skipToSelectionSet(); err != nil {
+				return Analysis{}, err
+			}
+			ops = append(ops, opStart{op, a.pos})
+			if err := a.skipBalanced("{", "}"); err != nil {
+				return Analysis{}, err
+			}
+		default:
+			return Analysis{}, fmt.Errorf("unexpected token %q", t.text)
+		}
+	}
+
+	if len(ops) == 0 {
+		return Analysis{}, errors.New("document contains no operations")
+	}
+
+	// Second pass: measure each operation with fragments expanded.
+	result := Analysis{}
+	for _, o := range ops {
+		a.pos = o.pos
+		s, err := a.selectionSet()
+		if err != nil {
+			return Analysis{}, err
+		}
+		o.op.Depth = s.depth
+		o.op.Complexity = s.fields
+		result.Operations = append(result.Operations, o.op)
+	}
+	return result, nil
+}
+
+type selectionStats struct {
+	depth  int
+	fields int
+}
+
+type analyzer struct {
+	tokens    []token
+	pos       int
+	fragments map[string]int
+	stats     map[string]selectionStats
+	visiting  map[string]bool
+}
+
+var eof = token{kind: tokPunct}
+
+func (a *analyzer) peek() token {
+	if a.pos >= len(a.tokens) {
+		return eof
+	}
+	return a.tokens[a.pos]
+}
+
+func (a *analyzer) next() token {
+	t := a.peek()
+	a.pos++
+	return t
+}
+
+func (a *analyzer) isPunct(text string) bool {
+	t := a.peek()
+	return t.kind == tokPunct && t.text == text
+}
+
+// skipBalanced consumes tokens from an opening delimiter to its matching closer.
+func (a *analyzer) skipBalanced(open, close string) error {
+	depth := 0
+	for a.pos < len(a.tokens) {
+		t := a.next()
+		if t.kind != tokPunct {
+			continue
+		}
+		switch t.text {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("unbalanced %q", open)
+}
+
+// skipToSelectionSet advances to the next top-level "{", skipping variable
+// definitions, type conditions and directive arguments.
+func (a *analyzer) skipToSelectionSet() error {
+	for a.pos < len(a.tokens) {
+		switch {
+		case a.isPunct("{"):
+			return nil
+		case a.isPunct("("):
+			if err := a.skipBalanced("(", ")"); err != nil {
+				return err
+			}
+		default:
+			a.pos++
+		}
+	}
+	return errors.New("expected selection set")
+}
+
+// skipDirectives consumes any directives, including their arguments.
+func (a *analyzer) skipDirectives() error {
+	for a.isPunct("@") {
+		a.pos++
+		if a.next().kind != tokName {
+			return errors.New("expected directive name")
+		}
+		if a.isPunct("(") {
+			if err := a.skipBalanced("(", ")"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// selectionSet measures the selection set starting at the current position.
+func (a *analyzer) selectionSet() (selectionStats, error) {
+	if !a.isPunct("{") {
+		return selectionStats{}, errors.New("expected selection set")
+	}
+	a.pos++
+
+	var s selectionStats
+	for !a.isPunct("}") {
+		if a.pos >= len(a.tokens) {
+			return selectionStats{}, errors.New("unterminated selection set")
+		}
+
+		if a.isPunct("...") {
+			a.pos++
+			var child selectionStats
+			t := a.peek()
+			if t.kind == tokName && t.text != "on" {
+				// Fragment spread.
+				a.pos++
+				var err error
+				if child, err = a.fragment(t.text); err != nil {
+					return selectionStats{}, err
+				}
+				if err := a.skipDirectives(); err != nil {
+					return selectionStats{}, err
+				}
+			} else {
+				// Inline fragment, optionally with a type condition.
+				if t.kind == tokName {
+					a.pos += 2
+				}
+				if err := a.skipDirectives(); err != nil {
+					return selectionStats{}, err
+				}
+				var err error
+				if child, err = a.selectionSet(); err != nil {
+					return selectionStats{}, err
+				}
+			}
+			s.depth = max(s.depth, child.depth)
+			s.fields += child.fields
+			continue
+		}
+
+		if a.next().kind != tokName {
+			return selectionStats{}, errors.New("expected field name")
+		}
+		if a.isPunct(":") {
+			a.pos++
+			if a.next().kind != tokName {
+				return selectionStats{}, errors.New("expected field name after alias")
+			}
+		}
+		if a.isPunct("(") {
+			if err := a.skipBalanced("(", ")"); err != nil {
+				return selectionStats{}, err
+			}
+		}
+		if err := a.skipDirectives(); err != nil {
+			return selectionStats{}, err
+		}
+
+		child := selectionStats{}
+		if a.isPunct("{") {
+			var err error
+			if child, err = a.selectionSet(); err != nil {
+				return selectionStats{}, err
+			}
+		}
+		s.depth = max(s.depth, child.depth+1)
+		s.fields += child.fields + 1
+	}
+	a.pos++
+	return s, nil
+}
+
+// fragment measures the named fragment, memoising the result and rejecting cycles.
+func (a *analyzer) fragment(name string) (selectionStats, error) {
+	if s, ok := a.stats[name]; ok {
+		return s, nil
+	}
+	start, ok := a.fragments[name]
+	if !ok {
+		return selectionStats{}, fmt.Errorf("unknown fragment %q", name)
+	}
+	if a.visiting[name] {
+		return selectionStats{}, fmt.Errorf("fragment %q spreads itself", name)
+	}
+	a.visiting[name] = true
+	defer delete(a.visiting, name)
+
+	saved := a.pos
+	a.pos = start
+	s, err := a.selectionSet()
+	a.pos = saved
+	if err != nil {
+		return selectionStats{}, err
+	}
+	a.stats[name] = s
+	return s, nil
+}
@@ -0,0 +1,37 @@
+// Package graphql provides helpers for serving GraphQL over HTTP.
+//
+// The package does not implement a GraphQL schema or resolver engine. Instead
+// it provides the HTTP transport around any engine that can be adapted to the
+// Executor interface, so that services get consistent request parsing,
+// persisted queries, and query cost limits regardless of the library they use.
+//
+// NewHandler accepts GET, POST (application/json and application/graphql) and
+// multipart file upload requests as described by the GraphQL over HTTP and
+// GraphQL multipart request specifications.
+//
+// With WithPersistedQueries, clients may send the hash of a document instead
+// of its text and register new documents; MemoryPersistedQueryStore keeps a
+// bounded number of them. WithPersistedQueryAllowlist instead serves only
+// the documents the application stored, keyed by QueryHash, and rejects all
+// others.
+//
+// Executor middleware guards resolvers from expensive queries before they run:
+//
+//   - NewDepthLimit: rejects queries nested deeper than a limit.
+//   - NewComplexityLimit: rejects queries selecting too many fields.
+//
+// Both are measured by Analyze, a lightweight lexical analysis that expands
+// fragment spreads but does not need the schema.
+//
+// Example:
+//
+//	exec := graphql.Chain(myExecutor,
+//	    graphql.NewDepthLimit(10),
+//	    graphql.NewComplexityLimit(200),
+//	)
+//	h := graphql.NewHandler(exec,
+//	    graphql.WithPersistedQueries(graphql.NewMemoryPersistedQueryStore(10000)),
+//	    graphql.WithLogger(slog.Default()),
+//	)
+//	mux.Handle("/graphql", stack(h))
+package graphql
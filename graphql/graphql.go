@@ -0,0 +1,69 @@
+package graphql
+
+import "context"
+
+// Request is a GraphQL request as described by the GraphQL over HTTP specification.
+type Request struct {
+	// Query is the GraphQL document to execute. It may be empty when the
+	// request refers to a persisted query via Extensions.
+	Query string `json:"query"`
+	// OperationName selects which operation in Query to execute when the
+	// document contains more than one.
+	OperationName string `json:"operationName,omitempty"`
+	// Variables holds the values for the operation's variables.
+	Variables map[string]any `json:"variables,omitempty"`
+	// Extensions holds protocol extensions such as persisted query hashes.
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// Response is the result of executing a GraphQL request.
+type Response struct {
+	Data       any            `json:"data,omitempty"`
+	Errors     []Error        `json:"errors,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// Error is a GraphQL error as returned in the "errors" list of a Response.
+type Error struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// ErrorResponse returns a Response containing a single error with the given
+// message. If code is non-empty it is added as the "code" extension.
+func ErrorResponse(message, code string) Response {
+	e := Error{Message: message}
+	if code != "" {
+		e.Extensions = map[string]any{"code": code}
+	}
+	return Response{Errors: []Error{e}}
+}
+
+// Executor executes GraphQL requests. Implementations typically adapt a
+// schema library such as graphql-go or gqlgen to this interface.
+type Executor interface {
+	Execute(ctx context.Context, req Request) Response
+}
+
+// ExecutorFunc is an adapter to allow the use of ordinary functions as Executors.
+type ExecutorFunc func(ctx context.Context, req Request) Response
+
+// Execute calls f(ctx, req).
+func (f ExecutorFunc) Execute(ctx context.Context, req Request) Response {
+	return f(ctx, req)
+}
+
+// Middleware wraps an Executor, providing functionality before and after
+// execution of the wrapped Executor. It mirrors middleware.Middleware at the
+// GraphQL execution layer.
+type Middleware func(next Executor) Executor
+
+// Chain wraps exec with the provided middleware. Middleware are applied in
+// the order provided: the first middleware is the outermost wrapper.
+func Chain(exec Executor, xs ...Middleware) Executor {
+	for i := len(xs) - 1; i >= 0; i-- {
+		exec = xs[i](exec)
+	}
+	return exec
+}
@@ -0,0 +1,55 @@
+package graphql_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/harrydayexe/GoWebUtilities/graphql"
+)
+
+// ExampleNewHandler demonstrates serving a GraphQL executor over HTTP with a
+// depth limit applied.
+func ExampleNewHandler() {
+	// A real service would adapt its schema library to the Executor interface.
+	exec := graphql.ExecutorFunc(func(ctx context.Context, req graphql.Request) graphql.Response {
+		return graphql.Response{Data: map[string]string{"hello": "world"}}
+	})
+
+	h := graphql.NewHandler(graphql.Chain(exec, graphql.NewDepthLimit(2)))
+
+	for _, query := range []string{`{ hello }`, `{ a { b { c } } }`} {
+		body := strings.NewReader(fmt.Sprintf(`{"query":%q}`, query))
+		req := httptest.NewRequest("POST", "/graphql", body)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		h.ServeHTTP(w, req)
+		fmt.Print(w.Body.String())
+	}
+
+	// Output:
+	// {"data":{"hello":"world"}}
+	// {"errors":[{"message":"query depth 3 exceeds maximum of 2","extensions":{"code":"DEPTH_LIMIT_EXCEEDED"}}]}
+}
+
+// ExampleAnalyze demonstrates measuring a query before execution.
+func ExampleAnalyze() {
+	analysis, err := graphql.Analyze(`
+		query GetUser {
+			user(id: 1) { name friends { ...F } }
+		}
+		fragment F on User { name }
+	`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	op, _ := analysis.Operation("GetUser")
+	fmt.Printf("%s %s: depth %d, complexity %d\n", op.Type, op.Name, op.Depth, op.Complexity)
+
+	// Output:
+	// query GetUser: depth 3, complexity 4
+}
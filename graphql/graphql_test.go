@@ -0,0 +1,355 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// echoExecutor returns an executor that records the request it receives and
+// responds with the operation name as data.
+func echoExecutor(got *Request) Executor {
+	return ExecutorFunc(func(ctx context.Context, req Request) Response {
+		*got = req
+		return Response{Data: map[string]any{"operation": req.OperationName}}
+	})
+}
+
+// decodeResponse decodes a GraphQL response body.
+func decodeResponse(t *testing.T, body io.Reader) Response {
+	t.Helper()
+	var resp Response
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		wantType       string
+		wantName       string
+		wantDepth      int
+		wantComplexity int
+	}{
+		{"shorthand", `{ a }`, "query", "", 1, 1},
+		{"nested", `query Q { a { b { c } d } }`, "query", "Q", 3, 4},
+		{"alias_and_args", `{ x: user(id: "1", filter: {name: "}"}) { name } }`, "query", "", 2, 2},
+		{"mutation_with_vars", `mutation M($in: Input = {a: 1}) { create(input: $in) { id } }`, "mutation", "M", 2, 2},
+		{"fragment_expanded", `query { a { ...F } } fragment F on T { b { c } }`, "query", "", 3, 3},
+		{"inline_fragment", `{ a { ... on T { b } ... @include(if: true) { c } } }`, "query", "", 2, 3},
+		{"comments_and_strings", "{ a # { b }\n b(s: \"\"\"{{\"\"\") }", "query", "", 1, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := Analyze(tt.query)
+			if err != nil {
+				t.Fatalf("Analyze() error = %v", err)
+			}
+			op, ok := a.Operation("")
+			if !ok {
+				t.Fatal("expected a single operation")
+			}
+			if op.Type != tt.wantType || op.Name != tt.wantName {
+				t.Errorf("operation: got %s %q, want %s %q", op.Type, op.Name, tt.wantType, tt.wantName)
+			}
+			if op.Depth != tt.wantDepth {
+				t.Errorf("depth: got %d, want %d", op.Depth, tt.wantDepth)
+			}
+			if op.Complexity != tt.wantComplexity {
+				t.Errorf("complexity: got %d, want %d", op.Complexity, tt.wantComplexity)
+			}
+		})
+	}
+}
+
+func TestAnalyze_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"empty", ""},
+		{"unbalanced", "{ a { b }"},
+		{"unknown_fragment", "{ ...Missing }"},
+		{"fragment_cycle", "{ ...A } fragment A on T { ...B } fragment B on T { ...A }"},
+		{"unterminated_string", `{ a(s: "oops) }`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Analyze(tt.query); err == nil {
+				t.Errorf("Analyze(%q) expected error, got nil", tt.query)
+			}
+		})
+	}
+}
+
+func TestHandler_RequestFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		request func() *http.Request
+	}{
+		{"get", func() *http.Request {
+			q := url.Values{"query": {"query Q { a }"}, "operationName": {"Q"}, "variables": {`{"x":1}`}}
+			return httptest.NewRequest("GET", "/graphql?"+q.Encode(), nil)
+		}},
+		{"post_json", func() *http.Request {
+			req := httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query":"query Q { a }","operationName":"Q","variables":{"x":1}}`))
+			req.Header.Set("Content-Type", "application/json")
+			return req
+		}},
+		{"post_graphql", func() *http.Request {
+			req := httptest.NewRequest("POST", "/graphql?operationName=Q", strings.NewReader("query Q { a }"))
+			req.Header.Set("Content-Type", "application/graphql")
+			return req
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Request
+			h := NewHandler(echoExecutor(&got))
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, tt.request())
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want 200 (body %s)", w.Code, w.Body.String())
+			}
+			if got.Query != "query Q { a }" || got.OperationName != "Q" {
+				t.Errorf("executor received %+v", got)
+			}
+		})
+	}
+}
+
+func TestHandler_RejectsMutationOverGET(t *testing.T) {
+	var got Request
+	h := NewHandler(echoExecutor(&got))
+	q := url.Values{"query": {"mutation { a }"}}
+	req := httptest.NewRequest("GET", "/graphql?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status: got %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if got.Query != "" {
+		t.Error("executor should not have been called")
+	}
+}
+
+func TestHandler_BadRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{"invalid_json", "POST", "application/json", "{", http.StatusBadRequest},
+		{"missing_query", "POST", "application/json", "{}", http.StatusBadRequest},
+		{"syntax_error", "POST", "application/json", `{"query":"{ a "}`, http.StatusBadRequest},
+		{"unsupported_type", "POST", "text/plain", "{ a }", http.StatusUnsupportedMediaType},
+		{"bad_method", "PUT", "application/json", `{"query":"{ a }"}`, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Request
+			h := NewHandler(echoExecutor(&got))
+			req := httptest.NewRequest(tt.method, "/graphql", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status: got %d, want %d", w.Code, tt.wantStatus)
+			}
+			if resp := decodeResponse(t, w.Body); len(resp.Errors) == 0 {
+				t.Error("expected errors in response body")
+			}
+		})
+	}
+}
+
+func TestHandler_PersistedQueries(t *testing.T) {
+	query := "{ a }"
+	sum := sha256.Sum256([]byte(query))
+	hash := hex.EncodeToString(sum[:])
+	ext := `"extensions":{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}`
+
+	var got Request
+	h := NewHandler(echoExecutor(&got), WithPersistedQueries(NewMemoryPersistedQueryStore(100)))
+
+	post := func(body string) Response {
+		req := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return decodeResponse(t, w.Body)
+	}
+
+	// Hash only, not yet registered.
+	resp := post(`{` + ext + `}`)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != "PERSISTED_QUERY_NOT_FOUND" {
+		t.Fatalf("expected PERSISTED_QUERY_NOT_FOUND, got %+v", resp)
+	}
+
+	// Register with the full query.
+	resp = post(`{"query":"` + query + `",` + ext + `}`)
+	if len(resp.Errors) != 0 {
+		t.Fatalf("registration failed: %+v", resp)
+	}
+
+	// Hash only, now resolved from the store.
+	got = Request{}
+	resp = post(`{` + ext + `}`)
+	if len(resp.Errors) != 0 || got.Query != query {
+		t.Errorf("expected persisted query to execute, got %+v (query %q)", resp, got.Query)
+	}
+
+	// Mismatched hash is rejected.
+	resp = post(`{"query":"{ b }",` + ext + `}`)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != "PERSISTED_QUERY_HASH_MISMATCH" {
+		t.Errorf("expected PERSISTED_QUERY_HASH_MISMATCH, got %+v", resp)
+	}
+}
+
+func TestHandler_PersistedQueryAllowlist(t *testing.T) {
+	store := NewMemoryPersistedQueryStore(10)
+	store.Put(context.Background(), QueryHash("{ a }"), "{ a }")
+
+	var got Request
+	h := NewHandler(echoExecutor(&got), WithPersistedQueryAllowlist(store))
+	post := func(body string) Response {
+		req := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return decodeResponse(t, w.Body)
+	}
+	ext := func(query string) string {
+		return `"extensions":{"persistedQuery":{"version":1,"sha256Hash":"` + QueryHash(query) + `"}}`
+	}
+
+	for _, body := range []string{`{` + ext("{ a }") + `}`, `{"query":"{ a }"}`} {
+		got = Request{}
+		if resp := post(body); len(resp.Errors) != 0 || got.Query != "{ a }" {
+			t.Errorf("%s: expected allowlisted query to execute, got %+v (query %q)", body, resp, got.Query)
+		}
+	}
+	for _, body := range []string{`{"query":"{ b }"}`, `{"query":"{ b }",` + ext("{ b }") + `}`, `{` + ext("{ b }") + `}`} {
+		resp := post(body)
+		if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != "PERSISTED_QUERY_NOT_IN_LIST" {
+			t.Errorf("%s: expected PERSISTED_QUERY_NOT_IN_LIST, got %+v", body, resp)
+		}
+	}
+	if _, ok := store.Get(context.Background(), QueryHash("{ b }")); ok {
+		t.Error("allowlist mode registered a query")
+	}
+}
+
+func TestMemoryPersistedQueryStore_Eviction(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryPersistedQueryStore(2)
+	store.Put(ctx, "h1", "{ a }")
+	store.Put(ctx, "h2", "{ b }")
+	store.Get(ctx, "h1")
+	store.Put(ctx, "h3", "{ c }")
+	if _, ok := store.Get(ctx, "h2"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	for _, hash := range []string{"h1", "h3"} {
+		if _, ok := store.Get(ctx, hash); !ok {
+			t.Errorf("%s was evicted", hash)
+		}
+	}
+}
+
+func TestHandler_MultipartUpload(t *testing.T) {
+	var got Request
+	var content []byte
+	exec := ExecutorFunc(func(ctx context.Context, req Request) Response {
+		got = req
+		if up, ok := req.Variables["file"].(*Upload); ok {
+			content, _ = io.ReadAll(up.File)
+		}
+		return Response{Data: true}
+	})
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField("operations", `{"query":"mutation($file: Upload!) { upload(file: $file) }","variables":{"file":null}}`)
+	mw.WriteField("map", `{"0":["variables.file"]}`)
+	fw, _ := mw.CreateFormFile("0", "hello.txt")
+	fw.Write([]byte("hello world"))
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/graphql", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	NewHandler(exec).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (body %s)", w.Code, w.Body.String())
+	}
+	up, ok := got.Variables["file"].(*Upload)
+	if !ok {
+		t.Fatalf("expected *Upload variable, got %T", got.Variables["file"])
+	}
+	if up.Filename != "hello.txt" || string(content) != "hello world" {
+		t.Errorf("upload: got %q with content %q", up.Filename, content)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	var got Request
+	exec := Chain(echoExecutor(&got), NewDepthLimit(2), NewComplexityLimit(3))
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode string
+	}{
+		{"within_limits", "{ a { b } }", ""},
+		{"too_deep", "{ a { b { c } } }", "DEPTH_LIMIT_EXCEEDED"},
+		{"too_complex", "{ a b c d }", "COMPLEXITY_LIMIT_EXCEEDED"},
+		{"deep_via_fragment", "{ a { ...F } } fragment F on T { b { c } }", "DEPTH_LIMIT_EXCEEDED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = Request{}
+			resp := exec.Execute(context.Background(), Request{Query: tt.query})
+
+			if tt.wantCode == "" {
+				if len(resp.Errors) != 0 || got.Query != tt.query {
+					t.Errorf("expected execution, got %+v", resp)
+				}
+				return
+			}
+			if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != tt.wantCode {
+				t.Errorf("expected %s, got %+v", tt.wantCode, resp)
+			}
+			if got.Query != "" {
+				t.Error("executor should not have been called")
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// defaultMaxBodySize is the request body limit applied when no
+// WithMaxBodySize option is given.
+const defaultMaxBodySize = 1048576 // 1MB
+
+// Option configures a handler created by NewHandler.
+type Option func(*handler)
+
+// WithPersistedQueries enables automatic persisted queries backed by store.
+// Clients may send the SHA-256 hash of a document in the "persistedQuery"
+// extension instead of the document itself; unknown hashes are answered with
+// a PERSISTED_QUERY_NOT_FOUND error so the client can retry with the full text.
+// Any client can register documents this way, so store should be bounded,
+// as MemoryPersistedQueryStore is; see WithPersistedQueryAllowlist to serve
+// a fixed set of documents instead.
+func WithPersistedQueries(store PersistedQueryStore) Option {
+	return func(h *handler) {
+		h.persisted = store
+		h.allowlist = false
+	}
+}
+
+// WithPersistedQueryAllowlist serves only the documents in store, as a
+// safelist: requests may refer to them by hash, as with WithPersistedQueries,
+// or send their full text, but other documents are rejected with a
+// PERSISTED_QUERY_NOT_IN_LIST error and clients cannot register new ones.
+// The store is filled by the application, keyed by QueryHash.
+func WithPersistedQueryAllowlist(store PersistedQueryStore) Option {
+	return func(h *handler) {
+		h.persisted = store
+		h.allowlist = true
+	}
+}
+
+// WithMaxBodySize limits the size of request bodies, including multipart
+// uploads. Defaults to 1MB.
+func WithMaxBodySize(maxBytes int64) Option {
+	return func(h *handler) {
+		h.maxBodySize = maxBytes
+	}
+}
+
+// WithLogger logs each executed operation at INFO level, using the
+// operation name as the label so that requests to the single GraphQL
+// endpoint can be told apart in logs.
+func WithLogger(logger *slog.Logger) Option {
+	return func(h *handler) {
+		h.logger = logger
+	}
+}
+
+type handler struct {
+	exec        Executor
+	persisted   PersistedQueryStore
+	allowlist   bool
+	maxBodySize int64
+	logger      *slog.Logger
+}
+
+// NewHandler returns an http.Handler that serves GraphQL requests using exec,
+// following the GraphQL over HTTP specification:
+//   - GET requests carry the query, operationName, variables and extensions
+//     as URL query parameters; mutations are rejected with 405.
+//   - POST requests with Content-Type application/json carry a JSON Request.
+//   - POST requests with Content-Type application/graphql carry the bare document.
+//   - POST requests with Content-Type multipart/form-data follow the GraphQL
+//     multipart request specification for file uploads (see Upload).
+//
+// Malformed requests receive 400 with a GraphQL error body. Executed requests
+// always receive 200 with the Response encoded as JSON, including when the
+// Response contains errors.
+//
+// The handler composes with the middleware package like any other handler,
+// and with Executor middleware such as NewDepthLimit via Chain.
+func NewHandler(exec Executor, opts ...Option) http.Handler {
+	h := &handler{
+		exec:        exec,
+		maxBodySize: defaultMaxBodySize,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	req, status, err := h.parseRequest(w, r)
+	if err != nil {
+		writeResponse(w, status, ErrorResponse(err.Error(), "BAD_REQUEST"))
+		return
+	}
+
+	if h.persisted != nil {
+		if resp := resolvePersistedQuery(r.Context(), h.persisted, h.allowlist, &req); resp != nil {
+			writeResponse(w, http.StatusOK, *resp)
+			return
+		}
+	}
+	if req.Query == "" {
+		writeResponse(w, http.StatusBadRequest, ErrorResponse("missing query", "BAD_REQUEST"))
+		return
+	}
+
+	analysis, err := Analyze(req.Query)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, ErrorResponse(fmt.Sprintf("invalid query: %s", err), "GRAPHQL_PARSE_FAILED"))
+		return
+	}
+	op, ok := analysis.Operation(req.OperationName)
+	if !ok {
+		writeResponse(w, http.StatusBadRequest, ErrorResponse("unable to determine operation to execute", "BAD_REQUEST"))
+		return
+	}
+	if r.Method == http.MethodGet && op.Type != "query" {
+		w.Header().Set("Allow", http.MethodPost)
+		writeResponse(w, http.StatusMethodNotAllowed, ErrorResponse(fmt.Sprintf("%s operations must use POST", op.Type), "BAD_REQUEST"))
+		return
+	}
+
+	resp := h.exec.Execute(r.Context(), req)
+	writeResponse(w, http.StatusOK, resp)
+
+	if h.logger != nil {
+		name := op.Name
+		if name == "" {
+			name = "anonymous"
+		}
+		h.logger.InfoContext(r.Context(), "graphql operation complete",
+			slog.String("operation", name),
+			slog.String("type", op.Type),
+			slog.Int("errors", len(resp.Errors)),
+			slog.Duration("duration", time.Since(start)),
+		)
+	}
+}
+
+// parseRequest decodes the GraphQL request from r according to its method
+// and Content-Type. On failure it returns the HTTP status to respond with.
+func (h *handler) parseRequest(w http.ResponseWriter, r *http.Request) (Request, int, error) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req := Request{
+			Query:         q.Get("query"),
+			OperationName: q.Get("operationName"),
+		}
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return Request{}, http.StatusBadRequest, fmt.Errorf("invalid variables: %w", err)
+			}
+		}
+		if v := q.Get("extensions"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Extensions); err != nil {
+				return Request{}, http.StatusBadRequest, fmt.Errorf("invalid extensions: %w", err)
+			}
+		}
+		return req, 0, nil
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		return Request{}, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method)
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return Request{}, http.StatusUnsupportedMediaType, fmt.Errorf("invalid Content-Type: %w", err)
+	}
+
+	switch mediaType {
+	case "application/json":
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return Request{}, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %w", err)
+		}
+		return req, 0, nil
+	case "application/graphql":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return Request{}, http.StatusBadRequest, fmt.Errorf("failed to read body: %w", err)
+		}
+		return Request{Query: string(body), OperationName: r.URL.Query().Get("operationName")}, 0, nil
+	case "multipart/form-data":
+		req, err := parseMultipart(r, h.maxBodySize)
+		if err != nil {
+			return Request{}, http.StatusBadRequest, err
+		}
+		return req, 0, nil
+	default:
+		return Request{}, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported Content-Type %q", mediaType)
+	}
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,57 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+)
+
+// NewDepthLimit returns middleware that rejects operations whose selection
+// depth, as measured by Analyze, exceeds maxDepth. Rejected requests are not
+// passed to the wrapped Executor and receive an error with the code
+// "DEPTH_LIMIT_EXCEEDED".
+//
+// Depth limits protect resolvers from deeply nested queries that are cheap to
+// send but expensive to execute, such as cyclic relationships (friends of friends...).
+func NewDepthLimit(maxDepth int) Middleware {
+	return newLimit(func(op Operation) error {
+		if op.Depth > maxDepth {
+			return fmt.Errorf("query depth %d exceeds maximum of %d", op.Depth, maxDepth)
+		}
+		return nil
+	}, "DEPTH_LIMIT_EXCEEDED")
+}
+
+// NewComplexityLimit returns middleware that rejects operations selecting
+// more than maxComplexity fields in total, as measured by Analyze. Rejected
+// requests are not passed to the wrapped Executor and receive an error with
+// the code "COMPLEXITY_LIMIT_EXCEEDED".
+func NewComplexityLimit(maxComplexity int) Middleware {
+	return newLimit(func(op Operation) error {
+		if op.Complexity > maxComplexity {
+			return fmt.Errorf("query complexity %d exceeds maximum of %d", op.Complexity, maxComplexity)
+		}
+		return nil
+	}, "COMPLEXITY_LIMIT_EXCEEDED")
+}
+
+// newLimit builds middleware that analyses the selected operation and rejects
+// it when check returns an error.
+func newLimit(check func(Operation) error, code string) Middleware {
+	return func(next Executor) Executor {
+		return ExecutorFunc(func(ctx context.Context, req Request) Response {
+			analysis, err := Analyze(req.Query)
+			if err != nil {
+				return ErrorResponse(fmt.Sprintf("invalid query: %s", err), "GRAPHQL_PARSE_FAILED")
+			}
+			for _, op := range analysis.Operations {
+				if req.OperationName != "" && op.Name != req.OperationName {
+					continue
+				}
+				if err := check(op); err != nil {
+					return ErrorResponse(err.Error(), code)
+				}
+			}
+			return next.Execute(ctx, req)
+		})
+	}
+}
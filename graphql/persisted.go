@@ -0,0 +1,135 @@
+package graphql
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// PersistedQueryStore stores GraphQL documents keyed by the hex-encoded
+// SHA-256 hash of their text, enabling clients to send only the hash.
+//
+// Implementations must be safe for concurrent use.
+type PersistedQueryStore interface {
+	// Get returns the document stored under hash, and whether it was found.
+	Get(ctx context.Context, hash string) (string, bool)
+	// Put stores query under hash.
+	Put(ctx context.Context, hash, query string)
+}
+
+// MemoryPersistedQueryStore is an in-memory PersistedQueryStore holding a
+// bounded number of documents, evicting the least recently used, so that
+// clients registering queries cannot exhaust memory. It is safe for
+// concurrent use.
+type MemoryPersistedQueryStore struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // of *persistedQuery, most recently used first
+	queries map[string]*list.Element
+}
+
+// persistedQuery is an element of MemoryPersistedQueryStore.order.
+type persistedQuery struct {
+	hash, query string
+}
+
+// NewMemoryPersistedQueryStore returns an empty MemoryPersistedQueryStore
+// that keeps up to maxEntries documents. It panics if maxEntries is not
+// positive.
+func NewMemoryPersistedQueryStore(maxEntries int) *MemoryPersistedQueryStore {
+	if maxEntries <= 0 {
+		panic("graphql: NewMemoryPersistedQueryStore requires a positive maxEntries")
+	}
+	return &MemoryPersistedQueryStore{max: maxEntries, order: list.New(), queries: make(map[string]*list.Element)}
+}
+
+// Get implements PersistedQueryStore.
+func (s *MemoryPersistedQueryStore) Get(_ context.Context, hash string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.queries[hash]
+	if !ok {
+		return "", false
+	}
+	s.order.MoveToFront(e)
+	return e.Value.(*persistedQuery).query, true
+}
+
+// Put implements PersistedQueryStore.
+func (s *MemoryPersistedQueryStore) Put(_ context.Context, hash, query string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.queries[hash]; ok {
+		e.Value.(*persistedQuery).query = query
+		s.order.MoveToFront(e)
+		return
+	}
+	s.queries[hash] = s.order.PushFront(&persistedQuery{hash: hash, query: query})
+	if s.order.Len() > s.max {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.queries, oldest.Value.(*persistedQuery).hash)
+	}
+}
+
+// QueryHash returns the hex-encoded SHA-256 hash of query, the key under
+// which persisted queries are stored.
+func QueryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// persistedQueryHash extracts the sha256Hash from the "persistedQuery"
+// extension used by automatic persisted queries, if present.
+func persistedQueryHash(req Request) (string, bool) {
+	pq, ok := req.Extensions["persistedQuery"].(map[string]any)
+	if !ok {
+		return "", false
+	}
+	hash, ok := pq["sha256Hash"].(string)
+	return hash, ok && hash != ""
+}
+
+// resolvePersistedQuery fills in req.Query from store when the request
+// refers to a persisted query, or registers the query when both the hash and
+// the document are sent. With allowlist set, nothing is registered and only
+// documents found in store are accepted, whether sent by hash or in full.
+// It returns a non-nil Response when the request must be answered without
+// execution.
+func resolvePersistedQuery(ctx context.Context, store PersistedQueryStore, allowlist bool, req *Request) *Response {
+	hash, ok := persistedQueryHash(*req)
+	if allowlist {
+		if !ok {
+			hash = QueryHash(req.Query)
+		}
+		query, found := store.Get(ctx, hash)
+		if !found || (req.Query != "" && req.Query != query) {
+			resp := ErrorResponse("query is not in the persisted query allowlist", "PERSISTED_QUERY_NOT_IN_LIST")
+			return &resp
+		}
+		req.Query = query
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+
+	if req.Query == "" {
+		query, found := store.Get(ctx, hash)
+		if !found {
+			resp := ErrorResponse("PersistedQueryNotFound", "PERSISTED_QUERY_NOT_FOUND")
+			return &resp
+		}
+		req.Query = query
+		return nil
+	}
+
+	if QueryHash(req.Query) != hash {
+		resp := ErrorResponse("provided sha does not match query", "PERSISTED_QUERY_HASH_MISMATCH")
+		return &resp
+	}
+	store.Put(ctx, hash, req.Query)
+	return nil
+}
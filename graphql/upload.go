@@ -0,0 +1,98 @@
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Upload is a file sent using the GraphQL multipart request specification.
+// Handlers receive it in place of the null variable the client mapped it to.
+type Upload struct {
+	File        multipart.File
+	Filename    string
+	Size        int64
+	ContentType string
+}
+
+// parseMultipart decodes a request following the GraphQL multipart request
+// specification: an "operations" field holding the request, a "map" field
+// mapping file field names to variable paths, and the files themselves.
+func parseMultipart(r *http.Request, maxMemory int64) (Request, error) {
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		return Request{}, fmt.Errorf("invalid multipart body: %w", err)
+	}
+
+	var req Request
+	if err := json.Unmarshal([]byte(r.FormValue("operations")), &req); err != nil {
+		return Request{}, fmt.Errorf("invalid operations field: %w", err)
+	}
+
+	var fileMap map[string][]string
+	if m := r.FormValue("map"); m != "" {
+		if err := json.Unmarshal([]byte(m), &fileMap); err != nil {
+			return Request{}, fmt.Errorf("invalid map field: %w", err)
+		}
+	}
+
+	for field, paths := range fileMap {
+		file, header, err := r.FormFile(field)
+		if err != nil {
+			return Request{}, fmt.Errorf("missing file %q: %w", field, err)
+		}
+		upload := &Upload{
+			File:        file,
+			Filename:    header.Filename,
+			Size:        header.Size,
+			ContentType: header.Header.Get("Content-Type"),
+		}
+		for _, path := range paths {
+			if err := setVariable(&req, path, upload); err != nil {
+				return Request{}, err
+			}
+		}
+	}
+	return req, nil
+}
+
+// setVariable replaces the value at an object path such as "variables.files.0"
+// with value.
+func setVariable(req *Request, path string, value any) error {
+	parts := strings.Split(path, ".")
+	if len(parts) < 2 || parts[0] != "variables" {
+		return fmt.Errorf("unsupported file path %q", path)
+	}
+	if req.Variables == nil {
+		return fmt.Errorf("file path %q refers to missing variables", path)
+	}
+
+	var container any = req.Variables
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		switch c := container.(type) {
+		case map[string]any:
+			if last {
+				c[part] = value
+				return nil
+			}
+			container = c[part]
+		case []any:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(c) {
+				return fmt.Errorf("invalid index in file path %q", path)
+			}
+			if last {
+				c[idx] = value
+				return nil
+			}
+			container = c[idx]
+		default:
+			return fmt.Errorf("file path %q does not exist in variables", path)
+		}
+	}
+	return errors.New("unreachable")
+}
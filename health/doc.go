@@ -0,0 +1,27 @@
+// Package health provides liveness and readiness endpoints built from named
+// checks.
+//
+// A Checker reports whether one dependency is usable. Register checks with a
+// Health and mount its endpoints:
+//
+//	h := health.New(health.Options{})
+//	h.AddReadiness("db", health.CheckerFunc(db.PingContext))
+//	h.AddReadiness("cache", health.CheckerFunc(func(ctx context.Context) error {
+//	    return cache.Ping(ctx).Err()
+//	}))
+//	h.Register(mux)
+//
+// GET /healthz runs the liveness checks and GET /readyz runs the liveness and
+// readiness checks. Checks run concurrently, each bounded by Options.Timeout.
+// Both answer with a JSON summary and status 200, or 503 if any check failed:
+//
+//	{"status":"fail","checks":{"cache":{"status":"ok","duration":"1.2ms"},
+//	 "db":{"status":"fail","duration":"2s","error":"context deadline exceeded"}}}
+//
+// Liveness checks should only fail when restarting the process would help;
+// a dependency outage belongs in readiness, which takes the instance out of
+// load balancing without restarting it.
+//
+// server.Run mounts the endpoints in front of the application's handler when
+// given server.WithHealth(h).
+package health
@@ -0,0 +1,201 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Checker checks one dependency of the service.
+type Checker interface {
+	// Check returns nil if the dependency is usable, or an error describing
+	// why not. It must return promptly once ctx is done.
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to Checker.
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Options configures a Health. Zero values are defaults.
+type Options struct {
+	// Timeout bounds each check. Defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// Status values reported for checks and overall results.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// CheckResult is the outcome of one check.
+type CheckResult struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Result is the aggregated outcome of a set of checks.
+type Result struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Health holds named liveness and readiness checks. It is safe for
+// concurrent use; checks may be added while it serves.
+type Health struct {
+	opts Options
+
+	mu        sync.RWMutex
+	liveness  map[string]Checker
+	readiness map[string]Checker
+}
+
+// New returns a Health without checks, whose endpoints report ok.
+func New(opts Options) *Health {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	return &Health{
+		opts:      opts,
+		liveness:  make(map[string]Checker),
+		readiness: make(map[string]Checker),
+	}
+}
+
+// AddLiveness registers a check run by /healthz and /readyz. It panics if a
+// check with the same name is already registered.
+func (h *Health) AddLiveness(name string, c Checker) {
+	h.add(h.liveness, name, c)
+}
+
+// AddReadiness registers a check run by /readyz. It panics if a check with
+// the same name is already registered.
+func (h *Health) AddReadiness(name string, c Checker) {
+	h.add(h.readiness, name, c)
+}
+
+// add registers c under name in checks.
+func (h *Health) add(checks map[string]Checker, name string, c Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.liveness[name]; ok {
+		panic(fmt.Sprintf("health: check %q registered twice", name))
+	}
+	if _, ok := h.readiness[name]; ok {
+		panic(fmt.Sprintf("health: check %q registered twice", name))
+	}
+	checks[name] = c
+}
+
+// Live runs the liveness checks.
+func (h *Health) Live(ctx context.Context) Result {
+	h.mu.RLock()
+	checks := maps.Clone(h.liveness)
+	h.mu.RUnlock()
+	return h.run(ctx, checks)
+}
+
+// Ready runs the liveness and readiness checks.
+func (h *Health) Ready(ctx context.Context) Result {
+	h.mu.RLock()
+	checks := maps.Clone(h.liveness)
+	maps.Copy(checks, h.readiness)
+	h.mu.RUnlock()
+	return h.run(ctx, checks)
+}
+
+// run runs checks concurrently and aggregates their results.
+func (h *Health) run(ctx context.Context, checks map[string]Checker) Result {
+	res := Result{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range slices.Sorted(maps.Keys(checks)) {
+		wg.Go(func() {
+			cr := h.check(ctx, checks[name])
+			mu.Lock()
+			defer mu.Unlock()
+			res.Checks[name] = cr
+			if cr.Status != StatusOK {
+				res.Status = StatusFail
+			}
+		})
+	}
+	wg.Wait()
+	return res
+}
+
+// check runs c with the configured timeout. A check that ignores its
+// context is abandoned when the timeout expires.
+func (h *Health) check(ctx context.Context, c Checker) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				done <- fmt.Errorf("panic: %v", v)
+			}
+		}()
+		done <- c.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	cr := CheckResult{Status: StatusOK, Duration: time.Since(start).Round(100 * time.Microsecond).String()}
+	if err != nil {
+		cr.Status = StatusFail
+		cr.Error = err.Error()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+			cr.Error = fmt.Sprintf("timed out after %s", h.opts.Timeout)
+		}
+	}
+	return cr
+}
+
+// LivenessHandler returns a handler that serves the result of Live.
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, h.Live(r.Context()))
+	})
+}
+
+// ReadinessHandler returns a handler that serves the result of Ready.
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, h.Ready(r.Context()))
+	})
+}
+
+// Register mounts GET /healthz and GET /readyz on mux.
+func (h *Health) Register(mux *http.ServeMux) {
+	mux.Handle("GET /healthz", h.LivenessHandler())
+	mux.Handle("GET /readyz", h.ReadinessHandler())
+}
+
+// writeResult writes res as JSON, with status 503 if it failed.
+func writeResult(w http.ResponseWriter, res Result) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if res.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(res)
+}
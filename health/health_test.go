@@ -0,0 +1,76 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, mux *http.ServeMux, path string) (int, Result) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var res Result
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("GET %s: invalid JSON %q: %v", path, rec.Body.String(), err)
+	}
+	return rec.Code, res
+}
+
+func TestHealth(t *testing.T) {
+	h := New(Options{Timeout: 50 * time.Millisecond})
+	h.AddLiveness("goroutines", CheckerFunc(func(ctx context.Context) error { return nil }))
+	dbErr := error(nil)
+	h.AddReadiness("db", CheckerFunc(func(ctx context.Context) error { return dbErr }))
+	mux := http.NewServeMux()
+	h.Register(mux)
+
+	code, res := get(t, mux, "/readyz")
+	if code != http.StatusOK || res.Status != StatusOK || len(res.Checks) != 2 {
+		t.Errorf("ready: got %d %+v", code, res)
+	}
+
+	dbErr = errors.New("connection refused")
+	code, res = get(t, mux, "/readyz")
+	if code != http.StatusServiceUnavailable || res.Status != StatusFail {
+		t.Errorf("db down: got %d %+v, want 503 fail", code, res)
+	}
+	if got := res.Checks["db"]; got.Status != StatusFail || got.Error != "connection refused" {
+		t.Errorf("db check = %+v", got)
+	}
+	if got := res.Checks["goroutines"]; got.Status != StatusOK {
+		t.Errorf("goroutines check = %+v, want ok", got)
+	}
+
+	// Readiness checks do not affect liveness.
+	code, res = get(t, mux, "/healthz")
+	if code != http.StatusOK || len(res.Checks) != 1 {
+		t.Errorf("healthz with db down: got %d %+v, want 200 with one check", code, res)
+	}
+}
+
+func TestHealth_Timeout(t *testing.T) {
+	h := New(Options{Timeout: 20 * time.Millisecond})
+	h.AddLiveness("stuck", CheckerFunc(func(ctx context.Context) error {
+		select {} // ignores ctx
+	}))
+	res := h.Live(context.Background())
+	if res.Status != StatusFail || res.Checks["stuck"].Error != "timed out after 20ms" {
+		t.Errorf("Live() = %+v, want stuck check timed out", res)
+	}
+}
+
+func TestHealth_DuplicateName(t *testing.T) {
+	h := New(Options{})
+	h.AddLiveness("db", CheckerFunc(func(context.Context) error { return nil }))
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate name did not panic")
+		}
+	}()
+	h.AddReadiness("db", CheckerFunc(func(context.Context) error { return nil }))
+}
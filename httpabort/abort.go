@@ -0,0 +1,64 @@
+package httpabort
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Abort is a panic value that requests an immediate HTTP response. Recovery
+// middleware (middleware.NewRecovery) recognises it and writes Status and
+// Body to the client instead of treating the panic as an internal error.
+//
+// Abort implements error so it can also be returned and inspected with errors.As.
+type Abort struct {
+	// Status is the HTTP status code to send.
+	Status int
+	// Body is the response body, sent as text/plain. If empty, the standard
+	// status text for Status is used.
+	Body string
+}
+
+// Error implements the error interface.
+func (a Abort) Error() string {
+	return fmt.Sprintf("http abort: %d %s", a.Status, a.Message())
+}
+
+// Message returns Body, or the status text for Status when Body is empty.
+func (a Abort) Message() string {
+	if a.Body != "" {
+		return a.Body
+	}
+	return http.StatusText(a.Status)
+}
+
+// With stops the current handler by panicking with an Abort carrying status
+// and body. It must only be called from a goroutine serving a request that is
+// wrapped by recovery middleware.
+func With(status int, body string) {
+	panic(Abort{Status: status, Body: body})
+}
+
+// BadRequest aborts the current handler with 400 Bad Request and the given message.
+func BadRequest(body string) {
+	With(http.StatusBadRequest, body)
+}
+
+// Unauthorized aborts the current handler with 401 Unauthorized.
+func Unauthorized() {
+	With(http.StatusUnauthorized, "")
+}
+
+// Forbidden aborts the current handler with 403 Forbidden.
+func Forbidden() {
+	With(http.StatusForbidden, "")
+}
+
+// NotFound aborts the current handler with 404 Not Found.
+func NotFound() {
+	With(http.StatusNotFound, "")
+}
+
+// Conflict aborts the current handler with 409 Conflict and the given message.
+func Conflict(body string) {
+	With(http.StatusConflict, body)
+}
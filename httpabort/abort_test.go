@@ -0,0 +1,62 @@
+package httpabort
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAbort_Message(t *testing.T) {
+	tests := []struct {
+		name  string
+		abort Abort
+		want  string
+	}{
+		{"custom_body", Abort{Status: http.StatusBadRequest, Body: "bad id"}, "bad id"},
+		{"default_body", Abort{Status: http.StatusNotFound}, "Not Found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.abort.Message(); got != tt.want {
+				t.Errorf("Message() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAbort_Error(t *testing.T) {
+	a := Abort{Status: http.StatusConflict, Body: "exists"}
+	if got, want := a.Error(), "http abort: 409 exists"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestHelpers_Panic(t *testing.T) {
+	tests := []struct {
+		name   string
+		fn     func()
+		status int
+	}{
+		{"BadRequest", func() { BadRequest("x") }, http.StatusBadRequest},
+		{"Unauthorized", Unauthorized, http.StatusUnauthorized},
+		{"Forbidden", Forbidden, http.StatusForbidden},
+		{"NotFound", NotFound, http.StatusNotFound},
+		{"Conflict", func() { Conflict("x") }, http.StatusConflict},
+		{"With", func() { With(http.StatusTeapot, "") }, http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				a, ok := recover().(Abort)
+				if !ok {
+					t.Fatal("expected panic with Abort")
+				}
+				if a.Status != tt.status {
+					t.Errorf("Status = %d, want %d", a.Status, tt.status)
+				}
+			}()
+			tt.fn()
+		})
+	}
+}
@@ -0,0 +1,19 @@
+// Package httpabort provides typed panics for stopping an HTTP handler early.
+//
+// Code deep in a call stack (e.g. a data loader that finds no row) can abort
+// the request with a specific response without plumbing errors back up
+// through every caller:
+//
+//	func loadUser(id string) User {
+//	    u, ok := users[id]
+//	    if !ok {
+//	        httpabort.NotFound()
+//	    }
+//	    return u
+//	}
+//
+// The panic carries an Abort value, which middleware.NewRecovery converts into
+// a response with the requested status and body. Any other panic is still
+// treated as an internal server error. Handlers using this package must be
+// wrapped by the recovery middleware.
+package httpabort
@@ -0,0 +1,366 @@
+package httpclient
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials attach a service's credentials to outbound requests.
+type Credentials interface {
+	// Authorize sets the credentials on req, typically its Authorization
+	// header. req is a copy owned by the caller.
+	Authorize(req *http.Request) error
+}
+
+// AuthOptions configures NewAuthTransport.
+type AuthOptions struct {
+	// Targets maps hosts to the credentials sent to them. Keys are a host
+	// name ("billing.internal"), a host and port ("billing.internal:8443")
+	// or a wildcard for subdomains ("*.internal"); the most specific
+	// match wins. Requests to other hosts are sent without credentials.
+	Targets map[string]Credentials
+	// AllowInsecure permits sending credentials over plain HTTP. By
+	// default they are only attached to HTTPS requests.
+	AllowInsecure bool
+}
+
+// NewAuthTransport returns a transport that attaches the credentials
+// configured for each request's host. Requests that already carry an
+// Authorization header are left alone. If a request with credentials that
+// can be refreshed (such as NewClientCredentials) is answered with 401, the
+// cached token is dropped so the next request fetches a new one.
+//
+// A nil next means http.DefaultTransport.
+func NewAuthTransport(next http.RoundTripper, opts AuthOptions) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	targets := maps.Clone(opts.Targets)
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		creds := credentialsFor(targets, req.URL)
+		if creds == nil || req.Header.Get("Authorization") != "" ||
+			req.URL.Scheme != "https" && !opts.AllowInsecure {
+			return next.RoundTrip(req)
+		}
+		authed := req.Clone(req.Context())
+		authed.Header = req.Header.Clone()
+		if err := creds.Authorize(authed); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, fmt.Errorf("httpclient: authorizing request to %s: %w", req.URL.Host, err)
+		}
+		resp, err := next.RoundTrip(authed)
+		if err == nil && resp.StatusCode == http.StatusUnauthorized {
+			if r, ok := creds.(interface{ invalidate() }); ok {
+				r.invalidate()
+			}
+		}
+		return resp, err
+	})
+}
+
+// credentialsFor returns the credentials configured for u's host, if any.
+func credentialsFor(targets map[string]Credentials, u *url.URL) Credentials {
+	if c, ok := targets[u.Host]; ok {
+		return c
+	}
+	host := u.Hostname()
+	if c, ok := targets[host]; ok {
+		return c
+	}
+	for {
+		_, rest, ok := strings.Cut(host, ".")
+		if !ok {
+			return nil
+		}
+		if c, ok := targets["*."+rest]; ok {
+			return c
+		}
+		host = rest
+	}
+}
+
+// staticToken is the Credentials returned by NewStaticToken.
+type staticToken string
+
+// NewStaticToken returns Credentials that send token as a bearer token.
+func NewStaticToken(token string) Credentials {
+	return staticToken(token)
+}
+
+// Authorize implements Credentials.
+func (t staticToken) Authorize(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+// ClientCredentialsConfig configures NewClientCredentials.
+type ClientCredentialsConfig struct {
+	// TokenURL is the authorization server's token endpoint.
+	TokenURL string
+	// ClientID and ClientSecret identify the service. They are sent with
+	// HTTP Basic authentication.
+	ClientID     string
+	ClientSecret string
+	// Scopes are the scopes requested, if any.
+	Scopes []string
+	// Params are extra form parameters for the token request, such as an
+	// audience or resource indicator.
+	Params url.Values
+	// Client sends token requests. Defaults to a client with a 10 second
+	// timeout.
+	Client *http.Client
+}
+
+// clientCredentials is the Credentials returned by NewClientCredentials.
+type clientCredentials struct {
+	cfg ClientCredentialsConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewClientCredentials returns Credentials that obtain bearer tokens with
+// the OAuth 2.0 client credentials grant (RFC 6749, section 4.4). A token is
+// reused until shortly before it expires and then fetched again; concurrent
+// requests wait for a single fetch. TokenURL and ClientID are required;
+// NewClientCredentials panics without them.
+func NewClientCredentials(cfg ClientCredentialsConfig) Credentials {
+	if cfg.TokenURL == "" || cfg.ClientID == "" {
+		panic("httpclient: ClientCredentialsConfig requires TokenURL and ClientID")
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &clientCredentials{cfg: cfg, now: time.Now}
+}
+
+// Authorize implements Credentials.
+func (c *clientCredentials) Authorize(req *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == "" || !c.now().Before(c.expires) {
+		if err := c.fetch(req.Context()); err != nil {
+			return err
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	return nil
+}
+
+// invalidate drops the cached token after the upstream rejected it.
+func (c *clientCredentials) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = ""
+}
+
+// fetch requests a new token. c.mu must be held.
+func (c *clientCredentials) fetch(ctx context.Context) error {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	}
+	for name, values := range c.cfg.Params {
+		form[name] = values
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+
+	resp, err := c.cfg.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("token request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token request: %s: %s", resp.Status, strings.TrimSpace(string(body[:min(len(body), 256)])))
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return fmt.Errorf("token response: %w", err)
+	}
+	if tok.AccessToken == "" {
+		return fmt.Errorf("token response has no access_token")
+	}
+	if tok.TokenType != "" && !strings.EqualFold(tok.TokenType, "bearer") {
+		return fmt.Errorf("token response has unsupported token_type %q", tok.TokenType)
+	}
+	lifetime := time.Hour // RFC 6749 leaves the default to the server
+	if tok.ExpiresIn > 0 {
+		lifetime = time.Duration(tok.ExpiresIn) * time.Second
+	}
+	c.token = tok.AccessToken
+	c.expires = c.now().Add(lifetime - min(30*time.Second, lifetime/10))
+	return nil
+}
+
+// JWTConfig configures NewSignedJWT.
+type JWTConfig struct {
+	// Issuer, Subject and Audience set the iss, sub and aud claims. Empty
+	// values are left out.
+	Issuer   string
+	Subject  string
+	Audience string
+	// KeyID sets the kid header, so the receiver can pick the verification
+	// key. Empty means no kid.
+	KeyID string
+	// Key signs the tokens: an ed25519.PrivateKey (EdDSA), an
+	// *ecdsa.PrivateKey on P-256 (ES256), an *rsa.PrivateKey (RS256) or a
+	// []byte shared secret (HS256).
+	Key any
+	// TTL is how long each token is valid. Tokens are reused for half of
+	// it. Defaults to 5 minutes.
+	TTL time.Duration
+	// Claims are extra claims added to every token.
+	Claims map[string]any
+}
+
+// signedJWT is the Credentials returned by NewSignedJWT.
+type signedJWT struct {
+	jwt JWTConfig
+	alg string
+	now func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	renewAt time.Time
+}
+
+// NewSignedJWT returns Credentials that send short-lived JWTs (RFC 7519)
+// signed with cfg.Key as bearer tokens, for receivers that verify service
+// identity against a public key. It panics if the key type is unsupported.
+func NewSignedJWT(cfg JWTConfig) Credentials {
+	var alg string
+	switch k := cfg.Key.(type) {
+	case ed25519.PrivateKey:
+		alg = "EdDSA"
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			panic("httpclient: JWTConfig.Key must be an ECDSA key on P-256")
+		}
+		alg = "ES256"
+	case *rsa.PrivateKey:
+		alg = "RS256"
+	case []byte:
+		if len(k) == 0 {
+			panic("httpclient: JWTConfig.Key must not be empty")
+		}
+		alg = "HS256"
+	default:
+		panic(fmt.Sprintf("httpclient: unsupported JWTConfig.Key type %T", cfg.Key))
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 5 * time.Minute
+	}
+	return &signedJWT{jwt: cfg, alg: alg, now: time.Now}
+}
+
+// Authorize implements Credentials.
+func (s *signedJWT) Authorize(req *http.Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := s.now(); s.token == "" || !now.Before(s.renewAt) {
+		token, err := s.sign(now)
+		if err != nil {
+			return err
+		}
+		s.token, s.renewAt = token, now.Add(s.jwt.TTL/2)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	return nil
+}
+
+// sign returns a new token issued at now.
+func (s *signedJWT) sign(now time.Time) (string, error) {
+	header := map[string]string{"alg": s.alg, "typ": "JWT"}
+	if s.jwt.KeyID != "" {
+		header["kid"] = s.jwt.KeyID
+	}
+	claims := maps.Clone(s.jwt.Claims)
+	if claims == nil {
+		claims = make(map[string]any)
+	}
+	for name, value := range map[string]string{"iss": s.jwt.Issuer, "sub": s.jwt.Subject, "aud": s.jwt.Audience} {
+		if value != "" {
+			claims[name] = value
+		}
+	}
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(s.jwt.TTL).Unix()
+
+	var nonce [12]byte
+	rand.Read(nonce[:])
+	claims["jti"] = base64.RawURLEncoding.EncodeToString(nonce[:])
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("encoding JWT claims: %w", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	sig, err := s.signature([]byte(signingInput))
+	if err != nil {
+		return "", fmt.Errorf("signing JWT: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// signature signs input with the configured key.
+func (s *signedJWT) signature(input []byte) ([]byte, error) {
+	digest := sha256.Sum256(input)
+	switch k := s.jwt.Key.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, input), nil
+	case *ecdsa.PrivateKey:
+		r, sv, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		sv.FillBytes(sig[32:])
+		return sig, nil
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	default:
+		mac := hmac.New(sha256.New, k.([]byte))
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	}
+}
@@ -0,0 +1,549 @@
+package httpclient
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CachedResponse is a response stored by a CachingTransport.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// RequestTime and ResponseTime are when the request that produced the
+	// response was sent and when its response arrived, for age calculation.
+	RequestTime  time.Time
+	ResponseTime time.Time
+	// Vary holds the request's values of the headers named by the
+	// response's Vary header, which later requests must match.
+	Vary map[string]string
+}
+
+// CacheStore stores responses for a CachingTransport. Implementations must
+// be safe for concurrent use, and must not modify responses passed to Set or
+// returned by Get; a shared store (e.g. Redis) serializes them.
+type CacheStore interface {
+	// Get returns the response stored under key, if any.
+	Get(ctx context.Context, key string) (*CachedResponse, bool, error)
+	// Set stores resp under key, replacing any previous response.
+	Set(ctx context.Context, key string, resp *CachedResponse) error
+	// Delete removes the response stored under key, if any.
+	Delete(ctx context.Context, key string) error
+}
+
+// CacheOptions configures NewCachingTransport. Zero values are defaults.
+type CacheOptions struct {
+	// Store holds the cached responses. Defaults to
+	// NewMemoryCacheStore(1000).
+	Store CacheStore
+	// MaxBodySize is the largest body that is cached, in bytes. Larger
+	// responses are passed through. Defaults to 1 MiB.
+	MaxBodySize int64
+	// Private makes the transport act as a private cache, for a client
+	// that only ever acts for one user: responses marked private and
+	// requests with an Authorization header are cached. By default the
+	// transport acts as a shared cache, since one client usually serves
+	// requests for many users.
+	Private bool
+	// Logger receives store errors. Defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// CacheStats is a snapshot of a CachingTransport's activity.
+type CacheStats struct {
+	// Hits is the number of requests answered from the cache without
+	// contacting the upstream, including stale responses served while
+	// revalidating.
+	Hits int64
+	// Stale is the number of Hits served stale under stale-while-revalidate.
+	Stale int64
+	// Revalidated is the number of cached responses confirmed by a 304.
+	Revalidated int64
+	// Misses is the number of cacheable requests sent upstream in full.
+	Misses int64
+	// Stores is the number of responses written to the store.
+	Stores int64
+}
+
+// HitRate returns the fraction of cacheable requests answered from the
+// cache, counting revalidated responses as hits.
+func (s CacheStats) HitRate() float64 {
+	total := s.Hits + s.Revalidated + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits+s.Revalidated) / float64(total)
+}
+
+// CachingTransport is an http.RoundTripper that caches responses to GET
+// requests following the HTTP caching rules (RFC 9111, formerly RFC 7234).
+// Create one with NewCachingTransport.
+type CachingTransport struct {
+	next http.RoundTripper
+	opts CacheOptions
+	now  func() time.Time
+
+	mu           sync.Mutex
+	revalidating map[string]bool
+
+	hits, stale, revalidated, misses, stores atomic.Int64
+}
+
+// NewCachingTransport returns a transport that serves repeated GET requests
+// from a cache, so that slow upstreams are only called when a response has
+// expired. It honours Cache-Control (max-age, s-maxage, no-store, no-cache,
+// private, must-revalidate, stale-while-revalidate), Expires, Age, Vary, and
+// revalidates expired responses with If-None-Match or If-Modified-Since.
+// Responses with a Last-Modified header but no explicit lifetime are fresh
+// for a tenth of their age, up to a day. Successful POST, PUT, PATCH and
+// DELETE requests invalidate the cached response for their URL.
+//
+// Requests with Range or conditional headers, or with Cache-Control:
+// no-store, bypass the cache. A nil next means http.DefaultTransport.
+func NewCachingTransport(next http.RoundTripper, opts CacheOptions) *CachingTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryCacheStore(1000)
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &CachingTransport{next: next, opts: opts, now: time.Now, revalidating: make(map[string]bool)}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.String()
+	if req.Method != http.MethodGet {
+		resp, err := t.next.RoundTrip(req)
+		if err == nil && resp.StatusCode < 400 && isUnsafe(req.Method) {
+			t.delete(req.Context(), key)
+		}
+		return resp, err
+	}
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; ok || !t.cacheableRequest(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	entry, ok, err := t.opts.Store.Get(req.Context(), key)
+	if err != nil {
+		t.opts.Logger.Warn("response cache lookup failed", slog.String("key", key), slog.String("error", err.Error()))
+	}
+	if !ok || !entry.matches(req) {
+		t.misses.Add(1)
+		return t.fetch(req, key)
+	}
+
+	age, lifetime := entry.age(t.now()), entry.lifetime(t.opts.Private)
+	respCC := parseCacheControl(entry.Header)
+	_, noCache := respCC["no-cache"]
+	_, reqNoCache := reqCC["no-cache"]
+	if maxAge, ok := seconds(reqCC, "max-age"); ok {
+		lifetime = min(lifetime, maxAge)
+	}
+	if !noCache && !reqNoCache {
+		if age < lifetime {
+			t.hits.Add(1)
+			return entry.response(req, age), nil
+		}
+		_, mustRevalidate := respCC["must-revalidate"]
+		if swr, ok := seconds(respCC, "stale-while-revalidate"); ok && !mustRevalidate && age < lifetime+swr {
+			t.hits.Add(1)
+			t.stale.Add(1)
+			t.revalidateAsync(req, key, entry)
+			return entry.response(req, age), nil
+		}
+	}
+	return t.revalidate(req, key, entry)
+}
+
+// fetch sends req upstream and stores the response if it is cacheable.
+func (t *CachingTransport) fetch(req *http.Request, key string) (*http.Response, error) {
+	requestTime := t.now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.store(req, key, resp, requestTime), nil
+}
+
+// revalidate asks the upstream whether entry is still current, returning the
+// cached response on 304 and the new response otherwise.
+func (t *CachingTransport) revalidate(req *http.Request, key string, entry *CachedResponse) (*http.Response, error) {
+	etag, lastModified := entry.Header.Get("ETag"), entry.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		t.misses.Add(1)
+		return t.fetch(req, key)
+	}
+	cond := req.Clone(req.Context())
+	cond.Header = req.Header.Clone()
+	if etag != "" {
+		cond.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		cond.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	requestTime := t.now()
+	resp, err := t.next.RoundTrip(cond)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusNotModified {
+		t.misses.Add(1)
+		return t.store(req, key, resp, requestTime), nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	t.revalidated.Add(1)
+
+	updated := *entry
+	updated.Header = entry.Header.Clone()
+	for name, values := range resp.Header {
+		if name != "Content-Length" {
+			updated.Header[name] = values
+		}
+	}
+	updated.RequestTime, updated.ResponseTime = requestTime, t.now()
+	t.set(req.Context(), key, &updated)
+	return updated.response(req, updated.age(t.now())), nil
+}
+
+// revalidateAsync revalidates entry in the background, at most once at a
+// time per key.
+func (t *CachingTransport) revalidateAsync(req *http.Request, key string, entry *CachedResponse) {
+	t.mu.Lock()
+	if t.revalidating[key] {
+		t.mu.Unlock()
+		return
+	}
+	t.revalidating[key] = true
+	t.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), 30*time.Second)
+	bg := req.Clone(ctx)
+	go func() {
+		defer func() {
+			cancel()
+			t.mu.Lock()
+			delete(t.revalidating, key)
+			t.mu.Unlock()
+		}()
+		resp, err := t.revalidate(bg, key, entry)
+		if err != nil {
+			t.opts.Logger.Debug("background revalidation failed", slog.String("key", key), slog.String("error", err.Error()))
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
+
+// store caches resp if it is cacheable and returns it with a readable body.
+func (t *CachingTransport) store(req *http.Request, key string, resp *http.Response, requestTime time.Time) *http.Response {
+	if !t.cacheableResponse(resp) {
+		return resp
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, t.opts.MaxBodySize+1))
+	if err != nil || int64(len(body)) > t.opts.MaxBodySize {
+		// Too large or cut short: pass on what was read and the rest.
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry := &CachedResponse{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         body,
+		RequestTime:  requestTime,
+		ResponseTime: t.now(),
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if entry.Vary == nil {
+			entry.Vary = make(map[string]string)
+		}
+		entry.Vary[name] = strings.Join(req.Header.Values(name), ",")
+	}
+	t.set(req.Context(), key, entry)
+	return resp
+}
+
+// set writes entry to the store, logging failures.
+func (t *CachingTransport) set(ctx context.Context, key string, entry *CachedResponse) {
+	if err := t.opts.Store.Set(ctx, key, entry); err != nil {
+		t.opts.Logger.Warn("response cache store failed", slog.String("key", key), slog.String("error", err.Error()))
+		return
+	}
+	t.stores.Add(1)
+}
+
+// delete removes key from the store, logging failures.
+func (t *CachingTransport) delete(ctx context.Context, key string) {
+	if err := t.opts.Store.Delete(ctx, key); err != nil {
+		t.opts.Logger.Warn("response cache invalidation failed", slog.String("key", key), slog.String("error", err.Error()))
+	}
+}
+
+// cacheableRequest reports whether req may be answered from the cache.
+func (t *CachingTransport) cacheableRequest(req *http.Request) bool {
+	for _, name := range []string{"Range", "If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since"} {
+		if req.Header.Get(name) != "" {
+			return false
+		}
+	}
+	return t.opts.Private || req.Header.Get("Authorization") == ""
+}
+
+// cacheableResponse reports whether resp may be stored.
+func (t *CachingTransport) cacheableResponse(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusMultipleChoices, http.StatusMovedPermanently, http.StatusNotFound,
+		http.StatusMethodNotAllowed, http.StatusGone, http.StatusRequestURITooLong,
+		http.StatusNotImplemented, http.StatusPermanentRedirect:
+	default:
+		return false
+	}
+	cc := parseCacheControl(resp.Header)
+	if _, ok := cc["no-store"]; ok {
+		return false
+	}
+	if _, ok := cc["private"]; ok && !t.opts.Private {
+		return false
+	}
+	if slices.Contains(varyHeaders(resp.Header), "*") {
+		return false
+	}
+	_, maxAge := cc["max-age"]
+	_, sMaxAge := cc["s-maxage"]
+	return maxAge || sMaxAge || resp.Header.Get("Expires") != "" ||
+		resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+}
+
+// Stats returns the transport's activity so far.
+func (t *CachingTransport) Stats() CacheStats {
+	return CacheStats{
+		Hits:        t.hits.Load(),
+		Stale:       t.stale.Load(),
+		Revalidated: t.revalidated.Load(),
+		Misses:      t.misses.Load(),
+		Stores:      t.stores.Load(),
+	}
+}
+
+// LogValue implements slog.LogValuer, logging the transport's statistics.
+func (t *CachingTransport) LogValue() slog.Value {
+	s := t.Stats()
+	return slog.GroupValue(
+		slog.Int64("hits", s.Hits),
+		slog.Int64("stale", s.Stale),
+		slog.Int64("revalidated", s.Revalidated),
+		slog.Int64("misses", s.Misses),
+		slog.Int64("stores", s.Stores),
+		slog.Float64("hit_rate", s.HitRate()),
+	)
+}
+
+// matches reports whether req has the header values the response varies on.
+func (c *CachedResponse) matches(req *http.Request) bool {
+	for name, value := range c.Vary {
+		if strings.Join(req.Header.Values(name), ",") != value {
+			return false
+		}
+	}
+	return true
+}
+
+// age returns the response's current age (RFC 9111, section 4.2.3).
+func (c *CachedResponse) age(now time.Time) time.Duration {
+	ageValue, _ := strconv.Atoi(c.Header.Get("Age"))
+	apparent := time.Duration(0)
+	if date, err := http.ParseTime(c.Header.Get("Date")); err == nil {
+		apparent = max(0, c.ResponseTime.Sub(date))
+	}
+	corrected := time.Duration(ageValue)*time.Second + c.ResponseTime.Sub(c.RequestTime)
+	return max(apparent, corrected) + now.Sub(c.ResponseTime)
+}
+
+// lifetime returns the response's freshness lifetime (RFC 9111, section 4.2.1).
+func (c *CachedResponse) lifetime(private bool) time.Duration {
+	cc := parseCacheControl(c.Header)
+	if d, ok := seconds(cc, "s-maxage"); ok && !private {
+		return d
+	}
+	if d, ok := seconds(cc, "max-age"); ok {
+		return d
+	}
+	date, err := http.ParseTime(c.Header.Get("Date"))
+	if err != nil {
+		date = c.ResponseTime
+	}
+	if expires := c.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0 // invalid Expires means already expired
+		}
+		return max(0, t.Sub(date))
+	}
+	if lm, err := http.ParseTime(c.Header.Get("Last-Modified")); err == nil {
+		return min(max(0, date.Sub(lm))/10, 24*time.Hour)
+	}
+	return 0
+}
+
+// response builds an http.Response for req from the cached response.
+func (c *CachedResponse) response(req *http.Request, age time.Duration) *http.Response {
+	header := c.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(age/time.Second)))
+	return &http.Response{
+		Status:        strconv.Itoa(c.StatusCode) + " " + http.StatusText(c.StatusCode),
+		StatusCode:    c.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// parseCacheControl returns the directives of h's Cache-Control headers,
+// keyed by lower-cased name, with unquoted values.
+func parseCacheControl(h http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, line := range h.Values("Cache-Control") {
+		for part := range strings.SplitSeq(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name != "" {
+				cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return cc
+}
+
+// seconds returns the delta-seconds value of directive in cc.
+func seconds(cc map[string]string, directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// varyHeaders returns the canonical header names listed in h's Vary header.
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, line := range h.Values("Vary") {
+		for name := range strings.SplitSeq(line, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// isUnsafe reports whether method may change the resource at its URL.
+func isUnsafe(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// readCloser combines a Reader with another value's Close.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// memoryCacheStore is the in-memory CacheStore returned by
+// NewMemoryCacheStore.
+type memoryCacheStore struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // of *memoryCacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+// memoryCacheEntry is an element of memoryCacheStore.order.
+type memoryCacheEntry struct {
+	key  string
+	resp *CachedResponse
+}
+
+// NewMemoryCacheStore returns a CacheStore that keeps up to maxEntries
+// responses in memory, evicting the least recently used. It panics if
+// maxEntries is not positive.
+func NewMemoryCacheStore(maxEntries int) CacheStore {
+	if maxEntries <= 0 {
+		panic("httpclient: NewMemoryCacheStore requires a positive maxEntries")
+	}
+	return &memoryCacheStore{max: maxEntries, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Get implements CacheStore.
+func (s *memoryCacheStore) Get(_ context.Context, key string) (*CachedResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	s.order.MoveToFront(e)
+	return e.Value.(*memoryCacheEntry).resp, true, nil
+}
+
+// Set implements CacheStore.
+func (s *memoryCacheStore) Set(_ context.Context, key string, resp *CachedResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.Value.(*memoryCacheEntry).resp = resp
+		s.order.MoveToFront(e)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(&memoryCacheEntry{key: key, resp: resp})
+	if s.order.Len() > s.max {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+	return nil
+}
+
+// Delete implements CacheStore.
+func (s *memoryCacheStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		s.order.Remove(e)
+		delete(s.entries, key)
+	}
+	return nil
+}
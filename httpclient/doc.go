@@ -0,0 +1,53 @@
+// Package httpclient provides building blocks for outbound HTTP clients.
+//
+// NewSSRFGuardTransport returns an http.RoundTripper for services that fetch
+// URLs supplied by users (webhooks, link previews, imports). It refuses to
+// connect to loopback, private, link-local (including cloud metadata
+// endpoints such as 169.254.169.254) and other internal addresses. The check
+// runs on the address actually dialled, after DNS resolution, so a hostname
+// that resolves to an internal address, including one that changes between
+// lookups (DNS rebinding), is blocked too:
+//
+//	client := &http.Client{
+//	    Transport: httpclient.NewSSRFGuardTransport(httpclient.SSRFGuardOptions{}),
+//	    Timeout:   10 * time.Second,
+//	}
+//	resp, err := client.Get(userSuppliedURL)
+//	if errors.Is(err, httpclient.ErrBlockedAddress) {
+//	    // reject the URL
+//	}
+//
+// NewCachingResolver caches DNS lookups, including failures, and can pin
+// hosts to fixed addresses. Its DialContext plugs into an http.Transport and
+// composes with the SSRF guard's dialer; Stats reports lookup counts, failures
+// and latency:
+//
+//	resolver := httpclient.NewCachingResolver(httpclient.ResolverOptions{TTL: time.Minute})
+//	transport := &http.Transport{DialContext: resolver.DialContext(
+//	    httpclient.NewSSRFGuardDialer(httpclient.SSRFGuardOptions{}))}
+//
+// NewTransport sizes a transport's connection pool and TLS session cache from
+// a config.ClientConfig. A ConnTracker wraps any RoundTripper and counts the
+// dials, reused connections and TLS handshakes behind its requests, showing
+// whether the pool fits the load.
+//
+// NewHedgingTransport sends a second attempt of a slow idempotent request,
+// optionally to another replica, takes the first success and cancels the
+// other attempt; a budget limits how much load hedging adds.
+//
+// NewCachingTransport caches GET responses as the HTTP caching rules allow,
+// revalidating expired ones and honouring stale-while-revalidate, in memory
+// or in a pluggable CacheStore.
+//
+// NewAuthTransport attaches service credentials to requests by target host:
+// a static token, OAuth 2.0 client credentials with automatic refresh, or
+// JWTs signed with the service's key.
+//
+// NewSigningTransport signs requests such as webhooks in the format checked
+// by middleware.NewHMACVerifier, with a fresh nonce for replay protection.
+//
+// A Client, used with the generic functions Get, Post, Do and Items, calls
+// JSON APIs: it resolves paths against a base URL, decodes responses into a
+// type parameter, turns error statuses into *APIError, propagates the
+// context's deadline and request ID, and iterates over paginated results.
+package httpclient
@@ -0,0 +1,340 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HedgeOptions configures NewHedgingTransport. Zero values are defaults.
+type HedgeOptions struct {
+	// Delay is how long the first attempt may run before a second one is
+	// sent. When Percentile is set it is only used until enough latencies
+	// have been observed. Defaults to 100 milliseconds.
+	Delay time.Duration
+	// Percentile, between 0 and 1 (e.g. 0.95), derives the delay from the
+	// latencies of recent requests, so that only the slowest requests are
+	// hedged. Zero means Delay is always used.
+	Percentile float64
+	// Budget caps the added load as the fraction of requests that may be
+	// hedged: each request earns Budget hedges, up to a burst of ten, and
+	// each hedge spends one. Defaults to 0.1 (10%).
+	Budget float64
+	// Replicas lists hosts (host or host:port) that serve the same API. The
+	// hedge is sent to a replica other than the request's host, in turn. If
+	// empty, the hedge goes to the request's host, which helps when it is a
+	// load balancer.
+	Replicas []string
+	// Logger receives a DEBUG record for each hedge sent. Defaults to
+	// slog.Default().
+	Logger *slog.Logger
+}
+
+// HedgeStats is a snapshot of a hedging transport's activity.
+type HedgeStats struct {
+	// Requests is the number of requests eligible for hedging.
+	Requests int64
+	// Hedges is the number of second attempts sent.
+	Hedges int64
+	// HedgeWins is the number of requests answered by the second attempt.
+	HedgeWins int64
+	// Throttled is the number of hedges not sent because the budget was spent.
+	Throttled int64
+}
+
+// HedgingTransport is an http.RoundTripper that hedges slow idempotent
+// requests. Create one with NewHedgingTransport.
+type HedgingTransport struct {
+	next http.RoundTripper
+	opts HedgeOptions
+
+	mu        sync.Mutex
+	tokens    float64
+	latencies []time.Duration // ring buffer of recent latencies
+	pos       int
+	delay     time.Duration
+	replica   int
+
+	requests, hedges, wins, throttled atomic.Int64
+}
+
+// hedgeBurst is the most hedges the budget can accumulate.
+const hedgeBurst = 10
+
+// hedgeWindow is the number of recent latencies Percentile is taken from.
+const hedgeWindow = 128
+
+// NewHedgingTransport returns a transport that sends a second attempt of an
+// idempotent request when the first has not answered within the hedge delay,
+// returns whichever attempt succeeds first and cancels the other. This trims
+// tail latency caused by a slow replica at the cost of some extra load,
+// which Budget bounds.
+//
+// Requests are hedged only if their method is idempotent (GET, HEAD,
+// OPTIONS, TRACE, PUT, DELETE) or they carry an Idempotency-Key header, and
+// their body, if any, can be replayed with GetBody. Other requests pass
+// straight to next. An attempt succeeds if it returns a response with a
+// status below 500; if both attempts fail, the first failure is returned.
+//
+// A nil next means http.DefaultTransport. Percentile must be below 1 and
+// Budget must not be negative; NewHedgingTransport panics otherwise.
+func NewHedgingTransport(next http.RoundTripper, opts HedgeOptions) *HedgingTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if opts.Percentile < 0 || opts.Percentile >= 1 {
+		panic("httpclient: HedgeOptions.Percentile must be in [0, 1)")
+	}
+	if opts.Budget < 0 {
+		panic("httpclient: HedgeOptions.Budget must not be negative")
+	}
+	if opts.Delay <= 0 {
+		opts.Delay = 100 * time.Millisecond
+	}
+	if opts.Budget == 0 {
+		opts.Budget = 0.1
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &HedgingTransport{next: next, opts: opts, tokens: hedgeBurst, delay: opts.Delay}
+}
+
+// attempt is the outcome of one try of a hedged request.
+type attempt struct {
+	resp   *http.Response
+	err    error
+	hedge  bool
+	index  int
+	cancel context.CancelFunc
+}
+
+// ok reports whether the attempt succeeded.
+func (a attempt) ok() bool {
+	return a.err == nil && a.resp.StatusCode < 500
+}
+
+// discard releases a losing attempt.
+func (a attempt) discard() {
+	if a.resp != nil {
+		io.Copy(io.Discard, io.LimitReader(a.resp.Body, 4<<10))
+		a.resp.Body.Close()
+	}
+	a.cancel()
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *HedgingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !hedgeable(req) {
+		return t.next.RoundTrip(req)
+	}
+	t.requests.Add(1)
+	start := time.Now()
+	t.mu.Lock()
+	t.tokens = min(t.tokens+t.opts.Budget, hedgeBurst)
+	delay := t.delay
+	t.mu.Unlock()
+
+	results := make(chan attempt, 2)
+	pending := 1
+	cancels := []context.CancelFunc{t.launch(req, req.Body, 0, results)}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	timerC := timer.C
+
+	var failure *attempt
+	for {
+		select {
+		case <-timerC:
+			timerC = nil
+			hedge, ok := t.hedgeRequest(req)
+			if !ok {
+				continue
+			}
+			body, err := bodyFor(hedge)
+			if err != nil {
+				continue
+			}
+			pending++
+			t.hedges.Add(1)
+			t.opts.Logger.Debug("hedging request",
+				slog.String("method", req.Method),
+				slog.String("host", hedge.URL.Host),
+				slog.Duration("delay", delay))
+			cancels = append(cancels, t.launch(hedge, body, len(cancels), results))
+
+		case a := <-results:
+			pending--
+			if a.ok() {
+				if a.hedge {
+					t.wins.Add(1)
+				}
+				// The latency the caller saw, which for a hedge includes the
+				// delay before it was sent.
+				t.observe(time.Since(start))
+				for i, cancel := range cancels {
+					if i != a.index {
+						cancel()
+					}
+				}
+				if failure != nil {
+					failure.discard()
+				}
+				go drain(results, pending)
+				return wrapCancel(a), nil
+			}
+			if failure == nil {
+				failure = &a
+			} else {
+				a.discard()
+			}
+			// A failed first attempt before the delay is returned as is:
+			// hedging cuts latency, it does not retry failures.
+			if pending == 0 {
+				timer.Stop()
+				if failure.err != nil {
+					failure.cancel()
+					return nil, failure.err
+				}
+				return wrapCancel(*failure), nil
+			}
+		}
+	}
+}
+
+// launch starts attempt index of req, sending its outcome to results, and
+// returns a function that cancels it.
+func (t *HedgingTransport) launch(req *http.Request, body io.ReadCloser, index int, results chan<- attempt) context.CancelFunc {
+	ctx, cancel := context.WithCancel(req.Context())
+	r := req.Clone(ctx)
+	r.Body = body
+	go func() {
+		resp, err := t.next.RoundTrip(r)
+		results <- attempt{resp: resp, err: err, hedge: index > 0, index: index, cancel: cancel}
+	}()
+	return cancel
+}
+
+// hedgeRequest spends a hedge from the budget and returns the request the
+// hedge should send, pointed at the next replica. It reports false if the
+// budget is spent.
+func (t *HedgingTransport) hedgeRequest(req *http.Request) (*http.Request, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tokens < 1 {
+		t.throttled.Add(1)
+		return nil, false
+	}
+	t.tokens--
+
+	hedge := *req
+	for range t.opts.Replicas {
+		host := t.opts.Replicas[t.replica%len(t.opts.Replicas)]
+		t.replica++
+		if host != req.URL.Host {
+			u := *req.URL
+			u.Host = host
+			hedge.URL = &u
+			hedge.Host = ""
+			break
+		}
+	}
+	return &hedge, true
+}
+
+// observe records a successful attempt's latency and, every so often,
+// recomputes the delay from Percentile.
+func (t *HedgingTransport) observe(d time.Duration) {
+	if t.opts.Percentile == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.latencies) < hedgeWindow {
+		t.latencies = append(t.latencies, d)
+	} else {
+		t.latencies[t.pos%hedgeWindow] = d
+	}
+	t.pos++
+	if t.pos%16 == 0 {
+		sorted := slices.Clone(t.latencies)
+		slices.Sort(sorted)
+		t.delay = sorted[int(t.opts.Percentile*float64(len(sorted)))]
+	}
+}
+
+// Stats returns the transport's activity so far.
+func (t *HedgingTransport) Stats() HedgeStats {
+	return HedgeStats{
+		Requests:  t.requests.Load(),
+		Hedges:    t.hedges.Load(),
+		HedgeWins: t.wins.Load(),
+		Throttled: t.throttled.Load(),
+	}
+}
+
+// LogValue implements slog.LogValuer, logging the transport's statistics.
+func (t *HedgingTransport) LogValue() slog.Value {
+	s := t.Stats()
+	return slog.GroupValue(
+		slog.Int64("requests", s.Requests),
+		slog.Int64("hedges", s.Hedges),
+		slog.Int64("hedge_wins", s.HedgeWins),
+		slog.Int64("throttled", s.Throttled),
+	)
+}
+
+// hedgeable reports whether req may be sent twice.
+func hedgeable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+	default:
+		if req.Header.Get("Idempotency-Key") == "" {
+			return false
+		}
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// bodyFor returns a fresh copy of req's body for a second attempt.
+func bodyFor(req *http.Request) (io.ReadCloser, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req.Body, nil
+	}
+	return req.GetBody()
+}
+
+// drain discards the outcomes of the n attempts still running after a
+// winner was chosen and their contexts cancelled.
+func drain(results <-chan attempt, n int) {
+	for range n {
+		a := <-results
+		a.discard()
+	}
+}
+
+// wrapCancel returns a's response with a body that cancels the attempt's
+// context once closed, keeping the context alive while the body is read.
+func wrapCancel(a attempt) *http.Response {
+	a.resp.Body = &cancelBody{ReadCloser: a.resp.Body, cancel: a.cancel}
+	return a.resp
+}
+
+// cancelBody cancels a context when the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels its attempt's context.
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
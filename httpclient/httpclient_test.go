@@ -0,0 +1,881 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+)
+
+func TestSSRFGuardOptions_Blocked(t *testing.T) {
+	opts := SSRFGuardOptions{Allow: []netip.Prefix{netip.MustParsePrefix("10.1.2.0/24")}}
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"10.0.0.5", true},
+		{"10.1.2.3", false}, // allow-listed
+		{"172.20.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"fd00:ec2::254", true},
+		{"fe80::1", true},
+		{"64:ff9b::a9fe:a9fe", true},               // NAT64 169.254.169.254
+		{"64:ff9b::808:808", false},                // NAT64 8.8.8.8
+		{"2002:a9fe:a9fe::", true},                 // 6to4 169.254.169.254
+		{"2002:a00:5::1", true},                    // 6to4 10.0.0.5
+		{"2001:0:4136:e378::8000:5601:5601", true}, // Teredo client 169.254.169.254 (inverted)
+		{"2001:0:4136:e378::f7f7:f7f7", false},     // Teredo client 8.8.8.8
+		{"64:ff9b::a01:203", false},                // NAT64 10.1.2.3, allow-listed
+		{"8.8.8.8", false},
+		{"2606:4700:4700::1111", false},
+	}
+	for _, tt := range tests {
+		if got := opts.blocked(netip.MustParseAddr(tt.addr)); got != tt.blocked {
+			t.Errorf("blocked(%s) = %v, want %v", tt.addr, got, tt.blocked)
+		}
+	}
+}
+
+func TestSSRFGuardTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: NewSSRFGuardTransport(SSRFGuardOptions{})}
+	for _, url := range []string{ts.URL, strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)} {
+		_, err := client.Get(url)
+		if !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("GET %s: error = %v, want ErrBlockedAddress", url, err)
+		}
+	}
+
+	client = &http.Client{Transport: NewSSRFGuardTransport(SSRFGuardOptions{
+		Allow: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+	})}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("allow-listed address: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestCachingResolver_Hosts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	r := NewCachingResolver(ResolverOptions{
+		Hosts: map[string][]netip.Addr{"api.internal": {netip.MustParseAddr("127.0.0.1")}},
+	})
+	client := &http.Client{Transport: &http.Transport{DialContext: r.DialContext(nil)}}
+	resp, err := client.Get(strings.Replace(ts.URL, "127.0.0.1", "api.internal", 1))
+	if err != nil {
+		t.Fatalf("GET via override: %v", err)
+	}
+	resp.Body.Close()
+	if s := r.Stats(); s.Hits != 1 || s.Lookups != 0 {
+		t.Errorf("Stats() = %+v, want 1 hit and no lookups", s)
+	}
+}
+
+func TestCachingResolver_NegativeCaching(t *testing.T) {
+	var dials int
+	now := time.Now()
+	r := NewCachingResolver(ResolverOptions{
+		NegativeTTL: time.Second,
+		Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				dials++
+				return nil, errors.New("no DNS in tests")
+			},
+		},
+	})
+	r.now = func() time.Time { return now }
+
+	for range 2 {
+		if _, err := r.LookupHost(context.Background(), "svc.example.test"); err == nil {
+			t.Fatal("LookupHost succeeded, want error")
+		}
+	}
+	if s := r.Stats(); s.Lookups != 1 || s.Failures != 1 || s.Hits != 1 {
+		t.Errorf("Stats() = %+v, want 1 lookup, 1 failure and 1 hit", s)
+	}
+	if dials == 0 {
+		t.Error("resolver was never dialled")
+	}
+
+	now = now.Add(2 * time.Second)
+	r.LookupHost(context.Background(), "svc.example.test")
+	if s := r.Stats(); s.Lookups != 2 {
+		t.Errorf("Lookups after NegativeTTL = %d, want 2", s.Lookups)
+	}
+}
+
+func TestCachingResolver_IPLiteral(t *testing.T) {
+	r := NewCachingResolver(ResolverOptions{})
+	addrs, err := r.LookupHost(context.Background(), "::1")
+	if err != nil || len(addrs) != 1 || addrs[0] != netip.IPv6Loopback() {
+		t.Errorf("LookupHost(::1) = %v, %v", addrs, err)
+	}
+	if s := r.Stats(); s != (ResolverStats{}) {
+		t.Errorf("Stats() = %+v, want zero for literals", s)
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	tr := NewTransport(config.ClientConfig{MaxIdleConnsPerHost: 32, IdleConnTimeout: 5, TLSSessionCacheSize: 8})
+	if tr.MaxIdleConnsPerHost != 32 || tr.IdleConnTimeout != 5*time.Second {
+		t.Errorf("pool settings = %d, %v; want 32, 5s", tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+	}
+	if tr.TLSClientConfig == nil || tr.TLSClientConfig.ClientSessionCache == nil {
+		t.Error("TLS session cache not set")
+	}
+	if http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost == 32 {
+		t.Error("NewTransport modified http.DefaultTransport")
+	}
+}
+
+func TestConnTracker(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer ts.Close()
+
+	tracker := NewConnTracker("upstream")
+	client := &http.Client{Transport: tracker.RoundTripper(ts.Client().Transport)}
+	for range 3 {
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	s := tracker.Stats()
+	if s.Requests != 3 || s.Dials != 1 || s.Reused != 2 || s.TLSHandshakes != 1 {
+		t.Errorf("Stats() = %+v, want 3 requests, 1 dial, 2 reused, 1 handshake", s)
+	}
+	if s.TLSHandshakeTime <= 0 {
+		t.Error("TLSHandshakeTime not recorded")
+	}
+}
+
+func TestHedgingTransport(t *testing.T) {
+	cancelled := make(chan struct{}, 16)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			cancelled <- struct{}{}
+		case <-time.After(2 * time.Second):
+			io.WriteString(w, "slow")
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "fast")
+	}))
+	defer fast.Close()
+
+	slowHost := strings.TrimPrefix(slow.URL, "http://")
+	fastHost := strings.TrimPrefix(fast.URL, "http://")
+	hedger := NewHedgingTransport(nil, HedgeOptions{
+		Delay:    20 * time.Millisecond,
+		Replicas: []string{slowHost, fastHost},
+		Logger:   slog.New(slog.DiscardHandler),
+	})
+	client := &http.Client{Transport: hedger}
+
+	resp, err := client.Get(slow.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "fast" {
+		t.Errorf("body = %q, want the hedge's response", body)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("losing attempt was not cancelled")
+	}
+	if s := hedger.Stats(); s.Requests != 1 || s.Hedges != 1 || s.HedgeWins != 1 {
+		t.Errorf("Stats() = %+v, want 1 request, hedge and win", s)
+	}
+
+	// POST without Idempotency-Key is never hedged.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, slow.URL, strings.NewReader("x"))
+	if _, err := client.Do(req); err == nil {
+		t.Error("POST was hedged to the fast replica")
+	}
+	if s := hedger.Stats(); s.Hedges != 1 {
+		t.Errorf("Hedges after POST = %d, want 1", s.Hedges)
+	}
+}
+
+func TestHedgingTransport_Budget(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	hedger := NewHedgingTransport(nil, HedgeOptions{
+		Delay:  time.Millisecond,
+		Budget: 0.01,
+		Logger: slog.New(slog.DiscardHandler),
+	})
+	client := &http.Client{Transport: hedger}
+	for range hedgeBurst + 2 {
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if s := hedger.Stats(); s.Hedges != hedgeBurst || s.Throttled != 2 {
+		t.Errorf("Stats() = %+v, want %d hedges and 2 throttled", s, hedgeBurst)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// closeTracker is a response body that records whether it was closed.
+type closeTracker struct {
+	io.Reader
+	closed atomic.Bool
+}
+
+func (b *closeTracker) Close() error {
+	b.closed.Store(true)
+	return nil
+}
+
+func TestHedgingTransport_FailedFirstAttempt(t *testing.T) {
+	loser := &closeTracker{Reader: strings.NewReader("error")}
+	next := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "primary" {
+			time.Sleep(30 * time.Millisecond)
+			return &http.Response{StatusCode: http.StatusInternalServerError, Body: loser}, nil
+		}
+		time.Sleep(60 * time.Millisecond)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("ok"))}, nil
+	})
+	hedger := NewHedgingTransport(next, HedgeOptions{
+		Delay:      10 * time.Millisecond,
+		Percentile: 0.5,
+		Replicas:   []string{"replica"},
+		Logger:     slog.New(slog.DiscardHandler),
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "http://primary/", nil)
+	resp, err := hedger.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want the hedge's 200", resp.StatusCode)
+	}
+	if !loser.closed.Load() {
+		t.Error("body of the failed attempt was not closed")
+	}
+	// The latency observed is the caller's, from before the hedge delay.
+	if got := hedger.latencies[0]; got < 70*time.Millisecond {
+		t.Errorf("observed latency = %v, want at least 70ms", got)
+	}
+}
+
+func TestCachingTransport(t *testing.T) {
+	var calls, conditional atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, "payload")
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	cache := NewCachingTransport(nil, CacheOptions{Logger: slog.New(slog.DiscardHandler)})
+	cache.now = func() time.Time { return now }
+	client := &http.Client{Transport: cache}
+	get := func() string {
+		t.Helper()
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if get() != "payload" || get() != "payload" {
+		t.Fatal("unexpected body")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("upstream calls = %d, want 1 (second request cached)", calls.Load())
+	}
+
+	now = now.Add(2 * time.Minute)
+	if got := get(); got != "payload" {
+		t.Errorf("body after revalidation = %q", got)
+	}
+	if calls.Load() != 2 || conditional.Load() != 1 {
+		t.Errorf("calls = %d, conditional = %d; want 2, 1", calls.Load(), conditional.Load())
+	}
+
+	// POST invalidates the cached response.
+	resp, err := client.Post(ts.URL, "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	get()
+	if calls.Load() != 4 || conditional.Load() != 1 {
+		t.Errorf("after POST: calls = %d, conditional = %d; want 4, 1", calls.Load(), conditional.Load())
+	}
+
+	s := cache.Stats()
+	if s.Hits != 1 || s.Revalidated != 1 || s.Misses != 2 {
+		t.Errorf("Stats() = %+v, want 1 hit, 1 revalidated, 2 misses", s)
+	}
+}
+
+func TestCachingTransport_StaleWhileRevalidate(t *testing.T) {
+	var calls atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header()["Date"] = nil // ages follow the test's clock only
+		w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+		fmt.Fprintf(w, "v%d", n)
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	var mu sync.Mutex
+	cache := NewCachingTransport(nil, CacheOptions{Logger: slog.New(slog.DiscardHandler)})
+	cache.now = func() time.Time { mu.Lock(); defer mu.Unlock(); return now }
+	client := &http.Client{Transport: cache}
+	get := func() string {
+		t.Helper()
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	get()
+	mu.Lock()
+	now = now.Add(5 * time.Second)
+	mu.Unlock()
+	if got := get(); got != "v1" {
+		t.Errorf("stale response = %q, want v1 served while revalidating", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for cache.Stats().Stores < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := get(); got != "v2" {
+		t.Errorf("after background revalidation = %q, want v2", got)
+	}
+	if s := cache.Stats(); s.Stale != 1 {
+		t.Errorf("Stale = %d, want 1", s.Stale)
+	}
+}
+
+func TestCachingTransport_Bypass(t *testing.T) {
+	var calls atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		switch r.URL.Path {
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		default:
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+		}
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: NewCachingTransport(nil, CacheOptions{})}
+	do := func(path, lang, auth string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if lang != "" {
+			req.Header.Set("Accept-Language", lang)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	tests := []struct {
+		name      string
+		requests  func()
+		wantCalls int64
+	}{
+		{"no-store", func() { do("/nostore", "", ""); do("/nostore", "", "") }, 2},
+		{"private in shared cache", func() { do("/private", "", ""); do("/private", "", "") }, 2},
+		{"authorization", func() { do("/auth", "", "Bearer a"); do("/auth", "", "Bearer b") }, 2},
+		{"vary mismatch", func() { do("/vary", "en", ""); do("/vary", "de", "") }, 2},
+		{"vary match", func() { do("/same", "en", ""); do("/same", "en", "") }, 1},
+	}
+	for _, tt := range tests {
+		calls.Store(0)
+		tt.requests()
+		if got := calls.Load(); got != tt.wantCalls {
+			t.Errorf("%s: upstream calls = %d, want %d", tt.name, got, tt.wantCalls)
+		}
+	}
+}
+
+func TestMemoryCacheStore_Eviction(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryCacheStore(2)
+	for _, key := range []string{"a", "b"} {
+		s.Set(ctx, key, &CachedResponse{})
+	}
+	s.Get(ctx, "a") // b is now least recently used
+	s.Set(ctx, "c", &CachedResponse{})
+	if _, ok, _ := s.Get(ctx, "b"); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	if _, ok, _ := s.Get(ctx, "a"); !ok {
+		t.Error("recently used entry was evicted")
+	}
+}
+
+func TestAuthTransport(t *testing.T) {
+	var gotAuth atomic.Value
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth.Store(r.Header.Get("Authorization"))
+	}))
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "https://")
+
+	tests := []struct {
+		name    string
+		targets map[string]Credentials
+		url     string
+		header  string
+		want    string
+	}{
+		{"host and port", map[string]Credentials{host: NewStaticToken("a")}, ts.URL, "", "Bearer a"},
+		{"host name", map[string]Credentials{"127.0.0.1": NewStaticToken("b")}, ts.URL, "", "Bearer b"},
+		{"other host", map[string]Credentials{"billing.internal": NewStaticToken("c")}, ts.URL, "", ""},
+		{"existing header kept", map[string]Credentials{host: NewStaticToken("d")}, ts.URL, "Basic eA==", "Basic eA=="},
+	}
+	for _, tt := range tests {
+		client := &http.Client{Transport: NewAuthTransport(ts.Client().Transport, AuthOptions{Targets: tt.targets})}
+		req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		resp.Body.Close()
+		if got := gotAuth.Load(); got != tt.want {
+			t.Errorf("%s: Authorization = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Credentials are not sent over plain HTTP by default.
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth.Store(r.Header.Get("Authorization"))
+	}))
+	defer plain.Close()
+	client := &http.Client{Transport: NewAuthTransport(nil, AuthOptions{
+		Targets: map[string]Credentials{"127.0.0.1": NewStaticToken("e")},
+	})}
+	resp, err := client.Get(plain.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := gotAuth.Load(); got != "" {
+		t.Errorf("plain HTTP: Authorization = %q, want none", got)
+	}
+}
+
+func TestCredentialsFor_Wildcard(t *testing.T) {
+	exact, wildcard := NewStaticToken("exact"), NewStaticToken("wildcard")
+	targets := map[string]Credentials{"a.svc.internal": exact, "*.internal": wildcard}
+	for host, want := range map[string]Credentials{
+		"a.svc.internal":      exact,
+		"b.svc.internal:8443": wildcard,
+		"internal":            nil,
+		"example.com":         nil,
+	} {
+		if got := credentialsFor(targets, &url.URL{Host: host}); got != want {
+			t.Errorf("credentialsFor(%s) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	var fetches atomic.Int64
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		r.ParseForm()
+		if id != "svc" || secret != "s3cret" || r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "read write" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		n := fetches.Add(1)
+		fmt.Fprintf(w, `{"access_token":"tok%d","token_type":"Bearer","expires_in":300}`, n)
+	}))
+	defer tokenServer.Close()
+
+	creds := NewClientCredentials(ClientCredentialsConfig{
+		TokenURL:     tokenServer.URL,
+		ClientID:     "svc",
+		ClientSecret: "s3cret",
+		Scopes:       []string{"read", "write"},
+	}).(*clientCredentials)
+	now := time.Now()
+	creds.now = func() time.Time { return now }
+
+	authorize := func() string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "https://api.internal/", nil)
+		if err := creds.Authorize(req); err != nil {
+			t.Fatal(err)
+		}
+		return req.Header.Get("Authorization")
+	}
+	if a, b := authorize(), authorize(); a != "Bearer tok1" || b != a {
+		t.Errorf("tokens = %q, %q; want tok1 reused", a, b)
+	}
+	now = now.Add(280 * time.Second) // within 30s of expiry
+	if got := authorize(); got != "Bearer tok2" {
+		t.Errorf("token near expiry = %q, want tok2", got)
+	}
+	creds.invalidate()
+	if got := authorize(); got != "Bearer tok3" {
+		t.Errorf("token after invalidate = %q, want tok3", got)
+	}
+
+	bad := NewClientCredentials(ClientCredentialsConfig{TokenURL: tokenServer.URL, ClientID: "svc", ClientSecret: "wrong"})
+	if err := bad.Authorize(httptest.NewRequest(http.MethodGet, "/", nil)); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("bad secret: err = %v, want 401 error", err)
+	}
+}
+
+func TestSignedJWT(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	creds := NewSignedJWT(JWTConfig{Issuer: "orders", Audience: "billing", KeyID: "k1", Key: priv, TTL: time.Minute})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := creds.Authorize(req); err != nil {
+		t.Fatal(err)
+	}
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %q is not a JWS", token)
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if !ed25519.Verify(pub, []byte(parts[0]+"."+parts[1]), sig) {
+		t.Error("signature does not verify")
+	}
+	var header, claims map[string]any
+	h, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	c, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	json.Unmarshal(h, &header)
+	json.Unmarshal(c, &claims)
+	if header["alg"] != "EdDSA" || header["kid"] != "k1" {
+		t.Errorf("header = %v", header)
+	}
+	if claims["iss"] != "orders" || claims["aud"] != "billing" || claims["exp"].(float64)-claims["iat"].(float64) != 60 {
+		t.Errorf("claims = %v", claims)
+	}
+
+	hs := NewSignedJWT(JWTConfig{Key: []byte("shared")})
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	hs.Authorize(req)
+	parts = strings.Split(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "), ".")
+	mac := hmac.New(sha256.New, []byte("shared"))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if got := base64.RawURLEncoding.EncodeToString(mac.Sum(nil)); got != parts[2] {
+		t.Error("HS256 signature does not verify")
+	}
+}
+
+type testWidget struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestClient(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/widgets/1":
+			if r.Header.Get("X-Request-Timeout") == "" || r.Header.Get("User-Agent") != "test" {
+				t.Errorf("headers = %v, want timeout and User-Agent", r.Header)
+			}
+			json.NewEncoder(w).Encode(testWidget{ID: 1, Name: "gear"})
+		case "/v1/widgets":
+			var in testWidget
+			json.NewDecoder(r.Body).Decode(&in)
+			in.ID = 2
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(in)
+		case "/v1/widgets/404":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"type":"about:blank","title":"Not Found","detail":"no widget 404"}`)
+		case "/v1/broken":
+			w.WriteHeader(http.StatusBadGateway)
+			io.WriteString(w, `{"error":"upstream down"}`)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient(ClientOptions{
+		BaseURL: ts.URL + "/v1",
+		Header:  http.Header{"User-Agent": {"test"}},
+		Timeout: time.Second,
+	})
+	ctx := context.Background()
+
+	w, err := Get[testWidget](ctx, c, "/widgets/1", nil)
+	if err != nil || w != (testWidget{ID: 1, Name: "gear"}) {
+		t.Errorf("Get = %+v, %v", w, err)
+	}
+	w, err = Post[testWidget](ctx, c, "widgets", &RequestOptions{Body: testWidget{Name: "cog"}})
+	if err != nil || w != (testWidget{ID: 2, Name: "cog"}) {
+		t.Errorf("Post = %+v, %v", w, err)
+	}
+
+	_, err = Get[testWidget](ctx, c, "/widgets/404", nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Detail != "no widget 404" || !IsStatus(err, http.StatusNotFound) {
+		t.Errorf("404 error = %#v", err)
+	}
+	_, err = Get[testWidget](ctx, c, "/broken", nil)
+	if err == nil || err.Error() != "502 Bad Gateway: upstream down" {
+		t.Errorf("502 error = %v", err)
+	}
+}
+
+func TestItems(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "", "1":
+			if r.URL.Query().Get("color") != "red" {
+				t.Errorf("first page query = %s, want color=red", r.URL.RawQuery)
+			}
+			w.Header().Set("Link", `</widgets?page=2>; rel="next", </widgets?page=9>; rel="last"`)
+			io.WriteString(w, `[{"id":1},{"id":2}]`)
+		case "2":
+			io.WriteString(w, `[{"id":3}]`)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient(ClientOptions{BaseURL: ts.URL})
+	var ids []int
+	for w, err := range Items[testWidget](context.Background(), c, "/widgets", &RequestOptions{Query: url.Values{"color": {"red"}}}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, w.ID)
+	}
+	if fmt.Sprint(ids) != "[1 2 3]" {
+		t.Errorf("ids = %v, want [1 2 3]", ids)
+	}
+}
+
+func TestItems_SelfLink(t *testing.T) {
+	var calls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Link", `</widgets>; rel="next"`)
+		io.WriteString(w, `[{"id":1}]`)
+	}))
+	defer ts.Close()
+
+	c := NewClient(ClientOptions{BaseURL: ts.URL})
+	n := 0
+	for _, err := range Items[testWidget](context.Background(), c, "/widgets", nil) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 1 || calls.Load() != 1 {
+		t.Errorf("items = %d, requests = %d, want 1 and 1", n, calls.Load())
+	}
+}
+
+func TestItems_CrossOriginLink(t *testing.T) {
+	var leaked atomic.Bool
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked.Store(true)
+		io.WriteString(w, `[]`)
+	}))
+	defer other.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "<"+other.URL+"/steal>; rel=\"next\"")
+		io.WriteString(w, `[{"id":1}]`)
+	}))
+	defer ts.Close()
+
+	c := NewClient(ClientOptions{BaseURL: ts.URL, Header: http.Header{"Authorization": {"Bearer s3cr3t-pager"}}})
+	var errs []error
+	for _, err := range Items[testWidget](context.Background(), c, "/widgets", nil) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "/steal") {
+		t.Errorf("errors = %v, want one refusing the next page", errs)
+	}
+	if leaked.Load() {
+		t.Error("next page on another host was requested")
+	}
+}
+
+func TestSigningTransport(t *testing.T) {
+	key := middleware.HMACKey{ID: "2026-10", Secret: []byte("webhook secret")}
+	var got string
+	receiver := middleware.CreateStack(
+		middleware.NewHMACVerifier(middleware.HMACOptions{Keys: []middleware.HMACKey{key}}),
+		middleware.NewReplayProtection(middleware.ReplayOptions{}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	}))
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	client := &http.Client{Transport: NewSigningTransport(nil, key)}
+	for i := range 2 {
+		resp, err := client.Post(srv.URL, "application/json", strings.NewReader(`{"n":1}`))
+		if err != nil {
+			t.Fatalf("Post() error = %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200 (fresh nonce each time)", i, resp.StatusCode)
+		}
+	}
+	if got != `{"n":1}` {
+		t.Errorf("receiver read %q, want the signed body", got)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{}`))
+	req.Header.Set(middleware.NonceHeader, "fixed")
+	for _, want := range []int{http.StatusOK, http.StatusConflict} {
+		resp, err := client.Do(req.Clone(context.Background()))
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("status with caller nonce = %d, want %d", resp.StatusCode, want)
+		}
+		req.Body, _ = req.GetBody()
+	}
+}
+
+func TestCachingResolver_ConcurrentLookups(t *testing.T) {
+	var dials atomic.Int64
+	r := NewCachingResolver(ResolverOptions{
+		Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				dials.Add(1)
+				time.Sleep(20 * time.Millisecond)
+				return nil, errors.New("no DNS in tests")
+			},
+		},
+	})
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if _, err := r.LookupHost(context.Background(), "slow.example.test"); err == nil {
+				t.Error("LookupHost succeeded, want error")
+			}
+		})
+	}
+	wg.Wait()
+	if s := r.Stats(); s.Lookups != 1 || s.Hits != 19 {
+		t.Errorf("Stats() = %+v, want 1 shared lookup and 19 hits", s)
+	}
+}
+
+func TestCachingResolver_Sweep(t *testing.T) {
+	now := time.Now()
+	r := NewCachingResolver(ResolverOptions{
+		NegativeTTL: time.Second,
+		Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return nil, errors.New("no DNS in tests")
+			},
+		},
+	})
+	r.now = func() time.Time { return now }
+
+	for i := range 10 {
+		r.LookupHost(context.Background(), fmt.Sprintf("host%d.example.test", i))
+	}
+	now = now.Add(2 * time.Minute)
+	r.LookupHost(context.Background(), "fresh.example.test")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) != 1 {
+		t.Errorf("entries after sweep = %d, want only the fresh lookup", len(r.entries))
+	}
+}
@@ -0,0 +1,234 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ResolverOptions configures a CachingResolver. Zero values are defaults.
+type ResolverOptions struct {
+	// TTL is how long successful lookups are cached. The standard library
+	// resolver does not report record TTLs, so one TTL applies to every
+	// host; keep it at or below the shortest TTL of the hosts called.
+	// Defaults to 30 seconds.
+	TTL time.Duration
+	// NegativeTTL is how long failed lookups are cached, so a missing host
+	// is not looked up again on every request. Defaults to 5 seconds.
+	NegativeTTL time.Duration
+	// Hosts maps host names to fixed addresses that are used instead of
+	// DNS, for example to pin a host during a migration or in tests.
+	Hosts map[string][]netip.Addr
+	// Resolver performs the lookups. Defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+}
+
+// ResolverStats is a snapshot of a CachingResolver's activity.
+type ResolverStats struct {
+	// Hits is the number of lookups answered from the cache or Hosts.
+	Hits int64
+	// Lookups is the number of DNS lookups performed.
+	Lookups int64
+	// Failures is the number of DNS lookups that failed.
+	Failures int64
+	// LookupTime is the total time spent in DNS lookups; divide by Lookups
+	// for the mean latency.
+	LookupTime time.Duration
+	// MaxLookupTime is the slowest DNS lookup so far.
+	MaxLookupTime time.Duration
+}
+
+// resolverEntry is a cached lookup result. ready is closed once addrs and
+// err are set, so concurrent lookups of one host share a single query.
+type resolverEntry struct {
+	ready   chan struct{}
+	addrs   []netip.Addr
+	err     error
+	expires time.Time
+}
+
+// CachingResolver caches DNS lookups for outbound connections, removing
+// repeated lookups from the request path. Use its DialContext as an
+// http.Transport's DialContext. A CachingResolver is safe for concurrent use.
+type CachingResolver struct {
+	opts ResolverOptions
+	now  func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*resolverEntry
+	lastSweep time.Time
+
+	hits, lookups, failures atomic.Int64
+	lookupTime, maxLookup   atomic.Int64
+}
+
+// NewCachingResolver returns a CachingResolver configured by opts.
+func NewCachingResolver(opts ResolverOptions) *CachingResolver {
+	if opts.TTL <= 0 {
+		opts.TTL = 30 * time.Second
+	}
+	if opts.NegativeTTL <= 0 {
+		opts.NegativeTTL = 5 * time.Second
+	}
+	if opts.Resolver == nil {
+		opts.Resolver = net.DefaultResolver
+	}
+	return &CachingResolver{opts: opts, now: time.Now, entries: make(map[string]*resolverEntry)}
+}
+
+// LookupHost returns the addresses of host, from Hosts, the cache or DNS.
+// IP address literals are returned as they are.
+func (r *CachingResolver) LookupHost(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if addrs, ok := r.opts.Hosts[host]; ok {
+		r.hits.Add(1)
+		return addrs, nil
+	}
+
+	r.mu.Lock()
+	now := r.now()
+	if now.Sub(r.lastSweep) > time.Minute {
+		r.sweep(now)
+	}
+	e, ok := r.entries[host]
+	// expires is written by the lookup before it closes ready, so it may only
+	// be read once ready is closed.
+	if ok && isClosed(e.ready) && !now.Before(e.expires) {
+		ok = false
+	}
+	if ok {
+		r.mu.Unlock()
+		r.hits.Add(1)
+		select {
+		case <-e.ready:
+			return e.addrs, e.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	e = &resolverEntry{ready: make(chan struct{})}
+	r.entries[host] = e
+	r.mu.Unlock()
+
+	// The lookup is shared, so one caller's cancellation must not fail it
+	// for the others.
+	start := r.now()
+	e.addrs, e.err = r.opts.Resolver.LookupNetIP(context.WithoutCancel(ctx), "ip", host)
+	elapsed := r.now().Sub(start)
+	r.lookups.Add(1)
+	r.lookupTime.Add(int64(elapsed))
+	for {
+		prev := r.maxLookup.Load()
+		if int64(elapsed) <= prev || r.maxLookup.CompareAndSwap(prev, int64(elapsed)) {
+			break
+		}
+	}
+	ttl := r.opts.TTL
+	if e.err != nil {
+		r.failures.Add(1)
+		ttl = r.opts.NegativeTTL
+	}
+	for i, addr := range e.addrs {
+		e.addrs[i] = addr.Unmap()
+	}
+	e.expires = r.now().Add(ttl)
+	close(e.ready)
+	return e.addrs, e.err
+}
+
+// sweep discards expired entries, so that hosts looked up once, such as
+// failed lookups of user-supplied names, do not stay cached forever. r.mu
+// must be held.
+func (r *CachingResolver) sweep(now time.Time) {
+	for host, e := range r.entries {
+		if isClosed(e.ready) && !now.Before(e.expires) {
+			delete(r.entries, host)
+		}
+	}
+	r.lastSweep = now
+}
+
+// DialContext returns a dial function for http.Transport.DialContext that
+// resolves host names through r and dials the addresses with d in turn until
+// one connects. Pass NewSSRFGuardDialer's dialer to combine caching with the
+// SSRF guard. A nil d means a zero net.Dialer.
+func (r *CachingResolver) DialContext(d *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if d == nil {
+		d = &net.Dialer{}
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, portStr, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			return nil, &net.AddrError{Err: "invalid port", Addr: address}
+		}
+		addrs, err := r.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var errs []error
+		for _, addr := range addrs {
+			if network == "tcp4" && !addr.Is4() || network == "tcp6" && !addr.Is6() {
+				continue
+			}
+			conn, err := d.DialContext(ctx, network, netip.AddrPortFrom(addr, uint16(port)).String())
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if len(errs) == 0 {
+			return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+		}
+		return nil, errors.Join(errs...)
+	}
+}
+
+// Stats returns the resolver's activity so far.
+func (r *CachingResolver) Stats() ResolverStats {
+	return ResolverStats{
+		Hits:          r.hits.Load(),
+		Lookups:       r.lookups.Load(),
+		Failures:      r.failures.Load(),
+		LookupTime:    time.Duration(r.lookupTime.Load()),
+		MaxLookupTime: time.Duration(r.maxLookup.Load()),
+	}
+}
+
+// LogValue implements slog.LogValuer, logging the resolver's statistics.
+func (r *CachingResolver) LogValue() slog.Value {
+	s := r.Stats()
+	return slog.GroupValue(
+		slog.Int64("hits", s.Hits),
+		slog.Int64("lookups", s.Lookups),
+		slog.Int64("failures", s.Failures),
+		slog.Duration("lookup_time", s.LookupTime),
+		slog.Duration("max_lookup_time", s.MaxLookupTime),
+	)
+}
+
+// isClosed reports whether ch has been closed.
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
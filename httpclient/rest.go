@@ -0,0 +1,290 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+)
+
+// ClientOptions configures NewClient. Zero values are defaults.
+type ClientOptions struct {
+	// BaseURL is the API's root URL; request paths are resolved against it.
+	// Required.
+	BaseURL string
+	// HTTPClient sends the requests. Defaults to http.DefaultClient; set
+	// one with a transport from this package to add SSRF protection,
+	// caching, hedging or credentials.
+	HTTPClient *http.Client
+	// Header is sent with every request, e.g. a User-Agent.
+	Header http.Header
+	// Timeout bounds each call, including decoding the response, unless
+	// the context has an earlier deadline. Zero means no timeout.
+	Timeout time.Duration
+	// MaxResponseSize is the largest response body decoded, in bytes.
+	// Defaults to 10 MiB.
+	MaxResponseSize int64
+}
+
+// Client calls a JSON API. Use it with the generic functions Get, Post, Do
+// and Items. A Client is safe for concurrent use.
+type Client struct {
+	base *url.URL
+	opts ClientOptions
+}
+
+// NewClient returns a Client for the API at opts.BaseURL. It panics if
+// BaseURL is not an absolute URL.
+func NewClient(opts ClientOptions) *Client {
+	base, err := url.Parse(opts.BaseURL)
+	if err != nil || !base.IsAbs() {
+		panic(fmt.Sprintf("httpclient: invalid ClientOptions.BaseURL %q", opts.BaseURL))
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.MaxResponseSize <= 0 {
+		opts.MaxResponseSize = 10 << 20
+	}
+	return &Client{base: base, opts: opts}
+}
+
+// RequestOptions adds to a single call. A nil *RequestOptions is valid.
+type RequestOptions struct {
+	// Query is added to the URL.
+	Query url.Values
+	// Header is sent with the request, after the client's Header.
+	Header http.Header
+	// Body is encoded as the JSON request body. Nil means no body.
+	Body any
+}
+
+// APIError is returned for responses with a status of 400 or above. It
+// parses RFC 9457 problem details and {"error": "..."} bodies.
+type APIError struct {
+	StatusCode int
+	// Type, Title and Detail come from a problem details body, or Detail
+	// from an "error" or "message" field.
+	Type   string
+	Title  string
+	Detail string
+	// Body is the start of the raw response body.
+	Body []byte
+}
+
+// Error implements error.
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	switch {
+	case e.Detail != "":
+		msg += ": " + e.Detail
+	case e.Title != "":
+		msg += ": " + e.Title
+	}
+	return msg
+}
+
+// IsStatus reports whether err is an *APIError with the given status code.
+func IsStatus(err error, code int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == code
+}
+
+// Get sends a GET request for path and decodes the JSON response into a T.
+func Get[T any](ctx context.Context, c *Client, path string, opts *RequestOptions) (T, error) {
+	return Do[T](ctx, c, http.MethodGet, path, opts)
+}
+
+// Post sends opts.Body as JSON to path and decodes the JSON response into a T.
+func Post[T any](ctx context.Context, c *Client, path string, opts *RequestOptions) (T, error) {
+	return Do[T](ctx, c, http.MethodPost, path, opts)
+}
+
+// Do sends a request and decodes the JSON response into a T. Responses with
+// no content (204, or an empty body) leave T's zero value. Error statuses
+// return an *APIError. The request carries the remaining time of ctx's
+// deadline in X-Request-Timeout (see middleware.NewDeadline) and the request
+// ID of ctx, if any.
+func Do[T any](ctx context.Context, c *Client, method, path string, opts *RequestOptions) (T, error) {
+	var v T
+	_, err := c.send(ctx, method, c.resolve(path, opts), opts, &v)
+	return v, err
+}
+
+// Items iterates over a paginated collection: each page is decoded as a JSON
+// array of T, and the next page is fetched from the response's Link header
+// (rel="next") until there is none, or until it links to a page already
+// fetched. Because every page is sent the client's and opts' headers, a next
+// link to another scheme or host than the client's BaseURL is refused with
+// an error. Iteration stops after yielding an error.
+func Items[T any](ctx context.Context, c *Client, path string, opts *RequestOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		next := c.resolve(path, opts)
+		seen := make(map[string]bool)
+		for next != "" && !seen[next] {
+			seen[next] = true
+			var page []T
+			resp, err := c.send(ctx, http.MethodGet, next, opts, &page)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			for _, item := range page {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			u := nextLink(resp)
+			if u == nil {
+				return
+			}
+			if !strings.EqualFold(u.Scheme, c.base.Scheme) || !strings.EqualFold(u.Host, c.base.Host) {
+				yield(zero, fmt.Errorf("next page %s is not on %s://%s", u.Redacted(), c.base.Scheme, c.base.Host))
+				return
+			}
+			next = u.String()
+		}
+	}
+}
+
+// resolve returns the absolute URL for path with opts.Query added.
+func (c *Client) resolve(path string, opts *RequestOptions) string {
+	u := c.base.ResolveReference(&url.URL{Path: strings.TrimPrefix(path, "/")})
+	if opts != nil && len(opts.Query) > 0 {
+		q := u.Query()
+		for name, values := range opts.Query {
+			q[name] = append(q[name], values...)
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// send performs one request to target and decodes its response into out.
+func (c *Client) send(ctx context.Context, method, target string, opts *RequestOptions, out any) (*http.Response, error) {
+	if c.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+
+	var body io.Reader
+	if opts != nil && opts.Body != nil {
+		b, err := json.Marshal(opts.Body)
+		if err != nil {
+			return nil, fmt.Errorf("encoding request body: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range c.opts.Header {
+		req.Header[name] = values
+	}
+	if opts != nil {
+		for name, values := range opts.Header {
+			req.Header[name] = values
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if id, ok := middleware.RequestIDFromContext(ctx); ok && req.Header.Get(middleware.RequestIDHeader) == "" {
+		req.Header.Set(middleware.RequestIDHeader, id)
+	}
+	middleware.SetTimeoutHeader(req)
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, c.opts.MaxResponseSize+1))
+	if err != nil {
+		return resp, fmt.Errorf("reading response: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		return resp, parseAPIError(resp.StatusCode, data)
+	}
+	if int64(len(data)) > c.opts.MaxResponseSize {
+		return resp, fmt.Errorf("response larger than %d bytes", c.opts.MaxResponseSize)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return resp, nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return resp, fmt.Errorf("decoding %s %s response: %w", method, req.URL.Path, err)
+	}
+	return resp, nil
+}
+
+// parseAPIError builds an APIError from an error response body.
+func parseAPIError(status int, body []byte) *APIError {
+	e := &APIError{StatusCode: status, Body: body[:min(len(body), 4<<10)]}
+	var fields struct {
+		Type    string `json:"type"`
+		Title   string `json:"title"`
+		Detail  string `json:"detail"`
+		Error   any    `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &fields) != nil {
+		return e
+	}
+	e.Type, e.Title, e.Detail = fields.Type, fields.Title, fields.Detail
+	if e.Detail == "" {
+		if s, ok := fields.Error.(string); ok {
+			e.Detail = s
+		} else {
+			e.Detail = fields.Message
+		}
+	}
+	return e
+}
+
+// nextLink returns the absolute URL of resp's Link rel="next", or nil.
+func nextLink(resp *http.Response) *url.URL {
+	for _, header := range resp.Header.Values("Link") {
+		for link := range strings.SplitSeq(header, ",") {
+			target, params, ok := strings.Cut(link, ";")
+			if !ok {
+				continue
+			}
+			target = strings.Trim(strings.TrimSpace(target), "<>")
+			for param := range strings.SplitSeq(params, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(name, "rel") || !slices.ContainsFunc(strings.Fields(strings.Trim(value, `"`)), isNext) {
+					continue
+				}
+				u, err := resp.Request.URL.Parse(target)
+				if err != nil {
+					return nil
+				}
+				return u
+			}
+		}
+	}
+	return nil
+}
+
+// isNext reports whether a link relation type is "next".
+func isNext(rel string) bool {
+	return strings.EqualFold(rel, "next")
+}
@@ -0,0 +1,61 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+)
+
+// NewSigningTransport returns a transport that signs every request with
+// middleware.SignRequest, for sending webhooks and other requests to
+// receivers protected by middleware.NewHMACVerifier. Each request is given a
+// random nonce (middleware.NonceHeader) unless it already has one, so that
+// receivers using middleware.NewReplayProtection accept it exactly once.
+//
+// Requests are signed with every key in keys, in order. During a rotation,
+// sign with both the new and the old key until all receivers accept the new
+// one. The body is read in full to sign it.
+//
+// A nil next means http.DefaultTransport. NewSigningTransport panics if keys
+// is empty.
+func NewSigningTransport(next http.RoundTripper, keys ...middleware.HMACKey) http.RoundTripper {
+	if len(keys) == 0 {
+		panic("httpclient: NewSigningTransport requires at least one key")
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		var body []byte
+		if req.Body != nil && req.Body != http.NoBody {
+			var err error
+			body, err = io.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("httpclient: reading request body to sign: %w", err)
+			}
+		}
+
+		signed := req.Clone(req.Context())
+		signed.Header = req.Header.Clone()
+		if signed.Header.Get(middleware.NonceHeader) == "" {
+			var b [16]byte
+			rand.Read(b[:])
+			signed.Header.Set(middleware.NonceHeader, hex.EncodeToString(b[:]))
+		}
+		middleware.SignRequest(signed, body, keys...)
+		if body != nil {
+			signed.Body = io.NopCloser(bytes.NewReader(body))
+			signed.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
+			}
+			signed.ContentLength = int64(len(body))
+		}
+		return next.RoundTrip(signed)
+	})
+}
@@ -0,0 +1,132 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned, wrapped, when a connection to an internal
+// address is refused by the SSRF guard.
+var ErrBlockedAddress = errors.New("httpclient: connection to blocked address")
+
+// blockedPrefixes are the address ranges that are not publicly routable and
+// so must not be reachable through user-supplied URLs.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this" network
+	netip.MustParsePrefix("10.0.0.0/8"),     // private
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("127.0.0.0/8"),    // loopback
+	netip.MustParsePrefix("169.254.0.0/16"), // link-local, cloud metadata
+	netip.MustParsePrefix("172.16.0.0/12"),  // private
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("192.168.0.0/16"), // private
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("224.0.0.0/4"),    // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, broadcast
+	netip.MustParsePrefix("::/128"),         // unspecified
+	netip.MustParsePrefix("::1/128"),        // loopback
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("fc00::/7"),       // unique local, including fd00:ec2::254
+	netip.MustParsePrefix("fe80::/10"),      // link-local
+	netip.MustParsePrefix("ff00::/8"),       // multicast
+	netip.MustParsePrefix("2001:db8::/32"),  // documentation
+	netip.MustParsePrefix("100::/64"),       // discard
+}
+
+// SSRFGuardOptions configures the SSRF guard. Zero values are defaults.
+type SSRFGuardOptions struct {
+	// Allow lists address ranges that may be reached even though they are
+	// blocked by default, such as an internal service the application is
+	// meant to call.
+	Allow []netip.Prefix
+	// Dialer is the dialer whose settings (timeouts, keep-alive) are used.
+	// Its Control function, if any, still runs after the guard's check.
+	// Defaults to a dialer with a 30 second timeout and keep-alive.
+	Dialer *net.Dialer
+}
+
+// blocked reports whether connections to addr are refused under opts.
+func (opts SSRFGuardOptions) blocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range opts.Allow {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if v4, ok := embeddedIPv4(addr); ok {
+		return opts.blocked(v4)
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Translation prefixes whose addresses carry an IPv4 address that the
+// network delivers to.
+var (
+	nat64Prefix  = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFour    = netip.MustParsePrefix("2002::/16")
+	teredoPrefix = netip.MustParsePrefix("2001::/32")
+)
+
+// embeddedIPv4 returns the IPv4 address embedded in a NAT64, 6to4 or Teredo
+// address, so that 64:ff9b::a9fe:a9fe is checked as 169.254.169.254.
+func embeddedIPv4(addr netip.Addr) (netip.Addr, bool) {
+	b := addr.As16()
+	switch {
+	case nat64Prefix.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[12:16])), true
+	case sixToFour.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[2:6])), true
+	case teredoPrefix.Contains(addr):
+		// The Teredo client address is stored inverted.
+		return netip.AddrFrom4([4]byte{^b[12], ^b[13], ^b[14], ^b[15]}), true
+	}
+	return netip.Addr{}, false
+}
+
+// NewSSRFGuardDialer returns a dialer that refuses to connect to blocked
+// addresses. The check runs on each resolved address just before it is
+// dialled, so DNS answers cannot smuggle an internal address past it.
+func NewSSRFGuardDialer(opts SSRFGuardOptions) *net.Dialer {
+	var d net.Dialer
+	if opts.Dialer != nil {
+		d = *opts.Dialer
+	} else {
+		d = net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	}
+	next := d.Control
+	d.Control = func(network, address string, c syscall.RawConn) error {
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+		}
+		if opts.blocked(addrPort.Addr()) {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, addrPort.Addr())
+		}
+		if next != nil {
+			return next(network, address, c)
+		}
+		return nil
+	}
+	return &d
+}
+
+// NewSSRFGuardTransport returns a transport, based on
+// http.DefaultTransport's settings, that dials through NewSSRFGuardDialer.
+// Proxies from the environment are not used, since the guard could not
+// check the final destination of a proxied request.
+func NewSSRFGuardTransport(opts SSRFGuardOptions) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = NewSSRFGuardDialer(opts).DialContext
+	return t
+}
@@ -0,0 +1,143 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+)
+
+// NewTransport returns a transport, based on http.DefaultTransport's
+// settings, with its connection pool and TLS session cache sized by cfg.
+// Set its DialContext to use the SSRF guard or a CachingResolver.
+func NewTransport(cfg config.ClientConfig) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = cfg.MaxIdleConns
+	t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	t.MaxConnsPerHost = cfg.MaxConnsPerHost
+	t.IdleConnTimeout = time.Duration(cfg.IdleConnTimeout) * time.Second
+	t.TLSHandshakeTimeout = time.Duration(cfg.TLSHandshakeTimeout) * time.Second
+	if cfg.TLSSessionCacheSize > 0 {
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(cfg.TLSSessionCacheSize)
+	}
+	return t
+}
+
+// ConnStats is a snapshot of the connections used by requests through a
+// ConnTracker. Its names follow server.ConnStats.
+type ConnStats struct {
+	// Requests is the number of requests that obtained a connection.
+	Requests int64
+	// Dials is the number of connections dialled.
+	Dials int64
+	// DialErrors is the number of dials that failed.
+	DialErrors int64
+	// Reused is the number of requests served on a pooled connection.
+	Reused int64
+	// TLSHandshakes is the number of TLS handshakes that completed.
+	TLSHandshakes int64
+	// TLSHandshakeErrors is the number of TLS handshakes that failed.
+	TLSHandshakeErrors int64
+	// TLSHandshakeTime is the total time spent in TLS handshakes.
+	TLSHandshakeTime time.Duration
+}
+
+// ConnTracker counts the connections an outbound client dials and reuses,
+// so that operators can see whether the pool is sized for the load: a low
+// reuse ratio means connections are being closed and redialled. A
+// ConnTracker is safe for concurrent use.
+type ConnTracker struct {
+	name          string
+	requests      atomic.Int64
+	dials         atomic.Int64
+	dialErrors    atomic.Int64
+	reused        atomic.Int64
+	handshakes    atomic.Int64
+	tlsErrors     atomic.Int64
+	handshakeTime atomic.Int64
+}
+
+// NewConnTracker returns a ConnTracker for the client called name, which
+// identifies it in logs.
+func NewConnTracker(name string) *ConnTracker {
+	return &ConnTracker{name: name}
+}
+
+// RoundTripper returns next instrumented with t. A nil next means
+// http.DefaultTransport.
+func (t *ConnTracker) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		var handshakeStart time.Time
+		trace := &httptrace.ClientTrace{
+			ConnectDone: func(network, addr string, err error) {
+				t.dials.Add(1)
+				if err != nil {
+					t.dialErrors.Add(1)
+				}
+			},
+			TLSHandshakeStart: func() { handshakeStart = time.Now() },
+			TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+				if err != nil {
+					t.tlsErrors.Add(1)
+					return
+				}
+				t.handshakes.Add(1)
+				t.handshakeTime.Add(int64(time.Since(handshakeStart)))
+			},
+			GotConn: func(info httptrace.GotConnInfo) {
+				t.requests.Add(1)
+				if info.Reused {
+					t.reused.Add(1)
+				}
+			},
+		}
+		ctx := httptrace.WithClientTrace(req.Context(), trace)
+		return next.RoundTrip(req.WithContext(ctx))
+	})
+}
+
+// Stats returns the tracker's counts so far.
+func (t *ConnTracker) Stats() ConnStats {
+	return ConnStats{
+		Requests:           t.requests.Load(),
+		Dials:              t.dials.Load(),
+		DialErrors:         t.dialErrors.Load(),
+		Reused:             t.reused.Load(),
+		TLSHandshakes:      t.handshakes.Load(),
+		TLSHandshakeErrors: t.tlsErrors.Load(),
+		TLSHandshakeTime:   time.Duration(t.handshakeTime.Load()),
+	}
+}
+
+// LogValue implements slog.LogValuer, logging the client name and statistics.
+func (t *ConnTracker) LogValue() slog.Value {
+	s := t.Stats()
+	return slog.GroupValue(
+		slog.String("client", t.name),
+		slog.Int64("requests", s.Requests),
+		slog.Int64("dials", s.Dials),
+		slog.Int64("dial_errors", s.DialErrors),
+		slog.Int64("reused", s.Reused),
+		slog.Int64("tls_handshakes", s.TLSHandshakes),
+		slog.Int64("tls_handshake_errors", s.TLSHandshakeErrors),
+		slog.Duration("tls_handshake_time", s.TLSHandshakeTime),
+	)
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,27 @@
+// Package httperror lets handlers return errors instead of writing them,
+// and turns those errors into consistent JSON responses in one place.
+//
+// A HandlerFunc returns an error. An *Error carries the status code, a public
+// message, extra response fields and the internal cause, which is logged but
+// never sent:
+//
+//	func getUser(w http.ResponseWriter, r *http.Request) error {
+//	    u, err := store.User(r.Context(), r.PathValue("id"))
+//	    if errors.Is(err, store.ErrNotFound) {
+//	        return httperror.NotFound("no such user")
+//	    }
+//	    if err != nil {
+//	        return httperror.Internal(err)
+//	    }
+//	    return respond.JSON(w, http.StatusOK, u)
+//	}
+//
+// Adapter converts HandlerFuncs into http.Handlers that write returned errors
+// as RFC 9457 problem details, as the respond package does, and log them:
+// server errors at ERROR level with their cause, client errors at DEBUG.
+//
+//	handle := httperror.Adapter(httperror.Options{Logger: logger})
+//	mux.Handle("GET /users/{id}", handle(getUser))
+//
+// A HandlerFunc is itself an http.Handler using the default options.
+package httperror
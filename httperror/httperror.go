@@ -0,0 +1,195 @@
+package httperror
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+
+	"github.com/harrydayexe/GoWebUtilities/httpabort"
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+	"github.com/harrydayexe/GoWebUtilities/respond"
+)
+
+// Error is an error with the HTTP response it should produce. Status,
+// Message and Fields are sent to the client; Err is only logged.
+type Error struct {
+	// Status is the HTTP status code. Defaults to 500.
+	Status int
+	// Message is the public explanation, sent as the problem detail.
+	// Defaults to none, leaving the status text as the title.
+	Message string
+	// Err is the internal cause, logged but never sent to the client.
+	Err error
+	// Fields are additional members of the response, such as the invalid
+	// fields of a request.
+	Fields map[string]any
+}
+
+// New returns an Error with the given status and public message.
+func New(status int, message string) *Error {
+	return &Error{Status: status, Message: message}
+}
+
+// Wrap returns an Error with the given status and public message whose
+// internal cause is err.
+func Wrap(err error, status int, message string) *Error {
+	return &Error{Status: status, Message: message, Err: err}
+}
+
+// BadRequest returns a 400 Bad Request Error.
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, message)
+}
+
+// NotFound returns a 404 Not Found Error.
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, message)
+}
+
+// Conflict returns a 409 Conflict Error.
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, message)
+}
+
+// Internal returns a 500 Internal Server Error Error whose internal cause is
+// err.
+func Internal(err error) *Error {
+	return Wrap(err, http.StatusInternalServerError, "")
+}
+
+// WithField returns a copy of e with the response member key set to value.
+func (e *Error) WithField(key string, value any) *Error {
+	c := *e
+	c.Fields = make(map[string]any, len(e.Fields)+1)
+	maps.Copy(c.Fields, e.Fields)
+	c.Fields[key] = value
+	return &c
+}
+
+// Error implements error, including the internal cause.
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.status())
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the internal cause.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// status returns e.Status, or 500 if unset.
+func (e *Error) status() int {
+	if e.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return e.Status
+}
+
+// HandlerFunc is an HTTP handler that returns its error instead of writing
+// it. As an http.Handler, it writes errors as Adapter(Options{}) does.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// ServeHTTP calls f(w, r), writing any error it returns.
+func (f HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serve(f, Options{}, w, r)
+}
+
+// Options configures Adapter. Zero values are defaults.
+type Options struct {
+	// Logger logs the errors handlers return. Defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// Adapter returns a function turning HandlerFuncs into http.Handlers that
+// convert returned errors into consistent JSON responses:
+//
+//   - An *Error, or an error wrapping one, answers with its Status, Message
+//     as the problem detail and Fields as extension members.
+//   - A *respond.ProblemDetails is written as it is, and an httpabort.Abort
+//     answers with its status and message.
+//   - An *http.MaxBytesError answers 413 Request Entity Too Large.
+//   - Any other error answers 500 Internal Server Error without detail.
+//
+// Responses are RFC 9457 problem details written with respond.Error, so an
+// encoder set with respond.SetErrorEncoder applies.
+// Server errors (5xx) are logged at ERROR level, with their internal cause,
+// and client errors at DEBUG. If the handler already started the response,
+// or the client went away, the error is only logged.
+func Adapter(opts Options) func(HandlerFunc) http.Handler {
+	return func(fn HandlerFunc) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serve(fn, opts, w, r)
+		})
+	}
+}
+
+// serve calls fn and handles its error.
+func serve(fn HandlerFunc, opts Options, w http.ResponseWriter, r *http.Request) {
+	rec, r := middleware.NewResponseRecorder(w, r)
+	err := fn(rec.Writer(), r)
+	if err == nil {
+		return
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		logger.LogAttrs(r.Context(), slog.LevelDebug, "request cancelled",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	problem := toProblem(err)
+	level := slog.LevelDebug
+	if problem.Status >= 500 {
+		level = slog.LevelError
+	}
+	logger.LogAttrs(r.Context(), level, "request failed",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Int("status", problem.Status),
+		slog.String("error", err.Error()),
+	)
+	if rec.HeaderWritten() || rec.Info().Hijacked {
+		return
+	}
+	respond.Error(rec.Writer(), problem.Status, &problem)
+}
+
+// toProblem returns the problem details answering err.
+func toProblem(err error) respond.ProblemDetails {
+	var e *Error
+	if errors.As(err, &e) {
+		return respond.ProblemDetails{Status: e.status(), Detail: e.Message, Extensions: e.Fields}
+	}
+	var p *respond.ProblemDetails
+	if errors.As(err, &p) {
+		problem := *p
+		if problem.Status == 0 {
+			problem.Status = http.StatusInternalServerError
+		}
+		return problem
+	}
+	var abort httpabort.Abort
+	if errors.As(err, &abort) {
+		return respond.ProblemDetails{Status: abort.Status, Detail: abort.Body}
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return respond.ProblemDetails{Status: http.StatusRequestEntityTooLarge}
+	}
+	return respond.ProblemDetails{Status: http.StatusInternalServerError}
+}
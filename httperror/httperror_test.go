@@ -0,0 +1,194 @@
+package httperror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/harrydayexe/GoWebUtilities/httpabort"
+	"github.com/harrydayexe/GoWebUtilities/respond"
+)
+
+func TestError(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := Wrap(cause, http.StatusServiceUnavailable, "try again later")
+	if got, want := err.Error(), "try again later: connection refused"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("errors.Is(err, cause) = false")
+	}
+	if got, want := (&Error{}).Error(), "Internal Server Error"; got != want {
+		t.Errorf("zero Error() = %q, want %q", got, want)
+	}
+
+	base := BadRequest("invalid user")
+	withName := base.WithField("field", "name")
+	if base.Fields != nil {
+		t.Errorf("WithField modified the receiver: %v", base.Fields)
+	}
+	if withName.Fields["field"] != "name" || withName.Status != http.StatusBadRequest {
+		t.Errorf("WithField() = %+v", withName)
+	}
+}
+
+func TestAdapter(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantBody   map[string]any
+		wantLevel  string
+	}{
+		{
+			name:       "error",
+			err:        NotFound("no such user").WithField("id", "ada"),
+			wantStatus: http.StatusNotFound,
+			wantBody:   map[string]any{"title": "Not Found", "detail": "no such user", "id": "ada"},
+			wantLevel:  "DEBUG",
+		},
+		{
+			name:       "wrapped error",
+			err:        fmt.Errorf("loading user: %w", Conflict("already exists")),
+			wantStatus: http.StatusConflict,
+			wantBody:   map[string]any{"detail": "already exists"},
+			wantLevel:  "DEBUG",
+		},
+		{
+			name:       "internal",
+			err:        Internal(errors.New("db password expired")),
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   map[string]any{"title": "Internal Server Error"},
+			wantLevel:  "ERROR",
+		},
+		{
+			name:       "problem details",
+			err:        &respond.ProblemDetails{Type: "https://example.com/probs/credit", Title: "No credit", Status: http.StatusForbidden},
+			wantStatus: http.StatusForbidden,
+			wantBody:   map[string]any{"type": "https://example.com/probs/credit", "title": "No credit"},
+			wantLevel:  "DEBUG",
+		},
+		{
+			name:       "abort",
+			err:        httpabort.Abort{Status: http.StatusTeapot, Body: "short and stout"},
+			wantStatus: http.StatusTeapot,
+			wantBody:   map[string]any{"detail": "short and stout"},
+			wantLevel:  "DEBUG",
+		},
+		{
+			name:       "too large",
+			err:        &http.MaxBytesError{Limit: 10},
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantLevel:  "DEBUG",
+		},
+		{
+			name:       "plain error",
+			err:        errors.New("db password expired"),
+			wantStatus: http.StatusInternalServerError,
+			wantLevel:  "ERROR",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			h := Adapter(Options{Logger: logger})(func(w http.ResponseWriter, r *http.Request) error {
+				return tt.err
+			})
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/ada", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/problem+json" {
+				t.Errorf("Content-Type = %q", got)
+			}
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding body %q: %v", rec.Body, err)
+			}
+			for k, want := range tt.wantBody {
+				if body[k] != want {
+					t.Errorf("body[%q] = %v, want %v", k, body[k], want)
+				}
+			}
+			if strings.Contains(rec.Body.String(), "password") {
+				t.Errorf("body %q leaks the internal error", rec.Body)
+			}
+			if !strings.Contains(logs.String(), "level="+tt.wantLevel) || !strings.Contains(logs.String(), "path=/users/ada") {
+				t.Errorf("log %q, want a %s entry with the path", logs.String(), tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestAdapter_ErrorEncoder(t *testing.T) {
+	respond.SetErrorEncoder(func(w http.ResponseWriter, status int, err error) error {
+		return respond.JSON(w, status, map[string]string{"error": err.Error()})
+	})
+	defer respond.SetErrorEncoder(nil)
+
+	h := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return NotFound("no such user")
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/ada", nil))
+	if rec.Code != http.StatusNotFound || strings.TrimSpace(rec.Body.String()) != `{"error":"no such user"}` {
+		t.Errorf("got %d %q, want the custom encoder's body", rec.Code, rec.Body)
+	}
+}
+
+func TestAdapter_NoError(t *testing.T) {
+	h := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		return respond.JSON(w, http.StatusCreated, map[string]string{"id": "ada"})
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/users", nil))
+	if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"ada"`) {
+		t.Errorf("got %d %q", rec.Code, rec.Body)
+	}
+}
+
+func TestAdapter_ResponseStarted(t *testing.T) {
+	var logs bytes.Buffer
+	h := Adapter(Options{Logger: slog.New(slog.NewTextHandler(&logs, nil))})(func(w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "partial")
+		return errors.New("stream broke")
+	})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "partial" {
+		t.Errorf("got %d %q, want the partial response untouched", rec.Code, rec.Body)
+	}
+	if !strings.Contains(logs.String(), "stream broke") {
+		t.Errorf("log %q does not contain the error", logs.String())
+	}
+}
+
+func TestAdapter_ClientGone(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	h := Adapter(Options{Logger: logger})(func(w http.ResponseWriter, r *http.Request) error {
+		return r.Context().Err()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if rec.Body.Len() != 0 {
+		t.Errorf("body = %q, want none for a cancelled request", rec.Body)
+	}
+	if !strings.Contains(logs.String(), "level=DEBUG") {
+		t.Errorf("log %q, want a DEBUG entry", logs.String())
+	}
+}
@@ -0,0 +1,26 @@
+// Package jobs implements the long-running operation pattern for HTTP APIs:
+// accept a request, run the work in the background, answer 202 Accepted with
+// a Location to poll, and let the client cancel it.
+//
+//	jm := jobs.New(jobs.Options{})
+//	mux.Handle("POST /reports", jm.Handler(func(ctx context.Context, payload json.RawMessage) (any, error) {
+//	    return buildReport(ctx, payload)
+//	}))
+//	jm.Register(mux) // GET and DELETE /jobs/{id}
+//	server.Run(ctx, mux, server.WithShutdownHook("jobs", 0, jm.Shutdown))
+//
+// A submission answers:
+//
+//	HTTP/1.1 202 Accepted
+//	Location: /jobs/3f2a...
+//	{"id":"3f2a...","state":"pending","created":"...","updated":"..."}
+//
+// Polling GET /jobs/{id} returns the job with its state (pending, running,
+// succeeded, failed or canceled) and, once finished, its result or error.
+// DELETE /jobs/{id} cancels a pending or running job through its context.
+//
+// Jobs run in this process on a bounded pool of workers with a bounded queue;
+// a full queue answers 503. Job records live in a Store (NewMemoryStore by
+// default); a shared Store lets any instance answer polls, but the work
+// itself, and cancellation, stay with the instance that accepted the job.
+package jobs
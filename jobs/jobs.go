@@ -0,0 +1,353 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/respond"
+)
+
+// State is the lifecycle state of a job.
+type State string
+
+const (
+	// Pending jobs are queued, waiting for a worker.
+	Pending State = "pending"
+	// Running jobs are being performed.
+	Running State = "running"
+	// Succeeded jobs finished with a result.
+	Succeeded State = "succeeded"
+	// Failed jobs finished with an error.
+	Failed State = "failed"
+	// Canceled jobs were stopped by a DELETE request or by Shutdown.
+	Canceled State = "canceled"
+)
+
+// Finished reports whether s is a final state.
+func (s State) Finished() bool {
+	return s == Succeeded || s == Failed || s == Canceled
+}
+
+// Job is the record of one submitted job, as returned to pollers.
+type Job struct {
+	ID      string          `json:"id"`
+	State   State           `json:"state"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Created time.Time       `json:"created"`
+	Updated time.Time       `json:"updated"`
+}
+
+// Store holds job records. Implementations must be safe for concurrent use.
+type Store interface {
+	// Save creates or replaces the record of job.ID.
+	Save(ctx context.Context, job Job) error
+	// Load returns the record of the job with the given ID, if any.
+	Load(ctx context.Context, id string) (Job, bool, error)
+}
+
+// Func performs a job. It receives the submitted request body and returns a
+// result that is encoded as JSON. It must return promptly once ctx is
+// canceled.
+type Func func(ctx context.Context, payload json.RawMessage) (any, error)
+
+// Options configures a Manager. Zero values are defaults.
+type Options struct {
+	// Store holds the job records. Defaults to NewMemoryStore(time.Hour).
+	Store Store
+	// Workers is how many jobs run at once. Defaults to 4.
+	Workers int
+	// QueueSize is how many accepted jobs may wait for a worker.
+	// Submissions beyond it are answered with 503. Defaults to 100.
+	QueueSize int
+	// BasePath is the path prefix of the status endpoints, ending in "/".
+	// Defaults to "/jobs/".
+	BasePath string
+	// MaxPayloadSize is the largest request body accepted, in bytes.
+	// Defaults to 1 MiB.
+	MaxPayloadSize int64
+	// Logger receives job failures and store errors. Defaults to
+	// slog.Default().
+	Logger *slog.Logger
+}
+
+// queued is a job waiting for a worker.
+type queued struct {
+	ctx     context.Context
+	job     Job
+	fn      Func
+	payload json.RawMessage
+}
+
+// Manager accepts jobs, runs them and serves their status. Create one with
+// New.
+type Manager struct {
+	opts  Options
+	queue chan queued
+	wg    sync.WaitGroup
+
+	// baseCtx parents every job's context; Shutdown cancels it when its
+	// deadline passes.
+	baseCtx   context.Context
+	cancelAll context.CancelFunc
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+	closed  bool
+}
+
+// New returns a Manager with its workers started.
+func New(opts Options) *Manager {
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore(time.Hour)
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 100
+	}
+	if opts.BasePath == "" {
+		opts.BasePath = "/jobs/"
+	}
+	if !strings.HasSuffix(opts.BasePath, "/") {
+		opts.BasePath += "/"
+	}
+	if opts.MaxPayloadSize <= 0 {
+		opts.MaxPayloadSize = 1 << 20
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	m := &Manager{
+		opts:    opts,
+		queue:   make(chan queued, opts.QueueSize),
+		cancels: make(map[string]context.CancelFunc),
+	}
+	m.baseCtx, m.cancelAll = context.WithCancel(context.Background())
+	for range opts.Workers {
+		m.wg.Go(m.work)
+	}
+	return m
+}
+
+// Handler returns a handler that accepts a job running fn with the request
+// body as its payload, and answers 202 Accepted with the job and a Location
+// header pointing at its status endpoint.
+func (m *Manager) Handler(fn Func) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, m.opts.MaxPayloadSize))
+		if err != nil {
+			respond.Error(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		if len(payload) > 0 && !json.Valid(payload) {
+			respond.Error(w, http.StatusBadRequest, errors.New("request body is not valid JSON"))
+			return
+		}
+		job, err := m.Submit(r.Context(), fn, payload)
+		if err != nil {
+			if errors.Is(err, ErrQueueFull) || errors.Is(err, ErrClosed) {
+				w.Header().Set("Retry-After", "1")
+				respond.Error(w, http.StatusServiceUnavailable, err)
+				return
+			}
+			m.opts.Logger.Error("job submission failed", slog.String("error", err.Error()))
+			respond.Error(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Location", m.opts.BasePath+job.ID)
+		respond.JSON(w, http.StatusAccepted, job)
+	})
+}
+
+// ErrQueueFull is returned by Submit when the queue has no room.
+var ErrQueueFull = errors.New("jobs: queue is full")
+
+// ErrClosed is returned by Submit after Shutdown.
+var ErrClosed = errors.New("jobs: manager is shut down")
+
+// Submit records a pending job running fn with payload and queues it,
+// returning the job's record.
+func (m *Manager) Submit(ctx context.Context, fn Func, payload json.RawMessage) (Job, error) {
+	now := time.Now()
+	job := Job{ID: newID(), State: Pending, Created: now, Updated: now}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return Job{}, ErrClosed
+	}
+	if len(m.queue) == cap(m.queue) {
+		return Job{}, ErrQueueFull
+	}
+	if err := m.opts.Store.Save(ctx, job); err != nil {
+		return Job{}, fmt.Errorf("saving job: %w", err)
+	}
+	jobCtx, cancel := context.WithCancel(m.baseCtx)
+	m.cancels[job.ID] = cancel
+	m.queue <- queued{ctx: jobCtx, job: job, fn: fn, payload: payload} // room was checked under m.mu
+	return job, nil
+}
+
+// Register mounts GET and DELETE {BasePath}{id} on mux.
+func (m *Manager) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+m.opts.BasePath+"{id}", m.status)
+	mux.HandleFunc("DELETE "+m.opts.BasePath+"{id}", m.cancel)
+}
+
+// status serves a job's record.
+func (m *Manager) status(w http.ResponseWriter, r *http.Request) {
+	job, ok, err := m.opts.Store.Load(r.Context(), r.PathValue("id"))
+	if err != nil {
+		m.opts.Logger.Error("loading job failed", slog.String("error", err.Error()))
+		respond.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		respond.Error(w, http.StatusNotFound, errors.New("no such job"))
+		return
+	}
+	if !job.State.Finished() {
+		w.Header().Set("Retry-After", "1")
+	}
+	respond.JSON(w, http.StatusOK, job)
+}
+
+// cancel cancels a pending or running job. The worker records the canceled
+// state once the job has stopped, so the response shows the state at the
+// time of the request.
+func (m *Manager) cancel(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	job, ok, err := m.opts.Store.Load(r.Context(), id)
+	if err != nil {
+		m.opts.Logger.Error("loading job failed", slog.String("error", err.Error()))
+		respond.Error(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		respond.Error(w, http.StatusNotFound, errors.New("no such job"))
+		return
+	}
+	if job.State.Finished() {
+		respond.Error(w, http.StatusConflict, fmt.Errorf("job already %s", job.State))
+		return
+	}
+	m.mu.Lock()
+	cancel, local := m.cancels[id]
+	m.mu.Unlock()
+	if !local {
+		respond.Error(w, http.StatusConflict, errors.New("job is running on another instance"))
+		return
+	}
+	cancel()
+	respond.JSON(w, http.StatusAccepted, job)
+}
+
+// work runs queued jobs until the queue is closed.
+func (m *Manager) work() {
+	for q := range m.queue {
+		m.run(q)
+	}
+}
+
+// run performs one job and records its outcome.
+func (m *Manager) run(q queued) {
+	defer func() {
+		m.mu.Lock()
+		m.cancels[q.job.ID]()
+		delete(m.cancels, q.job.ID)
+		m.mu.Unlock()
+	}()
+
+	job := q.job
+	if q.ctx.Err() == nil {
+		job.State, job.Updated = Running, time.Now()
+		m.save(job)
+		job.Result, job.Error = m.call(q)
+	}
+	job.Updated = time.Now()
+	switch {
+	case q.ctx.Err() != nil:
+		job.State, job.Result, job.Error = Canceled, nil, ""
+	case job.Error != "":
+		job.State = Failed
+	default:
+		job.State = Succeeded
+	}
+	m.save(job)
+}
+
+// call runs the job's function, returning its encoded result or error text.
+func (m *Manager) call(q queued) (result json.RawMessage, errText string) {
+	defer func() {
+		if v := recover(); v != nil {
+			m.opts.Logger.Error("job panicked", slog.String("job", q.job.ID), slog.Any("panic", v))
+			result, errText = nil, "internal error"
+		}
+	}()
+	v, err := q.fn(q.ctx, q.payload)
+	if err != nil {
+		if q.ctx.Err() == nil {
+			m.opts.Logger.Warn("job failed", slog.String("job", q.job.ID), slog.String("error", err.Error()))
+		}
+		return nil, err.Error()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		m.opts.Logger.Error("encoding job result failed", slog.String("job", q.job.ID), slog.String("error", err.Error()))
+		return nil, "internal error"
+	}
+	return b, ""
+}
+
+// save writes job to the store, logging failures.
+func (m *Manager) save(job Job) {
+	if err := m.opts.Store.Save(context.Background(), job); err != nil {
+		m.opts.Logger.Error("saving job failed", slog.String("job", job.ID), slog.String("error", err.Error()))
+	}
+}
+
+// Shutdown stops accepting jobs and waits for queued and running jobs to
+// finish. If ctx is done first, the remaining jobs are canceled, recorded as
+// such, and Shutdown returns ctx's error once they have stopped. Its
+// signature fits server.WithShutdownHook.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		m.cancelAll()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// newID returns a random job ID.
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
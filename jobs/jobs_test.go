@@ -0,0 +1,151 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestManager(t *testing.T, opts Options) (*Manager, *http.ServeMux) {
+	t.Helper()
+	opts.Logger = slog.New(slog.DiscardHandler)
+	m := New(opts)
+	t.Cleanup(func() { m.Shutdown(context.Background()) })
+	mux := http.NewServeMux()
+	m.Register(mux)
+	return m, mux
+}
+
+func do(t *testing.T, h http.Handler, method, path, body string) (*httptest.ResponseRecorder, Job) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var job Job
+	json.Unmarshal(rec.Body.Bytes(), &job)
+	return rec, job
+}
+
+func waitForState(t *testing.T, mux http.Handler, id string, want State) Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, job := do(t, mux, http.MethodGet, "/jobs/"+id, "")
+		if job.State == want || time.Now().After(deadline) {
+			if job.State != want {
+				t.Fatalf("job %s state = %q, want %q", id, job.State, want)
+			}
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestManager_Lifecycle(t *testing.T) {
+	m, mux := newTestManager(t, Options{})
+	mux.Handle("POST /sum", m.Handler(func(ctx context.Context, payload json.RawMessage) (any, error) {
+		var nums []int
+		if err := json.Unmarshal(payload, &nums); err != nil {
+			return nil, err
+		}
+		total := 0
+		for _, n := range nums {
+			total += n
+		}
+		return total, nil
+	}))
+
+	rec, job := do(t, mux, http.MethodPost, "/sum", "[1,2,3]")
+	if rec.Code != http.StatusAccepted || rec.Header().Get("Location") != "/jobs/"+job.ID {
+		t.Fatalf("submit: got %d, Location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if job.State != Pending {
+		t.Errorf("submitted state = %q, want pending", job.State)
+	}
+	job = waitForState(t, mux, job.ID, Succeeded)
+	if string(job.Result) != "6" {
+		t.Errorf("result = %s, want 6", job.Result)
+	}
+
+	_, job = do(t, mux, http.MethodPost, "/sum", `{"not":"a list"}`)
+	job = waitForState(t, mux, job.ID, Failed)
+	if job.Error == "" {
+		t.Error("failed job has no error")
+	}
+
+	if rec, _ := do(t, mux, http.MethodGet, "/jobs/unknown", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown job: got %d, want 404", rec.Code)
+	}
+	if rec, _ := do(t, mux, http.MethodPost, "/sum", "{"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid JSON: got %d, want 400", rec.Code)
+	}
+}
+
+func TestManager_Cancel(t *testing.T) {
+	m, mux := newTestManager(t, Options{})
+	started := make(chan struct{})
+	mux.Handle("POST /wait", m.Handler(func(ctx context.Context, _ json.RawMessage) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+
+	_, job := do(t, mux, http.MethodPost, "/wait", "")
+	<-started
+	if rec, _ := do(t, mux, http.MethodDelete, "/jobs/"+job.ID, ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("cancel: got %d, want 202", rec.Code)
+	}
+	waitForState(t, mux, job.ID, Canceled)
+	if rec, _ := do(t, mux, http.MethodDelete, "/jobs/"+job.ID, ""); rec.Code != http.StatusConflict {
+		t.Errorf("cancel finished job: got %d, want 409", rec.Code)
+	}
+}
+
+func TestManager_QueueFullAndShutdown(t *testing.T) {
+	m, _ := newTestManager(t, Options{Workers: 1, QueueSize: 1})
+	block := func(ctx context.Context, _ json.RawMessage) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	ctx := context.Background()
+	var err error
+	for range 3 {
+		if _, err = m.Submit(ctx, block, nil); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Submit error = %v, want ErrQueueFull", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := m.Shutdown(shutdownCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want deadline exceeded after canceling jobs", err)
+	}
+	if _, err := m.Submit(ctx, block, nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Submit after Shutdown = %v, want ErrClosed", err)
+	}
+}
+
+func TestMemoryStore_Expiry(t *testing.T) {
+	s := NewMemoryStore(time.Minute).(*memoryStore)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+	s.Save(ctx, Job{ID: "done", State: Succeeded, Updated: now})
+	s.Save(ctx, Job{ID: "running", State: Running, Updated: now})
+
+	now = now.Add(2 * time.Minute)
+	if _, ok, _ := s.Load(ctx, "done"); ok {
+		t.Error("finished job outlived its ttl")
+	}
+	if _, ok, _ := s.Load(ctx, "running"); !ok {
+		t.Error("unfinished job expired")
+	}
+}
@@ -0,0 +1,59 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryStore is the in-memory Store returned by NewMemoryStore.
+type memoryStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	jobs      map[string]Job
+	lastSweep time.Time
+}
+
+// NewMemoryStore returns a Store that keeps job records in memory. Records
+// of finished jobs are dropped ttl after the job finished, so clients must
+// collect results within ttl. A ttl of zero or less keeps them for an hour.
+func NewMemoryStore(ttl time.Duration) Store {
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	return &memoryStore{ttl: ttl, now: time.Now, jobs: make(map[string]Job)}
+}
+
+// Save implements Store.
+func (s *memoryStore) Save(_ context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	if now := s.now(); now.Sub(s.lastSweep) >= time.Minute {
+		s.lastSweep = now
+		for id, j := range s.jobs {
+			if s.expired(j, now) {
+				delete(s.jobs, id)
+			}
+		}
+	}
+	return nil
+}
+
+// Load implements Store.
+func (s *memoryStore) Load(_ context.Context, id string) (Job, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || s.expired(job, s.now()) {
+		return Job{}, false, nil
+	}
+	return job, true, nil
+}
+
+// expired reports whether job finished more than ttl before now.
+func (s *memoryStore) expired(job Job, now time.Time) bool {
+	return job.State.Finished() && now.Sub(job.Updated) > s.ttl
+}
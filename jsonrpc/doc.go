@@ -0,0 +1,25 @@
+// Package jsonrpc provides a JSON-RPC 2.0 server that maps methods to Go functions.
+//
+// Methods are registered with the generic Register function, which binds the
+// request params to a typed parameter value and encodes the typed result:
+//
+//	type AddParams struct {
+//	    A, B int
+//	}
+//
+//	rpc := jsonrpc.NewServer()
+//	jsonrpc.Register(rpc, "add", func(ctx context.Context, p AddParams) (int, error) {
+//	    return p.A + p.B, nil
+//	})
+//	mux.Handle("/rpc", stack(rpc))
+//
+// Both by-name ({"A": 1, "B": 2}) and by-position ([1, 2]) params are supported.
+// Batch requests, notifications, and the standard error codes defined by the
+// specification are handled by the Server. Methods can return an *Error to
+// send an application-defined error code to the client.
+//
+// Request bodies are limited to 1 MiB and batches to 100 requests, run 8 at
+// a time; WithMaxBodySize, WithMaxBatchSize and WithBatchParallelism change
+// the limits. Server implements http.Handler, so it composes with the
+// middleware package: use middleware.NewLoggingMiddleware to log calls.
+package jsonrpc
@@ -0,0 +1,38 @@
+package jsonrpc
+
+import "fmt"
+
+// Standard error codes defined by the JSON-RPC 2.0 specification.
+const (
+	// CodeParseError indicates that the server received invalid JSON.
+	CodeParseError = -32700
+	// CodeInvalidRequest indicates that the JSON sent is not a valid Request object.
+	CodeInvalidRequest = -32600
+	// CodeMethodNotFound indicates that the method does not exist or is not available.
+	CodeMethodNotFound = -32601
+	// CodeInvalidParams indicates invalid method parameters.
+	CodeInvalidParams = -32602
+	// CodeInternalError indicates an internal JSON-RPC error.
+	CodeInternalError = -32603
+)
+
+// Error is a JSON-RPC error object. Methods may return an *Error to control
+// the code and data sent to the client; any other error is reported as
+// CodeInternalError with the error's message.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// NewError returns an *Error with the given code, message and optional data.
+// Application-defined codes should lie outside the range -32768 to -32000,
+// which is reserved by the specification.
+func NewError(code int, message string, data any) *Error {
+	return &Error{Code: code, Message: message, Data: data}
+}
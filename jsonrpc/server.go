@@ -0,0 +1,329 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"runtime/debug"
+	"sync"
+)
+
+// request is a JSON-RPC 2.0 Request object. A request without an id is a
+// notification and receives no response.
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// response is a JSON-RPC 2.0 Response object.
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// method invokes a registered function with raw params.
+type method func(ctx context.Context, params json.RawMessage) (any, error)
+
+// Defaults applied when no option overrides them.
+const (
+	defaultMaxBodySize      = 1 << 20 // 1 MiB
+	defaultMaxBatchSize     = 100
+	defaultBatchParallelism = 8
+)
+
+// Option configures a Server created by NewServer.
+type Option func(*Server)
+
+// WithMaxBodySize limits the size of request bodies; larger ones are
+// answered with 413 Request Entity Too Large. Defaults to 1 MiB.
+func WithMaxBodySize(maxBytes int64) Option {
+	return func(s *Server) {
+		s.maxBodySize = maxBytes
+	}
+}
+
+// WithMaxBatchSize limits how many requests a batch may contain; larger
+// batches are answered with a single CodeInvalidRequest error. Defaults to
+// 100.
+func WithMaxBatchSize(n int) Option {
+	return func(s *Server) {
+		s.maxBatchSize = n
+	}
+}
+
+// WithBatchParallelism sets how many requests of a batch run at once.
+// Defaults to 8.
+func WithBatchParallelism(n int) Option {
+	return func(s *Server) {
+		s.parallelism = n
+	}
+}
+
+// Server dispatches JSON-RPC 2.0 requests received over HTTP to registered
+// Go functions. It implements http.Handler so it can be mounted on a mux and
+// wrapped with the middleware package like any other handler.
+//
+// Server is safe for concurrent use. Methods may be registered while serving.
+type Server struct {
+	maxBodySize  int64
+	maxBatchSize int
+	parallelism  int
+
+	mu      sync.RWMutex
+	methods map[string]method
+}
+
+// NewServer returns a Server with no registered methods.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		maxBodySize:  defaultMaxBodySize,
+		maxBatchSize: defaultMaxBatchSize,
+		parallelism:  defaultBatchParallelism,
+		methods:      make(map[string]method),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.maxBodySize <= 0 {
+		s.maxBodySize = defaultMaxBodySize
+	}
+	if s.maxBatchSize <= 0 {
+		s.maxBatchSize = defaultMaxBatchSize
+	}
+	if s.parallelism <= 0 {
+		s.parallelism = defaultBatchParallelism
+	}
+	return s
+}
+
+// Register registers fn as the handler for the named method.
+//
+// Parameters are bound to P as follows:
+//   - by-name params (a JSON object) are decoded into P with encoding/json;
+//   - by-position params (a JSON array) are decoded into P directly when P is
+//     a slice or array, or assigned to the exported fields of struct P in
+//     declaration order;
+//   - omitted params leave P as its zero value.
+//
+// Params that cannot be bound produce a CodeInvalidParams error. The result
+// R is encoded with encoding/json. Registering a method name twice replaces
+// the earlier registration.
+func Register[P, R any](s *Server, name string, fn func(ctx context.Context, params P) (R, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methods[name] = func(ctx context.Context, raw json.RawMessage) (any, error) {
+		var params P
+		if err := bindParams(raw, &params); err != nil {
+			return nil, NewError(CodeInvalidParams, "invalid params", err.Error())
+		}
+		return fn(ctx, params)
+	}
+}
+
+// bindParams decodes raw JSON-RPC params into dst, a pointer to P.
+func bindParams(raw json.RawMessage, dst any) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil
+	}
+	if raw[0] != '[' {
+		return json.Unmarshal(raw, dst)
+	}
+
+	v := reflect.ValueOf(dst).Elem()
+	if v.Kind() != reflect.Struct {
+		return json.Unmarshal(raw, dst)
+	}
+
+	var positional []json.RawMessage
+	if err := json.Unmarshal(raw, &positional); err != nil {
+		return err
+	}
+	t := v.Type()
+	field := 0
+	for _, p := range positional {
+		for field < t.NumField() && !t.Field(field).IsExported() {
+			field++
+		}
+		if field >= t.NumField() {
+			return fmt.Errorf("too many positional params: expected at most %d", field)
+		}
+		if err := json.Unmarshal(p, v.Field(field).Addr().Interface()); err != nil {
+			return fmt.Errorf("param %d: %w", field, err)
+		}
+		field++
+	}
+	return nil
+}
+
+// ServeHTTP handles a single JSON-RPC request or a batch of requests sent as
+// the body of a POST. Responses are always sent with status 200, except when
+// every request in the body is a notification, in which case the server
+// responds with 204 No Content, and for bodies over the size limit, which
+// get 413. A method that panics is answered with CodeInternalError.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		writeJSON(w, errorResponse(nil, CodeParseError, "failed to read request body"))
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			writeJSON(w, errorResponse(nil, CodeParseError, "parse error"))
+			return
+		}
+		if len(batch) == 0 {
+			writeJSON(w, errorResponse(nil, CodeInvalidRequest, "empty batch"))
+			return
+		}
+		if len(batch) > s.maxBatchSize {
+			writeJSON(w, errorResponse(nil, CodeInvalidRequest, fmt.Sprintf("batch too large: the limit is %d requests", s.maxBatchSize)))
+			return
+		}
+		responses := s.handleBatch(r.Context(), batch)
+		if len(responses) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, responses)
+		return
+	}
+
+	if !json.Valid(body) {
+		writeJSON(w, errorResponse(nil, CodeParseError, "parse error"))
+		return
+	}
+	resp := s.handle(r.Context(), body)
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+// handleBatch processes the requests of a batch concurrently, at most
+// s.parallelism at a time, returning the responses for the non-notification
+// requests in request order.
+func (s *Server) handleBatch(ctx context.Context, batch []json.RawMessage) []*response {
+	results := make([]*response, len(batch))
+	sem := make(chan struct{}, s.parallelism)
+	var wg sync.WaitGroup
+	for i, raw := range batch {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			results[i] = s.handle(ctx, raw)
+		})
+	}
+	wg.Wait()
+
+	responses := make([]*response, 0, len(results))
+	for _, resp := range results {
+		if resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	return responses
+}
+
+// handle processes a single request object, returning nil for notifications.
+func (s *Server) handle(ctx context.Context, raw json.RawMessage) *response {
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" || !validID(req.ID) {
+		return errorResponse(nil, CodeInvalidRequest, "invalid request")
+	}
+	notification := req.ID == nil
+
+	s.mu.RLock()
+	m, ok := s.methods[req.Method]
+	s.mu.RUnlock()
+	if !ok {
+		if notification {
+			return nil
+		}
+		return errorResponse(req.ID, CodeMethodNotFound, "method not found")
+	}
+
+	result, err := call(ctx, req.Method, m, req.Params)
+	if notification {
+		return nil
+	}
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = NewError(CodeInternalError, err.Error(), nil)
+		}
+		return &response{JSONRPC: "2.0", Error: rpcErr, ID: req.ID}
+	}
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+	return &response{JSONRPC: "2.0", Result: result, ID: req.ID}
+}
+
+// call invokes m, turning a panic into a CodeInternalError. Batch requests
+// run on goroutines of their own, where net/http cannot recover a panic, so
+// one would otherwise crash the process. Panics are logged with
+// slog.Default.
+func call(ctx context.Context, name string, m method, params json.RawMessage) (result any, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			slog.Default().ErrorContext(ctx, "jsonrpc method panicked",
+				slog.String("method", name),
+				slog.Any("panic", v),
+				slog.String("stack", string(debug.Stack())))
+			result, err = nil, NewError(CodeInternalError, "internal error", nil)
+		}
+	}()
+	return m(ctx, params)
+}
+
+// validID reports whether id is absent, null, a string, or a number.
+func validID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	switch id[0] {
+	case '"', 'n', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return true
+	default:
+		return false
+	}
+}
+
+func errorResponse(id json.RawMessage, code int, message string) *response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &response{JSONRPC: "2.0", Error: NewError(code, message, nil), ID: id}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,46 @@
+package jsonrpc_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/harrydayexe/GoWebUtilities/jsonrpc"
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+)
+
+// ExampleRegister demonstrates registering a typed method and calling it
+// through a middleware stack.
+func ExampleRegister() {
+	type GreetParams struct {
+		Name string `json:"name"`
+	}
+
+	rpc := jsonrpc.NewServer()
+	jsonrpc.Register(rpc, "greet", func(ctx context.Context, p GreetParams) (string, error) {
+		return "Hello, " + p.Name, nil
+	})
+
+	stack := middleware.CreateStack(
+		middleware.NewMaxBytesReader(1024),
+	)
+	server := httptest.NewServer(stack(rpc))
+	defer server.Close()
+
+	body := `{"jsonrpc":"2.0","method":"greet","params":{"name":"Alice"},"id":1}`
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	out, _ := io.ReadAll(resp.Body)
+	fmt.Print(string(out))
+
+	// Output:
+	// {"jsonrpc":"2.0","result":"Hello, Alice","id":1}
+}
@@ -0,0 +1,238 @@
+package jsonrpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type addParams struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+// newTestServer returns a server with "add", "fail", "custom" and "notify" methods.
+func newTestServer(notified *atomic.Int32) *Server {
+	s := NewServer()
+	Register(s, "add", func(ctx context.Context, p addParams) (int, error) {
+		return p.A + p.B, nil
+	})
+	Register(s, "sum", func(ctx context.Context, p []int) (int, error) {
+		total := 0
+		for _, n := range p {
+			total += n
+		}
+		return total, nil
+	})
+	Register(s, "fail", func(ctx context.Context, p struct{}) (any, error) {
+		return nil, errors.New("boom")
+	})
+	Register(s, "custom", func(ctx context.Context, p struct{}) (any, error) {
+		return nil, NewError(42, "custom failure", "details")
+	})
+	Register(s, "notify", func(ctx context.Context, p struct{}) (any, error) {
+		notified.Add(1)
+		return nil, nil
+	})
+	return s
+}
+
+// post sends body to the server and returns the recorder.
+func post(s *Server, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/rpc", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestServer_SingleRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantBody string
+	}{
+		{"by_name", `{"jsonrpc":"2.0","method":"add","params":{"a":1,"b":2},"id":1}`,
+			`{"jsonrpc":"2.0","result":3,"id":1}`},
+		{"by_position_struct", `{"jsonrpc":"2.0","method":"add","params":[4,5],"id":"x"}`,
+			`{"jsonrpc":"2.0","result":9,"id":"x"}`},
+		{"by_position_slice", `{"jsonrpc":"2.0","method":"sum","params":[1,2,3],"id":2}`,
+			`{"jsonrpc":"2.0","result":6,"id":2}`},
+		{"omitted_params", `{"jsonrpc":"2.0","method":"add","id":3}`,
+			`{"jsonrpc":"2.0","result":0,"id":3}`},
+		{"nil_result", `{"jsonrpc":"2.0","method":"notify","id":4}`,
+			`{"jsonrpc":"2.0","result":null,"id":4}`},
+		{"method_not_found", `{"jsonrpc":"2.0","method":"missing","id":5}`,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"method not found"},"id":5}`},
+		{"invalid_params", `{"jsonrpc":"2.0","method":"add","params":{"a":"x"},"id":6}`, ""},
+		{"too_many_positional", `{"jsonrpc":"2.0","method":"add","params":[1,2,3],"id":7}`, ""},
+		{"internal_error", `{"jsonrpc":"2.0","method":"fail","id":8}`,
+			`{"jsonrpc":"2.0","error":{"code":-32603,"message":"boom"},"id":8}`},
+		{"custom_error", `{"jsonrpc":"2.0","method":"custom","id":9}`,
+			`{"jsonrpc":"2.0","error":{"code":42,"message":"custom failure","data":"details"},"id":9}`},
+		{"wrong_version", `{"jsonrpc":"1.0","method":"add","id":10}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}`},
+		{"invalid_id", `{"jsonrpc":"2.0","method":"add","id":{}}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}`},
+		{"parse_error", `{"jsonrpc":`,
+			`{"jsonrpc":"2.0","error":{"code":-32700,"message":"parse error"},"id":null}`},
+	}
+
+	var notified atomic.Int32
+	s := newTestServer(&notified)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := post(s, tt.body)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status: got %d, want 200", w.Code)
+			}
+			got := strings.TrimSpace(w.Body.String())
+			if tt.wantBody == "" {
+				if !strings.Contains(got, `"code":-32602`) {
+					t.Errorf("expected invalid params error, got %s", got)
+				}
+				return
+			}
+			if got != tt.wantBody {
+				t.Errorf("body: got %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestServer_Batch(t *testing.T) {
+	var notified atomic.Int32
+	s := newTestServer(&notified)
+
+	w := post(s, `[
+		{"jsonrpc":"2.0","method":"add","params":[1,1],"id":1},
+		{"jsonrpc":"2.0","method":"notify"},
+		{"jsonrpc":"2.0","method":"missing","id":2},
+		{"foo":"bar"}
+	]`)
+
+	want := `[{"jsonrpc":"2.0","result":2,"id":1},` +
+		`{"jsonrpc":"2.0","error":{"code":-32601,"message":"method not found"},"id":2},` +
+		`{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}]`
+	if got := strings.TrimSpace(w.Body.String()); got != want {
+		t.Errorf("body: got %s, want %s", got, want)
+	}
+	if notified.Load() != 1 {
+		t.Errorf("notify called %d times, want 1", notified.Load())
+	}
+}
+
+func TestServer_NotificationsOnly(t *testing.T) {
+	var notified atomic.Int32
+	s := newTestServer(&notified)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"single", `{"jsonrpc":"2.0","method":"notify"}`},
+		{"batch", `[{"jsonrpc":"2.0","method":"notify"},{"jsonrpc":"2.0","method":"notify"}]`},
+		{"unknown_method", `{"jsonrpc":"2.0","method":"missing"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := post(s, tt.body)
+			if w.Code != http.StatusNoContent {
+				t.Errorf("status: got %d, want %d", w.Code, http.StatusNoContent)
+			}
+			if w.Body.Len() != 0 {
+				t.Errorf("expected empty body, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_EmptyBatch(t *testing.T) {
+	var notified atomic.Int32
+	w := post(newTestServer(&notified), `[]`)
+
+	want := `{"jsonrpc":"2.0","error":{"code":-32600,"message":"empty batch"},"id":null}`
+	if got := strings.TrimSpace(w.Body.String()); got != want {
+		t.Errorf("body: got %s, want %s", got, want)
+	}
+}
+
+func TestServer_MethodNotAllowed(t *testing.T) {
+	var notified atomic.Int32
+	s := newTestServer(&notified)
+	req := httptest.NewRequest("GET", "/rpc", nil)
+	w := httptest.NewRecorder()
+
+	s.ServeHTTP(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status: got %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if got := w.Header().Get("Allow"); got != "POST" {
+		t.Errorf("Allow header: got %q, want POST", got)
+	}
+}
+
+func TestServer_Panic(t *testing.T) {
+	var notified atomic.Int32
+	s := newTestServer(&notified)
+	Register(s, "boom", func(ctx context.Context, p struct{}) (any, error) {
+		panic("boom")
+	})
+
+	w := post(s, `[{"jsonrpc":"2.0","method":"boom","id":1},{"jsonrpc":"2.0","method":"add","params":[1,1],"id":2}]`)
+
+	want := `[{"jsonrpc":"2.0","error":{"code":-32603,"message":"internal error"},"id":1},` +
+		`{"jsonrpc":"2.0","result":2,"id":2}]`
+	if got := strings.TrimSpace(w.Body.String()); got != want {
+		t.Errorf("body: got %s, want %s", got, want)
+	}
+}
+
+func TestServer_Limits(t *testing.T) {
+	s := NewServer(WithMaxBodySize(64), WithMaxBatchSize(2))
+	Register(s, "add", func(ctx context.Context, p addParams) (int, error) {
+		return p.A + p.B, nil
+	})
+
+	w := post(s, `{"jsonrpc":"2.0","method":"add","params":{"a":1,"b":2},"id":"`+strings.Repeat("x", 64)+`"}`)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	w = post(s, `[{"jsonrpc":"2.0","method":"add","id":1},{},{}]`)
+	want := `{"jsonrpc":"2.0","error":{"code":-32600,"message":"batch too large: the limit is 2 requests"},"id":null}`
+	if got := strings.TrimSpace(w.Body.String()); got != want {
+		t.Errorf("large batch: got %s, want %s", got, want)
+	}
+}
+
+func TestServer_BatchParallelism(t *testing.T) {
+	var running, peak atomic.Int32
+	s := NewServer(WithBatchParallelism(2))
+	Register(s, "slow", func(ctx context.Context, p struct{}) (any, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil, nil
+	})
+
+	post(s, `[`+strings.TrimSuffix(strings.Repeat(`{"jsonrpc":"2.0","method":"slow","id":1},`, 6), ",")+`]`)
+	if got := peak.Load(); got > 2 {
+		t.Errorf("peak concurrency = %d, want at most 2", got)
+	}
+}
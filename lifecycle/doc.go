@@ -0,0 +1,19 @@
+// Package lifecycle starts and stops an application's components in an
+// order derived from their declared dependencies, instead of the implicit
+// order of statements in main.
+//
+// Each Component names the components it depends on. Start runs them in
+// dependency order, each within its own timeout, and Stop runs them in
+// reverse, so a component is started after, and stopped before, everything
+// it depends on:
+//
+//	l := lifecycle.New(lifecycle.Options{})
+//	l.Add(lifecycle.Component{Name: "db", Start: db.Connect, Stop: db.Close})
+//	l.Add(lifecycle.Component{Name: "cache-warm", DependsOn: []string{"db"}, Start: warmCache})
+//	l.Add(lifecycle.Component{Name: "queue", DependsOn: []string{"db"}, Start: q.Start, Stop: q.Drain})
+//	server.Run(ctx, mux, server.WithLifecycle(l)) // starts db, cache-warm and queue before listening
+//
+// Ties are broken by the order components were added, so the order is the
+// same on every run. Unknown dependencies and cycles are reported before
+// anything starts. Every step is logged with its duration.
+package lifecycle
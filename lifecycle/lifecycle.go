@@ -0,0 +1,272 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Component is one part of an application with a start and stop step.
+type Component struct {
+	// Name identifies the component in dependencies, logs and errors. It
+	// must be unique.
+	Name string
+	// DependsOn names the components that must start before this one and
+	// stop after it.
+	DependsOn []string
+	// Start starts the component. It must return promptly once ctx is done.
+	// Nil means the component has nothing to start.
+	Start func(ctx context.Context) error
+	// Stop stops the component, and is only called if Start succeeded. It
+	// must return promptly once ctx is done. Nil means the component has
+	// nothing to stop.
+	Stop func(ctx context.Context) error
+	// StartTimeout bounds Start. Defaults to Options.StartTimeout.
+	StartTimeout time.Duration
+	// StopTimeout bounds Stop. Defaults to Options.StopTimeout.
+	StopTimeout time.Duration
+}
+
+// Options configures a Lifecycle. Zero values are defaults.
+type Options struct {
+	// StartTimeout bounds each component's Start. Defaults to 30 seconds.
+	StartTimeout time.Duration
+	// StopTimeout bounds each component's Stop. Defaults to 10 seconds.
+	StopTimeout time.Duration
+	// Logger logs each step. Defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// Lifecycle starts and stops a set of components in dependency order. It
+// is safe for concurrent use, but components must all be added before
+// Start.
+type Lifecycle struct {
+	opts Options
+
+	mu         sync.Mutex
+	components []Component
+	started    []Component // in start order
+}
+
+// New returns an empty Lifecycle.
+func New(opts Options) *Lifecycle {
+	if opts.StartTimeout <= 0 {
+		opts.StartTimeout = 30 * time.Second
+	}
+	if opts.StopTimeout <= 0 {
+		opts.StopTimeout = 10 * time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return &Lifecycle{opts: opts}
+}
+
+// Add adds c. Problems such as a duplicate name are reported by Order and
+// Start.
+func (l *Lifecycle) Add(c Component) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.components = append(l.components, c)
+}
+
+// Order returns the names of the components in the order Start runs them.
+// Each component comes after its dependencies and, where the dependencies
+// allow either, after the components added before it. It returns an error
+// for a duplicate or empty name, an unknown dependency or a dependency
+// cycle.
+func (l *Lifecycle) Order() ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ordered, err := l.order()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(ordered))
+	for i, c := range ordered {
+		names[i] = c.Name
+	}
+	return names, nil
+}
+
+// order implements Order, returning the components. l.mu must be held.
+func (l *Lifecycle) order() ([]Component, error) {
+	byName := make(map[string]Component, len(l.components))
+	for _, c := range l.components {
+		if c.Name == "" {
+			return nil, errors.New("lifecycle: component has no name")
+		}
+		if _, ok := byName[c.Name]; ok {
+			return nil, fmt.Errorf("lifecycle: component %s added twice", c.Name)
+		}
+		byName[c.Name] = c
+	}
+	for _, c := range l.components {
+		for _, dep := range c.DependsOn {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("lifecycle: component %s depends on unknown component %s", c.Name, dep)
+			}
+		}
+	}
+
+	placed := make(map[string]bool, len(l.components))
+	ordered := make([]Component, 0, len(l.components))
+	for len(ordered) < len(l.components) {
+		progress := false
+		for _, c := range l.components {
+			if placed[c.Name] || !allPlaced(c.DependsOn, placed) {
+				continue
+			}
+			placed[c.Name] = true
+			ordered = append(ordered, c)
+			progress = true
+			break // restart, so earlier components win ties
+		}
+		if !progress {
+			return nil, fmt.Errorf("lifecycle: dependency cycle: %s", findCycle(l.components, byName, placed))
+		}
+	}
+	return ordered, nil
+}
+
+// allPlaced reports whether every name in deps is placed.
+func allPlaced(deps []string, placed map[string]bool) bool {
+	for _, dep := range deps {
+		if !placed[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// findCycle returns a dependency cycle among the components not placed, as
+// "a -> b -> a". There is one, as none of them can be placed.
+func findCycle(components []Component, byName map[string]Component, placed map[string]bool) string {
+	var path []string
+	onPath := make(map[string]bool)
+	for _, c := range components {
+		if !placed[c.Name] {
+			// Following unplaced dependencies from an unplaced component
+			// must revisit a component on the path.
+			for name := c.Name; ; {
+				if onPath[name] {
+					cycle := append(path[slices.Index(path, name):], name)
+					return strings.Join(cycle, " -> ")
+				}
+				onPath[name] = true
+				path = append(path, name)
+				for _, dep := range byName[name].DependsOn {
+					if !placed[dep] {
+						name = dep
+						break
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Start starts the components in dependency order, each within its start
+// timeout. If one fails, the components already started are stopped, in
+// reverse order, and Start returns the failure joined with any errors
+// stopping them. Components must not be added once Start has been called.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ordered, err := l.order()
+	if err != nil {
+		return err
+	}
+
+	logger := l.opts.Logger
+	begin := time.Now()
+	for _, c := range ordered {
+		timeout := orDefault(c.StartTimeout, l.opts.StartTimeout)
+		start := time.Now()
+		if err := runStep(ctx, c.Start, timeout); err != nil {
+			logger.Error("component failed to start",
+				slog.String("component", c.Name),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("error", err.Error()),
+			)
+			err = fmt.Errorf("lifecycle: starting %s: %w", c.Name, err)
+			return errors.Join(err, l.stop(context.WithoutCancel(ctx)))
+		}
+		logger.Info("component started", slog.String("component", c.Name), slog.Duration("duration", time.Since(start)))
+		l.started = append(l.started, c)
+	}
+	logger.Info("components started", slog.Int("components", len(ordered)), slog.Duration("duration", time.Since(begin)))
+	return nil
+}
+
+// Stop stops the started components in reverse start order, each within its
+// stop timeout. A component that fails to stop does not prevent the others
+// from stopping; their errors are joined. Stopping again, or before Start,
+// does nothing.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stop(ctx)
+}
+
+// stop implements Stop. l.mu must be held.
+func (l *Lifecycle) stop(ctx context.Context) error {
+	logger := l.opts.Logger
+	var errs []error
+	for _, c := range slices.Backward(l.started) {
+		timeout := orDefault(c.StopTimeout, l.opts.StopTimeout)
+		start := time.Now()
+		if err := runStep(ctx, c.Stop, timeout); err != nil {
+			logger.Error("component failed to stop",
+				slog.String("component", c.Name),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("error", err.Error()),
+			)
+			errs = append(errs, fmt.Errorf("lifecycle: stopping %s: %w", c.Name, err))
+			continue
+		}
+		logger.Info("component stopped", slog.String("component", c.Name), slog.Duration("duration", time.Since(start)))
+	}
+	l.started = nil
+	return errors.Join(errs...)
+}
+
+// orDefault returns d, or def if d is not positive.
+func orDefault(d, def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return d
+}
+
+// runStep calls fn, if not nil, giving up when timeout expires or ctx is
+// done.
+func runStep(ctx context.Context, fn func(context.Context) error, timeout time.Duration) error {
+	if fn == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				done <- fmt.Errorf("panic: %v", v)
+			}
+		}()
+		done <- fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("did not finish within %s: %w", timeout, ctx.Err())
+	}
+}
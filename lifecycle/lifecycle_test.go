@@ -0,0 +1,165 @@
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder records the steps run by the components it creates.
+type recorder struct {
+	steps []string
+}
+
+// component returns a component recording its start and stop.
+func (r *recorder) component(name string, deps ...string) Component {
+	return Component{
+		Name:      name,
+		DependsOn: deps,
+		Start: func(context.Context) error {
+			r.steps = append(r.steps, "start "+name)
+			return nil
+		},
+		Stop: func(context.Context) error {
+			r.steps = append(r.steps, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func newTestLifecycle() (*Lifecycle, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return New(Options{Logger: slog.New(slog.NewTextHandler(&buf, nil))}), &buf
+}
+
+func TestOrder(t *testing.T) {
+	var r recorder
+	l, _ := newTestLifecycle()
+	l.Add(r.component("server", "cache-warm", "queue"))
+	l.Add(r.component("cache-warm", "db"))
+	l.Add(r.component("metrics"))
+	l.Add(r.component("queue", "db"))
+	l.Add(r.component("db"))
+
+	got, err := l.Order()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"metrics", "db", "cache-warm", "queue", "server"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Order() = %v, want %v", got, want)
+	}
+}
+
+func TestOrder_Errors(t *testing.T) {
+	var r recorder
+	tests := []struct {
+		name       string
+		components []Component
+		want       string
+	}{
+		{"no name", []Component{{}}, "component has no name"},
+		{"duplicate", []Component{r.component("db"), r.component("db")}, "component db added twice"},
+		{"unknown dependency", []Component{r.component("cache", "db")}, "component cache depends on unknown component db"},
+		{"self cycle", []Component{r.component("db", "db")}, "dependency cycle: db -> db"},
+		{
+			"cycle",
+			[]Component{r.component("server", "a"), r.component("a", "b"), r.component("b", "c"), r.component("c", "a")},
+			"dependency cycle: a -> b -> c -> a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, _ := newTestLifecycle()
+			for _, c := range tt.components {
+				l.Add(c)
+			}
+			if _, err := l.Order(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Order() error = %v, want %q", err, tt.want)
+			}
+			if err := l.Start(context.Background()); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Start() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+	if len(r.steps) != 0 {
+		t.Errorf("steps %v ran despite invalid components", r.steps)
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	var r recorder
+	l, logs := newTestLifecycle()
+	l.Add(r.component("server", "cache-warm"))
+	l.Add(r.component("cache-warm", "db"))
+	l.Add(r.component("db"))
+	l.Add(Component{Name: "stateless", DependsOn: []string{"db"}})
+
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start db", "start cache-warm", "start server", "stop server", "stop cache-warm", "stop db"}
+	if !slices.Equal(r.steps, want) {
+		t.Errorf("steps = %v, want %v", r.steps, want)
+	}
+	for _, s := range []string{`msg="component started" component=db duration=`, `msg="components started" components=4`, `msg="component stopped" component=server duration=`} {
+		if !strings.Contains(logs.String(), s) {
+			t.Errorf("logs %q do not contain %q", logs, s)
+		}
+	}
+
+	// Stopping again does nothing.
+	r.steps = nil
+	if err := l.Stop(context.Background()); err != nil || len(r.steps) != 0 {
+		t.Errorf("second Stop() = %v, ran %v", err, r.steps)
+	}
+}
+
+func TestStart_FailureStopsStarted(t *testing.T) {
+	var r recorder
+	l, logs := newTestLifecycle()
+	boom := errors.New("boom")
+	l.Add(r.component("db"))
+	l.Add(r.component("cache", "db"))
+	failing := r.component("cache-warm", "cache")
+	failing.Start = func(context.Context) error { return boom }
+	l.Add(failing)
+	l.Add(r.component("server", "cache-warm"))
+
+	err := l.Start(context.Background())
+	if !errors.Is(err, boom) || !strings.Contains(err.Error(), "starting cache-warm") {
+		t.Errorf("Start() error = %v, want starting cache-warm: boom", err)
+	}
+	want := []string{"start db", "start cache", "stop cache", "stop db"}
+	if !slices.Equal(r.steps, want) {
+		t.Errorf("steps = %v, want %v", r.steps, want)
+	}
+	if !strings.Contains(logs.String(), `level=ERROR msg="component failed to start" component=cache-warm`) {
+		t.Errorf("logs %q do not report the failure", logs)
+	}
+}
+
+func TestTimeoutsAndPanics(t *testing.T) {
+	l := New(Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil)), StopTimeout: 10 * time.Millisecond})
+	block := func(context.Context) error { select {} }
+	l.Add(Component{Name: "ignores-ctx", Stop: block})
+	l.Add(Component{Name: "panics", DependsOn: []string{"ignores-ctx"}, Stop: func(context.Context) error { panic("oops") }})
+	l.Add(Component{Name: "slow", DependsOn: []string{"panics"}, StartTimeout: 10 * time.Millisecond, Start: block})
+
+	err := l.Start(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "starting slow: did not finish within 10ms") {
+		t.Errorf("Start() error = %v, want a timeout starting slow", err)
+	}
+	if !strings.Contains(err.Error(), "stopping panics: panic: oops") || !strings.Contains(err.Error(), "stopping ignores-ctx: did not finish within 10ms") {
+		t.Errorf("Start() error = %v, want the errors stopping the started components", err)
+	}
+}
@@ -0,0 +1,208 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// AsyncOptions configures NewAsyncHandler. Zero values are defaults.
+type AsyncOptions struct {
+	// BufferSize is how many records the ring buffer holds. Defaults to
+	// 1024.
+	BufferSize int
+	// DropWhenFull overwrites the oldest buffered record when the buffer is
+	// full, so that logging never blocks, and counts it in Dropped. By
+	// default Handle waits for room, so no record is lost.
+	DropWhenFull bool
+}
+
+// AsyncHandler is the slog.Handler returned by NewAsyncHandler.
+type AsyncHandler struct {
+	next slog.Handler
+	q    *asyncQueue
+}
+
+// NewAsyncHandler returns a handler that buffers records in a ring buffer
+// and passes them to next on a background goroutine, so that request paths
+// do not block on a slow stdout or pipe. Records are written in the order
+// they were handled. Values logged must not be modified afterwards, as next
+// formats them later.
+//
+// Flush waits until the buffered records are written, and Close flushes and
+// stops the goroutine; records handled after Close are written
+// synchronously. Loggers derived with With and WithGroup share the buffer.
+// Register Close as a shutdown hook, or install the handler with WithAsync,
+// which server.Run flushes on shutdown, so no records are lost on SIGTERM:
+//
+//	h := logging.NewAsyncHandler(slog.NewJSONHandler(os.Stdout, nil), logging.AsyncOptions{})
+//	server.Run(ctx, mux, server.WithShutdownHook("logs", 0, h.Close))
+//
+// Errors returned by next are discarded, as slog.Logger discards them.
+func NewAsyncHandler(next slog.Handler, opts AsyncOptions) *AsyncHandler {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 1024
+	}
+	q := &asyncQueue{
+		dropWhenFull: opts.DropWhenFull,
+		buf:          make([]asyncEntry, opts.BufferSize),
+		done:         make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	go q.run()
+	return &AsyncHandler{next: next, q: q}
+}
+
+func (h *AsyncHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *AsyncHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !h.q.push(asyncEntry{ctx: context.WithoutCancel(ctx), handler: h.next, record: r.Clone()}) {
+		return h.next.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (h *AsyncHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &AsyncHandler{next: h.next.WithAttrs(attrs), q: h.q}
+}
+
+func (h *AsyncHandler) WithGroup(name string) slog.Handler {
+	return &AsyncHandler{next: h.next.WithGroup(name), q: h.q}
+}
+
+// Flush waits until the records handled before the call have been written,
+// or ctx is done.
+func (h *AsyncHandler) Flush(ctx context.Context) error {
+	return h.q.flush(ctx)
+}
+
+// Close flushes the buffer, within ctx, and stops the background goroutine.
+// Closing again does nothing.
+func (h *AsyncHandler) Close(ctx context.Context) error {
+	h.q.mu.Lock()
+	if !h.q.closed {
+		h.q.closed = true
+		h.q.cond.Broadcast()
+	}
+	h.q.mu.Unlock()
+	select {
+	case <-h.q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Dropped returns how many records were overwritten because the buffer was
+// full, with DropWhenFull.
+func (h *AsyncHandler) Dropped() uint64 {
+	return h.q.dropped.Load()
+}
+
+// asyncEntry is a buffered record with the handler that writes it.
+type asyncEntry struct {
+	ctx     context.Context
+	handler slog.Handler
+	record  slog.Record
+}
+
+// asyncQueue is the ring buffer shared by an AsyncHandler and the handlers
+// derived from it.
+type asyncQueue struct {
+	dropWhenFull bool
+	dropped      atomic.Uint64
+	done         chan struct{} // closed when run returns
+
+	mu      sync.Mutex
+	cond    *sync.Cond // signalled when records are pushed or written, and on close
+	buf     []asyncEntry
+	head    int    // index of the oldest record
+	n       int    // records buffered
+	pushed  uint64 // records ever pushed
+	written uint64 // records ever written or dropped
+	closed  bool
+}
+
+// push buffers e, waiting for room unless dropWhenFull. It reports false if
+// the queue is closed, leaving e to be written by the caller.
+func (q *asyncQueue) push(e asyncEntry) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.n == len(q.buf) && !q.dropWhenFull && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return false
+	}
+	if q.n == len(q.buf) {
+		q.buf[q.head] = asyncEntry{}
+		q.head = (q.head + 1) % len(q.buf)
+		q.n--
+		q.written++
+		q.dropped.Add(1)
+	}
+	q.buf[(q.head+q.n)%len(q.buf)] = e
+	q.n++
+	q.pushed++
+	q.cond.Broadcast()
+	return true
+}
+
+// run writes buffered records until the queue is closed and empty.
+func (q *asyncQueue) run() {
+	defer close(q.done)
+	batch := make([]asyncEntry, 0, len(q.buf))
+	for {
+		q.mu.Lock()
+		for q.n == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.n == 0 {
+			q.mu.Unlock()
+			return
+		}
+		for ; q.n > 0; q.n-- {
+			batch = append(batch, q.buf[q.head])
+			q.buf[q.head] = asyncEntry{}
+			q.head = (q.head + 1) % len(q.buf)
+		}
+		// Room is free again for writers waiting in push.
+		q.cond.Broadcast()
+		q.mu.Unlock()
+
+		for _, e := range batch {
+			e.handler.Handle(e.ctx, e.record)
+		}
+
+		q.mu.Lock()
+		q.written += uint64(len(batch))
+		q.cond.Broadcast()
+		q.mu.Unlock()
+		clear(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush waits until the records pushed so far are written, or ctx is done.
+func (q *asyncQueue) flush(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.cond.Broadcast()
+	})
+	defer stop()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	target := q.pushed
+	for q.written < target {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		q.cond.Wait()
+	}
+	return nil
+}
@@ -26,6 +26,46 @@
 //   - "WARN": WARN level and above (default)
 //   - "ERROR": ERROR level only
 //
+// Output options:
+//
+// WithWriter, WithFormat, WithSource, WithTimeFormat and WithAttrs change
+// where and how records are written, and NewLogger builds a logger with them
+// without installing it:
+//
+//	logging.SetDefaultLogger(cfg,
+//		logging.WithFormat(logging.FormatJSON),
+//		logging.WithAttrs(slog.String("service", "billing"), slog.String("version", version)),
+//	)
+//
+// Redacting secrets:
+//
+// WithRedaction wraps the handler in NewRedactingHandler, which replaces the
+// values of attributes with sensitive keys, such as "authorization" and
+// "api_key", and email addresses and card numbers anywhere in messages and
+// string values:
+//
+//	logging.SetDefaultLogger(cfg, logging.WithRedaction(logging.RedactOptions{}))
+//
+// Options are remembered, so later calls without options keep redacting.
+//
+// Sampling:
+//
+// NewSamplingHandler, or WithSampling, passes the first records with each
+// message and level in every second and then one in a hundred, while WARN
+// and ERROR records always pass, to keep the volume of busy services down.
+//
+// Asynchronous output:
+//
+// NewAsyncHandler, or WithAsync, buffers records in a ring buffer and writes
+// them on a background goroutine, so slow output does not block requests.
+// Flush writes out the default logger's buffer; server.Run calls it on
+// shutdown, so records are not lost on SIGTERM.
+//
+// Following configuration changes:
+//
+// FollowConfig installs the logger from a config.Watcher and reinstalls it
+// whenever a reload changes the log level or environment.
+//
 // Concurrency:
 //
 // SetDefaultLogger is NOT safe for concurrent use. It should be called once during
@@ -1,40 +1,281 @@
 package logging
 
 import (
+	"context"
+	"io"
 	"log/slog"
 	"os"
+	"sync"
 
 	"github.com/harrydayexe/GoWebUtilities/config"
 )
 
+// level is the minimum level of the logger installed by SetDefaultLogger. It
+// is shared by every logger SetDefaultLogger creates, so SetLevel takes effect
+// without replacing the default logger.
+var level slog.LevelVar
+
+// Format is the output format of a logger.
+type Format string
+
+const (
+	// FormatAuto chooses by environment: text in Local, JSON otherwise.
+	FormatAuto Format = ""
+	// FormatText is slog's key=value text format.
+	FormatText Format = "text"
+	// FormatJSON is slog's JSON format, one object per line.
+	FormatJSON Format = "json"
+)
+
+// Option configures the logger created by SetDefaultLogger or NewLogger.
+type Option func(*options)
+
+type options struct {
+	redact     *RedactOptions
+	sampling   *SamplingOptions
+	async      *AsyncOptions
+	writer     io.Writer
+	format     Format
+	addSource  bool
+	timeFormat string
+	attrs      []slog.Attr
+}
+
+// WithSampling wraps the logger's handler in NewSamplingHandler, so
+// repetitive records below WARN are sampled as opts describes.
+func WithSampling(opts SamplingOptions) Option {
+	return func(o *options) {
+		o.sampling = &opts
+	}
+}
+
+// WithAsync writes records on a background goroutine through
+// NewAsyncHandler, so that logging does not block on slow output. The
+// default logger's buffer is flushed by Flush, which server.Run calls on
+// shutdown, and closed when SetDefaultLogger replaces the logger.
+func WithAsync(opts AsyncOptions) Option {
+	return func(o *options) {
+		o.async = &opts
+	}
+}
+
+// WithWriter writes log output to w instead of os.Stdout.
+func WithWriter(w io.Writer) Option {
+	return func(o *options) {
+		o.writer = w
+	}
+}
+
+// WithFormat uses format regardless of the environment.
+func WithFormat(format Format) Option {
+	return func(o *options) {
+		o.format = format
+	}
+}
+
+// WithSource adds the source file and line of the logging call to each
+// record, under the "source" key.
+func WithSource() Option {
+	return func(o *options) {
+		o.addSource = true
+	}
+}
+
+// WithTimeFormat formats record times with layout, as time.Time.Format does,
+// such as time.Kitchen for terse local output. slog's default is RFC 3339
+// with milliseconds in text and nanoseconds in JSON.
+func WithTimeFormat(layout string) Option {
+	return func(o *options) {
+		o.timeFormat = layout
+	}
+}
+
+// WithAttrs adds attrs to every record, such as the service name and version.
+// Several WithAttrs options add up.
+func WithAttrs(attrs ...slog.Attr) Option {
+	return func(o *options) {
+		o.attrs = append(o.attrs, attrs...)
+	}
+}
+
+// WithRedaction wraps the logger's handler in NewRedactingHandler, so
+// secrets matching opts never reach the log output.
+func WithRedaction(opts RedactOptions) Option {
+	return func(o *options) {
+		o.redact = &opts
+	}
+}
+
+// defaultOptions are the options last given to SetDefaultLogger, and
+// defaultAsync the buffer of the logger it installed with WithAsync.
+var (
+	defaultOptionsMu sync.Mutex
+	defaultOptions   []Option
+	defaultAsync     *AsyncHandler
+)
+
 // SetDefaultLogger configures the default slog logger based on the provided ServerConfig.
 // It sets the global default logger used by slog.Info, slog.Debug, and other top-level
 // slog functions.
 //
 // The function configures two aspects:
-//   - Log level: configured by cfg.LogLevel (DEBUG, INFO, WARN, or ERROR)
+//   - Log level: configured by cfg.LogLevel (DEBUG, INFO, WARN, or ERROR);
+//     it can later be changed with SetLevel
 //   - Handler type: Text for Local environment, JSON for Test/Production
 //
 // Log handlers write to os.Stdout. All log output includes timestamps and context fields.
+// Options change these defaults; see NewLogger.
+//
+// Options, such as WithRedaction, are kept for later calls made without
+// options, including those server.Run makes at startup and on reload, so
+// configure them once in main:
+//
+//	logging.SetDefaultLogger(cfg, logging.WithRedaction(logging.RedactOptions{}))
 //
 // This function is NOT safe for concurrent use and modifies global state via slog.SetDefault.
 // Call it once during application initialization (e.g., in main(), before starting the server)
 // before any goroutines that use logging are spawned.
+// server.Run also calls it when reloading configuration on SIGHUP; loggers
+// obtained from slog.Default before then keep their previous handler but
+// follow the new level.
 //
 // Example:
 //
 //	cfg, _ := config.ParseConfig[config.ServerConfig]()
 //	logging.SetDefaultLogger(cfg)
 //	slog.Info("server starting", "environment", cfg.Environment)
-func SetDefaultLogger(cfg config.ServerConfig) {
-	handlerOptions := slog.HandlerOptions{Level: cfg.LogLevel}
+func SetDefaultLogger(cfg config.ServerConfig, opts ...Option) {
+	defaultOptionsMu.Lock()
+	if len(opts) > 0 {
+		defaultOptions = opts
+	}
+	opts = defaultOptions
+	defaultOptionsMu.Unlock()
+
+	level.Set(cfg.LogLevel)
+	handler, async := newHandler(cfg, &level, opts, true)
+	slog.SetDefault(slog.New(handler))
+
+	defaultOptionsMu.Lock()
+	previous := defaultAsync
+	defaultAsync = async
+	defaultOptionsMu.Unlock()
+	if previous != nil {
+		// Loggers still holding the old handler write synchronously once
+		// it is closed.
+		previous.Close(context.Background())
+	}
+}
+
+// Flush waits until the records buffered by the default logger, if it was
+// installed by SetDefaultLogger with WithAsync, are written, or ctx is done.
+// server.Run and RunGroup call it once they have shut down.
+func Flush(ctx context.Context) error {
+	defaultOptionsMu.Lock()
+	async := defaultAsync
+	defaultOptionsMu.Unlock()
+	if async == nil {
+		return nil
+	}
+	return async.Flush(ctx)
+}
+
+// NewLogger returns a logger configured like the one SetDefaultLogger
+// installs, without installing it or remembering opts. Its level is fixed
+// at cfg.LogLevel; SetLevel does not change it. WithAsync is ignored, as
+// nothing could flush the buffer; wrap a handler with NewAsyncHandler
+// instead. Without options it writes
+// text in Local and JSON elsewhere to os.Stdout; options change the output:
+//
+//	logger := logging.NewLogger(cfg,
+//	    logging.WithWriter(f),
+//	    logging.WithFormat(logging.FormatJSON),
+//	    logging.WithSource(),
+//	    logging.WithAttrs(slog.String("service", "billing"), slog.String("version", version)),
+//	)
+func NewLogger(cfg config.ServerConfig, opts ...Option) *slog.Logger {
+	handler, _ := newHandler(cfg, cfg.LogLevel, opts, false)
+	return slog.New(handler)
+}
+
+// newHandler returns the handler described by cfg and opts and, with
+// WithAsync if allowAsync, its buffer.
+func newHandler(cfg config.ServerConfig, lvl slog.Leveler, opts []Option, allowAsync bool) (slog.Handler, *AsyncHandler) {
+	o := options{writer: os.Stdout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	handlerOptions := slog.HandlerOptions{Level: lvl, AddSource: o.addSource}
+	if o.timeFormat != "" {
+		handlerOptions.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 && a.Value.Kind() == slog.KindTime {
+				a.Value = slog.StringValue(a.Value.Time().Format(o.timeFormat))
+			}
+			return a
+		}
+	}
 
-	var logger *slog.Logger
-	if cfg.Environment == config.Local {
-		logger = slog.New(slog.NewTextHandler(os.Stdout, &handlerOptions))
+	format := o.format
+	if format == FormatAuto {
+		format = FormatJSON
+		if cfg.Environment == config.Local {
+			format = FormatText
+		}
+	}
+	var handler slog.Handler
+	if format == FormatText {
+		handler = slog.NewTextHandler(o.writer, &handlerOptions)
 	} else {
-		logger = slog.New(slog.NewJSONHandler(os.Stdout, &handlerOptions))
+		handler = slog.NewJSONHandler(o.writer, &handlerOptions)
+	}
+	// Only formatting and writing move to the background; redaction and
+	// sampling stay on the logging goroutine, while the values are current.
+	var async *AsyncHandler
+	if o.async != nil && allowAsync {
+		async = NewAsyncHandler(handler, *o.async)
+		handler = async
+	}
+	if o.redact != nil {
+		handler = NewRedactingHandler(handler, *o.redact)
 	}
+	if o.sampling != nil {
+		handler = NewSamplingHandler(handler, *o.sampling)
+	}
+	if len(o.attrs) > 0 {
+		handler = handler.WithAttrs(o.attrs)
+	}
+	return handler, async
+}
+
+// Level returns the current minimum level of the logger installed by
+// SetDefaultLogger.
+func Level() slog.Level {
+	return level.Level()
+}
+
+// SetLevel changes the minimum level of the logger installed by
+// SetDefaultLogger, including loggers derived from it, without replacing it.
+// The change lasts until SetDefaultLogger is called again, for example when
+// server.Run reloads the configuration. SetLevel is safe for concurrent use.
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
 
-	slog.SetDefault(logger)
+// FollowConfig sets the default logger from the current configuration of w
+// with SetDefaultLogger, and again whenever a reload changes its LogLevel or
+// Environment, so verbosity can be raised on a running server by editing its
+// config file. A level set with SetLevel lasts until the next such change.
+// FollowConfig returns a function that stops following w.
+func FollowConfig(w *config.Watcher[config.ServerConfig]) (stop func()) {
+	SetDefaultLogger(w.Current())
+	return w.Subscribe(func(c config.Change[config.ServerConfig]) {
+		if c.New.LogLevel != c.Old.LogLevel || c.New.Environment != c.Old.Environment {
+			SetDefaultLogger(c.New)
+			slog.Default().Info("logger reconfigured",
+				slog.String("level", c.New.LogLevel.String()),
+				slog.String("environment", c.New.Environment.String()),
+			)
+		}
+	})
 }
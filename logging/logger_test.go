@@ -3,10 +3,16 @@ package logging
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/harrydayexe/GoWebUtilities/config"
 )
@@ -474,3 +480,429 @@ func TestSetDefaultLogger_ActualLogging(t *testing.T) {
 		})
 	}
 }
+
+// TestSetLevel verifies that the level of the default logger can be changed
+// at runtime, including for loggers derived from it.
+func TestSetLevel(t *testing.T) {
+	original := saveDefaultLogger()
+	defer slog.SetDefault(original)
+
+	SetDefaultLogger(config.ServerConfig{Environment: config.Production, LogLevel: slog.LevelWarn})
+	derived := slog.Default().With("component", "test")
+
+	SetLevel(slog.LevelDebug)
+	if Level() != slog.LevelDebug {
+		t.Errorf("Level() = %v, want DEBUG", Level())
+	}
+	if got := getLogLevel(derived); got != slog.LevelDebug {
+		t.Errorf("derived logger level = %v, want DEBUG", got)
+	}
+
+	SetDefaultLogger(config.ServerConfig{Environment: config.Production, LogLevel: slog.LevelError})
+	if got := getLogLevel(slog.Default()); got != slog.LevelError {
+		t.Errorf("level after SetDefaultLogger = %v, want ERROR", got)
+	}
+}
+
+func TestFollowConfig(t *testing.T) {
+	original := saveDefaultLogger()
+	defer slog.SetDefault(original)
+
+	vars := map[string]string{"LOG_LEVEL": "WARN", "ENVIRONMENT": "test"}
+	var mu sync.Mutex
+	source := config.SourceFunc(func() (map[string]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return map[string]string{"LOG_LEVEL": vars["LOG_LEVEL"], "ENVIRONMENT": vars["ENVIRONMENT"]}, nil
+	})
+	w, err := config.NewWatcher[config.ServerConfig](config.WatcherOptions{}, source)
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+
+	stop := FollowConfig(w)
+	if Level() != slog.LevelWarn {
+		t.Errorf("Level() = %v, want WARN from the initial config", Level())
+	}
+
+	mu.Lock()
+	vars["LOG_LEVEL"] = "DEBUG"
+	mu.Unlock()
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if Level() != slog.LevelDebug {
+		t.Errorf("Level() = %v after reload, want DEBUG", Level())
+	}
+
+	stop()
+	mu.Lock()
+	vars["LOG_LEVEL"] = "ERROR"
+	mu.Unlock()
+	w.Reload()
+	if Level() != slog.LevelDebug {
+		t.Errorf("Level() = %v after stop, want DEBUG unchanged", Level())
+	}
+}
+
+// TestNewRedactingHandler verifies that sensitive keys and values are
+// scrubbed from messages, attributes, groups and derived loggers.
+func TestNewRedactingHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewRedactingHandler(slog.NewJSONHandler(&buf, nil), RedactOptions{}))
+
+	logger.With(slog.String("api_key", "k-123")).WithGroup("req").Info("login by ada@example.com",
+		slog.String("user", "ada"),
+		slog.String("Authorization", "Bearer abc"),
+		slog.Group("body", slog.String("new_password", "hunter2"), slog.Int("age", 36)),
+		slog.String("note", "card 4111 1111 1111 1111 on file"),
+		slog.Any("headers", http.Header{"Cookie": {"session=1"}, "Accept": {"text/html"}}),
+		slog.Any("fields", map[string]string{"X-Token": "t", "mail": "bob@example.org"}),
+		slog.Any("error", errors.New("no user grace@example.net")),
+		slog.Any("extra", map[string]any{"secret": 42, "nested": map[string]any{"refresh_token": "r"}}),
+	)
+	out := buf.String()
+	for _, leaked := range []string{"k-123", "ada@example.com", "Bearer abc", "hunter2", "4111", "session=1", `"t"`, "bob@example.org", "grace@example.net", `"secret":42`, `"r"`} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("output %s contains %q", out, leaked)
+		}
+	}
+	for _, kept := range []string{`"msg":"login by [REDACTED]"`, `"api_key":"[REDACTED]"`, `"user":"ada"`, `"age":36`, `"note":"card [REDACTED] on file"`, `"Accept":["text/html"]`, `"error":"no user [REDACTED]"`} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("output %s does not contain %s", out, kept)
+		}
+	}
+
+	buf.Reset()
+	custom := slog.New(NewRedactingHandler(slog.NewJSONHandler(&buf, nil), RedactOptions{
+		Keys:        []string{"ssn"},
+		Patterns:    []*regexp.Regexp{regexp.MustCompile(`\d{3}-\d{2}-\d{4}`)},
+		Replacement: "***",
+	}))
+	custom.Info("ids", slog.String("ssn", "x"), slog.String("text", "078-05-1120"), slog.String("password", "shown"))
+	if got := buf.String(); !strings.Contains(got, `"ssn":"***","text":"***","password":"shown"`) {
+		t.Errorf("custom redaction output = %s", got)
+	}
+}
+
+func TestIsSecretName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"Authorization":       true,
+		"Proxy-Authorization": true,
+		"Set-Cookie":          true,
+		"APIKey":              true,
+		"aws_credentials":     true,
+		"access_token":        true,
+		"DBPassword":          true,
+		"Content-Type":        false,
+		"user":                false,
+	} {
+		if got := IsSecretName(name); got != want {
+			t.Errorf("IsSecretName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+// TestSetDefaultLogger_WithRedaction verifies that redaction is installed
+// and kept by later calls without options.
+func TestSetDefaultLogger_WithRedaction(t *testing.T) {
+	original := saveDefaultLogger()
+	defer slog.SetDefault(original)
+	defer func() { defaultOptions = nil }()
+
+	cfg := config.ServerConfig{Environment: config.Production, LogLevel: slog.LevelInfo}
+	SetDefaultLogger(cfg, WithRedaction(RedactOptions{}))
+	if _, ok := slog.Default().Handler().(*redactingHandler); !ok {
+		t.Fatalf("handler = %T, want a redacting handler", slog.Default().Handler())
+	}
+	SetDefaultLogger(cfg)
+	if _, ok := slog.Default().Handler().(*redactingHandler); !ok {
+		t.Errorf("handler = %T after a call without options, want a redacting handler", slog.Default().Handler())
+	}
+}
+
+// TestNewLogger verifies the output options of NewLogger.
+func TestNewLogger(t *testing.T) {
+	local := config.ServerConfig{Environment: config.Local, LogLevel: slog.LevelInfo}
+
+	t.Run("forced JSON with source, time format and attrs", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := NewLogger(local,
+			WithWriter(&buf),
+			WithFormat(FormatJSON),
+			WithSource(),
+			WithTimeFormat(time.DateOnly),
+			WithAttrs(slog.String("service", "billing")),
+			WithAttrs(slog.String("version", "1.2.3")),
+		)
+		logger.Info("hello")
+
+		var record map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+			t.Fatalf("output %q is not JSON: %v", buf.String(), err)
+		}
+		if got, want := record["time"], time.Now().Format(time.DateOnly); got != want {
+			t.Errorf("time = %v, want %v", got, want)
+		}
+		if record["service"] != "billing" || record["version"] != "1.2.3" {
+			t.Errorf("record %v lacks the default attributes", record)
+		}
+		source, _ := record["source"].(map[string]any)
+		if file, _ := source["file"].(string); !strings.HasSuffix(file, "logger_test.go") {
+			t.Errorf("source = %v, want this file", record["source"])
+		}
+	})
+
+	t.Run("forced text and fixed level", func(t *testing.T) {
+		var buf bytes.Buffer
+		cfg := config.ServerConfig{Environment: config.Production, LogLevel: slog.LevelWarn}
+		logger := NewLogger(cfg, WithWriter(&buf), WithFormat(FormatText))
+		defer SetLevel(Level())
+		SetLevel(slog.LevelDebug)
+		logger.Info("dropped")
+		logger.Warn("kept")
+		if out := buf.String(); strings.Contains(out, "dropped") || !strings.HasPrefix(out, "time=") || !strings.Contains(out, "msg=kept") {
+			t.Errorf("output = %q, want only the WARN record as text", out)
+		}
+	})
+
+	t.Run("redacted default attrs", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := NewLogger(local, WithWriter(&buf), WithRedaction(RedactOptions{}), WithAttrs(slog.String("api_key", "k")))
+		logger.Info("hello")
+		if out := buf.String(); !strings.Contains(out, "api_key=[REDACTED]") {
+			t.Errorf("output = %q, want the default attribute redacted", out)
+		}
+	})
+}
+
+// TestSetDefaultLogger_WithWriter verifies that SetDefaultLogger honours the
+// output options.
+func TestSetDefaultLogger_WithWriter(t *testing.T) {
+	original := saveDefaultLogger()
+	defer slog.SetDefault(original)
+	defer func() { defaultOptions = nil }()
+
+	var buf bytes.Buffer
+	SetDefaultLogger(config.ServerConfig{Environment: config.Local, LogLevel: slog.LevelInfo},
+		WithWriter(&buf), WithFormat(FormatJSON), WithAttrs(slog.String("service", "api")))
+	slog.Info("hello")
+	if out := buf.String(); !strings.Contains(out, `"msg":"hello","service":"api"`) {
+		t.Errorf("output = %q, want a JSON record with the service attribute", out)
+	}
+}
+
+// TestSamplingHandler verifies that repetitive records are sampled per
+// message, level and window while WARN and above always pass.
+func TestSamplingHandler(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := newSamplingHandler(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}),
+		SamplingOptions{First: 2, Thereafter: 3}, func() time.Time { return now })
+	logger := slog.New(h)
+	derived := logger.With(slog.String("k", "v"))
+
+	count := func(msg string) int {
+		return strings.Count(buf.String(), "msg="+msg+"\n") + strings.Count(buf.String(), "msg="+msg+" ")
+	}
+	for range 8 {
+		logger.Info("request")
+	}
+	// 1 and 2 pass, then every third after them: 5 and 8.
+	if got := count("request"); got != 4 {
+		t.Errorf("INFO records passed = %d, want 4", got)
+	}
+	for range 2 {
+		derived.Info("request") // counts 9 and 10: dropped, as derived loggers share counts
+	}
+	logger.Debug("request") // a different level is counted apart
+	logger.Info("other")
+	for range 5 {
+		logger.Error("request")
+	}
+	if got := count("request"); got != 4+1+5 {
+		t.Errorf("records passed = %d, want %d", got, 4+1+5)
+	}
+	if got := count("other"); got != 1 {
+		t.Errorf("other records passed = %d, want 1", got)
+	}
+	if got := h.Dropped(); got != 6 {
+		t.Errorf("Dropped() = %d, want 6", got)
+	}
+
+	now = now.Add(time.Second)
+	buf.Reset()
+	logger.Info("request")
+	if got := count("request"); got != 1 {
+		t.Errorf("records passed in a new window = %d, want 1", got)
+	}
+}
+
+// TestNewLogger_WithSampling verifies that WithSampling drops repetitive
+// records.
+func TestNewLogger_WithSampling(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := config.ServerConfig{Environment: config.Local, LogLevel: slog.LevelInfo}
+	logger := NewLogger(cfg, WithWriter(&buf), WithSampling(SamplingOptions{First: 1, Thereafter: 1000}))
+	for range 10 {
+		logger.Info("tick")
+	}
+	if got := strings.Count(buf.String(), "msg=tick"); got != 1 {
+		t.Errorf("records written = %d, want 1", got)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for the background writes of an
+// AsyncHandler, optionally slow.
+type syncBuffer struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	delay time.Duration
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	time.Sleep(b.delay)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestAsyncHandler verifies that records are written in order in the
+// background, that Flush and Close wait for them, and that records handled
+// after Close are written synchronously.
+func TestAsyncHandler(t *testing.T) {
+	out := &syncBuffer{delay: time.Millisecond}
+	h := NewAsyncHandler(slog.NewTextHandler(out, nil), AsyncOptions{BufferSize: 4})
+	logger := slog.New(h)
+	derived := logger.With(slog.String("k", "v"))
+
+	for i := range 20 {
+		if i%2 == 0 {
+			logger.Info("record", slog.Int("i", i))
+		} else {
+			derived.Info("record", slog.Int("i", i))
+		}
+	}
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 20 {
+		t.Fatalf("wrote %d lines, want 20:\n%s", len(lines), out)
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, " i="+strconv.Itoa(i)) || strings.Contains(line, "k=v") != (i%2 == 1) {
+			t.Errorf("line %d = %q", i, line)
+		}
+	}
+	if h.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0 without DropWhenFull", h.Dropped())
+	}
+
+	logger.Info("before close")
+	if err := h.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	logger.Info("after close")
+	if got := out.String(); !strings.Contains(got, "before close") || !strings.Contains(got, "after close") {
+		t.Errorf("output %q lacks records handled around Close", got)
+	}
+	if err := h.Close(context.Background()); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+// TestAsyncHandler_DropWhenFull verifies that a full buffer overwrites the
+// oldest records instead of blocking.
+func TestAsyncHandler_DropWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	blocking := writerFunc(func(p []byte) (int, error) {
+		<-release
+		return len(p), nil
+	})
+	h := NewAsyncHandler(slog.NewTextHandler(blocking, nil), AsyncOptions{BufferSize: 2, DropWhenFull: true})
+	logger := slog.New(h)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 10 {
+			logger.Info("record")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging blocked on a full buffer")
+	}
+	close(release)
+	if err := h.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	// The writer holds at most one batch while the buffer holds two more.
+	if got := h.Dropped(); got < 10-1-2 {
+		t.Errorf("Dropped() = %d, want at least %d", got, 10-1-2)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	unblock := make(chan struct{})
+	stuck := NewAsyncHandler(slog.NewTextHandler(writerFunc(func(p []byte) (int, error) {
+		<-unblock
+		return len(p), nil
+	}), nil), AsyncOptions{})
+	defer stuck.Close(context.Background())
+	defer close(unblock)
+	slog.New(stuck).Info("not written yet")
+	if err := stuck.Flush(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Flush() with a cancelled context = %v, want %v", err, context.Canceled)
+	}
+}
+
+// writerFunc is an io.Writer implemented by a function.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+// TestSetDefaultLogger_WithAsync verifies that Flush writes out the default
+// logger's buffer and that replacing the logger closes the old buffer.
+func TestSetDefaultLogger_WithAsync(t *testing.T) {
+	original := saveDefaultLogger()
+	defer slog.SetDefault(original)
+	defer func() {
+		if defaultAsync != nil {
+			defaultAsync.Close(context.Background())
+		}
+		defaultOptions, defaultAsync = nil, nil
+	}()
+
+	out := &syncBuffer{delay: time.Millisecond}
+	cfg := config.ServerConfig{Environment: config.Local, LogLevel: slog.LevelInfo}
+	SetDefaultLogger(cfg, WithWriter(out), WithAsync(AsyncOptions{}))
+	old := slog.Default()
+	for range 5 {
+		slog.Info("buffered")
+	}
+	if err := Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if got := strings.Count(out.String(), "msg=buffered"); got != 5 {
+		t.Errorf("records written after Flush = %d, want 5", got)
+	}
+
+	first := defaultAsync
+	SetDefaultLogger(cfg)
+	if defaultAsync == nil || defaultAsync == first {
+		t.Fatal("SetDefaultLogger did not install a new buffer")
+	}
+	old.Info("through the old logger")
+	if !strings.Contains(out.String(), "through the old logger") {
+		t.Error("record logged through the replaced logger was not written synchronously")
+	}
+}
@@ -0,0 +1,207 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// DefaultRedactedKeys are the name fragments, in lower case, of values that
+// are secret: "key" covers "api_key" and "APIKey", and "authorization" and
+// "cookie" cover Proxy-Authorization and Set-Cookie. NewRedactingHandler
+// redacts attributes with these keys by default, and the body and detailed
+// request logging of package middleware and the reports of package
+// crashreport mask the same names, so the list is kept in one place.
+var DefaultRedactedKeys = []string{
+	"authorization", "cookie", "credential", "key", "passwd", "password", "secret", "token",
+}
+
+// IsSecretName reports whether name, such as an attribute key, header,
+// field or query parameter name, contains one of DefaultRedactedKeys,
+// ignoring case.
+func IsSecretName(name string) bool {
+	return containsFragment(strings.ToLower(name), DefaultRedactedKeys)
+}
+
+// containsFragment reports whether s contains one of fragments.
+func containsFragment(s string, fragments []string) bool {
+	for _, f := range fragments {
+		if strings.Contains(s, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// Patterns of sensitive values, redacted by default wherever they appear in
+// messages and string values.
+var (
+	// EmailPattern matches email addresses.
+	EmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	// CardNumberPattern matches payment card numbers: 13 to 19 digits,
+	// optionally separated by spaces or dashes. Other numbers of that length
+	// in strings, such as millisecond timestamps, match too.
+	CardNumberPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+)
+
+// DefaultRedactedPatterns are the value patterns NewRedactingHandler
+// redacts by default.
+var DefaultRedactedPatterns = []*regexp.Regexp{EmailPattern, CardNumberPattern}
+
+// RedactOptions configures NewRedactingHandler. Zero values are defaults.
+type RedactOptions struct {
+	// Keys are fragments of the keys of attributes whose values are
+	// replaced, compared ignoring case: "token" redacts "token",
+	// "access_token" and "X-Token" alike. They apply at any depth of groups
+	// and to the keys of logged maps and http.Headers. Defaults to
+	// DefaultRedactedKeys.
+	Keys []string
+	// Patterns match sensitive text replaced wherever it appears in the
+	// message, string values and errors. Defaults to DefaultRedactedPatterns.
+	Patterns []*regexp.Regexp
+	// Replacement replaces redacted values. Defaults to "[REDACTED]".
+	Replacement string
+}
+
+// NewRedactingHandler returns a handler that scrubs secrets from every
+// record before passing it to next: attributes whose keys match opts.Keys
+// have their values replaced, and text matching opts.Patterns is replaced in
+// messages, string values, errors and the values of logged maps, header
+// sets and string slices. LogValuers are resolved first, so their values are
+// scrubbed too. Other values, such as numbers and structs, are passed on
+// as they are.
+func NewRedactingHandler(next slog.Handler, opts RedactOptions) slog.Handler {
+	if opts.Keys == nil {
+		opts.Keys = DefaultRedactedKeys
+	}
+	if opts.Patterns == nil {
+		opts.Patterns = DefaultRedactedPatterns
+	}
+	if opts.Replacement == "" {
+		opts.Replacement = "[REDACTED]"
+	}
+	keys := make([]string, len(opts.Keys))
+	for i, k := range opts.Keys {
+		keys[i] = strings.ToLower(k)
+	}
+	return &redactingHandler{next: next, r: &redactor{keys: keys, patterns: opts.Patterns, replacement: opts.Replacement}}
+}
+
+// redactingHandler is the slog.Handler returned by NewRedactingHandler.
+type redactingHandler struct {
+	next slog.Handler
+	r    *redactor
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, rec slog.Record) error {
+	out := slog.NewRecord(rec.Time, rec.Level, h.r.text(rec.Message), rec.PC)
+	rec.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.r.attr(a))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	scrubbed := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		scrubbed[i] = h.r.attr(a)
+	}
+	return &redactingHandler{next: h.next.WithAttrs(scrubbed), r: h.r}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name), r: h.r}
+}
+
+// redactor scrubs attributes and text.
+type redactor struct {
+	keys        []string // lower case
+	patterns    []*regexp.Regexp
+	replacement string
+}
+
+// sensitive reports whether values under key are redacted.
+func (r *redactor) sensitive(key string) bool {
+	return containsFragment(strings.ToLower(key), r.keys)
+}
+
+// text replaces the patterns in s.
+func (r *redactor) text(s string) string {
+	for _, p := range r.patterns {
+		s = p.ReplaceAllString(s, r.replacement)
+	}
+	return s
+}
+
+// attr returns a with its value scrubbed.
+func (r *redactor) attr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	if r.sensitive(a.Key) {
+		return slog.String(a.Key, r.replacement)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(r.text(a.Value.String()))
+	case slog.KindGroup:
+		attrs := a.Value.Group()
+		scrubbed := make([]slog.Attr, len(attrs))
+		for i, ga := range attrs {
+			scrubbed[i] = r.attr(ga)
+		}
+		a.Value = slog.GroupValue(scrubbed...)
+	case slog.KindAny:
+		a.Value = r.any(a.Value.Any())
+	}
+	return a
+}
+
+// any returns the scrubbed value of v, for the types that commonly carry
+// secrets; other values are returned as they are.
+func (r *redactor) any(v any) slog.Value {
+	switch v := v.(type) {
+	case error:
+		return slog.StringValue(r.text(v.Error()))
+	case []string:
+		out := make([]string, len(v))
+		for i, s := range v {
+			out[i] = r.text(s)
+		}
+		return slog.AnyValue(out)
+	case map[string]string:
+		out := make(map[string]string, len(v))
+		for k, s := range v {
+			out[k] = r.replacement
+			if !r.sensitive(k) {
+				out[k] = r.text(s)
+			}
+		}
+		return slog.AnyValue(out)
+	case http.Header:
+		out := make(http.Header, len(v))
+		for k, vs := range v {
+			if r.sensitive(k) {
+				out[k] = []string{r.replacement}
+				continue
+			}
+			out[k] = make([]string, len(vs))
+			for i, s := range vs {
+				out[k][i] = r.text(s)
+			}
+		}
+		return slog.AnyValue(out)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, x := range v {
+			out[k] = r.attr(slog.Any(k, x)).Value.Any()
+		}
+		return slog.AnyValue(out)
+	}
+	return slog.AnyValue(v)
+}
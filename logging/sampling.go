@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SamplingOptions configures NewSamplingHandler. Zero values are defaults.
+type SamplingOptions struct {
+	// First is how many records with the same message and level pass in
+	// each Tick. Defaults to 100.
+	First int
+	// Thereafter passes every Thereafter-th record with the same message and
+	// level after the first First in a Tick, dropping the rest. Defaults to
+	// 100.
+	Thereafter int
+	// Tick is the length of the sampling window. Defaults to one second.
+	Tick time.Duration
+	// Always is the level from which records always pass. Defaults to WARN.
+	Always slog.Leveler
+}
+
+// SamplingHandler is the slog.Handler returned by NewSamplingHandler.
+type SamplingHandler struct {
+	next    slog.Handler
+	sampler *sampler
+}
+
+// NewSamplingHandler returns a handler that passes records to next, except
+// repetitive ones below opts.Always: of the records with the same message
+// and level in each opts.Tick, the first opts.First pass and then one in
+// every opts.Thereafter. WARN and ERROR records, with the default Always,
+// are never dropped. This keeps the log volume of a service handling
+// thousands of requests per second in check while still showing every
+// distinct event:
+//
+//	handler := logging.NewSamplingHandler(slog.NewJSONHandler(os.Stdout, nil), logging.SamplingOptions{})
+//
+// Loggers derived with With and WithGroup share the counts of the logger
+// they were derived from. Dropped reports how many records were dropped.
+func NewSamplingHandler(next slog.Handler, opts SamplingOptions) *SamplingHandler {
+	return newSamplingHandler(next, opts, time.Now)
+}
+
+// newSamplingHandler is NewSamplingHandler with a configurable clock.
+func newSamplingHandler(next slog.Handler, opts SamplingOptions, now func() time.Time) *SamplingHandler {
+	if opts.First <= 0 {
+		opts.First = 100
+	}
+	if opts.Thereafter <= 0 {
+		opts.Thereafter = 100
+	}
+	if opts.Tick <= 0 {
+		opts.Tick = time.Second
+	}
+	if opts.Always == nil {
+		opts.Always = slog.LevelWarn
+	}
+	return &SamplingHandler{next: next, sampler: &sampler{opts: opts, now: now, counts: make(map[sampleKey]int)}}
+}
+
+func (h *SamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *SamplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < h.sampler.opts.Always.Level() && !h.sampler.sample(r.Message, r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &SamplingHandler{next: h.next.WithAttrs(attrs), sampler: h.sampler}
+}
+
+func (h *SamplingHandler) WithGroup(name string) slog.Handler {
+	return &SamplingHandler{next: h.next.WithGroup(name), sampler: h.sampler}
+}
+
+// Dropped returns how many records h and the handlers derived from it have
+// dropped.
+func (h *SamplingHandler) Dropped() uint64 {
+	return h.sampler.dropped.Load()
+}
+
+// sampleKey identifies records counted together.
+type sampleKey struct {
+	msg   string
+	level slog.Level
+}
+
+// sampler holds the counts of the current window.
+type sampler struct {
+	opts    SamplingOptions
+	now     func() time.Time
+	dropped atomic.Uint64
+
+	mu     sync.Mutex
+	window time.Time
+	counts map[sampleKey]int
+}
+
+// sample counts a record and reports whether it passes.
+func (s *sampler) sample(msg string, level slog.Level) bool {
+	s.mu.Lock()
+	now := s.now()
+	if now.Sub(s.window) >= s.opts.Tick {
+		// A new window; clearing the counts also bounds the map to the
+		// messages of one window.
+		s.window = now
+		clear(s.counts)
+	}
+	key := sampleKey{msg: msg, level: level}
+	s.counts[key]++
+	n := s.counts[key]
+	s.mu.Unlock()
+
+	if n <= s.opts.First || (n-s.opts.First)%s.opts.Thereafter == 0 {
+		return true
+	}
+	s.dropped.Add(1)
+	return false
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+)
+
+// clfTimeFormat is the timestamp layout used by the Common Log Format.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// NewAccessLog returns middleware that writes one line per request to out in
+// the Apache Common or Combined Log Format, for log tooling that expects
+// classic access logs rather than structured records:
+//
+//	127.0.0.1 - alice [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.1" 200 2326 "http://example.com/" "Mozilla/5.0"
+//
+// The user is taken from HTTP Basic authentication credentials, if present.
+// The trailing Referer and User-Agent fields are written only for
+// config.CombinedLogFormat; any other format value writes the Common Log
+// Format. Writes to out are serialized, so it need not be safe for concurrent use.
+func NewAccessLog(out io.Writer, format config.AccessLogFormat) Middleware {
+	combined := format != config.CommonLogFormat
+	var mu sync.Mutex
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wrapped, r := NewResponseRecorder(w, r)
+			next.ServeHTTP(wrapped.Writer(), r)
+
+			line := appendAccessLogLine(nil, r, wrapped.Info(), wrapped.start, combined)
+			mu.Lock()
+			defer mu.Unlock()
+			out.Write(line)
+		})
+	}
+}
+
+// OpenAccessLog returns access log middleware configured by
+// cfg.AccessLogFile and cfg.AccessLogFormat. The file is opened for appending,
+// and created if necessary; the caller must Close the returned io.Closer on
+// shutdown. If cfg.AccessLogFile is empty the access log is disabled: the
+// returned middleware passes requests through unchanged and closing is a no-op.
+func OpenAccessLog(cfg config.ServerConfig) (Middleware, io.Closer, error) {
+	if cfg.AccessLogFile == "" {
+		return func(next http.Handler) http.Handler { return next }, io.NopCloser(nil), nil
+	}
+	f, err := os.OpenFile(cfg.AccessLogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewAccessLog(f, cfg.AccessLogFormat), f, nil
+}
+
+// appendAccessLogLine appends the access log line for a completed request to b.
+func appendAccessLogLine(b []byte, r *http.Request, info ResponseInfo, start time.Time, combined bool) []byte {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	user, _, ok := r.BasicAuth()
+	if !ok || user == "" {
+		user = "-"
+	}
+	uri := r.RequestURI
+	if uri == "" {
+		uri = r.URL.RequestURI()
+	}
+
+	b = append(b, orDash(host)...)
+	b = append(b, " - "...)
+	b = append(b, user...)
+	b = append(b, " ["...)
+	b = start.AppendFormat(b, clfTimeFormat)
+	b = append(b, "] "...)
+	b = strconv.AppendQuote(b, r.Method+" "+uri+" "+r.Proto)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(info.Status), 10)
+	b = append(b, ' ')
+	if info.Bytes > 0 {
+		b = strconv.AppendInt(b, info.Bytes, 10)
+	} else {
+		b = append(b, '-')
+	}
+	if combined {
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, orDash(r.Referer()))
+		b = append(b, ' ')
+		b = strconv.AppendQuote(b, orDash(r.UserAgent()))
+	}
+	return append(b, '\n')
+}
+
+// orDash returns s, or "-" if s is empty, as access log formats require.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Principal is the identity a request was authenticated as.
+type Principal struct {
+	// Subject identifies the authenticated user or service, such as the
+	// Basic auth user name or a token's sub claim.
+	Subject string
+	// Attributes carries whatever else the verifier knows, such as roles,
+	// scopes or token claims.
+	Attributes map[string]any
+}
+
+// principalKey is the context key under which the Principal is stored.
+type principalKey struct{}
+
+// PrincipalFromContext returns the Principal stored by NewBasicAuth or
+// NewBearerAuth, or false if the request was not authenticated.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// NewBasicAuth returns middleware that requires HTTP Basic authentication
+// (RFC 7617). validate is called with the credentials of each request and
+// must compare them in constant time (crypto/subtle) to avoid leaking them
+// through timing. Requests with missing or rejected credentials get 401 with
+// a WWW-Authenticate challenge; accepted ones carry a Principal whose Subject
+// is the user name.
+//
+// Basic credentials are sent with every request in the clear, so only use
+// them over TLS.
+func NewBasicAuth(validate func(user, pass string) bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			if !ok || !validate(user, pass) {
+				if ok {
+					countMetric("auth.basic.invalid_credentials", 1)
+				} else {
+					countMetric("auth.basic.missing_credentials", 1)
+				}
+				w.Header().Set("WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			ctx := context.WithValue(r.Context(), principalKey{}, Principal{Subject: user})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// NewBearerAuth returns middleware that requires a bearer token (RFC 6750)
+// in the Authorization header. verify checks the token, for example a JWT
+// signature or a lookup of an opaque token, and returns the Principal it
+// identifies. Requests without a token get 401 with a bare Bearer challenge;
+// those whose token verify rejects get 401 with error="invalid_token". The
+// verify error is not sent to the client. Accepted requests carry the
+// Principal in their context.
+func NewBearerAuth(verify func(token string) (Principal, error)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				countMetric("auth.bearer.missing_token", 1)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			p, err := verify(token)
+			if err != nil {
+				countMetric("auth.bearer.invalid_token", 1)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token", error_description="the access token is invalid or expired"`)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			ctx := context.WithValue(r.Context(), principalKey{}, p)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// bearerToken returns the token of a "Bearer" Authorization header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
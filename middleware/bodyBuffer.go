@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// BodyBufferOptions configures BufferBody and NewBodyBuffer. Zero values are
+// defaults.
+type BodyBufferOptions struct {
+	// MaxBodySize is the largest body buffered, in bytes. Defaults to 10 MiB.
+	MaxBodySize int64
+	// MemoryLimit is how much of a body is held in memory, in bytes; the
+	// rest of a larger body is written to a temporary file. Defaults to
+	// 1 MiB.
+	MemoryLimit int64
+	// TempDir is the directory for temporary files. Defaults to
+	// os.TempDir().
+	TempDir string
+}
+
+// BufferBody reads r's body in full and makes it re-readable, for handlers
+// that need it more than once: to verify a signature and then decode it, to
+// log it, or to let a proxy's transport retry the request. Afterwards r.Body
+// reads the body from the start, r.GetBody returns further independent
+// readers, and r.ContentLength is the body's length.
+//
+// Up to opts.MemoryLimit bytes are held in memory; the rest of a larger body
+// is written to a temporary file in opts.TempDir. A body larger than
+// opts.MaxBodySize is not buffered and BufferBody returns an
+// *http.MaxBytesError.
+//
+// Call release once the body is no longer needed, after which its readers
+// must not be used. It removes the temporary file, if any; where the
+// platform allows, the file is unlinked as soon as it is created, so it does
+// not outlive the process even if release is never called. release is safe
+// to call more than once, and is a no-op when BufferBody returns an error.
+func BufferBody(r *http.Request, opts BodyBufferOptions) (release func(), err error) {
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 10 << 20
+	}
+	if opts.MemoryLimit <= 0 {
+		opts.MemoryLimit = 1 << 20
+	}
+	opts.MemoryLimit = min(opts.MemoryLimit, opts.MaxBodySize)
+	if r.Body == nil || r.Body == http.NoBody {
+		r.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+		return func() {}, nil
+	}
+
+	body := io.LimitReader(r.Body, opts.MaxBodySize+1)
+	var mem bytes.Buffer
+	n, err := io.CopyN(&mem, body, opts.MemoryLimit+1)
+	if err != nil && err != io.EOF {
+		return func() {}, fmt.Errorf("middleware: reading request body: %w", err)
+	}
+	if n > opts.MaxBodySize {
+		return func() {}, &http.MaxBytesError{Limit: opts.MaxBodySize}
+	}
+	b := &bufferedBody{mem: mem.Bytes(), size: n}
+	if err == nil {
+		// The body is larger than the memory limit.
+		if err := b.spill(body, opts); err != nil {
+			b.release()
+			return func() {}, err
+		}
+	}
+
+	r.Body = b.reader()
+	r.GetBody = func() (io.ReadCloser, error) { return b.reader(), nil }
+	r.ContentLength = b.size
+	r.TransferEncoding = nil
+	return b.release, nil
+}
+
+// bufferedBody is a request body held in memory, or in a file.
+type bufferedBody struct {
+	mem     []byte
+	file    *os.File // nil while the body fits in mem
+	removed bool     // whether file has been unlinked
+	size    int64
+	once    sync.Once
+}
+
+// spill moves the buffered body to a temporary file and copies the rest of
+// body after it.
+func (b *bufferedBody) spill(body io.Reader, opts BodyBufferOptions) error {
+	f, err := os.CreateTemp(opts.TempDir, "body-*")
+	if err != nil {
+		return fmt.Errorf("middleware: buffering request body: %w", err)
+	}
+	b.file = f
+	// Unlinking an open file fails on Windows; release removes it there.
+	b.removed = os.Remove(f.Name()) == nil
+	if _, err := f.Write(b.mem); err != nil {
+		return fmt.Errorf("middleware: buffering request body: %w", err)
+	}
+	b.mem = nil
+	m, err := io.Copy(f, body)
+	b.size += m
+	if err != nil {
+		return fmt.Errorf("middleware: reading request body: %w", err)
+	}
+	if b.size > opts.MaxBodySize {
+		return &http.MaxBytesError{Limit: opts.MaxBodySize}
+	}
+	return nil
+}
+
+// reader returns a new reader over the whole body.
+func (b *bufferedBody) reader() io.ReadCloser {
+	if b.file == nil {
+		return io.NopCloser(bytes.NewReader(b.mem))
+	}
+	return io.NopCloser(io.NewSectionReader(b.file, 0, b.size))
+}
+
+// release closes and removes the temporary file, if any.
+func (b *bufferedBody) release() {
+	b.once.Do(func() {
+		if b.file == nil {
+			return
+		}
+		b.file.Close()
+		if !b.removed {
+			os.Remove(b.file.Name())
+		}
+	})
+}
+
+// NewBodyBuffer returns middleware that buffers request bodies with
+// BufferBody before calling the next handler, so that it and the middleware
+// after this one can read the body more than once, through r.GetBody. The
+// buffer, and any temporary file, is released when the next handler
+// returns, or panics.
+//
+// Bodies larger than opts.MaxBodySize are rejected with 413 Request Entity
+// Too Large, and bodies that cannot be read with 400 Bad Request.
+func NewBodyBuffer(opts BodyBufferOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			release, err := BufferBody(r, opts)
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					countMetric("bodybuffer.too_large", 1)
+					http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			defer release()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
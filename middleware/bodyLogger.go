@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+	"github.com/harrydayexe/GoWebUtilities/logging"
+)
+
+// DefaultLoggedContentTypes are the body media types NewBodyLogger logs by
+// default.
+var DefaultLoggedContentTypes = []string{"application/json", "application/*+json", "application/x-www-form-urlencoded", "text/*"}
+
+// BodyLoggerOptions configures NewBodyLogger. Zero values are defaults.
+type BodyLoggerOptions struct {
+	// MaxBodyBytes limits how many bytes of each body are logged. Defaults
+	// to 4096.
+	MaxBodyBytes int
+	// Responses also logs response bodies.
+	Responses bool
+	// ContentTypes are the media types of the bodies logged, without
+	// parameters; "text/*" matches every text type and "application/*+json"
+	// every JSON-based one. Other bodies are logged as omitted. Defaults to
+	// DefaultLoggedContentTypes.
+	ContentTypes []string
+	// RedactFields are fragments of the names of fields whose values are
+	// replaced with [REDACTED], compared ignoring case: "token" redacts
+	// "token", "access_token" and "X-Token" alike. They apply to JSON
+	// members, at any depth, and to form fields. Defaults to
+	// logging.DefaultRedactedKeys, the names redacted from logs.
+	RedactFields []string
+	// Environments are those whose requests are logged, read from the
+	// config.ServerConfig in the request context. Defaults to Local and
+	// Test; requests without a config are never logged, so bodies stay out
+	// of production logs unless Production is listed explicitly.
+	Environments []config.Environment
+	// Level is the level of the records. Defaults to INFO.
+	Level slog.Level
+}
+
+// NewBodyLogger returns middleware that logs a "request body" record for
+// each request, with the first MaxBodyBytes of the request body the handler
+// read and, with opts.Responses, of the response body written, for debugging
+// outside production. Field values whose names match opts.RedactFields are
+// masked in JSON and form bodies, including truncated ones. Headers are not
+// logged; see NewDetailedLogging for those.
+//
+// Requests whose config environment is not in opts.Environments pass
+// through untouched.
+func NewBodyLogger(logger *slog.Logger, opts BodyLoggerOptions) Middleware {
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	if opts.ContentTypes == nil {
+		opts.ContentTypes = DefaultLoggedContentTypes
+	}
+	if opts.RedactFields == nil {
+		opts.RedactFields = logging.DefaultRedactedKeys
+	}
+	if opts.Environments == nil {
+		opts.Environments = []config.Environment{config.Local, config.Test}
+	}
+	redact := newBodyRedactor(opts.RedactFields)
+
+	return conditional(func(cfg config.ServerConfig, ok bool) bool {
+		return ok && slices.Contains(opts.Environments, cfg.Environment)
+	}, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wrapped, r := NewResponseRecorder(w, r)
+			reqType := r.Header.Get("Content-Type")
+			var reqBody *cappedBuffer
+			if r.Body != nil && r.Body != http.NoBody && loggedContentType(reqType, opts.ContentTypes) {
+				reqBody = &cappedBuffer{limit: opts.MaxBodyBytes}
+				r.Body = &teeReadCloser{ReadCloser: r.Body, w: reqBody}
+			}
+			var respBody *cappedBuffer
+			prevCapture := wrapped.capture
+			if opts.Responses {
+				respBody = &cappedBuffer{limit: opts.MaxBodyBytes}
+				wrapped.capture = respBody
+				if prevCapture != nil {
+					wrapped.capture = io.MultiWriter(prevCapture, respBody)
+				}
+			}
+
+			next.ServeHTTP(wrapped.Writer(), r)
+
+			wrapped.capture = prevCapture
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", wrapped.Status()),
+			}
+			if id, ok := RequestIDFromContext(r.Context()); ok {
+				attrs = append(attrs, slog.String("request_id", id))
+			}
+			attrs = append(attrs, bodyAttr("request", reqType, reqBody, redact))
+			if opts.Responses {
+				respType := wrapped.Header().Get("Content-Type")
+				if !loggedContentType(respType, opts.ContentTypes) {
+					respBody = nil
+				}
+				attrs = append(attrs, bodyAttr("response", respType, respBody, redact))
+			}
+			attrs = append(attrs, RequestAttrs(r.Context())...)
+			logger.LogAttrs(r.Context(), opts.Level, "request body", attrs...)
+		})
+	})
+}
+
+// bodyAttr returns the group logging a body; a nil body was not captured.
+func bodyAttr(name, contentType string, body *cappedBuffer, redact func(string) string) slog.Attr {
+	if body == nil {
+		return slog.Group(name,
+			slog.String("content_type", contentType),
+			slog.Bool("body_omitted", true),
+		)
+	}
+	return slog.Group(name,
+		slog.String("content_type", contentType),
+		slog.String("body", redact(body.String())),
+		slog.Bool("body_truncated", body.truncated),
+	)
+}
+
+// loggedContentType reports whether bodies of contentType are logged.
+func loggedContentType(contentType string, patterns []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, p := range patterns {
+		switch {
+		case p == mediaType:
+			return true
+		case strings.HasSuffix(p, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(p, "*")):
+			return true
+		case strings.Contains(p, "/*+"):
+			typ, suffix, _ := strings.Cut(p, "/*")
+			if strings.HasPrefix(mediaType, typ+"/") && strings.HasSuffix(mediaType, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newBodyRedactor returns a function masking the values of JSON members and
+// form fields whose names contain any of fields. It works on text rather
+// than parsed documents, so truncated bodies are redacted too.
+func newBodyRedactor(fields []string) func(string) string {
+	if len(fields) == 0 {
+		return func(s string) string { return s }
+	}
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		quoted[i] = regexp.QuoteMeta(f)
+	}
+	names := "(?:" + strings.Join(quoted, "|") + ")"
+	// A JSON member: the key, then a string (perhaps cut off) or a scalar.
+	jsonField := regexp.MustCompile(`(?i)("[^"]*` + names + `[^"]*"\s*:\s*)(?:"(?:[^"\\]|\\.)*"?|[^\s,}\]]+)`)
+	formField := regexp.MustCompile(`(?i)((?:^|&)[^=&]*` + names + `[^=&]*=)[^&]*`)
+	return func(s string) string {
+		s = jsonField.ReplaceAllString(s, `${1}"[REDACTED]"`)
+		return formField.ReplaceAllString(s, `${1}[REDACTED]`)
+	}
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultMaxBreadcrumbs is the trail length used when NewBreadcrumbs is given
+// a non-positive limit.
+const defaultMaxBreadcrumbs = 50
+
+// breadcrumbsKey is the context key under which the breadcrumb trail is stored.
+type breadcrumbsKey struct{}
+
+// Breadcrumb is an event recorded during a request with AddBreadcrumb.
+type Breadcrumb struct {
+	// Time is when the event was recorded.
+	Time time.Time
+	// Message describes the event.
+	Message string
+	// Attrs holds additional details about the event.
+	Attrs []slog.Attr
+}
+
+// breadcrumbTrail holds the most recent breadcrumbs recorded for a request.
+type breadcrumbTrail struct {
+	mu     sync.Mutex
+	start  time.Time
+	max    int
+	crumbs []Breadcrumb
+}
+
+// NewBreadcrumbs returns middleware that attaches an empty breadcrumb trail to
+// each request, to which handlers and other middleware record events with
+// AddBreadcrumb. The trail keeps the most recent max events (50 if max is not
+// positive).
+//
+// The trail is written out only if the request fails: wrap the logger's
+// handler with NewBreadcrumbLogHandler and every ERROR record logged with the
+// request context (for example by NewRecovery, or by a handler calling
+// slog.ErrorContext) includes the events that led up to it.
+func NewBreadcrumbs(max int) Middleware {
+	if max <= 0 {
+		max = defaultMaxBreadcrumbs
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			trail := &breadcrumbTrail{start: time.Now(), max: max}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), breadcrumbsKey{}, trail)))
+		})
+	}
+}
+
+// AddBreadcrumb records an event on the breadcrumb trail of the request
+// carrying ctx. It does nothing if NewBreadcrumbs is not in the middleware
+// stack. AddBreadcrumb is safe to call from goroutines started by the handler.
+func AddBreadcrumb(ctx context.Context, msg string, attrs ...slog.Attr) {
+	trail, ok := ctx.Value(breadcrumbsKey{}).(*breadcrumbTrail)
+	if !ok {
+		return
+	}
+	trail.mu.Lock()
+	defer trail.mu.Unlock()
+	if len(trail.crumbs) == trail.max {
+		trail.crumbs = append(trail.crumbs[:0], trail.crumbs[1:]...)
+	}
+	trail.crumbs = append(trail.crumbs, Breadcrumb{Time: time.Now(), Message: msg, Attrs: attrs})
+}
+
+// Breadcrumbs returns a copy of the breadcrumbs recorded so far for the
+// request carrying ctx, oldest first.
+func Breadcrumbs(ctx context.Context) []Breadcrumb {
+	trail, ok := ctx.Value(breadcrumbsKey{}).(*breadcrumbTrail)
+	if !ok {
+		return nil
+	}
+	trail.mu.Lock()
+	defer trail.mu.Unlock()
+	return append([]Breadcrumb(nil), trail.crumbs...)
+}
+
+// breadcrumbsAttr renders the trail carried by ctx as a "breadcrumbs" group
+// with one numbered subgroup per event. Event times are given as offsets from
+// the start of the request. It returns false if there are no breadcrumbs.
+func breadcrumbsAttr(ctx context.Context) (slog.Attr, bool) {
+	trail, ok := ctx.Value(breadcrumbsKey{}).(*breadcrumbTrail)
+	if !ok {
+		return slog.Attr{}, false
+	}
+	trail.mu.Lock()
+	defer trail.mu.Unlock()
+	if len(trail.crumbs) == 0 {
+		return slog.Attr{}, false
+	}
+
+	events := make([]any, 0, len(trail.crumbs))
+	for i, c := range trail.crumbs {
+		attrs := make([]any, 0, len(c.Attrs)+2)
+		attrs = append(attrs,
+			slog.Duration("at", c.Time.Sub(trail.start)),
+			slog.String("msg", c.Message),
+		)
+		for _, a := range c.Attrs {
+			attrs = append(attrs, a)
+		}
+		events = append(events, slog.Group(strconv.Itoa(i+1), attrs...))
+	}
+	return slog.Group("breadcrumbs", events...), true
+}
+
+// breadcrumbLogHandler adds the request's breadcrumb trail to ERROR records.
+type breadcrumbLogHandler struct {
+	slog.Handler
+}
+
+// NewBreadcrumbLogHandler wraps h so that records at ERROR level or above
+// that are logged with a request context carrying breadcrumbs (see
+// NewBreadcrumbs) gain a "breadcrumbs" attribute listing them. Other records
+// are passed to h unchanged.
+func NewBreadcrumbLogHandler(h slog.Handler) slog.Handler {
+	return breadcrumbLogHandler{Handler: h}
+}
+
+func (h breadcrumbLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		if attr, ok := breadcrumbsAttr(ctx); ok {
+			r = r.Clone()
+			r.AddAttrs(attr)
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h breadcrumbLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return breadcrumbLogHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h breadcrumbLogHandler) WithGroup(name string) slog.Handler {
+	return breadcrumbLogHandler{Handler: h.Handler.WithGroup(name)}
+}
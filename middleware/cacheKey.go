@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CacheKeyOptions selects the parts of a request, beyond its method, host,
+// path and query, that distinguish one cached or deduplicated response from
+// another.
+type CacheKeyOptions struct {
+	// Headers lists request headers whose values vary the response, such as
+	// Accept-Language. Names are case-insensitive.
+	Headers []string
+	// IgnoreQuery lists query parameters that never affect the response,
+	// such as tracking parameters, and are left out of the key.
+	IgnoreQuery []string
+	// Tenant returns the tenant the request belongs to, so that tenants never
+	// share entries. Nil means requests are not partitioned by tenant.
+	Tenant func(r *http.Request) string
+	// Offers lists the content types the handler can produce. When set, the
+	// type negotiated from the Accept header is part of the key, rather than
+	// the raw header, so equivalent Accept headers share an entry.
+	Offers []string
+}
+
+// CacheKeyFunc derives a canonical key from a request.
+type CacheKeyFunc func(r *http.Request) string
+
+// NewCacheKey returns a CacheKeyFunc that builds keys from the request method,
+// lower-cased host, path, query parameters sorted by name, and the parts
+// selected by opts. Requests that differ only in query parameter order, header
+// name case or equivalent Accept headers get the same key.
+//
+// Middleware that stores or deduplicates responses per request (response
+// caching, idempotency, single flight) should derive its keys with a
+// CacheKeyFunc so that all of them agree on which requests are the same.
+//
+// Keys are printable but unbounded in length; stores with key size limits
+// should hash them.
+func NewCacheKey(opts CacheKeyOptions) CacheKeyFunc {
+	headers := make([]string, 0, len(opts.Headers))
+	for _, h := range opts.Headers {
+		headers = append(headers, http.CanonicalHeaderKey(h))
+	}
+	slices.Sort(headers)
+	headers = slices.Compact(headers)
+
+	return func(r *http.Request) string {
+		var b strings.Builder
+		b.WriteString(r.Method)
+		b.WriteByte(' ')
+		b.WriteString(strings.ToLower(r.Host))
+		b.WriteString(r.URL.EscapedPath())
+
+		query := r.URL.Query()
+		for _, name := range opts.IgnoreQuery {
+			query.Del(name)
+		}
+		if len(query) > 0 {
+			b.WriteByte('?')
+			b.WriteString(query.Encode()) // sorted by name
+		}
+
+		for _, name := range headers {
+			b.WriteString("\n")
+			b.WriteString(strings.ToLower(name))
+			b.WriteByte('=')
+			b.WriteString(url.QueryEscape(strings.Join(r.Header.Values(name), ",")))
+		}
+		if opts.Tenant != nil {
+			b.WriteString("\ntenant=")
+			b.WriteString(url.QueryEscape(opts.Tenant(r)))
+		}
+		if len(opts.Offers) > 0 {
+			b.WriteString("\ntype=")
+			b.WriteString(NegotiateContentType(r.Header.Get("Accept"), opts.Offers))
+		}
+		return b.String()
+	}
+}
+
+// NegotiateContentType returns the offer that best matches an Accept header
+// value. Offers are compared by quality value and then by how specifically
+// the Accept header names them; remaining ties go to the earlier offer. An
+// empty Accept header accepts the first offer. If no offer is acceptable,
+// NegotiateContentType returns "".
+func NegotiateContentType(accept string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQ, bestSpecificity := "", 0.0, -1
+	for _, offer := range offers {
+		q, specificity := 0.0, -1
+		for _, ar := range ranges {
+			if s := ar.matches(offer); s > specificity {
+				q, specificity = ar.q, s
+			}
+		}
+		if q > bestQ || q == bestQ && q > 0 && specificity > bestSpecificity {
+			best, bestQ, bestSpecificity = offer, q, specificity
+		}
+	}
+	return best
+}
+
+// acceptRange is one media range from an Accept header.
+type acceptRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept splits an Accept header into media ranges, skipping invalid ones.
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for part := range strings.SplitSeq(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		typ, subtype, ok := strings.Cut(mediaType, "/")
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{typ: typ, subtype: subtype, q: q})
+	}
+	return ranges
+}
+
+// matches reports how specifically the range matches the content type:
+// 2 for an exact match, 1 for type/*, 0 for */* and -1 for no match.
+func (ar acceptRange) matches(contentType string) int {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return -1
+	}
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	switch {
+	case ar.typ == "*" && ar.subtype == "*":
+		return 0
+	case ar.typ == typ && ar.subtype == "*":
+		return 1
+	case ar.typ == typ && ar.subtype == subtype:
+		return 2
+	}
+	return -1
+}
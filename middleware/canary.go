@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Variant names the handler tree a Canary sent a request to.
+type Variant string
+
+const (
+	VariantStable Variant = "stable"
+	VariantCanary Variant = "canary"
+)
+
+// CanaryOptions configures a Canary. Zero values are defaults.
+type CanaryOptions struct {
+	// Weight is the initial percentage of traffic, from 0 to 100, sent to the
+	// canary.
+	Weight int
+	// Header names a request header that forces a variant when set to
+	// "stable" or "canary", for testers and smoke checks. Defaults to
+	// "X-Canary".
+	Header string
+	// Cookie names the cookie that keeps each client in the same bucket, so
+	// its requests stay on one variant. Defaults to "canary_bucket".
+	Cookie string
+	// CookieMaxAge is how long the cookie lasts. Defaults to 24 hours.
+	CookieMaxAge time.Duration
+}
+
+// VariantStats counts the requests one variant served.
+type VariantStats struct {
+	Requests int64 `json:"requests"`
+	// ServerErrors counts responses with a 5xx status.
+	ServerErrors int64 `json:"server_errors"`
+}
+
+// CanaryStats is a snapshot of a Canary's traffic split.
+type CanaryStats struct {
+	Weight int          `json:"weight"`
+	Stable VariantStats `json:"stable"`
+	Canary VariantStats `json:"canary"`
+}
+
+// Canary splits traffic between a stable handler tree and a canary, for
+// blue/green and canary rollouts at the application layer. Create one with
+// NewCanary.
+//
+// Each client is assigned a random bucket from 0 to 99, kept in a cookie, and
+// goes to the canary while its bucket is below the weight. Raising the weight
+// therefore only moves clients from stable to canary, and lowering it to 0
+// rolls every client back, without clients switching back and forth in
+// between.
+//
+// A Canary is safe for concurrent use.
+type Canary struct {
+	canary http.Handler
+	opts   CanaryOptions
+	weight atomic.Int64
+	stats  [2]struct {
+		requests, serverErrors atomic.Int64
+	}
+}
+
+// NewCanary returns a Canary sending opts.Weight percent of traffic to
+// canary. It panics if the weight is not between 0 and 100.
+func NewCanary(canary http.Handler, opts CanaryOptions) *Canary {
+	if opts.Header == "" {
+		opts.Header = "X-Canary"
+	}
+	if opts.Cookie == "" {
+		opts.Cookie = "canary_bucket"
+	}
+	if opts.CookieMaxAge <= 0 {
+		opts.CookieMaxAge = 24 * time.Hour
+	}
+	c := &Canary{canary: canary, opts: opts}
+	if err := c.SetWeight(opts.Weight); err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// SetWeight changes the percentage of traffic sent to the canary.
+func (c *Canary) SetWeight(weight int) error {
+	if weight < 0 || weight > 100 {
+		return fmt.Errorf("middleware: canary weight %d is not between 0 and 100", weight)
+	}
+	c.weight.Store(int64(weight))
+	return nil
+}
+
+// Weight returns the percentage of traffic sent to the canary.
+func (c *Canary) Weight() int {
+	return int(c.weight.Load())
+}
+
+// Apply routes requests between next, the stable tree, and the canary. It has
+// the Middleware signature:
+//
+//	canary := middleware.NewCanary(newAPI, middleware.CanaryOptions{Weight: 5})
+//	handler := middleware.CreateStack(logging, canary.Apply)(oldAPI)
+func (c *Canary) Apply(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		variant := c.choose(w, r)
+		h, i := next, 0
+		if variant == VariantCanary {
+			h, i = c.canary, 1
+		}
+		wrapped, r := NewResponseRecorder(w, r)
+		h.ServeHTTP(wrapped.Writer(), r)
+		c.stats[i].requests.Add(1)
+		if wrapped.Status() >= 500 {
+			c.stats[i].serverErrors.Add(1)
+		}
+	})
+}
+
+// choose picks the variant for r, assigning the client a bucket if it has
+// none.
+func (c *Canary) choose(w http.ResponseWriter, r *http.Request) Variant {
+	switch Variant(r.Header.Get(c.opts.Header)) {
+	case VariantStable:
+		return VariantStable
+	case VariantCanary:
+		return VariantCanary
+	}
+	bucket := -1
+	if cookie, err := r.Cookie(c.opts.Cookie); err == nil {
+		if n, err := strconv.Atoi(cookie.Value); err == nil && n >= 0 && n < 100 {
+			bucket = n
+		}
+	}
+	if bucket < 0 {
+		bucket = rand.IntN(100)
+		http.SetCookie(w, &http.Cookie{
+			Name:     c.opts.Cookie,
+			Value:    strconv.Itoa(bucket),
+			Path:     "/",
+			MaxAge:   int(c.opts.CookieMaxAge / time.Second),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	if bucket < c.Weight() {
+		return VariantCanary
+	}
+	return VariantStable
+}
+
+// Stats returns the current weight and the traffic each variant served.
+func (c *Canary) Stats() CanaryStats {
+	return CanaryStats{
+		Weight: c.Weight(),
+		Stable: VariantStats{c.stats[0].requests.Load(), c.stats[0].serverErrors.Load()},
+		Canary: VariantStats{c.stats[1].requests.Load(), c.stats[1].serverErrors.Load()},
+	}
+}
+
+// LogValue implements slog.LogValuer, logging the canary's statistics.
+func (c *Canary) LogValue() slog.Value {
+	s := c.Stats()
+	return slog.GroupValue(
+		slog.Int("weight", s.Weight),
+		slog.Int64("stable_requests", s.Stable.Requests),
+		slog.Int64("stable_server_errors", s.Stable.ServerErrors),
+		slog.Int64("canary_requests", s.Canary.Requests),
+		slog.Int64("canary_server_errors", s.Canary.ServerErrors),
+	)
+}
+
+// AdminHandler returns a handler for adjusting the canary at runtime, meant
+// to be mounted on the admin server:
+//
+//	adminHandler.Handle("/canary", canary.AdminHandler())
+//
+// GET answers the Stats as JSON; PUT with a weight query parameter, such as
+// PUT /canary?weight=25, changes the weight and answers the new Stats.
+func (c *Canary) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPut:
+			weight, err := strconv.Atoi(r.URL.Query().Get("weight"))
+			if err == nil {
+				err = c.SetWeight(weight)
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid weight: %v", err), http.StatusBadRequest)
+				return
+			}
+			slog.InfoContext(r.Context(), "canary weight changed", slog.Int("weight", weight))
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Stats())
+	})
+}
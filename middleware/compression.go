@@ -0,0 +1,312 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultCompressibleTypes are the media types NewCompression compresses
+// when CompressionOptions.ContentTypes is empty.
+var DefaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/problem+json",
+	"image/svg+xml",
+}
+
+// CompressionOptions configures NewCompression.
+type CompressionOptions struct {
+	// MinSize is the smallest response body, in bytes, worth compressing.
+	// Smaller responses are sent as they are. Defaults to 1024.
+	MinSize int
+	// Level is the compression level, from gzip.BestSpeed to
+	// gzip.BestCompression. Defaults to gzip.DefaultCompression.
+	Level int
+	// ContentTypes lists the media types to compress; "type/*" matches every
+	// subtype. Defaults to DefaultCompressibleTypes.
+	ContentTypes []string
+}
+
+// NewCompression returns middleware that compresses response bodies with
+// gzip or deflate, whichever the client's Accept-Encoding header prefers
+// (gzip on a tie). Only responses whose Content-Type is in opts.ContentTypes
+// and whose body reaches opts.MinSize bytes are compressed; the body is held
+// back until either the minimum size is reached or the handler finishes, so
+// the decision can be made. Responses that already have a Content-Encoding,
+// and responses to HEAD requests, pass through untouched.
+//
+// Flushing the response (http.Flusher or http.ResponseController) decides
+// immediately and flushes the compressor, so streamed responses keep
+// streaming. Vary: Accept-Encoding is added to every response.
+//
+// Middleware observing the response through the shared wrapper, such as
+// NewLoggingMiddleware, see the bytes sent when placed outside NewCompression
+// and the uncompressed body when placed inside it.
+//
+// NewCompression panics if opts.Level is not a valid compression level.
+func NewCompression(opts CompressionOptions) Middleware {
+	if opts.MinSize <= 0 {
+		opts.MinSize = 1024
+	}
+	if opts.Level == 0 {
+		opts.Level = gzip.DefaultCompression
+	}
+	if opts.Level < gzip.HuffmanOnly || opts.Level > gzip.BestCompression {
+		panic("middleware: invalid CompressionOptions.Level " + strconv.Itoa(opts.Level))
+	}
+	if len(opts.ContentTypes) == 0 {
+		opts.ContentTypes = DefaultCompressibleTypes
+	}
+	gzipPool := sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(nil, opts.Level)
+		return w
+	}}
+	flatePool := sync.Pool{New: func() any {
+		w, _ := flate.NewWriter(nil, opts.Level)
+		return w
+	}}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The response depends on Accept-Encoding even when it is not
+			// compressed, so caches must not serve it to other clients.
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, opts: &opts, encoding: encoding}
+			defer cw.close()
+			if encoding == "gzip" {
+				cw.newEncoder = func(dst io.Writer) io.WriteCloser {
+					gz := gzipPool.Get().(*gzip.Writer)
+					gz.Reset(dst)
+					cw.release = func() { gzipPool.Put(gz) }
+					return gz
+				}
+			} else {
+				cw.newEncoder = func(dst io.Writer) io.WriteCloser {
+					fl := flatePool.Get().(*flate.Writer)
+					fl.Reset(dst)
+					cw.release = func() { flatePool.Put(fl) }
+					return fl
+				}
+			}
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding returns "gzip" or "deflate", whichever the
+// Accept-Encoding header value prefers, or "" if it accepts neither.
+func negotiateEncoding(acceptEncoding string) string {
+	var gzipQ, deflateQ float64
+	for part := range strings.SplitSeq(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "gzip", "x-gzip":
+			gzipQ = q
+		case "deflate":
+			deflateQ = q
+		case "*":
+			gzipQ, deflateQ = max(gzipQ, q), max(deflateQ, q)
+		}
+	}
+	switch {
+	case gzipQ > 0 && gzipQ >= deflateQ:
+		return "gzip"
+	case deflateQ > 0:
+		return "deflate"
+	}
+	return ""
+}
+
+// compressWriter holds back the start of the body until it can decide
+// whether to compress it, then either streams it through an encoder or
+// passes it through.
+type compressWriter struct {
+	http.ResponseWriter
+	opts       *CompressionOptions
+	encoding   string
+	newEncoder func(dst io.Writer) io.WriteCloser
+	release    func()
+
+	status   int
+	buf      []byte
+	decided  bool
+	encoder  io.WriteCloser
+	hijacked bool
+
+	// bytesIn and bytesOut are the body's size before and after
+	// compression, for the compression metrics.
+	bytesIn, bytesOut int64
+}
+
+func (w *compressWriter) WriteHeader(statusCode int) {
+	switch {
+	case statusCode < 200:
+		w.ResponseWriter.WriteHeader(statusCode)
+	case w.status != 0:
+		if w.decided {
+			w.ResponseWriter.WriteHeader(statusCode) // let net/http report the superfluous call
+		}
+	default:
+		w.status = statusCode
+		if statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+			w.decide(false)
+		}
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.opts.MinSize {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.encoder != nil {
+		w.bytesIn += int64(len(b))
+		return w.encoder.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide sends the headers, compressing the body from now on if large is
+// set and the response is eligible, and writes any held-back body. Partial
+// responses are never compressed: their Content-Range describes the
+// uncompressed body.
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	h := w.Header()
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	partial := w.status == http.StatusPartialContent || h.Get("Content-Range") != ""
+	if large && !partial && h.Get("Content-Encoding") == "" && w.compressible(h) {
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(w.buf))
+		}
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges") // ranges of the uncompressed body no longer apply
+		w.encoder = w.newEncoder(countingWriter{w.ResponseWriter, &w.bytesOut})
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		w.bytesIn += int64(len(w.buf))
+		_, err = w.encoder.Write(w.buf)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+	return err
+}
+
+// compressible reports whether the response's content type is in the allowlist.
+func (w *compressWriter) compressible(h http.Header) bool {
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(w.buf)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range w.opts.ContentTypes {
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// close finishes the response once the handler has returned.
+func (w *compressWriter) close() {
+	if w.hijacked {
+		return
+	}
+	if !w.decided && (w.status != 0 || len(w.buf) > 0) {
+		w.decide(false)
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+		w.release()
+		countMetric("compression.responses", 1)
+		countMetric("compression.bytes_in", w.bytesIn)
+		countMetric("compression.bytes_out", w.bytesOut)
+	}
+}
+
+// countingWriter adds the number of bytes written through it to *n.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	*c.n += int64(n)
+	return n, err
+}
+
+// Flush sends the headers and any held-back body, flushing the compressor.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(true)
+	}
+	if fl, ok := w.encoder.(interface{ Flush() error }); ok {
+		fl.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack takes over the underlying connection; nothing further is compressed.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying ResponseWriter, allowing
+// http.ResponseController to reach its other optional interfaces.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+)
+
+// NewConfigContext returns middleware that stores cfg in the request context,
+// where it can be read with config.FromContext. Servers created by the server
+// package already do this, so this middleware is only needed when serving
+// with a plain http.Server or in tests.
+func NewConfigContext(cfg config.ServerConfig) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(config.NewContext(r.Context(), cfg)))
+		})
+	}
+}
+
+// When returns middleware that applies mw only to requests whose context
+// carries a config.ServerConfig with the given environment. Other requests,
+// including those without a config in their context, skip mw and go straight
+// to the next handler.
+//
+// This allows environment-specific middleware to be declared in a single
+// stack definition:
+//
+//	stack := middleware.CreateStack(
+//	    middleware.NewLoggingMiddleware(logger),
+//	    middleware.When(config.Local, debugMiddleware),
+//	)
+func When(env config.Environment, mw Middleware) Middleware {
+	return conditional(func(cfg config.ServerConfig, ok bool) bool {
+		return ok && cfg.Environment == env
+	}, mw)
+}
+
+// UnlessProduction returns middleware that applies mw to every request except
+// those running in the Production environment. It is intended for debug-only
+// middleware such as fault injection or body logging.
+//
+// To fail safe, requests without a config.ServerConfig in their context are
+// treated as Production and skip mw.
+func UnlessProduction(mw Middleware) Middleware {
+	return conditional(func(cfg config.ServerConfig, ok bool) bool {
+		return ok && cfg.Environment != config.Production
+	}, mw)
+}
+
+// conditional applies mw when apply returns true for the request's config.
+// The wrapped handler is built once, not per request.
+func conditional(apply func(cfg config.ServerConfig, ok bool) bool, mw Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		wrapped := mw(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if apply(config.FromContext(r.Context())) {
+				wrapped.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Validators are the cache validators of a response, which clients send back
+// in If-None-Match and If-Modified-Since to revalidate a cached copy.
+type Validators struct {
+	// ETag identifies the representation, such as a database row version.
+	// It is quoted if it is not already, so "42" and `"42"` are equivalent;
+	// prefix it with W/ to mark it weak. Empty means no ETag.
+	ETag string
+	// LastModified is when the representation last changed. It is sent
+	// with one-second precision. Zero means no Last-Modified.
+	LastModified time.Time
+}
+
+// validatorsKey is the context key under which the conditional request state is stored.
+type validatorsKey struct{}
+
+// conditionalState records the validators declared for a request and whether
+// its preconditions hold.
+type conditionalState struct {
+	r           *http.Request
+	validators  Validators
+	declared    bool
+	notModified bool
+}
+
+// NewConditionalGet returns middleware that answers conditional GET and HEAD
+// requests with 304 Not Modified using validators declared by the handler
+// with SetValidators. Because the validators are known before the body is
+// produced, no buffering or hashing of the response is needed: the handler
+// can skip rendering entirely when SetValidators reports the client's copy is
+// current, and any body it writes anyway is discarded.
+//
+// Declared validators are sent as ETag and Last-Modified headers on 2xx
+// responses. Responses whose handler declares no validators pass through
+// unchanged.
+func NewConditionalGet() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			state := &conditionalState{r: r}
+			r = r.WithContext(context.WithValue(r.Context(), validatorsKey{}, state))
+			cw := &conditionalWriter{ResponseWriter: w, state: state}
+			next.ServeHTTP(newConditionalWriter(cw), r)
+			if !cw.wroteHeader && state.notModified {
+				cw.WriteHeader(http.StatusOK)
+			}
+		})
+	}
+}
+
+// SetValidators declares the validators of the response to the request
+// carrying ctx and reports whether the client's cached copy is still current.
+// When it returns true, NewConditionalGet sends 304 Not Modified and the
+// handler should return without producing a body:
+//
+//	if middleware.SetValidators(r.Context(), middleware.Validators{ETag: strconv.Itoa(row.Version)}) {
+//	    return
+//	}
+//
+// SetValidators must be called before the response is written. It returns
+// false if the request is not wrapped by NewConditionalGet.
+func SetValidators(ctx context.Context, v Validators) bool {
+	state, ok := ctx.Value(validatorsKey{}).(*conditionalState)
+	if !ok {
+		return false
+	}
+	if tag, weak := strings.CutPrefix(v.ETag, "W/"); tag != "" && !strings.HasSuffix(tag, `"`) {
+		v.ETag = `"` + tag + `"`
+		if weak {
+			v.ETag = "W/" + v.ETag
+		}
+	}
+	state.validators = v
+	state.declared = true
+	state.notModified = notModified(state.r, v)
+	if state.notModified {
+		countMetric("conditional.hits", 1)
+	} else if h := state.r.Header; h.Get("If-None-Match") != "" || h.Get("If-Modified-Since") != "" {
+		countMetric("conditional.misses", 1)
+	}
+	return state.notModified
+}
+
+// notModified evaluates If-None-Match and If-Modified-Since (RFC 9110
+// section 13.2.2) for a GET or HEAD request against v.
+func notModified(r *http.Request, v Validators) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return v.ETag != "" && etagListMatches(inm, v.ETag)
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || v.LastModified.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !v.LastModified.Truncate(time.Second).After(t)
+}
+
+// etagListMatches reports whether an If-None-Match list contains etag, using
+// weak comparison.
+func etagListMatches(list, etag string) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for candidate := range strings.SplitSeq(list, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionalWriter adds declared validators to the response headers and
+// turns 200 responses into 304 when the request's preconditions hold.
+type conditionalWriter struct {
+	http.ResponseWriter
+	state       *conditionalState
+	wroteHeader bool
+	discard     bool
+}
+
+func (w *conditionalWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader || statusCode < 200 {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.wroteHeader = true
+	if !w.state.declared || statusCode > 299 {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	h := w.Header()
+	if v := w.state.validators; v.ETag != "" {
+		h.Set("ETag", v.ETag)
+	}
+	if v := w.state.validators; !v.LastModified.IsZero() {
+		h.Set("Last-Modified", v.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if w.state.notModified && statusCode == http.StatusOK {
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		w.discard = true
+		statusCode = http.StatusNotModified
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *conditionalWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.discard {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter, allowing
+// http.ResponseController to reach optional interfaces such as http.Flusher.
+func (w *conditionalWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// newConditionalWriter returns w as a writer implementing exactly those of
+// http.Flusher, http.Hijacker and io.ReaderFrom that the wrapped writer
+// does, as ResponseRecorder.Writer does, so that server-sent events,
+// websockets and sendfile keep working behind NewConditionalGet.
+func newConditionalWriter(w *conditionalWriter) http.ResponseWriter {
+	var mask int
+	if _, ok := findWriter[http.Flusher](w.ResponseWriter); ok {
+		mask |= canFlush
+	}
+	if _, ok := findWriter[http.Hijacker](w.ResponseWriter); ok {
+		mask |= canHijack
+	}
+	if _, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		mask |= canReadFrom
+	}
+
+	f, h, rf := conditionalFlusher{w}, conditionalHijacker{w}, conditionalReaderFrom{w}
+	switch mask {
+	case 0:
+		return struct{ *conditionalWriter }{w}
+	case canFlush:
+		return struct {
+			*conditionalWriter
+			conditionalFlusher
+		}{w, f}
+	case canHijack:
+		return struct {
+			*conditionalWriter
+			conditionalHijacker
+		}{w, h}
+	case canFlush | canHijack:
+		return struct {
+			*conditionalWriter
+			conditionalFlusher
+			conditionalHijacker
+		}{w, f, h}
+	case canReadFrom:
+		return struct {
+			*conditionalWriter
+			conditionalReaderFrom
+		}{w, rf}
+	case canFlush | canReadFrom:
+		return struct {
+			*conditionalWriter
+			conditionalFlusher
+			conditionalReaderFrom
+		}{w, f, rf}
+	case canHijack | canReadFrom:
+		return struct {
+			*conditionalWriter
+			conditionalHijacker
+			conditionalReaderFrom
+		}{w, h, rf}
+	default:
+		return struct {
+			*conditionalWriter
+			conditionalFlusher
+			conditionalHijacker
+			conditionalReaderFrom
+		}{w, f, h, rf}
+	}
+}
+
+// conditionalFlusher implements http.Flusher for a conditionalWriter.
+type conditionalFlusher struct{ w *conditionalWriter }
+
+// Flush sends the headers, with the declared validators, and any buffered
+// data to the client.
+func (f conditionalFlusher) Flush() {
+	if !f.w.wroteHeader {
+		f.w.WriteHeader(http.StatusOK)
+	}
+	flusher, _ := findWriter[http.Flusher](f.w.ResponseWriter)
+	flusher.Flush()
+}
+
+// conditionalHijacker implements http.Hijacker for a conditionalWriter.
+type conditionalHijacker struct{ w *conditionalWriter }
+
+// Hijack takes over the underlying connection.
+func (h conditionalHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, _ := findWriter[http.Hijacker](h.w.ResponseWriter)
+	return hijacker.Hijack()
+}
+
+// conditionalReaderFrom implements io.ReaderFrom for a conditionalWriter, so
+// that io.Copy to the response can use the wrapped writer's optimizations.
+type conditionalReaderFrom struct{ w *conditionalWriter }
+
+// ReadFrom copies src to the response, or discards it for a 304.
+func (rf conditionalReaderFrom) ReadFrom(src io.Reader) (int64, error) {
+	if !rf.w.wroteHeader {
+		rf.w.WriteHeader(http.StatusOK)
+	}
+	if rf.w.discard {
+		return io.Copy(io.Discard, src)
+	}
+	return rf.w.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+}
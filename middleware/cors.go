@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCORSMethods are the methods NewCORS allows by default.
+var DefaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// DefaultCORSHeaders are the request headers NewCORS allows by default.
+var DefaultCORSHeaders = []string{"Accept", "Authorization", "Content-Type", RequestIDHeader}
+
+// CORSOptions configures NewCORS. Zero values are defaults.
+type CORSOptions struct {
+	// AllowedOrigins are the origins allowed to make cross-origin requests,
+	// such as "https://app.example.com". A port of "*", as in
+	// "http://localhost:*", matches any port or none, and "*" allows any
+	// origin. No origin is allowed by default, so cross-origin requests get
+	// no CORS headers.
+	AllowedOrigins []string
+	// AllowedMethods are the methods allowed in cross-origin requests.
+	// Defaults to DefaultCORSMethods.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in cross-origin
+	// requests. "*" allows whatever headers a preflight asks for. Defaults to
+	// DefaultCORSHeaders.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read, beyond the
+	// CORS-safelisted ones.
+	ExposedHeaders []string
+	// AllowCredentials lets cross-origin requests carry cookies and
+	// credentials. It cannot be combined with the "*" origin, which would let
+	// any website read responses with the user's credentials.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response. Browsers
+	// apply their own default if it is not set.
+	MaxAge time.Duration
+}
+
+// NewCORS returns middleware implementing Cross-Origin Resource Sharing.
+// Requests from allowed origins get Access-Control-Allow-Origin and the
+// related headers; preflight requests (OPTIONS with
+// Access-Control-Request-Method) from them are answered with 204 No Content
+// without reaching the handler. Preflight requests from other origins are
+// answered with 403 Forbidden, and their other requests are served without
+// CORS headers, so browsers withhold the response from scripts.
+//
+// Requests without an Origin header are passed on untouched. NewCORS panics
+// if opts allows the "*" origin with credentials.
+func NewCORS(opts CORSOptions) Middleware {
+	if opts.AllowedMethods == nil {
+		opts.AllowedMethods = DefaultCORSMethods
+	}
+	if opts.AllowedHeaders == nil {
+		opts.AllowedHeaders = DefaultCORSHeaders
+	}
+	anyOrigin := slices.Contains(opts.AllowedOrigins, "*")
+	if anyOrigin && opts.AllowCredentials {
+		panic(`middleware: NewCORS cannot allow credentials from the "*" origin`)
+	}
+	anyHeader := slices.Contains(opts.AllowedHeaders, "*")
+	methods := strings.Join(opts.AllowedMethods, ", ")
+	headers := strings.Join(opts.AllowedHeaders, ", ")
+	exposed := strings.Join(opts.ExposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if !anyOrigin && !allowedOrigin(origin, opts.AllowedOrigins) {
+				if preflight {
+					http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if opts.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if !preflight {
+				if exposed != "" {
+					h.Set("Access-Control-Expose-Headers", exposed)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", methods)
+			if anyHeader {
+				if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+					h.Set("Access-Control-Allow-Headers", requested)
+				}
+			} else {
+				h.Set("Access-Control-Allow-Headers", headers)
+			}
+			if opts.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge/time.Second)))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// allowedOrigin reports whether origin matches one of patterns, where a
+// pattern ending in ":*" matches its scheme and host with any port or none.
+func allowedOrigin(origin string, patterns []string) bool {
+	for _, p := range patterns {
+		if p == origin {
+			return true
+		}
+		base, ok := strings.CutSuffix(p, ":*")
+		if !ok {
+			continue
+		}
+		if origin == base {
+			return true
+		}
+		port, ok := strings.CutPrefix(origin, base+":")
+		if ok && port != "" && strings.Trim(port, "0123456789") == "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers carrying a caller's remaining time budget.
+const (
+	// RequestTimeoutHeader carries the budget as a whole number of milliseconds.
+	RequestTimeoutHeader = "X-Request-Timeout"
+	// GRPCTimeoutHeader carries the budget in the gRPC wire format: up to
+	// eight digits followed by a unit (H, M, S, m, u or n).
+	GRPCTimeoutHeader = "Grpc-Timeout"
+)
+
+// grpcTimeoutUnits maps gRPC timeout unit suffixes to durations.
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// NewDeadline returns middleware that applies the caller's time budget to the
+// request. The budget is read from the X-Request-Timeout header or, if that is
+// absent, the Grpc-Timeout header, and the request context is given a
+// deadline that far in the future. Handlers and the calls they make with the
+// request context then stop once the caller has given up waiting.
+//
+// If max is positive, budgets larger than max are reduced to it, so a caller
+// cannot extend a request beyond the server's own limit. Requests without a
+// valid budget header are passed through unchanged. A request whose budget is
+// already exhausted is answered with 504 Gateway Timeout without calling the
+// handler.
+//
+// To propagate the remaining budget to downstream services, call
+// SetTimeoutHeader on outgoing requests created with the request context.
+func NewDeadline(max time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			budget, ok := parseBudget(r.Header)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if max > 0 && budget > max {
+				budget = max
+			}
+			if budget <= 0 {
+				http.Error(w, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), budget)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// SetTimeoutHeader sets the X-Request-Timeout header of an outgoing request to
+// the time remaining until its context's deadline, so the downstream service
+// can stop work the caller will no longer wait for. It does nothing if the
+// context has no deadline. If the deadline has passed, the header is set to 0.
+func SetTimeoutHeader(req *http.Request) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return
+	}
+	remaining := max(time.Until(deadline).Milliseconds(), 0)
+	req.Header.Set(RequestTimeoutHeader, strconv.FormatInt(remaining, 10))
+}
+
+// parseBudget reads the time budget from the request headers.
+func parseBudget(h http.Header) (time.Duration, bool) {
+	if v := h.Get(RequestTimeoutHeader); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ms < 0 || ms > int64(time.Duration(1<<63-1)/time.Millisecond) {
+			return 0, false
+		}
+		return time.Duration(ms) * time.Millisecond, true
+	}
+	if v := h.Get(GRPCTimeoutHeader); len(v) >= 2 && len(v) <= 9 {
+		unit, ok := grpcTimeoutUnits[v[len(v)-1]]
+		if !ok {
+			return 0, false
+		}
+		n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		if err != nil || n < 0 {
+			return 0, false
+		}
+		if n > int64(time.Duration(1<<63-1)/unit) {
+			return time.Duration(1<<63 - 1), true
+		}
+		return time.Duration(n) * unit, true
+	}
+	return 0, false
+}
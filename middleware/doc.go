@@ -7,14 +7,126 @@
 // Multiple middleware can be composed into a single middleware using CreateStack,
 // which applies them in the order provided so that the first argument is the
 // outermost wrapper and therefore the first to execute on each request.
+// A Group registers routes on an http.ServeMux under a path prefix, wrapping
+// each handler in the group's own stack, with Get, Post and similar helpers.
 //
 // Available middleware:
 //
 //   - NewLoggingMiddleware: structured request logging via log/slog, recording
-//     method, path, status code, and duration.
+//     method, path, status code, response bytes, and duration.
+//   - NewRequestID: assigns each request an ID (propagated from X-Request-ID
+//     or generated), available via RequestIDFromContext and logged by
+//     NewLoggingMiddleware.
+//   - NewLoggingMiddlewareWithLevels: request logging with per-route levels
+//     from a RouteLogLevels, which can be updated while the server runs.
+//   - NewDetailedLogging: logs headers, bodies and timings for requests chosen
+//     by a LogSampler (1 in N per route, or a trigger header).
+//   - NewAccessLog / OpenAccessLog: writes Apache Common or Combined Log
+//     Format lines to a dedicated writer or the configured access log file.
 //   - NewMaxBytesReader: limits request body size to prevent resource exhaustion.
 //   - NewSetContentType / NewSetContentTypeJSON: sets the Content-Type response header.
 //   - NewStripHTMLExtension: rewrites ".html" paths to clean URLs before routing.
+//   - NewRecovery: recovers from handler panics, converting httpabort.Abort
+//     panics into the requested response and anything else into a logged 500
+//     (plus a crash report file when CRASH_DIR is configured).
+//   - NewEnvelope / NewUnwrapEnvelope: wraps JSON responses in a standard
+//     {data, error, meta} envelope, or unwraps enveloped responses.
+//   - NewTimeout: gives handlers a fixed time limit (or HANDLER_TIMEOUT),
+//     answering 504 when it passes and discarding later writes.
+//   - NewDeadline: sets the request context deadline from the caller's
+//     X-Request-Timeout or Grpc-Timeout budget; SetTimeoutHeader forwards
+//     the remaining budget on outgoing requests.
+//   - NewCSPNonce: sets a Content-Security-Policy with a fresh per-request
+//     nonce, available to templates via CSPNonce and CSPNonceAttr.
+//   - NewMemoryGuard: rejects low-priority requests with 503 while process
+//     memory is above a threshold, optionally writing a heap profile.
+//   - NewRateLimiter: limits each client (by IP, header or custom key) with a
+//     token bucket held in a pluggable RateLimitStore, answering 429;
+//     RateLimitOverrides give particular keys their own limits and can be
+//     reloaded from a JSON file at runtime.
+//   - NewHardening: rejects requests with ambiguous framing or malformed
+//     headers and optionally strips hop-by-hop headers.
+//   - NewCompression: compresses responses with gzip or deflate by
+//     Accept-Encoding, above a minimum size and for allowed content types.
+//   - NewBasicAuth, NewBearerAuth: require Basic credentials or a bearer
+//     token, answer 401 with a WWW-Authenticate challenge, and store the
+//     authenticated Principal (PrincipalFromContext).
+//   - NewReplayProtection: requires a nonce and a recent timestamp on each
+//     request, answering 401 when stale and 409 when the nonce was already
+//     used within the window, with nonces held in a pluggable NonceStore.
+//   - NewHMACVerifier: accepts only requests signed by SignRequest with a
+//     known HMACKey within a time window, answering 401 otherwise; keys have
+//     IDs so that secrets can be rotated.
+//   - NewResponseRecorder: the response wrapper shared by the middleware in
+//     this package, tracking status and body size, for reuse by your own
+//     middleware. Its Writer preserves the wrapped writer's http.Flusher,
+//     http.Hijacker, http.Pusher and io.ReaderFrom support.
+//   - NewCanary: sends a weighted share of traffic to a canary handler tree,
+//     keeping each client on one variant with a bucket cookie; the weight can
+//     be changed at runtime through AdminHandler, and Stats counts requests
+//     and server errors per variant.
+//   - NewWebSocket: wraps websocket endpoints so they work behind the other
+//     middleware, answering 426 to non-upgrade requests and 500 with an ERROR
+//     log when no writer can be hijacked; hijacked upgrades are recorded as
+//     101 Switching Protocols. IsUpgrade detects upgrade requests.
+//   - NewBodyBuffer / BufferBody: read the request body in full, up to a
+//     limit, and make it re-readable through r.GetBody, for signature
+//     checks, logging or retries; bodies past a memory threshold spill to a
+//     temporary file that is always removed.
+//   - Metrics: process-wide counters of the requests the middleware answer
+//     themselves, named "<middleware>.<event>" (rate-limit rejections,
+//     body-limit violations, auth failures by reason, conditional GET hits,
+//     compression bytes), published by the admin package on /debug/vars.
+//   - NewBodyLogger: log request, and optionally response, bodies up to a
+//     size cap for debugging, filtered by content type, with the values of
+//     fields such as "password" or "token" masked in JSON and form bodies;
+//     only in the Local and Test environments unless configured otherwise.
+//   - NewCORS: answers CORS preflights and sets Access-Control-Allow-*
+//     headers for allowed origins, leaving other origins without them.
+//   - NewSecurityHeaders: sets HSTS, Content-Security-Policy,
+//     X-Frame-Options, nosniff and similar headers on every response.
+//
+// Load-shedding middleware reports rejections as an Overload (429 or 503 with
+// a reason and Retry-After estimate) written by a pluggable OverloadResponder;
+// the default, RespondOverloaded, sends an RFC 9457 problem+json body.
+//
+// NewCacheKey builds canonical keys from requests (sorted query parameters,
+// selected headers, tenant and the content type chosen by NegotiateContentType)
+// for middleware that caches or deduplicates responses per request.
+//
+// NewConditionalGet answers conditional GET and HEAD requests with 304 Not
+// Modified using the ETag and Last-Modified a handler declares with
+// SetValidators before rendering, so the response need not be buffered.
+//
+// NewRequestAttrs runs Extractors once per request and attaches the resulting
+// log attributes to the context, where the logging and recovery middleware,
+// Hooks callbacks and handlers read them with RequestAttrs.
+//
+// Middleware in this package that observe the response (NewLoggingMiddleware,
+// Hooks) share a single ResponseWriter wrapper per request rather than each
+// layering their own. Handlers can read the status, byte count, duration and
+// hijack state it captures with ResponseInfoFromContext.
+//
+// NewRequestStore attaches a per-request RequestStore to each request context.
+// Middleware and handlers share values through it with typed StoreKeys, which
+// is cheaper than a chain of context.WithValue calls in deep stacks.
+//
+// NewBreadcrumbs gives each request a trail of events recorded with
+// AddBreadcrumb. A logger whose handler is wrapped with NewBreadcrumbLogHandler
+// adds the trail to ERROR records logged with the request context, so a
+// failure's log line shows what happened before it.
+//
+// Hooks is a registry of lifecycle callbacks (OnRequestStart, OnResponseWritten,
+// OnPanic, OnTimeout) that lets several subsystems observe requests through a
+// single middleware and ResponseWriter wrapper.
+//
+// SwappableStack holds a composition that can be atomically replaced at runtime,
+// so configuration changes take effect without rebuilding the server handler.
+//
+// Middleware can be applied conditionally on the runtime environment with
+// When and UnlessProduction, which read the config.ServerConfig that the server
+// package attaches to each request context (or NewConfigContext, when serving
+// without the server package).
 //
 // Example — composing a middleware stack for a JSON API:
 //
@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Envelope is the standard response shape produced by NewEnvelope and
+// consumed by NewUnwrapEnvelope. Successful responses populate Data, error
+// responses (status 400 and above) populate Error. Meta carries optional
+// response-level information such as pagination or request identifiers.
+type Envelope struct {
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error json.RawMessage `json:"error,omitempty"`
+	Meta  map[string]any  `json:"meta,omitempty"`
+}
+
+// bufferedWriter captures the status code and body written by a handler so
+// that middleware can rewrite the response before it is sent to the client.
+type bufferedWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func newBufferedWriter() *bufferedWriter {
+	return &bufferedWriter{header: make(http.Header)}
+}
+
+func (b *bufferedWriter) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedWriter) WriteHeader(statusCode int) {
+	if b.statusCode == 0 {
+		b.statusCode = statusCode
+	}
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	if b.statusCode == 0 {
+		b.statusCode = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// status returns the captured status code, defaulting to 200 when the
+// handler never wrote a header.
+func (b *bufferedWriter) status() int {
+	if b.statusCode == 0 {
+		return http.StatusOK
+	}
+	return b.statusCode
+}
+
+// flush copies the captured headers to w and writes body with the captured
+// status code. Content-Length is recomputed since body may have been rewritten.
+func (b *bufferedWriter) flush(w http.ResponseWriter, body []byte) {
+	dst := w.Header()
+	for k, v := range b.header {
+		dst[k] = v
+	}
+	dst.Del("Content-Length")
+	if len(body) > 0 {
+		dst.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.WriteHeader(b.status())
+	w.Write(body)
+}
+
+// isJSONContentType reports whether the Content-Type header value describes
+// a JSON document, including structured suffixes such as application/problem+json.
+func isJSONContentType(value string) bool {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// NewEnvelope returns middleware that wraps JSON response bodies in an Envelope.
+// Responses with a status below 400 are placed under "data", responses with a
+// status of 400 or above are placed under "error". If meta is non-nil it is
+// called for each request and its result is placed under "meta".
+//
+// Only responses whose Content-Type is JSON are rewritten; other responses,
+// empty bodies, and bodies that are not valid JSON are passed through unchanged.
+// The response is buffered in memory, so this middleware should not be used
+// for streaming endpoints. Upgrade requests, such as websocket handshakes, are
+// passed through.
+//
+// Apply it to the route groups that should share the envelope shape, e.g.:
+//
+//	api := middleware.CreateStack(
+//	    middleware.NewSetContentTypeJSON(),
+//	    middleware.NewEnvelope(nil),
+//	)
+func NewEnvelope(meta func(r *http.Request) map[string]any) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, upgrade := IsUpgrade(r); upgrade {
+				next.ServeHTTP(w, r)
+				return
+			}
+			buf := newBufferedWriter()
+			next.ServeHTTP(buf, r)
+
+			body := buf.body.Bytes()
+			if buf.body.Len() == 0 || !isJSONContentType(buf.header.Get("Content-Type")) || !json.Valid(body) {
+				buf.flush(w, body)
+				return
+			}
+
+			env := Envelope{}
+			if buf.status() >= http.StatusBadRequest {
+				env.Error = json.RawMessage(body)
+			} else {
+				env.Data = json.RawMessage(body)
+			}
+			if meta != nil {
+				env.Meta = meta(r)
+			}
+
+			wrapped, err := json.Marshal(env)
+			if err != nil {
+				buf.flush(w, body)
+				return
+			}
+			buf.header.Set("Content-Type", "application/json")
+			buf.flush(w, wrapped)
+		})
+	}
+}
+
+// NewUnwrapEnvelope returns middleware that performs the inverse of NewEnvelope:
+// JSON responses shaped as an Envelope are replaced by the contents of their
+// "data" field, or their "error" field when the status is 400 or above.
+//
+// This is useful for route groups (e.g. legacy clients) that must receive bare
+// payloads from handlers that already produce enveloped responses. Responses
+// that are not JSON, or that do not decode as an Envelope, are passed through
+// unchanged. Like NewEnvelope it buffers the response, and passes upgrade
+// requests, such as websocket handshakes, through.
+func NewUnwrapEnvelope() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, upgrade := IsUpgrade(r); upgrade {
+				next.ServeHTTP(w, r)
+				return
+			}
+			buf := newBufferedWriter()
+			next.ServeHTTP(buf, r)
+
+			body := buf.body.Bytes()
+			if buf.body.Len() == 0 || !isJSONContentType(buf.header.Get("Content-Type")) {
+				buf.flush(w, body)
+				return
+			}
+
+			var env Envelope
+			if err := json.Unmarshal(body, &env); err != nil {
+				buf.flush(w, body)
+				return
+			}
+
+			payload := env.Data
+			if buf.status() >= http.StatusBadRequest {
+				payload = env.Error
+			}
+			if payload == nil {
+				buf.flush(w, body)
+				return
+			}
+			buf.flush(w, payload)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// Extractor derives application-specific attributes from a request, such as
+// the tenant, API version or client application.
+type Extractor func(r *http.Request) []slog.Attr
+
+// requestAttrsKey is the context key under which extracted request attributes are stored.
+type requestAttrsKey struct{}
+
+// NewRequestAttrs returns middleware that runs the extractors once per
+// request and attaches the resulting attributes to the request context.
+// The logging, detailed logging and recovery middleware add them to their
+// log records, recovery crash reports include them, and Hooks callbacks and
+// handlers can read them with RequestAttrs, so custom fields appear the same
+// way in every subsystem.
+//
+// Extractors run before the rest of the stack, so they see the request as the
+// client sent it. Place NewRequestAttrs outside the middleware that consume
+// the attributes. Attributes from several NewRequestAttrs in one stack are
+// combined, outermost first.
+func NewRequestAttrs(extractors ...Extractor) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attrs := RequestAttrs(r.Context())
+			for _, extract := range extractors {
+				attrs = append(attrs, extract(r)...)
+			}
+			ctx := context.WithValue(r.Context(), requestAttrsKey{}, attrs)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestAttrs returns the attributes extracted for the request carrying ctx
+// by NewRequestAttrs, or nil if there are none. The returned slice must not be
+// modified.
+func RequestAttrs(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(requestAttrsKey{}).([]slog.Attr)
+	return attrs[:len(attrs):len(attrs)]
+}
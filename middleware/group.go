@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Group registers handlers on an http.ServeMux under a common path prefix,
+// wrapping each one in the group's middleware stack. It lets different parts
+// of an application use different stacks without wrapping every handler by
+// hand:
+//
+//	mux := http.NewServeMux()
+//	root := middleware.NewGroup(mux)
+//	api := root.Group("/api", middleware.NewSetContentTypeJSON(), auth)
+//	api.Get("/users/{id}", getUser)   // GET /api/users/{id}
+//	api.Post("/users", createUser)    // POST /api/users
+//	root.Group("/public").Handle("/", http.FileServerFS(static))
+//
+// Middleware runs only for requests that match a route of the group. The
+// mux's own 404 and 405 responses are not wrapped, so middleware that must
+// see every request belongs around the mux instead.
+type Group struct {
+	mux    *http.ServeMux
+	prefix string
+	stack  []Middleware
+}
+
+// NewGroup returns the root group of mux, with no prefix, whose handlers are
+// wrapped in xs in the same order as CreateStack.
+func NewGroup(mux *http.ServeMux, xs ...Middleware) *Group {
+	return &Group{mux: mux, stack: xs}
+}
+
+// Group returns a subgroup registering its routes under prefix, relative to
+// g's own prefix. Its handlers are wrapped in g's middleware and then xs, so
+// g's run first.
+func (g *Group) Group(prefix string, xs ...Middleware) *Group {
+	return &Group{
+		mux:    g.mux,
+		prefix: g.prefix + strings.TrimSuffix(prefix, "/"),
+		stack:  append(g.stack[:len(g.stack):len(g.stack)], xs...),
+	}
+}
+
+// Handle registers handler for pattern, a ServeMux pattern whose path is
+// relative to the group's prefix, such as "/users" or "GET /users/{id}".
+// Host patterns are not supported. Handle panics like ServeMux.Handle if the
+// pattern is invalid or conflicts with an existing one.
+func (g *Group) Handle(pattern string, handler http.Handler) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = "", pattern
+	} else {
+		method += " "
+	}
+	path = strings.TrimLeft(path, " \t")
+	if !strings.HasPrefix(path, "/") {
+		panic("middleware: Group pattern " + pattern + " must have a path beginning with /")
+	}
+	g.mux.Handle(method+g.prefix+path, CreateStack(g.stack...)(handler))
+}
+
+// HandleFunc registers fn for pattern, like Handle.
+func (g *Group) HandleFunc(pattern string, fn http.HandlerFunc) {
+	g.Handle(pattern, fn)
+}
+
+// Get registers fn for GET (and therefore HEAD) requests to path.
+func (g *Group) Get(path string, fn http.HandlerFunc) {
+	g.Handle(http.MethodGet+" "+path, fn)
+}
+
+// Post registers fn for POST requests to path.
+func (g *Group) Post(path string, fn http.HandlerFunc) {
+	g.Handle(http.MethodPost+" "+path, fn)
+}
+
+// Put registers fn for PUT requests to path.
+func (g *Group) Put(path string, fn http.HandlerFunc) {
+	g.Handle(http.MethodPut+" "+path, fn)
+}
+
+// Patch registers fn for PATCH requests to path.
+func (g *Group) Patch(path string, fn http.HandlerFunc) {
+	g.Handle(http.MethodPatch+" "+path, fn)
+}
+
+// Delete registers fn for DELETE requests to path.
+func (g *Group) Delete(path string, fn http.HandlerFunc) {
+	g.Handle(http.MethodDelete+" "+path, fn)
+}
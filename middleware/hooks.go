@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// Hooks is a registry of callbacks invoked at points in the lifecycle of each
+// request. It gives subsystems such as logging, metrics, and auditing a single
+// extension point that shares one ResponseWriter wrapper, rather than each
+// stacking its own. The wrapper is the same one used by NewLoggingMiddleware,
+// so combining the two does not add a second layer.
+//
+// Callbacks run synchronously on the request goroutine, in registration
+// order, so they should be fast. Callbacks must not register further hooks.
+//
+// A Hooks is safe for concurrent use; callbacks may be registered while serving.
+type Hooks struct {
+	mu              sync.RWMutex
+	requestStart    []func(r *http.Request)
+	responseWritten []func(r *http.Request, info ResponseInfo)
+	panics          []func(r *http.Request, recovered any)
+	timeouts        []func(r *http.Request)
+}
+
+// NewHooks returns an empty Hooks registry.
+func NewHooks() *Hooks {
+	return &Hooks{}
+}
+
+// OnRequestStart registers fn to be called before the request is passed to
+// the next handler.
+func (h *Hooks) OnRequestStart(fn func(r *http.Request)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requestStart = append(h.requestStart, fn)
+}
+
+// OnResponseWritten registers fn to be called after the next handler returns
+// normally, with details of the response it wrote.
+func (h *Hooks) OnResponseWritten(fn func(r *http.Request, info ResponseInfo)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.responseWritten = append(h.responseWritten, fn)
+}
+
+// OnPanic registers fn to be called when the next handler panics, with the
+// recovered value. The panic is re-raised after the callbacks run so that
+// recovery middleware further out, or net/http itself, still handles it.
+// Panics with http.ErrAbortHandler are not reported.
+func (h *Hooks) OnPanic(fn func(r *http.Request, recovered any)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.panics = append(h.panics, fn)
+}
+
+// OnTimeout registers fn to be called when the next handler returns after the
+// request context's deadline has been exceeded. OnResponseWritten callbacks
+// are still called for timed-out requests.
+func (h *Hooks) OnTimeout(fn func(r *http.Request)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.timeouts = append(h.timeouts, fn)
+}
+
+// Apply wraps next so that the registered hooks are invoked for each request.
+// It has the Middleware signature, so h.Apply can be passed to CreateStack.
+// Place it near the outside of the stack so that timings cover the other middleware.
+func (h *Hooks) Apply(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.mu.RLock()
+		requestStart, responseWritten := h.requestStart, h.responseWritten
+		panics, timeouts := h.panics, h.timeouts
+		h.mu.RUnlock()
+
+		wrapped, r := NewResponseRecorder(w, r)
+
+		for _, fn := range requestStart {
+			fn(r)
+		}
+
+		if len(panics) > 0 {
+			defer func() {
+				if v := recover(); v != nil {
+					if v != http.ErrAbortHandler {
+						for _, fn := range panics {
+							fn(r, v)
+						}
+					}
+					panic(v)
+				}
+			}()
+		}
+
+		next.ServeHTTP(wrapped.Writer(), r)
+
+		if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			for _, fn := range timeouts {
+				fn(r)
+			}
+		}
+
+		if len(responseWritten) > 0 {
+			info := wrapped.Info()
+			for _, fn := range responseWritten {
+				fn(r, info)
+			}
+		}
+	})
+}
@@ -3,57 +3,84 @@ package middleware
 import (
 	"log/slog"
 	"net/http"
-	"time"
+	"sync/atomic"
 )
 
-// wrappedWriter wraps http.ResponseWriter to capture the status code.
-type wrappedWriter struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func (w *wrappedWriter) WriteHeader(statusCode int) {
-	w.statusCode = statusCode
-	w.ResponseWriter.WriteHeader(statusCode)
-}
-
-func (w *wrappedWriter) Write(b []byte) (int, error) {
-	if w.statusCode == 0 {
-		w.statusCode = http.StatusOK
-	}
-	return w.ResponseWriter.Write(b)
-}
-
 // NewLoggingMiddleware returns middleware that logs HTTP requests.
-// Logs include method, path, status code, and duration.
+// Logs include method, path, status code, response body bytes and duration,
+// the request ID when NewRequestID has assigned one, and any attributes
+// attached by NewRequestAttrs.
 func NewLoggingMiddleware(logger *slog.Logger) Middleware {
+	return NewLoggingMiddlewareWithLevels(logger, nil)
+}
+
+// NewLoggingMiddlewareWithLevels returns middleware that logs HTTP requests
+// like NewLoggingMiddleware, but logs the "request complete" record at the
+// level levels assigns to the request path instead of always at INFO. This
+// lets noisy endpoints such as health checks log at DEBUG while other routes
+// log at INFO. A nil levels logs every request at INFO.
+func NewLoggingMiddlewareWithLevels(logger *slog.Logger, levels *RouteLogLevels) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			start := time.Now()
-
-			wrapped := &wrappedWriter{
-				ResponseWriter: w,
-				statusCode:     0,
-			}
+			wrapped, r := NewResponseRecorder(w, r)
 
-			logger.DebugContext(r.Context(), "handling request",
+			attrs := []slog.Attr{
 				slog.String("method", r.Method),
 				slog.String("path", r.URL.Path),
-			)
-
-			next.ServeHTTP(wrapped, r)
-
-			statusCode := wrapped.statusCode
-			if statusCode == 0 {
-				statusCode = http.StatusOK
 			}
+			if id, ok := RequestIDFromContext(r.Context()); ok {
+				attrs = append(attrs, slog.String("request_id", id))
+			}
+			logger.LogAttrs(r.Context(), slog.LevelDebug, "handling request", attrs...)
 
-			logger.InfoContext(r.Context(), "request complete",
-				slog.String("method", r.Method),
-				slog.String("path", r.URL.Path),
-				slog.Int("status", statusCode),
-				slog.Duration("duration", time.Since(start)),
+			next.ServeHTTP(wrapped.Writer(), r)
+
+			info := wrapped.Info()
+			attrs = append(attrs,
+				slog.Int("status", info.Status),
+				slog.Int64("bytes", info.Bytes),
+				slog.Duration("duration", info.Duration),
 			)
+			attrs = append(attrs, RequestAttrs(r.Context())...)
+			logger.LogAttrs(r.Context(), levels.Level(r.URL.Path), "request complete", attrs...)
 		})
 	}
 }
+
+// RouteLogLevels assigns log levels to request paths for
+// NewLoggingMiddlewareWithLevels. Patterns follow http.ServeMux path
+// conventions: a pattern ending in "/" matches every path below it, any other
+// pattern matches only that exact path, and the longest matching pattern
+// wins. Paths matching no pattern are logged at INFO.
+//
+// The overrides can be replaced at any time with Set, so they can be changed
+// while the server is running. A RouteLogLevels is safe for concurrent use.
+type RouteLogLevels struct {
+	routes atomic.Pointer[routeTable[slog.Level]]
+}
+
+// NewRouteLogLevels returns a RouteLogLevels with the given pattern to level
+// overrides, as produced by config.ParseRouteLogLevels.
+func NewRouteLogLevels(levels map[string]slog.Level) *RouteLogLevels {
+	l := &RouteLogLevels{}
+	l.Set(levels)
+	return l
+}
+
+// Set replaces all overrides with levels. Requests already in progress may
+// still be logged with the previous overrides.
+func (l *RouteLogLevels) Set(levels map[string]slog.Level) {
+	routes := newRouteTable(levels)
+	l.routes.Store(&routes)
+}
+
+// Level returns the level at which requests for path are logged.
+func (l *RouteLogLevels) Level(path string) slog.Level {
+	if l == nil {
+		return slog.LevelInfo
+	}
+	if level, ok := l.routes.Load().lookup(path); ok {
+		return level
+	}
+	return slog.LevelInfo
+}
@@ -1,6 +1,10 @@
 package middleware
 
-import "net/http"
+import (
+	"errors"
+	"io"
+	"net/http"
+)
 
 // NewMaxBytesReader returns middleware that limits request body size to maxBytes.
 // Bodies exceeding this limit will cause an error response. This prevents
@@ -12,8 +16,25 @@ func NewMaxBytesReader(maxBytes int64) Middleware {
 	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			r.Body = &countingMaxBytesReader{ReadCloser: http.MaxBytesReader(w, r.Body, maxBytes)}
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// countingMaxBytesReader counts the first time a body exceeds its limit in
+// the maxbytes.exceeded metric.
+type countingMaxBytesReader struct {
+	io.ReadCloser
+	counted bool
+}
+
+func (r *countingMaxBytesReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	var tooLarge *http.MaxBytesError
+	if err != nil && !r.counted && errors.As(err, &tooLarge) {
+		r.counted = true
+		countMetric("maxbytes.exceeded", 1)
+	}
+	return n, err
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MemoryGuardOptions configures NewMemoryGuard.
+type MemoryGuardOptions struct {
+	// Threshold is the process memory, in bytes, above which low-priority
+	// requests are rejected. Memory is measured with runtime/metrics as the
+	// memory mapped by the Go runtime minus heap memory released back to the
+	// operating system, which closely tracks the resident set size of a Go
+	// program. Required.
+	Threshold uint64
+	// Interval is the minimum time between memory samples. Sampling happens
+	// on the request path, at most once per Interval. Defaults to 1 second.
+	Interval time.Duration
+	// LowPriority reports whether a request may be rejected while memory is
+	// above Threshold. If nil, every request may be rejected.
+	LowPriority func(r *http.Request) bool
+	// ProfileDir, if set, is the directory a heap profile is written to each
+	// time memory crosses above Threshold, for later analysis with go tool pprof.
+	ProfileDir string
+	// Logger receives warnings when memory crosses Threshold. Defaults to slog.Default().
+	Logger *slog.Logger
+	// Respond writes the response for rejected requests. Defaults to RespondOverloaded.
+	Respond OverloadResponder
+}
+
+// memoryGuard holds the sampled memory state shared by all requests.
+type memoryGuard struct {
+	opts       MemoryGuardOptions
+	read       func() uint64
+	lastSample atomic.Int64
+	over       atomic.Bool
+	sampling   sync.Mutex
+}
+
+// NewMemoryGuard returns middleware that protects the process from being
+// killed for running out of memory. When sampled memory use is above
+// opts.Threshold, requests for which opts.LowPriority returns true are
+// rejected with 503 Service Unavailable (reason "memory_pressure", retry after
+// the sampling interval) through opts.Respond, while other requests continue
+// to be served. Requests are accepted again as soon as a
+// sample falls back below the threshold.
+//
+// Each time memory crosses above the threshold a warning is logged and, if
+// opts.ProfileDir is set, a heap profile is written in the background.
+//
+// NewMemoryGuard panics if opts.Threshold is zero.
+func NewMemoryGuard(opts MemoryGuardOptions) Middleware {
+	return newMemoryGuard(opts, readProcessMemory)
+}
+
+// newMemoryGuard builds the middleware with a custom memory reader, for tests.
+func newMemoryGuard(opts MemoryGuardOptions, read func() uint64) Middleware {
+	if opts.Threshold == 0 {
+		panic("middleware: MemoryGuardOptions.Threshold must be set")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	g := &memoryGuard{opts: opts, read: read}
+	overload := Overload{
+		Status:     http.StatusServiceUnavailable,
+		Reason:     "memory_pressure",
+		Detail:     "The server is low on memory and is temporarily shedding load.",
+		RetryAfter: opts.Interval,
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			g.maybeSample()
+			if g.over.Load() && (opts.LowPriority == nil || opts.LowPriority(r)) {
+				respondOverloaded(opts.Respond, w, r, overload)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// maybeSample reads memory use if the last sample is older than the interval.
+// Only one request samples at a time; others use the previous result.
+func (g *memoryGuard) maybeSample() {
+	now := time.Now().UnixNano()
+	if now-g.lastSample.Load() < int64(g.opts.Interval) {
+		return
+	}
+	if !g.sampling.TryLock() {
+		return
+	}
+	defer g.sampling.Unlock()
+	g.lastSample.Store(now)
+
+	used := g.read()
+	over := used > g.opts.Threshold
+	if over && !g.over.Load() {
+		g.opts.Logger.Warn("memory above threshold, shedding low-priority requests",
+			slog.Uint64("bytes", used),
+			slog.Uint64("threshold", g.opts.Threshold),
+		)
+		if g.opts.ProfileDir != "" {
+			go g.writeHeapProfile()
+		}
+	} else if !over && g.over.Load() {
+		g.opts.Logger.Info("memory below threshold, accepting all requests",
+			slog.Uint64("bytes", used),
+			slog.Uint64("threshold", g.opts.Threshold),
+		)
+	}
+	g.over.Store(over)
+}
+
+// writeHeapProfile writes a heap profile to a timestamped file in ProfileDir.
+func (g *memoryGuard) writeHeapProfile() {
+	name := filepath.Join(g.opts.ProfileDir, fmt.Sprintf("heap-%s.pprof", time.Now().UTC().Format("20060102T150405.000000000")))
+	if err := writeProfile(name, "heap"); err != nil {
+		g.opts.Logger.Error("failed to write heap profile", slog.String("error", err.Error()))
+		return
+	}
+	g.opts.Logger.Warn("wrote heap profile", slog.String("file", name))
+}
+
+// writeProfile writes the named pprof profile to path.
+func writeProfile(path, profile string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup(profile).WriteTo(f, 0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// memorySamples are the runtime metrics used to approximate resident memory.
+var memorySamples = []string{
+	"/memory/classes/total:bytes",
+	"/memory/classes/heap/released:bytes",
+}
+
+// readProcessMemory returns the memory mapped by the Go runtime that has not
+// been released back to the operating system.
+func readProcessMemory() uint64 {
+	samples := make([]metrics.Sample, len(memorySamples))
+	for i, name := range memorySamples {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+	total, released := samples[0].Value.Uint64(), samples[1].Value.Uint64()
+	if released > total {
+		return 0
+	}
+	return total - released
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// counters holds the metrics reported by Metrics, by name.
+var counters sync.Map // string → *atomic.Int64
+
+// countMetric adds n to the named counter.
+func countMetric(name string, n int64) {
+	c, ok := counters.Load(name)
+	if !ok {
+		c, _ = counters.LoadOrStore(name, new(atomic.Int64))
+	}
+	c.(*atomic.Int64).Add(n)
+}
+
+// Metrics returns the counters the middleware of this package keep about
+// the requests they answer themselves, so operators can see why requests
+// fail before reaching the handler. Names have the form
+// "<middleware>.<event>" and a counter appears once it is first counted:
+//
+//	ratelimit.rejected              answered 429 by NewRateLimiter
+//	ratelimit.store_errors          allowed because the RateLimitStore failed
+//	maxbytes.exceeded               bodies cut off by NewMaxBytesReader
+//	bodybuffer.too_large            answered 413 by NewBodyBuffer
+//	auth.basic.missing_credentials  answered 401 by NewBasicAuth
+//	auth.basic.invalid_credentials
+//	auth.bearer.missing_token       answered 401 by NewBearerAuth
+//	auth.bearer.invalid_token
+//	auth.hmac.malformed             answered 401 by NewHMACVerifier
+//	auth.hmac.stale
+//	auth.hmac.invalid_signature
+//	auth.hmac.too_large             answered 413 by NewHMACVerifier
+//	replay.malformed                answered 401 by NewReplayProtection
+//	replay.stale
+//	replay.reused                   answered 409 by NewReplayProtection
+//	replay.store_errors             answered 503 by NewReplayProtection
+//	conditional.hits                answered 304 by NewConditionalGet
+//	conditional.misses              conditional requests whose validators changed
+//	compression.responses           responses compressed by NewCompression
+//	compression.bytes_in            their size before compression
+//	compression.bytes_out           and after, so the compression ratio is
+//	                                bytes_out / bytes_in
+//
+// The counters are process-wide, shared by all instances of a middleware,
+// and only grow. The admin package publishes them as the "middleware"
+// expvar variable, served on its /debug/vars endpoint.
+func Metrics() map[string]int64 {
+	m := make(map[string]int64)
+	for name, c := range counters.Range {
+		m[name.(string)] = c.(*atomic.Int64).Load()
+	}
+	return m
+}
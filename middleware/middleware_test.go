@@ -1,16 +1,32 @@
 package middleware
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+	"github.com/harrydayexe/GoWebUtilities/httpabort"
 )
 
 // Test helper functions
@@ -98,10 +114,10 @@ func runConcurrent(t *testing.T, handler http.Handler, count int) {
 	}
 }
 
-// TestWrappedWriter_ImplicitStatus verifies that wrappedWriter correctly
+// TestResponseRecorder_ImplicitStatus verifies that ResponseRecorder correctly
 // captures an implicit 200 status when the handler calls Write() without
 // first calling WriteHeader().
-func TestWrappedWriter_ImplicitStatus(t *testing.T) {
+func TestResponseRecorder_ImplicitStatus(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Only call Write(), never WriteHeader()
 		w.Write([]byte("hello"))
@@ -191,9 +207,9 @@ func TestMaxBytesReader_DefaultZero(t *testing.T) {
 	})
 }
 
-// TestWrappedWriter_WriteHeader verifies that wrappedWriter correctly captures
+// TestResponseRecorder_WriteHeader verifies that ResponseRecorder correctly captures
 // the status code when WriteHeader is called explicitly.
-func TestWrappedWriter_WriteHeader(t *testing.T) {
+func TestResponseRecorder_WriteHeader(t *testing.T) {
 	tests := []struct {
 		name       string
 		statusCode int
@@ -223,9 +239,9 @@ func TestWrappedWriter_WriteHeader(t *testing.T) {
 	}
 }
 
-// TestWrappedWriter_Write verifies that wrappedWriter correctly delegates
+// TestResponseRecorder_Write verifies that ResponseRecorder correctly delegates
 // the Write call to the underlying ResponseWriter.
-func TestWrappedWriter_Write(t *testing.T) {
+func TestResponseRecorder_Write(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		n, err := w.Write([]byte("test response"))
 		if err != nil {
@@ -247,9 +263,9 @@ func TestWrappedWriter_Write(t *testing.T) {
 	assertBody(t, w, "test response")
 }
 
-// TestWrappedWriter_MultipleWrites verifies that multiple Write calls work correctly
+// TestResponseRecorder_MultipleWrites verifies that multiple Write calls work correctly
 // and that the implicit status code is only set on the first write.
-func TestWrappedWriter_MultipleWrites(t *testing.T) {
+func TestResponseRecorder_MultipleWrites(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("first "))
 		w.Write([]byte("second "))
@@ -1053,3 +1069,3191 @@ func Test_CacheControlMiddleware(t *testing.T) {
 		})
 	}
 }
+
+// TestEnvelope_WrapsJSON verifies that JSON responses are wrapped under
+// "data" for success statuses and under "error" for error statuses.
+func TestEnvelope_WrapsJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantBody string
+	}{
+		{"success", http.StatusOK, `{"id":1}`, `{"data":{"id":1},"meta":{"version":"v1"}}`},
+		{"created", http.StatusCreated, `[1,2]`, `{"data":[1,2],"meta":{"version":"v1"}}`},
+		{"client_error", http.StatusNotFound, `{"msg":"missing"}`, `{"error":{"msg":"missing"},"meta":{"version":"v1"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			mw := NewEnvelope(func(r *http.Request) map[string]any {
+				return map[string]any{"version": "v1"}
+			})
+			req := httptest.NewRequest("GET", "/", nil)
+			w := httptest.NewRecorder()
+
+			mw(handler).ServeHTTP(w, req)
+
+			assertStatus(t, w, tt.status)
+			assertBody(t, w, tt.wantBody)
+			assertHeader(t, w, "Content-Length", fmt.Sprint(len(tt.wantBody)))
+		})
+	}
+}
+
+// TestEnvelope_PassThrough verifies that non-JSON, empty, and invalid JSON
+// responses are forwarded unchanged.
+func TestEnvelope_PassThrough(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"html", "text/html", "<p>hi</p>"},
+		{"empty", "application/json", ""},
+		{"invalid_json", "application/json", "{not json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+			})
+
+			mw := NewEnvelope(nil)
+			req := httptest.NewRequest("GET", "/", nil)
+			w := httptest.NewRecorder()
+
+			mw(handler).ServeHTTP(w, req)
+
+			assertStatus(t, w, http.StatusOK)
+			assertBody(t, w, tt.body)
+		})
+	}
+}
+
+// TestUnwrapEnvelope verifies that enveloped responses are replaced by their
+// data or error payload and that other JSON is left untouched.
+func TestUnwrapEnvelope(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantBody string
+	}{
+		{"data", http.StatusOK, `{"data":{"id":1},"meta":{"page":1}}`, `{"id":1}`},
+		{"error", http.StatusBadRequest, `{"error":{"msg":"bad"}}`, `{"msg":"bad"}`},
+		{"not_enveloped", http.StatusOK, `{"id":1}`, `{"id":1}`},
+		{"array", http.StatusOK, `[1,2]`, `[1,2]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			mw := NewUnwrapEnvelope()
+			req := httptest.NewRequest("GET", "/", nil)
+			w := httptest.NewRecorder()
+
+			mw(handler).ServeHTTP(w, req)
+
+			assertStatus(t, w, tt.status)
+			assertBody(t, w, tt.wantBody)
+		})
+	}
+}
+
+// TestConditional_When verifies that When applies the wrapped middleware only
+// for requests running in the matching environment.
+func TestConditional_When(t *testing.T) {
+	tests := []struct {
+		name      string
+		ctxConfig *config.ServerConfig
+		wantApply bool
+	}{
+		{"matching_env", &config.ServerConfig{Environment: config.Local}, true},
+		{"other_env", &config.ServerConfig{Environment: config.Production}, false},
+		{"no_config", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			mw := When(config.Local, NewSetContentType("text/debug"))
+			if tt.ctxConfig != nil {
+				mw = CreateStack(NewConfigContext(*tt.ctxConfig), mw)
+			}
+			req := httptest.NewRequest("GET", "/", nil)
+			w := httptest.NewRecorder()
+
+			mw(handler).ServeHTTP(w, req)
+
+			want := ""
+			if tt.wantApply {
+				want = "text/debug"
+			}
+			assertHeader(t, w, "Content-Type", want)
+		})
+	}
+}
+
+// TestConditional_UnlessProduction verifies that UnlessProduction skips the
+// wrapped middleware in Production and when no config is available.
+func TestConditional_UnlessProduction(t *testing.T) {
+	tests := []struct {
+		name      string
+		ctxConfig *config.ServerConfig
+		wantApply bool
+	}{
+		{"local", &config.ServerConfig{Environment: config.Local}, true},
+		{"test", &config.ServerConfig{Environment: config.Test}, true},
+		{"production", &config.ServerConfig{Environment: config.Production}, false},
+		{"no_config", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			mw := UnlessProduction(NewSetContentType("text/debug"))
+			if tt.ctxConfig != nil {
+				mw = CreateStack(NewConfigContext(*tt.ctxConfig), mw)
+			}
+			req := httptest.NewRequest("GET", "/", nil)
+			w := httptest.NewRecorder()
+
+			mw(handler).ServeHTTP(w, req)
+
+			want := ""
+			if tt.wantApply {
+				want = "text/debug"
+			}
+			assertHeader(t, w, "Content-Type", want)
+		})
+	}
+}
+
+// TestSwappableStack_Swap verifies that swapping the stack changes the
+// middleware applied to subsequent requests.
+func TestSwappableStack_Swap(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	stack := NewSwappableStack(NewSetContentType("text/plain"))
+	wrapped := stack.Apply(handler)
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		wrapped.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w
+	}
+
+	assertHeader(t, serve(), "Content-Type", "text/plain")
+
+	stack.Swap(NewSetContentTypeJSON(), NewCacheControl(time.Minute))
+	w := serve()
+	assertHeader(t, w, "Content-Type", "application/json")
+	assertHeader(t, w, "Cache-Control", "public, max-age=60")
+
+	stack.Swap()
+	w = serve()
+	assertHeader(t, w, "Content-Type", "")
+	assertHeader(t, w, "Cache-Control", "")
+}
+
+// TestSwappableStack_InFlightRequestKeepsStack verifies that a request in
+// flight during a swap completes with the stack it started with.
+func TestSwappableStack_InFlightRequestKeepsStack(t *testing.T) {
+	var recorder []string
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+	})
+
+	stack := NewSwappableStack(recordingMiddleware("old", &recorder))
+	wrapped := stack.Apply(handler)
+
+	done := make(chan struct{})
+	go func() {
+		wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+		close(done)
+	}()
+	<-started
+
+	var newRecorder []string
+	stack.Swap(recordingMiddleware("new", &newRecorder))
+	close(release)
+	<-done
+
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if want := []string{"old:before", "old:after"}; !slices.Equal(recorder, want) {
+		t.Errorf("old stack: got %v, want %v", recorder, want)
+	}
+	if want := []string{"new:before", "new:after"}; !slices.Equal(newRecorder, want) {
+		t.Errorf("new stack: got %v, want %v", newRecorder, want)
+	}
+}
+
+// TestSwappableStack_ConcurrentSwap verifies that swapping while serving
+// concurrent requests is race free.
+func TestSwappableStack_ConcurrentSwap(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	stack := NewSwappableStack(NewSetContentTypeJSON())
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				stack.Swap(NewSetContentType("text/plain"))
+			}
+		}
+	}()
+
+	runConcurrent(t, stack.Apply(handler), 50)
+	close(stop)
+	wg.Wait()
+}
+
+// TestHooks_Lifecycle verifies that request start and response written hooks
+// are called in order with the details of the response.
+func TestHooks_Lifecycle(t *testing.T) {
+	var events []string
+	var info ResponseInfo
+
+	hooks := NewHooks()
+	hooks.OnRequestStart(func(r *http.Request) { events = append(events, "start:"+r.URL.Path) })
+	hooks.OnRequestStart(func(r *http.Request) { events = append(events, "start2") })
+	hooks.OnResponseWritten(func(r *http.Request, i ResponseInfo) {
+		events = append(events, "written")
+		info = i
+	})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events = append(events, "handler")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+
+	w := httptest.NewRecorder()
+	hooks.Apply(handler).ServeHTTP(w, httptest.NewRequest("POST", "/items", nil))
+
+	if want := []string{"start:/items", "start2", "handler", "written"}; !slices.Equal(events, want) {
+		t.Errorf("events: got %v, want %v", events, want)
+	}
+	if info.Status != http.StatusCreated || info.Bytes != 5 {
+		t.Errorf("info: got %+v, want status 201 and 5 bytes", info)
+	}
+	assertStatus(t, w, http.StatusCreated)
+	assertBody(t, w, "hello")
+}
+
+// TestHooks_ImplicitStatus verifies that a handler writing nothing is
+// reported with the implicit 200 status.
+func TestHooks_ImplicitStatus(t *testing.T) {
+	var info ResponseInfo
+	hooks := NewHooks()
+	hooks.OnResponseWritten(func(r *http.Request, i ResponseInfo) { info = i })
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	hooks.Apply(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if info.Status != http.StatusOK || info.Bytes != 0 {
+		t.Errorf("info: got %+v, want status 200 and 0 bytes", info)
+	}
+}
+
+// TestHooks_Panic verifies that panic hooks receive the recovered value and
+// that the panic is re-raised.
+func TestHooks_Panic(t *testing.T) {
+	var recovered any
+	written := false
+	hooks := NewHooks()
+	hooks.OnPanic(func(r *http.Request, v any) { recovered = v })
+	hooks.OnResponseWritten(func(r *http.Request, i ResponseInfo) { written = true })
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Errorf("expected re-panic with boom, got %v", v)
+			}
+		}()
+		hooks.Apply(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+
+	if recovered != "boom" {
+		t.Errorf("panic hook got %v, want boom", recovered)
+	}
+	if written {
+		t.Error("response written hook should not run after a panic")
+	}
+}
+
+// TestHooks_Timeout verifies that timeout hooks fire when the request context
+// deadline has passed by the time the handler returns.
+func TestHooks_Timeout(t *testing.T) {
+	timedOut := false
+	hooks := NewHooks()
+	hooks.OnTimeout(func(r *http.Request) { timedOut = true })
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.WriteHeader(http.StatusGatewayTimeout)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	hooks.Apply(handler).ServeHTTP(httptest.NewRecorder(), req)
+
+	if !timedOut {
+		t.Error("expected timeout hook to fire")
+	}
+}
+
+// TestSharedResponseWriter_SingleLayer verifies that stacking the logging
+// middleware and Hooks wraps the ResponseWriter only once.
+func TestSharedResponseWriter_SingleLayer(t *testing.T) {
+	logger, _ := newTestLogger()
+	hooks := NewHooks()
+
+	rec := httptest.NewRecorder()
+	var layers int
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for {
+			u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+			if !ok {
+				break
+			}
+			layers++
+			w = u.Unwrap()
+		}
+		if w != rec {
+			t.Error("innermost writer should be the recorder")
+		}
+	})
+
+	stack := CreateStack(hooks.Apply, NewLoggingMiddleware(logger))
+	stack(handler).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if layers != 1 {
+		t.Errorf("wrapper layers: got %d, want 1", layers)
+	}
+}
+
+// TestSharedResponseWriter_NotBypassedByReplacement verifies that a middleware
+// replacing the writer between two wrapping middleware is not bypassed.
+func TestSharedResponseWriter_NotBypassedByReplacement(t *testing.T) {
+	logger, _ := newTestLogger()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":1}`))
+	})
+
+	stack := CreateStack(NewLoggingMiddleware(logger), NewEnvelope(nil), NewLoggingMiddleware(logger))
+	w := httptest.NewRecorder()
+	stack(handler).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	assertBody(t, w, `{"data":{"id":1}}`)
+}
+
+// TestResponseInfoFromContext verifies that handlers can read the response
+// state captured by the shared wrapper.
+func TestResponseInfoFromContext(t *testing.T) {
+	var before, after ResponseInfo
+	var ok bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		before, ok = ResponseInfoFromContext(r.Context())
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("abc"))
+		after, _ = ResponseInfoFromContext(r.Context())
+	})
+
+	NewHooks().Apply(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if !ok {
+		t.Fatal("expected response info in context")
+	}
+	if before.Bytes != 0 {
+		t.Errorf("before write: got %d bytes, want 0", before.Bytes)
+	}
+	if after.Status != http.StatusAccepted || after.Bytes != 3 {
+		t.Errorf("after write: got %+v, want status 202 and 3 bytes", after)
+	}
+
+	if _, ok := ResponseInfoFromContext(context.Background()); ok {
+		t.Error("expected no response info without middleware")
+	}
+}
+
+// TestSharedResponseWriter_Hijack verifies that hijacking through the shared
+// wrapper reaches the underlying connection and is recorded.
+func TestSharedResponseWriter_Hijack(t *testing.T) {
+	infoCh := make(chan ResponseInfo, 1)
+	hooks := NewHooks()
+	hooks.OnResponseWritten(func(r *http.Request, i ResponseInfo) { infoCh <- i })
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Hijack() error = %v", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+		rw.Flush()
+	})
+
+	server := httptest.NewServer(hooks.Apply(handler))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "ok" {
+		t.Errorf("body: got %q, want ok", body)
+	}
+	if info := <-infoCh; !info.Hijacked {
+		t.Error("expected response to be recorded as hijacked")
+	}
+}
+
+// TestRecovery_Abort verifies that httpabort panics are converted into the
+// requested response.
+func TestRecovery_Abort(t *testing.T) {
+	tests := []struct {
+		name       string
+		panicWith  func()
+		wantStatus int
+		wantBody   string
+	}{
+		{"not_found", httpabort.NotFound, http.StatusNotFound, "Not Found\n"},
+		{"bad_request", func() { httpabort.BadRequest("invalid id") }, http.StatusBadRequest, "invalid id\n"},
+		{"pointer", func() { panic(&httpabort.Abort{Status: http.StatusConflict}) }, http.StatusConflict, "Conflict\n"},
+		{"wrapped_error", func() {
+			panic(fmt.Errorf("loading: %w", httpabort.Abort{Status: http.StatusForbidden}))
+		}, http.StatusForbidden, "Forbidden\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.panicWith()
+			})
+
+			logger, buf := newTestLogger()
+			w := httptest.NewRecorder()
+			NewRecovery(logger)(handler).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+			assertStatus(t, w, tt.wantStatus)
+			assertBody(t, w, tt.wantBody)
+			if strings.Contains(buf.String(), "level=ERROR") {
+				t.Errorf("abort should not be logged as an error, got: %s", buf.String())
+			}
+		})
+	}
+}
+
+// TestRecovery_Panic verifies that other panics are logged with a stack trace
+// and answered with 500.
+func TestRecovery_Panic(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("something broke")
+	})
+
+	logger, buf := newTestLogger()
+	w := httptest.NewRecorder()
+	NewRecovery(logger)(handler).ServeHTTP(w, httptest.NewRequest("GET", "/boom", nil))
+
+	assertStatus(t, w, http.StatusInternalServerError)
+	logOutput := buf.String()
+	for _, want := range []string{"level=ERROR", "panic recovered", "something broke", "path=/boom", "stack="} {
+		if !strings.Contains(logOutput, want) {
+			t.Errorf("log should contain %q, got: %s", want, logOutput)
+		}
+	}
+}
+
+// TestRecovery_AlreadyWritten verifies that a panic after the response has
+// started leaves the written status untouched.
+func TestRecovery_AlreadyWritten(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		httpabort.NotFound()
+	})
+
+	logger, _ := newTestLogger()
+	w := httptest.NewRecorder()
+	NewRecovery(logger)(handler).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	assertStatus(t, w, http.StatusAccepted)
+	assertBody(t, w, "partial")
+}
+
+// TestRecovery_ErrAbortHandler verifies that http.ErrAbortHandler is re-raised.
+func TestRecovery_ErrAbortHandler(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	logger, _ := newTestLogger()
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("expected http.ErrAbortHandler to be re-raised, got %v", v)
+		}
+	}()
+	NewRecovery(logger)(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+// TestRecovery_LoggedStatus verifies that the logging middleware records the
+// status written by the recovery middleware.
+func TestRecovery_LoggedStatus(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpabort.NotFound()
+	})
+
+	logger, buf := newTestLogger()
+	stack := CreateStack(NewLoggingMiddleware(logger), NewRecovery(logger))
+	stack(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if !strings.Contains(buf.String(), "status=404") {
+		t.Errorf("log should contain status=404, got: %s", buf.String())
+	}
+}
+
+// TestRequestStore_TypedValues verifies that values set by one middleware are
+// visible to handlers further in, keyed by identity.
+func TestRequestStore_TypedValues(t *testing.T) {
+	userKey := NewStoreKey[string]("user")
+	countKey := NewStoreKey[int]("count")
+	otherUserKey := NewStoreKey[string]("user")
+
+	setUser := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !userKey.Set(r.Context(), "alice") {
+				t.Error("Set() should succeed with a store present")
+			}
+			countKey.Set(r.Context(), 42)
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, ok := userKey.Get(r.Context()); !ok || got != "alice" {
+			t.Errorf("user: got %q, %v", got, ok)
+		}
+		if got, ok := countKey.Get(r.Context()); !ok || got != 42 {
+			t.Errorf("count: got %d, %v", got, ok)
+		}
+		if _, ok := otherUserKey.Get(r.Context()); ok {
+			t.Error("distinct keys with the same name should not collide")
+		}
+		countKey.Delete(r.Context())
+		if _, ok := countKey.Get(r.Context()); ok {
+			t.Error("deleted value should be absent")
+		}
+	})
+
+	stack := CreateStack(NewRequestStore(), setUser, NewRequestStore())
+	stack(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+// TestRequestStore_Missing verifies that accessors degrade gracefully without
+// the store middleware.
+func TestRequestStore_Missing(t *testing.T) {
+	key := NewStoreKey[string]("k")
+	ctx := context.Background()
+
+	if key.Set(ctx, "v") {
+		t.Error("Set() should report false without a store")
+	}
+	if _, ok := key.Get(ctx); ok {
+		t.Error("Get() should report false without a store")
+	}
+	key.Delete(ctx)
+	if RequestStoreFromContext(ctx) != nil {
+		t.Error("expected nil store")
+	}
+}
+
+// TestRequestStore_Isolation verifies that each request gets its own store.
+func TestRequestStore_Isolation(t *testing.T) {
+	key := NewStoreKey[string]("path")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := key.Get(r.Context()); ok {
+			t.Error("store should start empty for each request")
+		}
+		key.Set(r.Context(), r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	runConcurrent(t, NewRequestStore()(handler), 50)
+}
+
+// storeBenchmarkDepth is the number of middleware each storing one value in
+// the request-scoped storage benchmarks.
+const storeBenchmarkDepth = 10
+
+// BenchmarkRequestStore measures a stack of middleware that each store a
+// value in the RequestStore, with the handler reading all of them.
+func BenchmarkRequestStore(b *testing.B) {
+	keys := make([]*StoreKey[int], storeBenchmarkDepth)
+	mws := []Middleware{NewRequestStore()}
+	for i := range keys {
+		keys[i] = NewStoreKey[int](fmt.Sprint(i))
+		key := keys[i]
+		mws = append(mws, func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				key.Set(r.Context(), 1)
+				next.ServeHTTP(w, r)
+			})
+		})
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, key := range keys {
+			key.Get(r.Context())
+		}
+	})
+	wrapped := CreateStack(mws...)(handler)
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	for b.Loop() {
+		wrapped.ServeHTTP(w, req)
+	}
+}
+
+// benchmarkContextKey is a context key used by BenchmarkContextValue.
+type benchmarkContextKey int
+
+// BenchmarkContextValue measures the equivalent of BenchmarkRequestStore
+// using a context.WithValue chain, for comparison.
+func BenchmarkContextValue(b *testing.B) {
+	var mws []Middleware
+	for i := range storeBenchmarkDepth {
+		key := benchmarkContextKey(i)
+		mws = append(mws, func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), key, 1)))
+			})
+		})
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := range storeBenchmarkDepth {
+			r.Context().Value(benchmarkContextKey(i))
+		}
+	})
+	wrapped := CreateStack(mws...)(handler)
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	for b.Loop() {
+		wrapped.ServeHTTP(w, req)
+	}
+}
+
+// TestMemoryGuard_Shedding verifies that low-priority requests are rejected
+// while memory is above the threshold and accepted again once it falls.
+func TestMemoryGuard_Shedding(t *testing.T) {
+	var used atomic.Uint64
+	logger, buf := newTestLogger()
+	mw := newMemoryGuard(MemoryGuardOptions{
+		Threshold: 100,
+		Interval:  time.Nanosecond,
+		LowPriority: func(r *http.Request) bool {
+			return r.URL.Path != "/healthz"
+		},
+		Logger: logger,
+	}, used.Load)
+
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(path string) *httptest.ResponseRecorder {
+		time.Sleep(time.Millisecond)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	used.Store(50)
+	assertStatus(t, serve("/api"), http.StatusOK)
+
+	used.Store(150)
+	w := serve("/api")
+	assertStatus(t, w, http.StatusServiceUnavailable)
+	assertHeader(t, w, "Retry-After", "1")
+	assertStatus(t, serve("/healthz"), http.StatusOK)
+	if !strings.Contains(buf.String(), "memory above threshold") {
+		t.Errorf("expected threshold warning, got: %s", buf.String())
+	}
+
+	used.Store(80)
+	assertStatus(t, serve("/api"), http.StatusOK)
+}
+
+// TestMemoryGuard_SampleInterval verifies that memory is not re-read until
+// the interval has elapsed.
+func TestMemoryGuard_SampleInterval(t *testing.T) {
+	var reads atomic.Int32
+	mw := newMemoryGuard(MemoryGuardOptions{Threshold: 100, Interval: time.Hour}, func() uint64 {
+		reads.Add(1)
+		return 0
+	})
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for range 10 {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+
+	if got := reads.Load(); got != 1 {
+		t.Errorf("memory reads: got %d, want 1", got)
+	}
+}
+
+// TestMemoryGuard_HeapProfile verifies that a heap profile is written to the
+// configured directory when the threshold is crossed.
+func TestMemoryGuard_HeapProfile(t *testing.T) {
+	dir := t.TempDir()
+	logger, _ := newTestLogger()
+	mw := newMemoryGuard(MemoryGuardOptions{
+		Threshold:  1,
+		ProfileDir: dir,
+		Logger:     logger,
+	}, func() uint64 { return 2 })
+
+	mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		matches, _ := filepath.Glob(filepath.Join(dir, "heap-*.pprof"))
+		if len(matches) == 1 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected one heap profile in %s, found %v", dir, matches)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestReadProcessMemory verifies that the runtime metrics used by the memory
+// guard report a plausible value.
+func TestReadProcessMemory(t *testing.T) {
+	if got := readProcessMemory(); got == 0 {
+		t.Error("expected non-zero process memory")
+	}
+}
+
+// TestAccessLog_Formats verifies the Common and Combined Log Format lines.
+func TestAccessLog_Formats(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})
+
+	tests := []struct {
+		name   string
+		format config.AccessLogFormat
+		suffix string
+	}{
+		{"common", config.CommonLogFormat, `"POST /items?x=1 HTTP/1.1" 201 5` + "\n"},
+		{"combined", config.CombinedLogFormat, `"POST /items?x=1 HTTP/1.1" 201 5 "http://example.com/" "test-agent"` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			req := httptest.NewRequest("POST", "/items?x=1", nil)
+			req.RemoteAddr = "203.0.113.7:51234"
+			req.SetBasicAuth("alice", "secret")
+			req.Header.Set("Referer", "http://example.com/")
+			req.Header.Set("User-Agent", "test-agent")
+
+			NewAccessLog(&buf, tt.format)(handler).ServeHTTP(httptest.NewRecorder(), req)
+
+			line := buf.String()
+			if !strings.HasPrefix(line, "203.0.113.7 - alice [") {
+				t.Errorf("unexpected prefix: %q", line)
+			}
+			if !strings.HasSuffix(line, tt.suffix) {
+				t.Errorf("line %q does not end with %q", line, tt.suffix)
+			}
+			ts := line[strings.Index(line, "[")+1 : strings.Index(line, "]")]
+			if _, err := time.Parse(clfTimeFormat, ts); err != nil {
+				t.Errorf("invalid timestamp %q: %v", ts, err)
+			}
+		})
+	}
+}
+
+// TestAccessLog_EmptyFields verifies that missing values are logged as "-"
+// and that quoted fields are escaped.
+func TestAccessLog_EmptyFields(t *testing.T) {
+	var buf bytes.Buffer
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("User-Agent", `evil" agent`)
+
+	NewAccessLog(&buf, config.CombinedLogFormat)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	line := buf.String()
+	if !strings.HasPrefix(line, "192.0.2.1 - - [") {
+		t.Errorf("unexpected prefix: %q", line)
+	}
+	if want := `"GET / HTTP/1.1" 204 - "-" "evil\" agent"` + "\n"; !strings.HasSuffix(line, want) {
+		t.Errorf("line %q does not end with %q", line, want)
+	}
+}
+
+// TestOpenAccessLog verifies that the access log is written to the
+// configured file, and disabled when no file is configured.
+func TestOpenAccessLog(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "access.log")
+		mw, closer, err := OpenAccessLog(config.ServerConfig{AccessLogFile: path, AccessLogFormat: config.CommonLogFormat})
+		if err != nil {
+			t.Fatalf("OpenAccessLog: %v", err)
+		}
+		for range 2 {
+			mw(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}
+		if err := closer.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(string(data), "\n"); got != 2 {
+			t.Errorf("expected 2 lines, got %d: %q", got, data)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		mw, closer, err := OpenAccessLog(config.ServerConfig{})
+		if err != nil {
+			t.Fatalf("OpenAccessLog: %v", err)
+		}
+		w := httptest.NewRecorder()
+		mw(handler).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		assertStatus(t, w, http.StatusOK)
+		if err := closer.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	})
+
+	t.Run("unwritable", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing", "access.log")
+		if _, _, err := OpenAccessLog(config.ServerConfig{AccessLogFile: path}); err == nil {
+			t.Error("expected error for unwritable path")
+		}
+	})
+}
+
+// TestRouteLogLevels_Level verifies exact and subtree pattern matching, with
+// the longest pattern taking precedence.
+func TestRouteLogLevels_Level(t *testing.T) {
+	levels := NewRouteLogLevels(map[string]slog.Level{
+		"/healthz":     slog.LevelDebug,
+		"/admin/":      slog.LevelWarn,
+		"/admin/debug": slog.LevelDebug,
+	})
+
+	tests := []struct {
+		path string
+		want slog.Level
+	}{
+		{"/healthz", slog.LevelDebug},
+		{"/healthz/deep", slog.LevelInfo},
+		{"/admin/", slog.LevelWarn},
+		{"/admin/users", slog.LevelWarn},
+		{"/admin/debug", slog.LevelDebug},
+		{"/api/users", slog.LevelInfo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := levels.Level(tt.path); got != tt.want {
+				t.Errorf("Level(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	var nilLevels *RouteLogLevels
+	if got := nilLevels.Level("/healthz"); got != slog.LevelInfo {
+		t.Errorf("nil RouteLogLevels: Level = %v, want INFO", got)
+	}
+}
+
+// TestLoggingMiddlewareWithLevels verifies that the completion record is
+// logged at the route's level, and that Set takes effect immediately.
+func TestLoggingMiddlewareWithLevels(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	levels := NewRouteLogLevels(map[string]slog.Level{"/healthz": slog.LevelDebug})
+	handler := NewLoggingMiddlewareWithLevels(logger, levels)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(path string) string {
+		buf.Reset()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		return buf.String()
+	}
+
+	if out := serve("/healthz"); out != "" {
+		t.Errorf("expected /healthz to be logged below INFO, got: %s", out)
+	}
+	if out := serve("/api"); !strings.Contains(out, "level=INFO") {
+		t.Errorf("expected /api to be logged at INFO, got: %s", out)
+	}
+
+	levels.Set(map[string]slog.Level{"/api": slog.LevelWarn})
+	if out := serve("/healthz"); !strings.Contains(out, "level=INFO") {
+		t.Errorf("expected /healthz at INFO after Set, got: %s", out)
+	}
+	if out := serve("/api"); !strings.Contains(out, "level=WARN") {
+		t.Errorf("expected /api at WARN after Set, got: %s", out)
+	}
+}
+
+// TestLogSampler_Sample verifies rate, per-route and trigger header sampling.
+func TestLogSampler_Sample(t *testing.T) {
+	sampler := NewLogSampler(LogSamplingConfig{
+		Every:         1,
+		Routes:        map[string]int{"/healthz": 0},
+		TriggerHeader: "X-Debug-Log",
+	})
+
+	req := func(path string, trigger bool) *http.Request {
+		r := httptest.NewRequest("GET", path, nil)
+		if trigger {
+			r.Header.Set("X-Debug-Log", "1")
+		}
+		return r
+	}
+
+	if !sampler.Sample(req("/api", false)) {
+		t.Error("expected every request to be sampled with Every=1")
+	}
+	if sampler.Sample(req("/healthz", false)) {
+		t.Error("expected /healthz sampling to be disabled by route override")
+	}
+	if !sampler.Sample(req("/healthz", true)) {
+		t.Error("expected trigger header to force sampling")
+	}
+
+	sampler.Set(LogSamplingConfig{})
+	if sampler.Sample(req("/api", false)) {
+		t.Error("expected sampling to be disabled after Set")
+	}
+}
+
+// TestDetailedLogging verifies the contents of the detailed record and that
+// bodies reach the handler and client unchanged.
+func TestDetailedLogging(t *testing.T) {
+	logger, buf := newTestLogger()
+	sampler := NewLogSampler(LogSamplingConfig{TriggerHeader: "X-Debug-Log", MaxBodyBytes: 8})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("echo:" + string(body)))
+	})
+	stack := CreateStack(NewLoggingMiddleware(logger), NewDetailedLogging(logger, sampler))
+
+	t.Run("sampled", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest("POST", "/items?x=1", strings.NewReader("payload"))
+		req.Header.Set("X-Debug-Log", "1")
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("X-Api-Key", "k-secret")
+		w := httptest.NewRecorder()
+
+		stack(handler).ServeHTTP(w, req)
+
+		assertStatus(t, w, http.StatusAccepted)
+		assertBody(t, w, "echo:payload")
+		out := buf.String()
+		for _, want := range []string{
+			"request detail",
+			`query="x=1"`,
+			"request.body=payload",
+			"request.body_truncated=false",
+			"response.body=echo:pay",
+			"response.body_truncated=true",
+			"response.bytes=12",
+			"time_to_headers=",
+			"[REDACTED]",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("log should contain %q, got: %s", want, out)
+			}
+		}
+		if strings.Contains(out, "secret") || strings.Contains(out, "Bearer token") {
+			t.Errorf("log should not contain sensitive header values, got: %s", out)
+		}
+		if !strings.Contains(out, "request complete") {
+			t.Errorf("compact line should still be logged, got: %s", out)
+		}
+	})
+
+	t.Run("not_sampled", func(t *testing.T) {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		stack(handler).ServeHTTP(w, httptest.NewRequest("POST", "/items", strings.NewReader("payload")))
+
+		assertBody(t, w, "echo:payload")
+		if strings.Contains(buf.String(), "request detail") {
+			t.Errorf("unsampled request should not be logged in detail, got: %s", buf.String())
+		}
+	})
+}
+
+// TestBreadcrumbs_ErrorLog verifies that the breadcrumb trail is attached to
+// ERROR records logged with the request context, and only to those.
+func TestBreadcrumbs_ErrorLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(NewBreadcrumbLogHandler(slog.NewTextHandler(buf, nil)))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddBreadcrumb(r.Context(), "loaded user", slog.Int("user_id", 42))
+		AddBreadcrumb(r.Context(), "charging card")
+		logger.InfoContext(r.Context(), "progress")
+		panic("card declined")
+	})
+	stack := CreateStack(NewBreadcrumbs(0), NewRecovery(logger))
+
+	w := httptest.NewRecorder()
+	stack(handler).ServeHTTP(w, httptest.NewRequest("POST", "/pay", nil))
+	assertStatus(t, w, http.StatusInternalServerError)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %d: %s", len(lines), buf.String())
+	}
+	if strings.Contains(lines[0], "breadcrumbs") {
+		t.Errorf("INFO record should not include breadcrumbs: %s", lines[0])
+	}
+	for _, want := range []string{
+		"breadcrumbs.1.msg=\"loaded user\"",
+		"breadcrumbs.1.user_id=42",
+		"breadcrumbs.2.msg=\"charging card\"",
+		"breadcrumbs.2.at=",
+	} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("ERROR record should contain %q, got: %s", want, lines[1])
+		}
+	}
+}
+
+// TestBreadcrumbs_Limit verifies that only the most recent events are kept.
+func TestBreadcrumbs_Limit(t *testing.T) {
+	var got []Breadcrumb
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := range 5 {
+			AddBreadcrumb(r.Context(), fmt.Sprint(i))
+		}
+		got = Breadcrumbs(r.Context())
+	})
+
+	NewBreadcrumbs(3)(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	var msgs []string
+	for _, b := range got {
+		msgs = append(msgs, b.Message)
+	}
+	if want := []string{"2", "3", "4"}; !slices.Equal(msgs, want) {
+		t.Errorf("breadcrumbs = %v, want %v", msgs, want)
+	}
+}
+
+// TestBreadcrumbs_WithoutMiddleware verifies that recording breadcrumbs
+// without NewBreadcrumbs in the stack is a no-op.
+func TestBreadcrumbs_WithoutMiddleware(t *testing.T) {
+	ctx := context.Background()
+	AddBreadcrumb(ctx, "ignored")
+	if got := Breadcrumbs(ctx); got != nil {
+		t.Errorf("expected no breadcrumbs, got %v", got)
+	}
+}
+
+// TestRecovery_CrashReport verifies that a crash report is written when the
+// request's config sets CrashDir, and that its path is logged.
+func TestRecovery_CrashReport(t *testing.T) {
+	crashDir := t.TempDir()
+	logger, buf := newTestLogger()
+	stack := CreateStack(
+		NewConfigContext(config.ServerConfig{Environment: config.Production, CrashDir: crashDir}),
+		NewRecovery(logger),
+	)
+
+	w := httptest.NewRecorder()
+	stack(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})).ServeHTTP(w, httptest.NewRequest("GET", "/explode", nil))
+
+	assertStatus(t, w, http.StatusInternalServerError)
+	matches, _ := filepath.Glob(filepath.Join(crashDir, "crash-*.txt"))
+	if len(matches) != 1 {
+		t.Fatalf("expected one crash report, found %v", matches)
+	}
+	data, err := os.ReadFile(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"reason: panic: boom", "GET /explode HTTP/1.1", "Environment: production", "== stack =="} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("crash report should contain %q, got:\n%s", want, data)
+		}
+	}
+	if !strings.Contains(buf.String(), "crash_report="+matches[0]) {
+		t.Errorf("log should reference crash report, got: %s", buf.String())
+	}
+}
+
+// TestRecovery_NoCrashReportForAbort verifies that httpabort panics, which are
+// not crashes, do not produce crash reports.
+func TestRecovery_NoCrashReportForAbort(t *testing.T) {
+	crashDir := t.TempDir()
+	logger, _ := newTestLogger()
+	stack := CreateStack(NewConfigContext(config.ServerConfig{CrashDir: crashDir}), NewRecovery(logger))
+
+	stack(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpabort.NotFound()
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if entries, _ := os.ReadDir(crashDir); len(entries) != 0 {
+		t.Errorf("expected no crash reports, found %d", len(entries))
+	}
+}
+
+// TestParseBudget verifies both budget header formats.
+func TestParseBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"request_timeout_ms", RequestTimeoutHeader, "1500", 1500 * time.Millisecond, true},
+		{"request_timeout_zero", RequestTimeoutHeader, "0", 0, true},
+		{"request_timeout_invalid", RequestTimeoutHeader, "1.5s", 0, false},
+		{"request_timeout_negative", RequestTimeoutHeader, "-1", 0, false},
+		{"grpc_seconds", GRPCTimeoutHeader, "3S", 3 * time.Second, true},
+		{"grpc_millis", GRPCTimeoutHeader, "250m", 250 * time.Millisecond, true},
+		{"grpc_hours_overflow", GRPCTimeoutHeader, "99999999H", time.Duration(1<<63 - 1), true},
+		{"grpc_bad_unit", GRPCTimeoutHeader, "10x", 0, false},
+		{"grpc_too_long", GRPCTimeoutHeader, "123456789S", 0, false},
+		{"grpc_no_digits", GRPCTimeoutHeader, "S", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			h.Set(tt.header, tt.value)
+			got, ok := parseBudget(h)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseBudget(%s: %s) = (%v, %v), want (%v, %v)", tt.header, tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// TestDeadline verifies that the budget becomes the request deadline, is
+// capped by max, and that exhausted budgets are rejected.
+func TestDeadline(t *testing.T) {
+	var remaining time.Duration
+	var hasDeadline bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var deadline time.Time
+		deadline, hasDeadline = r.Context().Deadline()
+		remaining = time.Until(deadline)
+	})
+	mw := NewDeadline(2 * time.Second)
+
+	serve := func(header, value string) *httptest.ResponseRecorder {
+		hasDeadline = false
+		req := httptest.NewRequest("GET", "/", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		mw(handler).ServeHTTP(w, req)
+		return w
+	}
+
+	serve(RequestTimeoutHeader, "500")
+	if !hasDeadline || remaining > 500*time.Millisecond || remaining < 400*time.Millisecond {
+		t.Errorf("expected ~500ms deadline, got %v (deadline set: %v)", remaining, hasDeadline)
+	}
+
+	serve(GRPCTimeoutHeader, "1M")
+	if !hasDeadline || remaining > 2*time.Second {
+		t.Errorf("expected budget capped to 2s, got %v", remaining)
+	}
+
+	serve("", "")
+	if hasDeadline {
+		t.Error("expected no deadline without a budget header")
+	}
+
+	w := serve(RequestTimeoutHeader, "0")
+	assertStatus(t, w, http.StatusGatewayTimeout)
+	if hasDeadline {
+		t.Error("handler should not run with an exhausted budget")
+	}
+}
+
+// TestSetTimeoutHeader verifies that the remaining budget is forwarded.
+func TestSetTimeoutHeader(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	req := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+
+	SetTimeoutHeader(req)
+
+	ms, err := strconv.Atoi(req.Header.Get(RequestTimeoutHeader))
+	if err != nil || ms > 3000 || ms < 2500 {
+		t.Errorf("X-Request-Timeout = %q, want about 3000", req.Header.Get(RequestTimeoutHeader))
+	}
+
+	plain := httptest.NewRequest("GET", "/", nil)
+	SetTimeoutHeader(plain)
+	if got := plain.Header.Get(RequestTimeoutHeader); got != "" {
+		t.Errorf("expected no header without a deadline, got %q", got)
+	}
+}
+
+// TestRespondOverloaded verifies the default problem+json response and
+// Retry-After rounding.
+func TestRespondOverloaded(t *testing.T) {
+	w := httptest.NewRecorder()
+	RespondOverloaded(w, httptest.NewRequest("GET", "/", nil), Overload{
+		Status:     http.StatusTooManyRequests,
+		Reason:     "rate_limited",
+		Detail:     "slow down",
+		RetryAfter: 1500 * time.Millisecond,
+	})
+
+	assertStatus(t, w, http.StatusTooManyRequests)
+	assertHeader(t, w, "Retry-After", "2")
+	assertHeader(t, w, "Content-Type", "application/problem+json")
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON body: %v", err)
+	}
+	want := map[string]any{
+		"type":        "about:blank",
+		"title":       "Too Many Requests",
+		"status":      float64(429),
+		"detail":      "slow down",
+		"reason":      "rate_limited",
+		"retry_after": float64(2),
+	}
+	for k, v := range want {
+		if body[k] != v {
+			t.Errorf("body[%q] = %v, want %v", k, body[k], v)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	RespondOverloaded(w, httptest.NewRequest("GET", "/", nil), Overload{Status: http.StatusServiceUnavailable})
+	if got := w.Header().Get("Retry-After"); got != "" {
+		t.Errorf("expected no Retry-After when unknown, got %q", got)
+	}
+}
+
+// TestMemoryGuard_CustomResponder verifies that the overload responder is pluggable.
+func TestMemoryGuard_CustomResponder(t *testing.T) {
+	var got Overload
+	mw := newMemoryGuard(MemoryGuardOptions{
+		Threshold: 1,
+		Logger:    slog.New(slog.DiscardHandler),
+		Respond: func(w http.ResponseWriter, r *http.Request, o Overload) {
+			got = o
+			w.WriteHeader(o.Status)
+		},
+	}, func() uint64 { return 2 })
+
+	w := httptest.NewRecorder()
+	mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	assertStatus(t, w, http.StatusServiceUnavailable)
+	if got.Reason != "memory_pressure" || got.RetryAfter != time.Second {
+		t.Errorf("unexpected overload: %+v", got)
+	}
+}
+
+// TestCacheKey verifies that equivalent requests share a key and that the
+// selected headers, tenant and negotiated type distinguish requests.
+func TestCacheKey(t *testing.T) {
+	key := NewCacheKey(CacheKeyOptions{
+		Headers:     []string{"accept-language"},
+		IgnoreQuery: []string{"utm_source"},
+		Tenant:      func(r *http.Request) string { return r.Header.Get("X-Tenant") },
+		Offers:      []string{"application/json", "text/html"},
+	})
+	newReq := func(target string, headers ...string) *http.Request {
+		r := httptest.NewRequest("GET", target, nil)
+		for i := 0; i < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		return r
+	}
+
+	base := key(newReq("http://Example.com/items?b=2&a=1", "Accept-Language", "en", "X-Tenant", "acme"))
+	want := "GET example.com/items?a=1&b=2\naccept-language=en\ntenant=acme\ntype=application/json"
+	if base != want {
+		t.Errorf("key = %q, want %q", base, want)
+	}
+
+	same := []*http.Request{
+		newReq("http://example.com/items?a=1&b=2&utm_source=x", "Accept-Language", "en", "X-Tenant", "acme"),
+		newReq("http://example.com/items?a=1&b=2", "Accept-Language", "en", "X-Tenant", "acme", "Accept", "application/json, text/html;q=0.5"),
+		newReq("http://example.com/items?a=1&b=2", "Accept-Language", "en", "X-Tenant", "acme", "Accept", "*/*"),
+	}
+	for i, r := range same {
+		if got := key(r); got != base {
+			t.Errorf("request %d: key = %q, want %q", i, got, base)
+		}
+	}
+
+	different := []*http.Request{
+		newReq("http://example.com/items?a=1&b=3", "Accept-Language", "en", "X-Tenant", "acme"),
+		newReq("http://example.com/items?a=1&b=2", "Accept-Language", "fr", "X-Tenant", "acme"),
+		newReq("http://example.com/items?a=1&b=2", "Accept-Language", "en", "X-Tenant", "other"),
+		newReq("http://example.com/items?a=1&b=2", "Accept-Language", "en", "X-Tenant", "acme", "Accept", "text/html"),
+	}
+	for i, r := range different {
+		if got := key(r); got == base {
+			t.Errorf("request %d: expected a different key, got %q", i, got)
+		}
+	}
+}
+
+// TestNegotiateContentType verifies Accept header matching.
+func TestNegotiateContentType(t *testing.T) {
+	offers := []string{"application/json", "text/html"}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/json"},
+		{"text/html", "text/html"},
+		{"text/*", "text/html"},
+		{"*/*", "application/json"},
+		{"application/json;q=0.5, text/html", "text/html"},
+		{"text/html;q=0, */*", "application/json"},
+		{"image/png", ""},
+		{"garbage", ""},
+	}
+	for _, tt := range tests {
+		if got := NegotiateContentType(tt.accept, offers); got != tt.want {
+			t.Errorf("NegotiateContentType(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// TestConditionalGet verifies 304 generation from handler-declared validators.
+func TestConditionalGet(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	rendered := 0
+	handler := NewConditionalGet()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if SetValidators(r.Context(), Validators{ETag: "v42", LastModified: modified}) {
+			return
+		}
+		rendered++
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("body"))
+	}))
+
+	tests := []struct {
+		name    string
+		method  string
+		header  string
+		value   string
+		want    int
+		renders bool
+	}{
+		{"unconditional", "GET", "", "", http.StatusOK, true},
+		{"etag match", "GET", "If-None-Match", `"v1", W/"v42"`, http.StatusNotModified, false},
+		{"etag wildcard", "GET", "If-None-Match", "*", http.StatusNotModified, false},
+		{"etag mismatch", "GET", "If-None-Match", `"v41"`, http.StatusOK, true},
+		{"not modified since", "GET", "If-Modified-Since", modified.Format(http.TimeFormat), http.StatusNotModified, false},
+		{"modified since", "GET", "If-Modified-Since", modified.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK, true},
+		{"post ignored", "POST", "If-None-Match", `"v42"`, http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered = 0
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assertStatus(t, w, tt.want)
+			assertHeader(t, w, "ETag", `"v42"`)
+			assertHeader(t, w, "Last-Modified", "Wed, 01 May 2024 12:00:00 GMT")
+			if (rendered == 1) != tt.renders {
+				t.Errorf("rendered = %d, want renders %v", rendered, tt.renders)
+			}
+			if tt.want == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("expected empty body, got %q", w.Body.String())
+			}
+		})
+	}
+}
+
+// TestConditionalGet_BodyDiscarded verifies that a handler ignoring the
+// result of SetValidators still produces a bodiless 304.
+func TestConditionalGet_BodyDiscarded(t *testing.T) {
+	handler := NewConditionalGet()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetValidators(r.Context(), Validators{ETag: `W/"1"`})
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("body"))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", `"1"`)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assertStatus(t, w, http.StatusNotModified)
+	assertHeader(t, w, "ETag", `W/"1"`)
+	if w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+		t.Errorf("expected no body or Content-Type, got %q %q", w.Body.String(), w.Header().Get("Content-Type"))
+	}
+}
+
+// TestConditionalGet_WeakETag verifies that an unquoted weak ETag is quoted
+// and stays weak.
+func TestConditionalGet_WeakETag(t *testing.T) {
+	handler := NewConditionalGet()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetValidators(r.Context(), Validators{ETag: "W/v7"})
+		w.Write([]byte("body"))
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	assertHeader(t, w, "ETag", `W/"v7"`)
+}
+
+// TestConditionalGet_Flush verifies that the wrapped writer's optional
+// interfaces are passed through, and that flushing sends the validators.
+func TestConditionalGet_Flush(t *testing.T) {
+	handler := NewConditionalGet()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetValidators(r.Context(), Validators{ETag: "v1"})
+		if _, ok := w.(http.Hijacker); ok {
+			t.Error("writer implements http.Hijacker, but the wrapped writer does not")
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("writer does not implement http.Flusher")
+		}
+		flusher.Flush()
+		w.Write([]byte("event"))
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if !w.Flushed {
+		t.Error("response not flushed")
+	}
+	assertStatus(t, w, http.StatusOK)
+	assertHeader(t, w, "ETag", `"v1"`)
+	if w.Body.String() != "event" {
+		t.Errorf("body = %q, want event", w.Body.String())
+	}
+}
+
+// TestRequestAttrs verifies that extracted attributes reach the logging and
+// recovery middleware and handlers.
+func TestRequestAttrs(t *testing.T) {
+	logger, buf := newTestLogger()
+	tenant := func(r *http.Request) []slog.Attr {
+		return []slog.Attr{slog.String("tenant", r.Header.Get("X-Tenant"))}
+	}
+	version := func(r *http.Request) []slog.Attr {
+		return []slog.Attr{slog.String("api_version", "v2")}
+	}
+	stack := CreateStack(
+		NewRequestAttrs(tenant),
+		NewRequestAttrs(version),
+		NewLoggingMiddleware(logger),
+		NewRecovery(logger),
+	)
+
+	var got []slog.Attr
+	req := httptest.NewRequest("GET", "/boom", nil)
+	req.Header.Set("X-Tenant", "acme")
+	stack(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = RequestAttrs(r.Context())
+		panic("boom")
+	})).ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(got) != 2 || got[0].Key != "tenant" || got[1].Key != "api_version" {
+		t.Errorf("RequestAttrs = %v, want tenant then api_version", got)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if strings.Contains(line, "panic recovered") || strings.Contains(line, "request complete") {
+			if !strings.Contains(line, "tenant=acme") || !strings.Contains(line, "api_version=v2") {
+				t.Errorf("log line missing request attributes: %s", line)
+			}
+		}
+	}
+
+	if attrs := RequestAttrs(context.Background()); attrs != nil {
+		t.Errorf("expected no attributes without middleware, got %v", attrs)
+	}
+}
+
+// TestCSPNonce verifies that each request gets a fresh nonce in the header,
+// context and template attribute.
+func TestCSPNonce(t *testing.T) {
+	tmpl := template.Must(template.New("page").Parse(`<script {{.}}>run()</script>`))
+	handler := NewCSPNonce("")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tmpl.Execute(w, CSPNonceAttr(r.Context()))
+	}))
+
+	var nonces []string
+	for range 2 {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		csp := w.Header().Get("Content-Security-Policy")
+		_, rest, ok := strings.Cut(csp, "'nonce-")
+		if !ok {
+			t.Fatalf("policy has no nonce: %q", csp)
+		}
+		nonce, _, _ := strings.Cut(rest, "'")
+		if strings.Contains(csp, "{nonce}") || !strings.Contains(csp, "style-src 'self' 'nonce-"+nonce+"'") {
+			t.Errorf("nonce not substituted everywhere: %q", csp)
+		}
+		if want := `<script nonce="` + nonce + `">run()</script>`; w.Body.String() != want {
+			t.Errorf("body = %q, want %q", w.Body.String(), want)
+		}
+		nonces = append(nonces, nonce)
+	}
+	if nonces[0] == nonces[1] {
+		t.Errorf("expected a fresh nonce per request, got %q twice", nonces[0])
+	}
+
+	if got := CSPNonceAttr(context.Background()); got != "" {
+		t.Errorf("expected empty attribute without middleware, got %q", got)
+	}
+}
+
+// TestRequestID verifies generation, propagation and logging of request IDs.
+func TestRequestID(t *testing.T) {
+	logger, buf := newTestLogger()
+	var seen string
+	handler := CreateStack(NewRequestID(), NewLoggingMiddleware(logger))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen, _ = RequestIDFromContext(r.Context())
+		}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "upstream-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if seen != "upstream-123" {
+		t.Errorf("propagated ID = %q, want upstream-123", seen)
+	}
+	assertHeader(t, w, "X-Request-ID", "upstream-123")
+	if !strings.Contains(buf.String(), "request_id=upstream-123") {
+		t.Errorf("log should include request_id, got: %s", buf.String())
+	}
+
+	for _, incoming := range []string{"", "bad id\x00", strings.Repeat("a", 129)} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Request-ID", incoming)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if len(seen) != 32 || seen == incoming {
+			t.Errorf("incoming %q: expected a generated ID, got %q", incoming, seen)
+		}
+		assertHeader(t, w, "X-Request-ID", seen)
+	}
+
+	if _, ok := RequestIDFromContext(context.Background()); ok {
+		t.Error("expected no request ID without middleware")
+	}
+}
+
+// TestMemoryRateLimitStore verifies token bucket refill, burst and eviction.
+func TestMemoryRateLimitStore(t *testing.T) {
+	now := time.Unix(0, 0)
+	store := newMemoryRateLimitStore(func() time.Time { return now })
+	take := func(key string) (bool, time.Duration) {
+		allowed, wait, err := store.Take(context.Background(), key, 2, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return allowed, wait
+	}
+
+	for i := range 3 {
+		if ok, _ := take("a"); !ok {
+			t.Fatalf("request %d within burst was rejected", i)
+		}
+	}
+	if ok, wait := take("a"); ok || wait != 500*time.Millisecond {
+		t.Errorf("over burst: allowed=%v wait=%v, want rejected with 500ms", ok, wait)
+	}
+	if ok, _ := take("b"); !ok {
+		t.Error("other clients should have their own bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := take("a"); !ok {
+		t.Error("expected a token after refilling")
+	}
+
+	now = now.Add(2 * time.Minute)
+	take("c")
+	if _, ok := store.buckets["a"]; ok {
+		t.Error("expected full buckets to be swept")
+	}
+}
+
+// TestRateLimiter verifies 429 responses, keying and fail-open behaviour.
+func TestRateLimiter(t *testing.T) {
+	handler := NewRateLimiter(RateLimiterOptions{
+		Rate: 1,
+		Key:  HeaderKey("X-API-Key"),
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	assertStatus(t, serve("k1"), http.StatusOK)
+	w := serve("k1")
+	assertStatus(t, w, http.StatusTooManyRequests)
+	assertHeader(t, w, "Retry-After", "1")
+	assertStatus(t, serve("k2"), http.StatusOK)
+	for range 3 {
+		assertStatus(t, serve(""), http.StatusOK)
+	}
+
+	failing := NewRateLimiter(RateLimiterOptions{
+		Rate:   1,
+		Store:  failingStore{},
+		Logger: slog.New(slog.DiscardHandler),
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w = httptest.NewRecorder()
+	failing.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assertStatus(t, w, http.StatusOK)
+}
+
+// failingStore is a RateLimitStore and NonceStore whose backend is
+// unavailable.
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, float64, int) (bool, time.Duration, error) {
+	return false, 0, fmt.Errorf("connection refused")
+}
+
+func (failingStore) Remember(context.Context, string, time.Time) (bool, error) {
+	return false, fmt.Errorf("connection refused")
+}
+
+// TestHardening verifies rejection of ambiguous requests and hop-by-hop
+// header stripping.
+func TestHardening(t *testing.T) {
+	logger, buf := newTestLogger()
+	var got http.Header
+	handler := NewHardening(HardeningOptions{StripHopByHop: true, Logger: logger})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Clone()
+		}))
+
+	tests := []struct {
+		name   string
+		modify func(r *http.Request)
+		reason string
+	}{
+		{"content length with chunked", func(r *http.Request) {
+			r.Header.Set("Content-Length", "3")
+			r.TransferEncoding = []string{"chunked"}
+		}, "content_length_with_transfer_encoding"},
+		{"duplicate content length", func(r *http.Request) {
+			r.Header["Content-Length"] = []string{"3", "4"}
+		}, "multiple_content_length"},
+		{"gzip transfer encoding", func(r *http.Request) {
+			r.TransferEncoding = []string{"gzip", "chunked"}
+		}, "unsupported_transfer_encoding"},
+		{"folded value", func(r *http.Request) {
+			r.Header["X-Folded"] = []string{"a\r\n b"}
+		}, "invalid_header_value"},
+		{"invalid name", func(r *http.Request) {
+			r.Header["Bad Name"] = []string{"x"}
+		}, "invalid_header_name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest("POST", "/", nil)
+			tt.modify(req)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assertStatus(t, w, http.StatusBadRequest)
+			if !strings.Contains(buf.String(), "reason="+tt.reason) {
+				t.Errorf("expected warning with reason %s, got: %s", tt.reason, buf.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Connection", "keep-alive, X-Internal")
+	req.Header.Set("X-Internal", "1")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	req.Header.Set("Upgrade", "h2c")
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assertStatus(t, w, http.StatusOK)
+	for _, name := range []string{"Connection", "X-Internal", "Keep-Alive", "Upgrade"} {
+		if got.Get(name) != "" {
+			t.Errorf("hop-by-hop header %s should be stripped", name)
+		}
+	}
+	if got.Get("Accept") != "text/html" {
+		t.Error("end-to-end headers should be kept")
+	}
+}
+
+// decompress returns the decoded body of a compressed response.
+func decompress(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var r io.Reader
+	switch w.Header().Get("Content-Encoding") {
+	case "gzip":
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	case "deflate":
+		r = flate.NewReader(w.Body)
+	default:
+		return w.Body.String()
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// TestCompression verifies encoding negotiation and the size, type and
+// existing-encoding rules.
+func TestCompression(t *testing.T) {
+	large := strings.Repeat(`{"item":"value"}`, 100)
+	tests := []struct {
+		name         string
+		accept       string
+		contentType  string
+		encoding     string
+		body         string
+		wantEncoding string
+	}{
+		{"gzip", "gzip, deflate", "application/json", "", large, "gzip"},
+		{"deflate preferred", "gzip;q=0.5, deflate", "application/json", "", large, "deflate"},
+		{"not accepted", "br", "application/json", "", large, ""},
+		{"gzip refused", "gzip;q=0", "application/json", "", large, ""},
+		{"too small", "gzip", "application/json", "", `{"ok":true}`, ""},
+		{"type not allowed", "gzip", "image/png", "", large, ""},
+		{"sniffed text", "gzip", "", "", strings.Repeat("hello ", 300), "gzip"},
+		{"already encoded", "gzip", "application/json", "br", large, "br"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewCompression(CompressionOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				// Write in chunks straddling the minimum size.
+				for chunk := range slices.Chunk([]byte(tt.body), 700) {
+					w.Write(chunk)
+				}
+			}))
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", tt.accept)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assertStatus(t, w, http.StatusOK)
+			assertHeader(t, w, "Content-Encoding", tt.wantEncoding)
+			if !slices.Contains(w.Header().Values("Vary"), "Accept-Encoding") {
+				t.Error("expected Vary: Accept-Encoding")
+			}
+			if tt.encoding == "" {
+				if got := decompress(t, w); got != tt.body {
+					t.Errorf("body mismatch: got %d bytes, want %d", len(got), len(tt.body))
+				}
+			}
+		})
+	}
+}
+
+// TestCompression_Range verifies that partial responses are sent
+// uncompressed, so that Content-Range matches the bytes on the wire.
+func TestCompression_Range(t *testing.T) {
+	content := strings.Repeat("range test content ", 200)
+	handler := NewCompression(CompressionOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.txt", time.Time{}, strings.NewReader(content))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=100-2099")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assertStatus(t, w, http.StatusPartialContent)
+	assertHeader(t, w, "Content-Encoding", "")
+	assertHeader(t, w, "Content-Range", fmt.Sprintf("bytes 100-2099/%d", len(content)))
+	if got := w.Body.String(); got != content[100:2100] {
+		t.Errorf("body = %d bytes, want the 2000 requested", len(got))
+	}
+}
+
+// TestCompression_StreamingAndLogging verifies that flushes reach the client
+// and that the shared wrapper outside compression counts uncompressed bytes.
+func TestCompression_StreamingAndLogging(t *testing.T) {
+	logger, buf := newTestLogger()
+	flushed := false
+	handler := CreateStack(NewLoggingMiddleware(logger), NewCompression(CompressionOptions{}))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: 1\n\n"))
+			if err := http.NewResponseController(w).Flush(); err != nil {
+				t.Errorf("Flush: %v", err)
+			}
+			flushed = true
+		}))
+	req := httptest.NewRequest("GET", "/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if !flushed || !w.Flushed {
+		t.Error("expected the response to be flushed")
+	}
+	assertHeader(t, w, "Content-Encoding", "gzip")
+	if got := decompress(t, w); got != "data: 1\n\n" {
+		t.Errorf("body = %q", got)
+	}
+	if !strings.Contains(buf.String(), "status=200") {
+		t.Errorf("expected request to be logged, got: %s", buf.String())
+	}
+
+	var info ResponseInfo
+	hooks := NewHooks()
+	hooks.OnResponseWritten(func(r *http.Request, i ResponseInfo) { info = i })
+	CreateStack(NewCompression(CompressionOptions{MinSize: 10}), hooks.Apply)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(strings.Repeat("a", 5000)))
+	})).ServeHTTP(httptest.NewRecorder(), req)
+	if info.Bytes != 5000 {
+		t.Errorf("wrapper inside compression should count uncompressed bytes, got %d", info.Bytes)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	var got Principal
+	handler := NewBasicAuth(func(user, pass string) bool {
+		return user == "ada" && pass == "lovelace"
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assertStatus(t, w, http.StatusUnauthorized)
+	assertHeader(t, w, "WWW-Authenticate", `Basic realm="restricted", charset="UTF-8"`)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth("ada", "wrong")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assertStatus(t, w, http.StatusUnauthorized)
+
+	r.SetBasicAuth("ada", "lovelace")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assertStatus(t, w, http.StatusOK)
+	if got.Subject != "ada" {
+		t.Errorf("principal = %+v, want subject ada", got)
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	var got Principal
+	handler := NewBearerAuth(func(token string) (Principal, error) {
+		if token != "t0k3n" {
+			return Principal{}, errors.New("unknown token")
+		}
+		return Principal{Subject: "svc-orders", Attributes: map[string]any{"scope": "read"}}, nil
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name      string
+		header    string
+		want      int
+		challenge string
+	}{
+		{"missing", "", http.StatusUnauthorized, `Bearer realm="api"`},
+		{"other scheme", "Basic YTpi", http.StatusUnauthorized, `Bearer realm="api"`},
+		{"invalid", "Bearer nope", http.StatusUnauthorized, `Bearer realm="api", error="invalid_token", error_description="the access token is invalid or expired"`},
+		{"valid", "bearer t0k3n", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assertStatus(t, w, tt.want)
+			assertHeader(t, w, "WWW-Authenticate", tt.challenge)
+		})
+	}
+	if got.Subject != "svc-orders" || got.Attributes["scope"] != "read" {
+		t.Errorf("principal = %+v", got)
+	}
+	if _, ok := PrincipalFromContext(context.Background()); ok {
+		t.Error("PrincipalFromContext on an empty context reported a principal")
+	}
+}
+
+func TestReplayProtection(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	clock := func() time.Time { return now }
+	store := newMemoryNonceStore(clock)
+	handler := newReplayProtection(ReplayOptions{
+		NonceHeader:     "X-Nonce",
+		TimestampHeader: "X-Timestamp",
+		Window:          time.Minute,
+		Key:             HeaderKey("X-Client"),
+		Store:           store,
+	}, clock)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(client, nonce string, ts time.Time) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set("X-Client", client)
+		if nonce != "" {
+			r.Header.Set("X-Nonce", nonce)
+		}
+		if !ts.IsZero() {
+			r.Header.Set("X-Timestamp", strconv.FormatInt(ts.Unix(), 10))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	assertStatus(t, serve("a", "", now), http.StatusUnauthorized)
+	assertStatus(t, serve("a", "n1", time.Time{}), http.StatusUnauthorized)
+	assertStatus(t, serve("a", "n1", now.Add(-2*time.Minute)), http.StatusUnauthorized)
+	assertStatus(t, serve("a", "n1", now.Add(2*time.Minute)), http.StatusUnauthorized)
+
+	assertStatus(t, serve("a", "n1", now.Add(30*time.Second)), http.StatusOK)
+	assertStatus(t, serve("a", "n1", now), http.StatusConflict)
+	assertStatus(t, serve("b", "n1", now), http.StatusOK)
+
+	// The nonce is remembered until its timestamp leaves the window.
+	now = now.Add(80 * time.Second)
+	assertStatus(t, serve("a", "n1", now), http.StatusConflict)
+	now = now.Add(20 * time.Second)
+	assertStatus(t, serve("a", "n1", now), http.StatusOK)
+
+	now = now.Add(5 * time.Minute)
+	serve("c", "n2", now)
+	if len(store.nonces) != 1 {
+		t.Errorf("store holds %d nonces after sweep, want 1", len(store.nonces))
+	}
+
+	failing := NewReplayProtection(ReplayOptions{
+		Store:  failingStore{},
+		Logger: slog.New(slog.DiscardHandler),
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-Nonce", "n")
+	r.Header.Set("X-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	w := httptest.NewRecorder()
+	failing.ServeHTTP(w, r)
+	assertStatus(t, w, http.StatusServiceUnavailable)
+}
+
+func TestRateLimiter_Overrides(t *testing.T) {
+	overrides := NewRateLimitOverrides(map[string]RateLimit{"acme": {Rate: 1, Burst: 3}})
+	handler := NewRateLimiter(RateLimiterOptions{
+		Rate:      1,
+		Key:       HeaderKey("X-Tenant-ID"),
+		Overrides: overrides,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	allowed := func(tenant string) int {
+		n := 0
+		for range 5 {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-Tenant-ID", tenant)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code == http.StatusOK {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := allowed("acme"); n != 3 {
+		t.Errorf("acme allowed %d requests, want 3", n)
+	}
+	if n := allowed("free"); n != 1 {
+		t.Errorf("free allowed %d requests, want 1", n)
+	}
+
+	if err := overrides.Load(strings.NewReader(`{"globex": {"rate": 2}}`)); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if n := allowed("globex"); n != 2 {
+		t.Errorf("globex allowed %d requests after reload, want 2", n)
+	}
+
+	for _, bad := range []string{`{"x": {"rate": 0}}`, `{"x": {"rate": 1, "burts": 2}}`, `[`} {
+		if err := overrides.Load(strings.NewReader(bad)); err == nil {
+			t.Errorf("Load(%s) succeeded, want error", bad)
+		}
+	}
+	if l, ok := overrides.Lookup("globex"); !ok || l.Burst != 2 {
+		t.Errorf("Lookup(globex) = %+v, %v after failed loads, want previous overrides kept", l, ok)
+	}
+
+	path := filepath.Join(t.TempDir(), "limits.json")
+	if err := os.WriteFile(path, []byte(`{"initech": {"rate": 5, "burst": 10}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := overrides.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if _, ok := overrides.Lookup("globex"); ok {
+		t.Error("LoadFile() kept an override missing from the file")
+	}
+	if l, _ := overrides.Lookup("initech"); l != (RateLimit{Rate: 5, Burst: 10}) {
+		t.Errorf("Lookup(initech) = %+v, want {5 10}", l)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Stack", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	mux := http.NewServeMux()
+	root := NewGroup(mux, tag("root"))
+	api := root.Group("/api/", tag("api"))
+	api.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.PathValue("id")))
+	})
+	api.Post("/users", ok)
+	api.Group("/admin", tag("admin")).Delete("/users/{id}", ok)
+	root.Group("/public").Handle("/", http.HandlerFunc(ok))
+
+	tests := []struct {
+		method, path string
+		status       int
+		stack        []string
+	}{
+		{"GET", "/api/users/42", http.StatusOK, []string{"root", "api"}},
+		{"HEAD", "/api/users/42", http.StatusOK, []string{"root", "api"}},
+		{"POST", "/api/users", http.StatusOK, []string{"root", "api"}},
+		{"DELETE", "/api/admin/users/42", http.StatusOK, []string{"root", "api", "admin"}},
+		{"GET", "/public/css/site.css", http.StatusOK, []string{"root"}},
+		{"PUT", "/api/users", http.StatusMethodNotAllowed, nil},
+		{"GET", "/other", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			assertStatus(t, w, tt.status)
+			if got := w.Header().Values("X-Stack"); !slices.Equal(got, tt.stack) {
+				t.Errorf("middleware run = %v, want %v", got, tt.stack)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/users/42", nil))
+	if w.Body.String() != "42" {
+		t.Errorf("body = %q, want path value 42", w.Body.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Handle() with a relative path did not panic")
+		}
+	}()
+	root.Handle("GET users", http.HandlerFunc(ok))
+}
+
+func TestHMACVerifier(t *testing.T) {
+	oldKey := HMACKey{ID: "k1", Secret: []byte("old secret")}
+	newKey := HMACKey{ID: "k2", Secret: []byte("new secret")}
+	var got string
+	handler := NewHMACVerifier(HMACOptions{
+		Keys:        []HMACKey{oldKey, newKey},
+		MaxBodySize: 64,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	}))
+	serve := func(body string, prepare func(r *http.Request)) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/hooks", strings.NewReader(body))
+		r.Header.Set(NonceHeader, "n-1")
+		prepare(r)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	body := `{"event":"order.paid"}`
+
+	tests := []struct {
+		name    string
+		body    string
+		prepare func(r *http.Request)
+		want    int
+	}{
+		{"new key", body, func(r *http.Request) { SignRequest(r, []byte(body), newKey) }, http.StatusOK},
+		{"both keys during rotation", body, func(r *http.Request) {
+			SignRequest(r, []byte(body), HMACKey{ID: "k3", Secret: []byte("next")}, oldKey)
+		}, http.StatusOK},
+		{"unsigned", body, func(r *http.Request) {}, http.StatusUnauthorized},
+		{"unknown key", body, func(r *http.Request) {
+			SignRequest(r, []byte(body), HMACKey{ID: "k9", Secret: newKey.Secret})
+		}, http.StatusUnauthorized},
+		{"tampered body", `{"event":"order.refunded"}`, func(r *http.Request) {
+			SignRequest(r, []byte(body), newKey)
+		}, http.StatusUnauthorized},
+		{"tampered nonce", body, func(r *http.Request) {
+			SignRequest(r, []byte(body), newKey)
+			r.Header.Set(NonceHeader, "n-2")
+		}, http.StatusUnauthorized},
+		{"stale", body, func(r *http.Request) {
+			SignRequest(r, []byte(body), newKey)
+			r.Header.Set(TimestampHeader, strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+		}, http.StatusUnauthorized},
+		{"too large", strings.Repeat("x", 65), func(r *http.Request) {
+			SignRequest(r, []byte(strings.Repeat("x", 65)), newKey)
+		}, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = ""
+			w := serve(tt.body, tt.prepare)
+			assertStatus(t, w, tt.want)
+			if tt.want == http.StatusOK && got != tt.body {
+				t.Errorf("handler read body %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	lateWrite := make(chan error, 1)
+	slow := NewTimeout(20 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		<-release
+		w.Header().Set("X-Late", "1")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("late"))
+		lateWrite <- err
+	}))
+	w := httptest.NewRecorder()
+	slow.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	close(release)
+	assertStatus(t, w, http.StatusGatewayTimeout)
+	if err := <-lateWrite; !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Errorf("write after deadline returned %v, want http.ErrHandlerTimeout", err)
+	}
+	if w.Header().Get("X-Late") != "" || strings.Contains(w.Body.String(), "late") {
+		t.Error("writes after the deadline reached the response")
+	}
+
+	fast := NewTimeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Error("handler context has no deadline")
+		}
+		w.Header().Set("X-Fast", "1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("ok"))
+	}))
+	w = httptest.NewRecorder()
+	fast.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assertStatus(t, w, http.StatusCreated)
+	assertHeader(t, w, "X-Fast", "1")
+
+	panicking := NewTimeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	func() {
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Errorf("recovered %v, want http.ErrAbortHandler", v)
+			}
+		}()
+		panicking.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+
+	fromConfig := NewTimeout(0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := r.Context().Deadline()
+		w.Header().Set("X-Deadline", strconv.FormatBool(ok))
+	}))
+	for _, tt := range []struct {
+		seconds int
+		want    string
+	}{{0, "false"}, {5, "true"}} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r = r.WithContext(config.NewContext(r.Context(), config.ServerConfig{HandlerTimeout: tt.seconds}))
+		w := httptest.NewRecorder()
+		fromConfig.ServeHTTP(w, r)
+		assertHeader(t, w, "X-Deadline", tt.want)
+	}
+}
+
+// TestLoggingMiddleware_Bytes verifies that the "request complete" record
+// includes the number of response body bytes written.
+func TestLoggingMiddleware_Bytes(t *testing.T) {
+	logger, buf := newTestLogger()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello "))
+		w.Write([]byte("world"))
+	})
+
+	NewLoggingMiddleware(logger)(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if !strings.Contains(buf.String(), "bytes=11") {
+		t.Errorf("log should contain bytes=11, got: %s", buf.String())
+	}
+}
+
+// TestNewResponseRecorder verifies that a ResponseRecorder reports status and
+// size, and that middleware deeper in the stack share the outer recorder.
+func TestNewResponseRecorder(t *testing.T) {
+	var inner *ResponseRecorder
+	handler := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inner, r = NewResponseRecorder(w, r)
+			next.ServeHTTP(inner, r)
+		})
+	}(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", nil)
+	rec, r := NewResponseRecorder(w, r)
+	handler.ServeHTTP(rec, r)
+
+	if inner != rec {
+		t.Error("inner middleware did not reuse the outer ResponseRecorder")
+	}
+	if rec.Status() != http.StatusCreated || rec.BytesWritten() != 7 {
+		t.Errorf("Status, BytesWritten = %d, %d; want 201, 7", rec.Status(), rec.BytesWritten())
+	}
+	if info := rec.Info(); info.Status != http.StatusCreated || info.Bytes != 7 {
+		t.Errorf("Info = %+v", info)
+	}
+	assertStatus(t, w, http.StatusCreated)
+}
+
+// fakeWriter is a ResponseWriter that implements every optional interface;
+// fakeWriterWith exposes only some of them.
+type fakeWriter struct {
+	*httptest.ResponseRecorder
+	flushed, hijacked, pushed, readFrom bool
+}
+
+func (f *fakeWriter) Flush() { f.flushed = true; f.ResponseRecorder.Flush() }
+
+func (f *fakeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	f.hijacked = true
+	return nil, nil, nil
+}
+
+func (f *fakeWriter) Push(string, *http.PushOptions) error { f.pushed = true; return nil }
+
+func (f *fakeWriter) ReadFrom(src io.Reader) (int64, error) {
+	f.readFrom = true
+	return io.Copy(f.ResponseRecorder, src)
+}
+
+// fakeWriterWith returns a writer backed by f implementing only the optional
+// interfaces in mask.
+func fakeWriterWith(f *fakeWriter, mask int) http.ResponseWriter {
+	type rw = http.ResponseWriter
+	switch mask {
+	case 0:
+		return struct{ rw }{f}
+	case canFlush:
+		return struct {
+			rw
+			http.Flusher
+		}{f, f}
+	case canHijack:
+		return struct {
+			rw
+			http.Hijacker
+		}{f, f}
+	case canFlush | canHijack:
+		return struct {
+			rw
+			http.Flusher
+			http.Hijacker
+		}{f, f, f}
+	case canPush:
+		return struct {
+			rw
+			http.Pusher
+		}{f, f}
+	case canFlush | canPush:
+		return struct {
+			rw
+			http.Flusher
+			http.Pusher
+		}{f, f, f}
+	case canHijack | canPush:
+		return struct {
+			rw
+			http.Hijacker
+			http.Pusher
+		}{f, f, f}
+	case canFlush | canHijack | canPush:
+		return struct {
+			rw
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{f, f, f, f}
+	case canReadFrom:
+		return struct {
+			rw
+			io.ReaderFrom
+		}{f, f}
+	case canFlush | canReadFrom:
+		return struct {
+			rw
+			http.Flusher
+			io.ReaderFrom
+		}{f, f, f}
+	case canHijack | canReadFrom:
+		return struct {
+			rw
+			http.Hijacker
+			io.ReaderFrom
+		}{f, f, f}
+	case canFlush | canHijack | canReadFrom:
+		return struct {
+			rw
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{f, f, f, f}
+	case canPush | canReadFrom:
+		return struct {
+			rw
+			http.Pusher
+			io.ReaderFrom
+		}{f, f, f}
+	case canFlush | canPush | canReadFrom:
+		return struct {
+			rw
+			http.Flusher
+			http.Pusher
+			io.ReaderFrom
+		}{f, f, f, f}
+	case canHijack | canPush | canReadFrom:
+		return struct {
+			rw
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{f, f, f, f}
+	default:
+		return f
+	}
+}
+
+// TestResponseRecorder_OptionalInterfaces verifies that, for every
+// combination of optional interfaces on the underlying writer, the
+// recorder's Writer implements exactly those interfaces and records what
+// passes through them.
+func TestResponseRecorder_OptionalInterfaces(t *testing.T) {
+	for mask := range 16 {
+		t.Run(fmt.Sprintf("mask=%04b", mask), func(t *testing.T) {
+			f := &fakeWriter{ResponseRecorder: httptest.NewRecorder()}
+			rec, _ := NewResponseRecorder(fakeWriterWith(f, mask), httptest.NewRequest("GET", "/", nil))
+			w := rec.Writer()
+
+			flusher, isFlusher := w.(http.Flusher)
+			hijacker, isHijacker := w.(http.Hijacker)
+			pusher, isPusher := w.(http.Pusher)
+			readerFrom, isReaderFrom := w.(io.ReaderFrom)
+			for _, c := range []struct {
+				name     string
+				got, bit bool
+			}{
+				{"Flusher", isFlusher, mask&canFlush != 0},
+				{"Hijacker", isHijacker, mask&canHijack != 0},
+				{"Pusher", isPusher, mask&canPush != 0},
+				{"ReaderFrom", isReaderFrom, mask&canReadFrom != 0},
+			} {
+				if c.got != c.bit {
+					t.Errorf("Writer implements %s = %v, want %v", c.name, c.got, c.bit)
+				}
+			}
+
+			if isReaderFrom {
+				if n, err := readerFrom.ReadFrom(strings.NewReader("hello")); n != 5 || err != nil || !f.readFrom {
+					t.Errorf("ReadFrom = %d, %v (delegated %v)", n, err, f.readFrom)
+				}
+				if rec.BytesWritten() != 5 || rec.Status() != http.StatusOK {
+					t.Errorf("after ReadFrom: BytesWritten, Status = %d, %d; want 5, 200", rec.BytesWritten(), rec.Status())
+				}
+			}
+			if isFlusher {
+				flusher.Flush()
+				if !f.flushed || rec.statusCode != http.StatusOK {
+					t.Errorf("Flush delegated %v, recorded status %d", f.flushed, rec.statusCode)
+				}
+			}
+			if isPusher {
+				if err := pusher.Push("/style.css", nil); err != nil || !f.pushed {
+					t.Errorf("Push = %v (delegated %v)", err, f.pushed)
+				}
+			}
+			if isHijacker {
+				if _, _, err := hijacker.Hijack(); err != nil || !f.hijacked || !rec.Info().Hijacked {
+					t.Errorf("Hijack = %v (delegated %v, recorded %v)", err, f.hijacked, rec.Info().Hijacked)
+				}
+			}
+
+			if again, _ := NewResponseRecorder(w, httptest.NewRequest("GET", "/", nil)); again != rec {
+				t.Error("NewResponseRecorder did not reuse the recorder behind its Writer")
+			}
+		})
+	}
+}
+
+// unwrappingWriter hides its writer's methods but exposes it through Unwrap,
+// as many third-party wrappers do.
+type unwrappingWriter struct{ http.ResponseWriter }
+
+func (u unwrappingWriter) Unwrap() http.ResponseWriter { return u.ResponseWriter }
+
+// TestResponseRecorder_UnwrapChain verifies that Flusher and Hijacker are
+// found through Unwrap methods, but ReaderFrom is not, since writing to an
+// inner writer directly would bypass the wrapper.
+func TestResponseRecorder_UnwrapChain(t *testing.T) {
+	f := &fakeWriter{ResponseRecorder: httptest.NewRecorder()}
+	rec, _ := NewResponseRecorder(unwrappingWriter{f}, httptest.NewRequest("GET", "/", nil))
+	w := rec.Writer()
+	if _, ok := w.(http.Flusher); !ok {
+		t.Error("Writer does not implement Flusher found through Unwrap")
+	}
+	if _, ok := w.(http.Hijacker); !ok {
+		t.Error("Writer does not implement Hijacker found through Unwrap")
+	}
+	if _, ok := w.(io.ReaderFrom); ok {
+		t.Error("Writer implements ReaderFrom of an unwrapped writer")
+	}
+}
+
+// TestResponseRecorder_ReadFromCapture verifies that a capturing recorder
+// copies the body through Write so the capture sees it.
+func TestResponseRecorder_ReadFromCapture(t *testing.T) {
+	f := &fakeWriter{ResponseRecorder: httptest.NewRecorder()}
+	rec, _ := NewResponseRecorder(f, httptest.NewRequest("GET", "/", nil))
+	var captured bytes.Buffer
+	rec.capture = &captured
+	rec.Writer().(io.ReaderFrom).ReadFrom(strings.NewReader("body"))
+	if captured.String() != "body" || f.readFrom || rec.BytesWritten() != 4 {
+		t.Errorf("captured %q, delegated %v, bytes %d", captured.String(), f.readFrom, rec.BytesWritten())
+	}
+}
+
+func TestCanary(t *testing.T) {
+	stable := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "stable") })
+	canaryTree := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "canary")
+	})
+	canary := NewCanary(canaryTree, CanaryOptions{Weight: 30})
+	handler := canary.Apply(stable)
+
+	serve := func(header string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if header != "" {
+			req.Header.Set("X-Canary", header)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("header forces variant", func(t *testing.T) {
+		if got := serve("canary", nil).Body.String(); got != "canary" {
+			t.Errorf("X-Canary: canary served %q", got)
+		}
+		if got := serve("stable", nil).Body.String(); got != "stable" {
+			t.Errorf("X-Canary: stable served %q", got)
+		}
+	})
+
+	t.Run("bucket cookie", func(t *testing.T) {
+		for bucket, want := range map[string]string{"0": "canary", "29": "canary", "30": "stable", "99": "stable"} {
+			rec := serve("", &http.Cookie{Name: "canary_bucket", Value: bucket})
+			if rec.Body.String() != want {
+				t.Errorf("bucket %s served %q, want %q", bucket, rec.Body, want)
+			}
+			if rec.Header().Get("Set-Cookie") != "" {
+				t.Errorf("bucket %s: cookie reassigned", bucket)
+			}
+		}
+	})
+
+	t.Run("new client is assigned a sticky bucket", func(t *testing.T) {
+		rec := serve("", &http.Cookie{Name: "canary_bucket", Value: "bogus"})
+		cookies := rec.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != "canary_bucket" || !cookies[0].HttpOnly {
+			t.Fatalf("cookies = %v, want canary_bucket", cookies)
+		}
+		first := rec.Body.String()
+		for range 5 {
+			if got := serve("", cookies[0]).Body.String(); got != first {
+				t.Fatalf("client moved from %q to %q", first, got)
+			}
+		}
+	})
+
+	t.Run("weight zero rolls back", func(t *testing.T) {
+		if err := canary.SetWeight(0); err != nil {
+			t.Fatal(err)
+		}
+		if got := serve("", &http.Cookie{Name: "canary_bucket", Value: "0"}).Body.String(); got != "stable" {
+			t.Errorf("weight 0 served %q", got)
+		}
+		if err := canary.SetWeight(101); err == nil {
+			t.Error("SetWeight(101) = nil error")
+		}
+	})
+
+	stats := canary.Stats()
+	if stats.Canary.Requests == 0 || stats.Canary.ServerErrors != stats.Canary.Requests || stats.Stable.ServerErrors != 0 {
+		t.Errorf("Stats = %+v", stats)
+	}
+	if stats.Canary.Requests+stats.Stable.Requests != 13 {
+		t.Errorf("Stats = %+v, want 13 requests", stats)
+	}
+}
+
+func TestCanary_AdminHandler(t *testing.T) {
+	canary := NewCanary(http.NotFoundHandler(), CanaryOptions{})
+	admin := canary.AdminHandler()
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("PUT", "/canary?weight=25", nil))
+	assertStatus(t, rec, http.StatusOK)
+	var stats CanaryStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || stats.Weight != 25 || canary.Weight() != 25 {
+		t.Errorf("PUT answered %s (%v), weight %d", rec.Body, err, canary.Weight())
+	}
+
+	for _, target := range []string{"/canary", "/canary?weight=-1", "/canary?weight=x"} {
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, httptest.NewRequest("PUT", target, nil))
+		assertStatus(t, rec, http.StatusBadRequest)
+	}
+	rec = httptest.NewRecorder()
+	admin.ServeHTTP(rec, httptest.NewRequest("DELETE", "/canary", nil))
+	assertStatus(t, rec, http.StatusMethodNotAllowed)
+	if canary.Weight() != 25 {
+		t.Errorf("weight = %d after rejected requests, want 25", canary.Weight())
+	}
+}
+
+func TestIsUpgrade(t *testing.T) {
+	tests := []struct {
+		connection, upgrade string
+		want                string
+		wantOK              bool
+	}{
+		{"Upgrade", "websocket", "websocket", true},
+		{"keep-alive, upgrade", "WebSocket", "websocket", true},
+		{"keep-alive", "websocket", "", false},
+		{"Upgrade", "", "", false},
+		{"Upgrade", "h2c, websocket", "h2c", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Connection", tt.connection)
+		if tt.upgrade != "" {
+			req.Header.Set("Upgrade", tt.upgrade)
+		}
+		if got, ok := IsUpgrade(req); got != tt.want || ok != tt.wantOK {
+			t.Errorf("IsUpgrade(%q, %q) = %q, %v, want %q, %v", tt.connection, tt.upgrade, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestWebSocket_Rejections(t *testing.T) {
+	logger, buf := newTestLogger()
+	called := false
+	handler := NewWebSocket(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/ws", nil))
+	assertStatus(t, rec, http.StatusUpgradeRequired)
+	assertHeader(t, rec, "Upgrade", "websocket")
+
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	rec = httptest.NewRecorder() // not an http.Hijacker
+	handler.ServeHTTP(rec, req)
+	assertStatus(t, rec, http.StatusInternalServerError)
+	if !strings.Contains(buf.String(), "cannot be hijacked") {
+		t.Errorf("log = %q, want hijack error", buf.String())
+	}
+	if called {
+		t.Error("handler called for a request that cannot be upgraded")
+	}
+}
+
+func TestWebSocket_ThroughStack(t *testing.T) {
+	logger, buf := newTestLogger()
+	var mu sync.Mutex
+	ws := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("Hijack = %v", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		rw.Flush()
+		line, _ := rw.ReadString('\n')
+		rw.WriteString("echo " + line)
+		rw.Flush()
+	})
+	stack := CreateStack(
+		func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				next.ServeHTTP(w, r)
+			})
+		},
+		NewLoggingMiddleware(logger),
+		NewEnvelope(nil),
+		NewUnwrapEnvelope(),
+		NewTimeout(time.Millisecond),
+		NewWebSocket(logger),
+	)
+	srv := httptest.NewServer(stack(ws))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "GET /ws HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake = %v, %v", resp, err)
+	}
+	time.Sleep(5 * time.Millisecond) // past the timeout
+	fmt.Fprint(conn, "hello\n")
+	if got, _ := r.ReadString('\n'); got != "echo hello\n" {
+		t.Errorf("echo = %q", got)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !strings.Contains(buf.String(), "status=101") {
+		t.Errorf("log = %q, want status=101", buf.String())
+	}
+}
+
+func TestBufferBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "in memory", body: "small"},
+		{name: "spilled to a file", body: strings.Repeat("large body ", 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.ContentLength = -1
+			release, err := BufferBody(r, BodyBufferOptions{MemoryLimit: 16, TempDir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+
+			if r.ContentLength != int64(len(tt.body)) {
+				t.Errorf("ContentLength = %d, want %d", r.ContentLength, len(tt.body))
+			}
+			for i := range 3 {
+				body := r.Body
+				if i > 0 {
+					if body, err = r.GetBody(); err != nil {
+						t.Fatal(err)
+					}
+				}
+				got, err := io.ReadAll(body)
+				if err != nil || string(got) != tt.body {
+					t.Errorf("read %d = %q, %v, want %q", i, got, err, tt.body)
+				}
+			}
+
+			release()
+			release()
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("temporary files left after release: %v", entries)
+			}
+		})
+	}
+}
+
+func TestBufferBody_TooLarge(t *testing.T) {
+	for _, memoryLimit := range []int64{4, 64} {
+		dir := t.TempDir()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", 33)))
+		release, err := BufferBody(r, BodyBufferOptions{MaxBodySize: 32, MemoryLimit: memoryLimit, TempDir: dir})
+		release()
+		var tooLarge *http.MaxBytesError
+		if !errors.As(err, &tooLarge) || tooLarge.Limit != 32 {
+			t.Errorf("memory limit %d: error = %v, want *http.MaxBytesError with limit 32", memoryLimit, err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("memory limit %d: temporary files left: %v", memoryLimit, entries)
+		}
+	}
+}
+
+func TestBodyBuffer(t *testing.T) {
+	dir := t.TempDir()
+	var handlerErr error
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first, _ := io.ReadAll(r.Body)
+		body, err := r.GetBody()
+		if err != nil {
+			handlerErr = err
+			return
+		}
+		second, _ := io.ReadAll(body)
+		if !bytes.Equal(first, second) {
+			handlerErr = fmt.Errorf("reads differ: %q and %q", first, second)
+		}
+		if string(first) == "panic" {
+			panic("handler failed")
+		}
+		w.Write(second)
+	})
+	logger, _ := newTestLogger()
+	stack := CreateStack(NewRecovery(logger), NewBodyBuffer(BodyBufferOptions{MaxBodySize: 64, MemoryLimit: 2, TempDir: dir}))(handler)
+
+	for _, tt := range []struct {
+		body   string
+		status int
+	}{
+		{"payload", http.StatusOK},
+		{"panic", http.StatusInternalServerError},
+		{strings.Repeat("x", 65), http.StatusRequestEntityTooLarge},
+	} {
+		rec := httptest.NewRecorder()
+		stack.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+		assertStatus(t, rec, tt.status)
+		if tt.status == http.StatusOK && rec.Body.String() != tt.body {
+			t.Errorf("body = %q, want %q", rec.Body.String(), tt.body)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("body %.10q: temporary files left: %v", tt.body, entries)
+		}
+	}
+	if handlerErr != nil {
+		t.Error(handlerErr)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	before := Metrics()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if SetValidators(r.Context(), Validators{ETag: "v1"}) {
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(bytes.Repeat([]byte("compressible "), 200))
+	})
+	serve := func(h http.Handler, r *http.Request) {
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	limited := NewRateLimiter(RateLimiterOptions{Rate: 1, Key: HeaderKey("X-API-Key")})(ok)
+	for range 3 {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-API-Key", "k")
+		serve(limited, r)
+	}
+	serve(NewMaxBytesReader(4)(ok), httptest.NewRequest("POST", "/", strings.NewReader("too long")))
+	basic := NewBasicAuth(func(user, pass string) bool { return false })(ok)
+	serve(basic, httptest.NewRequest("GET", "/", nil))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.SetBasicAuth("user", "wrong")
+	serve(basic, r)
+	serve(NewBearerAuth(func(string) (Principal, error) { return Principal{}, errors.New("no") })(ok), httptest.NewRequest("GET", "/", nil))
+	conditional := NewConditionalGet()(ok)
+	for _, etag := range []string{`"v1"`, `"v0"`} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("If-None-Match", etag)
+		serve(conditional, r)
+	}
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	serve(NewCompression(CompressionOptions{})(ok), r)
+
+	after := Metrics()
+	for name, want := range map[string]int64{
+		"ratelimit.rejected":             2,
+		"maxbytes.exceeded":              1,
+		"auth.basic.missing_credentials": 1,
+		"auth.basic.invalid_credentials": 1,
+		"auth.bearer.missing_token":      1,
+		"conditional.hits":               1,
+		"conditional.misses":             1,
+		"compression.responses":          1,
+		"compression.bytes_in":           2600,
+	} {
+		if got := after[name] - before[name]; got != want {
+			t.Errorf("%s increased by %d, want %d", name, got, want)
+		}
+	}
+	in, out := after["compression.bytes_in"]-before["compression.bytes_in"], after["compression.bytes_out"]-before["compression.bytes_out"]
+	if out <= 0 || out >= in {
+		t.Errorf("compression.bytes_out increased by %d, want between 0 and %d", out, in)
+	}
+}
+
+func TestBodyLogger(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		io.Copy(w, r.Body)
+	})
+	local := config.ServerConfig{Environment: config.Local}
+
+	tests := []struct {
+		name        string
+		opts        BodyLoggerOptions
+		cfg         *config.ServerConfig
+		contentType string
+		body        string
+		want        []string
+		notWant     []string
+	}{
+		{
+			name:        "json redacted",
+			cfg:         &local,
+			contentType: "application/json",
+			body:        `{"user":"ada","Password":"hunter2","auth":{"access_token":"abc\"def","ttl":3600},"apiKey":12345}`,
+			want:        []string{`\"user\":\"ada\"`, `\"Password\":\"[REDACTED]\"`, `\"access_token\":\"[REDACTED]\"`, `\"ttl\":3600`, "body_truncated=false"},
+			notWant:     []string{"hunter2", "abc", "12345", "response."},
+		},
+		{
+			name:        "form redacted",
+			cfg:         &local,
+			contentType: "application/x-www-form-urlencoded",
+			body:        "user=ada&password=hunter2&csrf_token=xyz&client_credential=cred-1&signing_key=sign-1",
+			want:        []string{"user=ada&password=[REDACTED]&csrf_token=[REDACTED]&client_credential=[REDACTED]&signing_key=[REDACTED]"},
+			notWant:     []string{"hunter2", "xyz", "cred-1", "sign-1"},
+		},
+		{
+			name:        "truncated",
+			opts:        BodyLoggerOptions{MaxBodyBytes: 30},
+			cfg:         &local,
+			contentType: "application/json",
+			body:        `{"name":"ada","secret":"hunter2hunter2"}`,
+			want:        []string{`\"secret\":\"[REDACTED]\"`, "body_truncated=true"},
+			notWant:     []string{"hunter2"},
+		},
+		{
+			name:        "responses",
+			opts:        BodyLoggerOptions{Responses: true},
+			cfg:         &local,
+			contentType: "text/plain; charset=utf-8",
+			body:        "hello",
+			want:        []string{"request.body=hello", "response.body=hello", "response.content_type="},
+		},
+		{
+			name:        "content type filtered",
+			opts:        BodyLoggerOptions{Responses: true},
+			cfg:         &local,
+			contentType: "application/octet-stream",
+			body:        "binary",
+			want:        []string{"request.body_omitted=true", "response.body_omitted=true"},
+			notWant:     []string{"binary"},
+		},
+		{
+			name:        "custom fields",
+			opts:        BodyLoggerOptions{RedactFields: []string{"ssn"}},
+			cfg:         &local,
+			contentType: "application/problem+json",
+			body:        `{"ssn":"078-05-1120","password":"shown"}`,
+			want:        []string{`\"ssn\":\"[REDACTED]\"`, "shown"},
+		},
+		{
+			name:        "production skipped",
+			cfg:         &config.ServerConfig{Environment: config.Production},
+			contentType: "application/json",
+			body:        `{}`,
+		},
+		{
+			name:        "no config skipped",
+			contentType: "application/json",
+			body:        `{}`,
+		},
+		{
+			name:        "production allowed",
+			opts:        BodyLoggerOptions{Environments: []config.Environment{config.Production}},
+			cfg:         &config.ServerConfig{Environment: config.Production},
+			contentType: "application/json",
+			body:        `{"a":1}`,
+			want:        []string{`\"a\":1`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, buf := newTestLogger()
+			h := NewBodyLogger(logger, tt.opts)(echo)
+			req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.cfg != nil {
+				req = req.WithContext(config.NewContext(req.Context(), *tt.cfg))
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Body.String() != tt.body {
+				t.Errorf("response body = %q, want %q", rec.Body, tt.body)
+			}
+			logs := buf.String()
+			if tt.want == nil {
+				if logs != "" {
+					t.Errorf("logged %q, want nothing", logs)
+				}
+				return
+			}
+			for _, want := range append(tt.want, `msg="request body"`) {
+				if !strings.Contains(logs, want) {
+					t.Errorf("log %q does not contain %q", logs, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(logs, notWant) {
+					t.Errorf("log %q contains %q", logs, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	serve := func(opts CORSOptions, method, origin string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		NewCORS(opts)(okHandler).ServeHTTP(w, req)
+		return w
+	}
+	listed := CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com"},
+		ExposedHeaders: []string{"X-Total"},
+		MaxAge:         10 * time.Minute,
+	}
+	preflight := map[string]string{"Access-Control-Request-Method": "POST"}
+
+	t.Run("same origin request untouched", func(t *testing.T) {
+		w := serve(listed, http.MethodGet, "", nil)
+		assertStatus(t, w, http.StatusOK)
+		assertHeader(t, w, "Access-Control-Allow-Origin", "")
+		assertHeader(t, w, "Vary", "")
+	})
+
+	t.Run("allowed origin", func(t *testing.T) {
+		w := serve(listed, http.MethodGet, "https://app.example.com", nil)
+		assertStatus(t, w, http.StatusOK)
+		assertHeader(t, w, "Access-Control-Allow-Origin", "https://app.example.com")
+		assertHeader(t, w, "Access-Control-Expose-Headers", "X-Total")
+		assertHeader(t, w, "Access-Control-Allow-Credentials", "")
+		assertHeader(t, w, "Vary", "Origin")
+	})
+
+	t.Run("other origin served without headers", func(t *testing.T) {
+		w := serve(listed, http.MethodGet, "https://evil.example", nil)
+		assertStatus(t, w, http.StatusOK)
+		assertHeader(t, w, "Access-Control-Allow-Origin", "")
+	})
+
+	t.Run("preflight", func(t *testing.T) {
+		w := serve(listed, http.MethodOptions, "https://app.example.com", preflight)
+		assertStatus(t, w, http.StatusNoContent)
+		assertHeader(t, w, "Access-Control-Allow-Methods", "GET, HEAD, POST")
+		assertHeader(t, w, "Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-Request-ID")
+		assertHeader(t, w, "Access-Control-Max-Age", "600")
+	})
+
+	t.Run("preflight from other origin", func(t *testing.T) {
+		w := serve(listed, http.MethodOptions, "https://evil.example", preflight)
+		assertStatus(t, w, http.StatusForbidden)
+		assertHeader(t, w, "Access-Control-Allow-Origin", "")
+	})
+
+	t.Run("any origin", func(t *testing.T) {
+		w := serve(CORSOptions{AllowedOrigins: []string{"*"}}, http.MethodGet, "https://a.example", nil)
+		assertHeader(t, w, "Access-Control-Allow-Origin", "*")
+	})
+
+	t.Run("any port with credentials", func(t *testing.T) {
+		opts := CORSOptions{AllowedOrigins: []string{"http://localhost:*"}, AllowedHeaders: []string{"*"}, AllowCredentials: true}
+		w := serve(opts, http.MethodOptions, "http://localhost:5173", map[string]string{
+			"Access-Control-Request-Method":  "PUT",
+			"Access-Control-Request-Headers": "X-Custom",
+		})
+		assertStatus(t, w, http.StatusNoContent)
+		assertHeader(t, w, "Access-Control-Allow-Origin", "http://localhost:5173")
+		assertHeader(t, w, "Access-Control-Allow-Credentials", "true")
+		assertHeader(t, w, "Access-Control-Allow-Headers", "X-Custom")
+
+		for origin, want := range map[string]string{
+			"http://localhost":                "http://localhost",
+			"http://localhost.evil.example":   "",
+			"http://localhost:1@evil.example": "",
+			"https://localhost:443":           "",
+		} {
+			w := serve(opts, http.MethodGet, origin, nil)
+			assertHeader(t, w, "Access-Control-Allow-Origin", want)
+		}
+	})
+
+	t.Run("any origin with credentials panics", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("NewCORS did not panic")
+			}
+		}()
+		NewCORS(CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	})
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	handler := NewSecurityHeaders(SecurityHeadersOptions{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		FrameOptions:          "DENY",
+		NoSniff:               true,
+		ReferrerPolicy:        "no-referrer",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Del("Referrer-Policy")
+		w.WriteHeader(http.StatusOK)
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assertHeader(t, w, "Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+	assertHeader(t, w, "X-Frame-Options", "DENY")
+	assertHeader(t, w, "X-Content-Type-Options", "nosniff")
+	assertHeader(t, w, "Referrer-Policy", "")
+	assertHeader(t, w, "Content-Security-Policy", "")
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Overload describes why a request is being turned away by load-shedding
+// middleware such as NewMemoryGuard.
+type Overload struct {
+	// Status is the response status: http.StatusTooManyRequests when the
+	// client has exceeded its own allowance, or http.StatusServiceUnavailable
+	// when the server as a whole cannot take more work.
+	Status int
+	// Reason is a short machine-readable cause, such as "rate_limited" or
+	// "memory_pressure".
+	Reason string
+	// Detail is a human-readable explanation for the client.
+	Detail string
+	// RetryAfter is how long the client should wait before retrying, as
+	// estimated from the limiter's state. Zero means unknown.
+	RetryAfter time.Duration
+}
+
+// OverloadResponder writes the response for a request rejected because of
+// overload. Middleware that sheds load accepts an OverloadResponder so that
+// applications can use one response format for every such rejection; a nil
+// OverloadResponder means RespondOverloaded.
+type OverloadResponder func(w http.ResponseWriter, r *http.Request, o Overload)
+
+// overloadProblem is the RFC 9457 problem details body for an Overload.
+type overloadProblem struct {
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	Status     int    `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	RetryAfter int64  `json:"retry_after,omitempty"`
+}
+
+// RespondOverloaded is the default OverloadResponder. It sets the Retry-After
+// header to o.RetryAfter rounded up to whole seconds (when known) and writes an
+// application/problem+json body (RFC 9457) with the status, reason, detail and
+// retry delay:
+//
+//	{"type":"about:blank","title":"Service Unavailable","status":503,
+//	 "detail":"...","reason":"memory_pressure","retry_after":1}
+func RespondOverloaded(w http.ResponseWriter, r *http.Request, o Overload) {
+	problem := overloadProblem{
+		Type:   "about:blank",
+		Title:  http.StatusText(o.Status),
+		Status: o.Status,
+		Detail: o.Detail,
+		Reason: o.Reason,
+	}
+	if o.RetryAfter > 0 {
+		problem.RetryAfter = int64(math.Ceil(o.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.FormatInt(problem.RetryAfter, 10))
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(o.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// respondOverloaded writes o with responder, or RespondOverloaded if nil.
+func respondOverloaded(responder OverloadResponder, w http.ResponseWriter, r *http.Request, o Overload) {
+	if responder == nil {
+		responder = RespondOverloaded
+	}
+	responder(w, r, o)
+}
@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimitStore holds the token buckets of NewRateLimiter. The in-memory
+// store from NewMemoryRateLimitStore limits each process separately;
+// deployments with several instances can implement RateLimitStore on a shared
+// backend such as Redis so that clients are limited across all of them.
+type RateLimitStore interface {
+	// Take removes one token from the bucket for key, which refills at rate
+	// tokens per second up to burst tokens and starts full. It reports
+	// whether a token was available and, if not, how long until one will be.
+	Take(ctx context.Context, key string, rate float64, burst int) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// RateLimiterOptions configures NewRateLimiter.
+type RateLimiterOptions struct {
+	// Rate is the sustained number of requests per second allowed for each
+	// client. Required.
+	Rate float64
+	// Burst is the number of requests a client may make at once after being
+	// idle. Defaults to Rate rounded up, and at least 1.
+	Burst int
+	// Key identifies the client a request counts against, such as
+	// RemoteIPKey or HeaderKey("X-API-Key"). Requests for which Key returns
+	// "" are not limited. Defaults to RemoteIPKey.
+	Key func(r *http.Request) string
+	// Overrides replaces Rate and Burst for particular keys, such as tenants
+	// entitled to higher limits. Optional.
+	Overrides *RateLimitOverrides
+	// Store holds the buckets. Defaults to a new NewMemoryRateLimitStore.
+	Store RateLimitStore
+	// Logger receives warnings when Store fails; requests are then allowed.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+	// Respond writes the response for rejected requests. Defaults to RespondOverloaded.
+	Respond OverloadResponder
+}
+
+// NewRateLimiter returns middleware that limits each client to opts.Rate
+// requests per second with bursts of up to opts.Burst, using a token bucket
+// per client key. Requests over the limit are rejected with 429 Too Many
+// Requests (reason "rate_limited") through opts.Respond, with Retry-After set
+// to when the client's next token will be available. Keys with an entry in
+// opts.Overrides are limited by that entry instead, as of the current
+// request, so reloaded overrides apply without a restart.
+//
+// If the store returns an error, the request is allowed and a warning logged,
+// so an unavailable shared store does not take the service down.
+//
+// NewRateLimiter panics if opts.Rate is not positive.
+func NewRateLimiter(opts RateLimiterOptions) Middleware {
+	if opts.Rate <= 0 {
+		panic("middleware: RateLimiterOptions.Rate must be positive")
+	}
+	limit := normalizeRateLimit(RateLimit{Rate: opts.Rate, Burst: opts.Burst})
+	if opts.Key == nil {
+		opts.Key = RemoteIPKey
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryRateLimitStore()
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := opts.Key(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			l := limit
+			if opts.Overrides != nil {
+				if o, ok := opts.Overrides.Lookup(key); ok {
+					l = o
+				}
+			}
+			allowed, retryAfter, err := opts.Store.Take(r.Context(), key, l.Rate, l.Burst)
+			if err != nil {
+				opts.Logger.WarnContext(r.Context(), "rate limit store failed, allowing request",
+					slog.String("error", err.Error()),
+				)
+				countMetric("ratelimit.store_errors", 1)
+				allowed = true
+			}
+			if !allowed {
+				countMetric("ratelimit.rejected", 1)
+				respondOverloaded(opts.Respond, w, r, Overload{
+					Status:     http.StatusTooManyRequests,
+					Reason:     "rate_limited",
+					Detail:     "Too many requests; slow down and retry later.",
+					RetryAfter: retryAfter,
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RemoteIPKey keys rate limits by the IP address of the connection's remote
+// end. Behind a reverse proxy this is the proxy's address; use HeaderKey
+// with a header the proxy sets instead.
+func RemoteIPKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// HeaderKey returns a key function that keys rate limits by the value of
+// the named request header, such as an API key. Requests without the header
+// are not limited.
+func HeaderKey(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// tokenBucket is the state of one client in a memoryRateLimitStore.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	rate   float64
+	burst  int
+}
+
+// memoryRateLimitStore is the in-process RateLimitStore.
+type memoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimitStore returns a RateLimitStore that keeps buckets in
+// memory. Buckets that have refilled completely are discarded periodically,
+// so memory use follows the number of recently active clients.
+func NewMemoryRateLimitStore() RateLimitStore {
+	return newMemoryRateLimitStore(time.Now)
+}
+
+// newMemoryRateLimitStore builds the store with a custom clock, for tests.
+func newMemoryRateLimitStore(now func() time.Time) *memoryRateLimitStore {
+	return &memoryRateLimitStore{buckets: make(map[string]*tokenBucket), now: now, lastSweep: now()}
+}
+
+// Take implements RateLimitStore.
+func (s *memoryRateLimitStore) Take(_ context.Context, key string, rate float64, burst int) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*rate, float64(burst))
+	b.last, b.rate, b.burst = now, rate, burst
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	return false, wait, nil
+}
+
+// sweep discards buckets that would be full by now, which are equivalent to
+// absent ones. Each bucket is judged by the limit it was last taken with,
+// since keys with overrides have limits of their own.
+func (s *memoryRateLimitStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.rate >= float64(b.burst) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync/atomic"
+)
+
+// RateLimit is the rate and burst applied to one client key.
+type RateLimit struct {
+	// Rate is the sustained number of requests per second. Must be positive.
+	Rate float64 `json:"rate"`
+	// Burst is the number of requests allowed at once. Defaults to Rate
+	// rounded up, and at least 1.
+	Burst int `json:"burst,omitempty"`
+}
+
+// RateLimitOverrides holds per-key limits that replace the defaults of
+// NewRateLimiter for particular clients, such as tenants on a higher plan.
+// The set of overrides can be replaced at runtime, typically by reloading a
+// file on SIGHUP:
+//
+//	overrides := middleware.NewRateLimitOverrides(nil)
+//	if err := overrides.LoadFile("/etc/app/rate-limits.json"); err != nil {
+//		return err
+//	}
+//	limiter := middleware.NewRateLimiter(middleware.RateLimiterOptions{
+//		Rate:      10,
+//		Key:       middleware.HeaderKey("X-Tenant-ID"),
+//		Overrides: overrides,
+//	})
+//	server.Run(ctx, handler, server.WithReloadHandler(func(config.ServerConfig) {
+//		if err := overrides.LoadFile("/etc/app/rate-limits.json"); err != nil {
+//			slog.Error("rate limit overrides not reloaded", slog.String("error", err.Error()))
+//		}
+//	}))
+//
+// A RateLimitOverrides is safe for concurrent use.
+type RateLimitOverrides struct {
+	limits atomic.Pointer[map[string]RateLimit]
+}
+
+// NewRateLimitOverrides returns overrides initially holding limits, keyed by
+// the value of RateLimiterOptions.Key. It panics if a limit is invalid.
+func NewRateLimitOverrides(limits map[string]RateLimit) *RateLimitOverrides {
+	o := &RateLimitOverrides{}
+	if err := o.Set(limits); err != nil {
+		panic("middleware: " + err.Error())
+	}
+	return o
+}
+
+// Set atomically replaces all overrides with limits. If any limit is
+// invalid, Set returns an error and keeps the previous overrides.
+func (o *RateLimitOverrides) Set(limits map[string]RateLimit) error {
+	m := make(map[string]RateLimit, len(limits))
+	for key, l := range limits {
+		if l.Rate <= 0 {
+			return fmt.Errorf("rate limit override %q: rate must be positive", key)
+		}
+		if l.Burst < 0 {
+			return fmt.Errorf("rate limit override %q: burst must not be negative", key)
+		}
+		m[key] = normalizeRateLimit(l)
+	}
+	o.limits.Store(&m)
+	return nil
+}
+
+// Load replaces the overrides with those read from r, a JSON object mapping
+// keys to limits:
+//
+//	{"tenant-acme": {"rate": 100, "burst": 200}, "tenant-free": {"rate": 1}}
+//
+// If r cannot be decoded or holds an invalid limit, Load returns an error and
+// keeps the previous overrides.
+func (o *RateLimitOverrides) Load(r io.Reader) error {
+	var limits map[string]RateLimit
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&limits); err != nil {
+		return fmt.Errorf("decoding rate limit overrides: %w", err)
+	}
+	return o.Set(limits)
+}
+
+// LoadFile calls Load with the contents of the named file.
+func (o *RateLimitOverrides) LoadFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := o.Load(f); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// Lookup returns the override for key, if any.
+func (o *RateLimitOverrides) Lookup(key string) (RateLimit, bool) {
+	l, ok := (*o.limits.Load())[key]
+	return l, ok
+}
+
+// normalizeRateLimit fills in the default burst.
+func normalizeRateLimit(l RateLimit) RateLimit {
+	if l.Burst <= 0 {
+		l.Burst = max(int(math.Ceil(l.Rate)), 1)
+	}
+	return l
+}
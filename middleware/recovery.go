@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+	"github.com/harrydayexe/GoWebUtilities/crashreport"
+	"github.com/harrydayexe/GoWebUtilities/httpabort"
+)
+
+// NewRecovery returns middleware that recovers from panics in the next handler.
+//
+// Panics with an httpabort.Abort value (or an error wrapping one) are treated
+// as a request to respond early: the Abort's status and body are sent to the
+// client and the event is logged at DEBUG level. Any other panic is logged at
+// ERROR level with its stack trace and answered with 500 Internal Server Error.
+//
+// If the request context carries a config.ServerConfig (as it does when served
+// by the server package) with CrashDir set, a crash report with the stack,
+// request metadata and attributes, build information and masked configuration is also written
+// to that directory, and its path is included in the log record.
+//
+// If the handler had already started writing the response, the status cannot
+// be changed, so the response is left as written. Panics with
+// http.ErrAbortHandler are re-raised so that net/http aborts the connection
+// silently, as documented for that value.
+//
+// Place NewRecovery inside NewLoggingMiddleware so the logged status reflects
+// the response written by the recovery.
+func NewRecovery(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wrapped, r := NewResponseRecorder(w, r)
+
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				written := wrapped.statusCode != 0 || wrapped.hijacked
+
+				if abort, ok := asAbort(v); ok {
+					logger.DebugContext(r.Context(), "request aborted",
+						slog.String("method", r.Method),
+						slog.String("path", r.URL.Path),
+						slog.Int("status", abort.Status),
+					)
+					if !written {
+						http.Error(wrapped, abort.Message(), abort.Status)
+					}
+					return
+				}
+
+				stack := debug.Stack()
+				attrs := []any{
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("panic", fmt.Sprint(v)),
+					slog.String("stack", string(stack)),
+				}
+				for _, a := range RequestAttrs(r.Context()) {
+					attrs = append(attrs, a)
+				}
+				if cfg, ok := config.FromContext(r.Context()); ok && cfg.CrashDir != "" {
+					path, err := crashreport.Write(cfg.CrashDir, crashreport.Report{
+						Reason:  fmt.Sprintf("panic: %v", v),
+						Stack:   stack,
+						Request: r,
+						Attrs:   RequestAttrs(r.Context()),
+						Config:  cfg,
+					})
+					if err != nil {
+						attrs = append(attrs, slog.String("crash_report_error", err.Error()))
+					} else {
+						attrs = append(attrs, slog.String("crash_report", path))
+					}
+				}
+				logger.ErrorContext(r.Context(), "panic recovered", attrs...)
+				if !written {
+					http.Error(wrapped, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}()
+
+			next.ServeHTTP(wrapped.Writer(), r)
+		})
+	}
+}
+
+// asAbort reports whether the panic value v is, or wraps, an httpabort.Abort.
+func asAbort(v any) (httpabort.Abort, bool) {
+	switch a := v.(type) {
+	case httpabort.Abort:
+		return a, true
+	case *httpabort.Abort:
+		return *a, a != nil
+	case error:
+		var abort httpabort.Abort
+		if errors.As(a, &abort) {
+			return abort, true
+		}
+	}
+	return httpabort.Abort{}, false
+}
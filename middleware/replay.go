@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NonceStore remembers the nonces seen by NewReplayProtection. The in-memory
+// store from NewMemoryNonceStore protects each process separately; deployments
+// with several instances must implement NonceStore on a shared backend (for
+// example Redis SET NX with an expiry), or a request replayed against another
+// instance will be accepted.
+type NonceStore interface {
+	// Remember records nonce until expires and reports whether it was new,
+	// i.e. not already recorded with an expiry still in the future. Checking
+	// and recording must be atomic.
+	Remember(ctx context.Context, nonce string, expires time.Time) (fresh bool, err error)
+}
+
+// ReplayOptions configures NewReplayProtection.
+type ReplayOptions struct {
+	// NonceHeader carries the client-chosen unique value of each request.
+	// Defaults to NonceHeader ("X-Nonce").
+	NonceHeader string
+	// TimestampHeader carries the time the client created the request, in
+	// Unix seconds. Defaults to TimestampHeader ("X-Timestamp").
+	TimestampHeader string
+	// Window is how far the timestamp may be from the server's clock in
+	// either direction. Nonces are remembered for as long as their request
+	// could still be accepted. Defaults to 5 minutes.
+	Window time.Duration
+	// Key scopes nonces to a client, such as the subject of the Principal
+	// set by NewBearerAuth, so clients cannot exhaust each other's nonces.
+	// Defaults to one scope shared by all clients.
+	Key func(r *http.Request) string
+	// Store remembers nonces. Defaults to a new NewMemoryNonceStore.
+	Store NonceStore
+	// Logger receives errors when Store fails. Defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// NewReplayProtection returns middleware that rejects requests whose nonce
+// has already been used within the time window. Each request must carry a
+// nonce and a timestamp within opts.Window of the server's clock; requests
+// missing either or with a stale timestamp are rejected with 401
+// Unauthorized, and requests reusing a nonce with 409 Conflict.
+//
+// The headers only prove anything when they are covered by a signature, so
+// place the middleware after NewHMACVerifier, whose signatures include both.
+// Unlike NewRateLimiter, a store error rejects the request with 503 Service
+// Unavailable, since allowing it would let replays through.
+func NewReplayProtection(opts ReplayOptions) Middleware {
+	if opts.NonceHeader == "" {
+		opts.NonceHeader = NonceHeader
+	}
+	if opts.TimestampHeader == "" {
+		opts.TimestampHeader = TimestampHeader
+	}
+	if opts.Window <= 0 {
+		opts.Window = 5 * time.Minute
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryNonceStore()
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return newReplayProtection(opts, time.Now)
+}
+
+// newReplayProtection builds the middleware with a custom clock, for tests.
+func newReplayProtection(opts ReplayOptions, now func() time.Time) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nonce := r.Header.Get(opts.NonceHeader)
+			sec, err := strconv.ParseInt(r.Header.Get(opts.TimestampHeader), 10, 64)
+			if nonce == "" || err != nil {
+				countMetric("replay.malformed", 1)
+				http.Error(w, "missing or malformed nonce or timestamp", http.StatusUnauthorized)
+				return
+			}
+			ts := time.Unix(sec, 0)
+			if d := now().Sub(ts); d > opts.Window || d < -opts.Window {
+				countMetric("replay.stale", 1)
+				http.Error(w, "request timestamp outside the allowed window", http.StatusUnauthorized)
+				return
+			}
+
+			if opts.Key != nil {
+				nonce = opts.Key(r) + "\x00" + nonce
+			}
+			fresh, err := opts.Store.Remember(r.Context(), nonce, ts.Add(opts.Window))
+			if err != nil {
+				opts.Logger.ErrorContext(r.Context(), "nonce store failed, rejecting request",
+					slog.String("error", err.Error()),
+				)
+				countMetric("replay.store_errors", 1)
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+			if !fresh {
+				countMetric("replay.reused", 1)
+				http.Error(w, "nonce already used", http.StatusConflict)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// memoryNonceStore is the in-process NonceStore.
+type memoryNonceStore struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryNonceStore returns a NonceStore that keeps nonces in memory.
+// Expired nonces are discarded periodically, so memory use follows the
+// number of requests within the replay window.
+func NewMemoryNonceStore() NonceStore {
+	return newMemoryNonceStore(time.Now)
+}
+
+// newMemoryNonceStore builds the store with a custom clock, for tests.
+func newMemoryNonceStore(now func() time.Time) *memoryNonceStore {
+	return &memoryNonceStore{nonces: make(map[string]time.Time), now: now, lastSweep: now()}
+}
+
+// Remember implements NonceStore.
+func (s *memoryNonceStore) Remember(_ context.Context, nonce string, expires time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for n, exp := range s.nonces {
+			if !exp.After(now) {
+				delete(s.nonces, n)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if exp, ok := s.nonces[nonce]; ok && exp.After(now) {
+		return false, nil
+	}
+	s.nonces[nonce] = expires
+	return true, nil
+}
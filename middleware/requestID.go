@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is the header carrying the request identifier.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the length of a propagated request ID.
+const maxRequestIDLength = 128
+
+// requestIDKey is the context key under which the request ID is stored.
+type requestIDKey struct{}
+
+// NewRequestID returns middleware that gives every request an identifier.
+// A valid X-Request-ID header from the client or an upstream proxy is kept,
+// so one ID follows the request across services; otherwise a random 128-bit
+// hex ID is generated. The ID is stored in the request context, where
+// RequestIDFromContext reads it, and set as the X-Request-ID response header.
+//
+// Propagated IDs must be at most 128 printable ASCII characters, so that
+// clients cannot inject control characters or oversized values into logs.
+//
+// NewLoggingMiddleware includes the ID as the request_id field; place
+// NewRequestID before it in the stack.
+func NewRequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}
+}
+
+// RequestIDFromContext returns the request ID stored by NewRequestID, or
+// false if the request has none.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// newRequestID returns a random 32-character hex identifier.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b) // never returns an error
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether id is acceptable to propagate.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// requestStoreKey is the context key under which the RequestStore is stored.
+type requestStoreKey struct{}
+
+// RequestStore is a per-request key/value store. It is attached to the
+// request context once by NewRequestStore, after which any number of
+// middleware and handlers can store values in it without each allocating a
+// new context and request with context.WithValue.
+//
+// Values are accessed through typed StoreKeys. A RequestStore is safe for
+// concurrent use, so goroutines spawned by a handler may share it.
+type RequestStore struct {
+	mu     sync.RWMutex
+	values map[any]any
+}
+
+// NewRequestStore returns middleware that attaches an empty RequestStore to
+// each request's context. If the context already carries a store (for example
+// because NewRequestStore appears twice in a stack) the existing one is kept.
+// Place it at the outside of the stack so every other middleware can use it.
+func NewRequestStore() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if RequestStoreFromContext(r.Context()) == nil {
+				store := &RequestStore{values: make(map[any]any)}
+				r = r.WithContext(context.WithValue(r.Context(), requestStoreKey{}, store))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequestStoreFromContext returns the RequestStore attached to ctx by
+// NewRequestStore, or nil if there is none.
+func RequestStoreFromContext(ctx context.Context) *RequestStore {
+	store, _ := ctx.Value(requestStoreKey{}).(*RequestStore)
+	return store
+}
+
+// StoreKey identifies a value of type T in a RequestStore. Keys are compared
+// by identity, so each call to NewStoreKey creates a distinct key; declare
+// keys once as package-level variables.
+type StoreKey[T any] struct {
+	name string
+}
+
+// NewStoreKey returns a new key for values of type T. The name is used only
+// for debugging.
+func NewStoreKey[T any](name string) *StoreKey[T] {
+	return &StoreKey[T]{name: name}
+}
+
+// String returns the key's name.
+func (k *StoreKey[T]) String() string {
+	return k.name
+}
+
+// Get returns the value stored under k in the RequestStore attached to ctx,
+// and whether it was present. It returns false if ctx has no RequestStore.
+func (k *StoreKey[T]) Get(ctx context.Context) (T, bool) {
+	var zero T
+	store := RequestStoreFromContext(ctx)
+	if store == nil {
+		return zero, false
+	}
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	v, ok := store.values[k]
+	if !ok {
+		return zero, false
+	}
+	return v.(T), true
+}
+
+// Set stores value under k in the RequestStore attached to ctx. It returns
+// false, storing nothing, if ctx has no RequestStore.
+func (k *StoreKey[T]) Set(ctx context.Context, value T) bool {
+	store := RequestStoreFromContext(ctx)
+	if store == nil {
+		return false
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.values[k] = value
+	return true
+}
+
+// Delete removes the value stored under k in the RequestStore attached to ctx.
+func (k *StoreKey[T]) Delete(ctx context.Context) {
+	store := RequestStoreFromContext(ctx)
+	if store == nil {
+		return
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.values, k)
+}
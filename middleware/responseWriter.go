@@ -0,0 +1,371 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ResponseInfo describes the response written for a request.
+type ResponseInfo struct {
+	// Status is the HTTP status code sent, or 200 if the handler wrote
+	// nothing and the status was implied.
+	Status int
+	// Bytes is the number of response body bytes written by the handler.
+	Bytes int64
+	// Duration is the time elapsed since the response wrapper was created,
+	// which is when the outermost middleware that uses it received the request.
+	Duration time.Duration
+	// Hijacked reports whether the connection was taken over by the handler,
+	// for example to upgrade to a websocket.
+	Hijacked bool
+}
+
+// responseWriterKey is the context key under which the shared ResponseRecorder
+// is stored.
+type responseWriterKey struct{}
+
+// ResponseRecorder wraps http.ResponseWriter to capture the status code, the
+// number of body bytes written, whether the connection was hijacked, when the
+// request started and when the response headers were sent. Middleware in this
+// package that needs the body itself sets capture to receive a copy of it.
+//
+// A single ResponseRecorder is shared by all middleware in a stack: use
+// NewResponseRecorder rather than constructing one directly, so that logging,
+// hooks, your own middleware and others observe the same response without
+// each layering their own wrapper:
+//
+//	func countErrors(next http.Handler) http.Handler {
+//		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//			rec, r := middleware.NewResponseRecorder(w, r)
+//			next.ServeHTTP(rec.Writer(), r)
+//			if rec.Status() >= 500 {
+//				serverErrors.Add(1)
+//			}
+//		})
+//	}
+type ResponseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int64
+	hijacked   bool
+	upgrade    bool // the request asks to switch protocols
+	start      time.Time
+	headerAt   time.Time
+	capture    io.Writer
+	writer     http.ResponseWriter // returned by Writer
+}
+
+// NewResponseRecorder returns the shared ResponseRecorder for the request. If w
+// is already the shared wrapper, or its Writer, it is reused; otherwise a new
+// wrapper is created around w and stored in the returned request's context.
+// Pass the recorder's Writer and the returned request to the next handler.
+//
+// A middleware that replaces the ResponseWriter with its own (for example to
+// buffer the body) hides the shared wrapper, so middleware further in get a
+// fresh wrapper that observes the replaced writer rather than bypassing it.
+func NewResponseRecorder(w http.ResponseWriter, r *http.Request) (*ResponseRecorder, *http.Request) {
+	if rw, ok := w.(interface{ recorder() *ResponseRecorder }); ok {
+		return rw.recorder(), r
+	}
+	_, upgrade := IsUpgrade(r)
+	ww := &ResponseRecorder{ResponseWriter: w, upgrade: upgrade, start: time.Now()}
+	ww.writer = newRecorderWriter(ww)
+	return ww, r.WithContext(context.WithValue(r.Context(), responseWriterKey{}, ww))
+}
+
+// ResponseInfoFromContext returns details of the response written so far for
+// the request carrying ctx, as observed by the shared response wrapper that
+// the logging middleware, Hooks and other middleware in this package install.
+// It returns false if no such middleware wraps the request.
+//
+// The returned value is a snapshot. ResponseInfoFromContext must be called
+// from the goroutine serving the request.
+func ResponseInfoFromContext(ctx context.Context) (ResponseInfo, bool) {
+	ww, ok := ctx.Value(responseWriterKey{}).(*ResponseRecorder)
+	if !ok {
+		return ResponseInfo{}, false
+	}
+	return ww.Info(), true
+}
+
+// Info returns a snapshot of the response state. It must be called from the
+// goroutine serving the request.
+func (w *ResponseRecorder) Info() ResponseInfo {
+	return ResponseInfo{
+		Status:   w.Status(),
+		Bytes:    w.bytes,
+		Duration: time.Since(w.start),
+		Hijacked: w.hijacked,
+	}
+}
+
+// Status returns the status code sent, or 200 if none has been written.
+func (w *ResponseRecorder) Status() int {
+	if w.statusCode == 0 {
+		return http.StatusOK
+	}
+	return w.statusCode
+}
+
+// HeaderWritten reports whether the response has been started, by
+// WriteHeader or by writing the body, so an error can no longer be sent in
+// its place.
+func (w *ResponseRecorder) HeaderWritten() bool {
+	return !w.headerAt.IsZero()
+}
+
+// BytesWritten returns the number of response body bytes written so far.
+func (w *ResponseRecorder) BytesWritten() int64 {
+	return w.bytes
+}
+
+// implicitHeader records the implied 200 status when the body or a flush
+// starts the response without a WriteHeader call.
+func (w *ResponseRecorder) implicitHeader() {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+		w.headerAt = time.Now()
+	}
+}
+
+// WriteHeader implements http.ResponseWriter, recording the status code.
+func (w *ResponseRecorder) WriteHeader(statusCode int) {
+	if w.headerAt.IsZero() {
+		w.headerAt = time.Now()
+	}
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements http.ResponseWriter, counting the bytes written.
+func (w *ResponseRecorder) Write(b []byte) (int, error) {
+	w.implicitHeader()
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	if w.capture != nil {
+		w.capture.Write(b[:n])
+	}
+	return n, err
+}
+
+// Unwrap returns the underlying ResponseWriter, allowing
+// http.ResponseController to reach optional interfaces such as http.Flusher.
+func (w *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Writer returns the ResponseWriter to pass to the next handler. It records
+// the response like the ResponseRecorder itself, and implements exactly
+// those of http.Flusher, http.Hijacker, http.Pusher and io.ReaderFrom that
+// the wrapped writer does, so handlers that test for them, for server-sent
+// events, websockets or sendfile, behave as they would unwrapped. Flusher,
+// Hijacker and Pusher are also found through writers' Unwrap methods, as
+// http.ResponseController does.
+func (w *ResponseRecorder) Writer() http.ResponseWriter {
+	return w.writer
+}
+
+// recorder is implemented by every writer returned by Writer, so that
+// NewResponseRecorder can find the shared ResponseRecorder behind one.
+func (w *ResponseRecorder) recorder() *ResponseRecorder {
+	return w
+}
+
+// The optional interfaces a Writer may implement, as bits of a mask.
+const (
+	canFlush = 1 << iota
+	canHijack
+	canPush
+	canReadFrom
+)
+
+// newRecorderWriter returns the writer for w.Writer, implementing the
+// optional interfaces of the wrapped writer.
+func newRecorderWriter(w *ResponseRecorder) http.ResponseWriter {
+	var mask int
+	if _, ok := findWriter[http.Flusher](w.ResponseWriter); ok {
+		mask |= canFlush
+	}
+	if _, ok := findWriter[http.Hijacker](w.ResponseWriter); ok {
+		mask |= canHijack
+	}
+	if _, ok := findWriter[http.Pusher](w.ResponseWriter); ok {
+		mask |= canPush
+	}
+	if _, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		mask |= canReadFrom
+	}
+
+	f, h, p, rf := recorderFlusher{w}, recorderHijacker{w}, recorderPusher{w}, recorderReaderFrom{w}
+	switch mask {
+	case 0:
+		return struct{ *ResponseRecorder }{w}
+	case canFlush:
+		return struct {
+			*ResponseRecorder
+			recorderFlusher
+		}{w, f}
+	case canHijack:
+		return struct {
+			*ResponseRecorder
+			recorderHijacker
+		}{w, h}
+	case canFlush | canHijack:
+		return struct {
+			*ResponseRecorder
+			recorderFlusher
+			recorderHijacker
+		}{w, f, h}
+	case canPush:
+		return struct {
+			*ResponseRecorder
+			recorderPusher
+		}{w, p}
+	case canFlush | canPush:
+		return struct {
+			*ResponseRecorder
+			recorderFlusher
+			recorderPusher
+		}{w, f, p}
+	case canHijack | canPush:
+		return struct {
+			*ResponseRecorder
+			recorderHijacker
+			recorderPusher
+		}{w, h, p}
+	case canFlush | canHijack | canPush:
+		return struct {
+			*ResponseRecorder
+			recorderFlusher
+			recorderHijacker
+			recorderPusher
+		}{w, f, h, p}
+	case canReadFrom:
+		return struct {
+			*ResponseRecorder
+			recorderReaderFrom
+		}{w, rf}
+	case canFlush | canReadFrom:
+		return struct {
+			*ResponseRecorder
+			recorderFlusher
+			recorderReaderFrom
+		}{w, f, rf}
+	case canHijack | canReadFrom:
+		return struct {
+			*ResponseRecorder
+			recorderHijacker
+			recorderReaderFrom
+		}{w, h, rf}
+	case canFlush | canHijack | canReadFrom:
+		return struct {
+			*ResponseRecorder
+			recorderFlusher
+			recorderHijacker
+			recorderReaderFrom
+		}{w, f, h, rf}
+	case canPush | canReadFrom:
+		return struct {
+			*ResponseRecorder
+			recorderPusher
+			recorderReaderFrom
+		}{w, p, rf}
+	case canFlush | canPush | canReadFrom:
+		return struct {
+			*ResponseRecorder
+			recorderFlusher
+			recorderPusher
+			recorderReaderFrom
+		}{w, f, p, rf}
+	case canHijack | canPush | canReadFrom:
+		return struct {
+			*ResponseRecorder
+			recorderHijacker
+			recorderPusher
+			recorderReaderFrom
+		}{w, h, p, rf}
+	default:
+		return struct {
+			*ResponseRecorder
+			recorderFlusher
+			recorderHijacker
+			recorderPusher
+			recorderReaderFrom
+		}{w, f, h, p, rf}
+	}
+}
+
+// findWriter returns the first writer in w's chain of Unwrap methods that
+// implements I.
+func findWriter[I any](w http.ResponseWriter) (I, bool) {
+	for {
+		if i, ok := w.(I); ok {
+			return i, true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			var zero I
+			return zero, false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// recorderFlusher implements http.Flusher for a ResponseRecorder.
+type recorderFlusher struct{ r *ResponseRecorder }
+
+// Flush sends any buffered data to the client.
+func (f recorderFlusher) Flush() {
+	f.r.implicitHeader()
+	flusher, _ := findWriter[http.Flusher](f.r.ResponseWriter)
+	flusher.Flush()
+}
+
+// recorderHijacker implements http.Hijacker for a ResponseRecorder.
+type recorderHijacker struct{ r *ResponseRecorder }
+
+// Hijack takes over the underlying connection, recording that the response
+// was hijacked. For an upgrade request with no status written yet, it records
+// 101 Switching Protocols, which the handler writes to the connection itself.
+func (h recorderHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, _ := findWriter[http.Hijacker](h.r.ResponseWriter)
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		h.r.hijacked = true
+		if h.r.upgrade && h.r.statusCode == 0 {
+			h.r.statusCode = http.StatusSwitchingProtocols
+			h.r.headerAt = time.Now()
+		}
+	}
+	return conn, rw, err
+}
+
+// recorderPusher implements http.Pusher for a ResponseRecorder.
+type recorderPusher struct{ r *ResponseRecorder }
+
+// Push initiates an HTTP/2 server push.
+func (p recorderPusher) Push(target string, opts *http.PushOptions) error {
+	pusher, _ := findWriter[http.Pusher](p.r.ResponseWriter)
+	return pusher.Push(target, opts)
+}
+
+// recorderReaderFrom implements io.ReaderFrom for a ResponseRecorder, so
+// that io.Copy to the response can use the wrapped writer's optimizations,
+// such as sendfile.
+type recorderReaderFrom struct{ r *ResponseRecorder }
+
+// ReadFrom copies src to the response, counting the bytes written.
+func (rf recorderReaderFrom) ReadFrom(src io.Reader) (int64, error) {
+	if rf.r.capture != nil {
+		// The body must pass through Write to be captured.
+		return io.Copy(struct{ io.Writer }{rf.r}, src)
+	}
+	rf.r.implicitHeader()
+	n, err := rf.r.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	rf.r.bytes += n
+	return n, err
+}
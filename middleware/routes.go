@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// routeRule associates a path pattern with a value.
+type routeRule[T any] struct {
+	pattern string
+	value   T
+}
+
+// routeTable looks up per-route settings by request path. Patterns follow
+// http.ServeMux path conventions: a pattern ending in "/" matches every path
+// below it, any other pattern matches only that exact path, and the longest
+// matching pattern wins.
+type routeTable[T any] []routeRule[T]
+
+// newRouteTable builds a routeTable from a pattern to value map.
+func newRouteTable[T any](routes map[string]T) routeTable[T] {
+	table := make(routeTable[T], 0, len(routes))
+	for pattern, value := range routes {
+		table = append(table, routeRule[T]{pattern: pattern, value: value})
+	}
+	// Longest first, so the first match is the most specific.
+	slices.SortFunc(table, func(a, b routeRule[T]) int {
+		return cmp.Compare(len(b.pattern), len(a.pattern))
+	})
+	return table
+}
+
+// lookup returns the value of the most specific pattern matching path.
+func (t routeTable[T]) lookup(path string) (T, bool) {
+	for _, rule := range t {
+		if path == rule.pattern ||
+			strings.HasSuffix(rule.pattern, "/") && strings.HasPrefix(path, rule.pattern) {
+			return rule.value, true
+		}
+	}
+	var zero T
+	return zero, false
+}
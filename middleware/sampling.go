@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/harrydayexe/GoWebUtilities/logging"
+)
+
+// defaultMaxBodyBytes is the default limit on body bytes recorded per request.
+const defaultMaxBodyBytes = 4096
+
+// LogSamplingConfig controls which requests NewDetailedLogging logs in detail.
+type LogSamplingConfig struct {
+	// Every logs 1 in Every requests in detail, chosen at random, on routes
+	// without an entry in Routes. Zero disables sampling.
+	Every int
+	// Routes overrides Every for individual routes, using http.ServeMux path
+	// conventions: a pattern ending in "/" matches every path below it, and
+	// the longest matching pattern wins. Zero disables sampling for the route.
+	Routes map[string]int
+	// TriggerHeader, if set, names a request header that causes a request to
+	// be logged in detail whenever it is present with a non-empty value,
+	// for example "X-Debug-Log".
+	TriggerHeader string
+	// MaxBodyBytes limits how many bytes of each request and response body
+	// are logged. Defaults to 4096.
+	MaxBodyBytes int
+}
+
+// LogSampler decides which requests are logged in detail. The configuration
+// can be replaced at any time with Set, so detailed logging can be turned up
+// for live debugging without restarting. A LogSampler is safe for concurrent use.
+type LogSampler struct {
+	state atomic.Pointer[logSamplingState]
+}
+
+// logSamplingState is an immutable snapshot of a LogSampler's configuration.
+type logSamplingState struct {
+	cfg    LogSamplingConfig
+	routes routeTable[int]
+}
+
+// NewLogSampler returns a LogSampler with the given configuration.
+func NewLogSampler(cfg LogSamplingConfig) *LogSampler {
+	s := &LogSampler{}
+	s.Set(cfg)
+	return s
+}
+
+// Set replaces the sampler's configuration.
+func (s *LogSampler) Set(cfg LogSamplingConfig) {
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	s.state.Store(&logSamplingState{cfg: cfg, routes: newRouteTable(cfg.Routes)})
+}
+
+// Sample reports whether r should be logged in detail.
+func (s *LogSampler) Sample(r *http.Request) bool {
+	return s.state.Load().sample(r)
+}
+
+// sample implements Sample against a single configuration snapshot.
+func (st *logSamplingState) sample(r *http.Request) bool {
+	if st.cfg.TriggerHeader != "" && r.Header.Get(st.cfg.TriggerHeader) != "" {
+		return true
+	}
+	every, ok := st.routes.lookup(r.URL.Path)
+	if !ok {
+		every = st.cfg.Every
+	}
+	return every > 0 && rand.IntN(every) == 0
+}
+
+// NewDetailedLogging returns middleware that logs a "request detail" record
+// for requests chosen by sampler, in addition to the compact line written by
+// NewLoggingMiddleware. The record includes the request and response headers,
+// the first MaxBodyBytes of the request body read by the handler and of the
+// response body written, the status, the time to the response headers and the
+// total duration. Authorization, Proxy-Authorization, Cookie and Set-Cookie
+// header values are redacted. Requests that are not sampled pass through with
+// no overhead beyond the sampling decision.
+//
+// Detailed records may contain personal data from request and response
+// bodies; enable sampling with care in production.
+func NewDetailedLogging(logger *slog.Logger, sampler *LogSampler) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			st := sampler.state.Load()
+			if !st.sample(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			wrapped, r := NewResponseRecorder(w, r)
+			reqBody := &cappedBuffer{limit: st.cfg.MaxBodyBytes}
+			respBody := &cappedBuffer{limit: st.cfg.MaxBodyBytes}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &teeReadCloser{ReadCloser: r.Body, w: reqBody}
+			}
+			prevCapture := wrapped.capture
+			wrapped.capture = respBody
+			if prevCapture != nil {
+				wrapped.capture = io.MultiWriter(prevCapture, respBody)
+			}
+
+			next.ServeHTTP(wrapped.Writer(), r)
+
+			wrapped.capture = prevCapture
+			info := wrapped.Info()
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("query", r.URL.RawQuery),
+				slog.Int("status", info.Status),
+				slog.Duration("duration", info.Duration),
+				slog.Group("request",
+					slog.Any("headers", redactHeaders(r.Header)),
+					slog.String("body", reqBody.String()),
+					slog.Bool("body_truncated", reqBody.truncated),
+				),
+				slog.Group("response",
+					slog.Any("headers", redactHeaders(wrapped.Header())),
+					slog.String("body", respBody.String()),
+					slog.Bool("body_truncated", respBody.truncated),
+					slog.Int64("bytes", info.Bytes),
+				),
+			}
+			if !wrapped.headerAt.IsZero() {
+				attrs = append(attrs, slog.Duration("time_to_headers", wrapped.headerAt.Sub(wrapped.start)))
+			}
+			attrs = append(attrs, RequestAttrs(r.Context())...)
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "request detail", attrs...)
+		})
+	}
+}
+
+// redactHeaders returns the headers as a map of comma-joined values, with the
+// values of headers logging.IsSecretName matches replaced.
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		out[name] = strings.Join(values, ", ")
+		if logging.IsSecretName(name) {
+			out[name] = "[REDACTED]"
+		}
+	}
+	return out
+}
+
+// cappedBuffer records the first limit bytes written to it and discards the
+// rest, noting that it did so. Writes never fail.
+type cappedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.Buffer.Write(p[:max(room, 0)])
+		b.truncated = true
+	} else {
+		b.Buffer.Write(p)
+	}
+	return len(p), nil
+}
+
+// teeReadCloser copies everything read from the ReadCloser to w.
+type teeReadCloser struct {
+	io.ReadCloser
+	w io.Writer
+}
+
+func (t *teeReadCloser) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.w.Write(p[:n])
+	}
+	return n, err
+}
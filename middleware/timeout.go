@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+)
+
+// NewTimeout returns middleware that limits each request to d. The handler
+// runs with a context that expires after d; if it has not finished by then,
+// the client is answered with 504 Gateway Timeout, unless the handler had
+// already started the response, in which case the response is cut short.
+// Either way, writes the handler makes after the deadline are discarded and
+// return http.ErrHandlerTimeout, so a slow handler cannot corrupt the
+// response or trigger superfluous WriteHeader calls.
+//
+// If d is zero, the timeout is read from the HandlerTimeout of the
+// config.ServerConfig attached to the request by the server package
+// (HANDLER_TIMEOUT); requests without one, or with HandlerTimeout zero, are
+// passed through unchanged.
+//
+// Upgrade requests, such as websocket handshakes, are passed through too: the
+// connection outlives the handler's usual budget.
+//
+// Unlike http.TimeoutHandler, the response is not buffered, so streaming
+// handlers keep working. The handler runs on its own goroutine, and a panic
+// in it is re-raised with the same value on the serving goroutine, so
+// NewRecovery and httpabort work outside NewTimeout. The handler should stop
+// promptly once its context is done; NewTimeout does not wait for it.
+func NewTimeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := d
+			if timeout <= 0 {
+				cfg, _ := config.FromContext(r.Context())
+				timeout = time.Duration(cfg.HandlerTimeout) * time.Second
+			}
+			if _, upgrade := IsUpgrade(r); timeout <= 0 || upgrade {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			tw := &timeoutWriter{w: w, h: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+						return
+					}
+					close(done)
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+			}()
+
+			select {
+			case <-done:
+				tw.WriteHeader(http.StatusOK) // send headers set without a body
+			case p := <-panicked:
+				tw.expire(false)
+				panic(p)
+			case <-ctx.Done():
+				select {
+				case <-done:
+				default:
+					tw.expire(true)
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter guards the ResponseWriter of a handler run by NewTimeout. The
+// handler writes its headers to its own map, which is copied to the real
+// writer when the response starts, so headers can be written on timeout
+// without racing the handler.
+type timeoutWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	mu          sync.Mutex
+	wroteHeader bool
+	expired     bool
+}
+
+// Header implements http.ResponseWriter.
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeaderLocked(code)
+}
+
+// writeHeaderLocked sends the handler's headers unless the response has
+// started or expired.
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	if tw.expired || tw.wroteHeader {
+		return
+	}
+	if code >= 100 && code <= 199 && code != http.StatusSwitchingProtocols {
+		// Informational responses may be followed by the final one.
+		copyHeader(tw.w.Header(), tw.h)
+		tw.w.WriteHeader(code)
+		return
+	}
+	tw.wroteHeader = true
+	copyHeader(tw.w.Header(), tw.h)
+	tw.w.WriteHeader(code)
+}
+
+// Write implements http.ResponseWriter.
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	return tw.w.Write(b)
+}
+
+// Flush implements http.Flusher.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired {
+		return
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	http.NewResponseController(tw.w).Flush()
+}
+
+// expire stops the handler's further writes, answering 504 if the response
+// has not started and respond is true.
+func (tw *timeoutWriter) expire(respond bool) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.expired = true
+	if respond && !tw.wroteHeader {
+		http.Error(tw.w, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+	}
+}
+
+// copyHeader replaces the values in dst with those in src.
+func copyHeader(dst, src http.Header) {
+	for k, v := range src {
+		dst[k] = slices.Clone(v)
+	}
+}
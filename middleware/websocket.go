@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// IsUpgrade reports whether r asks to switch to another protocol, with an
+// Upgrade header and "upgrade" among its Connection options, and returns
+// the protocol requested, lower-cased, such as "websocket".
+func IsUpgrade(r *http.Request) (string, bool) {
+	upgrade := r.Header.Get("Upgrade")
+	if upgrade == "" {
+		return "", false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for option := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(option), "upgrade") {
+				protocol, _, _ := strings.Cut(upgrade, ",")
+				return strings.ToLower(strings.TrimSpace(protocol)), true
+			}
+		}
+	}
+	return "", false
+}
+
+// NewWebSocket returns middleware for websocket endpoints, placed innermost
+// around the handler that calls a websocket library's upgrade function, so
+// the endpoint can sit behind the logging, auth and other middleware:
+//
+//	upgrader := websocket.Upgrader{} // github.com/gorilla/websocket
+//	mux.Handle("GET /ws", middleware.NewWebSocket(logger)(http.HandlerFunc(
+//	    func(w http.ResponseWriter, r *http.Request) {
+//	        conn, err := upgrader.Upgrade(w, r, nil)
+//	        if err != nil {
+//	            return // the upgrader has already answered
+//	        }
+//	        defer conn.Close()
+//	        // ...
+//	    })))
+//
+// github.com/coder/websocket (formerly nhooyr.io/websocket) plugs in the
+// same way with websocket.Accept(w, r, nil).
+//
+// Requests that are not websocket upgrades are answered with 426 Upgrade
+// Required. If no writer in the chain can be hijacked, because some
+// middleware in front hides http.Hijacker, it logs an ERROR naming the
+// problem and answers 500, rather than leaving the library to fail with a
+// less helpful error. HTTP/2 requests cannot be upgraded this way.
+//
+// The shared ResponseRecorder records a hijacked upgrade as 101 Switching
+// Protocols, so the logging middleware reports websocket sessions correctly,
+// with their whole duration. NewTimeout, NewEnvelope and NewUnwrapEnvelope
+// pass upgrade requests through unchanged.
+func NewWebSocket(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if protocol, ok := IsUpgrade(r); !ok || protocol != "websocket" {
+				w.Header().Set("Connection", "Upgrade")
+				w.Header().Set("Upgrade", "websocket")
+				http.Error(w, http.StatusText(http.StatusUpgradeRequired), http.StatusUpgradeRequired)
+				return
+			}
+			if _, ok := findWriter[http.Hijacker](w); !ok {
+				logger.ErrorContext(r.Context(), "websocket upgrade impossible: response writer cannot be hijacked",
+					slog.String("path", r.URL.Path),
+					slog.String("proto", r.Proto))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// Package policy selects security defaults by environment, so that every
+// project gets the same CORS, security header, cookie and debug endpoint
+// settings without configuring each one: permissive in Local, where a front
+// end on another port must reach the API over plain HTTP, and strict in
+// Production.
+//
+// Preset returns the built-in Policy for a config.Environment, and For
+// passes it to a single override function first, where a project records
+// its exceptions:
+//
+//	p := policy.For(cfg.Environment, func(p *policy.Policy) {
+//	    p.CORS.AllowedOrigins = append(p.CORS.AllowedOrigins, "https://admin.example.com")
+//	})
+//	mux.Handle("GET /debug/state", p.Debug(stateHandler))
+//	handler := middleware.CreateStack(p.Middleware(), middleware.NewLoggingMiddleware(logger))(mux)
+//
+// Middleware sets the security headers and handles CORS, SetCookie enforces
+// the cookie flags, and Debug disables debug handlers where the policy does
+// not allow them.
+package policy
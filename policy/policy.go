@@ -0,0 +1,150 @@
+package policy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+)
+
+// Policy is the set of security defaults for one environment.
+type Policy struct {
+	// Environment is the environment the preset was chosen for.
+	Environment config.Environment
+	// CORS configures cross-origin requests. With no AllowedOrigins, CORS
+	// headers are never sent and only same-origin scripts can read
+	// responses.
+	CORS middleware.CORSOptions
+	// Headers are the security response headers set on every response.
+	Headers middleware.SecurityHeadersOptions
+	// Cookies are the flags enforced on cookies set with SetCookie.
+	Cookies CookiePolicy
+	// DebugEndpoints enables the handlers wrapped with Debug.
+	DebugEndpoints bool
+}
+
+// CookiePolicy is the set of flags SetCookie enforces.
+type CookiePolicy struct {
+	// Secure restricts cookies to HTTPS.
+	Secure bool
+	// HTTPOnly hides cookies from scripts.
+	HTTPOnly bool
+	// SameSite is used for cookies that do not set their own.
+	SameSite http.SameSite
+}
+
+// Preset returns the built-in policy for env:
+//
+//   - Local is permissive for development: pages served over HTTP from
+//     localhost, on any port, may make credentialed cross-origin requests
+//     with any headers, cookies work over plain HTTP, and debug endpoints
+//     are enabled. Only headers that do not get in the
+//     way, such as X-Content-Type-Options, are set.
+//   - Production is strict: no cross-origin access, HSTS for two years
+//     including subdomains, a same-origin Content-Security-Policy, framing
+//     denied, no referrer, Secure and HttpOnly cookies, and debug endpoints
+//     disabled.
+//   - Test is Production with debug endpoints enabled, so that staging
+//     behaves like production.
+//
+// Any other environment gets Production's policy, to fail safe.
+func Preset(env config.Environment) Policy {
+	if env == config.Local {
+		return Policy{
+			Environment: env,
+			CORS: middleware.CORSOptions{
+				// Only pages served from this machine, such as a front end's
+				// development server, so that a deployment that forgot to
+				// set ENVIRONMENT does not open up to every website.
+				AllowedOrigins: []string{"http://localhost:*", "http://127.0.0.1:*", "http://[::1]:*"},
+				AllowedMethods: []string{
+					http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+					http.MethodPatch, http.MethodDelete, http.MethodOptions,
+				},
+				AllowedHeaders:   []string{"*"},
+				AllowCredentials: true,
+			},
+			Headers: middleware.SecurityHeadersOptions{
+				NoSniff:        true,
+				FrameOptions:   "SAMEORIGIN",
+				ReferrerPolicy: "strict-origin-when-cross-origin",
+			},
+			Cookies:        CookiePolicy{HTTPOnly: true, SameSite: http.SameSiteLaxMode},
+			DebugEndpoints: true,
+		}
+	}
+	p := Policy{
+		Environment: env,
+		Headers: middleware.SecurityHeadersOptions{
+			HSTSMaxAge:              2 * 365 * 24 * time.Hour,
+			HSTSIncludeSubdomains:   true,
+			ContentSecurityPolicy:   "default-src 'self'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'",
+			FrameOptions:            "DENY",
+			NoSniff:                 true,
+			ReferrerPolicy:          "no-referrer",
+			CrossOriginOpenerPolicy: "same-origin",
+		},
+		Cookies: CookiePolicy{Secure: true, HTTPOnly: true, SameSite: http.SameSiteLaxMode},
+	}
+	if env == config.Test {
+		p.DebugEndpoints = true
+	}
+	return p
+}
+
+// For returns the preset for env after passing it to override, if not nil.
+// The override is the single place a project adjusts the defaults, such as
+// allowing its front end's origin in production:
+//
+//	p := policy.For(cfg.Environment, func(p *policy.Policy) {
+//	    if p.Environment == config.Production {
+//	        p.CORS.AllowedOrigins = []string{"https://app.example.com"}
+//	    }
+//	})
+func For(env config.Environment, override func(*Policy)) Policy {
+	p := Preset(env)
+	if override != nil {
+		override(&p)
+	}
+	return p
+}
+
+// Middleware returns middleware setting p's security headers and, if p
+// allows any origin, handling CORS. Apply it outermost, so that CORS
+// preflight requests are answered before authentication.
+func (p Policy) Middleware() middleware.Middleware {
+	mws := []middleware.Middleware{middleware.NewSecurityHeaders(p.Headers)}
+	if len(p.CORS.AllowedOrigins) > 0 {
+		mws = append(mws, middleware.NewCORS(p.CORS))
+	}
+	return middleware.CreateStack(mws...)
+}
+
+// Cookie applies p's cookie flags to c: Secure and HttpOnly are set if the
+// policy requires them, and SameSite if c does not set its own.
+func (p Policy) Cookie(c *http.Cookie) {
+	c.Secure = c.Secure || p.Cookies.Secure
+	c.HttpOnly = c.HttpOnly || p.Cookies.HTTPOnly
+	if c.SameSite == 0 {
+		c.SameSite = p.Cookies.SameSite
+	}
+}
+
+// SetCookie applies p's cookie flags to c and adds it to w's headers.
+func (p Policy) SetCookie(w http.ResponseWriter, c *http.Cookie) {
+	p.Cookie(c)
+	http.SetCookie(w, c)
+}
+
+// Debug returns h if p enables debug endpoints, and otherwise a handler
+// answering 404 Not Found, so that debug routes can be registered
+// unconditionally:
+//
+//	mux.Handle("GET /debug/state", p.Debug(stateHandler))
+func (p Policy) Debug(h http.Handler) http.Handler {
+	if p.DebugEndpoints {
+		return h
+	}
+	return http.NotFoundHandler()
+}
@@ -0,0 +1,138 @@
+package policy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+)
+
+// serve passes a cross-origin request through p's middleware and returns the
+// response.
+func serve(p Policy, method, origin string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", nil)
+	req.Header.Set("Origin", origin)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	p.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(w, req)
+	return w
+}
+
+func TestPreset_Middleware(t *testing.T) {
+	tests := []struct {
+		env       config.Environment
+		allowCORS string
+		hsts      bool
+		frame     string
+	}{
+		{config.Local, "http://localhost:3000", false, "SAMEORIGIN"},
+		{config.Test, "", true, "DENY"},
+		{config.Production, "", true, "DENY"},
+		{"unknown", "", true, "DENY"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.env), func(t *testing.T) {
+			w := serve(Preset(tt.env), http.MethodGet, "http://localhost:3000", nil)
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowCORS {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowCORS)
+			}
+			if got := w.Header().Get("Strict-Transport-Security") != ""; got != tt.hsts {
+				t.Errorf("Strict-Transport-Security set = %v, want %v", got, tt.hsts)
+			}
+			if got := w.Header().Get("X-Frame-Options"); got != tt.frame {
+				t.Errorf("X-Frame-Options = %q, want %q", got, tt.frame)
+			}
+			if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+			}
+		})
+	}
+
+	t.Run("local preflight", func(t *testing.T) {
+		w := serve(Preset(config.Local), http.MethodOptions, "http://127.0.0.1:8081", map[string]string{
+			"Access-Control-Request-Method":  "DELETE",
+			"Access-Control-Request-Headers": "X-Custom",
+		})
+		if w.Code != http.StatusNoContent {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+		}
+	})
+
+	t.Run("local rejects other websites", func(t *testing.T) {
+		w := serve(Preset(config.Local), http.MethodGet, "https://evil.example", nil)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("Access-Control-Allow-Origin = %q, want none", got)
+		}
+	})
+}
+
+func TestFor(t *testing.T) {
+	p := For(config.Production, func(p *Policy) {
+		p.CORS.AllowedOrigins = []string{"https://app.example.com"}
+		p.Headers.ContentSecurityPolicy = ""
+	})
+	w := serve(p, http.MethodGet, "https://app.example.com", nil)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the overridden origin", got)
+	}
+	if got := w.Header().Get("Content-Security-Policy"); got != "" {
+		t.Errorf("Content-Security-Policy = %q, want it removed", got)
+	}
+	if Preset(config.Production).CORS.AllowedOrigins != nil {
+		t.Error("override changed the preset")
+	}
+	if got := For(config.Local, nil); !got.DebugEndpoints {
+		t.Error("For with no override: debug endpoints disabled, want the Local preset")
+	}
+}
+
+func TestPolicy_SetCookie(t *testing.T) {
+	tests := []struct {
+		env      config.Environment
+		cookie   http.Cookie
+		secure   bool
+		sameSite http.SameSite
+	}{
+		{config.Local, http.Cookie{Name: "s", Value: "1"}, false, http.SameSiteLaxMode},
+		{config.Production, http.Cookie{Name: "s", Value: "1"}, true, http.SameSiteLaxMode},
+		{config.Production, http.Cookie{Name: "s", Value: "1", SameSite: http.SameSiteStrictMode}, true, http.SameSiteStrictMode},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		Preset(tt.env).SetCookie(w, &tt.cookie)
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("%s: got %d cookies, want 1", tt.env, len(cookies))
+		}
+		c := cookies[0]
+		if c.Secure != tt.secure || !c.HttpOnly || c.SameSite != tt.sameSite {
+			t.Errorf("%s: cookie %q has Secure=%v HttpOnly=%v SameSite=%v, want Secure=%v HttpOnly=true SameSite=%v",
+				tt.env, w.Header().Get("Set-Cookie"), c.Secure, c.HttpOnly, c.SameSite, tt.secure, tt.sameSite)
+		}
+	}
+}
+
+func TestPolicy_Debug(t *testing.T) {
+	debug := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	for env, want := range map[config.Environment]int{
+		config.Local:      http.StatusOK,
+		config.Test:       http.StatusOK,
+		config.Production: http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		Preset(env).Debug(debug).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug", nil))
+		if w.Code != want {
+			t.Errorf("%s: status = %d, want %d", env, w.Code, want)
+		}
+	}
+}
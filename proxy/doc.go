@@ -0,0 +1,57 @@
+// Package proxy provides reverse proxy building blocks for simple gateways.
+//
+// NewUpstream returns a handler that forwards requests to a set of
+// upstream servers in turn, answering failures with 502 (504 on timeout)
+// problem details:
+//
+//	api, err := proxy.NewUpstream(targets, proxy.UpstreamOptions{})
+//	mux.Handle("/api/", http.StripPrefix("/api", api))
+//
+// With UpstreamOptions.Affinity, clients stick to one target, by cookie or by
+// consistent hashing of a key such as the client IP address. SetTargets
+// changes the targets at runtime, moving only the clients of removed ones,
+// and Stats counts those affinity breaks.
+//
+// Streamed responses, such as server-sent events and chunked bodies, are
+// passed on as the upstream writes them; FlushInterval extends this to
+// bodies with a Content-Length, and BufferSize bounds the pooled copy
+// buffers. The logging, compression and other middleware of this module
+// flush through, so they do not hold streamed responses back.
+//
+// Websocket handshakes, and other protocol upgrades, are forwarded too: once
+// the target switches protocols, the two connections are copied in both
+// directions until either side closes. http.Server.Shutdown leaves upgraded
+// connections open, so gateways close them by cancelling
+// UpstreamOptions.Context, for example from a server.WithShutdownHook:
+//
+//	wsCtx, closeSessions := context.WithCancel(context.Background())
+//	h, err := cfg.Handler(proxy.HandlerOptions{Context: wsCtx})
+//	// ...
+//	server.Run(ctx, h, server.WithShutdownHook("websockets", 0,
+//	    func(context.Context) error { closeSessions(); return nil }))
+//
+// A gateway can instead be configured without code changes from a route
+// file, a JSON document listing each route's method and path, its upstreams
+// or a static response, a timeout and which middleware to apply:
+//
+//	{"routes": [
+//	  {"method": "GET", "path": "/healthz", "static": {"body": "ok\n"}},
+//	  {"path": "/api/", "upstreams": ["http://10.0.0.1:8080"], "stripPrefix": "/api",
+//	   "timeout": "5s", "middleware": {"requestId": true, "logging": true}}
+//	]}
+//
+// LoadConfigFile reads and validates the file and Config.Handler builds the
+// handler tree, ready for server.Run:
+//
+//	cfg, err := proxy.LoadConfigFile("routes.json")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	h, err := cfg.Handler(proxy.HandlerOptions{})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	server.Run(ctx, h)
+//
+// Route files are JSON only; the module has no YAML dependency.
+package proxy
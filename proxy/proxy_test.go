@@ -0,0 +1,489 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+	"github.com/harrydayexe/GoWebUtilities/scalar"
+)
+
+var discard = slog.New(slog.DiscardHandler)
+
+// newBackend returns a server answering with name and the request path.
+func newBackend(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name+" "+r.URL.Path+" "+r.Header.Get("X-Forwarded-Host"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, h http.Handler, method, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+func TestUpstream_RoundRobin(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	targets := []*url.URL{mustParse(t, a.URL), mustParse(t, b.URL+"/base")}
+	up, err := NewUpstream(targets, UpstreamOptions{Logger: discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for range 3 {
+		got = append(got, get(t, up, "GET", "http://gw.example/x").Body.String())
+	}
+	want := []string{"a /x gw.example", "b /base/x gw.example", "a /x gw.example"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("response %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestUpstream_Errors(t *testing.T) {
+	if _, err := NewUpstream(nil, UpstreamOptions{}); err == nil {
+		t.Error("NewUpstream(nil) = nil error")
+	}
+	if _, err := NewUpstream([]*url.URL{{Path: "/relative"}}, UpstreamOptions{}); err == nil {
+		t.Error("NewUpstream(relative) = nil error")
+	}
+
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	up, _ := NewUpstream([]*url.URL{mustParse(t, dead.URL)}, UpstreamOptions{Logger: discard})
+	rec := get(t, up, "GET", "/")
+	if rec.Code != http.StatusBadGateway || rec.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("got %d %q, want 502 problem details", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig(strings.NewReader(`{"routes":[
+		{"method":"GET","path":"/healthz","static":{"body":"ok"}},
+		{"path":"/api/","upstreams":["http://localhost:1"],"timeout":"PT5S","middleware":{"logging":true}}
+	]}`))
+	if err != nil {
+		t.Fatalf("LoadConfig = %v", err)
+	}
+	if len(cfg.Routes) != 2 || time.Duration(cfg.Routes[1].Timeout) != 5*time.Second || !cfg.Routes[1].Middleware.Logging {
+		t.Errorf("LoadConfig = %+v", cfg)
+	}
+
+	for _, doc := range []string{
+		`{"routes":[{"path":"/","static":{},"extra":1}]}`,
+		`{"routes":[{"path":"nope","static":{}}]}`,
+		`{"routes":[{"path":"/"}]}`,
+		`{"routes":[{"path":"/","static":{},"upstreams":["http://a"]}]}`,
+		`{"routes":[{"path":"/","upstreams":["ftp://a"]}]}`,
+		`{"routes":[{"path":"/","static":{},"stripPrefix":"/a"}]}`,
+		`{"routes":[{"path":"/","static":{"status":42}}]}`,
+		`{"routes":[{"path":"/","static":{},"timeout":"-1s"}]}`,
+		`{"routes":[{"path":"/","upstreams":["http://a"],"affinity":"sticky"}]}`,
+		`{"routes":[{"path":"/","static":{},"affinity":"cookie"}]}`,
+	} {
+		if _, err := LoadConfig(strings.NewReader(doc)); err == nil {
+			t.Errorf("LoadConfig(%s) = nil error", doc)
+		}
+	}
+}
+
+func TestConfig_Handler(t *testing.T) {
+	backend := newBackend(t, "api")
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+
+	cfg := &Config{Routes: []Route{
+		{Method: "GET", Path: "/healthz", Static: &Static{Status: 202, Headers: map[string]string{"X-Gateway": "1"}, Body: "ok"}},
+		{Path: "/api/", Upstreams: []string{backend.URL}, StripPrefix: "/api", Middleware: Middleware{RequestID: true}},
+		{Path: "/slow", Upstreams: []string{slow.URL}, Timeout: scalar.Duration(10 * time.Millisecond)},
+		{Path: "/upload", Upstreams: []string{backend.URL}, Middleware: Middleware{MaxBodySize: 8, BufferBody: true}},
+	}}
+	h, err := cfg.Handler(HandlerOptions{Logger: discard})
+	if err != nil {
+		t.Fatalf("Handler = %v", err)
+	}
+
+	rec := get(t, h, "GET", "/healthz")
+	if rec.Code != 202 || rec.Body.String() != "ok" || rec.Header().Get("X-Gateway") != "1" {
+		t.Errorf("static route: %d %q %v", rec.Code, rec.Body, rec.Header())
+	}
+	if rec := get(t, h, "POST", "/healthz"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST static route = %d, want 405", rec.Code)
+	}
+	rec = get(t, h, "GET", "http://gw.example/api/users")
+	if rec.Body.String() != "api /users gw.example" || rec.Header().Get("X-Request-ID") == "" {
+		t.Errorf("upstream route: %q, request ID %q", rec.Body, rec.Header().Get("X-Request-ID"))
+	}
+	if rec := get(t, h, "GET", "/slow"); rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("timed out route = %d, want 504", rec.Code)
+	}
+	for body, want := range map[string]int{"12345678": http.StatusOK, "123456789": http.StatusRequestEntityTooLarge} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/upload", strings.NewReader(body)))
+		if rec.Code != want {
+			t.Errorf("upload of %d bytes = %d, want %d", len(body), rec.Code, want)
+		}
+	}
+	if rec := get(t, h, "GET", "/other"); rec.Code != http.StatusNotFound {
+		t.Errorf("unrouted = %d, want 404", rec.Code)
+	}
+}
+
+func TestConfig_HandlerConflict(t *testing.T) {
+	cfg := &Config{Routes: []Route{
+		{Path: "/a", Static: &Static{}},
+		{Path: "/a", Static: &Static{}},
+	}}
+	if _, err := cfg.Handler(HandlerOptions{}); err == nil {
+		t.Error("Handler with duplicate routes = nil error")
+	}
+}
+
+func mustParse(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestUpstream_CookieAffinity(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	up, err := NewUpstream([]*url.URL{mustParse(t, a.URL), mustParse(t, b.URL)}, UpstreamOptions{Affinity: AffinityCookie, Logger: discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		up.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(nil)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "upstream" || strings.Contains(cookies[0].Value, "127.0.0.1") {
+		t.Fatalf("cookies = %v, want an opaque upstream cookie", cookies)
+	}
+	first := rec.Body.String()
+	for range 3 {
+		rec := serve(cookies[0])
+		if rec.Body.String() != first || len(rec.Result().Cookies()) != 0 {
+			t.Fatalf("sticky client moved from %q to %q", first, rec.Body)
+		}
+	}
+
+	// Remove the client's target: it is moved to the other and counted.
+	remaining := b.URL
+	if strings.HasPrefix(first, "b") {
+		remaining = a.URL
+	}
+	if err := up.SetTargets([]*url.URL{mustParse(t, remaining)}); err != nil {
+		t.Fatal(err)
+	}
+	rec = serve(cookies[0])
+	if rec.Body.String() == first || len(rec.Result().Cookies()) != 1 {
+		t.Errorf("after removal got %q with cookies %v", rec.Body, rec.Result().Cookies())
+	}
+	serve(&http.Cookie{Name: "upstream", Value: "unknown"})
+	if s := up.Stats(); s.AffinityBreaks != 1 || s.Targets != 1 || s.Requests != 6 {
+		t.Errorf("Stats = %+v, want 1 break over 6 requests", s)
+	}
+}
+
+func TestUpstream_HashAffinity(t *testing.T) {
+	var backends []*url.URL
+	for _, name := range []string{"a", "b", "c"} {
+		backends = append(backends, mustParse(t, newBackend(t, name).URL))
+	}
+	up, err := NewUpstream(backends, UpstreamOptions{
+		Affinity:    AffinityHash,
+		AffinityKey: func(r *http.Request) string { return r.Header.Get("X-User") },
+		Logger:      discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := func() map[string]string {
+		got := map[string]string{}
+		for i := range 60 {
+			user := strconv.Itoa(i)
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("X-User", user)
+			rec := httptest.NewRecorder()
+			up.ServeHTTP(rec, req)
+			got[user] = rec.Body.String()[:1]
+		}
+		return got
+	}
+
+	before := route()
+	if again := route(); !maps.Equal(before, again) {
+		t.Fatal("hash affinity is not stable")
+	}
+	if err := up.SetTargets(backends[:2]); err != nil { // remove c
+		t.Fatal(err)
+	}
+	moved := 0
+	for user, target := range route() {
+		if before[user] == "c" {
+			moved++
+		} else if target != before[user] {
+			t.Errorf("user %s moved from %s to %s though its target remains", user, before[user], target)
+		}
+		if target == "c" {
+			t.Errorf("user %s still routed to removed target", user)
+		}
+	}
+	if moved == 0 || up.Stats().AffinityBreaks != int64(moved) {
+		t.Errorf("AffinityBreaks = %d, want %d", up.Stats().AffinityBreaks, moved)
+	}
+}
+
+// TestUpstream_RemovedBounded verifies that the removed targets remembered
+// for counting affinity breaks do not grow as targets churn.
+func TestUpstream_RemovedBounded(t *testing.T) {
+	target := func(i int) *url.URL {
+		return &url.URL{Scheme: "http", Host: "10.0.0." + strconv.Itoa(i)}
+	}
+	up, err := NewUpstream([]*url.URL{target(0)}, UpstreamOptions{Logger: discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 100; i++ {
+		if err := up.SetTargets([]*url.URL{target(0), target(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(up.removed) != 1 || !up.wasRemoved(targetID(target(99))) {
+		t.Errorf("removed = %v, want only the target removed last", up.removed)
+	}
+	// Adding a target keeps the latest removal.
+	if err := up.SetTargets([]*url.URL{target(0), target(100), target(101)}); err != nil {
+		t.Fatal(err)
+	}
+	if !up.wasRemoved(targetID(target(99))) {
+		t.Error("adding a target forgot the latest removal")
+	}
+}
+
+// TestConfig_HandlerStreaming verifies that streamed upstream responses reach
+// the client as they are produced, through the logging, compression and
+// canary wrappers, rather than being buffered until the upstream finishes.
+func TestConfig_HandlerStreaming(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		w.Header().Set("Content-Length", r.URL.Query().Get("length"))
+		io.WriteString(w, "first\n")
+		http.NewResponseController(w).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		io.WriteString(w, "second\n")
+	}))
+	t.Cleanup(backend.Close)
+
+	all := Middleware{RequestID: true, Logging: true, Recovery: true, Compression: true}
+	cfg := &Config{Routes: []Route{
+		// Events and bodies of unknown length are flushed at once without a
+		// FlushInterval; bodies of known length need one.
+		{Path: "/events", Upstreams: []string{backend.URL}, Middleware: all},
+		{Path: "/chunks", Upstreams: []string{backend.URL}, Middleware: all},
+		{Path: "/sized", Upstreams: []string{backend.URL}, FlushInterval: -1, BufferSize: 64, Middleware: all},
+	}}
+	h, err := cfg.Handler(HandlerOptions{Logger: discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	canary := middleware.NewCanary(h, middleware.CanaryOptions{Weight: 50})
+	gateway := httptest.NewServer(canary.Apply(h))
+	t.Cleanup(gateway.Close)
+
+	for _, target := range []string{"/events?type=text/event-stream", "/chunks?type=text/plain", "/sized?type=text/plain&length=13"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, "GET", gateway.URL+target, nil)
+		var r *bufio.Reader
+		got := make(chan string, 1)
+		go func() {
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				got <- err.Error()
+				return
+			}
+			r = bufio.NewReader(resp.Body)
+			line, _ := r.ReadString('\n')
+			got <- line
+		}()
+		select {
+		case line := <-got:
+			if line != "first\n" {
+				t.Errorf("%s: first line = %q", target, line)
+			}
+		case <-time.After(2 * time.Second):
+			cancel() // lets the upstream handler return
+			t.Fatalf("%s: first line not streamed before the upstream finished", target)
+		}
+		release <- struct{}{}
+		if rest, _ := io.ReadAll(r); string(rest) != "second\n" {
+			t.Errorf("%s: rest = %q", target, rest)
+		}
+		cancel()
+	}
+	if s := canary.Stats(); s.Stable.Requests+s.Canary.Requests != 3 {
+		t.Errorf("canary stats = %+v, want 3 requests", s)
+	}
+}
+
+// newEchoBackend returns a server that accepts websocket handshakes and
+// echoes the upgraded connection until the client closes its side.
+func newEchoBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if protocol, ok := middleware.IsUpgrade(r); !ok || protocol != "websocket" {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+			"X-Backend-Path: " + r.URL.Path + "\r\n\r\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// dialUpgrade sends a websocket handshake for path to srv and returns the
+// connection and the response.
+func dialUpgrade(t *testing.T, srv *httptest.Server, path string) (*net.TCPConn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: gw.example\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn.(*net.TCPConn), br, resp
+}
+
+// TestConfig_HandlerWebSocket verifies that websocket sessions pass through
+// a route with every middleware, and that closing one side closes the other.
+func TestConfig_HandlerWebSocket(t *testing.T) {
+	backend := newEchoBackend(t)
+	cfg := &Config{Routes: []Route{{
+		Path:        "/ws/",
+		Upstreams:   []string{backend.URL},
+		StripPrefix: "/ws",
+		Timeout:     scalar.Duration(time.Second),
+		Middleware:  Middleware{RequestID: true, Logging: true, Recovery: true, Compression: true, MaxBodySize: 1024},
+	}}}
+	h, err := cfg.Handler(HandlerOptions{Logger: discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway := httptest.NewServer(h)
+	t.Cleanup(gateway.Close)
+
+	conn, br, resp := dialUpgrade(t, gateway, "/ws/chat")
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", resp.StatusCode)
+	}
+	for key, want := range map[string]string{"Upgrade": "websocket", "Connection": "Upgrade", "X-Backend-Path": "/chat"} {
+		if got := resp.Header.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if resp.Header.Get("X-Request-ID") == "" {
+		t.Error("expected the middleware's X-Request-ID on the 101 response")
+	}
+
+	io.WriteString(conn, "hello\n")
+	if line, err := br.ReadString('\n'); err != nil || line != "hello\n" {
+		t.Fatalf("echo = %q, %v, want %q", line, err, "hello\n")
+	}
+	// Closing our side ends the backend's echo, which closes the gateway's.
+	conn.CloseWrite()
+	if rest, err := io.ReadAll(br); err != nil || len(rest) != 0 {
+		t.Errorf("after close: read %q, %v, want EOF", rest, err)
+	}
+}
+
+// TestUpstream_UpgradeContext verifies that cancelling
+// UpstreamOptions.Context closes upgraded connections.
+func TestUpstream_UpgradeContext(t *testing.T) {
+	backend := newEchoBackend(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	up, err := NewUpstream([]*url.URL{mustParse(t, backend.URL)}, UpstreamOptions{Context: ctx, Logger: discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gateway := httptest.NewServer(up)
+	t.Cleanup(gateway.Close)
+
+	conn, br, resp := dialUpgrade(t, gateway, "/ws")
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d, want 101", resp.StatusCode)
+	}
+	io.WriteString(conn, "ping\n")
+	if line, _ := br.ReadString('\n'); line != "ping\n" {
+		t.Fatalf("echo = %q, want %q", line, "ping\n")
+	}
+	if s := up.Stats(); s.Upgrades != 1 || s.ActiveUpgrades != 1 {
+		t.Errorf("stats = %+v, want 1 upgrade, 1 active", s)
+	}
+
+	cancel()
+	if _, err := br.ReadString('\n'); err != io.EOF {
+		t.Errorf("read after cancel: %v, want EOF", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for up.Stats().ActiveUpgrades != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("upgrade still active: %+v", up.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
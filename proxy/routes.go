@@ -0,0 +1,296 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+	"github.com/harrydayexe/GoWebUtilities/scalar"
+)
+
+// Config is a route file: the routes of a gateway, declared rather than
+// coded.
+type Config struct {
+	Routes []Route `json:"routes"`
+}
+
+// Route maps requests matching Method and Path to Upstreams or a Static
+// response. Exactly one of the two must be set.
+type Route struct {
+	// Method restricts the route to one HTTP method; empty matches all.
+	Method string `json:"method,omitempty"`
+	// Path is an http.ServeMux path pattern, such as "/api/" or
+	// "/users/{id}".
+	Path string `json:"path"`
+	// Upstreams are the URLs requests are forwarded to, in turn.
+	Upstreams []string `json:"upstreams,omitempty"`
+	// Affinity keeps each client on one upstream: "cookie" remembers it in a
+	// cookie, "hash" hashes the client IP address. Empty sends requests to
+	// the upstreams in turn.
+	Affinity string `json:"affinity,omitempty"`
+	// StripPrefix is removed from the request path before forwarding.
+	StripPrefix string `json:"stripPrefix,omitempty"`
+	// Static is a fixed response served without contacting an upstream.
+	Static *Static `json:"static,omitempty"`
+	// Timeout bounds each request, such as "5s"; zero means no limit.
+	Timeout scalar.Duration `json:"timeout,omitempty"`
+	// FlushInterval is how often streamed upstream responses are flushed to
+	// the client, such as "100ms"; negative flushes after every write. See
+	// UpstreamOptions.FlushInterval.
+	FlushInterval scalar.Duration `json:"flushInterval,omitempty"`
+	// BufferSize is the size of the buffers upstream responses are copied
+	// through, in bytes. See UpstreamOptions.BufferSize.
+	BufferSize int `json:"bufferSize,omitempty"`
+	// Middleware selects the middleware wrapped around the route.
+	Middleware Middleware `json:"middleware"`
+}
+
+// Static is a fixed response.
+type Static struct {
+	// Status defaults to 200.
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// Middleware toggles the middleware package's middleware for a route. They
+// are applied in field order, the first outermost.
+type Middleware struct {
+	RequestID   bool `json:"requestId,omitempty"`
+	Logging     bool `json:"logging,omitempty"`
+	Recovery    bool `json:"recovery,omitempty"`
+	Compression bool `json:"compression,omitempty"`
+	// MaxBodySize limits request bodies, in bytes; zero means no limit.
+	MaxBodySize int64 `json:"maxBodySize,omitempty"`
+	// BufferBody buffers request bodies, up to MaxBodySize if set, so the
+	// transport can resend them when it retries a request. See
+	// middleware.NewBodyBuffer.
+	BufferBody bool `json:"bufferBody,omitempty"`
+}
+
+// LoadConfig reads and validates a route file from r, a JSON document:
+//
+//	{"routes": [
+//	  {"method": "GET", "path": "/healthz", "static": {"body": "ok\n"}},
+//	  {"path": "/api/", "upstreams": ["http://10.0.0.1:8080", "http://10.0.0.2:8080"],
+//	   "stripPrefix": "/api", "timeout": "5s",
+//	   "middleware": {"requestId": true, "logging": true, "recovery": true}}
+//	]}
+//
+// Unknown fields are rejected, so typos are not silently ignored.
+func LoadConfig(r io.Reader) (*Config, error) {
+	var cfg Config
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("decoding route file: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// LoadConfigFile calls LoadConfig with the contents of the named file.
+func LoadConfigFile(name string) (*Config, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg, err := LoadConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks every route, returning the problems found together.
+func (c *Config) Validate() error {
+	var errs []error
+	for i, rt := range c.Routes {
+		if err := rt.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (%s): %w", i, rt.pattern(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validate checks a single route.
+func (rt Route) validate() error {
+	switch {
+	case !strings.HasPrefix(rt.Path, "/"):
+		return errors.New(`path must start with "/"`)
+	case len(rt.Upstreams) > 0 && rt.Static != nil:
+		return errors.New("upstreams and static are mutually exclusive")
+	case len(rt.Upstreams) == 0 && rt.Static == nil:
+		return errors.New("one of upstreams or static is required")
+	case (rt.StripPrefix != "" || rt.Affinity != "" || rt.FlushInterval != 0 || rt.BufferSize != 0) && rt.Static != nil:
+		return errors.New("stripPrefix, affinity, flushInterval and bufferSize apply only to upstreams")
+	case rt.BufferSize < 0:
+		return errors.New("bufferSize must not be negative")
+	case rt.Affinity != "" && rt.Affinity != "cookie" && rt.Affinity != "hash":
+		return fmt.Errorf(`affinity must be "cookie" or "hash", not %q`, rt.Affinity)
+	case rt.Timeout < 0:
+		return errors.New("timeout must not be negative")
+	case rt.Middleware.MaxBodySize < 0:
+		return errors.New("maxBodySize must not be negative")
+	case rt.Static != nil && rt.Static.Status != 0 && (rt.Static.Status < 100 || rt.Static.Status > 999):
+		return fmt.Errorf("invalid static status %d", rt.Static.Status)
+	}
+	for _, s := range rt.Upstreams {
+		if _, err := parseTarget(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pattern returns the ServeMux pattern of the route.
+func (rt Route) pattern() string {
+	if rt.Method == "" {
+		return rt.Path
+	}
+	return rt.Method + " " + rt.Path
+}
+
+// affinities maps the affinity names of route files to Affinity values.
+var affinities = map[string]Affinity{"": AffinityNone, "cookie": AffinityCookie, "hash": AffinityHash}
+
+// parseTarget parses an upstream URL.
+func parseTarget(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("upstream %q is not an absolute http or https URL", s)
+	}
+	return u, nil
+}
+
+// HandlerOptions configures the handler built from a Config. Zero values
+// are defaults.
+type HandlerOptions struct {
+	// Transport makes the upstream requests. Defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+	// Context, once done, closes the upgraded connections, such as websocket
+	// sessions, of every route. See UpstreamOptions.Context.
+	Context context.Context
+	// Logger is used by upstreams and the logging and recovery middleware.
+	// Defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// Handler builds the handler tree for c: an http.ServeMux with a handler per
+// route, wrapped in the route's middleware. Requests matching no route are
+// answered by the mux (404, or 405 when only the method differs). It returns
+// an error if c is invalid or two routes' patterns conflict.
+func (c *Config) Handler(opts HandlerOptions) (http.Handler, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	mux := http.NewServeMux()
+	for i, rt := range c.Routes {
+		h, err := rt.handler(opts)
+		if err != nil {
+			return nil, fmt.Errorf("route %d (%s): %w", i, rt.pattern(), err)
+		}
+		if err := register(mux, rt.pattern(), h); err != nil {
+			return nil, fmt.Errorf("route %d: %w", i, err)
+		}
+	}
+	return mux, nil
+}
+
+// handler returns the route's handler wrapped in its middleware.
+func (rt Route) handler(opts HandlerOptions) (http.Handler, error) {
+	var h http.Handler
+	if rt.Static != nil {
+		h = staticHandler(*rt.Static)
+	} else {
+		targets := make([]*url.URL, len(rt.Upstreams))
+		for i, s := range rt.Upstreams {
+			targets[i], _ = parseTarget(s)
+		}
+		up, err := NewUpstream(targets, UpstreamOptions{
+			Transport:     opts.Transport,
+			FlushInterval: time.Duration(rt.FlushInterval),
+			BufferSize:    rt.BufferSize,
+			Affinity:      affinities[rt.Affinity],
+			Context:       opts.Context,
+			Logger:        opts.Logger,
+		})
+		if err != nil {
+			return nil, err
+		}
+		h = up
+		if rt.StripPrefix != "" {
+			h = http.StripPrefix(rt.StripPrefix, h)
+		}
+	}
+
+	var xs []middleware.Middleware
+	m := rt.Middleware
+	if m.RequestID {
+		xs = append(xs, middleware.NewRequestID())
+	}
+	if m.Logging {
+		xs = append(xs, middleware.NewLoggingMiddleware(opts.Logger))
+	}
+	if m.Recovery {
+		xs = append(xs, middleware.NewRecovery(opts.Logger))
+	}
+	if m.Compression {
+		xs = append(xs, middleware.NewCompression(middleware.CompressionOptions{}))
+	}
+	if m.MaxBodySize > 0 {
+		xs = append(xs, middleware.NewMaxBytesReader(m.MaxBodySize))
+	}
+	if m.BufferBody {
+		xs = append(xs, middleware.NewBodyBuffer(middleware.BodyBufferOptions{MaxBodySize: m.MaxBodySize}))
+	}
+	if rt.Timeout > 0 {
+		xs = append(xs, middleware.NewTimeout(time.Duration(rt.Timeout)))
+	}
+	return middleware.CreateStack(xs...)(h), nil
+}
+
+// staticHandler returns a handler always writing s.
+func staticHandler(s Static) http.Handler {
+	status := s.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range s.Headers {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(status)
+		if r.Method != http.MethodHead {
+			io.WriteString(w, s.Body)
+		}
+	})
+}
+
+// register adds h to mux under pattern, returning ServeMux's panic for an
+// invalid or conflicting pattern as an error.
+func register(mux *http.ServeMux, pattern string, h http.Handler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v", p)
+		}
+	}()
+	mux.Handle(pattern, h)
+	return nil
+}
@@ -0,0 +1,386 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+	"github.com/harrydayexe/GoWebUtilities/respond"
+)
+
+// Affinity selects how an Upstream keeps a client on the same target.
+type Affinity int
+
+const (
+	// AffinityNone sends requests to the targets in turn.
+	AffinityNone Affinity = iota
+	// AffinityCookie assigns clients a target in turn and remembers it in a
+	// cookie.
+	AffinityCookie
+	// AffinityHash picks the target by consistent (rendezvous) hashing of a
+	// key derived from the request, so every gateway instance agrees without
+	// cookies. Removing a target moves only the keys that were on it.
+	AffinityHash
+)
+
+// UpstreamOptions configures an Upstream. Zero values are defaults.
+type UpstreamOptions struct {
+	// Transport makes the upstream requests. Defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+	// FlushInterval is how often response bodies with a Content-Length are
+	// flushed to the client while they are copied; negative flushes after
+	// every write, and zero only once the body is complete. Streamed
+	// responses, text/event-stream or of unknown length (chunked), are
+	// always flushed after every write.
+	FlushInterval time.Duration
+	// BufferSize is the size, in bytes, of the buffers response bodies are
+	// copied through, which bounds the memory each response in flight holds.
+	// Buffers are pooled. Defaults to 32 KiB.
+	BufferSize int
+	// Affinity keeps clients on the same target. Defaults to AffinityNone.
+	Affinity Affinity
+	// AffinityCookie names the cookie used by AffinityCookie. Defaults to
+	// "upstream".
+	AffinityCookie string
+	// AffinityKey returns the key hashed by AffinityHash. Defaults to
+	// middleware.RemoteIPKey.
+	AffinityKey func(*http.Request) string
+	// Context, once done, closes the upgraded connections, such as websocket
+	// sessions, the Upstream is proxying. http.Server.Shutdown neither closes
+	// nor waits for upgraded connections, so cancel it when shutting down.
+	// Defaults to a context that is never done.
+	Context context.Context
+	// Logger receives upstream failures. Defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// UpstreamStats is a snapshot of an Upstream's activity.
+type UpstreamStats struct {
+	// Targets is the number of targets currently in use.
+	Targets int
+	// Requests is the number of requests forwarded.
+	Requests int64
+	// AffinityBreaks counts requests moved to another target because the one
+	// their client was bound to (by cookie, or by hash for AffinityHash) has
+	// been removed.
+	AffinityBreaks int64
+	// Upgrades is the number of protocol upgrade requests, such as websocket
+	// handshakes, forwarded.
+	Upgrades int64
+	// ActiveUpgrades is the number of those still being proxied: upgraded
+	// connections that are open, and handshakes in progress.
+	ActiveUpgrades int64
+}
+
+// Upstream is a reverse proxy handler that forwards each request to one of
+// its targets. Create one with NewUpstream.
+type Upstream struct {
+	opts    UpstreamOptions
+	buffers *bufferPool
+	targets atomic.Pointer[[]*target]
+	next    atomic.Uint64
+
+	// removed holds the IDs of the targets taken out by the latest
+	// SetTargets call that took any out, so that affinity breaks can be told
+	// from new clients. Older removals are forgotten, keeping the set as
+	// small as one call's targets. mu also serializes SetTargets.
+	mu      sync.RWMutex
+	removed map[string]bool
+
+	requests, breaks         atomic.Int64
+	upgrades, activeUpgrades atomic.Int64
+}
+
+// target is one upstream server.
+type target struct {
+	url   *url.URL
+	id    string // stable and opaque, for cookies and hashing
+	proxy *httputil.ReverseProxy
+}
+
+// NewUpstream returns an Upstream forwarding to targets, which must be
+// absolute http or https URLs. A target's path is prefixed to the request
+// path, and X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto are set
+// from the incoming request.
+//
+// Failed upstream requests are answered with 502 Bad Gateway, or 504 Gateway
+// Timeout when the request's context deadline passed, as problem details.
+//
+// Protocol upgrades, such as websocket handshakes, are forwarded with their
+// Connection and Upgrade headers. Once the target switches protocols, the
+// client and target connections are copied in both directions until either
+// side closes, which is passed on to the other, or the request's context or
+// UpstreamOptions.Context is done. Upgrades need HTTP/1.1 on both sides.
+func NewUpstream(targets []*url.URL, opts UpstreamOptions) (*Upstream, error) {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.AffinityCookie == "" {
+		opts.AffinityCookie = "upstream"
+	}
+	if opts.AffinityKey == nil {
+		opts.AffinityKey = middleware.RemoteIPKey
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 32 << 10
+	}
+	u := &Upstream{opts: opts, buffers: newBufferPool(opts.BufferSize), removed: make(map[string]bool)}
+	if err := u.SetTargets(targets); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// SetTargets replaces the targets. Clients bound to a target that remains
+// keep it; those bound to a removed target are moved to another and counted
+// as affinity breaks. Requests in flight finish on the target they started
+// with.
+func (u *Upstream) SetTargets(targets []*url.URL) error {
+	if len(targets) == 0 {
+		return errors.New("proxy: upstream has no targets")
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	old := map[string]*target{}
+	if cur := u.targets.Load(); cur != nil {
+		for _, t := range *cur {
+			old[t.id] = t
+		}
+	}
+	next := make([]*target, 0, len(targets))
+	for _, tu := range targets {
+		if tu.Scheme != "http" && tu.Scheme != "https" || tu.Host == "" {
+			return fmt.Errorf("proxy: upstream target %q is not an absolute http or https URL", tu)
+		}
+		id := targetID(tu)
+		if t, ok := old[id]; ok {
+			next = append(next, t)
+			delete(old, id)
+			continue
+		}
+		next = append(next, u.newTarget(tu, id))
+	}
+
+	if len(old) > 0 {
+		u.removed = make(map[string]bool, len(old))
+		for id := range old {
+			u.removed[id] = true
+		}
+	} else {
+		for _, t := range next {
+			delete(u.removed, t.id)
+		}
+	}
+	u.targets.Store(&next)
+	return nil
+}
+
+// newTarget returns the target for tu.
+func (u *Upstream) newTarget(tu *url.URL, id string) *target {
+	return &target{
+		url: tu,
+		id:  id,
+		proxy: &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(tu)
+				pr.SetXForwarded()
+			},
+			Transport:     u.opts.Transport,
+			FlushInterval: u.opts.FlushInterval,
+			BufferPool:    u.buffers,
+			ErrorHandler:  upstreamError(u.opts.Logger, tu),
+		},
+	}
+}
+
+// bufferPool is an httputil.BufferPool of fixed-size buffers.
+type bufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+// newBufferPool returns a pool of buffers of size bytes.
+func newBufferPool(size int) *bufferPool {
+	p := &bufferPool{size: size}
+	p.pool.New = func() any {
+		b := make([]byte, size)
+		return &b
+	}
+	return p
+}
+
+// Get implements httputil.BufferPool.
+func (p *bufferPool) Get() []byte {
+	return *p.pool.Get().(*[]byte)
+}
+
+// Put implements httputil.BufferPool.
+func (p *bufferPool) Put(b []byte) {
+	if len(b) == p.size {
+		p.pool.Put(&b)
+	}
+}
+
+// targetID returns an opaque identifier for a target URL, so cookies do not
+// reveal internal addresses.
+func targetID(tu *url.URL) string {
+	sum := sha256.Sum256([]byte(tu.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ServeHTTP implements http.Handler.
+func (u *Upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.requests.Add(1)
+	t := u.pick(w, r)
+	if _, ok := middleware.IsUpgrade(r); ok {
+		u.upgrades.Add(1)
+		u.activeUpgrades.Add(1)
+		defer u.activeUpgrades.Add(-1)
+		if u.opts.Context != nil {
+			// ReverseProxy closes the upgraded connections when the request's
+			// context is done.
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			stop := context.AfterFunc(u.opts.Context, cancel)
+			defer stop()
+			r = r.WithContext(ctx)
+		}
+	}
+	t.proxy.ServeHTTP(w, r)
+}
+
+// pick chooses the target for r according to the affinity.
+func (u *Upstream) pick(w http.ResponseWriter, r *http.Request) *target {
+	targets := *u.targets.Load()
+	switch u.opts.Affinity {
+	case AffinityCookie:
+		if c, err := r.Cookie(u.opts.AffinityCookie); err == nil {
+			for _, t := range targets {
+				if t.id == c.Value {
+					return t
+				}
+			}
+			if u.wasRemoved(c.Value) {
+				u.breaks.Add(1)
+			}
+		}
+		t := u.roundRobin(targets)
+		http.SetCookie(w, &http.Cookie{
+			Name:     u.opts.AffinityCookie,
+			Value:    t.id,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return t
+	case AffinityHash:
+		key := u.opts.AffinityKey(r)
+		best, bestScore := targets[0], uint64(0)
+		for _, t := range targets {
+			if s := rendezvousScore(key, t.id); s >= bestScore {
+				best, bestScore = t, s
+			}
+		}
+		if u.preferredRemoved(key, bestScore) {
+			u.breaks.Add(1)
+		}
+		return best
+	}
+	return u.roundRobin(targets)
+}
+
+// roundRobin returns the next of targets in turn.
+func (u *Upstream) roundRobin(targets []*target) *target {
+	return targets[(u.next.Add(1)-1)%uint64(len(targets))]
+}
+
+// wasRemoved reports whether id is a target removed by SetTargets.
+func (u *Upstream) wasRemoved(id string) bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.removed[id]
+}
+
+// preferredRemoved reports whether a removed target outscores score for key,
+// meaning key was moved off it.
+func (u *Upstream) preferredRemoved(key string, score uint64) bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	for id := range u.removed {
+		if rendezvousScore(key, id) > score {
+			return true
+		}
+	}
+	return false
+}
+
+// rendezvousScore is the highest-random-weight hash of key for a target.
+func rendezvousScore(key, id string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(id))
+	// FNV's low bits mix poorly for similar inputs; finish with a
+	// splitmix64 step.
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// Stats returns the upstream's activity so far.
+func (u *Upstream) Stats() UpstreamStats {
+	return UpstreamStats{
+		Targets:        len(*u.targets.Load()),
+		Requests:       u.requests.Load(),
+		AffinityBreaks: u.breaks.Load(),
+		Upgrades:       u.upgrades.Load(),
+		ActiveUpgrades: u.activeUpgrades.Load(),
+	}
+}
+
+// LogValue implements slog.LogValuer, logging the upstream's statistics.
+func (u *Upstream) LogValue() slog.Value {
+	s := u.Stats()
+	return slog.GroupValue(
+		slog.Int("targets", s.Targets),
+		slog.Int64("requests", s.Requests),
+		slog.Int64("affinity_breaks", s.AffinityBreaks),
+		slog.Int64("upgrades", s.Upgrades),
+		slog.Int64("active_upgrades", s.ActiveUpgrades),
+	)
+}
+
+// upstreamError returns the ReverseProxy error handler for target.
+func upstreamError(logger *slog.Logger, target *url.URL) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		status := http.StatusBadGateway
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		level := slog.LevelWarn
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			level = slog.LevelDebug // the client went away
+		}
+		logger.Log(r.Context(), level, "upstream request failed",
+			slog.String("upstream", target.String()),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Any("error", err))
+		respond.Error(w, status, err)
+	}
+}
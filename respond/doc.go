@@ -0,0 +1,26 @@
+// Package respond writes JSON responses and errors in one consistent format.
+//
+// JSON encodes a value straight to the response with a json.Encoder:
+//
+//	respond.JSON(w, http.StatusOK, user)
+//
+// Errors are always written as RFC 9457 problem details
+// (application/problem+json), so clients parse one error shape everywhere:
+//
+//	respond.Error(w, http.StatusNotFound, fmt.Errorf("no user %q", id))
+//	// {"type":"about:blank","title":"Not Found","status":404,"detail":"no user \"ada\""}
+//
+// Server errors (5xx) omit the error text, which may reveal internals; log it
+// instead. A handler can control the body fully by returning or passing a
+// *ProblemDetails, which may carry extension members:
+//
+//	respond.Problem(w, respond.ProblemDetails{
+//	    Type:       "https://example.com/probs/out-of-credit",
+//	    Title:      "You do not have enough credit.",
+//	    Status:     http.StatusForbidden,
+//	    Extensions: map[string]any{"balance": 30},
+//	})
+//
+// Applications with an established error format replace the serialization of
+// Error with SetErrorEncoder.
+package respond
@@ -0,0 +1,132 @@
+package respond
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"sync/atomic"
+)
+
+// JSON writes v as a JSON response with the given status. The value is
+// encoded straight to w, so an encoding error surfaces after the status has
+// been sent; JSON returns it for logging.
+func JSON(w http.ResponseWriter, status int, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+// ProblemDetails is an RFC 9457 problem details object. It implements error,
+// so handlers and the functions they call can return one to control the
+// error response written by Error.
+type ProblemDetails struct {
+	// Type is a URI identifying the problem type. Defaults to "about:blank".
+	Type string
+	// Title is a short summary of the problem type. Defaults to the status
+	// text when Type is "about:blank".
+	Title string
+	// Status is the HTTP status code.
+	Status int
+	// Detail explains this occurrence of the problem.
+	Detail string
+	// Instance is a URI identifying this occurrence.
+	Instance string
+	// Extensions are additional members, such as a validation error list.
+	// They cannot replace the standard members.
+	Extensions map[string]any
+}
+
+// Error implements error.
+func (p *ProblemDetails) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	if p.Title != "" {
+		return p.Title
+	}
+	return http.StatusText(p.Status)
+}
+
+// MarshalJSON encodes the problem with its extensions as top-level members.
+func (p ProblemDetails) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+5)
+	maps.Copy(m, p.Extensions)
+	m["type"] = p.Type
+	m["title"] = p.Title
+	m["status"] = p.Status
+	for name, value := range map[string]string{"detail": p.Detail, "instance": p.Instance} {
+		if value != "" {
+			m[name] = value
+		} else {
+			delete(m, name)
+		}
+	}
+	return json.Marshal(m)
+}
+
+// Problem writes p as an application/problem+json response with p.Status,
+// filling in the default Type and Title.
+func Problem(w http.ResponseWriter, p ProblemDetails) error {
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" && p.Type == "about:blank" {
+		p.Title = http.StatusText(p.Status)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	return json.NewEncoder(w).Encode(p)
+}
+
+// ErrorEncoder writes the response for an error passed to Error.
+type ErrorEncoder func(w http.ResponseWriter, status int, err error) error
+
+// errorEncoder holds the ErrorEncoder set with SetErrorEncoder.
+var errorEncoder atomic.Pointer[ErrorEncoder]
+
+// SetErrorEncoder replaces how Error writes errors, for applications with an
+// established error format. A nil e restores EncodeProblem. It is safe to
+// call concurrently with Error, but is meant to be called once at startup.
+func SetErrorEncoder(e ErrorEncoder) {
+	if e == nil {
+		errorEncoder.Store(nil)
+		return
+	}
+	errorEncoder.Store(&e)
+}
+
+// Error writes err as an error response with the given status, using the
+// encoder set with SetErrorEncoder or EncodeProblem.
+func Error(w http.ResponseWriter, status int, err error) error {
+	if e := errorEncoder.Load(); e != nil {
+		return (*e)(w, status, err)
+	}
+	return EncodeProblem(w, status, err)
+}
+
+// EncodeProblem is the default ErrorEncoder. If err wraps a *ProblemDetails,
+// that problem is written, with status used only when it has none.
+// Otherwise it writes an "about:blank" problem whose detail is err's text
+// for client errors (4xx) and omitted for server errors, whose text may
+// reveal internals.
+func EncodeProblem(w http.ResponseWriter, status int, err error) error {
+	var p *ProblemDetails
+	if errors.As(err, &p) {
+		problem := *p
+		if problem.Status == 0 {
+			problem.Status = status
+		}
+		return Problem(w, problem)
+	}
+	problem := ProblemDetails{Status: status}
+	if err != nil && status < 500 {
+		problem.Detail = err.Error()
+	}
+	return Problem(w, problem)
+}
@@ -0,0 +1,85 @@
+package respond
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if err := JSON(rec, http.StatusCreated, map[string]int{"id": 7}); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusCreated || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if got := rec.Body.String(); got != "{\"id\":7}\n" {
+		t.Errorf("body = %q", got)
+	}
+
+	if err := JSON(httptest.NewRecorder(), http.StatusOK, func() {}); err == nil {
+		t.Error("unencodable value: JSON returned nil error")
+	}
+}
+
+func TestError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   string
+	}{
+		{
+			name:   "client error includes detail",
+			status: http.StatusNotFound,
+			err:    errors.New(`no user "ada"`),
+			want:   `{"detail":"no user \"ada\"","status":404,"title":"Not Found","type":"about:blank"}`,
+		},
+		{
+			name:   "server error hides detail",
+			status: http.StatusInternalServerError,
+			err:    errors.New("pq: connection refused"),
+			want:   `{"status":500,"title":"Internal Server Error","type":"about:blank"}`,
+		},
+		{
+			name:   "wrapped problem details",
+			status: http.StatusBadRequest,
+			err: fmt.Errorf("validating: %w", &ProblemDetails{
+				Type:       "https://example.com/probs/out-of-credit",
+				Title:      "Out of credit",
+				Status:     http.StatusForbidden,
+				Extensions: map[string]any{"balance": 30, "status": 1},
+			}),
+			want: `{"balance":30,"status":403,"title":"Out of credit","type":"https://example.com/probs/out-of-credit"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Error(rec, tt.status, tt.err)
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.want {
+				t.Errorf("body = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetErrorEncoder(t *testing.T) {
+	SetErrorEncoder(func(w http.ResponseWriter, status int, err error) error {
+		return JSON(w, status, map[string]string{"error": err.Error()})
+	})
+	defer SetErrorEncoder(nil)
+
+	rec := httptest.NewRecorder()
+	Error(rec, http.StatusConflict, errors.New("taken"))
+	if rec.Code != http.StatusConflict || strings.TrimSpace(rec.Body.String()) != `{"error":"taken"}` {
+		t.Errorf("got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,22 @@
+// Package scalar parses the scalar values APIs commonly accept as strings:
+// timestamps, dates, durations and amounts of money, so that services do not
+// each reinvent them, and money in particular is never rounded through a
+// float64.
+//
+// The parsers are lenient where clients commonly differ and strict where a
+// mistake would be costly:
+//
+//	scalar.ParseTime("2024-03-01 12:30:00")       // RFC 3339 and common variants; no offset is UTC
+//	scalar.ParseDate("2024-03-01")                // a calendar date, without a time zone
+//	scalar.ParseDuration("PT1H30M")               // Go ("1h30m") or ISO 8601 durations
+//	scalar.ParseAmount("12.34", "USD")            // 1234 minor units; "12.345" is an error
+//	scalar.ParseMoney("JPY 500")                  // Money{Amount: 500, Currency: "JPY"}
+//
+// Time, Date, Duration and Money implement json.Unmarshaler with the same
+// rules, so they can be used as fields of request types decoded by
+// bind.JSON, which answers parse failures with 400 Bad Request. For string
+// fields, the validate package has matching datetime, date, duration and
+// money rules.
+//
+// Failures are *ParseError values.
+package scalar
@@ -0,0 +1,180 @@
+package scalar
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// minorDigits lists the ISO 4217 currencies whose minor unit is not a
+// hundredth. Other currencies have two decimal places.
+var minorDigits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0,
+	"XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// MinorDigits returns the number of decimal places of currency's minor unit,
+// such as 2 for "USD" (cents) and 0 for "JPY".
+func MinorDigits(currency string) int {
+	if d, ok := minorDigits[currency]; ok {
+		return d
+	}
+	return 2
+}
+
+// Money is an amount of a currency, held as an integer number of the
+// currency's minor units (cents for USD) so that arithmetic is exact.
+//
+// In JSON it is an object with the amount as a decimal string, which no
+// client will round through a float64:
+//
+//	{"amount":"12.34","currency":"USD"}
+//
+// A JSON number is also accepted for the amount, read from its literal text
+// rather than as a float64.
+type Money struct {
+	// Amount is in minor units: 1234 is 12.34 USD, or 1234 JPY.
+	Amount int64
+	// Currency is an ISO 4217 code such as "USD".
+	Currency string
+}
+
+// ParseAmount parses a decimal amount of currency, such as "12.34" or
+// "-0.5", into minor units. It rejects more decimal places than the
+// currency has, unless the extra digits are zeros, rather than round, and
+// rejects thousands separators, exponents and amounts that overflow int64.
+func ParseAmount(s, currency string) (int64, error) {
+	fail := func(err error) (int64, error) {
+		return 0, &ParseError{Type: "amount", Value: s, Err: err}
+	}
+	digits := MinorDigits(currency)
+	norm := strings.TrimSpace(s)
+	sign := ""
+	if norm != "" && (norm[0] == '-' || norm[0] == '+') {
+		sign, norm = norm[:1], norm[1:]
+	}
+	whole, frac, hasPoint := strings.Cut(norm, ".")
+	if whole == "" || !isDigits(whole) || hasPoint && (frac == "" || !isDigits(frac)) {
+		return fail(nil)
+	}
+	if trimmed := strings.TrimRight(frac, "0"); len(trimmed) > digits {
+		return fail(fmt.Errorf("%s has %d decimal places", currency, digits))
+	}
+	if len(frac) > digits {
+		frac = frac[:digits]
+	}
+	frac += strings.Repeat("0", digits-len(frac))
+	n, err := strconv.ParseInt(sign+whole+frac, 10, 64)
+	if err != nil {
+		return fail(fmt.Errorf("out of range"))
+	}
+	return n, nil
+}
+
+// FormatAmount formats minor units of currency as a decimal string, the
+// inverse of ParseAmount.
+func FormatAmount(amount int64, currency string) string {
+	digits := MinorDigits(currency)
+	s := strconv.FormatInt(amount, 10)
+	sign := ""
+	if amount < 0 {
+		sign, s = "-", s[1:]
+	}
+	if digits == 0 {
+		return sign + s
+	}
+	if len(s) <= digits {
+		s = strings.Repeat("0", digits-len(s)+1) + s
+	}
+	return sign + s[:len(s)-digits] + "." + s[len(s)-digits:]
+}
+
+// ParseMoney parses an amount with its currency code, such as "USD 12.34"
+// or "12.34 usd".
+func ParseMoney(s string) (Money, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return Money{}, &ParseError{Type: "money", Value: s}
+	}
+	code, amount := fields[0], fields[1]
+	if !isCurrency(strings.ToUpper(code)) {
+		code, amount = amount, code
+	}
+	code = strings.ToUpper(code)
+	if !isCurrency(code) {
+		return Money{}, &ParseError{Type: "money", Value: s, Err: fmt.Errorf("no ISO 4217 currency code")}
+	}
+	n, err := ParseAmount(amount, code)
+	if err != nil {
+		return Money{}, &ParseError{Type: "money", Value: s, Err: err}
+	}
+	return Money{Amount: n, Currency: code}, nil
+}
+
+// String returns m in the form "USD 12.34".
+func (m Money) String() string {
+	return m.Currency + " " + FormatAmount(m.Amount, m.Currency)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{FormatAmount(m.Amount, m.Currency), m.Currency})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var raw struct {
+		Amount   json.RawMessage `json:"amount"`
+		Currency string          `json:"currency"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil || raw.Amount == nil {
+		return &ParseError{Type: "money", Value: string(data), Err: fmt.Errorf(`must be an object with "amount" and "currency"`)}
+	}
+	currency := strings.ToUpper(raw.Currency)
+	if !isCurrency(currency) {
+		return &ParseError{Type: "money", Value: string(data), Err: fmt.Errorf("no ISO 4217 currency code")}
+	}
+	amount := string(raw.Amount)
+	if raw.Amount[0] == '"' {
+		json.Unmarshal(raw.Amount, &amount)
+	}
+	n, err := ParseAmount(amount, currency)
+	if err != nil {
+		return err
+	}
+	*m = Money{Amount: n, Currency: currency}
+	return nil
+}
+
+// isCurrency reports whether s looks like an ISO 4217 code.
+func isCurrency(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// isDigits reports whether s is all ASCII digits.
+func isDigits(s string) bool {
+	for _, c := range []byte(s) {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
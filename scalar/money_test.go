@@ -0,0 +1,95 @@
+package scalar
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in, currency string
+		want         int64
+	}{
+		{"12.34", "USD", 1234},
+		{"12", "USD", 1200},
+		{"12.3", "USD", 1230},
+		{"-0.05", "EUR", -5},
+		{"+1.50", "GBP", 150},
+		{"12.340", "USD", 1234},
+		{"500", "JPY", 500},
+		{"500.00", "JPY", 500},
+		{"1.234", "KWD", 1234},
+		{"92233720368547758.07", "USD", 9223372036854775807},
+	}
+	for _, tt := range tests {
+		if got, err := ParseAmount(tt.in, tt.currency); err != nil || got != tt.want {
+			t.Errorf("ParseAmount(%q, %s) = %d, %v; want %d", tt.in, tt.currency, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "-", "12.345", "1,234.56", "1e3", ".5", "5.", "12.3.4", "92233720368547758.08", "abc"} {
+		if _, err := ParseAmount(in, "USD"); err == nil {
+			t.Errorf("ParseAmount(%q, USD) = nil error, want one", in)
+		}
+	}
+	if _, err := ParseAmount("5.5", "JPY"); err == nil {
+		t.Error("ParseAmount(5.5, JPY) = nil error, want one")
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{1234, "USD", "12.34"},
+		{5, "USD", "0.05"},
+		{-5, "EUR", "-0.05"},
+		{500, "JPY", "500"},
+		{1234, "KWD", "1.234"},
+		{9223372036854775807, "USD", "92233720368547758.07"},
+	}
+	for _, tt := range tests {
+		if got := FormatAmount(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("FormatAmount(%d, %s) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	for _, in := range []string{"USD 12.34", "12.34 usd", "  usd   12.34 "} {
+		if m, err := ParseMoney(in); err != nil || m != (Money{1234, "USD"}) {
+			t.Errorf("ParseMoney(%q) = %v, %v", in, m, err)
+		}
+	}
+	for _, in := range []string{"12.34", "US 12.34", "USD 12.345", "USD 1 2"} {
+		if _, err := ParseMoney(in); err == nil {
+			t.Errorf("ParseMoney(%q) = nil error, want one", in)
+		}
+	}
+	if s := (Money{-1234, "USD"}).String(); s != "USD -12.34" {
+		t.Errorf("String = %q", s)
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	for _, in := range []string{
+		`{"amount":"12.34","currency":"USD"}`,
+		`{"amount":12.34,"currency":"usd"}`,
+	} {
+		var m Money
+		if err := json.Unmarshal([]byte(in), &m); err != nil || m != (Money{1234, "USD"}) {
+			t.Errorf("Unmarshal(%s) = %v, %v", in, m, err)
+		}
+	}
+	for _, in := range []string{`"USD 12.34"`, `{"currency":"USD"}`, `{"amount":"1","currency":"dollars"}`, `{"amount":0.001,"currency":"USD"}`} {
+		var m Money
+		if err := json.Unmarshal([]byte(in), &m); err == nil {
+			t.Errorf("Unmarshal(%s) = nil error, want one", in)
+		}
+	}
+	out, _ := json.Marshal(Money{500, "JPY"})
+	if string(out) != `{"amount":"500","currency":"JPY"}` {
+		t.Errorf("Marshal = %s", out)
+	}
+}
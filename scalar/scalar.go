@@ -0,0 +1,223 @@
+package scalar
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseError is returned when a value cannot be parsed.
+type ParseError struct {
+	// Type names what was being parsed: "time", "date", "amount", "money"
+	// or "duration".
+	Type  string
+	Value string
+	// Err is the underlying problem, if more specific than the value being
+	// malformed.
+	Err error
+}
+
+// Error implements error.
+func (e *ParseError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("invalid %s %q: %v", e.Type, e.Value, e.Err)
+	}
+	return fmt.Sprintf("invalid %s %q", e.Type, e.Value)
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// timeLayouts are tried in order by ParseTime, after its normalization.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700", // offset without a colon
+	"2006-01-02T15:04Z07:00",             // no seconds
+	"2006-01-02T15:04:05.999999999",      // no offset: UTC
+	"2006-01-02T15:04",
+	time.DateOnly,
+}
+
+// ParseTime parses an RFC 3339 timestamp, such as
+// "2024-03-01T12:30:00Z", leniently accepting the common variations clients
+// send: a space or lower-case "t" between date and time, a lower-case "z",
+// an offset without a colon ("+0100"), no seconds, no offset (taken as UTC)
+// or a date alone (midnight UTC).
+func ParseTime(s string) (time.Time, error) {
+	norm := strings.TrimSpace(s)
+	if len(norm) > 10 && (norm[10] == ' ' || norm[10] == 't') {
+		norm = norm[:10] + "T" + norm[11:]
+	}
+	if strings.HasSuffix(norm, "z") {
+		norm = norm[:len(norm)-1] + "Z"
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, norm); err == nil {
+			return t, nil
+		}
+	}
+	_, err := time.Parse(time.RFC3339Nano, norm)
+	return time.Time{}, &ParseError{Type: "time", Value: s, Err: err}
+}
+
+// Time is a time.Time that unmarshals from JSON with ParseTime and marshals
+// as RFC 3339.
+type Time struct {
+	time.Time
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *Time) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	s, err := unquote(data, "time")
+	if err != nil {
+		return err
+	}
+	t.Time, err = ParseTime(s)
+	return err
+}
+
+// Date is a calendar date without a time of day or time zone, such as a
+// birthday or a billing date, written as "2006-01-02".
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// ParseDate parses a date in the form "2006-01-02".
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(time.DateOnly, strings.TrimSpace(s))
+	if err != nil {
+		return Date{}, &ParseError{Type: "date", Value: s, Err: err}
+	}
+	return DateOf(t), nil
+}
+
+// DateOf returns the date of t in t's location.
+func DateOf(t time.Time) Date {
+	y, m, d := t.Date()
+	return Date{y, m, d}
+}
+
+// String returns d in the form "2006-01-02".
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// In returns the start of d in loc.
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// IsZero reports whether d is the zero Date.
+func (d Date) IsZero() bool {
+	return d == Date{}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Date) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	s, err := unquote(data, "date")
+	if err != nil {
+		return err
+	}
+	*d, err = ParseDate(s)
+	return err
+}
+
+// Duration is a time.Duration that unmarshals from JSON with ParseDuration,
+// or from a number of seconds, and marshals as a Go duration string such as
+// "1h30m0s".
+type Duration time.Duration
+
+// isoDuration matches the ISO 8601 durations ParseDuration accepts.
+var isoDuration = regexp.MustCompile(`^([-+])?P(?:(\d+(?:\.\d+)?)W)?(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// ParseDuration parses a Go duration string such as "1h30m" or "250ms", or
+// an ISO 8601 duration such as "PT1H30M" or "P1DT12H". ISO durations may use
+// weeks, days (of 24 hours), hours, minutes and seconds, but not years or
+// months, whose length varies.
+func ParseDuration(s string) (time.Duration, error) {
+	norm := strings.TrimSpace(s)
+	if d, err := time.ParseDuration(norm); err == nil {
+		return d, nil
+	}
+	m := isoDuration.FindStringSubmatch(strings.ToUpper(norm))
+	if m == nil || norm == "P" || strings.HasSuffix(strings.ToUpper(norm), "T") {
+		return 0, &ParseError{Type: "duration", Value: s}
+	}
+	var total float64
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+2] == "" {
+			continue
+		}
+		n, _ := strconv.ParseFloat(m[i+2], 64)
+		total += n * float64(unit)
+	}
+	if total > math.MaxInt64 {
+		return 0, &ParseError{Type: "duration", Value: s, Err: fmt.Errorf("out of range")}
+	}
+	d := time.Duration(math.Round(total))
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// String returns d formatted as by time.Duration.String.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if data[0] != '"' {
+		secs, err := strconv.ParseFloat(string(data), 64)
+		if err != nil || math.Abs(secs) > math.MaxInt64/float64(time.Second) {
+			return &ParseError{Type: "duration", Value: string(data)}
+		}
+		*d = Duration(math.Round(secs * float64(time.Second)))
+		return nil
+	}
+	s, err := unquote(data, "duration")
+	if err != nil {
+		return err
+	}
+	parsed, err := ParseDuration(s)
+	*d = Duration(parsed)
+	return err
+}
+
+// unquote returns the JSON string data, or a ParseError of type typ if data
+// is not a string.
+func unquote(data []byte, typ string) (string, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return "", &ParseError{Type: typ, Value: string(data), Err: fmt.Errorf("must be a string")}
+	}
+	return s, nil
+}
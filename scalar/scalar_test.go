@@ -0,0 +1,112 @@
+package scalar
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	plusOne := time.FixedZone("", 3600)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2024-03-01T12:30:00Z", want},
+		{"2024-03-01t12:30:00z", want},
+		{"2024-03-01 12:30:00Z", want},
+		{" 2024-03-01T12:30:00Z ", want},
+		{"2024-03-01T12:30:00.5Z", want.Add(500 * time.Millisecond)},
+		{"2024-03-01T13:30:00+01:00", want.In(plusOne)},
+		{"2024-03-01T13:30:00+0100", want.In(plusOne)},
+		{"2024-03-01T12:30Z", want},
+		{"2024-03-01T12:30:00", want},
+		{"2024-03-01T12:30", want},
+		{"2024-03-01", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.in)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "yesterday", "2024-13-01", "2024-03-01T25:00:00Z", "01/03/2024"} {
+		var parseErr *ParseError
+		if _, err := ParseTime(in); !errors.As(err, &parseErr) || parseErr.Type != "time" {
+			t.Errorf("ParseTime(%q) error = %v, want a time ParseError", in, err)
+		}
+	}
+}
+
+func TestDate(t *testing.T) {
+	d, err := ParseDate("2024-02-29")
+	if err != nil || d != (Date{2024, time.February, 29}) || d.String() != "2024-02-29" {
+		t.Errorf("ParseDate = %v, %v", d, err)
+	}
+	if _, err := ParseDate("2023-02-29"); err == nil {
+		t.Error("ParseDate(2023-02-29) = nil error, want one")
+	}
+	if got := d.In(time.UTC); !got.Equal(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("In = %v", got)
+	}
+
+	var v struct {
+		Born Date `json:"born"`
+		When Time `json:"when"`
+	}
+	if err := json.Unmarshal([]byte(`{"born":"1815-12-10","when":"2024-03-01 12:30:00Z"}`), &v); err != nil {
+		t.Fatalf("Unmarshal = %v", err)
+	}
+	if v.Born != (Date{1815, time.December, 10}) || v.When.Hour() != 12 {
+		t.Errorf("decoded %+v", v)
+	}
+	out, _ := json.Marshal(v)
+	if want := `{"born":"1815-12-10","when":"2024-03-01T12:30:00Z"}`; string(out) != want {
+		t.Errorf("Marshal = %s, want %s", out, want)
+	}
+	if err := json.Unmarshal([]byte(`{"born":18151210}`), &v); err == nil {
+		t.Error("Unmarshal of a numeric date = nil error, want one")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"1h30m", 90 * time.Minute},
+		{"250ms", 250 * time.Millisecond},
+		{"PT1H30M", 90 * time.Minute},
+		{"pt45s", 45 * time.Second},
+		{"P1DT12H", 36 * time.Hour},
+		{"P2W", 14 * 24 * time.Hour},
+		{"PT0.5S", 500 * time.Millisecond},
+		{"-PT1M", -time.Minute},
+	}
+	for _, tt := range tests {
+		if got, err := ParseDuration(tt.in); err != nil || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "P", "PT", "P1Y", "P1M", "P1DT", "10", "1 hour"} {
+		if _, err := ParseDuration(in); err == nil {
+			t.Errorf("ParseDuration(%q) = nil error, want one", in)
+		}
+	}
+
+	var v struct {
+		Timeout Duration `json:"timeout"`
+		TTL     Duration `json:"ttl"`
+	}
+	if err := json.Unmarshal([]byte(`{"timeout":"PT2M","ttl":1.5}`), &v); err != nil {
+		t.Fatalf("Unmarshal = %v", err)
+	}
+	if time.Duration(v.Timeout) != 2*time.Minute || time.Duration(v.TTL) != 1500*time.Millisecond {
+		t.Errorf("decoded %+v", v)
+	}
+	if out, _ := json.Marshal(v); string(out) != `{"timeout":"2m0s","ttl":"1.5s"}` {
+		t.Errorf("Marshal = %s", out)
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/admin"
+	"github.com/harrydayexe/GoWebUtilities/config"
+)
+
+// adminRoute is an endpoint registered with WithAdminHandler.
+type adminRoute struct {
+	pattern string
+	handler http.Handler
+}
+
+// WithAdminHandler mounts handler at pattern on the admin server that Run
+// starts when ADMIN_PORT is set, behind the admin server's authorization.
+// The pattern follows http.ServeMux conventions, such as "POST /cache/purge".
+// It is ignored if the admin server is disabled.
+//
+// The admin server also serves the health endpoints given with WithHealth, so
+// operators can check them alongside pprof, expvar and the log level.
+func WithAdminHandler(pattern string, handler http.Handler) Option {
+	return func(o *runOptions) {
+		o.adminRoutes = append(o.adminRoutes, adminRoute{pattern: pattern, handler: handler})
+	}
+}
+
+// WithMaintenance puts m's middleware in front of the handler passed to Run,
+// so that it answers 503 while maintenance mode is on, and serves m at
+// GET and PUT /maintenance on the admin server. The WithHealth endpoints
+// are still answered in maintenance mode.
+func WithMaintenance(m *admin.Maintenance) Option {
+	return func(o *runOptions) {
+		o.maintenance = m
+	}
+}
+
+// newAdminServer returns the admin server described by cfg, or nil if
+// cfg.AdminPort is not set.
+func newAdminServer(cfg config.ServerConfig, opts *runOptions) (*http.Server, error) {
+	if cfg.AdminPort == 0 {
+		return nil, nil
+	}
+	handler := admin.NewHandler(admin.Options{
+		Token:            cfg.AdminToken,
+		AllowClientCerts: cfg.AdminClientCAFile != "",
+		Config:           cfg,
+		Maintenance:      opts.maintenance,
+	})
+	if opts.health != nil {
+		handler.Handle("GET /healthz", opts.health.LivenessHandler())
+		handler.Handle("GET /readyz", opts.health.ReadinessHandler())
+	}
+	for _, route := range opts.adminRoutes {
+		handler.Handle(route.pattern, route.handler)
+	}
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.AdminPort),
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       time.Duration(cfg.IdleTimeout) * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return config.NewContext(context.Background(), cfg)
+		},
+	}
+	if cfg.AdminClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.AdminClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read admin client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in admin client CA file %s", cfg.AdminClientCAFile)
+		}
+		// Clients without a certificate may still authorize with the token.
+		srv.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	}
+	return srv, nil
+}
+
+// serveAdmin serves srv on ln until it is shut down, with TLS if cfg
+// configures it. It returns nil once srv is shut down.
+func serveAdmin(srv *http.Server, ln net.Listener, cfg config.ServerConfig) error {
+	slog.Info("admin server listening",
+		slog.String("address", ln.Addr().String()),
+		slog.Bool("tls", cfg.AdminTLSCertFile != ""),
+	)
+	var err error
+	if cfg.AdminTLSCertFile != "" {
+		err = srv.ServeTLS(ln, cfg.AdminTLSCertFile, cfg.AdminTLSKeyFile)
+	} else {
+		err = srv.Serve(ln)
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// ConnStats is a snapshot of the connections seen by a ConnTracker.
+type ConnStats struct {
+	// Accepted is the number of connections accepted so far.
+	Accepted int64
+	// Open is the number of connections currently open.
+	Open int64
+	// Active is the number of open connections currently serving a request.
+	Active int64
+	// Hijacked is the number of connections taken over by handlers, for
+	// example for websockets. Hijacked connections are no longer open.
+	Hijacked int64
+	// Closed is the number of connections closed by the server.
+	Closed int64
+	// TLSHandshakeErrors is the number of TLS handshakes that failed.
+	TLSHandshakeErrors int64
+}
+
+// ConnTracker counts the connections of one http.Server through its
+// ConnState hook, so that operators running several listeners can see which
+// one is misbehaving and watch connections drain during shutdown. A
+// ConnTracker is safe for concurrent use.
+type ConnTracker struct {
+	name      string
+	states    sync.Map // net.Conn -> http.ConnState
+	accepted  atomic.Int64
+	open      atomic.Int64
+	active    atomic.Int64
+	hijacked  atomic.Int64
+	closed    atomic.Int64
+	tlsErrors atomic.Int64
+}
+
+// NewConnTracker returns a ConnTracker for the listener called name, which
+// identifies it in logs.
+func NewConnTracker(name string) *ConnTracker {
+	return &ConnTracker{name: name}
+}
+
+// WithConnTracker makes Run instrument its server with t and log t's
+// statistics once shutdown has finished.
+func WithConnTracker(t *ConnTracker) Option {
+	return func(o *runOptions) {
+		o.connTrackers = append(o.connTrackers, t)
+	}
+}
+
+// Instrument installs t on srv. Any ConnState hook already set on srv is
+// still called. TLS handshake failures are counted by intercepting the
+// server's error log; messages are still written to srv.ErrorLog, or to
+// standard error if it is nil. Instrument must be called before srv starts
+// serving, and a ConnTracker should instrument only one server.
+func (t *ConnTracker) Instrument(srv *http.Server) {
+	next := srv.ConnState
+	srv.ConnState = func(c net.Conn, state http.ConnState) {
+		t.track(c, state)
+		if next != nil {
+			next(c, state)
+		}
+	}
+	out := log.New(os.Stderr, "", log.LstdFlags)
+	if srv.ErrorLog != nil {
+		out = srv.ErrorLog
+	}
+	srv.ErrorLog = log.New(&tlsErrorCounter{t: t, out: out}, "", 0)
+}
+
+// track updates the counters for a connection state transition.
+func (t *ConnTracker) track(c net.Conn, state http.ConnState) {
+	var prev http.ConnState = -1
+	if v, ok := t.states.Load(c); ok {
+		prev = v.(http.ConnState)
+	}
+	if prev == http.StateActive && state != http.StateActive {
+		t.active.Add(-1)
+	}
+	switch state {
+	case http.StateNew:
+		t.accepted.Add(1)
+		t.open.Add(1)
+	case http.StateActive:
+		if prev != http.StateActive {
+			t.active.Add(1)
+		}
+	case http.StateHijacked, http.StateClosed:
+		t.states.Delete(c)
+		t.open.Add(-1)
+		if state == http.StateHijacked {
+			t.hijacked.Add(1)
+		} else {
+			t.closed.Add(1)
+		}
+		return
+	}
+	t.states.Store(c, state)
+}
+
+// Stats returns the current statistics.
+func (t *ConnTracker) Stats() ConnStats {
+	return ConnStats{
+		Accepted:           t.accepted.Load(),
+		Open:               t.open.Load(),
+		Active:             t.active.Load(),
+		Hijacked:           t.hijacked.Load(),
+		Closed:             t.closed.Load(),
+		TLSHandshakeErrors: t.tlsErrors.Load(),
+	}
+}
+
+// LogValue implements slog.LogValuer, logging the listener name and statistics.
+func (t *ConnTracker) LogValue() slog.Value {
+	s := t.Stats()
+	return slog.GroupValue(
+		slog.String("listener", t.name),
+		slog.Int64("accepted", s.Accepted),
+		slog.Int64("open", s.Open),
+		slog.Int64("active", s.Active),
+		slog.Int64("hijacked", s.Hijacked),
+		slog.Int64("closed", s.Closed),
+		slog.Int64("tls_handshake_errors", s.TLSHandshakeErrors),
+	)
+}
+
+// tlsErrorCounter counts the TLS handshake errors net/http reports to the
+// server's error log before passing each message on.
+type tlsErrorCounter struct {
+	t   *ConnTracker
+	out *log.Logger
+}
+
+func (w *tlsErrorCounter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("TLS handshake error")) {
+		w.t.tlsErrors.Add(1)
+	}
+	w.out.Output(2, string(p))
+	return len(p), nil
+}
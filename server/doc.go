@@ -20,9 +20,57 @@
 //
 // The Run function handles all server lifecycle management including:
 //   - Loading configuration from environment variables
+//   - Setting the Go memory limit from the container's limit (TuneRuntime)
 //   - Starting the HTTP server in a goroutine
-//   - Listening for interrupt signals (SIGINT / Ctrl+C)
-//   - Performing graceful shutdown with a 10-second timeout
+//   - Listening for shutdown signals (SIGINT / Ctrl+C, SIGTERM)
+//   - Reloading configuration on SIGHUP and dumping goroutine stacks on SIGUSR1
+//     (Unix only), plus application handlers registered with WithSignalHandler
+//   - Performing graceful shutdown with a 10-second timeout (4 seconds on
+//     Windows, where console close and system shutdown events arrive as SIGTERM)
+//
+// Run listens on tcp ":PORT" by default. LISTEN_NETWORK and LISTEN_ADDRESS
+// select another address or a unix socket, and a socket passed by systemd
+// socket activation (LISTEN_FDS) is used in preference; Listen returns the
+// same listener for servers managed by hand.
+//
+// With H2C set, the server also accepts HTTP/2 over cleartext, as spoken by
+// gRPC clients and load balancers in front of servers without TLS;
+// HTTP2_MAX_CONCURRENT_STREAMS and HTTP2_READ_IDLE_TIMEOUT tune HTTP/2.
+//
+// WithReadyFunc reports the bound address once Run's listeners are bound,
+// for tests and orchestration code, including the port chosen for PORT=0.
+//
+// SelfTest starts the server on an ephemeral port, runs the smoke checks
+// registered with WithSmokeCheck, prints a report and returns an error on
+// failure, for container healthchecks and CI; SelfTestFlag defines -selftest.
+//
+// When ADMIN_PORT is set, Run also serves an admin.Handler with pprof, log
+// level and configuration endpoints on that port; WithAdminHandler mounts more.
+// WithMaintenance adds a maintenance mode switch there, which makes the main
+// server answer 503 while it is on.
+//
+// A ConnTracker counts the connections of a server (accepted, open, active,
+// hijacked, closed and failed TLS handshakes) so that operators running
+// several listeners can tell which is misbehaving. Run instruments its server
+// with trackers passed to WithConnTracker and logs their counts on shutdown.
+//
+// WithHealth mounts the /healthz and /readyz endpoints of a health.Health in
+// front of the application's handler.
+//
+// WithLifecycle starts the components of a lifecycle.Lifecycle in dependency
+// order before Run listens, and stops them in reverse once it has shut down.
+// With WithStartupGate, Run listens first and answers 503 problems with
+// Retry-After until they, and an optional warmup, have finished, so load
+// balancers are not refused connections during boot.
+//
+// Shutdown hooks registered with WithShutdownHook run in order after the
+// servers have shut down, each with its own timeout, to close database pools,
+// flush logs or deregister from service discovery. Run returns their errors.
+//
+// RunGroup serves several http.Servers in one process, such as a public API
+// and an internal metrics listener, with the same signal handling and
+// shutdown hooks; if any server fails, all are shut down together and its
+// error is returned.
 //
 // For more control over the server instance, use NewServerWithConfig to
 // create an *http.Server and manage its lifecycle manually.
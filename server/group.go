@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// RunGroup serves several http.Servers in one process, such as a public API
+// on :8080 and an internal metrics listener on :9090, with shared signal
+// handling and coordinated shutdown:
+//
+//	api := &http.Server{Addr: ":8080", Handler: apiMux}
+//	internal := &http.Server{Addr: ":9090", Handler: internalMux}
+//	if err := server.RunGroup(ctx, []*http.Server{api, internal}); err != nil {
+//	    log.Fatal(err)
+//	}
+//
+// Servers whose TLSConfig has certificates (Certificates or GetCertificate)
+// are served with TLS. Unlike Run, RunGroup does not create servers from the
+// environment: configure them yourself, for example starting from
+// NewServerWithConfig.
+//
+// RunGroup blocks until ctx is cancelled, SIGINT or SIGTERM is received, or
+// any server fails to listen or serve. All servers are then shut down
+// together, the hooks registered with WithShutdownHook run and a default
+// logger installed with logging.WithAsync is flushed, all within one
+// shutdown timeout. WithSignalHandler, WithReloadHandler,
+// WithConfigWatcher, WithLifecycle and WithConnTracker (which instruments
+// every server) apply as in Run, and WithReadyFunc is called as each server
+// is bound; WithHealth, WithAdminHandler and WithStartupGate do not, as
+// RunGroup mounts nothing itself.
+//
+// It returns the first server's failure, if any, joined with the errors of
+// the lifecycle components and the shutdown hooks.
+func RunGroup(ctx context.Context, servers []*http.Server, opts ...Option) error {
+	if len(servers) == 0 {
+		return errors.New("server: RunGroup needs at least one server")
+	}
+	var options runOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, shutdownSignals...)
+	defer cancel()
+
+	logger := slog.Default()
+	for _, t := range options.connTrackers {
+		for _, srv := range servers {
+			t.Instrument(srv)
+		}
+	}
+	if options.lifecycle != nil {
+		if err := options.lifecycle.Start(ctx); err != nil {
+			return err
+		}
+	}
+	dispatchSignals := notifySignals(&options)
+
+	serveErrs := make(chan error, len(servers))
+	var serving sync.WaitGroup
+	for _, srv := range servers {
+		serving.Go(func() {
+			if err := listenAndServe(srv, &options); err != nil && err != http.ErrServerClosed {
+				logger.Error("server failed", slog.String("address", srv.Addr), slog.String("error", err.Error()))
+				serveErrs <- fmt.Errorf("server %s: %w", srv.Addr, err)
+				cancel()
+			}
+		})
+	}
+
+	var signals sync.WaitGroup
+	signals.Go(func() { dispatchSignals(ctx) })
+	<-ctx.Done()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	var shutdown sync.WaitGroup
+	for _, srv := range servers {
+		shutdown.Go(func() {
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				fmt.Fprintf(os.Stderr, "error shutting down http server %s: %s\n", srv.Addr, err)
+			}
+		})
+	}
+	shutdown.Wait()
+	serving.Wait()
+	signals.Wait()
+	for _, t := range options.connTrackers {
+		logger.Info("connections drained", slog.Any("connections", t))
+	}
+	var hookErr error
+	if options.lifecycle != nil {
+		hookErr = options.lifecycle.Stop(shutdownCtx)
+	}
+	hookErr = errors.Join(hookErr, runShutdownHooks(shutdownCtx, options.shutdownHooks, logger))
+	flushLogs(shutdownCtx)
+
+	var serveErr error
+	select {
+	case serveErr = <-serveErrs:
+	default:
+	}
+	return errors.Join(serveErr, hookErr)
+}
+
+// listenAndServe serves srv, with TLS if its TLSConfig has certificates,
+// calling the WithReadyFunc functions once it is bound.
+func listenAndServe(srv *http.Server, opts *runOptions) error {
+	tc := srv.TLSConfig
+	useTLS := tc != nil && (len(tc.Certificates) > 0 || tc.GetCertificate != nil)
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":http"
+		if useTLS {
+			addr = ":https"
+		}
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	// Record the bound address, such as the port chosen for ":0", so ready
+	// functions can tell the servers apart.
+	srv.Addr = ln.Addr().String()
+	slog.Default().Info("server listening", slog.String("address", srv.Addr))
+	notifyReady(opts, ln.Addr())
+	if useTLS {
+		return srv.ServeTLS(ln, "", "")
+	}
+	return srv.Serve(ln)
+}
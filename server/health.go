@@ -0,0 +1,25 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/harrydayexe/GoWebUtilities/health"
+)
+
+// WithHealth makes Run serve h's GET /healthz and GET /readyz endpoints in
+// front of the handler passed to Run, so probes bypass the application's
+// middleware (and its request logs). Other requests, including other methods
+// on those paths, reach the handler.
+func WithHealth(h *health.Health) Option {
+	return func(o *runOptions) {
+		o.health = h
+	}
+}
+
+// withHealthEndpoints returns handler with h's endpoints mounted in front.
+func withHealthEndpoints(h *health.Health, handler http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	h.Register(mux)
+	mux.Handle("/", handler)
+	return mux
+}
@@ -0,0 +1,15 @@
+package server
+
+import "github.com/harrydayexe/GoWebUtilities/lifecycle"
+
+// WithLifecycle makes Run start the components of l, in dependency order,
+// before it binds its listeners, and stop them, in reverse order, once the
+// servers have shut down and before the hooks registered with
+// WithShutdownHook run. If a component fails to start, Run stops the ones
+// already started and returns the error without serving. A signal or the
+// cancellation of ctx during startup interrupts the component starting.
+func WithLifecycle(l *lifecycle.Lifecycle) Option {
+	return func(o *runOptions) {
+		o.lifecycle = l
+	}
+}
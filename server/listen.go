@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket
+// activation; see sd_listen_fds(3).
+const listenFDsStart = 3
+
+// Listen returns the listener Run serves on, for use with http.Server.Serve
+// when managing a server from NewServerWithConfig yourself:
+//
+//	ln, err := server.Listen(cfg)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	httpServer.Serve(ln)
+//
+// If the process was started by systemd socket activation (LISTEN_PID is the
+// process ID and LISTEN_FDS is at least 1), the first inherited socket is
+// used and the LISTEN_* variables are unset, so child processes do not
+// inherit them. Otherwise Listen listens on cfg.ListenNetwork and
+// cfg.ListenAddress, by default tcp on ":PORT". For a unix socket, a stale
+// socket file left by a previous process that no longer accepts connections
+// is removed first; the socket file is removed again when the listener is
+// closed.
+func Listen(cfg config.ServerConfig) (net.Listener, error) {
+	ln, err := inheritedListener(listenFDsStart)
+	if ln != nil || err != nil {
+		return ln, err
+	}
+	network, address := cfg.ListenAddr()
+	if network == "unix" {
+		if err := removeStaleSocket(address); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen(network, address)
+}
+
+// inheritedListener returns the listener passed by systemd socket activation
+// at file descriptor fd, or nil if there is none.
+func inheritedListener(fd int) (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+	defer f.Close() // FileListener holds its own copy
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("server: inheriting systemd socket: %w", err)
+	}
+	return ln, nil
+}
+
+// removeStaleSocket removes the unix socket file at path if nothing accepts
+// connections on it. Files that are not sockets are left for net.Listen to
+// report.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&fs.ModeSocket == 0 {
+		return nil
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil // in use; net.Listen reports it
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("server: removing stale socket: %w", err)
+	}
+	return nil
+}
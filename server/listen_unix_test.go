@@ -0,0 +1,178 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+)
+
+// socketPath returns a unix socket path in a fresh directory, short enough
+// for the platform's limit on socket path length.
+func socketPath(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "s.sock")
+}
+
+// unixClient returns an http.Client connecting to the unix socket at path.
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestListen_UnixSocket(t *testing.T) {
+	path := socketPath(t)
+	cfg := config.ServerConfig{ListenNetwork: "unix", ListenAddress: path}
+
+	ln, err := Listen(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ln.Addr().Network() != "unix" || ln.Addr().String() != path {
+		t.Errorf("listening on %s %s, want unix %s", ln.Addr().Network(), ln.Addr(), path)
+	}
+
+	// A second listener fails while the socket is in use.
+	if ln2, err := Listen(cfg); err == nil {
+		ln2.Close()
+		t.Error("expected an error listening on a socket in use")
+	}
+	ln.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the socket file to be removed on close, got %v", err)
+	}
+}
+
+func TestListen_RemovesStaleSocket(t *testing.T) {
+	path := socketPath(t)
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Leave the socket file behind, as a crashed process would.
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := Listen(config.ServerConfig{ListenNetwork: "unix", ListenAddress: path})
+	if err != nil {
+		t.Fatalf("expected the stale socket to be replaced, got %v", err)
+	}
+	ln.Close()
+
+	// Regular files are not removed.
+	if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if ln, err := Listen(config.ServerConfig{ListenNetwork: "unix", ListenAddress: path}); err == nil {
+		ln.Close()
+		t.Error("expected an error listening on a regular file")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected the regular file to be kept, got %v", err)
+	}
+}
+
+func TestListen_SystemdSocket(t *testing.T) {
+	orig, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orig.Close()
+	f, err := orig.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// inheritedListener closes the descriptor it is given, as it would
+	// systemd's, so pass it a copy.
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "http")
+	ln, err := inheritedListener(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ln == nil {
+		t.Fatal("expected the inherited listener")
+	}
+	defer ln.Close()
+	if ln.Addr().String() != orig.Addr().String() {
+		t.Errorf("inherited listener on %s, want %s", ln.Addr(), orig.Addr())
+	}
+	for _, v := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if _, ok := os.LookupEnv(v); ok {
+			t.Errorf("expected %s to be unset", v)
+		}
+	}
+
+	// Variables meant for another process are ignored.
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+	if ln, err := inheritedListener(fd); ln != nil || err != nil {
+		t.Errorf("inheritedListener() = %v, %v, want nil, nil", ln, err)
+	}
+}
+
+// TestRun_UnixSocket verifies that Run serves on LISTEN_ADDRESS when
+// LISTEN_NETWORK is unix.
+func TestRun_UnixSocket(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	path := socketPath(t)
+	clearServerEnvVars(t)
+	t.Setenv("LISTEN_NETWORK", "unix")
+	t.Setenv("LISTEN_ADDRESS", path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "over unix")
+		}))
+	}()
+
+	client := unixClient(path)
+	var resp *http.Response
+	waitFor(t, func() bool {
+		var err error
+		resp, err = client.Get("http://unix/")
+		return err == nil
+	})
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "over unix" {
+		t.Errorf("body = %q, want %q", body, "over unix")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	waitFor(t, func() bool {
+		_, err := os.Stat(path)
+		return os.IsNotExist(err)
+	})
+}
@@ -0,0 +1,33 @@
+package server
+
+import "net"
+
+// WithReadyFunc registers fn to be called with the address the server is
+// bound to, once Run has bound its listeners (the admin server's too) and
+// before it starts serving. Tests and orchestration code use it to learn
+// when, and where, the server accepts connections instead of sleeping and
+// hoping; with PORT=0 the address has the port the system chose:
+//
+//	ready := make(chan net.Addr, 1)
+//	go server.Run(ctx, mux, server.WithReadyFunc(func(addr net.Addr) {
+//	    ready <- addr
+//	}))
+//	addr := <-ready
+//
+// Connections made once fn is called wait until the server serves them. fn
+// is not called if Run fails to listen, and must not block, as the server
+// does not start serving until it returns. RunGroup calls fn once for each
+// server, from the server's own goroutine, after setting the server's Addr
+// to the bound address.
+func WithReadyFunc(fn func(addr net.Addr)) Option {
+	return func(o *runOptions) {
+		o.readyFuncs = append(o.readyFuncs, fn)
+	}
+}
+
+// notifyReady calls the functions registered with WithReadyFunc.
+func notifyReady(opts *runOptions, addr net.Addr) {
+	for _, fn := range opts.readyFuncs {
+		fn(addr)
+	}
+}
@@ -2,31 +2,82 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
 	"sync"
-	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+	"github.com/harrydayexe/GoWebUtilities/crashreport"
 )
 
 // Run starts the HTTP server with the provided handler and manages its lifecycle.
 //
 // This function handles the complete server lifecycle including:
 //   - Loading configuration from environment variables via NewServerWithConfig
+//   - Fitting the Go runtime to container resource limits via TuneRuntime
 //   - Starting the HTTP server in a background goroutine
-//   - Listening for SIGINT (Ctrl+C) or context cancellation
+//   - Listening for SIGINT (Ctrl+C), SIGTERM or context cancellation
 //   - Performing graceful shutdown with a 10-second timeout when interrupted
+//     (4 seconds on Windows, which terminates the process 5 seconds after a
+//     console close, logoff or shutdown event), which covers stopping
+//     components, shutdown hooks and flushing logs as well as draining
+//     requests
 //
 // The function blocks until the server is shut down, either by:
-//   - An interrupt signal (SIGINT / Ctrl+C)
+//   - An interrupt or termination signal (SIGINT / Ctrl+C, SIGTERM)
 //   - Cancellation of the provided context
 //   - A fatal error during server creation
+//   - A failure to listen, such as the port already being in use, or to serve
+//
+// While serving, Run also handles these signals on Unix systems:
+//   - SIGHUP: re-parses the configuration from the environment (or through
+//     the watcher given with WithConfigWatcher), reconfigures the default
+//     logger (e.g. a new LOG_LEVEL) and calls the handlers registered with
+//     WithReloadHandler
+//   - SIGUSR1: logs the stacks of all goroutines at INFO level
+//
+// On Windows, console close, logoff and system shutdown events are delivered
+// as SIGTERM and so also shut the server down gracefully.
+//
+// If ADMIN_PORT is set, Run also serves an admin.Handler on that port, with
+// the endpoints added by WithAdminHandler and WithMaintenance, and shuts it
+// down with the server.
+//
+// Run listens as Listen does: on LISTEN_NETWORK and LISTEN_ADDRESS, by
+// default tcp on ":PORT", which may instead be a unix socket, or on a socket
+// inherited through systemd socket activation.
+//
+// With WithHealth, Run serves the liveness and readiness endpoints of a
+// health.Health in front of the handler.
 //
-// Returns an error only if server creation fails (e.g., invalid configuration).
-// Errors from ListenAndServe or Shutdown are written to stderr but do not
-// cause the function to return an error, as they can occur during normal shutdown.
+// Applications add their own behaviour for these or any other signal, such as
+// a zero-downtime restart on SIGUSR2, with WithSignalHandler.
+//
+// With WithLifecycle, Run starts the components of a lifecycle.Lifecycle
+// before listening and stops them once the servers have shut down. With
+// WithStartupGate, it listens first and answers 503 until they have started.
+//
+// Once the servers have shut down, Run calls the hooks registered with
+// WithShutdownHook in order, each with its own timeout, and then flushes a
+// default logger installed with logging.WithAsync, all before the shutdown
+// deadline.
+//
+// Returns an error if server creation fails (e.g., invalid configuration),
+// if a lifecycle component or startup gate warmup fails, if the server or admin server
+// fails to listen or serve, or if any lifecycle component or shutdown hook
+// fails to stop; these errors are joined. Listeners are bound before anything
+// is served, so an address already in use makes Run shut down and return
+// at once, after running the shutdown hooks, rather than block with nothing
+// serving. Errors from Shutdown are written to stderr but do not cause the
+// function to return an error, as they can occur during normal shutdown.
+// If CRASH_DIR is set, a listen or serve failure also writes a crash report
+// with the stacks of all goroutines to that directory.
 //
 // Example usage:
 //
@@ -42,39 +93,178 @@ import (
 func Run(
 	ctx context.Context,
 	srv http.Handler,
+	opts ...Option,
 ) error {
-	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	var options runOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, shutdownSignals...)
 	defer cancel()
 
 	logger := slog.Default()
 
-	httpServer, err := NewServerWithConfig(srv)
+	if options.maintenance != nil {
+		srv = options.maintenance.Middleware()(srv)
+	}
+	if options.health != nil {
+		srv = withHealthEndpoints(options.health, srv)
+	}
+	httpServer, cfg, err := newServerFromEnv(srv)
 	if err != nil {
 		return fmt.Errorf("failed to create server with config from environment: %w", err)
 	}
+	if options.selfTest {
+		// A self test serves on an ephemeral loopback port, so it can run
+		// beside the instance it checks, and without an admin server.
+		cfg.ListenNetwork, cfg.ListenAddress = "tcp", "127.0.0.1:0"
+		cfg.AdminPort = 0
+	}
+	adminServer, err := newAdminServer(cfg, &options)
+	if err != nil {
+		return fmt.Errorf("failed to create admin server: %w", err)
+	}
+	TuneRuntime(cfg)
+	for _, t := range options.connTrackers {
+		t.Instrument(httpServer)
+	}
+	var gate *startupGate
+	if options.startupGate != nil && !options.selfTest {
+		gate = &startupGate{opts: *options.startupGate, liveness: options.health != nil}
+		httpServer.Handler = gate.wrap(httpServer.Handler)
+	} else if options.lifecycle != nil {
+		if err := options.lifecycle.Start(ctx); err != nil {
+			return err
+		}
+	}
+	dispatchSignals := notifySignals(&options)
 
-	go func() {
+	// A failure to start, listen or serve shuts everything down, and Run
+	// returns it.
+	serveErrs := make(chan error, 3)
+	var starting sync.WaitGroup
+	fail := func(err error) {
+		logger.Error("server failed", slog.String("error", err.Error()))
+		writeCrashReport(cfg, err)
+		serveErrs <- err
+		cancel()
+	}
+	if ln, adminLn, err := listen(cfg, adminServer, options.selfTest); err != nil {
+		fail(err)
+	} else {
 		logger.Info(
 			"server listening",
-			slog.String("address", httpServer.Addr),
+			slog.String("network", ln.Addr().Network()),
+			slog.String("address", ln.Addr().String()),
 		)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fmt.Fprintf(os.Stderr, "error listening and serving: %s\n", err)
+		notifyReady(&options, ln.Addr())
+		go func() {
+			if err := httpServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+				fail(err)
+			}
+		}()
+		if adminLn != nil {
+			go func() {
+				if err := serveAdmin(adminServer, adminLn, cfg); err != nil {
+					fail(fmt.Errorf("admin server: %w", err))
+				}
+			}()
 		}
-	}()
+		if gate != nil {
+			starting.Go(func() {
+				if err := gate.start(ctx, &options); err != nil {
+					logger.Error("startup failed", slog.String("error", err.Error()))
+					serveErrs <- err
+					cancel()
+					return
+				}
+				logger.Info("startup complete, serving requests")
+			})
+		}
+	}
+	var hookErr error
 	var wg sync.WaitGroup
-	wg.Add(1)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		dispatchSignals(ctx)
+	}()
 	go func() {
 		defer wg.Done()
 		// wait for ctx cancellation
 		<-ctx.Done()
-		// make a new context for the Shutdown
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		// One deadline for the whole shutdown sequence: draining requests,
+		// stopping components, hooks and flushing logs.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 		defer cancel()
 		if err := httpServer.Shutdown(shutdownCtx); err != nil {
 			fmt.Fprintf(os.Stderr, "error shutting down http server: %s\n", err)
 		}
+		if adminServer != nil {
+			if err := adminServer.Shutdown(shutdownCtx); err != nil {
+				fmt.Fprintf(os.Stderr, "error shutting down admin server: %s\n", err)
+			}
+		}
+		for _, t := range options.connTrackers {
+			logger.Info("connections drained", slog.Any("connections", t))
+		}
+		// Components started behind the gate must have finished starting
+		// before they can be stopped.
+		starting.Wait()
+		if options.lifecycle != nil {
+			hookErr = options.lifecycle.Stop(shutdownCtx)
+		}
+		hookErr = errors.Join(hookErr, runShutdownHooks(shutdownCtx, options.shutdownHooks, logger))
+		flushLogs(shutdownCtx)
 	}()
 	wg.Wait()
-	return nil
+
+	var serveErr error
+	select {
+	case serveErr = <-serveErrs:
+	default:
+	}
+	return errors.Join(serveErr, hookErr)
+}
+
+// listen binds the listeners of the server and, if there is one, the admin
+// server before either serves, so that an address already in use is
+// reported at once. A self test never takes over a socket passed by systemd.
+func listen(cfg config.ServerConfig, adminServer *http.Server, selfTest bool) (ln, adminLn net.Listener, err error) {
+	if selfTest {
+		ln, err = net.Listen(cfg.ListenAddr())
+	} else {
+		ln, err = Listen(cfg)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if adminServer != nil {
+		if adminLn, err = net.Listen("tcp", adminServer.Addr); err != nil {
+			ln.Close()
+			return nil, nil, fmt.Errorf("admin server: %w", err)
+		}
+	}
+	return ln, adminLn, nil
+}
+
+// writeCrashReport writes a crash report for a fatal server error to
+// cfg.CrashDir, if set, including the stacks of all goroutines.
+func writeCrashReport(cfg config.ServerConfig, err error) {
+	if cfg.CrashDir == "" {
+		return
+	}
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	path, werr := crashreport.Write(cfg.CrashDir, crashreport.Report{
+		Reason: fmt.Sprintf("server error: %v", err),
+		Stack:  buf,
+		Config: cfg,
+	})
+	if werr != nil {
+		fmt.Fprintf(os.Stderr, "error writing crash report: %s\n", werr)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "crash report written to %s\n", path)
 }
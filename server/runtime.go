@@ -0,0 +1,125 @@
+package server
+
+import (
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+)
+
+// cgroupRoot is the mount point of the cgroup filesystem.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// procSelfCgroup lists the cgroups of the current process.
+const procSelfCgroup = "/proc/self/cgroup"
+
+// memoryLimitRatio is the fraction of the container memory limit given to the
+// Go runtime as its soft memory limit. The remainder is headroom for memory
+// the runtime does not account for, such as cgo allocations and OS buffers.
+const memoryLimitRatio = 0.9
+
+// TuneRuntime adapts the Go runtime to the resource limits of the container
+// it is running in, and logs the resulting values at INFO level.
+//
+// GOMAXPROCS needs no adjustment: since Go 1.25 the runtime derives its
+// default from the cgroup CPU limit and tracks changes to it, so TuneRuntime
+// only reports the value in use.
+//
+// If the GOMEMLIMIT environment variable is not set and a cgroup (v1 or v2)
+// memory limit applies to the process, the runtime's soft memory limit is set
+// to 90% of it. The garbage collector then works harder as memory use nears
+// the limit instead of the process being OOM-killed.
+//
+// TuneRuntime does nothing if cfg.TuneRuntime is false. Run calls it at
+// startup; call it directly when managing the server lifecycle manually.
+func TuneRuntime(cfg config.ServerConfig) {
+	if !cfg.TuneRuntime {
+		return
+	}
+	tuneRuntime(cgroupRoot, procSelfCgroup)
+}
+
+// tuneRuntime implements TuneRuntime, reading cgroup limits below root for
+// the cgroups listed in procCgroup. It returns the memory limit in effect
+// afterwards.
+func tuneRuntime(root, procCgroup string) int64 {
+	source := "default"
+	if os.Getenv("GOMEMLIMIT") != "" {
+		source = "GOMEMLIMIT"
+	} else if limit, ok := cgroupMemoryLimit(root, procCgroup); ok {
+		debug.SetMemoryLimit(int64(float64(limit) * memoryLimitRatio))
+		source = "cgroup"
+	}
+
+	// A negative input reads the current limit without changing it.
+	memLimit := debug.SetMemoryLimit(-1)
+	attrs := []any{
+		slog.Int("gomaxprocs", runtime.GOMAXPROCS(0)),
+		slog.String("memory_limit_source", source),
+	}
+	if memLimit != math.MaxInt64 {
+		attrs = append(attrs, slog.Int64("gomemlimit", memLimit))
+	}
+	slog.Default().Info("runtime tuned", attrs...)
+	return memLimit
+}
+
+// cgroupMemoryLimit returns the memory limit, in bytes, of the process's
+// cgroup below the cgroup filesystem mounted at root, checking the files
+// cgroupMemoryFiles lists in turn. It returns false if none exists or the
+// first that does sets no limit.
+func cgroupMemoryLimit(root, procCgroup string) (int64, bool) {
+	for _, name := range cgroupMemoryFiles(procCgroup) {
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			continue
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "max" {
+			return 0, false
+		}
+		limit, err := strconv.ParseInt(value, 10, 64)
+		// cgroup v1 reports "unlimited" as a page-aligned value near MaxInt64.
+		if err != nil || limit <= 0 || limit >= 1<<62 {
+			return 0, false
+		}
+		return limit, true
+	}
+	return 0, false
+}
+
+// cgroupMemoryFiles returns the memory limit files to check, relative to the
+// cgroup root: those of the process's own cgroup, read from procCgroup
+// (/proc/self/cgroup), and then those at the root, which is where a
+// container's cgroup is mounted when it has its own cgroup namespace. The
+// own cgroup matters outside containers, such as for a systemd service with
+// MemoryMax, whose limit is not on the root.
+func cgroupMemoryFiles(procCgroup string) []string {
+	var files []string
+	if data, err := os.ReadFile(procCgroup); err == nil {
+		for line := range strings.Lines(string(data)) {
+			// hierarchy-ID:controllers:path
+			fields := strings.SplitN(strings.TrimSpace(line), ":", 3)
+			if len(fields) != 3 || fields[2] == "/" {
+				continue
+			}
+			switch {
+			case fields[0] == "0" && fields[1] == "": // cgroup v2
+				files = append(files, filepath.Join(fields[2], "memory.max"))
+			case slices.Contains(strings.Split(fields[1], ","), "memory"): // cgroup v1
+				files = append(files, filepath.Join("memory", fields[2], "memory.limit_in_bytes"))
+			}
+		}
+	}
+	return append(files,
+		"memory.max",                   // cgroup v2
+		"memory/memory.limit_in_bytes", // cgroup v1
+	)
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// SmokeCheck is a request SelfTest makes to the running server, and the
+// response it expects.
+type SmokeCheck struct {
+	// Name identifies the check in the report. Defaults to the method and
+	// path.
+	Name string
+	// Method defaults to GET.
+	Method string
+	// Path is the request path, with any query, such as "/users?limit=1".
+	Path string
+	// Header is added to the request, for example to authenticate it.
+	Header http.Header
+	// Body is the request body.
+	Body string
+	// Status is the expected response status. Defaults to 200.
+	Status int
+	// Check, if set, inspects the response further once its status matched,
+	// returning an error to fail the check. The body is closed afterwards.
+	Check func(resp *http.Response) error
+}
+
+// name returns the check's name in the report.
+func (c SmokeCheck) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.method() + " " + c.Path
+}
+
+// method returns the check's request method.
+func (c SmokeCheck) method() string {
+	if c.Method == "" {
+		return http.MethodGet
+	}
+	return c.Method
+}
+
+// WithSmokeCheck registers a check SelfTest runs against the server. Run
+// ignores it.
+func WithSmokeCheck(c SmokeCheck) Option {
+	return func(o *runOptions) {
+		o.smokeChecks = append(o.smokeChecks, c)
+	}
+}
+
+// selfTestTimeout bounds each smoke check request.
+const selfTestTimeout = 10 * time.Second
+
+// SelfTest starts the server as Run does, with the same handler, options and
+// environment configuration, but on an ephemeral loopback port and without
+// the admin server. It then runs the smoke checks registered with
+// WithSmokeCheck, preceded by the liveness and readiness endpoints if
+// WithHealth is given, prints a report to stdout, shuts the server down and
+// returns an error if the server failed to start or any check failed.
+//
+// Because it exercises the real handler, configuration and shutdown hooks,
+// a binary can check itself as a container healthcheck or a CI smoke test.
+// SelfTestFlag adds a -selftest flag to select it:
+//
+//	selfTest := server.SelfTestFlag(flag.CommandLine)
+//	flag.Parse()
+//	opts := []server.Option{
+//	    server.WithHealth(h),
+//	    server.WithSmokeCheck(server.SmokeCheck{Path: "/users?limit=1"}),
+//	}
+//	if *selfTest {
+//	    if err := server.SelfTest(ctx, mux, opts...); err != nil {
+//	        os.Exit(1)
+//	    }
+//	    return
+//	}
+//	if err := server.Run(ctx, mux, opts...); err != nil {
+//	    log.Fatal(err)
+//	}
+func SelfTest(ctx context.Context, srv http.Handler, opts ...Option) error {
+	return selfTest(ctx, os.Stdout, srv, opts...)
+}
+
+// SelfTestFlag defines the -selftest flag on fs, typically flag.CommandLine,
+// and returns its value, which is true when the process should run SelfTest
+// instead of Run.
+func SelfTestFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("selftest", false, "start the server on an ephemeral port, run its smoke checks and exit")
+}
+
+// selfTest implements SelfTest, writing the report to w.
+func selfTest(ctx context.Context, w io.Writer, srv http.Handler, opts ...Option) error {
+	var options runOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	checks := options.smokeChecks
+	if options.health != nil {
+		checks = append([]SmokeCheck{
+			{Name: "liveness", Path: "/healthz"},
+			{Name: "readiness", Path: "/readyz"},
+		}, checks...)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ready := make(chan net.Addr, 1)
+	done := make(chan error, 1)
+	opts = append(opts[:len(opts):len(opts)],
+		func(o *runOptions) { o.selfTest = true },
+		WithReadyFunc(func(addr net.Addr) { ready <- addr }),
+	)
+	go func() { done <- Run(ctx, srv, opts...) }()
+
+	var addr net.Addr
+	select {
+	case addr = <-ready:
+	case err := <-done:
+		fmt.Fprintf(w, "selftest: FAIL server did not start: %v\n", err)
+		return fmt.Errorf("selftest: server did not start: %w", err)
+	}
+
+	client := &http.Client{Timeout: selfTestTimeout}
+	base := "http://" + addr.String()
+	var errs []error
+	for _, c := range checks {
+		start := time.Now()
+		err := runSmokeCheck(ctx, client, base, c)
+		elapsed := time.Since(start).Round(time.Microsecond)
+		if err != nil {
+			fmt.Fprintf(w, "selftest: FAIL %s (%s): %v\n", c.name(), elapsed, err)
+			errs = append(errs, fmt.Errorf("%s: %w", c.name(), err))
+			continue
+		}
+		fmt.Fprintf(w, "selftest: PASS %s (%s)\n", c.name(), elapsed)
+	}
+	fmt.Fprintf(w, "selftest: %d of %d checks passed\n", len(checks)-len(errs), len(checks))
+
+	cancel()
+	if err := <-done; err != nil {
+		errs = append(errs, fmt.Errorf("selftest: shutting down: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// runSmokeCheck makes c's request to the server at base and checks the
+// response.
+func runSmokeCheck(ctx context.Context, client *http.Client, base string, c SmokeCheck) error {
+	var body io.Reader
+	if c.Body != "" {
+		body = strings.NewReader(c.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.method(), base+c.Path, body)
+	if err != nil {
+		return err
+	}
+	for k, vs := range c.Header {
+		req.Header[k] = append(req.Header[k], vs...)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	want := c.Status
+	if want == 0 {
+		want = http.StatusOK
+	}
+	if resp.StatusCode != want {
+		return fmt.Errorf("status %d, want %d", resp.StatusCode, want)
+	}
+	if c.Check != nil {
+		return c.Check(resp)
+	}
+	return nil
+}
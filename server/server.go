@@ -1,8 +1,10 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"time"
 
@@ -13,39 +15,82 @@ import (
 // NewServerWithConfig creates a new http.Server configured from environment variables.
 //
 // The server is configured using config.ServerConfig, which loads settings for:
-//   - Port (env: PORT, default: 8080)
+//   - Port (env: PORT, default: 8080), or ListenAddress (env: LISTEN_ADDRESS)
 //   - ReadTimeout (env: READ_TIMEOUT, default: 15 seconds)
 //   - WriteTimeout (env: WRITE_TIMEOUT, default: 15 seconds)
 //   - IdleTimeout (env: IDLE_TIMEOUT, default: 60 seconds)
+//   - H2C (env: H2C, default: false): also accept HTTP/2 over cleartext
+//   - HTTP/2 tuning (env: HTTP2_MAX_CONCURRENT_STREAMS, HTTP2_READ_IDLE_TIMEOUT)
 //   - Environment (env: ENVIRONMENT, default: "local")
 //
 // As a side effect, NewServerWithConfig calls logging.SetDefaultLogger to configure
 // the global slog logger based on the parsed environment and log level.
 //
+// The parsed configuration is attached to the context of every request served,
+// so handlers and middleware (such as middleware.When) can read it with
+// config.FromContext.
+//
 // The function returns an error if the configuration cannot be parsed or validated.
 // Common error cases include an unrecognised ENVIRONMENT value.
 //
 // The returned server is ready to use with ListenAndServe or Shutdown methods.
+// To serve on a unix socket or a socket inherited from systemd, as Run does,
+// pass the listener returned by Listen to its Serve method instead.
 // For automatic lifecycle management with graceful shutdown, use the Run function instead.
 //
 // This function is safe for concurrent use.
 func NewServerWithConfig(handler http.Handler) (*http.Server, error) {
+	httpServer, _, err := newServerFromEnv(handler)
+	return httpServer, err
+}
+
+// newServerFromEnv implements NewServerWithConfig, also returning the parsed
+// configuration for callers such as Run that need it.
+func newServerFromEnv(handler http.Handler) (*http.Server, config.ServerConfig, error) {
 	cfg, err := config.ParseConfig[config.ServerConfig]()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create config from environment: %w", err)
+		return nil, cfg, fmt.Errorf("failed to create config from environment: %w", err)
 	}
 
 	logging.SetDefaultLogger(cfg)
+	httpServer := NewServerFromConfig(cfg, handler)
+	slog.Default().Info("created server", slog.String("environment", cfg.Environment.String()))
+
+	return httpServer, cfg, nil
+}
 
+// NewServerFromConfig creates an http.Server as NewServerWithConfig does, but
+// from an already parsed cfg, such as one read with a variable prefix by
+// config.ParseConfigWithPrefix. It neither reads the environment nor
+// configures the default logger.
+func NewServerFromConfig(cfg config.ServerConfig, handler http.Handler) *http.Server {
+	addr := fmt.Sprintf(":%d", cfg.Port)
+	if network, address := cfg.ListenAddr(); network != "unix" {
+		addr = address
+	}
 	httpServer := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.Port),
+		Addr:         addr,
 		Handler:      handler,
 		ReadTimeout:  time.Duration(cfg.ReadTimeout) * time.Second,
 		WriteTimeout: time.Duration(cfg.WriteTimeout) * time.Second,
 		IdleTimeout:  time.Duration(cfg.IdleTimeout) * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return config.NewContext(context.Background(), cfg)
+		},
 	}
 
-	slog.Default().Info("created server", slog.String("environment", cfg.Environment.String()))
-
-	return httpServer, nil
+	if cfg.HTTP2MaxConcurrentStreams > 0 || cfg.HTTP2ReadIdleTimeout > 0 {
+		httpServer.HTTP2 = &http.HTTP2Config{
+			MaxConcurrentStreams: cfg.HTTP2MaxConcurrentStreams,
+			SendPingTimeout:      time.Duration(cfg.HTTP2ReadIdleTimeout) * time.Second,
+		}
+	}
+	if cfg.H2C {
+		// HTTP/2 over TLS stays enabled for servers given a certificate.
+		httpServer.Protocols = new(http.Protocols)
+		httpServer.Protocols.SetHTTP1(true)
+		httpServer.Protocols.SetHTTP2(true)
+		httpServer.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return httpServer
 }
@@ -2,16 +2,29 @@ package server
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"log"
 	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/admin"
+	"github.com/harrydayexe/GoWebUtilities/config"
+	"github.com/harrydayexe/GoWebUtilities/health"
+	"github.com/harrydayexe/GoWebUtilities/lifecycle"
+	"github.com/harrydayexe/GoWebUtilities/logging"
 )
 
 // Helper Functions
@@ -19,7 +32,7 @@ import (
 // clearServerEnvVars clears all server configuration environment variables
 func clearServerEnvVars(t *testing.T) {
 	t.Helper()
-	envVars := []string{"PORT", "READ_TIMEOUT", "WRITE_TIMEOUT", "IDLE_TIMEOUT", "ENVIRONMENT", "LOG_LEVEL"}
+	envVars := []string{"PORT", "READ_TIMEOUT", "WRITE_TIMEOUT", "IDLE_TIMEOUT", "ENVIRONMENT", "LOG_LEVEL", "ADMIN_PORT", "ADMIN_TOKEN", "LISTEN_NETWORK", "LISTEN_ADDRESS", "LISTEN_PID", "LISTEN_FDS", "H2C", "HTTP2_MAX_CONCURRENT_STREAMS", "HTTP2_READ_IDLE_TIMEOUT"}
 	for _, v := range envVars {
 		t.Setenv(v, "")
 	}
@@ -28,7 +41,7 @@ func clearServerEnvVars(t *testing.T) {
 // clearOtherServerEnvVars clears all server env vars except PORT
 func clearOtherServerEnvVars(t *testing.T) {
 	t.Helper()
-	envVars := []string{"READ_TIMEOUT", "WRITE_TIMEOUT", "IDLE_TIMEOUT", "ENVIRONMENT", "LOG_LEVEL"}
+	envVars := []string{"READ_TIMEOUT", "WRITE_TIMEOUT", "IDLE_TIMEOUT", "ENVIRONMENT", "LOG_LEVEL", "ADMIN_PORT", "ADMIN_TOKEN", "LISTEN_NETWORK", "LISTEN_ADDRESS", "LISTEN_PID", "LISTEN_FDS", "H2C", "HTTP2_MAX_CONCURRENT_STREAMS", "HTTP2_READ_IDLE_TIMEOUT"}
 	for _, v := range envVars {
 		t.Setenv(v, "")
 	}
@@ -46,6 +59,28 @@ func findAvailablePort(t *testing.T) int {
 	return port
 }
 
+// startServer runs Run with handler and opts in the background on a port
+// chosen by the system, and waits until it is bound. It returns the
+// server's address and a channel that receives Run's result.
+func startServer(t *testing.T, ctx context.Context, handler http.Handler, opts ...Option) (string, <-chan error) {
+	t.Helper()
+	t.Setenv("PORT", "0")
+	ready := make(chan net.Addr, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, handler, append(opts, WithReadyFunc(func(addr net.Addr) { ready <- addr }))...)
+	}()
+	select {
+	case addr := <-ready:
+		return addr.String(), done
+	case err := <-done:
+		t.Fatalf("Run returned before it was ready: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server was not ready in time")
+	}
+	return "", nil
+}
+
 // assertContains checks if a string contains a substring
 func assertContains(t *testing.T, got, want string) {
 	t.Helper()
@@ -242,9 +277,6 @@ func TestRun_ContextCancellation(t *testing.T) {
 	// Suppress log output for this test
 	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
 
-	// Use high port to avoid conflicts
-	port := findAvailablePort(t)
-	t.Setenv("PORT", fmt.Sprintf("%d", port))
 	clearOtherServerEnvVars(t)
 
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -252,14 +284,7 @@ func TestRun_ContextCancellation(t *testing.T) {
 	})
 
 	ctx, cancel := context.WithCancel(context.Background())
-
-	runComplete := make(chan error, 1)
-	go func() {
-		runComplete <- Run(ctx, handler)
-	}()
-
-	// Give server time to start
-	time.Sleep(100 * time.Millisecond)
+	_, runComplete := startServer(t, ctx, handler)
 
 	// Cancel context
 	cancel()
@@ -294,8 +319,6 @@ func TestRun_GracefulShutdown(t *testing.T) {
 	// Suppress log output for this test
 	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
 
-	port := findAvailablePort(t)
-	t.Setenv("PORT", fmt.Sprintf("%d", port))
 	clearOtherServerEnvVars(t)
 
 	requestStarted := make(chan struct{})
@@ -310,17 +333,11 @@ func TestRun_GracefulShutdown(t *testing.T) {
 	})
 
 	ctx, cancel := context.WithCancel(context.Background())
-
-	go func() {
-		Run(ctx, handler)
-	}()
-
-	// Wait for server to start
-	time.Sleep(100 * time.Millisecond)
+	addr, _ := startServer(t, ctx, handler)
 
 	// Start a request in background
 	go func() {
-		resp, err := http.Get(fmt.Sprintf("http://localhost:%d/", port))
+		resp, err := http.Get("http://" + addr + "/")
 		if err != nil {
 			t.Logf("request error: %v", err)
 			return
@@ -347,8 +364,6 @@ func TestRun_MultipleShutdowns(t *testing.T) {
 	// Suppress log output for this test
 	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
 
-	port := findAvailablePort(t)
-	t.Setenv("PORT", fmt.Sprintf("%d", port))
 	clearOtherServerEnvVars(t)
 
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -356,13 +371,7 @@ func TestRun_MultipleShutdowns(t *testing.T) {
 	})
 
 	ctx, cancel := context.WithCancel(context.Background())
-
-	runComplete := make(chan error, 1)
-	go func() {
-		runComplete <- Run(ctx, handler)
-	}()
-
-	time.Sleep(100 * time.Millisecond)
+	_, runComplete := startServer(t, ctx, handler)
 
 	// Cancel multiple times
 	cancel()
@@ -379,3 +388,882 @@ func TestRun_MultipleShutdowns(t *testing.T) {
 		t.Fatal("Run did not complete within timeout")
 	}
 }
+
+func TestNewServerWithConfig_ConfigInRequestContext(t *testing.T) {
+	clearServerEnvVars(t)
+	t.Setenv("ENVIRONMENT", "test")
+
+	var got config.ServerConfig
+	var found bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, found = config.FromContext(r.Context())
+	})
+
+	srv, err := NewServerWithConfig(handler)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	ts := httptest.NewUnstartedServer(srv.Handler)
+	ts.Config.BaseContext = srv.BaseContext
+	ts.Start()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if !found {
+		t.Fatal("expected config in request context")
+	}
+	if got.Environment != config.Test {
+		t.Errorf("expected environment %q, got %q", config.Test, got.Environment)
+	}
+}
+
+func TestCgroupMemoryLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		proc   string // contents of /proc/self/cgroup
+		files  map[string]string
+		want   int64
+		wantOK bool
+	}{
+		{"v2_limit", "", map[string]string{"memory.max": "536870912\n"}, 536870912, true},
+		{"v2_unlimited", "", map[string]string{"memory.max": "max\n"}, 0, false},
+		{"v1_limit", "", map[string]string{"memory/memory.limit_in_bytes": "268435456\n"}, 268435456, true},
+		{"v1_unlimited", "", map[string]string{"memory/memory.limit_in_bytes": "9223372036854771712\n"}, 0, false},
+		{"no_cgroup", "", nil, 0, false},
+		{"malformed", "", map[string]string{"memory.max": "lots"}, 0, false},
+		{"v2_own_cgroup", "0::/system.slice/app.service\n", map[string]string{
+			"system.slice/app.service/memory.max": "134217728\n",
+			"memory.max":                          "536870912\n",
+		}, 134217728, true},
+		{"v1_own_cgroup", "12:cpu,cpuacct:/app\n4:memory:/app\n0::/app\n", map[string]string{
+			"memory/app/memory.limit_in_bytes": "67108864\n",
+		}, 67108864, true},
+		{"namespaced_falls_back_to_root", "0::/\n", map[string]string{"memory.max": "536870912\n"}, 536870912, true},
+		{"own_cgroup_not_mounted", "4:memory:/docker/abc\n", map[string]string{"memory/memory.limit_in_bytes": "268435456\n"}, 268435456, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(root, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			proc := filepath.Join(t.TempDir(), "cgroup")
+			if tt.proc != "" {
+				if err := os.WriteFile(proc, []byte(tt.proc), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, ok := cgroupMemoryLimit(root, proc)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("cgroupMemoryLimit() = (%d, %v), want (%d, %v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTuneRuntime_MemoryLimit(t *testing.T) {
+	prev := debug.SetMemoryLimit(-1)
+	t.Cleanup(func() { debug.SetMemoryLimit(prev) })
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "memory.max"), []byte("1000000000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("from_cgroup", func(t *testing.T) {
+		t.Setenv("GOMEMLIMIT", "")
+		if got, want := tuneRuntime(root, filepath.Join(root, "no-proc")), int64(900000000); got != want {
+			t.Errorf("memory limit = %d, want %d", got, want)
+		}
+	})
+
+	t.Run("GOMEMLIMIT_respected", func(t *testing.T) {
+		t.Setenv("GOMEMLIMIT", "2GiB")
+		debug.SetMemoryLimit(prev)
+		if got := tuneRuntime(root, filepath.Join(root, "no-proc")); got != prev {
+			t.Errorf("memory limit = %d, want unchanged %d", got, prev)
+		}
+	})
+}
+
+func TestTuneRuntime_OptOut(t *testing.T) {
+	prev := debug.SetMemoryLimit(-1)
+	TuneRuntime(config.ServerConfig{TuneRuntime: false})
+	if got := debug.SetMemoryLimit(-1); got != prev {
+		t.Errorf("memory limit changed to %d with TuneRuntime disabled", got)
+	}
+}
+
+func TestRun_ListenErrorWritesCrashReport(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	// Occupy the port so ListenAndServe fails.
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	crashDir := t.TempDir()
+	clearServerEnvVars(t)
+	t.Setenv("PORT", fmt.Sprintf("%d", listener.Addr().(*net.TCPAddr).Port))
+	t.Setenv("CRASH_DIR", crashDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Run(ctx, http.NotFoundHandler())
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		matches, _ := filepath.Glob(filepath.Join(crashDir, "crash-*.txt"))
+		if len(matches) == 1 {
+			data, err := os.ReadFile(matches[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertContains(t, string(data), "reason: server error: listen tcp")
+			assertContains(t, string(data), "CrashDir: "+crashDir)
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected a crash report after ListenAndServe failed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRun_ListenErrorReturns verifies that Run returns promptly, with the
+// error, when the server or admin server cannot listen, after running the
+// shutdown hooks.
+func TestRun_ListenErrorReturns(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	busy := fmt.Sprintf("%d", listener.Addr().(*net.TCPAddr).Port)
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"server port in use", map[string]string{"PORT": busy}, "address already in use"},
+		{"admin port in use", map[string]string{"PORT": "0", "ADMIN_PORT": busy, "ADMIN_TOKEN": "secret"}, "admin server: listen tcp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearServerEnvVars(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			hookRan := false
+			done := make(chan error, 1)
+			go func() {
+				done <- Run(context.Background(), http.NotFoundHandler(),
+					WithShutdownHook("hook", 0, func(context.Context) error {
+						hookRan = true
+						return nil
+					}))
+			}()
+
+			select {
+			case err := <-done:
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				assertContains(t, err.Error(), tt.want)
+				if !hookRan {
+					t.Error("expected the shutdown hook to run")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run did not return after failing to listen")
+			}
+		})
+	}
+}
+
+// TestRun_H2C verifies that with H2C set, Run serves HTTP/2 over cleartext
+// as well as HTTP/1.1, with the HTTP/2 tuning applied.
+func TestRun_H2C(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	clearServerEnvVars(t)
+	t.Setenv("H2C", "true")
+	t.Setenv("HTTP2_MAX_CONCURRENT_STREAMS", "50")
+	t.Setenv("HTTP2_READ_IDLE_TIMEOUT", "30")
+
+	srv, err := NewServerWithConfig(http.NotFoundHandler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.HTTP2 == nil || srv.HTTP2.MaxConcurrentStreams != 50 || srv.HTTP2.SendPingTimeout != 30*time.Second {
+		t.Errorf("HTTP2 = %+v, want 50 streams and a 30s ping timeout", srv.HTTP2)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	addr, _ := startServer(t, ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	}))
+
+	h2c := &http.Transport{Protocols: new(http.Protocols)}
+	h2c.Protocols.SetUnencryptedHTTP2(true)
+	for name, client := range map[string]*http.Client{
+		"HTTP/2.0": {Transport: h2c},
+		"HTTP/1.1": {Transport: &http.Transport{}},
+	} {
+		resp, err := client.Get("http://" + addr + "/")
+		if err != nil {
+			t.Fatalf("%s request: %v", name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != name {
+			t.Errorf("served %s, want %s", body, name)
+		}
+	}
+}
+
+func TestDumpGoroutines(t *testing.T) {
+	var buf strings.Builder
+	dumpGoroutines(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	out := buf.String()
+	assertContains(t, out, "goroutine dump")
+	assertContains(t, out, "TestDumpGoroutines")
+}
+
+// TestConnTracker verifies connection counting and TLS handshake failure
+// detection.
+func TestConnTracker(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+	}))
+	var logs strings.Builder
+	ts.Config.ErrorLog = log.New(&logs, "", 0)
+	tracker := NewConnTracker("public")
+	tracker.Instrument(ts.Config)
+	ts.StartTLS()
+
+	client := ts.Client()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := client.Get(ts.URL + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	waitFor(t, func() bool { return tracker.Stats().Active == 1 })
+	close(release)
+	<-done
+
+	// A plain HTTP request to the TLS listener fails the handshake.
+	if resp, err := http.Get(strings.Replace(ts.URL, "https", "http", 1)); err == nil {
+		resp.Body.Close()
+	}
+	waitFor(t, func() bool { return tracker.Stats().TLSHandshakeErrors == 1 })
+	if !strings.Contains(logs.String(), "TLS handshake error") {
+		t.Errorf("error log should still receive the message, got %q", logs.String())
+	}
+
+	ts.Close()
+	waitFor(t, func() bool { return tracker.Stats().Open == 0 })
+	stats := tracker.Stats()
+	if stats.Accepted != 2 || stats.Closed != 2 || stats.Active != 0 || stats.Hijacked != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestRun_AdminServer verifies that Run serves the admin endpoints on
+// ADMIN_PORT, including those added with WithAdminHandler and
+// WithMaintenance, and that maintenance mode spares the health endpoints.
+func TestRun_AdminServer(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	clearOtherServerEnvVars(t)
+	adminPort := findAvailablePort(t)
+	t.Setenv("ADMIN_PORT", fmt.Sprintf("%d", adminPort))
+	t.Setenv("ADMIN_TOKEN", "s3cret")
+
+	var maintenance admin.Maintenance
+	maintenance.Set(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	// The admin server is bound before the ready functions are called.
+	addr, runComplete := startServer(t, ctx, http.NotFoundHandler(),
+		WithHealth(health.New(health.Options{})),
+		WithMaintenance(&maintenance),
+		WithAdminHandler("GET /custom", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("custom"))
+		})))
+
+	for path, want := range map[string]int{"/": http.StatusServiceUnavailable, "/healthz": http.StatusOK} {
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s in maintenance mode: got %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/custom", adminPort)
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("admin request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unauthenticated admin request: got %d, want 401", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("admin request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "custom" {
+		t.Errorf("custom admin endpoint: got %d %q", resp.StatusCode, body)
+	}
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d/readyz", adminPort), nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("admin request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("admin readiness endpoint: got %d, want 200", resp.StatusCode)
+	}
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("http://127.0.0.1:%d/maintenance", adminPort), nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("admin request failed: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "true\n" {
+		t.Errorf("admin maintenance endpoint = %q, want true", body)
+	}
+
+	cancel()
+	if err := <-runComplete; err != nil {
+		t.Errorf("Run returned error: %v", err)
+	}
+}
+
+func TestRun_ShutdownHooks(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	clearOtherServerEnvVars(t)
+
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, name)
+	}
+	errFlush := errors.New("flush failed")
+	ctx, cancel := context.WithCancel(context.Background())
+	_, runComplete := startServer(t, ctx, http.NotFoundHandler(),
+		WithShutdownHook("db", 0, func(ctx context.Context) error {
+			record("db")
+			return nil
+		}),
+		WithShutdownHook("slow", 10*time.Millisecond, func(ctx context.Context) error {
+			record("slow")
+			select {} // ignores ctx
+		}),
+		WithShutdownHook("logs", 0, func(ctx context.Context) error {
+			record("logs")
+			return errFlush
+		}),
+	)
+	cancel()
+
+	select {
+	case err := <-runComplete:
+		if !errors.Is(err, errFlush) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Run error = %v, want flush failure and slow hook timeout", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(order, ","); got != "db,slow,logs" {
+		t.Errorf("hook order = %s, want db,slow,logs", got)
+	}
+}
+
+// TestRunShutdownHooks_SharedDeadline verifies that hooks share the shutdown
+// deadline rather than each getting the full shutdown timeout.
+func TestRunShutdownHooks_SharedDeadline(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	block := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := runShutdownHooks(ctx, []shutdownHook{
+		{name: "first", fn: block},
+		{name: "second", timeout: time.Hour, fn: block},
+	}, logger)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("hooks took %v, want them to stop at the shared deadline", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "second") {
+		t.Errorf("error = %v, want both hooks to miss the deadline", err)
+	}
+}
+
+func TestWithHealthEndpoints(t *testing.T) {
+	h := health.New(health.Options{})
+	h.AddReadiness("db", health.CheckerFunc(func(context.Context) error { return errors.New("down") }))
+	handler := withHealthEndpoints(h, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("app"))
+	}))
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/healthz", http.StatusOK},
+		{http.MethodGet, "/readyz", http.StatusServiceUnavailable},
+		{http.MethodGet, "/", http.StatusOK},
+		{http.MethodPost, "/healthz", http.StatusOK}, // reaches the application
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s: got %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
+
+// TestRunGroup verifies that RunGroup serves every server and shuts them all
+// down when the context is cancelled.
+func TestRunGroup(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	var servers []*http.Server
+	for _, name := range []string{"api", "metrics"} {
+		servers = append(servers, &http.Server{
+			Addr: "127.0.0.1:0",
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(name))
+			}),
+		})
+	}
+
+	hookRan := false
+	ctx, cancel := context.WithCancel(context.Background())
+	runComplete := make(chan error, 1)
+	ready := make(chan net.Addr, len(servers))
+	go func() {
+		runComplete <- RunGroup(ctx, servers,
+			WithReadyFunc(func(addr net.Addr) { ready <- addr }),
+			WithShutdownHook("hook", 0, func(context.Context) error {
+				hookRan = true
+				return nil
+			}))
+	}()
+	for range servers {
+		<-ready
+	}
+
+	for i, want := range []string{"api", "metrics"} {
+		url := "http://" + servers[i].Addr + "/"
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != want {
+			t.Errorf("%s answered %q, want %q", url, body, want)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-runComplete:
+		if err != nil {
+			t.Errorf("RunGroup returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("RunGroup did not return")
+	}
+	if !hookRan {
+		t.Error("shutdown hook did not run")
+	}
+	for _, srv := range servers {
+		if resp, err := http.Get("http://" + srv.Addr + "/"); err == nil {
+			resp.Body.Close()
+			t.Errorf("%s still serving after RunGroup returned", srv.Addr)
+		}
+	}
+}
+
+// TestRunGroup_ListenError verifies that a server failing to listen makes
+// RunGroup shut the others down and return the failure.
+func TestRunGroup_ListenError(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	good := &http.Server{Addr: fmt.Sprintf("127.0.0.1:%d", findAvailablePort(t)), Handler: http.NotFoundHandler()}
+	bad := &http.Server{Addr: taken.Addr().String(), Handler: http.NotFoundHandler()}
+	runComplete := make(chan error, 1)
+	go func() {
+		runComplete <- RunGroup(context.Background(), []*http.Server{good, bad})
+	}()
+
+	select {
+	case err := <-runComplete:
+		if err == nil || !strings.Contains(err.Error(), bad.Addr) {
+			t.Errorf("RunGroup error = %v, want failure of %s", err, bad.Addr)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("RunGroup did not return after a listen failure")
+	}
+	if err := RunGroup(context.Background(), nil); err == nil {
+		t.Error("RunGroup with no servers returned nil")
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	clearServerEnvVars(t)
+	// The running instance holds PORT; the self test must not need it.
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	t.Setenv("PORT", fmt.Sprint(busy.Addr().(*net.TCPAddr).Port))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("POST /echo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		io.Copy(w, r.Body)
+	})
+	mux.HandleFunc("GET /broken", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	})
+	h := health.New(health.Options{})
+	var hookRan bool
+	opts := []Option{
+		WithHealth(h),
+		WithShutdownHook("test", 0, func(context.Context) error { hookRan = true; return nil }),
+		WithSmokeCheck(SmokeCheck{Name: "users", Path: "/users"}),
+		WithSmokeCheck(SmokeCheck{
+			Method: http.MethodPost,
+			Path:   "/echo",
+			Header: http.Header{"Authorization": {"Bearer token"}},
+			Body:   "hello",
+			Check: func(resp *http.Response) error {
+				b, _ := io.ReadAll(resp.Body)
+				if string(b) != "hello" {
+					return fmt.Errorf("body %q, want %q", b, "hello")
+				}
+				return nil
+			},
+		}),
+	}
+
+	t.Run("pass", func(t *testing.T) {
+		var buf strings.Builder
+		if err := selfTest(context.Background(), &buf, mux, opts...); err != nil {
+			t.Fatalf("selfTest() error = %v\n%s", err, buf.String())
+		}
+		for _, want := range []string{"PASS liveness", "PASS readiness", "PASS users", "PASS POST /echo", "4 of 4 checks passed"} {
+			assertContains(t, buf.String(), want)
+		}
+		if !hookRan {
+			t.Error("shutdown hook did not run")
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		var buf strings.Builder
+		err := selfTest(context.Background(), &buf, mux, append(opts,
+			WithSmokeCheck(SmokeCheck{Name: "broken", Path: "/broken"}),
+			WithSmokeCheck(SmokeCheck{Name: "missing", Path: "/missing", Status: http.StatusNotFound}),
+		)...)
+		if err == nil {
+			t.Fatalf("selfTest() succeeded, want an error\n%s", buf.String())
+		}
+		assertContains(t, err.Error(), "broken: status 500, want 200")
+		assertContains(t, buf.String(), "FAIL broken")
+		assertContains(t, buf.String(), "PASS missing")
+		assertContains(t, buf.String(), "5 of 6 checks passed")
+	})
+
+	t.Run("start failure", func(t *testing.T) {
+		t.Setenv("LOG_LEVEL", "nonsense")
+		var buf strings.Builder
+		if err := selfTest(context.Background(), &buf, mux, opts...); err == nil {
+			t.Fatal("selfTest() succeeded with invalid configuration")
+		}
+		assertContains(t, buf.String(), "FAIL server did not start")
+	})
+}
+
+func TestSelfTestFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	selfTest := SelfTestFlag(fs)
+	if err := fs.Parse([]string{"-selftest"}); err != nil {
+		t.Fatal(err)
+	}
+	if !*selfTest {
+		t.Error("-selftest did not set the flag")
+	}
+}
+
+func TestRun_Lifecycle(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	clearOtherServerEnvVars(t)
+
+	var mu sync.Mutex
+	var order []string
+	record := func(step string) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, step)
+			return nil
+		}
+	}
+	l := lifecycle.New(lifecycle.Options{})
+	l.Add(lifecycle.Component{Name: "cache", DependsOn: []string{"db"}, Start: record("start cache"), Stop: record("stop cache")})
+	l.Add(lifecycle.Component{Name: "db", Start: record("start db"), Stop: record("stop db")})
+
+	t.Run("start and stop", func(t *testing.T) {
+		order = nil
+		ctx, cancel := context.WithCancel(context.Background())
+		_, runComplete := startServer(t, ctx, http.NotFoundHandler(),
+			WithLifecycle(l),
+			WithReadyFunc(func(net.Addr) { record("ready")(ctx) }),
+			WithShutdownHook("logs", 0, record("hook")),
+		)
+		cancel()
+		if err := <-runComplete; err != nil {
+			t.Fatalf("Run error = %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		want := "start db,start cache,ready,stop cache,stop db,hook"
+		if got := strings.Join(order, ","); got != want {
+			t.Errorf("order = %s, want %s", got, want)
+		}
+	})
+
+	t.Run("start failure", func(t *testing.T) {
+		boom := errors.New("boom")
+		failing := lifecycle.New(lifecycle.Options{})
+		failing.Add(lifecycle.Component{Name: "db", Start: func(context.Context) error { return boom }})
+		t.Setenv("PORT", "0")
+		var ready bool
+		err := Run(context.Background(), http.NotFoundHandler(), WithLifecycle(failing), WithReadyFunc(func(net.Addr) { ready = true }))
+		if !errors.Is(err, boom) {
+			t.Errorf("Run error = %v, want %v", err, boom)
+		}
+		if ready {
+			t.Error("server listened although a component failed to start")
+		}
+	})
+}
+
+// TestRun_StartupGate verifies that Run listens before startup completes and
+// answers 503 problems until it has.
+func TestRun_StartupGate(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	clearOtherServerEnvVars(t)
+
+	t.Run("gated until warmup completes", func(t *testing.T) {
+		release := make(chan struct{})
+		var started atomic.Bool
+		l := lifecycle.New(lifecycle.Options{})
+		l.Add(lifecycle.Component{Name: "db", Start: func(context.Context) error {
+			started.Store(true)
+			return nil
+		}})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		addr, runComplete := startServer(t, ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+			WithHealth(health.New(health.Options{})),
+			WithLifecycle(l),
+			WithStartupGate(StartupGateOptions{
+				RetryAfter: 2 * time.Second,
+				Warmup: func(ctx context.Context) error {
+					select {
+					case <-release:
+						return nil
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				},
+			}),
+		)
+
+		resp, err := http.Get("http://" + addr + "/orders")
+		if err != nil {
+			t.Fatalf("GET during startup: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("status during startup = %d, want 503", resp.StatusCode)
+		}
+		if got := resp.Header.Get("Retry-After"); got != "2" {
+			t.Errorf("Retry-After = %q, want 2", got)
+		}
+		if got := resp.Header.Get("Content-Type"); got != "application/problem+json" {
+			t.Errorf("Content-Type = %q, want application/problem+json", got)
+		}
+		assertContains(t, string(body), `"reason":"starting"`)
+
+		for path, want := range map[string]int{"/healthz": http.StatusOK, "/readyz": http.StatusServiceUnavailable} {
+			resp, err := http.Get("http://" + addr + path)
+			if err != nil {
+				t.Fatalf("GET %s: %v", path, err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != want {
+				t.Errorf("GET %s during startup = %d, want %d", path, resp.StatusCode, want)
+			}
+		}
+
+		waitFor(t, started.Load)
+		close(release)
+		waitFor(t, func() bool {
+			resp, err := http.Get("http://" + addr + "/orders")
+			if err != nil {
+				return false
+			}
+			resp.Body.Close()
+			return resp.StatusCode == http.StatusOK
+		})
+		cancel()
+		if err := <-runComplete; err != nil {
+			t.Errorf("Run error = %v", err)
+		}
+	})
+
+	t.Run("warmup failure", func(t *testing.T) {
+		boom := errors.New("boom")
+		var stopped atomic.Bool
+		l := lifecycle.New(lifecycle.Options{})
+		l.Add(lifecycle.Component{Name: "db", Stop: func(context.Context) error {
+			stopped.Store(true)
+			return nil
+		}})
+		_, runComplete := startServer(t, context.Background(), http.NotFoundHandler(),
+			WithLifecycle(l),
+			WithStartupGate(StartupGateOptions{Warmup: func(context.Context) error { return boom }}),
+		)
+		if err := <-runComplete; !errors.Is(err, boom) {
+			t.Errorf("Run error = %v, want %v", err, boom)
+		}
+		if !stopped.Load() {
+			t.Error("started component was not stopped")
+		}
+	})
+}
+
+// slowWriter is a goroutine-safe writer that takes its time, as a congested
+// pipe would.
+type slowWriter struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *slowWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+// TestRun_FlushesAsyncLogger verifies that records buffered by an
+// asynchronous default logger are written before Run returns.
+func TestRun_FlushesAsyncLogger(t *testing.T) {
+	clearOtherServerEnvVars(t)
+	out := &slowWriter{}
+	t.Setenv("LOG_LEVEL", "INFO")
+	logging.SetDefaultLogger(config.ServerConfig{LogLevel: slog.LevelInfo}, logging.WithWriter(out), logging.WithAsync(logging.AsyncOptions{}))
+	defer logging.SetDefaultLogger(config.ServerConfig{}, logging.WithWriter(os.Stdout))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, runComplete := startServer(t, ctx, http.NotFoundHandler(),
+		WithShutdownHook("logs", 0, func(context.Context) error {
+			for i := range 50 {
+				slog.Info("hook record", slog.Int("i", i))
+			}
+			return nil
+		}),
+	)
+	cancel()
+	if err := <-runComplete; err != nil {
+		t.Fatalf("Run error = %v", err)
+	}
+	if got := strings.Count(out.String(), "hook record"); got != 50 {
+		t.Errorf("records written by the time Run returned = %d, want 50", got)
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/logging"
+)
+
+// shutdownHook is a callback registered with WithShutdownHook.
+type shutdownHook struct {
+	name    string
+	timeout time.Duration
+	fn      func(ctx context.Context) error
+}
+
+// WithShutdownHook registers fn to run once the server has shut down and no
+// longer serves requests, before Run returns. Use it to release what handlers
+// depended on: close database pools, flush logs or buffered metrics,
+// deregister from service discovery.
+//
+// Hooks run one at a time in registration order, so register a hook after
+// the hooks of anything it must outlive. Each gets a context that expires
+// after timeout, if it is not zero, or at the shutdown deadline, whichever
+// comes first: draining requests, stopping components, running hooks and
+// flushing logs share one deadline, the shutdown timeout after shutdown
+// began. A hook that has not returned by then is abandoned and Run moves on
+// to the next.
+// Errors are logged under the hook's name, and all of them are joined into
+// the error Run returns.
+func WithShutdownHook(name string, timeout time.Duration, fn func(ctx context.Context) error) Option {
+	return func(o *runOptions) {
+		o.shutdownHooks = append(o.shutdownHooks, shutdownHook{name: name, timeout: timeout, fn: fn})
+	}
+}
+
+// runShutdownHooks runs hooks in order within ctx, the shutdown deadline,
+// and returns their joined errors.
+func runShutdownHooks(ctx context.Context, hooks []shutdownHook, logger *slog.Logger) error {
+	var errs []error
+	for _, h := range hooks {
+		if err := h.run(ctx); err != nil {
+			logger.Error("shutdown hook failed", slog.String("hook", h.name), slog.String("error", err.Error()))
+			errs = append(errs, fmt.Errorf("shutdown hook %s: %w", h.name, err))
+			continue
+		}
+		logger.Debug("shutdown hook complete", slog.String("hook", h.name))
+	}
+	return errors.Join(errs...)
+}
+
+// run calls the hook, giving up when its timeout expires or parent is done.
+func (h shutdownHook) run(parent context.Context) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if h.timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, h.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				done <- fmt.Errorf("panic: %v", v)
+			}
+		}()
+		done <- h.fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if parent.Err() != nil {
+			return fmt.Errorf("did not finish by the shutdown deadline: %w", ctx.Err())
+		}
+		return fmt.Errorf("did not finish within %s: %w", h.timeout, ctx.Err())
+	}
+}
+
+// flushLogs writes out the records buffered by a default logger installed
+// with logging.WithAsync, within ctx, the shutdown deadline, so none are
+// lost when the process exits.
+func flushLogs(ctx context.Context) {
+	if err := logging.Flush(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "error flushing logs: %s\n", err)
+	}
+}
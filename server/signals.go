@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+
+	"github.com/harrydayexe/GoWebUtilities/admin"
+	"github.com/harrydayexe/GoWebUtilities/config"
+	"github.com/harrydayexe/GoWebUtilities/health"
+	"github.com/harrydayexe/GoWebUtilities/lifecycle"
+	"github.com/harrydayexe/GoWebUtilities/logging"
+)
+
+// shutdownSignals are the signals that make Run shut the server down
+// gracefully. On Windows the runtime delivers CTRL_CLOSE_EVENT,
+// CTRL_LOGOFF_EVENT and CTRL_SHUTDOWN_EVENT as SIGTERM, and blocks the
+// console control handler so the process is not terminated before Run has
+// shut down (subject to the system's own timeout; see shutdownTimeout).
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// Option configures Run.
+type Option func(*runOptions)
+
+// runOptions holds the settings applied by Options.
+type runOptions struct {
+	signalHandlers map[os.Signal][]func(ctx context.Context)
+	reloadHandlers []func(cfg config.ServerConfig)
+	connTrackers   []*ConnTracker
+	adminRoutes    []adminRoute
+	shutdownHooks  []shutdownHook
+	health         *health.Health
+	configWatcher  *config.Watcher[config.ServerConfig]
+	readyFuncs     []func(addr net.Addr)
+	smokeChecks    []SmokeCheck
+	selfTest       bool
+	lifecycle      *lifecycle.Lifecycle
+	startupGate    *StartupGateOptions
+	maintenance    *admin.Maintenance
+}
+
+// WithSignalHandler registers fn to be called when the process receives sig
+// while Run is serving. Handlers for the same signal run in registration
+// order, after Run's built-in behaviour for that signal (see Run). They run on
+// a single goroutine, so a slow handler delays the handling of later signals.
+// The context passed to fn is cancelled when the server starts shutting down.
+//
+// For example, an application can implement a zero-downtime restart on
+// SIGUSR2 by starting a new process that inherits the listener:
+//
+//	server.Run(ctx, mux, server.WithSignalHandler(syscall.SIGUSR2, restart))
+func WithSignalHandler(sig os.Signal, fn func(ctx context.Context)) Option {
+	return func(o *runOptions) {
+		if o.signalHandlers == nil {
+			o.signalHandlers = make(map[os.Signal][]func(ctx context.Context))
+		}
+		o.signalHandlers[sig] = append(o.signalHandlers[sig], fn)
+	}
+}
+
+// WithReloadHandler registers fn to be called with the newly parsed
+// configuration each time Run reloads it in response to SIGHUP. Settings that
+// the running http.Server was created with, such as the port and timeouts,
+// are not changed by a reload; fn can apply the others.
+func WithReloadHandler(fn func(cfg config.ServerConfig)) Option {
+	return func(o *runOptions) {
+		o.reloadHandlers = append(o.reloadHandlers, fn)
+	}
+}
+
+// WithConfigWatcher makes Run reload the configuration through w on SIGHUP,
+// instead of re-parsing it from the environment, so that configuration files
+// among w's sources are read again too. Subscribers of w are notified of the
+// change before the reload handlers are called with w's new configuration.
+//
+// The http.Server is still created from the environment when Run starts; use
+// Watch on w to also reload when its files change.
+func WithConfigWatcher(w *config.Watcher[config.ServerConfig]) Option {
+	return func(o *runOptions) {
+		o.configWatcher = w
+	}
+}
+
+// notifySignals starts delivery of the signals that have a built-in action
+// or a registered handler, and returns a function that dispatches them until
+// ctx is cancelled, after which delivery is stopped. Delivery starts before
+// the function is called so that no signal sent after notifySignals returns
+// falls back to its default behaviour (which for SIGHUP is to exit).
+func notifySignals(opts *runOptions) func(ctx context.Context) {
+	actions := builtinSignalActions(opts)
+	for sig := range opts.signalHandlers {
+		if _, ok := actions[sig]; !ok {
+			actions[sig] = func(context.Context) {}
+		}
+	}
+	if len(actions) == 0 {
+		return func(context.Context) {}
+	}
+
+	sigs := make([]os.Signal, 0, len(actions))
+	for sig := range actions {
+		sigs = append(sigs, sig)
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+
+	return func(ctx context.Context) {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-ch:
+				slog.Default().Info("received signal", slog.String("signal", sig.String()))
+				actions[sig](ctx)
+				for _, fn := range opts.signalHandlers[sig] {
+					fn(ctx)
+				}
+			}
+		}
+	}
+}
+
+// reloadConfig re-parses the configuration from the environment, or through
+// the watcher set by WithConfigWatcher, reconfigures the default logger and
+// calls the reload handlers. An invalid configuration is logged and otherwise
+// ignored, leaving the previous one in effect.
+func reloadConfig(opts *runOptions) {
+	var cfg config.ServerConfig
+	var err error
+	if w := opts.configWatcher; w != nil {
+		if err = w.Reload(); err == nil {
+			cfg = w.Current()
+		}
+	} else {
+		cfg, err = config.ParseConfig[config.ServerConfig]()
+	}
+	if err != nil {
+		slog.Default().Error("config reload failed, keeping previous config", slog.String("error", err.Error()))
+		return
+	}
+	logging.SetDefaultLogger(cfg)
+	for _, fn := range opts.reloadHandlers {
+		fn(cfg)
+	}
+	slog.Default().Info("config reloaded", slog.String("environment", cfg.Environment.String()))
+}
+
+// dumpGoroutines logs the stacks of all goroutines at INFO level.
+func dumpGoroutines(logger *slog.Logger) {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	logger.Info("goroutine dump",
+		slog.Int("goroutines", runtime.NumGoroutine()),
+		slog.String("stacks", string(buf)),
+	)
+}
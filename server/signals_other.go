@@ -0,0 +1,20 @@
+//go:build !unix && !windows
+
+package server
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// shutdownTimeout is how long Run's whole shutdown sequence may take:
+// draining in-flight requests, stopping components, running shutdown hooks
+// and flushing logs share one deadline.
+const shutdownTimeout = 10 * time.Second
+
+// builtinSignalActions returns Run's built-in signal behaviour. SIGHUP and
+// SIGUSR1 are not delivered on this platform, so there is none.
+func builtinSignalActions(opts *runOptions) map[os.Signal]func(ctx context.Context) {
+	return map[os.Signal]func(ctx context.Context){}
+}
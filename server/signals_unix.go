@@ -0,0 +1,25 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout is how long Run's whole shutdown sequence may take:
+// draining in-flight requests, stopping components, running shutdown hooks
+// and flushing logs share one deadline.
+const shutdownTimeout = 10 * time.Second
+
+// builtinSignalActions returns Run's built-in signal behaviour: SIGHUP reloads
+// the configuration and SIGUSR1 dumps goroutine stacks to the log.
+func builtinSignalActions(opts *runOptions) map[os.Signal]func(ctx context.Context) {
+	return map[os.Signal]func(ctx context.Context){
+		syscall.SIGHUP:  func(context.Context) { reloadConfig(opts) },
+		syscall.SIGUSR1: func(context.Context) { dumpGoroutines(slog.Default()) },
+	}
+}
@@ -0,0 +1,156 @@
+//go:build unix
+
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+)
+
+// startRun runs Run in the background with opts and waits until the server
+// accepts connections. It returns a channel that receives Run's result.
+func startRun(t *testing.T, ctx context.Context, opts ...Option) <-chan error {
+	t.Helper()
+	clearServerEnvVars(t)
+	_, done := startServer(t, ctx, http.NotFoundHandler(), opts...)
+	return done
+}
+
+// signalSelf sends sig to the current process.
+func signalSelf(t *testing.T, sig syscall.Signal) {
+	t.Helper()
+	if err := syscall.Kill(syscall.Getpid(), sig); err != nil {
+		t.Fatalf("failed to send %v: %v", sig, err)
+	}
+}
+
+func TestRun_SIGTERMShutsDown(t *testing.T) {
+	done := startRun(t, context.Background())
+
+	signalSelf(t, syscall.SIGTERM)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after SIGTERM")
+	}
+}
+
+func TestRun_SIGHUPReloadsConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloaded := make(chan config.ServerConfig, 1)
+	startRun(t, ctx, WithReloadHandler(func(cfg config.ServerConfig) {
+		reloaded <- cfg
+	}))
+
+	t.Setenv("LOG_LEVEL", "ERROR")
+	signalSelf(t, syscall.SIGHUP)
+
+	select {
+	case cfg := <-reloaded:
+		if cfg.LogLevel != slog.LevelError {
+			t.Errorf("reloaded LogLevel = %v, want ERROR", cfg.LogLevel)
+		}
+		if slog.Default().Enabled(context.Background(), slog.LevelWarn) {
+			t.Error("expected default logger to be reconfigured to ERROR")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("reload handler was not called after SIGHUP")
+	}
+}
+
+func TestRun_SIGHUPReloadsThroughConfigWatcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), ".env")
+	os.WriteFile(path, []byte("LOG_LEVEL=WARN\n"), 0o600)
+	w, err := config.NewWatcher[config.ServerConfig](config.WatcherOptions{}, config.DotEnvFile(path))
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+	changed := make(chan config.Change[config.ServerConfig], 1)
+	w.Subscribe(func(c config.Change[config.ServerConfig]) { changed <- c })
+	reloaded := make(chan config.ServerConfig, 1)
+	startRun(t, ctx, WithConfigWatcher(w), WithReloadHandler(func(cfg config.ServerConfig) {
+		reloaded <- cfg
+	}))
+
+	os.WriteFile(path, []byte("LOG_LEVEL=ERROR\n"), 0o600)
+	signalSelf(t, syscall.SIGHUP)
+
+	select {
+	case cfg := <-reloaded:
+		if cfg.LogLevel != slog.LevelError {
+			t.Errorf("reloaded LogLevel = %v, want ERROR from the watched file", cfg.LogLevel)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("reload handler was not called after SIGHUP")
+	}
+	select {
+	case <-changed:
+	default:
+		t.Error("watcher subscribers were not notified")
+	}
+}
+
+func TestRun_SIGHUPInvalidConfigKeepsPrevious(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloaded := make(chan struct{}, 1)
+	hup := make(chan struct{}, 1)
+	startRun(t, ctx,
+		WithReloadHandler(func(config.ServerConfig) { reloaded <- struct{}{} }),
+		WithSignalHandler(syscall.SIGHUP, func(context.Context) { hup <- struct{}{} }),
+	)
+
+	t.Setenv("ENVIRONMENT", "staging")
+	signalSelf(t, syscall.SIGHUP)
+
+	select {
+	case <-hup:
+	case <-time.After(2 * time.Second):
+		t.Fatal("SIGHUP handler was not called")
+	}
+	select {
+	case <-reloaded:
+		t.Error("reload handler should not be called for an invalid config")
+	default:
+	}
+}
+
+func TestRun_CustomSignalHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	called := make(chan struct{}, 2)
+	handler := func(context.Context) { called <- struct{}{} }
+	startRun(t, ctx,
+		WithSignalHandler(syscall.SIGUSR2, handler),
+		WithSignalHandler(syscall.SIGUSR2, handler),
+	)
+
+	signalSelf(t, syscall.SIGUSR2)
+
+	for range 2 {
+		select {
+		case <-called:
+		case <-time.After(2 * time.Second):
+			t.Fatal("expected both SIGUSR2 handlers to be called")
+		}
+	}
+}
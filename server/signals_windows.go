@@ -0,0 +1,23 @@
+//go:build windows
+
+package server
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// shutdownTimeout is how long Run's whole shutdown sequence may take:
+// draining in-flight requests, stopping components, running shutdown hooks
+// and flushing logs share one deadline. Windows terminates a console process
+// about 5 seconds after delivering a close, logoff or shutdown event (which
+// the Go runtime reports as SIGTERM), so the graceful shutdown must finish
+// within that window.
+const shutdownTimeout = 4 * time.Second
+
+// builtinSignalActions returns Run's built-in signal behaviour. Windows does
+// not deliver SIGHUP or SIGUSR1, so there is none.
+func builtinSignalActions(opts *runOptions) map[os.Signal]func(ctx context.Context) {
+	return map[os.Signal]func(ctx context.Context){}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/harrydayexe/GoWebUtilities/middleware"
+)
+
+// StartupGateOptions configures WithStartupGate. Zero values are defaults.
+type StartupGateOptions struct {
+	// RetryAfter is how long clients are told to wait before retrying.
+	// Defaults to 5 seconds.
+	RetryAfter time.Duration
+	// Warmup, if set, runs once the server is listening and the lifecycle
+	// components have started, such as a cache fill. The gate opens when it
+	// returns nil; an error shuts the server down, and Run returns it.
+	Warmup func(ctx context.Context) error
+	// Respond writes the 503 answer. Defaults to
+	// middleware.RespondOverloaded.
+	Respond middleware.OverloadResponder
+}
+
+// WithStartupGate makes Run listen at once, before starting the components
+// of WithLifecycle and running opts.Warmup, and answer requests with 503
+// Service Unavailable until they are done, instead of refusing connections.
+// Load balancers and clients so get a fast, well-formed answer during boot:
+// an application/problem+json body with reason "starting" and a Retry-After
+// header, as middleware.RespondOverloaded writes. GET /healthz still reaches
+// the liveness checks of WithHealth, so a slow start is not mistaken for a
+// dead process; /readyz is gated like the application's routes.
+//
+// If startup fails, Run shuts down and returns the error. The gate does not
+// apply to SelfTest, which starts everything before serving, nor to
+// RunGroup.
+func WithStartupGate(opts StartupGateOptions) Option {
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = 5 * time.Second
+	}
+	return func(o *runOptions) {
+		o.startupGate = &opts
+	}
+}
+
+// startupGate answers requests with 503 until it is opened.
+type startupGate struct {
+	opts     StartupGateOptions
+	liveness bool // let GET /healthz through
+	open     atomic.Bool
+}
+
+// wrap returns handler behind g.
+func (g *startupGate) wrap(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g.open.Load() || g.liveness && r.Method == http.MethodGet && r.URL.Path == "/healthz" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		respond := g.opts.Respond
+		if respond == nil {
+			respond = middleware.RespondOverloaded
+		}
+		respond(w, r, middleware.Overload{
+			Status:     http.StatusServiceUnavailable,
+			Reason:     "starting",
+			Detail:     "The server is starting.",
+			RetryAfter: g.opts.RetryAfter,
+		})
+	})
+}
+
+// start starts the lifecycle components and runs the warmup, then opens g.
+func (g *startupGate) start(ctx context.Context, opts *runOptions) error {
+	if opts.lifecycle != nil {
+		if err := opts.lifecycle.Start(ctx); err != nil {
+			return err
+		}
+	}
+	if g.opts.Warmup != nil {
+		if err := g.opts.Warmup(ctx); err != nil {
+			return fmt.Errorf("warmup: %w", err)
+		}
+	}
+	g.open.Store(true)
+	return nil
+}
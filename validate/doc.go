@@ -0,0 +1,50 @@
+// Package validate checks struct fields against rules declared in struct
+// tags, and defines the FieldErrors type that bind and config report
+// problems with.
+//
+//	type CreateUser struct {
+//	    Name  string   `json:"name" validate:"required,min=3,max=50"`
+//	    Email string   `json:"email" validate:"required,email"`
+//	    Role  string   `json:"role" validate:"omitempty,oneof=admin user"`
+//	    Tags  []string `json:"tags" validate:"max=10"`
+//	}
+//
+//	err := validate.Struct(in)
+//	// validate.FieldErrors{{Field: "email", Message: "must be a valid email address"}}
+//
+// A validate tag is a comma-separated list of rules, applied in order until
+// one fails, so each field reports at most one problem:
+//
+//   - required: the field must not be its zero value (nil, "", 0, ...)
+//   - omitempty: skip the remaining rules when the field is its zero value
+//   - min=n, max=n, len=n: bound the length of a string (in characters), the
+//     number of items in a slice, array or map, or the value of a number
+//   - oneof=a b c: the field, formatted with fmt, must be one of the
+//     space-separated values
+//   - email, url, uuid: the string must be an email address (without a
+//     display name), an absolute URL, or a UUID
+//   - datetime, date, duration: the string must parse with the scalar
+//     package's ParseTime, ParseDate or ParseDuration
+//   - money=USD: the string must be an amount of the currency, such as
+//     "12.34"; without a currency, an amount with one, such as "USD 12.34"
+//
+// Nested structs, pointers to them and slices of them are validated too,
+// with paths such as "address.city" and "items[2].sku". Fields are named by
+// their json tag, or another tag set with Options.NameTag; config names them
+// by their env tag. Register adds custom rules.
+//
+// Sanitize rewrites string fields before validation by their sanitize tags,
+// a comma-separated list applied in order: trimspace, lowercase, uppercase,
+// collapsespace (trim and reduce runs of white space to one space),
+// stripcontrol (drop control characters other than tab and newline, and
+// invisible format characters) and validutf8 (replace invalid UTF-8 with
+// U+FFFD). RegisterSanitizer adds custom ones. Unicode normalization is not
+// built in, as it needs golang.org/x/text; register it if you need it:
+//
+//	validate.RegisterSanitizer("nfc", norm.NFC.String)
+//
+// FieldErrors unwraps to a 422 respond.ProblemDetails, so respond.Error
+// writes it with the field errors in an "errors" member. bind.JSON sanitizes
+// and checks every decoded body, and config.ParseConfig checks every parsed
+// configuration, before calling Validate.
+package validate
@@ -0,0 +1,185 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Sanitizer rewrites a string field, such as by trimming it.
+type Sanitizer func(string) string
+
+var (
+	sanitizersMu sync.RWMutex
+	sanitizers   = map[string]Sanitizer{
+		"trimspace":     strings.TrimSpace,
+		"lowercase":     strings.ToLower,
+		"uppercase":     strings.ToUpper,
+		"collapsespace": collapseSpace,
+		"stripcontrol":  stripControl,
+		"validutf8":     func(s string) string { return strings.ToValidUTF8(s, "\uFFFD") },
+	}
+)
+
+// RegisterSanitizer adds a sanitizer usable in sanitize tags under name,
+// replacing any sanitizer of that name. It is intended to be called from
+// init functions. It panics if name is empty or contains ",".
+func RegisterSanitizer(name string, s Sanitizer) {
+	if name == "" || strings.Contains(name, ",") {
+		panic(fmt.Sprintf("validate: invalid sanitizer name %q", name))
+	}
+	sanitizersMu.Lock()
+	defer sanitizersMu.Unlock()
+	sanitizers[name] = s
+}
+
+// Sanitize rewrites the string fields of the struct v points to according to
+// their sanitize tags, a comma-separated list of sanitizers applied in
+// order, so that validation and handlers see clean input:
+//
+//	type SignUp struct {
+//	    Email string `json:"email" sanitize:"trimspace,lowercase" validate:"required,email"`
+//	    Bio   string `json:"bio" sanitize:"stripcontrol,trimspace"`
+//	}
+//
+// Tags apply to string fields, pointers to strings and slices of strings,
+// and nested structs, pointers to them and slices of them are sanitized
+// too. It returns an error if v is not a non-nil pointer, or a tag names an
+// unknown sanitizer or is on a field that is not a string.
+func Sanitize(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("validate: Sanitize requires a non-nil pointer")
+	}
+	return sanitizeValue(rv.Elem())
+}
+
+// sanitizeValue sanitizes the structs in rv.
+func sanitizeValue(rv reflect.Value) error {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := range rv.Len() {
+			if err := sanitizeValue(rv.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields, err := sanitizeFields(rv.Type())
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			fv := rv.FieldByIndex(f.index)
+			if f.sanitizers == nil {
+				if err := sanitizeValue(fv); err != nil {
+					return err
+				}
+				continue
+			}
+			sanitizeStrings(fv, f.sanitizers)
+		}
+	}
+	return nil
+}
+
+// sanitizeStrings applies ss to the string, *string or []string fv.
+func sanitizeStrings(fv reflect.Value, ss []Sanitizer) {
+	switch fv.Kind() {
+	case reflect.Pointer:
+		if !fv.IsNil() {
+			sanitizeStrings(fv.Elem(), ss)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range fv.Len() {
+			sanitizeStrings(fv.Index(i), ss)
+		}
+	case reflect.String:
+		if !fv.CanSet() {
+			return
+		}
+		s := fv.String()
+		for _, sanitize := range ss {
+			s = sanitize(s)
+		}
+		fv.SetString(s)
+	}
+}
+
+// sanitizeField is a struct field and the sanitizers in its sanitize tag, if
+// any; fields without one may contain structs that have them.
+type sanitizeField struct {
+	index      []int
+	sanitizers []Sanitizer
+}
+
+// sanitizeCache holds the parsed sanitize tags of each struct type.
+var sanitizeCache sync.Map // reflect.Type -> []sanitizeField
+
+// sanitizeFields returns the settable fields of struct type t.
+func sanitizeFields(t reflect.Type) ([]sanitizeField, error) {
+	if fields, ok := sanitizeCache.Load(t); ok {
+		return fields.([]sanitizeField), nil
+	}
+	var fields []sanitizeField
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		f := sanitizeField{index: sf.Index}
+		if tag := sf.Tag.Get("sanitize"); tag != "" && tag != "-" {
+			if !stringsType(sf.Type) {
+				return nil, fmt.Errorf("validate: sanitize tag on %s.%s, which is not a string", t, sf.Name)
+			}
+			for name := range strings.SplitSeq(tag, ",") {
+				name = strings.TrimSpace(name)
+				sanitizersMu.RLock()
+				s, ok := sanitizers[name]
+				sanitizersMu.RUnlock()
+				if !ok {
+					return nil, fmt.Errorf("validate: unknown sanitizer %q on %s.%s", name, t, sf.Name)
+				}
+				f.sanitizers = append(f.sanitizers, s)
+			}
+		}
+		fields = append(fields, f)
+	}
+	sanitizeCache.Store(t, fields)
+	return fields, nil
+}
+
+// stringsType reports whether t is a string, or a pointer, slice or array of
+// them.
+func stringsType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.String
+}
+
+// stripControl removes control characters other than tab and newline, and
+// Unicode format characters such as zero-width spaces and bidirectional
+// overrides.
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || !unicode.IsControl(r) && !unicode.Is(unicode.Cf, r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// collapseSpace trims s and replaces each run of white space in it with a
+// single space.
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
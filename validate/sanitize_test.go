@@ -0,0 +1,82 @@
+package validate
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+type signUp struct {
+	Email   string    `json:"email" sanitize:"trimspace,lowercase"`
+	Name    *string   `json:"name" sanitize:"stripcontrol,collapsespace"`
+	Tags    []string  `json:"tags" sanitize:"trimspace,uppercase"`
+	Bio     string    `json:"bio" sanitize:"validutf8,stripcontrol"`
+	Raw     string    `json:"raw"`
+	Friends []*signUp `json:"friends"`
+}
+
+func TestSanitize(t *testing.T) {
+	name := "  Ada\u200b \x00 Lovelace\t"
+	in := &signUp{
+		Email:   "  Ada@Example.COM \n",
+		Name:    &name,
+		Tags:    []string{" go ", "web"},
+		Bio:     "line one\nline\x1b two\xff",
+		Raw:     "  untouched ",
+		Friends: []*signUp{{Email: " B@X.IO"}, nil},
+	}
+	if err := Sanitize(in); err != nil {
+		t.Fatalf("Sanitize = %v", err)
+	}
+	if in.Email != "ada@example.com" {
+		t.Errorf("Email = %q", in.Email)
+	}
+	if *in.Name != "Ada Lovelace" {
+		t.Errorf("Name = %q", *in.Name)
+	}
+	if !slices.Equal(in.Tags, []string{"GO", "WEB"}) {
+		t.Errorf("Tags = %q", in.Tags)
+	}
+	if in.Bio != "line one\nline two\uFFFD" {
+		t.Errorf("Bio = %q", in.Bio)
+	}
+	if in.Raw != "  untouched " {
+		t.Errorf("Raw = %q, want it unchanged", in.Raw)
+	}
+	if in.Friends[0].Email != "b@x.io" {
+		t.Errorf("Friends[0].Email = %q", in.Friends[0].Email)
+	}
+}
+
+func TestSanitize_Errors(t *testing.T) {
+	if err := Sanitize(signUp{}); err == nil {
+		t.Error("Sanitize(non-pointer) = nil, want error")
+	}
+	if err := Sanitize(&struct {
+		A string `sanitize:"nope"`
+	}{}); err == nil || !strings.Contains(err.Error(), "unknown sanitizer") {
+		t.Errorf("unknown sanitizer error = %v", err)
+	}
+	if err := Sanitize(&struct {
+		A int `sanitize:"trimspace"`
+	}{}); err == nil {
+		t.Error("sanitize tag on an int = nil, want error")
+	}
+}
+
+func TestRegisterSanitizer(t *testing.T) {
+	RegisterSanitizer("digits", func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, s)
+	})
+	v := struct {
+		Phone string `sanitize:"digits"`
+	}{Phone: "+44 (0)20 7946-0000"}
+	if err := Sanitize(&v); err != nil || v.Phone != "4402079460000" {
+		t.Errorf("Phone = %q, %v", v.Phone, err)
+	}
+}
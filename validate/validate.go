@@ -0,0 +1,431 @@
+package validate
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/harrydayexe/GoWebUtilities/respond"
+	"github.com/harrydayexe/GoWebUtilities/scalar"
+)
+
+// FieldError describes a problem with one field of a value.
+type FieldError struct {
+	// Field is the path of the field, such as "address.city" or "items[2]".
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// FieldErrors is a list of field problems. It implements error, so Validate
+// methods can return it to report every invalid field at once.
+type FieldErrors []FieldError
+
+// Error implements error.
+func (fe FieldErrors) Error() string {
+	parts := make([]string, len(fe))
+	for i, e := range fe {
+		parts[i] = e.Field + " " + e.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Err returns fe as an error, or nil if fe is empty.
+func (fe FieldErrors) Err() error {
+	if len(fe) == 0 {
+		return nil
+	}
+	return fe
+}
+
+// Unwrap returns the problem details for the errors, so respond.Error writes
+// them as a 422 Unprocessable Entity problem with an "errors" member.
+func (fe FieldErrors) Unwrap() error {
+	return &respond.ProblemDetails{
+		Status:     http.StatusUnprocessableEntity,
+		Detail:     "validation failed",
+		Extensions: map[string]any{"errors": fe},
+	}
+}
+
+// Rule checks one field against a rule's param, the text after "=" in the
+// tag (empty if there is none). v is never a nil pointer: pointers are
+// dereferenced, and nil ones are only checked by required. Rule returns a
+// message such as "must be a valid email address" if v breaks the rule, or
+// "" if it does not.
+type Rule func(v reflect.Value, param string) string
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]Rule{
+		"min":   ruleMin,
+		"max":   ruleMax,
+		"len":   ruleLen,
+		"oneof": ruleOneOf,
+		"email": ruleEmail,
+		"url":   ruleURL,
+		"uuid":  ruleUUID,
+
+		"datetime": ruleDateTime,
+		"date":     ruleDate,
+		"duration": ruleDuration,
+		"money":    ruleMoney,
+	}
+)
+
+// Register adds a rule usable in validate tags under name, replacing any
+// rule of that name. It is intended to be called from init functions. It
+// panics if name is empty, contains "," or "=", or is required or omitempty.
+func Register(name string, rule Rule) {
+	if name == "" || strings.ContainsAny(name, ",=") || name == "required" || name == "omitempty" {
+		panic(fmt.Sprintf("validate: invalid rule name %q", name))
+	}
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rules[name] = rule
+}
+
+// Options configures StructWith. Zero values are defaults.
+type Options struct {
+	// NameTag is the struct tag whose first element names fields in errors,
+	// falling back to the Go field name. Defaults to "json".
+	NameTag string
+}
+
+// Struct validates v, a struct or pointer to one, with default Options.
+func Struct(v any) error {
+	return StructWith(v, Options{})
+}
+
+// StructWith validates the fields of v, a struct or pointer to one, against
+// their validate tags, and those of nested structs, slices and arrays of
+// structs, and pointers to them. It returns FieldErrors listing every field
+// that breaks a rule, or nil. Other values, including nil, are valid.
+//
+// It returns a different error if a tag is malformed or names an unknown
+// rule; that is a programming error, and is reported whether or not the
+// field is otherwise valid.
+func StructWith(v any, opts Options) error {
+	if opts.NameTag == "" {
+		opts.NameTag = "json"
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	var errs FieldErrors
+	if err := validateValue(rv, "", opts.NameTag, &errs); err != nil {
+		return err
+	}
+	return errs.Err()
+}
+
+// validateValue validates the structs in rv, whose path is path.
+func validateValue(rv reflect.Value, path, nameTag string, errs *FieldErrors) error {
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := range rv.Len() {
+			if err := validateValue(rv.Index(i), fmt.Sprintf("%s[%d]", path, i), nameTag, errs); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields, err := typeFields(rv.Type(), nameTag)
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			fv := rv.FieldByIndex(f.index)
+			fieldPath := f.name
+			if path != "" && f.name != "" {
+				fieldPath = path + "." + f.name
+			} else if f.name == "" {
+				fieldPath = path
+			}
+			if msg := f.check(fv); msg != "" {
+				*errs = append(*errs, FieldError{Field: fieldPath, Message: msg})
+				continue
+			}
+			if err := validateValue(fv, fieldPath, nameTag, errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// field is a struct field and the rules in its validate tag.
+type field struct {
+	index     []int
+	name      string
+	required  bool
+	omitempty bool
+	rules     []boundRule
+}
+
+// boundRule is a rule and its param.
+type boundRule struct {
+	rule  Rule
+	param string
+}
+
+// check returns the message for the first rule fv breaks, or "".
+func (f field) check(fv reflect.Value) string {
+	if fv.IsZero() {
+		if f.required {
+			return "is required"
+		}
+		if f.omitempty {
+			return ""
+		}
+	}
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			return ""
+		}
+		fv = fv.Elem()
+	}
+	for _, r := range f.rules {
+		if msg := r.rule(fv, r.param); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+// typeKey identifies the parsed fields of a struct type named by a tag.
+type typeKey struct {
+	t       reflect.Type
+	nameTag string
+}
+
+// fieldCache holds the parsed fields of each struct type validated, so tags
+// are parsed once per type.
+var fieldCache sync.Map // typeKey -> []field
+
+// typeFields returns the exported and embedded fields of struct type t.
+// Embedded structs without a name in nameTag have an empty name, so their
+// fields are reported as the embedding struct's.
+func typeFields(t reflect.Type, nameTag string) ([]field, error) {
+	key := typeKey{t, nameTag}
+	if fields, ok := fieldCache.Load(key); ok {
+		return fields.([]field), nil
+	}
+	var fields []field
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		f := field{index: sf.Index, name: sf.Name}
+		if name, _, _ := strings.Cut(sf.Tag.Get(nameTag), ","); name != "" && name != "-" {
+			f.name = name
+		} else if sf.Anonymous {
+			f.name = "" // promoted fields keep the embedding struct's path
+		}
+		if !sf.IsExported() && f.name != "" {
+			continue
+		}
+		tag := sf.Tag.Get("validate")
+		if tag == "" || tag == "-" {
+			fields = append(fields, f)
+			continue
+		}
+		for part := range strings.SplitSeq(tag, ",") {
+			name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch name {
+			case "required":
+				f.required = true
+				continue
+			case "omitempty":
+				f.omitempty = true
+				continue
+			}
+			rulesMu.RLock()
+			rule, ok := rules[name]
+			rulesMu.RUnlock()
+			if !ok {
+				return nil, fmt.Errorf("validate: unknown rule %q on %s.%s", name, t, sf.Name)
+			}
+			if err := checkParam(name, param, sf.Type); err != nil {
+				return nil, fmt.Errorf("validate: rule %q on %s.%s: %w", part, t, sf.Name, err)
+			}
+			f.rules = append(f.rules, boundRule{rule, param})
+		}
+		fields = append(fields, f)
+	}
+	fieldCache.Store(key, fields)
+	return fields, nil
+}
+
+// checkParam reports whether the built-in rule name can be applied with
+// param to fields of type t.
+func checkParam(name, param string, t reflect.Type) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch name {
+	case "min", "max", "len":
+		if _, err := strconv.ParseFloat(param, 64); err != nil {
+			return fmt.Errorf("param must be a number")
+		}
+		if sizeKind(t.Kind()) == "" {
+			return fmt.Errorf("not applicable to %s", t)
+		}
+	case "oneof":
+		if param == "" {
+			return fmt.Errorf("param must list the allowed values")
+		}
+	case "email", "url", "uuid", "datetime", "date", "duration", "money":
+		if t.Kind() != reflect.String {
+			return fmt.Errorf("not applicable to %s", t)
+		}
+	}
+	return nil
+}
+
+// sizeKind returns what min, max and len measure for a kind: "length",
+// "items" or "value", or "" if they do not apply.
+func sizeKind(k reflect.Kind) string {
+	switch k {
+	case reflect.String:
+		return "length"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return "items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return "value"
+	}
+	return ""
+}
+
+// size returns what min, max and len compare for v.
+func size(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String()))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return float64(v.Uint())
+}
+
+// sizeMessage describes a bound on v's size.
+func sizeMessage(v reflect.Value, bound, param string) string {
+	switch sizeKind(v.Kind()) {
+	case "length":
+		return fmt.Sprintf("must be %s %s characters long", bound, param)
+	case "items":
+		return fmt.Sprintf("must have %s %s items", bound, param)
+	}
+	return fmt.Sprintf("must be %s %s", bound, param)
+}
+
+func ruleMin(v reflect.Value, param string) string {
+	if n, _ := strconv.ParseFloat(param, 64); size(v) < n {
+		return sizeMessage(v, "at least", param)
+	}
+	return ""
+}
+
+func ruleMax(v reflect.Value, param string) string {
+	if n, _ := strconv.ParseFloat(param, 64); size(v) > n {
+		return sizeMessage(v, "at most", param)
+	}
+	return ""
+}
+
+func ruleLen(v reflect.Value, param string) string {
+	if n, _ := strconv.ParseFloat(param, 64); size(v) != n {
+		return sizeMessage(v, "exactly", param)
+	}
+	return ""
+}
+
+func ruleOneOf(v reflect.Value, param string) string {
+	allowed := strings.Fields(param)
+	if !slices.Contains(allowed, fmt.Sprint(v)) {
+		return "must be one of " + strings.Join(allowed, ", ")
+	}
+	return ""
+}
+
+func ruleEmail(v reflect.Value, _ string) string {
+	if addr, err := mail.ParseAddress(v.String()); err != nil || addr.Name != "" || addr.Address != v.String() {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+func ruleURL(v reflect.Value, _ string) string {
+	if u, err := url.Parse(v.String()); err != nil || u.Scheme == "" || u.Host == "" {
+		return "must be an absolute URL"
+	}
+	return ""
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func ruleUUID(v reflect.Value, _ string) string {
+	if !uuidPattern.MatchString(v.String()) {
+		return "must be a UUID"
+	}
+	return ""
+}
+
+func ruleDateTime(v reflect.Value, _ string) string {
+	if _, err := scalar.ParseTime(v.String()); err != nil {
+		return "must be an RFC 3339 date-time"
+	}
+	return ""
+}
+
+func ruleDate(v reflect.Value, _ string) string {
+	if _, err := scalar.ParseDate(v.String()); err != nil {
+		return "must be a date in the form YYYY-MM-DD"
+	}
+	return ""
+}
+
+func ruleDuration(v reflect.Value, _ string) string {
+	if _, err := scalar.ParseDuration(v.String()); err != nil {
+		return "must be a duration such as 1h30m or PT1H30M"
+	}
+	return ""
+}
+
+// ruleMoney checks for an amount of the currency param, such as "12.34", or
+// without a param, an amount with its currency, such as "USD 12.34".
+func ruleMoney(v reflect.Value, param string) string {
+	if param != "" {
+		if _, err := scalar.ParseAmount(v.String(), param); err != nil {
+			return fmt.Sprintf("must be an amount of %s with at most %d decimal places", param, scalar.MinorDigits(param))
+		}
+		return ""
+	}
+	if _, err := scalar.ParseMoney(v.String()); err != nil {
+		return "must be an amount with a currency, such as USD 12.34"
+	}
+	return ""
+}
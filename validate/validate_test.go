@@ -0,0 +1,183 @@
+package validate
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/harrydayexe/GoWebUtilities/respond"
+)
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type Audit struct {
+	By string `json:"by" validate:"required"`
+}
+
+type user struct {
+	Audit
+	Name     string    `json:"name" validate:"required,min=3,max=5"`
+	Email    string    `json:"email" validate:"omitempty,email"`
+	Site     string    `json:"site,omitempty" validate:"omitempty,url"`
+	ID       string    `validate:"omitempty,uuid"`
+	Age      int       `json:"age" validate:"min=0,max=150"`
+	Role     string    `json:"role" validate:"omitempty,oneof=admin user"`
+	Tags     []string  `json:"tags" validate:"max=2"`
+	Code     *string   `json:"code" validate:"len=4"`
+	Address  *address  `json:"address"`
+	Previous []address `json:"previous"`
+	internal string    `validate:"required"`
+}
+
+func TestStruct(t *testing.T) {
+	code := "12345"
+	tests := []struct {
+		name string
+		in   any
+		want []string // "field message"
+	}{
+		{"valid", user{Audit: Audit{By: "x"}, Name: "ada", Email: "a@example.com", Site: "https://example.com", ID: "123e4567-e89b-12d3-a456-426614174000", Role: "user"}, nil},
+		{"pointer", &user{Audit: Audit{By: "x"}, Name: "ada"}, nil},
+		{"nil", (*user)(nil), nil},
+		{"not a struct", 3, nil},
+		{"required", user{}, []string{"by is required", "name is required"}},
+		{"rules", user{
+			Audit: Audit{By: "x"}, Name: "ab", Email: "Ada <a@example.com>", Site: "/relative", ID: "nope",
+			Age: -1, Role: "root", Tags: []string{"a", "b", "c"}, Code: &code,
+		}, []string{
+			"name must be at least 3 characters long",
+			"email must be a valid email address",
+			"site must be an absolute URL",
+			"ID must be a UUID",
+			"age must be at least 0",
+			"role must be one of admin, user",
+			"tags must have at most 2 items",
+			"code must be exactly 4 characters long",
+		}},
+		{"nested", user{Audit: Audit{By: "x"}, Name: "ada", Address: &address{}, Previous: []address{{City: "a"}, {}}}, []string{
+			"address.city is required",
+			"previous[1].city is required",
+		}},
+		{"slice", []address{{}}, []string{"[0].city is required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := messages(t, Struct(tt.in)); !slices.Equal(got, tt.want) {
+				t.Errorf("Struct = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructWith_NameTag(t *testing.T) {
+	type config struct {
+		Port int `env:"PORT" validate:"min=1,max=65535"`
+	}
+	got := messages(t, StructWith(config{Port: 0}, Options{NameTag: "env"}))
+	if want := []string{"PORT must be at least 1"}; !slices.Equal(got, want) {
+		t.Errorf("StructWith = %q, want %q", got, want)
+	}
+}
+
+func TestStruct_InvalidTags(t *testing.T) {
+	for _, in := range []any{
+		struct {
+			A string `validate:"nope"`
+		}{},
+		struct {
+			A string `validate:"min=x"`
+		}{},
+		struct {
+			A bool `validate:"max=1"`
+		}{},
+		struct {
+			A int `validate:"email"`
+		}{},
+	} {
+		err := Struct(in)
+		var fields FieldErrors
+		if err == nil || errors.As(err, &fields) {
+			t.Errorf("Struct(%T) = %v, want a tag error", in, err)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("even", func(v reflect.Value, _ string) string {
+		if v.Int()%2 != 0 {
+			return "must be even"
+		}
+		return ""
+	})
+	type pair struct {
+		N int `json:"n" validate:"even"`
+	}
+	if got := messages(t, Struct(pair{N: 3})); !slices.Equal(got, []string{"n must be even"}) {
+		t.Errorf("Struct = %q", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Register(\"required\") did not panic")
+		}
+	}()
+	Register("required", nil)
+}
+
+func TestFieldErrors_Respond(t *testing.T) {
+	rec := httptest.NewRecorder()
+	respond.Error(rec, http.StatusBadRequest, Struct(address{}))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", rec.Code)
+	}
+	want := `{"detail":"validation failed","errors":[{"field":"city","message":"is required"}],"status":422,"title":"Unprocessable Entity","type":"about:blank"}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+}
+
+func messages(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var fields FieldErrors
+	if !errors.As(err, &fields) {
+		t.Fatalf("error = %v, want FieldErrors", err)
+	}
+	var out []string
+	for _, f := range fields {
+		out = append(out, f.Field+" "+f.Message)
+	}
+	return out
+}
+
+func TestStruct_ScalarRules(t *testing.T) {
+	type order struct {
+		At      string `json:"at" validate:"datetime"`
+		Due     string `json:"due" validate:"date"`
+		Timeout string `json:"timeout" validate:"duration"`
+		Total   string `json:"total" validate:"money=USD"`
+		Price   string `json:"price" validate:"money"`
+	}
+	if err := Struct(order{At: "2024-03-01 12:30:00Z", Due: "2024-03-01", Timeout: "PT5M", Total: "12.34", Price: "EUR 3"}); err != nil {
+		t.Errorf("Struct = %v, want nil", err)
+	}
+	got := messages(t, Struct(order{At: "now", Due: "2024-02-30", Timeout: "soon", Total: "12.345", Price: "3"}))
+	want := []string{
+		"at must be an RFC 3339 date-time",
+		"due must be a date in the form YYYY-MM-DD",
+		"timeout must be a duration such as 1h30m or PT1H30M",
+		"total must be an amount of USD with at most 2 decimal places",
+		"price must be an amount with a currency, such as USD 12.34",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Struct = %q, want %q", got, want)
+	}
+}
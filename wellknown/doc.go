@@ -0,0 +1,18 @@
+// Package wellknown serves the boilerplate routes every public web service
+// needs: /robots.txt, /favicon.ico and documents under /.well-known/.
+//
+// Register mounts them all on a ServeMux in one call:
+//
+//	wellknown.Register(mux, wellknown.Options{
+//	    Favicon:           faviconBytes,
+//	    SecurityTxt:       "Contact: mailto:security@example.com\nExpires: 2027-01-01T00:00:00Z\n",
+//	    ChangePasswordURL: "/account/password",
+//	})
+//
+// robots.txt is environment-aware: it serves Options.Robots (allow
+// everything by default) only when the request context carries a
+// config.ServerConfig for the Production environment, as it does when served
+// by the server package. Local and Test deployments, and requests without a
+// configuration, are told to crawl nothing, so staging sites stay out of
+// search indexes.
+package wellknown
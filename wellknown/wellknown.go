@@ -0,0 +1,76 @@
+package wellknown
+
+import (
+	"net/http"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+)
+
+const (
+	// AllowAll is the default production robots.txt, permitting every crawler.
+	AllowAll = "User-agent: *\nAllow: /\n"
+	// DisallowAll is the robots.txt served outside Production.
+	DisallowAll = "User-agent: *\nDisallow: /\n"
+)
+
+// Options configures the routes mounted by Register. Zero values are defaults.
+type Options struct {
+	// Robots is the robots.txt served in Production. Empty means AllowAll.
+	Robots string
+	// Favicon is the icon served at /favicon.ico. When nil, /favicon.ico
+	// answers 204 No Content so browsers stop asking without logging 404s.
+	Favicon []byte
+	// FaviconType is the Content-Type of Favicon. Empty means it is
+	// detected from the content.
+	FaviconType string
+	// SecurityTxt is served at /.well-known/security.txt (RFC 9116). Empty
+	// means the route is not mounted.
+	SecurityTxt string
+	// ChangePasswordURL is where /.well-known/change-password redirects, so
+	// password managers can find the change password page. Empty means the
+	// route is not mounted.
+	ChangePasswordURL string
+}
+
+// Register mounts /robots.txt, /favicon.ico and the configured /.well-known/
+// routes on mux for GET and HEAD requests. It panics if any of the routes is
+// already registered, as http.ServeMux does.
+func Register(mux *http.ServeMux, opts Options) {
+	robots := opts.Robots
+	if robots == "" {
+		robots = AllowAll
+	}
+	mux.HandleFunc("GET /robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		body := DisallowAll
+		if cfg, ok := config.FromContext(r.Context()); ok && cfg.Environment == config.Production {
+			body = robots
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(body))
+	})
+
+	mux.HandleFunc("GET /favicon.ico", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		if opts.Favicon == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		contentType := opts.FaviconType
+		if contentType == "" {
+			contentType = http.DetectContentType(opts.Favicon)
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(opts.Favicon)
+	})
+
+	if opts.SecurityTxt != "" {
+		mux.HandleFunc("GET /.well-known/security.txt", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(opts.SecurityTxt))
+		})
+	}
+
+	if opts.ChangePasswordURL != "" {
+		mux.Handle("GET /.well-known/change-password", http.RedirectHandler(opts.ChangePasswordURL, http.StatusFound))
+	}
+}
@@ -0,0 +1,81 @@
+package wellknown
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/harrydayexe/GoWebUtilities/config"
+)
+
+// serve sends a GET request for path to mux, with cfg in the request context
+// when env is not empty.
+func serve(mux *http.ServeMux, env config.Environment, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	if env != "" {
+		req = req.WithContext(config.NewContext(context.Background(), config.ServerConfig{Environment: env}))
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestRobots(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux, Options{Robots: "User-agent: *\nDisallow: /admin\n"})
+
+	tests := []struct {
+		env  config.Environment
+		want string
+	}{
+		{config.Production, "User-agent: *\nDisallow: /admin\n"},
+		{config.Test, DisallowAll},
+		{config.Local, DisallowAll},
+		{"", DisallowAll},
+	}
+	for _, tt := range tests {
+		w := serve(mux, tt.env, "/robots.txt")
+		if w.Code != http.StatusOK || w.Body.String() != tt.want {
+			t.Errorf("env %q: got %d %q, want %q", tt.env, w.Code, w.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestFavicon(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux, Options{})
+	if w := serve(mux, "", "/favicon.ico"); w.Code != http.StatusNoContent {
+		t.Errorf("status without favicon = %d, want 204", w.Code)
+	}
+
+	icon := []byte("\x89PNG\r\n\x1a\n")
+	mux = http.NewServeMux()
+	Register(mux, Options{Favicon: icon})
+	w := serve(mux, "", "/favicon.ico")
+	if w.Code != http.StatusOK || w.Body.String() != string(icon) {
+		t.Errorf("got %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "image/png" {
+		t.Errorf("Content-Type = %q, want image/png", got)
+	}
+}
+
+func TestWellKnown(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux, Options{SecurityTxt: "Contact: mailto:sec@example.com\n", ChangePasswordURL: "/account/password"})
+
+	if w := serve(mux, "", "/.well-known/security.txt"); w.Body.String() != "Contact: mailto:sec@example.com\n" {
+		t.Errorf("security.txt = %q", w.Body.String())
+	}
+	w := serve(mux, "", "/.well-known/change-password")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/account/password" {
+		t.Errorf("change-password = %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	mux = http.NewServeMux()
+	Register(mux, Options{})
+	if w := serve(mux, "", "/.well-known/security.txt"); w.Code != http.StatusNotFound {
+		t.Errorf("unconfigured security.txt status = %d, want 404", w.Code)
+	}
+}